@@ -0,0 +1,88 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	errorsutil "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/device-plugin/nvidiadevice/nvinternal/plugin"
+	"github.com/Project-HAMi/HAMi/pkg/util/health"
+)
+
+// runningPlugins holds the plugins of the current run, replaced on every restart.
+var runningPlugins atomic.Pointer[[]plugin.Interface]
+
+// pluginsReady fails unless every plugin with devices to serve is ready, and there is at least one.
+func pluginsReady() error {
+	plugins := runningPlugins.Load()
+	if plugins == nil {
+		return errors.New("plugins are not started yet")
+	}
+	errs := []error{}
+	serving := 0
+	for _, p := range *plugins {
+		if len(p.Devices()) == 0 {
+			continue
+		}
+		serving++
+		errs = append(errs, p.Ready())
+	}
+	if serving == 0 {
+		return errors.New("no plugin has devices to serve")
+	}
+	return errorsutil.NewAggregate(errs)
+}
+
+// serveRuntime serves the result of the last container runtime check.
+func serveRuntime(w http.ResponseWriter, _ *http.Request) {
+	info := plugin.DetectedRuntime()
+	if info == nil {
+		http.Error(w, "container runtime not checked yet", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		klog.Errorf("Failed to write container runtime: %v", err)
+	}
+}
+
+// serveHealth serves /healthz, which fails once the GPUs can't be discovered, e.g. because NVML
+// is unreachable, and /readyz, which also needs every plugin to be registered with the kubelet
+// and on the node. /debug/runtime serves the detected container runtime and /metrics the device
+// plugin metrics.
+func serveHealth(addr string) {
+	discovery := health.Check{Name: "device-discovery", Check: plugin.DiscoveryCheck}
+	reg := prometheus.NewRegistry()
+	plugin.RegisterMetrics(reg)
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", health.Handler("healthz", discovery))
+	mux.Handle("/readyz", health.Handler("readyz", discovery, health.Check{Name: "device-plugins", Check: pluginsReady}))
+	mux.HandleFunc("/debug/runtime", serveRuntime)
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	klog.Infof("Serving health checks on %s", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		klog.Errorf("Failed to serve health checks on %s: %v", addr, err)
+	}
+}
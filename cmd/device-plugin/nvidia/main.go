@@ -31,6 +31,7 @@ import (
 	"k8s.io/klog/v2"
 	kubeletdevicepluginv1beta1 "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
 
+	"github.com/Project-HAMi/HAMi/pkg/audit"
 	"github.com/Project-HAMi/HAMi/pkg/device-plugin/nvidiadevice/nvinternal/info"
 	"github.com/Project-HAMi/HAMi/pkg/device-plugin/nvidiadevice/nvinternal/plugin"
 	"github.com/Project-HAMi/HAMi/pkg/device-plugin/nvidiadevice/nvinternal/rm"
@@ -197,6 +198,24 @@ func start(c *cli.Context, flags []cli.Flag) error {
 	klog.Info("Starting OS watcher.")
 	sigs := newOSWatcher(syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 
+	if addr := c.String("health-bind-address"); addr != "" {
+		go serveHealth(addr)
+	}
+
+	// The auditor outlives the restarts of the plugins.
+	stopAuditor := make(chan struct{})
+	defer close(stopAuditor)
+	plugin.Auditor, err = audit.Start(audit.SourceDevicePlugin, audit.Config{
+		SinkURL:    c.String("audit-sink-url"),
+		SinkType:   c.String("audit-sink-type"),
+		KafkaTopic: c.String("audit-kafka-topic"),
+		BufferSize: c.Int("audit-buffer-size"),
+		SpoolPath:  c.String("audit-spool-path"),
+	}, stopAuditor)
+	if err != nil {
+		klog.Errorf("Failed to start the audit recorder, allocation auditing disabled: %v", err)
+	}
+
 	var restarting bool
 	var restartTimeout <-chan time.Time
 	var plugins []plugin.Interface
@@ -214,6 +233,7 @@ restart:
 	if err != nil {
 		return fmt.Errorf("error starting plugins: %v", err)
 	}
+	runningPlugins.Store(ptr(plugins))
 
 	if restartPlugins {
 		klog.Info("Failed to start one or more plugins. Retrying in 30s...")
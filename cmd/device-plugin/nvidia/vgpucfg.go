@@ -21,6 +21,7 @@ import (
 	"os"
 	"strings"
 
+	"github.com/Project-HAMi/HAMi/pkg/audit"
 	"github.com/Project-HAMi/HAMi/pkg/device"
 	"github.com/Project-HAMi/HAMi/pkg/device-plugin/nvidiadevice/nvinternal/plugin"
 	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
@@ -68,6 +69,156 @@ func addFlags() []cli.Flag {
 			Value: "nvidia.com/gpu",
 			Usage: "the name of field for number GPU visible in container",
 		},
+		&cli.DurationFlag{
+			Name:    "utilization-sample-interval",
+			Value:   0,
+			Usage:   "how often the live SM and memory bandwidth utilization of the GPUs is published to the node, 0 disables it",
+			EnvVars: []string{"UTILIZATION_SAMPLE_INTERVAL"},
+		},
+		&cli.DurationFlag{
+			Name:    "energy-sample-interval",
+			Value:   0,
+			Usage:   "how often the energy of the GPUs is sampled and attributed to the pods on them in the hami_device_plugin_pod_gpu_energy_joules_total metric, 0 disables it",
+			EnvVars: []string{"ENERGY_SAMPLE_INTERVAL"},
+		},
+		&cli.IntFlag{
+			Name:    "allocate-failure-threshold",
+			Value:   plugin.AllocateFailureThreshold,
+			Usage:   "the number of consecutive allocation failures after which a GPU is quarantined, 0 disables the quarantine",
+			EnvVars: []string{"ALLOCATE_FAILURE_THRESHOLD"},
+		},
+		&cli.DurationFlag{
+			Name:    "quarantine-backoff",
+			Value:   plugin.QuarantineBackoff,
+			Usage:   "how long a GPU is quarantined the first time, doubled on every further failure up to 1h",
+			EnvVars: []string{"QUARANTINE_BACKOFF"},
+		},
+		&cli.DurationFlag{
+			Name:    "list-and-watch-debounce",
+			Value:   plugin.ListAndWatchDebounce,
+			Usage:   "how long to wait after a change of the devices before sending them to the kubelet, so rapid changes are sent once, 0 sends them right away",
+			EnvVars: []string{"LIST_AND_WATCH_DEBOUNCE"},
+		},
+		&cli.DurationFlag{
+			Name:    "drain-timeout",
+			Value:   plugin.DrainTimeout,
+			Usage:   "how long to wait for in-flight allocations to finish on shutdown",
+			EnvVars: []string{"DRAIN_TIMEOUT"},
+		},
+		&cli.StringFlag{
+			Name:    "co-tenant-xid-policy",
+			Value:   "",
+			Usage:   "what to do with the other pods on a shared GPU hit by an application Xid after one of its pods exited: restart, reschedule, or empty to leave them alone",
+			EnvVars: []string{"CO_TENANT_XID_POLICY"},
+		},
+		&cli.DurationFlag{
+			Name:    "co-tenant-xid-window",
+			Value:   plugin.CoTenantXidWindow,
+			Usage:   "how long after a pod on a shared GPU exited an application Xid on the GPU is attributed to its exit",
+			EnvVars: []string{"CO_TENANT_XID_WINDOW"},
+		},
+		&cli.StringFlag{
+			Name:    "health-bind-address",
+			Value:   "",
+			Usage:   "the address to serve /healthz, /readyz and /metrics on, e.g. :9396, empty disables them",
+			EnvVars: []string{"HEALTH_BIND_ADDRESS"},
+		},
+		&cli.BoolFlag{
+			Name:    "mig-auto-reconfig",
+			Value:   false,
+			Usage:   "re-partition idle GPUs in mig mode into the geometry serving the most unschedulable pods, only on nodes labeled hami.io/mig-reconfig=allowed",
+			EnvVars: []string{"MIG_AUTO_RECONFIG"},
+		},
+		&cli.DurationFlag{
+			Name:    "mig-reconfig-interval",
+			Value:   plugin.MigReconfigInterval,
+			Usage:   "how often the pending pods are checked for MIG geometries the idle GPUs aren't partitioned with",
+			EnvVars: []string{"MIG_RECONFIG_INTERVAL"},
+		},
+		&cli.Float64Flag{
+			Name:    "memory-pressure-threshold",
+			Value:   0,
+			Usage:   "fraction of the memory of a GPU in use at which a pod annotated with hami.io/gpu-tier=best-effort is evicted from it, 0 disables it",
+			EnvVars: []string{"MEMORY_PRESSURE_THRESHOLD"},
+		},
+		&cli.StringFlag{
+			Name:    "stock-plugin-resource",
+			Value:   "",
+			Usage:   "resource of the stock NVIDIA device plugin running next to HAMi, e.g. nvidia.com/gpu, the GPUs it hands out to pods are withdrawn, empty disables it",
+			EnvVars: []string{"STOCK_PLUGIN_RESOURCE"},
+		},
+		&cli.StringFlag{
+			Name:    "textfile-path",
+			Value:   "",
+			Usage:   "file ending in .prom the per-GPU allocation metrics are written to for the textfile collector of node-exporter, empty disables it",
+			EnvVars: []string{"TEXTFILE_PATH"},
+		},
+		&cli.DurationFlag{
+			Name:    "textfile-interval",
+			Value:   plugin.TextfileInterval,
+			Usage:   "how often the textfile of --textfile-path is written",
+			EnvVars: []string{"TEXTFILE_INTERVAL"},
+		},
+		&cli.StringFlag{
+			Name:    "runtime-check",
+			Value:   plugin.RuntimeCheck,
+			Usage:   "what to do when the container runtime won't mount the allocated GPUs into containers: warn, enforce to advertise no GPUs, or off",
+			EnvVars: []string{"RUNTIME_CHECK"},
+		},
+		&cli.BoolFlag{
+			Name:    "wake-idle-gpus",
+			Value:   false,
+			Usage:   "lock the graphics clock of the GPUs found in a low power state before registering them, so they stay ready to run kernels at the cost of their idle power",
+			EnvVars: []string{"WAKE_IDLE_GPUS"},
+		},
+		&cli.StringFlag{
+			Name:    "device-discovery",
+			Value:   plugin.DeviceDiscoveryNVML,
+			Usage:   "how the GPUs of the node are found: nvml asks the driver, fake serves the GPUs of --fake-devices, e.g. to run the plugin on nodes without GPUs",
+			EnvVars: []string{"DEVICE_DISCOVERY"},
+		},
+		&cli.StringFlag{
+			Name:    "fake-devices",
+			Value:   "",
+			Usage:   "the GPUs served with --device-discovery=fake, a JSON list like [{\"uuid\":\"GPU-0\",\"model\":\"Tesla T4\",\"memory\":15360}] or the path of a file holding one",
+			EnvVars: []string{"FAKE_DEVICES"},
+		},
+		&cli.BoolFlag{
+			Name:    "enable-dra",
+			Value:   false,
+			Usage:   "publish the GPU slots in ResourceSlices and prepare the ResourceClaims allocated to them",
+			EnvVars: []string{"ENABLE_DRA"},
+		},
+		&cli.StringFlag{
+			Name:    "audit-sink-url",
+			Value:   "",
+			Usage:   "endpoint to deliver the audit records of the devices allocated to containers to, empty disables auditing",
+			EnvVars: []string{"AUDIT_SINK_URL"},
+		},
+		&cli.StringFlag{
+			Name:    "audit-sink-type",
+			Value:   audit.SinkTypeWebhook,
+			Usage:   "audit sink type: webhook or kafka-rest",
+			EnvVars: []string{"AUDIT_SINK_TYPE"},
+		},
+		&cli.StringFlag{
+			Name:    "audit-kafka-topic",
+			Value:   "",
+			Usage:   "kafka topic used by the kafka-rest audit sink",
+			EnvVars: []string{"AUDIT_KAFKA_TOPIC"},
+		},
+		&cli.IntFlag{
+			Name:    "audit-buffer-size",
+			Value:   10000,
+			Usage:   "max number of undelivered audit records buffered",
+			EnvVars: []string{"AUDIT_BUFFER_SIZE"},
+		},
+		&cli.StringFlag{
+			Name:    "audit-spool-path",
+			Value:   "",
+			Usage:   "file undelivered audit records are kept in across restarts, empty keeps them in memory only",
+			EnvVars: []string{"AUDIT_SPOOL_PATH"},
+		},
 	}
 	return addition
 }
@@ -108,6 +259,63 @@ func generateDeviceConfigFromNvidia(cfg *spec.Config, c *cli.Context, flags []cl
 			if strings.Compare(n, "config-file") == 0 {
 				updateFromCLIFlag(&plugin.ConfigFile, c, n)
 			}
+			if strings.Compare(n, "utilization-sample-interval") == 0 {
+				plugin.UtilizationSampleInterval = c.Duration(n)
+			}
+			if strings.Compare(n, "energy-sample-interval") == 0 {
+				plugin.EnergySampleInterval = c.Duration(n)
+			}
+			if strings.Compare(n, "allocate-failure-threshold") == 0 {
+				plugin.AllocateFailureThreshold = c.Int(n)
+			}
+			if strings.Compare(n, "quarantine-backoff") == 0 {
+				plugin.QuarantineBackoff = c.Duration(n)
+			}
+			if strings.Compare(n, "list-and-watch-debounce") == 0 {
+				plugin.ListAndWatchDebounce = c.Duration(n)
+			}
+			if strings.Compare(n, "drain-timeout") == 0 {
+				plugin.DrainTimeout = c.Duration(n)
+			}
+			if strings.Compare(n, "co-tenant-xid-policy") == 0 {
+				plugin.CoTenantXidPolicy = c.String(n)
+			}
+			if strings.Compare(n, "co-tenant-xid-window") == 0 {
+				plugin.CoTenantXidWindow = c.Duration(n)
+			}
+			if strings.Compare(n, "mig-auto-reconfig") == 0 {
+				plugin.MigAutoReconfig = c.Bool(n)
+			}
+			if strings.Compare(n, "mig-reconfig-interval") == 0 {
+				plugin.MigReconfigInterval = c.Duration(n)
+			}
+			if strings.Compare(n, "memory-pressure-threshold") == 0 {
+				plugin.MemoryPressureThreshold = c.Float64(n)
+			}
+			if strings.Compare(n, "stock-plugin-resource") == 0 {
+				plugin.StockPluginResource = c.String(n)
+			}
+			if strings.Compare(n, "textfile-path") == 0 {
+				plugin.TextfilePath = c.String(n)
+			}
+			if strings.Compare(n, "textfile-interval") == 0 {
+				plugin.TextfileInterval = c.Duration(n)
+			}
+			if strings.Compare(n, "runtime-check") == 0 {
+				plugin.RuntimeCheck = c.String(n)
+			}
+			if strings.Compare(n, "wake-idle-gpus") == 0 {
+				plugin.WakeIdleGPUs = c.Bool(n)
+			}
+			if strings.Compare(n, "device-discovery") == 0 {
+				plugin.DeviceDiscovery = c.String(n)
+			}
+			if strings.Compare(n, "fake-devices") == 0 {
+				plugin.FakeDevices = c.String(n)
+			}
+			if strings.Compare(n, "enable-dra") == 0 {
+				plugin.EnableDRA = c.Bool(n)
+			}
 		}
 	}
 
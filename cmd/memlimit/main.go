@@ -0,0 +1,178 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+var (
+	gpumem           string
+	gpumemPercentage string
+	limit            string
+	cardMemory       int64
+	deviceConfigFile string
+
+	rootCmd = &cobra.Command{
+		Use:   "memlimit",
+		Short: "Show the device memory limit HAMi-core enforces for a request",
+		Long: `memlimit resolves a GPU memory request the same way the HAMi webhook and
+scheduler do, formats it as the CUDA_DEVICE_MEMORY_LIMIT value the device plugin
+hands to the container and parses it back the way HAMi-core does.
+
+The JSON report is written to stdout, a human readable summary to stderr.`,
+		Example: `  memlimit --gpumem 3000
+  memlimit --gpumem-percentage 50 --card-memory 40960
+  memlimit --limit 2g --card-memory 16384`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return run()
+		},
+	}
+)
+
+func init() {
+	rootCmd.Flags().SortFlags = false
+	rootCmd.Flags().StringVar(&gpumem, "gpumem", "", "value of the GPU memory resource (e.g. nvidia.com/gpumem), in MiB")
+	rootCmd.Flags().StringVar(&gpumemPercentage, "gpumem-percentage", "", "value of the GPU memory percentage resource, requires --card-memory")
+	rootCmd.Flags().StringVar(&limit, "limit", "", "raw CUDA_DEVICE_MEMORY_LIMIT value to check, e.g. 3000m or 2g")
+	rootCmd.Flags().Int64Var(&cardMemory, "card-memory", 0, "memory of the target card in MiB, 0 if unknown")
+	rootCmd.Flags().StringVar(&deviceConfigFile, "device-config-file", "", "device config file of the scheduler, the built-in defaults are used if empty")
+	rootCmd.Flags().AddGoFlagSet(util.InitKlogFlags())
+}
+
+func run() error {
+	set := 0
+	for _, v := range []string{gpumem, gpumemPercentage, limit} {
+		if v != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("exactly one of --gpumem, --gpumem-percentage and --limit must be set")
+	}
+	cardBytes := util.MemoryToBytes(nvidia.NvidiaGPUDevice, cardMemory)
+
+	var report util.MemoryLimitReport
+	var err error
+	if limit != "" {
+		requested, perr := util.ParseMemoryLimitEnv(limit)
+		if perr != nil {
+			return perr
+		}
+		report, err = util.EvaluateMemoryLimit(limit, limit, requested, cardBytes)
+	} else {
+		requested, input, rerr := resolveRequest(cardBytes)
+		if rerr != nil {
+			return rerr
+		}
+		report, err = util.EvaluateMemoryLimit(input, util.MemoryLimitEnvValue(requested), requested, cardBytes)
+	}
+	if err != nil {
+		return err
+	}
+
+	out, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	printSummary(report)
+	return nil
+}
+
+// resolveRequest feeds the flags through the NVIDIA device's GenerateResourceRequests,
+// which is what the webhook and the scheduler use to read a container's resources.
+func resolveRequest(cardBytes int64) (int64, string, error) {
+	if err := initDevices(); err != nil {
+		return 0, "", err
+	}
+	dev, ok := device.GetDevices()[nvidia.NvidiaGPUDevice].(*nvidia.NvidiaGPUDevices)
+	if !ok {
+		return 0, "", fmt.Errorf("nvidia device is not configured")
+	}
+	countName, memName, memPercentageName := dev.ResourceNames()
+	ctr := &corev1.Container{
+		Resources: corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{
+				corev1.ResourceName(countName): *resource.NewQuantity(1, resource.DecimalSI),
+			},
+		},
+	}
+	name, value, input := memName, gpumem, memName+"="+gpumem
+	if gpumemPercentage != "" {
+		name, value, input = memPercentageName, gpumemPercentage, memPercentageName+"="+gpumemPercentage
+	}
+	q, err := resource.ParseQuantity(value)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid resource value %q: %v", value, err)
+	}
+	ctr.Resources.Limits[corev1.ResourceName(name)] = q
+
+	req := dev.GenerateResourceRequests(ctr)
+	if req.Nums == 0 {
+		return 0, "", fmt.Errorf("the request for %s is not a valid GPU request", input)
+	}
+	if req.Memreq > 0 {
+		return req.Memreq, input, nil
+	}
+	// Same as fitInCertainDevice: a percentage request is resolved against the chosen card.
+	if cardBytes == 0 {
+		return 0, "", fmt.Errorf("%s resolves to %d%% of the card memory, set --card-memory to evaluate it", input, req.MemPercentagereq)
+	}
+	return cardBytes * int64(req.MemPercentagereq) / 100, input, nil
+}
+
+func initDevices() error {
+	if deviceConfigFile == "" {
+		device.InitDefaultDevices()
+		return nil
+	}
+	config, err := device.LoadConfig(deviceConfigFile)
+	if err != nil {
+		return fmt.Errorf("failed to load device config file %s: %v", deviceConfigFile, err)
+	}
+	return device.InitDevicesWithConfig(config)
+}
+
+func printSummary(r util.MemoryLimitReport) {
+	fmt.Fprintf(os.Stderr, "%s: scheduled %d bytes (%.2f MiB), CUDA_DEVICE_MEMORY_LIMIT=%s, HAMi-core enforces %d bytes (%.2f MiB)\n",
+		r.Input, r.RequestedBytes, float64(r.RequestedBytes)/float64(util.MiB), r.Env, r.EffectiveBytes, float64(r.EffectiveBytes)/float64(util.MiB))
+	if r.RoundedBytes != 0 {
+		fmt.Fprintf(os.Stderr, "the limit is rounded up by %d bytes to a whole MiB\n", r.RoundedBytes)
+	}
+	if r.Warning != "" {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", r.Warning)
+	}
+}
+
+func main() {
+	if err := rootCmd.Execute(); err != nil {
+		klog.Fatal(err)
+	}
+}
@@ -17,9 +17,11 @@ limitations under the License.
 package main
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net/http"
 	"net/http/pprof"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/spf13/cobra"
@@ -32,6 +34,7 @@ import (
 	"github.com/Project-HAMi/HAMi/pkg/util"
 	"github.com/Project-HAMi/HAMi/pkg/util/client"
 	"github.com/Project-HAMi/HAMi/pkg/util/flag"
+	"github.com/Project-HAMi/HAMi/pkg/util/health"
 	"github.com/Project-HAMi/HAMi/pkg/version"
 )
 
@@ -64,9 +67,72 @@ func init() {
 	rootCmd.Flags().Int32Var(&config.DefaultCores, "default-cores", 0, "default gpu core percentage to allocate")
 	rootCmd.Flags().Int32Var(&config.DefaultResourceNum, "default-gpu", 1, "default gpu to allocate")
 	rootCmd.Flags().StringVar(&config.NodeSchedulerPolicy, "node-scheduler-policy", util.NodeSchedulerPolicyBinpack.String(), "node scheduler policy")
-	rootCmd.Flags().StringVar(&config.GPUSchedulerPolicy, "gpu-scheduler-policy", util.GPUSchedulerPolicySpread.String(), "GPU scheduler policy")
+	rootCmd.Flags().StringVar(&config.GPUSchedulerPolicy, "gpu-scheduler-policy", util.GPUSchedulerPolicySpread.String(), "GPU scheduler policy, binpack, spread or roundrobin")
 	rootCmd.Flags().StringVar(&config.MetricsBindAddress, "metrics-bind-address", ":9395", "The TCP address that the scheduler should bind to for serving prometheus metrics(e.g. 127.0.0.1:9395, :9395)")
 	rootCmd.Flags().StringToStringVar(&config.NodeLabelSelector, "node-label-selector", nil, "key=value pairs separated by commas")
+	rootCmd.Flags().Float64Var(&config.ImageLocalityWeight, "image-locality-weight", 0, "weight of the score preferring nodes which already cached the pod's images, 0 disables it")
+	rootCmd.Flags().StringSliceVar(&config.IsolatedNamespaces, "isolated-namespaces", nil, "namespaces whose pods share cards only with pods of the same namespace, pods can override with the hami.io/namespace-isolation annotation")
+	rootCmd.Flags().StringVar(&config.CUDAVersionCheck, "cuda-version-check", scheduler.CUDAVersionCheckWarn, "what is done with pods whose hami.io/cuda-version the driver of a node doesn't support: off ignores it, warn records a warning on the pod placed there, filter excludes the node")
+	rootCmd.Flags().Float64Var(&config.PerfTierWeight, "perf-tier-weight", 10, "weight of the score preferring higher performance tier cards for latency-sensitive pods, 0 disables it")
+	rootCmd.Flags().Float64Var(&config.UtilizationWeight, "utilization-weight", 0, "weight of the score preferring cards with lower live SM and memory bandwidth utilization for latency-sensitive pods, 0 disables it")
+	rootCmd.Flags().DurationVar(&config.UtilizationMaxAge, "utilization-max-age", 2*time.Minute, "utilization samples older than this are ignored by the utilization score")
+	rootCmd.Flags().Float64Var(&config.PCIeContentionWeight, "pcie-contention-weight", 0, "weight of the score preferring PCIe switches with fewer bandwidth-heavy pods for pods annotated with hami.io/pcie-bandwidth-heavy, 0 disables it")
+	rootCmd.Flags().Float64Var(&config.NoiseToleranceWeight, "noise-tolerance-weight", 10, "weight of the score preferring cards with fewer and less busy co-tenants for pods with a low hami.io/noise-tolerance, 0 disables it")
+	rootCmd.Flags().Float64Var(&config.MemoryTypeWeight, "memory-type-weight", 10, "weight of the score preferring cards with the memory type of hami.io/preferred-gpu-memory-type, 0 disables it")
+	rootCmd.Flags().Float64Var(&config.ECCErrorWeight, "ecc-error-weight", 10, "weight of the score preferring cards with fewer ECC errors in the last 24 hours, 0 disables it")
+	rootCmd.Flags().IntVar(&config.ECCCorrectedThreshold, "ecc-corrected-threshold", 0, "corrected ECC errors in the last 24 hours from which a card takes no new pods, 0 disables it")
+	rootCmd.Flags().IntVar(&config.GPUTemperatureThreshold, "gpu-temperature-threshold", 0, "GPU temperature in degrees Celsius from which a card takes no new pods, 0 disables it")
+	rootCmd.Flags().IntVar(&config.GPUTemperatureSoftThreshold, "gpu-temperature-soft-threshold", 0, "GPU temperature in degrees Celsius above which cards are avoided, the more the hotter, 0 disables it")
+	rootCmd.Flags().Float64Var(&config.GPUTemperatureWeight, "gpu-temperature-weight", 10, "weight of the score avoiding cards above --gpu-temperature-soft-threshold")
+	rootCmd.Flags().Float64Var(&config.PerformanceStateWeight, "performance-state-weight", 0, "weight of the score preferring cards in a high performance state for pods annotated with hami.io/latency-sensitive, 0 disables it")
+	rootCmd.Flags().IntVar(&config.ECCUncorrectedThreshold, "ecc-uncorrected-threshold", 1, "uncorrected ECC errors in the last 24 hours from which a card takes no new pods, 0 disables it")
+	rootCmd.Flags().IntVar(&config.ExtenderMaxConcurrency, "extender-max-concurrency", 32, "max number of filter requests served concurrently, 0 means unlimited")
+	rootCmd.Flags().IntVar(&config.ExtenderMaxQueue, "extender-max-queue", 128, "max number of filter requests waiting for a free slot before being rejected")
+	rootCmd.Flags().DurationVar(&config.ExtenderQueueTimeout, "extender-queue-timeout", 3*time.Second, "max time a filter request waits for a free slot before being rejected")
+	rootCmd.Flags().DurationVar(&config.StickyPlacementTTL, "sticky-placement-ttl", 30*time.Minute, "how long the previous cards of a deleted pod using hami.io/sticky-placement are preferred")
+	rootCmd.Flags().StringVar(&config.FabricNodeLabel, "fabric-node-label", "hami.io/interconnect-fabric", "node label holding the interconnect fabric matched against the hami.io/interconnect-fabric pod annotation")
+	rootCmd.Flags().StringVar(&config.MetricsSidecarImage, "metrics-sidecar-image", "", "image of the GPU metrics sidecar injected into GPU pods, empty disables injection")
+	rootCmd.Flags().StringSliceVar(&config.MetricsSidecarArgs, "metrics-sidecar-args", nil, "arguments of the GPU metrics sidecar")
+	rootCmd.Flags().StringSliceVar(&config.MetricsSidecarNamespaces, "metrics-sidecar-namespaces", nil, "namespaces where the metrics sidecar is injected by default, pods can override with the hami.io/metrics-sidecar annotation")
+	rootCmd.Flags().StringVar(&config.MetricsSidecarCacheHostPath, "metrics-sidecar-cache-host-path", "/usr/local/vgpu/containers", "host directory holding the per-container HAMi-core caches")
+	rootCmd.Flags().StringSliceVar(&config.AMDGPUTranslationNamespaces, "amd-gpu-translation-namespaces", nil, "namespaces where the amd.com/gpu resources of pods are translated into whole Hygon DCUs, for migrating from the ROCm device plugin")
+	rootCmd.Flags().StringVar(&config.AuditSinkURL, "audit-sink-url", "", "endpoint to deliver GPU allocation audit records to, empty disables auditing")
+	rootCmd.Flags().StringVar(&config.AuditSinkType, "audit-sink-type", "webhook", "audit sink type: webhook or kafka-rest")
+	rootCmd.Flags().StringVar(&config.AuditKafkaTopic, "audit-kafka-topic", "", "kafka topic used by the kafka-rest audit sink")
+	rootCmd.Flags().IntVar(&config.AuditBufferSize, "audit-buffer-size", 10000, "max number of undelivered audit records buffered")
+	rootCmd.Flags().StringVar(&config.AuditSpoolPath, "audit-spool-path", "", "file undelivered audit records are kept in across restarts, empty keeps them in memory only")
+	rootCmd.Flags().StringVar(&config.ProfileConfigFile, "profile-config-file", "", "file with the global HAMi policy and the policies per kube-scheduler profile, matched by the schedulerName of the pod, reloaded when it changes")
+	rootCmd.Flags().DurationVar(&config.DriftCheckInterval, "drift-check-interval", 5*time.Minute, "how often recorded GPU allocations are checked against the capacity advertised by each node, 0 disables it")
+	rootCmd.Flags().BoolVar(&config.DriftAutoCorrect, "drift-auto-correct", false, "refresh the node capacity and release allocations of pods which no longer exist when drift is found")
+	rootCmd.Flags().IntVar(&config.DecisionCacheSize, "decision-cache-size", 1000, "number of recent scheduling decisions served by /debug/decisions/:uid, 0 disables it")
+	rootCmd.Flags().DurationVar(&config.ReservationMaxTTL, "reservation-max-ttl", 5*time.Minute, "longest time a reservation of /reservations holds capacity for pods not created yet, 0 disables reservations")
+	rootCmd.Flags().DurationVar(&config.ResumeReservationTTL, "resume-reservation-ttl", 0, "how long the GPU capacity of the pods of a Job, ReplicaSet or StatefulSet resumed after being suspended or scaled to zero is held for them, 0 disables it")
+	rootCmd.Flags().StringVar(&config.FilterRecordFile, "filter-record-file", "", "file every filter request and its outcome is appended to as JSON lines for replay through /plan, - writes them to the log, empty disables it")
+	rootCmd.Flags().StringSliceVar(&config.FilterRecordRedact, "filter-record-redact", []string{scheduler.RedactEnv, scheduler.RedactCommand}, "pod fields redacted in filter records: env, command, image, labels, or annotation keys")
+	rootCmd.Flags().IntVar(&config.BindRetryCount, "bind-retry-count", 3, "number of retries of a bind failing with a conflict, a held node lock or a transient API server error, 0 disables retries")
+	rootCmd.Flags().DurationVar(&config.BindRetryBackoff, "bind-retry-backoff", 200*time.Millisecond, "wait before the first bind retry, doubled on every further retry")
+	rootCmd.Flags().DurationVar(&config.BindRetryBudget, "bind-retry-budget", 10*time.Second, "how long binds and the device assignments of the filter are written again while the API server is unreachable, 0 disables it")
+	rootCmd.Flags().DurationVar(&config.NodeLockCoalesceWindow, "node-lock-coalesce-window", 0, "how long the release of the node locks of a failed bind is deferred, so a retry or the next pod on the same node takes them over, 0 releases them right away")
+	rootCmd.Flags().BoolVar(&config.CompactDeviceAnnotations, "compact-device-annotations", false, "write the devices assigned to pods gzip compressed, enable it once every device plugin reads the compact format")
+	rootCmd.Flags().IntVar(&config.DeviceAnnotationOverflowSize, "device-annotation-overflow-size", 0, "size in bytes above which the devices assigned to a pod are kept in a ConfigMap of its node instead of the annotation, 0 keeps them on the pod")
+	rootCmd.Flags().StringVar(&config.DeviceAnnotationOverflowNamespace, "device-annotation-overflow-namespace", "kube-system", "namespace of the ConfigMaps holding the overflowing device annotations of pods")
+	rootCmd.Flags().BoolVar(&config.EnableDRA, "enable-dra", false, "account for the GPU slots allocated to ResourceClaims from the gpu.hami.io DRA driver, requires the resource.k8s.io/v1beta1 API")
+	rootCmd.Flags().Float64Var(&config.FairnessAgingWeight, "fairness-aging-weight", 0, "priority a pod waiting for devices gains per minute, a pod ahead by 1 holds the room it fits into, 0 disables it")
+	rootCmd.Flags().BoolVar(&config.NVLinkFabricGate, "nvlink-fabric-gate", true, "keep pods with more than one NVIDIA GPU off nodes with an unhealthy NVLink fabric")
+	rootCmd.Flags().DurationVar(&config.EventAggregationWindow, "event-aggregation-window", 10*time.Minute, "time within which identical events on the same object are recorded once, 0 records every event")
+	rootCmd.Flags().BoolVar(&config.GPUReclaim, "gpu-reclaim", false, "let a pod which fits nowhere evict pods with a lower GPU reclaim priority to free shared cards")
+	rootCmd.Flags().StringSliceVar(&config.GPUReclaimPriorityNamespaces, "gpu-reclaim-priority-namespaces", nil, "namespaces whose pods may raise their GPU reclaim priority above their PriorityClass with the hami.io/gpu-reclaim-priority annotation, elsewhere it can only lower it")
+	rootCmd.Flags().BoolVar(&config.TFLOPSRequests, "tflops-requests", false, "experimental: let pods request the cores of a card by throughput with the hami.io/tflops annotation")
+	rootCmd.Flags().Float64Var(&config.MemoryOversubscriptionRatio, "memory-oversubscription-ratio", 0, "how many times the memory of a card pods annotated with hami.io/gpu-tier=best-effort may reserve, values up to 1 disable it")
+	rootCmd.Flags().Float64Var(&config.CoreOvercommit, "core-overcommit", 1, "how many times the cores of every card may be allocated, independently of the memory, scheduler profiles may override it")
+	rootCmd.Flags().BoolVar(&config.NodeExtendedResources, "node-extended-resources", false, "publish the memory and cores of every device type of a node, and the part allocated to pods, as node extended resources")
+	rootCmd.Flags().BoolVar(&config.GPUAllocationCRD, "gpu-allocation-crd", false, "publish the devices of every node and their allocations to pods as GPUAllocation custom resources, the CRD must be installed")
+	rootCmd.Flags().IntVar(&config.DevicePluginVersionSkew, "device-plugin-version-skew", 1, "how many minor versions the device plugin of a node may be apart from the scheduler, with the same major version, for GPU pods to be placed on the node, negative disables the check")
+	rootCmd.Flags().IntVar(&config.MaxCardsPerPod, "max-cards-per-pod", 0, "max number of distinct cards the devices of a single pod may span, 0 is unlimited")
+	rootCmd.Flags().StringSliceVar(&config.CostCenters, "cost-centers", nil, "values of the hami.io/cost-center pod annotation allocation metrics are labeled with, others are labeled other, empty disables the label")
+	rootCmd.Flags().DurationVar(&config.GPUTypeFallbackAfter, "gpu-type-fallback-after", 10*time.Minute, "how long a pod annotated with hami.io/gpu-type-order waits for one type of its order before it also accepts the next one, 0 accepts all of them right away")
+	rootCmd.Flags().StringVar(&config.ZeroHealthyGPUPolicy, "zero-healthy-gpu-policy", scheduler.ZeroHealthyGPUExclude, "how nodes whose GPUs are all unhealthy are reported to kube-scheduler: exclude marks them unresolvable, keep leaves them in consideration for preemption until a GPU recovers")
+	rootCmd.Flags().StringVar(&config.GPUMemoryPadding, "gpu-memory-padding", "0", "memory the webhook adds to every nvidia.com/gpumem request for the CUDA context, a quantity like 256Mi or a percentage like 10%, 0 disables it")
 	// add QPS and Burst to the global flagset
 	// qps and burst settings for the client-go client
 	rootCmd.Flags().Float32Var(&config.QPS, "kube-qps", 5.0, "QPS to use while talking with kube-apiserver.")
@@ -99,9 +165,29 @@ func injectProfilingRoute(router *httprouter.Router) {
 }
 
 func start() error {
+	if err := scheduler.ValidateZeroHealthyGPUPolicy(config.ZeroHealthyGPUPolicy); err != nil {
+		return err
+	}
+	if err := scheduler.ValidateGPUMemoryPadding(config.GPUMemoryPadding); err != nil {
+		return err
+	}
+	if err := scheduler.ValidateCUDAVersionCheck(config.CUDAVersionCheck); err != nil {
+		return err
+	}
 	client.InitGlobalClient(client.WithBurst(config.Burst), client.WithQPS(config.QPS))
 	device.InitDevices()
 	sher = scheduler.NewScheduler()
+	if err := sher.LoadProfiles(config.ProfileConfigFile); err != nil {
+		return fmt.Errorf("failed to load scheduler profiles from %s: %v", config.ProfileConfigFile, err)
+	}
+	if config.ProfileConfigFile != "" {
+		if err := sher.WatchPolicyFile(config.ProfileConfigFile); err != nil {
+			return fmt.Errorf("failed to watch scheduler profiles %s: %v", config.ProfileConfigFile, err)
+		}
+	}
+	if err := sher.OpenFilterRecords(config.FilterRecordFile, config.FilterRecordRedact); err != nil {
+		return fmt.Errorf("failed to open filter records %s: %v", config.FilterRecordFile, err)
+	}
 	sher.Start()
 	defer sher.Stop()
 
@@ -111,10 +197,37 @@ func start() error {
 
 	// start http server
 	router := httprouter.New()
-	router.POST("/filter", routes.PredicateRoute(sher))
+	limiter := routes.NewLimiter(config.ExtenderMaxConcurrency, config.ExtenderMaxQueue, config.ExtenderQueueTimeout)
+	// Only filter is limited: kube-scheduler retries the pod of a rejected filter, while a
+	// rejected bind fails a pod the devices were already assigned to.
+	router.POST("/filter", limiter.Limit("filter", routes.PredicateRoute(sher)))
 	router.POST("/bind", routes.Bind(sher))
+	router.POST("/plan", routes.PlanRoute(sher))
+	if config.ReservationMaxTTL > 0 {
+		router.POST("/reservations", routes.ReserveRoute(sher))
+		router.DELETE("/reservations/:token", routes.ReleaseReservationRoute(sher))
+	}
 	router.POST("/webhook", routes.WebHookRoute())
-	router.GET("/healthz", routes.HealthzRoute())
+	readyChecks := []health.Check{{Name: "node-cache", Check: sher.CacheSynced}}
+	var cert tls.Certificate
+	serveTLS := len(tlsCertFile) != 0 && len(tlsKeyFile) != 0
+	if serveTLS {
+		var err error
+		if cert, err = tls.LoadX509KeyPair(tlsCertFile, tlsKeyFile); err != nil {
+			return fmt.Errorf("failed to load the serving certificate: %v", err)
+		}
+		readyChecks = append(readyChecks, health.CertificateCheck(&cert))
+	}
+	router.GET("/healthz", routes.HealthzRoute(health.Ping))
+	router.GET("/readyz", routes.ReadyzRoute(readyChecks...))
+	router.GET("/readyz/device-plugins", routes.DevicePluginsRoute(sher))
+	router.GET("/debug/decisions/:uid", routes.DecisionRoute(sher))
+	router.GET("/debug/decisions/:uid/report", routes.DecisionReportRoute(sher))
+	router.GET("/policy", routes.PolicyRoute(sher))
+	router.GET("/usage", routes.UsageRoute(sher))
+	router.GET("/nodes/:node/cards/:uuid/pods", routes.CardPodsRoute(sher))
+	router.GET("/consistency", routes.ConsistencyRoute(sher, false))
+	router.POST("/consistency/repair", routes.ConsistencyRoute(sher, true))
 	klog.Info("listen on ", config.HTTPBind)
 
 	if enableProfiling {
@@ -122,12 +235,17 @@ func start() error {
 		klog.Infof("Profiling enabled, visit %s/debug/pprof/ to view profiles", config.HTTPBind)
 	}
 
-	if len(tlsCertFile) == 0 || len(tlsKeyFile) == 0 {
+	if !serveTLS {
 		if err := http.ListenAndServe(config.HTTPBind, router); err != nil {
 			return fmt.Errorf("listen and Serve error, %v", err)
 		}
 	} else {
-		if err := http.ListenAndServeTLS(config.HTTPBind, tlsCertFile, tlsKeyFile, router); err != nil {
+		server := &http.Server{
+			Addr:      config.HTTPBind,
+			Handler:   router,
+			TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+		}
+		if err := server.ListenAndServeTLS("", ""); err != nil {
 			return fmt.Errorf("listen and Serve error, %v", err)
 		}
 	}
@@ -26,6 +26,9 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	klog "k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/metrics"
+	"github.com/Project-HAMi/HAMi/pkg/util"
 )
 
 // ClusterManager is an example for a system that might have been built without
@@ -78,6 +81,11 @@ func (cc ClusterManagerCollector) Collect(ch chan<- prometheus.Metric) {
 		"Device memory allocated for a certain GPU",
 		[]string{"nodeid", "deviceuuid", "deviceidx", "devicecores"}, nil,
 	)
+	nodevGPUMemoryShareAllocatedDesc := prometheus.NewDesc(
+		"GPUDeviceMemoryShareAllocated",
+		"Device memory allocated for a certain GPU in percent of its memory, for devices accounting memory in shares",
+		[]string{"nodeid", "deviceuuid", "deviceidx", "devicecores"}, nil,
+	)
 	nodevGPUSharedNumDesc := prometheus.NewDesc(
 		"GPUDeviceSharedNum",
 		"Number of containers sharing this GPU",
@@ -104,6 +112,21 @@ func (cc ClusterManagerCollector) Collect(ch chan<- prometheus.Metric) {
 		"GPU Sharing mode. 0 for hami-core, 1 for mig, 2 for mps",
 		[]string{"nodeid", "deviceuuid", "deviceidx", "migname"}, nil,
 	)
+	nodeGPUQuarantined := prometheus.NewDesc(
+		"nodeGPUQuarantined",
+		"Whether a GPU is quarantined by the device plugin after repeated allocation failures, 1 for quarantined",
+		[]string{"nodeid", "deviceuuid", "deviceidx"}, nil,
+	)
+	nodeGPUECCErrors := prometheus.NewDesc(
+		"nodeGPUECCErrors",
+		"ECC errors of a GPU since its driver was loaded, by type: corrected or uncorrected",
+		[]string{"nodeid", "deviceuuid", "deviceidx", "type"}, nil,
+	)
+	nodeGPURecentECCErrors := prometheus.NewDesc(
+		"nodeGPURecentECCErrors",
+		"ECC errors of a GPU in the last 24 hours, by type: corrected or uncorrected",
+		[]string{"nodeid", "deviceuuid", "deviceidx", "type"}, nil,
+	)
 	nu := sher.InspectAllNodesUsage()
 	for nodeID, val := range *nu {
 		for _, devs := range val.Devices.DeviceLists {
@@ -123,24 +146,37 @@ func (cc ClusterManagerCollector) Collect(ch chan<- prometheus.Metric) {
 				}
 			}
 
-			ch <- prometheus.MustNewConstMetric(
-				nodevGPUMemoryLimitDesc,
-				prometheus.GaugeValue,
-				float64(devs.Device.Totalmem)*float64(1024)*float64(1024),
-				nodeID, devs.Device.ID, fmt.Sprint(devs.Device.Index),
-			)
+			// The memory of share devices isn't in bytes, only its share of the card is published.
+			memoryShare := util.MemoryShares[devs.Device.Type]
+			if !memoryShare {
+				ch <- prometheus.MustNewConstMetric(
+					nodevGPUMemoryLimitDesc,
+					prometheus.GaugeValue,
+					float64(devs.Device.Totalmem),
+					nodeID, devs.Device.ID, fmt.Sprint(devs.Device.Index),
+				)
+			}
 			ch <- prometheus.MustNewConstMetric(
 				nodevGPUCoreLimitDesc,
 				prometheus.GaugeValue,
 				float64(devs.Device.Totalcore),
 				nodeID, devs.Device.ID, fmt.Sprint(devs.Device.Index),
 			)
-			ch <- prometheus.MustNewConstMetric(
-				nodevGPUMemoryAllocatedDesc,
-				prometheus.GaugeValue,
-				float64(devs.Device.Usedmem)*float64(1024)*float64(1024),
-				nodeID, devs.Device.ID, fmt.Sprint(devs.Device.Index), fmt.Sprint(devs.Device.Usedcores),
-			)
+			if memoryShare {
+				ch <- prometheus.MustNewConstMetric(
+					nodevGPUMemoryShareAllocatedDesc,
+					prometheus.GaugeValue,
+					float64(devs.Device.Usedmem)*100/float64(devs.Device.Totalmem),
+					nodeID, devs.Device.ID, fmt.Sprint(devs.Device.Index), fmt.Sprint(devs.Device.Usedcores),
+				)
+			} else {
+				ch <- prometheus.MustNewConstMetric(
+					nodevGPUMemoryAllocatedDesc,
+					prometheus.GaugeValue,
+					float64(devs.Device.Usedmem),
+					nodeID, devs.Device.ID, fmt.Sprint(devs.Device.Index), fmt.Sprint(devs.Device.Usedcores),
+				)
+			}
 			ch <- prometheus.MustNewConstMetric(
 				nodevGPUSharedNumDesc,
 				prometheus.GaugeValue,
@@ -154,36 +190,84 @@ func (cc ClusterManagerCollector) Collect(ch chan<- prometheus.Metric) {
 				float64(devs.Device.Usedcores),
 				nodeID, devs.Device.ID, fmt.Sprint(devs.Device.Index),
 			)
+			if !memoryShare {
+				ch <- prometheus.MustNewConstMetric(
+					nodeGPUOverview,
+					prometheus.GaugeValue,
+					float64(devs.Device.Usedmem),
+					nodeID, devs.Device.ID, fmt.Sprint(devs.Device.Index), fmt.Sprint(devs.Device.Usedcores), fmt.Sprint(devs.Device.Used), fmt.Sprint(devs.Device.Totalmem/util.MiB), devs.Device.Type,
+				)
+			}
 			ch <- prometheus.MustNewConstMetric(
-				nodeGPUOverview,
+				nodeGPUMemoryPercentage,
 				prometheus.GaugeValue,
-				float64(devs.Device.Usedmem)*float64(1024)*float64(1024),
-				nodeID, devs.Device.ID, fmt.Sprint(devs.Device.Index), fmt.Sprint(devs.Device.Usedcores), fmt.Sprint(devs.Device.Used), fmt.Sprint(devs.Device.Totalmem), devs.Device.Type,
+				float64(devs.Device.Usedmem)/float64(devs.Device.Totalmem),
+				nodeID, devs.Device.ID, fmt.Sprint(devs.Device.Index),
 			)
+			quarantined := 0
+			if devs.Device.Quarantined {
+				quarantined = 1
+			}
 			ch <- prometheus.MustNewConstMetric(
-				nodeGPUMemoryPercentage,
+				nodeGPUQuarantined,
 				prometheus.GaugeValue,
-				float64(devs.Device.Usedmem)/float64(devs.Device.Totalmem),
+				float64(quarantined),
 				nodeID, devs.Device.ID, fmt.Sprint(devs.Device.Index),
 			)
+			if ecc := devs.Device.ECCErrors; ecc != nil {
+				for errType, counts := range map[string][2]uint64{
+					"corrected":   {ecc.Corrected, ecc.RecentCorrected},
+					"uncorrected": {ecc.Uncorrected, ecc.RecentUncorrected},
+				} {
+					ch <- prometheus.MustNewConstMetric(nodeGPUECCErrors, prometheus.GaugeValue, float64(counts[0]),
+						nodeID, devs.Device.ID, fmt.Sprint(devs.Device.Index), errType)
+					ch <- prometheus.MustNewConstMetric(nodeGPURecentECCErrors, prometheus.GaugeValue, float64(counts[1]),
+						nodeID, devs.Device.ID, fmt.Sprint(devs.Device.Index), errType)
+				}
+			}
 		}
 	}
 
 	ctrvGPUDeviceAllocatedDesc := prometheus.NewDesc(
 		"vGPUPodsDeviceAllocated",
 		"vGPU Allocated from pods",
-		[]string{"podnamespace", "nodename", "podname", "containeridx", "deviceuuid", "deviceusedcore"}, nil,
+		[]string{"podnamespace", "nodename", "podname", "containeridx", "deviceuuid", "deviceusedcore", "costcenter"}, nil,
+	)
+	ctrvGPUDeviceMemoryShareAllocatedDesc := prometheus.NewDesc(
+		"vGPUPodsDeviceMemoryShareAllocated",
+		"vGPU memory share in percent of the device allocated from pods, for devices accounting memory in shares",
+		[]string{"podnamespace", "nodename", "podname", "containeridx", "deviceuuid", "deviceusedcore", "costcenter"}, nil,
 	)
 	ctrvGPUdeviceAllocatedMemoryPercentageDesc := prometheus.NewDesc(
 		"vGPUMemoryPercentage",
 		"vGPU memory percentage allocated from a container",
-		[]string{"podnamespace", "nodename", "podname", "containeridx", "deviceuuid"}, nil,
+		[]string{"podnamespace", "nodename", "podname", "containeridx", "deviceuuid", "costcenter"}, nil,
 	)
 	ctrvGPUdeviceAllocateCorePercentageDesc := prometheus.NewDesc(
 		"vGPUCorePercentage",
 		"vGPU core allocated from a container",
-		[]string{"podnamespace", "nodename", "podname", "containeridx", "deviceuuid"}, nil,
+		[]string{"podnamespace", "nodename", "podname", "containeridx", "deviceuuid", "costcenter"}, nil,
+	)
+	costCenterDevicesAllocatedDesc := prometheus.NewDesc(
+		"vGPUCostCenterDevicesAllocated",
+		"Device slices allocated to the pods of a cost center",
+		[]string{"costcenter"}, nil,
+	)
+	costCenterMemoryAllocatedDesc := prometheus.NewDesc(
+		"vGPUCostCenterMemoryAllocated",
+		"Device memory in MiB allocated to the pods of a cost center",
+		[]string{"costcenter"}, nil,
 	)
+	costCenterCoresAllocatedDesc := prometheus.NewDesc(
+		"vGPUCostCenterCoresAllocated",
+		"Device cores allocated to the pods of a cost center",
+		[]string{"costcenter"}, nil,
+	)
+	for _, u := range sher.CostCenterUsage() {
+		ch <- prometheus.MustNewConstMetric(costCenterDevicesAllocatedDesc, prometheus.GaugeValue, float64(u.Devices), u.CostCenter)
+		ch <- prometheus.MustNewConstMetric(costCenterMemoryAllocatedDesc, prometheus.GaugeValue, float64(u.Memory), u.CostCenter)
+		ch <- prometheus.MustNewConstMetric(costCenterCoresAllocatedDesc, prometheus.GaugeValue, float64(u.Cores), u.CostCenter)
+	}
 	schedpods, _ := sher.GetScheduledPods()
 	for _, val := range schedpods {
 		for _, podSingleDevice := range val.Devices {
@@ -202,43 +286,48 @@ func (cc ClusterManagerCollector) Collect(ch chan<- prometheus.Metric) {
 							val.Namespace, val.Name, ctridx, val.NodeID)
 						continue
 					}
-					ch <- prometheus.MustNewConstMetric(
-						ctrvGPUDeviceAllocatedDesc,
-						prometheus.GaugeValue,
-						float64(ctrdevval.Usedmem)*float64(1024)*float64(1024),
-						val.Namespace, val.NodeID, val.Name, fmt.Sprint(ctridx), ctrdevval.UUID, fmt.Sprint(ctrdevval.Usedcores))
-					var totaldev int32
-					found := false
-					for _, ni := range *nu {
+					// UUIDs aren't unique across nodes in some passthrough setups, so only the node of the pod is searched.
+					var totaldev int64
+					if ni, ok := (*nu)[val.NodeID]; ok {
 						for _, nodedev := range ni.Devices.DeviceLists {
-							//fmt.Println("uuid=", nodedev.ID, ctrdevval.UUID)
 							if strings.Compare(nodedev.Device.ID, ctrdevval.UUID) == 0 {
 								totaldev = nodedev.Device.Totalmem
-								found = true
 								break
 							}
 						}
-						if found {
-							break
-						}
 					}
 					klog.V(4).InfoS("Total memory for device",
 						"deviceUUID", ctrdevval.UUID,
 						"totalMemory", totaldev,
 						"nodeID", val.NodeID,
 					)
+					if util.MemoryShares[ctrdevval.Type] {
+						if totaldev > 0 {
+							ch <- prometheus.MustNewConstMetric(
+								ctrvGPUDeviceMemoryShareAllocatedDesc,
+								prometheus.GaugeValue,
+								float64(ctrdevval.Usedmem)*100/float64(totaldev),
+								val.Namespace, val.NodeID, val.Name, fmt.Sprint(ctridx), ctrdevval.UUID, fmt.Sprint(ctrdevval.Usedcores), val.CostCenter)
+						}
+					} else {
+						ch <- prometheus.MustNewConstMetric(
+							ctrvGPUDeviceAllocatedDesc,
+							prometheus.GaugeValue,
+							float64(ctrdevval.Usedmem),
+							val.Namespace, val.NodeID, val.Name, fmt.Sprint(ctridx), ctrdevval.UUID, fmt.Sprint(ctrdevval.Usedcores), val.CostCenter)
+					}
 					if totaldev > 0 {
 						ch <- prometheus.MustNewConstMetric(
 							ctrvGPUdeviceAllocatedMemoryPercentageDesc,
 							prometheus.GaugeValue,
 							float64(ctrdevval.Usedmem)/float64(totaldev),
-							val.Namespace, val.NodeID, val.Name, fmt.Sprint(ctridx), ctrdevval.UUID)
+							val.Namespace, val.NodeID, val.Name, fmt.Sprint(ctridx), ctrdevval.UUID, val.CostCenter)
 					}
 					ch <- prometheus.MustNewConstMetric(
 						ctrvGPUdeviceAllocateCorePercentageDesc,
 						prometheus.GaugeValue,
 						float64(ctrdevval.Usedcores),
-						val.Namespace, val.NodeID, val.Name, fmt.Sprint(ctridx), ctrdevval.UUID)
+						val.Namespace, val.NodeID, val.Name, fmt.Sprint(ctridx), ctrdevval.UUID, val.CostCenter)
 				}
 			}
 		}
@@ -268,6 +357,7 @@ func initMetrics(bindAddress string) {
 	// Construct cluster managers. In real code, we would assign them to
 	// variables to then do something with them.
 	NewClusterManager("vGPU", reg)
+	metrics.Register(reg)
 
 	http.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
 	log.Fatal(http.ListenAndServe(bindAddress, nil))
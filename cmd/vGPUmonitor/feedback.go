@@ -201,6 +201,23 @@ func CheckPriority(utSwitchOn map[string]UtilizationPerDevice, p int, c *nvidia.
 	return false
 }
 
+// ApplySoftMemoryLimits lowers the HAMi-core memory limit of the containers of soft pods the
+// scheduler asked to shrink. New allocations beyond the limit fail, the ones already made stay.
+func ApplySoftMemoryLimits(lister *nvidia.ContainerLister) {
+	for _, c := range lister.ListContainers() {
+		if c.SoftMemoryLimit == 0 {
+			continue
+		}
+		for i := range c.Info.DeviceMax() {
+			if c.Info.IsValidUUID(i) && c.Info.DeviceMemoryLimit(i) > c.SoftMemoryLimit {
+				klog.Infof("Lowering memory limit of pod %s container %s to %d bytes", c.PodUID, c.ContainerName, c.SoftMemoryLimit)
+				c.Info.SetDeviceMemoryLimit(c.SoftMemoryLimit)
+				break
+			}
+		}
+	}
+}
+
 func Observe(lister *nvidia.ContainerLister) {
 	utSwitchOn := map[string]UtilizationPerDevice{}
 	containers := lister.ListContainers()
@@ -0,0 +1,262 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Project-HAMi/HAMi/pkg/k8sutil"
+	"github.com/Project-HAMi/HAMi/pkg/monitor/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// EventReasonGPUIdleMemoryReclaimed is recorded on a pod whose memory limit was lowered
+	// because its GPUs were idle.
+	EventReasonGPUIdleMemoryReclaimed = "GPUIdleMemoryReclaimed"
+	// EventReasonGPUIdleMemoryRestored is recorded on a pod whose memory limit was raised again
+	// because it uses its GPUs again.
+	EventReasonGPUIdleMemoryRestored = "GPUIdleMemoryRestored"
+)
+
+// idleMemoryReclaimWindow is how long the GPUs of a pod with reclaimable memory have to be idle
+// before its memory limit is lowered. 0 disables it.
+var idleMemoryReclaimWindow time.Duration
+
+// idleMemoryWatch lowers the memory limit of the idle pods with reclaimable memory on the node.
+type idleMemoryWatch struct {
+	reclaimer *nvidia.IdleMemoryReclaimer
+	clientset kubernetes.Interface
+	events    record.EventRecorder
+	nodeName  string
+}
+
+func newIdleMemoryWatch(reclaimer *nvidia.IdleMemoryReclaimer, clientset kubernetes.Interface) *idleMemoryWatch {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&v1core.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+	schema := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(schema)
+	nodeName := os.Getenv(util.NodeNameEnvName)
+	return &idleMemoryWatch{
+		reclaimer: reclaimer,
+		clientset: clientset,
+		events:    broadcaster.NewRecorder(schema, corev1.EventSource{Component: "hami-vgpu-monitor", Host: nodeName}),
+		nodeName:  nodeName,
+	}
+}
+
+// gpuActivity reports whether any of ctrs uses its GPUs, and the most memory one of them uses
+// on a device, from their HAMi-core regions.
+func gpuActivity(ctrs []*nvidia.ContainerUsage) (active bool, used uint64) {
+	for _, c := range ctrs {
+		for i := range c.Info.DeviceMax() {
+			if !c.Info.IsValidUUID(i) {
+				continue
+			}
+			active = active || c.Info.DeviceSmUtil(i) > 0
+			used = max(used, c.Info.DeviceMemoryTotal(i))
+		}
+	}
+	return active, used
+}
+
+// check lowers the memory limit of the reclaimable pods on the node whose GPUs were idle for the
+// window, and raises it again for the ones using their GPUs again.
+func (w *idleMemoryWatch) check(lister *nvidia.ContainerLister, now time.Time) {
+	containers := make(map[string][]*nvidia.ContainerUsage)
+	for _, c := range lister.ListContainers() {
+		containers[c.PodUID] = append(containers[c.PodUID], c)
+	}
+	list, err := w.clientset.CoreV1().Pods("").List(context.Background(), metav1.ListOptions{
+		FieldSelector: fmt.Sprintf("spec.nodeName=%s", w.nodeName),
+	})
+	if err != nil {
+		klog.Errorf("idle memory reclaim: failed to list pods: %v", err)
+		return
+	}
+	node, err := w.clientset.CoreV1().Nodes().Get(context.Background(), w.nodeName, metav1.GetOptions{})
+	if err != nil {
+		klog.Errorf("idle memory reclaim: failed to get node %s: %v", w.nodeName, err)
+		return
+	}
+	limits := k8sutil.NodeIdleMemoryLimits(node)
+	if limits == nil {
+		limits = make(map[k8stypes.UID]int64)
+	}
+	seen := make(map[string]bool)
+	for i := range list.Items {
+		pod := &list.Items[i]
+		ctrs := containers[string(pod.UID)]
+		if pod.Status.Phase != corev1.PodRunning || len(ctrs) == 0 || !nvidia.Reclaimable(pod) || !restorable(pod, ctrs) {
+			continue
+		}
+		seen[string(pod.UID)] = true
+		active, used := gpuActivity(ctrs)
+		idle := w.reclaimer.Observe(string(pod.UID), active, now)
+		limit, lowered := limits[pod.UID]
+		switch {
+		case lowered && active:
+			w.restore(pod, ctrs, limits)
+		case lowered:
+			// A restarted container starts over with the limit injected into it.
+			enforceIdleMemoryLimit(ctrs, uint64(limit))
+		case idle:
+			w.reclaim(pod, ctrs, used, limits)
+		}
+	}
+	w.reclaimer.Forget(func(uid string) bool { return seen[uid] })
+	stale := false
+	for uid := range limits {
+		if !seen[string(uid)] {
+			delete(limits, uid)
+			stale = true
+		}
+	}
+	if stale {
+		if err := w.storeIdleMemoryLimits(limits); err != nil {
+			klog.Errorf("idle memory reclaim: failed to annotate node %s: %v", w.nodeName, err)
+		}
+	}
+}
+
+// restorable reports whether the limit injected into each of ctrs is known, to raise it back to.
+func restorable(pod *corev1.Pod, ctrs []*nvidia.ContainerUsage) bool {
+	for _, c := range ctrs {
+		if _, ok := nvidia.InjectedContainerMemoryLimit(pod, c.ContainerName); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// enforceIdleMemoryLimit lowers the HAMi-core memory limit of ctrs to limit where it is above.
+func enforceIdleMemoryLimit(ctrs []*nvidia.ContainerUsage, limit uint64) {
+	for _, c := range ctrs {
+		c.IdleMemoryLimit = limit
+		for i := range c.Info.DeviceMax() {
+			if c.Info.IsValidUUID(i) && c.Info.DeviceMemoryLimit(i) > limit {
+				klog.Infof("Lowering memory limit of idle pod %s container %s to %d bytes", c.PodUID, c.ContainerName, limit)
+				c.Info.SetDeviceMemoryLimit(limit)
+				break
+			}
+		}
+	}
+}
+
+// reclaim lowers the memory limit of the idle pod to the used bytes it uses on its fullest
+// device, if that is below the limit of any of its containers, and records it in limits.
+func (w *idleMemoryWatch) reclaim(pod *corev1.Pod, ctrs []*nvidia.ContainerUsage, used uint64, limits map[k8stypes.UID]int64) {
+	// HAMi-core takes a limit of 0 as none.
+	limit := max(nvidia.IdleMemoryLimit(used), uint64(util.MiB))
+	from := uint64(0)
+	for _, c := range ctrs {
+		for i := range c.Info.DeviceMax() {
+			if c.Info.IsValidUUID(i) {
+				from = max(from, c.Info.DeviceMemoryLimit(i))
+			}
+		}
+	}
+	if from <= limit {
+		return
+	}
+	limits[pod.UID] = int64(limit)
+	if err := w.storeIdleMemoryLimits(limits); err != nil {
+		delete(limits, pod.UID)
+		klog.Errorf("idle memory reclaim: failed to annotate node %s: %v", w.nodeName, err)
+		return
+	}
+	mib := fmt.Sprint(limit / uint64(util.MiB))
+	if err := w.patchIdleMemoryLimit(pod, &mib); err != nil {
+		klog.Errorf("idle memory reclaim: failed to annotate pod %s/%s: %v", pod.Namespace, pod.Name, err)
+	}
+	enforceIdleMemoryLimit(ctrs, limit)
+	klog.Infof("GPUs of pod %s/%s idle for %s, lowered its memory limit from %d to %s MiB per card", pod.Namespace, pod.Name, w.reclaimer.Window(), from/uint64(util.MiB), mib)
+	w.events.Eventf(pod, corev1.EventTypeNormal, EventReasonGPUIdleMemoryReclaimed,
+		"GPUs idle for %s, memory limit lowered from %d to %s MiB per card for other pods", w.reclaimer.Window(), from/uint64(util.MiB), mib)
+}
+
+// restore raises the memory limit of the containers of pod back to the one injected into them,
+// and removes it from limits.
+func (w *idleMemoryWatch) restore(pod *corev1.Pod, ctrs []*nvidia.ContainerUsage, limits map[k8stypes.UID]int64) {
+	limit := limits[pod.UID]
+	delete(limits, pod.UID)
+	if err := w.storeIdleMemoryLimits(limits); err != nil {
+		limits[pod.UID] = limit
+		klog.Errorf("idle memory reclaim: failed to annotate node %s: %v", w.nodeName, err)
+		return
+	}
+	if err := w.patchIdleMemoryLimit(pod, nil); err != nil {
+		klog.Errorf("idle memory reclaim: failed to annotate pod %s/%s: %v", pod.Namespace, pod.Name, err)
+	}
+	for _, c := range ctrs {
+		c.IdleMemoryLimit = 0
+		limit, _ := nvidia.InjectedContainerMemoryLimit(pod, c.ContainerName)
+		c.Info.SetDeviceMemoryLimit(limit)
+	}
+	klog.Infof("GPUs of pod %s/%s in use again, raised its memory limit back", pod.Namespace, pod.Name)
+	w.events.Event(pod, corev1.EventTypeNormal, EventReasonGPUIdleMemoryRestored,
+		"GPUs in use again, memory limit raised back to the allocation, memory other pods took meanwhile may still be in use")
+}
+
+// patchIdleMemoryLimit sets the hami.io/gpu-idle-memory-limit annotation of pod to mib, or
+// removes it if mib is nil. It only shows the limit, which the node annotation holds.
+func (w *idleMemoryWatch) patchIdleMemoryLimit(pod *corev1.Pod, mib *string) error {
+	patch, err := json.Marshal(map[string]any{"metadata": map[string]any{"annotations": map[string]*string{util.GPUIdleMemoryLimit: mib}}})
+	if err != nil {
+		return err
+	}
+	_, err = w.clientset.CoreV1().Pods(pod.Namespace).Patch(context.Background(), pod.Name, k8stypes.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+// storeIdleMemoryLimits sets the hami.io/gpu-idle-memory-limits annotation of the node to
+// limits, in bytes by pod UID, which the scheduler accounts the pods with.
+func (w *idleMemoryWatch) storeIdleMemoryLimits(limits map[k8stypes.UID]int64) error {
+	var value *string
+	if len(limits) > 0 {
+		mibs := make(map[k8stypes.UID]int64, len(limits))
+		for uid, limit := range limits {
+			mibs[uid] = limit / util.MiB
+		}
+		data, err := json.Marshal(mibs)
+		if err != nil {
+			return err
+		}
+		annotation := string(data)
+		value = &annotation
+	}
+	patch, err := json.Marshal(map[string]any{"metadata": map[string]any{"annotations": map[string]*string{util.GPUIdleMemoryLimits: value}}})
+	if err != nil {
+		return err
+	}
+	_, err = w.clientset.CoreV1().Nodes().Patch(context.Background(), w.nodeName, k8stypes.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
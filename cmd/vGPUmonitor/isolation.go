@@ -0,0 +1,188 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Project-HAMi/HAMi/pkg/monitor/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// EventReasonGPUIsolationInactive is recorded on a pod with a container running GPU processes
+	// without HAMi-core.
+	EventReasonGPUIsolationInactive = "GPUIsolationInactive"
+	// EventReasonGPUIsolationLimitMismatch is recorded on a pod with a container whose HAMi-core
+	// limits differ from the injected ones.
+	EventReasonGPUIsolationLimitMismatch = "GPUIsolationLimitMismatch"
+)
+
+// isolationAuditInterval is how often the isolation of the GPU containers is audited. 0
+// disables the audit.
+var isolationAuditInterval time.Duration
+
+// isolationAudit checks that HAMi-core runs in the GPU containers on the node with the limits
+// the device plugin injected.
+type isolationAudit struct {
+	auditor   *nvidia.IsolationAuditor
+	clientset kubernetes.Interface
+	events    record.EventRecorder
+	nodeName  string
+	last      time.Time
+}
+
+func newIsolationAudit(auditor *nvidia.IsolationAuditor, clientset kubernetes.Interface) *isolationAudit {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&v1core.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+	schema := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(schema)
+	nodeName := os.Getenv(util.NodeNameEnvName)
+	return &isolationAudit{
+		auditor:   auditor,
+		clientset: clientset,
+		events:    broadcaster.NewRecorder(schema, corev1.EventSource{Component: "hami-vgpu-monitor", Host: nodeName}),
+		nodeName:  nodeName,
+	}
+}
+
+// gpuProcessCgroups returns the cgroups of the processes NVML reports on any device of the node,
+// read from /proc, as the monitor shares the PID namespace of the host.
+func gpuProcessCgroups() ([]string, error) {
+	count, ret := nvml.DeviceGetCount()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("nvml DeviceGetCount err: %s", nvml.ErrorString(ret))
+	}
+	var cgroups []string
+	for i := range count {
+		dev, ret := nvml.DeviceGetHandleByIndex(i)
+		if ret != nvml.SUCCESS {
+			return nil, fmt.Errorf("nvml DeviceGetHandleByIndex err: %s", nvml.ErrorString(ret))
+		}
+		procs, ret := dev.GetComputeRunningProcesses()
+		if ret != nvml.SUCCESS {
+			return nil, fmt.Errorf("nvml GetComputeRunningProcesses err: %s", nvml.ErrorString(ret))
+		}
+		for _, p := range procs {
+			cgroup, err := os.ReadFile(fmt.Sprintf("/proc/%d/cgroup", p.Pid))
+			if err != nil {
+				// The process exited.
+				continue
+			}
+			cgroups = append(cgroups, string(cgroup))
+		}
+	}
+	return cgroups, nil
+}
+
+// runsGPUProcesses reports whether one of cgroups belongs to the container with containerID, a
+// container ID of the pod status like containerd://<id>.
+func runsGPUProcesses(cgroups []string, containerID string) bool {
+	_, id, ok := strings.Cut(containerID, "://")
+	if !ok || id == "" {
+		return false
+	}
+	for _, c := range cgroups {
+		if strings.Contains(c, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// audit checks the running containers of the GPU pods on the node, at most every
+// isolationAuditInterval.
+func (a *isolationAudit) audit(lister *nvidia.ContainerLister, now time.Time) {
+	if now.Sub(a.last) < isolationAuditInterval {
+		return
+	}
+	a.last = now
+	list, err := a.clientset.CoreV1().Pods("").List(context.Background(), metav1.ListOptions{
+		FieldSelector: fmt.Sprintf("spec.nodeName=%s", a.nodeName),
+	})
+	if err != nil {
+		klog.Errorf("isolation audit: failed to list pods: %v", err)
+		return
+	}
+	cgroups, err := gpuProcessCgroups()
+	if err != nil {
+		klog.V(4).Infof("isolation audit: can't tell which containers run GPU processes: %v", err)
+	}
+	containers := lister.ListContainers()
+	audited := make(map[nvidia.IsolationKey]bool)
+	for i := range list.Items {
+		pod := &list.Items[i]
+		limits := nvidia.InjectedMemoryLimits(pod)
+		if pod.Status.Phase != corev1.PodRunning || limits == nil {
+			continue
+		}
+		for _, cs := range pod.Status.ContainerStatuses {
+			idx := containerIndex(pod, cs.Name)
+			if cs.State.Running == nil || idx < 0 {
+				continue
+			}
+			usage := containers[string(pod.UID)+"_"+cs.Name]
+			status, ok := nvidia.AuditIsolation(pod, &pod.Spec.Containers[idx], limits, usage, runsGPUProcesses(cgroups, cs.ContainerID))
+			if !ok {
+				continue
+			}
+			audited[status.IsolationKey] = true
+			if a.auditor.Observe(status) {
+				a.report(pod, status)
+			}
+		}
+	}
+	a.auditor.Forget(func(key nvidia.IsolationKey) bool { return audited[key] })
+}
+
+func containerIndex(pod *corev1.Pod, name string) int {
+	for i := range pod.Spec.Containers {
+		if pod.Spec.Containers[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// report records a container whose isolation is not active on its pod.
+func (a *isolationAudit) report(pod *corev1.Pod, status nvidia.IsolationStatus) {
+	reason := ""
+	switch status.State {
+	case nvidia.IsolationInactive:
+		reason = EventReasonGPUIsolationInactive
+	case nvidia.IsolationLimitMismatch:
+		reason = EventReasonGPUIsolationLimitMismatch
+	default:
+		return
+	}
+	klog.Warningf("GPU isolation of container %s of pod %s/%s is %s: %s", status.Container, pod.Namespace, pod.Name, status.State, status.Detail)
+	a.events.Eventf(pod, corev1.EventTypeWarning, reason, "Container %s: %s", status.Container, status.Detail)
+}
@@ -26,6 +26,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/Project-HAMi/HAMi/pkg/audit"
 	"github.com/Project-HAMi/HAMi/pkg/monitor/nvidia"
 	"github.com/Project-HAMi/HAMi/pkg/util"
 	"github.com/Project-HAMi/HAMi/pkg/util/flag"
@@ -39,6 +40,9 @@ import (
 )
 
 var (
+	// auditConfig configures the audit records of the pods releasing their GPUs.
+	auditConfig audit.Config
+
 	rootCmd = &cobra.Command{
 		Use:   "vGPUmonitor",
 		Short: "Hami vgpu vGPUmonitor",
@@ -52,6 +56,15 @@ var (
 func init() {
 	rootCmd.Flags().SortFlags = false
 	rootCmd.PersistentFlags().SortFlags = false
+	rootCmd.Flags().DurationVar(&memoryLeakWindow, "memory-leak-window", 0, "how long the GPU memory use of a pod has to grow before it is reported as a suspected leak, 0 disables it")
+	rootCmd.Flags().Float64Var(&memoryLeakThreshold, "memory-leak-threshold", 0.9, "fraction of its memory limit the GPU memory use of a pod has to reach to be reported as a suspected leak")
+	rootCmd.Flags().DurationVar(&idleMemoryReclaimWindow, "idle-memory-reclaim-window", 0, "how long the GPUs of a pod annotated with hami.io/gpu-reclaimable-memory have to be idle before its memory limit is lowered to the memory it uses, 0 disables it")
+	rootCmd.Flags().DurationVar(&isolationAuditInterval, "isolation-audit-interval", time.Minute, "how often the GPU containers are checked for running HAMi-core with the injected limits, 0 disables it")
+	rootCmd.Flags().StringVar(&auditConfig.SinkURL, "audit-sink-url", "", "endpoint to deliver the audit records of the pods releasing their GPUs to, empty disables auditing")
+	rootCmd.Flags().StringVar(&auditConfig.SinkType, "audit-sink-type", audit.SinkTypeWebhook, "audit sink type: webhook or kafka-rest")
+	rootCmd.Flags().StringVar(&auditConfig.KafkaTopic, "audit-kafka-topic", "", "kafka topic used by the kafka-rest audit sink")
+	rootCmd.Flags().IntVar(&auditConfig.BufferSize, "audit-buffer-size", 10000, "max number of undelivered audit records buffered")
+	rootCmd.Flags().StringVar(&auditConfig.SpoolPath, "audit-spool-path", "", "file undelivered audit records are kept in across restarts, empty keeps them in memory only")
 	rootCmd.Flags().AddGoFlagSet(util.InitKlogFlags())
 }
 
@@ -67,9 +80,30 @@ func start() error {
 
 	cgroupDriver = 0 // Explicitly initialize
 
+	leaks, err := nvidia.NewMemoryLeakDetector(memoryLeakWindow, memoryLeakThreshold)
+	if err != nil {
+		return fmt.Errorf("failed to create memory leak detector: %v", err)
+	}
+	var isolation *nvidia.IsolationAuditor
+	if isolationAuditInterval > 0 {
+		isolation = nvidia.NewIsolationAuditor()
+	}
+	idle, err := nvidia.NewIdleMemoryReclaimer(idleMemoryReclaimWindow)
+	if err != nil {
+		return fmt.Errorf("failed to create idle memory reclaimer: %v", err)
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	auditor, err := audit.Start(audit.SourceMonitor, auditConfig, ctx.Done())
+	if err != nil {
+		klog.Errorf("Failed to start the audit recorder, allocation auditing disabled: %v", err)
+	}
+	if auditor != nil {
+		containerLister.SetAuditor(auditor)
+	}
+
 	var wg sync.WaitGroup
 	errCh := make(chan error, 2)
 
@@ -77,7 +111,7 @@ func start() error {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		if err := initMetrics(ctx, containerLister); err != nil {
+		if err := initMetrics(ctx, containerLister, leaks, isolation); err != nil {
 			errCh <- err
 		}
 	}()
@@ -86,7 +120,7 @@ func start() error {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		if err := watchAndFeedback(ctx, containerLister); err != nil {
+		if err := watchAndFeedback(ctx, containerLister, leaks, isolation, idle); err != nil {
 			errCh <- err
 		}
 	}()
@@ -110,14 +144,14 @@ func start() error {
 	return nil
 }
 
-func initMetrics(ctx context.Context, containerLister *nvidia.ContainerLister) error {
+func initMetrics(ctx context.Context, containerLister *nvidia.ContainerLister, leaks *nvidia.MemoryLeakDetector, isolation *nvidia.IsolationAuditor) error {
 	klog.V(4).Info("Initializing metrics for vGPUmonitor")
 	reg := prometheus.NewRegistry()
 	//reg := prometheus.NewPedanticRegistry()
 
 	// Construct cluster managers. In real code, we would assign them to
 	// variables to then do something with them.
-	NewClusterManager("vGPU", reg, containerLister)
+	NewClusterManager("vGPU", reg, containerLister, leaks, isolation)
 	//NewClusterManager("ca", reg)
 
 	// Uncomment to add the standard process and Go metrics to the custom registry.
@@ -146,12 +180,30 @@ func initMetrics(ctx context.Context, containerLister *nvidia.ContainerLister) e
 	return nil
 }
 
-func watchAndFeedback(ctx context.Context, lister *nvidia.ContainerLister) error {
+func watchAndFeedback(ctx context.Context, lister *nvidia.ContainerLister, leaks *nvidia.MemoryLeakDetector, isolation *nvidia.IsolationAuditor, idle *nvidia.IdleMemoryReclaimer) error {
 	if nvret := nvml.Init(); nvret != nvml.SUCCESS {
 		return fmt.Errorf("failed to initialize NVML: %s", nvml.ErrorString(nvret))
 	}
 	defer nvml.Shutdown()
 
+	var leakWatch *memoryLeakWatch
+	if leaks != nil {
+		klog.Infof("Reporting GPU memory growing for %s up to %v of the limit as suspected leaks", memoryLeakWindow, memoryLeakThreshold)
+		leakWatch = newMemoryLeakWatch(leaks, lister.Clientset())
+	}
+	var isolationWatch *isolationAudit
+	if isolation != nil {
+		klog.Infof("Auditing the HAMi-core isolation of GPU containers every %s", isolationAuditInterval)
+		isolationWatch = newIsolationAudit(isolation, lister.Clientset())
+	}
+	var idleWatch *idleMemoryWatch
+	if idle != nil {
+		klog.Infof("Lowering the memory limit of pods with reclaimable memory whose GPUs were idle for %s", idle.Window())
+		idleWatch = newIdleMemoryWatch(idle, lister.Clientset())
+	}
+	warmup := newWarmupWatch(lister.Clientset())
+	scaleDown := newScaleDownWatch(warmup)
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -164,6 +216,18 @@ func watchAndFeedback(ctx context.Context, lister *nvidia.ContainerLister) error
 			}
 			//klog.Infof("WatchAndFeedback srPodList=%v", srPodList)
 			Observe(lister)
+			ApplySoftMemoryLimits(lister)
+			if leakWatch != nil {
+				leakWatch.sample(lister, time.Now())
+			}
+			if idleWatch != nil {
+				idleWatch.check(lister, time.Now())
+			}
+			if isolationWatch != nil {
+				isolationWatch.audit(lister, time.Now())
+			}
+			warmup.check(lister, time.Now())
+			scaleDown.check(lister, time.Now())
 		}
 	}
 }
@@ -0,0 +1,159 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Project-HAMi/HAMi/pkg/monitor/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+)
+
+// EventReasonGPUMemoryLeakSuspected is recorded on a pod whose GPU memory use grew over the
+// whole memory leak window toward its limit.
+const EventReasonGPUMemoryLeakSuspected = "GPUMemoryLeakSuspected"
+
+var (
+	// memoryLeakWindow is how long the GPU memory use of a pod has to grow before it is
+	// suspected to leak. 0 disables the detection.
+	memoryLeakWindow time.Duration
+	// memoryLeakThreshold is the fraction of its limit the memory use of a pod has to reach.
+	memoryLeakThreshold float64
+)
+
+// memoryLeakWatch samples the GPU memory use of the pods on the node for the leak detector.
+type memoryLeakWatch struct {
+	detector  *nvidia.MemoryLeakDetector
+	clientset kubernetes.Interface
+	events    record.EventRecorder
+	nodeName  string
+}
+
+func newMemoryLeakWatch(detector *nvidia.MemoryLeakDetector, clientset kubernetes.Interface) *memoryLeakWatch {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&v1core.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+	schema := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(schema)
+	nodeName := os.Getenv(util.NodeNameEnvName)
+	return &memoryLeakWatch{
+		detector:  detector,
+		clientset: clientset,
+		events:    broadcaster.NewRecorder(schema, corev1.EventSource{Component: "hami-vgpu-monitor", Host: nodeName}),
+		nodeName:  nodeName,
+	}
+}
+
+// processMemory returns the memory in use on the device uuid by every process, by host pid, as
+// reported by NVML.
+func processMemory(uuid string) (map[int32]uint64, error) {
+	dev, ret := nvml.DeviceGetHandleByUUID(uuid)
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("nvml DeviceGetHandleByUUID err: %s", nvml.ErrorString(ret))
+	}
+	procs, ret := dev.GetComputeRunningProcesses()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("nvml GetComputeRunningProcesses err: %s", nvml.ErrorString(ret))
+	}
+	used := make(map[int32]uint64, len(procs))
+	for _, p := range procs {
+		used[int32(p.Pid)] += p.UsedGpuMemory
+	}
+	return used, nil
+}
+
+// sample observes the memory every pod uses on each of its devices, summed over the processes
+// of its containers, against the sum of their limits.
+func (w *memoryLeakWatch) sample(lister *nvidia.ContainerLister, now time.Time) {
+	used := make(map[nvidia.MemoryLeakKey]uint64)
+	limit := make(map[nvidia.MemoryLeakKey]uint64)
+	devices := make(map[string]map[int32]uint64)
+	for _, c := range lister.ListContainers() {
+		pids := c.Info.HostPids()
+		for i := range c.Info.DeviceMax() {
+			if !c.Info.IsValidUUID(i) || len(c.Info.DeviceUUID(i)) < 40 {
+				continue
+			}
+			uuid := c.Info.DeviceUUID(i)[0:40]
+			procs, ok := devices[uuid]
+			if !ok {
+				var err error
+				if procs, err = processMemory(uuid); err != nil {
+					klog.V(4).Infof("memory leak detection: skipping device %s: %v", uuid, err)
+				}
+				devices[uuid] = procs
+			}
+			if procs == nil {
+				continue
+			}
+			key := nvidia.MemoryLeakKey{PodUID: c.PodUID, DeviceUUID: uuid}
+			for _, pid := range pids {
+				used[key] += procs[pid]
+			}
+			limit[key] += c.Info.DeviceMemoryLimit(i)
+		}
+	}
+	w.detector.Forget(func(key nvidia.MemoryLeakKey) bool {
+		_, ok := used[key]
+		return ok
+	})
+	var pods []corev1.Pod
+	for key, u := range used {
+		leak, newly := w.detector.Observe(key, u, limit[key], now)
+		if !newly {
+			continue
+		}
+		if pods == nil {
+			list, err := w.clientset.CoreV1().Pods("").List(context.Background(), metav1.ListOptions{
+				FieldSelector: fmt.Sprintf("spec.nodeName=%s", w.nodeName),
+			})
+			if err != nil {
+				klog.Errorf("memory leak detection: failed to list pods: %v", err)
+				continue
+			}
+			pods = list.Items
+		}
+		w.report(pods, leak)
+	}
+}
+
+// report records the leak on its pod.
+func (w *memoryLeakWatch) report(pods []corev1.Pod, leak nvidia.MemoryLeak) {
+	for i := range pods {
+		if string(pods[i].UID) != leak.PodUID {
+			continue
+		}
+		klog.Warningf("GPU memory of pod %s/%s on device %s grew from %d to %d bytes over %s, limit %d bytes",
+			pods[i].Namespace, pods[i].Name, leak.DeviceUUID, leak.From, leak.Used, w.detector.Window(), leak.Limit)
+		w.events.Eventf(&pods[i], corev1.EventTypeWarning, EventReasonGPUMemoryLeakSuspected,
+			"GPU memory in use on device %s grew from %d to %d MiB over the last %s, %d%% of its %d MiB limit",
+			leak.DeviceUUID, leak.From/uint64(util.MiB), leak.Used/uint64(util.MiB), w.detector.Window(), leak.Used*100/leak.Limit, leak.Limit/uint64(util.MiB))
+		return
+	}
+}
@@ -49,6 +49,10 @@ type ClusterManager struct {
 	// Contains many more fields not listed in this example.
 	PodLister       listerscorev1.PodLister
 	containerLister *nvidia.ContainerLister
+	// leaks is nil unless memory leak detection is enabled.
+	leaks *nvidia.MemoryLeakDetector
+	// isolation is nil unless the isolation audit is enabled.
+	isolation *nvidia.IsolationAuditor
 }
 
 // ReallyExpensiveAssessmentOfTheSystemState is a mock for the data gathering a
@@ -100,6 +104,12 @@ var (
 		"vGPU device limit",
 		[]string{"podnamespace", "podname", "ctrname", "vdeviceid", "deviceuuid"}, nil,
 	)
+
+	ctrvGPUcorelimitdesc = prometheus.NewDesc(
+		"vGPU_device_core_limit",
+		"vGPU device core limit in percent of the device",
+		[]string{"podnamespace", "podname", "ctrname", "vdeviceid", "deviceuuid"}, nil,
+	)
 	ctrDeviceMemorydesc = prometheus.NewDesc(
 		"Device_memory_desc_of_container",
 		"Container device meory description",
@@ -110,6 +120,16 @@ var (
 		"Container device utilization description",
 		[]string{"podnamespace", "podname", "ctrname", "vdeviceid", "deviceuuid"}, nil,
 	)
+	ctrDeviceMemoryLeakdesc = prometheus.NewDesc(
+		"vGPU_device_memory_leak_suspected",
+		"GPU memory use of the pod on the device grew over the whole memory leak window toward its limit",
+		[]string{"podnamespace", "podname", "deviceuuid"}, nil,
+	)
+	ctrIsolationDesc = prometheus.NewDesc(
+		"vGPU_container_isolation",
+		"Isolation state of the GPU container found by the last isolation audit: active, inactive or limit_mismatch",
+		[]string{"podnamespace", "podname", "ctrname", "state"}, nil,
+	)
 	ctrDeviceLastKernelDesc = prometheus.NewDesc(
 		"Device_last_kernel_of_container",
 		"Container device last kernel description",
@@ -124,7 +144,10 @@ func (cc ClusterManagerCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- hostGPUdesc
 	ch <- ctrvGPUdesc
 	ch <- ctrvGPUlimitdesc
+	ch <- ctrvGPUcorelimitdesc
 	ch <- hostGPUUtilizationdesc
+	ch <- ctrDeviceMemoryLeakdesc
+	ch <- ctrIsolationDesc
 	//prometheus.DescribeByCollect(cc, ch)
 }
 
@@ -334,6 +357,34 @@ func (cc ClusterManagerCollector) collectPodAndContainerInfo(ch chan<- prometheu
 		}
 	}
 
+	if cc.ClusterManager.leaks != nil {
+		leaks := make(map[string][]nvidia.MemoryLeak)
+		for _, l := range cc.ClusterManager.leaks.Leaks() {
+			leaks[l.PodUID] = append(leaks[l.PodUID], l)
+		}
+		for _, pod := range pods {
+			for _, l := range leaks[string(pod.UID)] {
+				if err := sendMetric(ch, ctrDeviceMemoryLeakdesc, prometheus.GaugeValue, 1, pod.Namespace, pod.Name, l.DeviceUUID); err != nil {
+					klog.Errorf("Failed to send memory leak metric for device %s in Pod %s/%s: %v", l.DeviceUUID, pod.Namespace, pod.Name, err)
+				}
+			}
+		}
+	}
+
+	if cc.ClusterManager.isolation != nil {
+		statuses := make(map[string][]nvidia.IsolationStatus)
+		for _, s := range cc.ClusterManager.isolation.Statuses() {
+			statuses[s.PodUID] = append(statuses[s.PodUID], s)
+		}
+		for _, pod := range pods {
+			for _, s := range statuses[string(pod.UID)] {
+				if err := sendMetric(ch, ctrIsolationDesc, prometheus.GaugeValue, 1, pod.Namespace, pod.Name, s.Container, s.State); err != nil {
+					klog.Errorf("Failed to send isolation metric for container %s in Pod %s/%s: %v", s.Container, pod.Namespace, pod.Name, err)
+				}
+			}
+		}
+	}
+
 	klog.V(4).Infof("Finished collecting metrics for %d pods", len(pods))
 	return nil
 }
@@ -364,6 +415,7 @@ func (cc ClusterManagerCollector) collectContainerMetrics(ch chan<- prometheus.M
 		// Collect device metrics
 		memoryTotal := c.Info.DeviceMemoryTotal(i)
 		memoryLimit := c.Info.DeviceMemoryLimit(i)
+		coreLimit := c.Info.DeviceSmLimit(i)
 		memoryContextSize := c.Info.DeviceMemoryContextSize(i)
 		memoryModuleSize := c.Info.DeviceMemoryModuleSize(i)
 		memoryBufferSize := c.Info.DeviceMemoryBufferSize(i)
@@ -384,6 +436,11 @@ func (cc ClusterManagerCollector) collectContainerMetrics(ch chan<- prometheus.M
 			return err
 		}
 
+		if err := sendMetric(ch, ctrvGPUcorelimitdesc, prometheus.GaugeValue, float64(coreLimit), labels...); err != nil {
+			klog.Errorf("Failed to send coreLimit metric for device %d in Pod %s/%s, Container %s: %v", i, pod.Namespace, pod.Name, ctr.Name, err)
+			return err
+		}
+
 		// Send memory-related metrics with additional labels
 		memoryLabels := append(labels, fmt.Sprint(memoryContextSize), fmt.Sprint(memoryModuleSize), fmt.Sprint(memoryBufferSize), fmt.Sprint(memoryOffset))
 		if err := sendMetric(ch, ctrDeviceMemorydesc, prometheus.CounterValue, float64(memoryTotal), memoryLabels...); err != nil {
@@ -424,10 +481,12 @@ func sendMetric(ch chan<- prometheus.Metric, desc *prometheus.Desc, valueType pr
 // ClusterManager. Finally, it registers the ClusterManagerCollector with a
 // wrapping Registerer that adds the zone as a label. In this way, the metrics
 // collected by different ClusterManagerCollectors do not collide.
-func NewClusterManager(zone string, reg prometheus.Registerer, containerLister *nvidia.ContainerLister) *ClusterManager {
+func NewClusterManager(zone string, reg prometheus.Registerer, containerLister *nvidia.ContainerLister, leaks *nvidia.MemoryLeakDetector, isolation *nvidia.IsolationAuditor) *ClusterManager {
 	c := &ClusterManager{
 		Zone:            zone,
 		containerLister: containerLister,
+		leaks:           leaks,
+		isolation:       isolation,
 	}
 
 	informerFactory := informers.NewSharedInformerFactoryWithOptions(containerLister.Clientset(), time.Hour*1)
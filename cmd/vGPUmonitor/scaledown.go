@@ -0,0 +1,134 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/monitor/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+const (
+	// EventReasonGPUScaleDownPending is recorded on a pod told to checkpoint before its node is
+	// removed by the cluster autoscaler.
+	EventReasonGPUScaleDownPending = "GPUScaleDownPending"
+	// EventReasonGPUScaleDownReleased is recorded on a pod the autoscaler may evict again.
+	EventReasonGPUScaleDownReleased = "GPUScaleDownReleased"
+)
+
+// scaleDownWatch holds the node back from a scale-down of the cluster autoscaler until its
+// hami.io/scale-down-checkpoint pods checkpointed.
+type scaleDownWatch struct {
+	clientset kubernetes.Interface
+	events    record.EventRecorder
+	nodeName  string
+}
+
+func newScaleDownWatch(w *warmupWatch) *scaleDownWatch {
+	return &scaleDownWatch{clientset: w.clientset, events: w.events, nodeName: w.nodeName}
+}
+
+// check takes the next scale-down step of the pods on the node.
+func (w *scaleDownWatch) check(lister *nvidia.ContainerLister, now time.Time) {
+	list, err := w.clientset.CoreV1().Pods("").List(context.Background(), metav1.ListOptions{
+		FieldSelector: fmt.Sprintf("spec.nodeName=%s", w.nodeName),
+	})
+	if err != nil {
+		klog.Errorf("scale-down watch: failed to list pods: %v", err)
+		return
+	}
+	var pods []*corev1.Pod
+	for i := range list.Items {
+		pod := &list.Items[i]
+		if pod.Status.Phase == corev1.PodRunning && nvidia.WantsScaleDownCheckpoint(pod) {
+			pods = append(pods, pod)
+		}
+	}
+	if len(pods) == 0 {
+		return
+	}
+	node, err := w.clientset.CoreV1().Nodes().Get(context.Background(), w.nodeName, metav1.GetOptions{})
+	if err != nil {
+		klog.Errorf("scale-down watch: failed to get node %s: %v", w.nodeName, err)
+		return
+	}
+	candidate := nvidia.ScaleDownCandidate(node)
+	for _, pod := range pods {
+		step, reason := nvidia.NextScaleDownStep(pod, lister.ContainerPath(), candidate, now)
+		if step == nvidia.ScaleDownWait {
+			continue
+		}
+		if err := w.apply(pod, step, lister.ContainerPath(), now); err != nil {
+			klog.Errorf("scale-down watch: failed to update pod %s/%s: %v", pod.Namespace, pod.Name, err)
+			continue
+		}
+		klog.Infof("Scale-down of pod %s/%s: %s", pod.Namespace, pod.Name, reason)
+		switch step {
+		case nvidia.ScaleDownSignal:
+			w.events.Event(pod, corev1.EventTypeNormal, EventReasonGPUScaleDownPending, "The "+reason)
+		case nvidia.ScaleDownRelease:
+			w.events.Event(pod, corev1.EventTypeNormal, EventReasonGPUScaleDownReleased, "The cluster autoscaler may evict the pod: "+reason)
+		}
+	}
+}
+
+// apply takes step for pod: it writes or removes the files of the handshake in the HAMi-core
+// directories of its containers and sets the annotations recording it.
+func (w *scaleDownWatch) apply(pod *corev1.Pod, step nvidia.ScaleDownStep, containerPath string, now time.Time) error {
+	stamp := now.UTC().Format(time.RFC3339)
+	var annos map[string]*string
+	dirs := nvidia.ScaleDownContainerDirs(pod, containerPath)
+	switch step {
+	case nvidia.ScaleDownSignal:
+		deadline := now.Add(nvidia.ScaleDownGrace(pod)).UTC().Format(time.RFC3339)
+		for _, dir := range dirs {
+			os.Remove(filepath.Join(dir, util.ScaleDownReadyFile))
+			if err := os.WriteFile(filepath.Join(dir, util.ScaleDownPendingFile), []byte(deadline+"\n"), 0o666); err != nil {
+				return err
+			}
+		}
+		safeToEvict := "false"
+		annos = map[string]*string{util.ScaleDownSignaledAt: &stamp, util.SafeToEvict: &safeToEvict}
+	case nvidia.ScaleDownRelease:
+		annos = map[string]*string{util.ScaleDownReleasedAt: &stamp, util.SafeToEvict: nil}
+	case nvidia.ScaleDownRearm:
+		for _, dir := range dirs {
+			os.Remove(filepath.Join(dir, util.ScaleDownPendingFile))
+			os.Remove(filepath.Join(dir, util.ScaleDownReadyFile))
+		}
+		annos = map[string]*string{util.ScaleDownSignaledAt: nil, util.ScaleDownReleasedAt: nil}
+	}
+	patch, err := json.Marshal(map[string]any{"metadata": map[string]any{"annotations": annos}})
+	if err != nil {
+		return err
+	}
+	_, err = w.clientset.CoreV1().Pods(pod.Namespace).Patch(context.Background(), pod.Name, k8stypes.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Project-HAMi/HAMi/pkg/monitor/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+)
+
+// EventReasonGPUWarmupTimedOut is recorded on a pod whose GPU containers didn't report their
+// warmup complete within its hami.io/gpu-warmup-timeout.
+const EventReasonGPUWarmupTimedOut = "GPUWarmupTimedOut"
+
+// warmupWatch sets the hami.io/gpu-warmup readiness gate condition of the pods on the node from
+// the warmup their GPU containers report.
+type warmupWatch struct {
+	clientset kubernetes.Interface
+	events    record.EventRecorder
+	nodeName  string
+}
+
+func newWarmupWatch(clientset kubernetes.Interface) *warmupWatch {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&v1core.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+	schema := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(schema)
+	nodeName := os.Getenv(util.NodeNameEnvName)
+	return &warmupWatch{
+		clientset: clientset,
+		events:    broadcaster.NewRecorder(schema, corev1.EventSource{Component: "hami-vgpu-monitor", Host: nodeName}),
+		nodeName:  nodeName,
+	}
+}
+
+// check updates the warmup condition of the pods on the node which changed.
+func (w *warmupWatch) check(lister *nvidia.ContainerLister, now time.Time) {
+	list, err := w.clientset.CoreV1().Pods("").List(context.Background(), metav1.ListOptions{
+		FieldSelector: fmt.Sprintf("spec.nodeName=%s", w.nodeName),
+	})
+	if err != nil {
+		klog.Errorf("warmup watch: failed to list pods: %v", err)
+		return
+	}
+	for i := range list.Items {
+		pod := &list.Items[i]
+		if pod.Status.Phase != corev1.PodRunning || !nvidia.WantsWarmup(pod) {
+			continue
+		}
+		status, ok := nvidia.CheckWarmup(pod, lister.ContainerPath(), now)
+		if !ok || !warmupChanged(pod, status) {
+			continue
+		}
+		if err := w.setCondition(pod, status, now); err != nil {
+			klog.Errorf("warmup watch: failed to update the warmup condition of pod %s/%s: %v", pod.Namespace, pod.Name, err)
+			continue
+		}
+		klog.Infof("GPU warmup of pod %s/%s is %s: %s", pod.Namespace, pod.Name, status.Reason, status.Message)
+		if status.Reason == nvidia.WarmupTimedOut {
+			w.events.Event(pod, corev1.EventTypeWarning, EventReasonGPUWarmupTimedOut, status.Message)
+		}
+	}
+}
+
+// warmupChanged reports whether status differs from the warmup condition pod has.
+func warmupChanged(pod *corev1.Pod, status nvidia.WarmupStatus) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == util.GPUWarmupCondition {
+			return c.Status != status.Status || c.Reason != status.Reason
+		}
+	}
+	return true
+}
+
+// setCondition sets the warmup condition of pod to status.
+func (w *warmupWatch) setCondition(pod *corev1.Pod, status nvidia.WarmupStatus, now time.Time) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		current, err := w.clientset.CoreV1().Pods(pod.Namespace).Get(context.Background(), pod.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if current.UID != pod.UID {
+			return nil
+		}
+		condition := corev1.PodCondition{
+			Type:               util.GPUWarmupCondition,
+			Status:             status.Status,
+			Reason:             status.Reason,
+			Message:            status.Message,
+			LastProbeTime:      metav1.NewTime(now),
+			LastTransitionTime: metav1.NewTime(now),
+		}
+		found := false
+		for i, c := range current.Status.Conditions {
+			if c.Type != util.GPUWarmupCondition {
+				continue
+			}
+			if c.Status == status.Status {
+				condition.LastTransitionTime = c.LastTransitionTime
+			}
+			current.Status.Conditions[i] = condition
+			found = true
+		}
+		if !found {
+			current.Status.Conditions = append(current.Status.Conditions, condition)
+		}
+		_, err = w.clientset.CoreV1().Pods(pod.Namespace).UpdateStatus(context.Background(), current, metav1.UpdateOptions{})
+		return err
+	})
+}
@@ -0,0 +1,309 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+type EventType string
+
+const (
+	// EventAllocated is recorded when a pod the scheduler assigned devices to is bound.
+	EventAllocated EventType = "Allocated"
+	// EventReleased is recorded when a pod holding devices is removed from accounting.
+	EventReleased EventType = "Released"
+)
+
+// The components recording events. The scheduler records the allocations it binds and the
+// releases of the pods it bound, the device plugin the devices it hands to the containers of
+// a pod, and the vGPU monitor the pods of its node which stopped holding their devices.
+const (
+	SourceScheduler    = "scheduler"
+	SourceDevicePlugin = "device-plugin"
+	SourceMonitor      = "monitor"
+)
+
+// DeviceRecord describes a single device slice handed to a container.
+type DeviceRecord struct {
+	Vendor       string `json:"vendor"`
+	ContainerIdx int    `json:"containerIdx"`
+	Container    string `json:"container,omitempty"`
+	UUID         string `json:"uuid"`
+	Usedmem      int64  `json:"usedmem"`
+	Usedcores    int32  `json:"usedcores"`
+}
+
+// AllocationEvent is the typed record emitted for every allocation and release.
+type AllocationEvent struct {
+	Type      EventType `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	// Source is the component which recorded the event.
+	Source    string `json:"source"`
+	PodUID    string `json:"podUID"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Node      string `json:"node"`
+	// CostCenter is the hami.io/cost-center annotation of the pod.
+	CostCenter string         `json:"costCenter,omitempty"`
+	Devices    []DeviceRecord `json:"devices"`
+}
+
+// NewAllocationEvent builds an event for pod from the devices assigned on node.
+func NewAllocationEvent(t EventType, pod *corev1.Pod, node string, pd util.PodDevices) AllocationEvent {
+	ev := AllocationEvent{
+		Type:       t,
+		Timestamp:  time.Now().UTC(),
+		PodUID:     string(pod.UID),
+		Namespace:  pod.Namespace,
+		Name:       pod.Name,
+		Node:       node,
+		CostCenter: pod.Annotations[util.CostCenter],
+		Devices:    make([]DeviceRecord, 0),
+	}
+	for vendor, podSingle := range pd {
+		for ctridx, ctrdevs := range podSingle {
+			for _, d := range ctrdevs {
+				if len(d.UUID) == 0 {
+					continue
+				}
+				container := ""
+				if ctridx < len(pod.Spec.Containers) {
+					container = pod.Spec.Containers[ctridx].Name
+				}
+				ev.Devices = append(ev.Devices, DeviceRecord{
+					Vendor:       vendor,
+					ContainerIdx: ctridx,
+					Container:    container,
+					UUID:         d.UUID,
+					Usedmem:      d.Usedmem,
+					Usedcores:    d.Usedcores,
+				})
+			}
+		}
+	}
+	return ev
+}
+
+// Config configures the delivery of the audit records of a component.
+type Config struct {
+	// SinkURL is the endpoint the records are sent to. Empty disables auditing.
+	SinkURL string
+	// SinkType is `webhook` or `kafka-rest`.
+	SinkType string
+	// KafkaTopic is the topic used when SinkType is `kafka-rest`.
+	KafkaTopic string
+	// BufferSize is the number of undelivered records kept.
+	BufferSize int
+	// SpoolPath is the file the undelivered records are kept in, so they survive a restart.
+	// Empty keeps them in memory only.
+	SpoolPath string
+}
+
+// Start returns a Recorder delivering the records of source as configured by c until stopCh
+// is closed, nil if c has no sink.
+func Start(source string, c Config, stopCh <-chan struct{}) (*Recorder, error) {
+	if len(c.SinkURL) == 0 {
+		return nil, nil
+	}
+	sink, err := NewSink(c.SinkType, c.SinkURL, c.KafkaTopic)
+	if err != nil {
+		return nil, err
+	}
+	r := NewRecorder(source, sink, c.BufferSize)
+	if len(c.SpoolPath) > 0 {
+		if err := r.Spool(c.SpoolPath); err != nil {
+			return nil, fmt.Errorf("failed to open audit spool %s: %w", c.SpoolPath, err)
+		}
+	}
+	go r.Run(stopCh)
+	return r, nil
+}
+
+// Recorder buffers allocation events and delivers them to a Sink in the
+// background. Events are only removed from the buffer after the sink
+// acknowledges them, which gives at-least-once delivery as long as the buffer
+// does not overflow. The buffer is kept in memory, and in a spool file when
+// Spool was called.
+type Recorder struct {
+	source    string
+	sink      Sink
+	maxBuffer int
+	batchSize int
+	backoff   time.Duration
+
+	mutex  sync.Mutex
+	seq    uint64
+	buffer []bufferedEvent
+	spool  *spool
+	notify chan struct{}
+}
+
+type bufferedEvent struct {
+	Seq   uint64          `json:"seq"`
+	Event AllocationEvent `json:"event"`
+}
+
+// NewRecorder returns a Recorder of the events of source.
+func NewRecorder(source string, sink Sink, maxBuffer int) *Recorder {
+	if maxBuffer <= 0 {
+		maxBuffer = 10000
+	}
+	return &Recorder{
+		source:    source,
+		sink:      sink,
+		maxBuffer: maxBuffer,
+		batchSize: 100,
+		backoff:   time.Second,
+		buffer:    make([]bufferedEvent, 0),
+		notify:    make(chan struct{}, 1),
+	}
+}
+
+// Spool keeps the buffer in the file at path as well, and queues the events a previous
+// Recorder left undelivered in it.
+func (r *Recorder) Spool(path string) error {
+	s, spooled, err := openSpool(path)
+	if err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if len(spooled) > r.maxBuffer {
+		klog.Warningf("audit spool holds %d events, dropping the oldest %d", len(spooled), len(spooled)-r.maxBuffer)
+		spooled = spooled[len(spooled)-r.maxBuffer:]
+	}
+	for _, b := range spooled {
+		r.seq = max(r.seq, b.Seq)
+	}
+	r.buffer = append(spooled, r.buffer...)
+	r.spool = s
+	r.rewriteSpool()
+	if len(spooled) > 0 {
+		klog.InfoS("Queued undelivered audit events from the spool", "path", path, "events", len(spooled))
+		select {
+		case r.notify <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Record queues an event for delivery. It never blocks the caller; if the
+// buffer is full the oldest event is dropped.
+func (r *Recorder) Record(ev AllocationEvent) {
+	if r == nil {
+		return
+	}
+	if len(ev.Source) == 0 {
+		ev.Source = r.source
+	}
+	r.mutex.Lock()
+	if len(r.buffer) >= r.maxBuffer {
+		dropped := r.buffer[0].Event
+		r.buffer = r.buffer[1:]
+		klog.Warningf("audit buffer full, dropping oldest event %s for pod %s/%s", dropped.Type, dropped.Namespace, dropped.Name)
+	}
+	r.seq++
+	b := bufferedEvent{Seq: r.seq, Event: ev}
+	r.buffer = append(r.buffer, b)
+	if r.spool != nil {
+		// The spool is only compacted on delivery, so it is bounded while the sink is down.
+		if r.spool.lines >= 2*r.maxBuffer {
+			r.rewriteSpool()
+		} else if err := r.spool.append(b); err != nil {
+			klog.ErrorS(err, "Failed to spool audit event", "path", r.spool.path)
+		}
+	}
+	r.mutex.Unlock()
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
+
+// rewriteSpool writes the buffer to the spool. The caller holds the mutex.
+func (r *Recorder) rewriteSpool() {
+	if r.spool == nil {
+		return
+	}
+	if err := r.spool.rewrite(r.buffer); err != nil {
+		klog.ErrorS(err, "Failed to rewrite audit spool", "path", r.spool.path)
+	}
+}
+
+// Pending returns the number of events waiting to be delivered.
+func (r *Recorder) Pending() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return len(r.buffer)
+}
+
+// Run delivers buffered events until stopCh is closed.
+func (r *Recorder) Run(stopCh <-chan struct{}) {
+	klog.InfoS("Starting audit recorder", "sink", r.sink.Name())
+	backoff := r.backoff
+	for {
+		select {
+		case <-stopCh:
+			klog.InfoS("Stopping audit recorder", "pendingEvents", r.Pending())
+			return
+		case <-r.notify:
+		case <-time.After(backoff):
+		}
+		for r.Pending() > 0 {
+			if err := r.flush(); err != nil {
+				klog.ErrorS(err, "Failed to deliver audit events, will retry", "sink", r.sink.Name(), "pendingEvents", r.Pending(), "backoff", backoff)
+				backoff = min(backoff*2, time.Minute)
+				break
+			}
+			backoff = r.backoff
+		}
+	}
+}
+
+func (r *Recorder) flush() error {
+	r.mutex.Lock()
+	n := min(len(r.buffer), r.batchSize)
+	batch := make([]AllocationEvent, 0, n)
+	for _, b := range r.buffer[:n] {
+		batch = append(batch, b.Event)
+	}
+	lastSeq := r.buffer[n-1].Seq
+	r.mutex.Unlock()
+
+	if err := r.sink.Send(batch); err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	// Record may have dropped entries from the head meanwhile, so trim by sequence rather than by count.
+	idx := 0
+	for idx < len(r.buffer) && r.buffer[idx].Seq <= lastSeq {
+		idx++
+	}
+	r.buffer = r.buffer[idx:]
+	r.rewriteSpool()
+	r.mutex.Unlock()
+	return nil
+}
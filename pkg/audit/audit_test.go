@@ -0,0 +1,211 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+type fakeSink struct {
+	mutex    sync.Mutex
+	failures int
+	received []AllocationEvent
+}
+
+func (f *fakeSink) Name() string { return "fake" }
+
+func (f *fakeSink) Send(events []AllocationEvent) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.failures > 0 {
+		f.failures--
+		return errors.New("sink unavailable")
+	}
+	f.received = append(f.received, events...)
+	return nil
+}
+
+func (f *fakeSink) count() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return len(f.received)
+}
+
+func testPod() *corev1.Pod {
+	return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "p1", Namespace: "default", UID: "uid-1"}}
+}
+
+func TestNewAllocationEvent(t *testing.T) {
+	pd := util.PodDevices{
+		"NVIDIA": util.PodSingleDevice{
+			{{UUID: "GPU-0", Type: "NVIDIA", Usedmem: 1024, Usedcores: 30}},
+			{},
+			{{UUID: "GPU-1", Type: "NVIDIA", Usedmem: 2048, Usedcores: 50}},
+		},
+	}
+	ev := NewAllocationEvent(EventAllocated, testPod(), "node1", pd)
+	assert.Equal(t, ev.Type, EventAllocated)
+	assert.Equal(t, ev.PodUID, "uid-1")
+	assert.Equal(t, ev.Node, "node1")
+	assert.Equal(t, len(ev.Devices), 2)
+	assert.Equal(t, ev.Devices[1].ContainerIdx, 2)
+	assert.Equal(t, ev.Devices[1].Usedmem, int64(2048))
+	assert.Equal(t, ev.CostCenter, "")
+	assert.Equal(t, ev.Devices[1].Container, "")
+
+	pod := testPod()
+	pod.Spec.Containers = []corev1.Container{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	assert.Equal(t, NewAllocationEvent(EventAllocated, pod, "node1", pd).Devices[1].Container, "c")
+
+	pod = testPod()
+	pod.Annotations = map[string]string{util.CostCenter: "research"}
+	assert.Equal(t, NewAllocationEvent(EventReleased, pod, "node1", pd).CostCenter, "research")
+}
+
+func TestRecorderRetriesUntilDelivered(t *testing.T) {
+	sink := &fakeSink{failures: 2}
+	r := NewRecorder(SourceScheduler, sink, 10)
+	r.backoff = 10 * time.Millisecond
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go r.Run(stopCh)
+
+	r.Record(NewAllocationEvent(EventAllocated, testPod(), "node1", util.PodDevices{}))
+	r.Record(NewAllocationEvent(EventReleased, testPod(), "node1", util.PodDevices{}))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for sink.count() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, sink.count(), 2)
+	assert.Equal(t, r.Pending(), 0)
+	assert.Equal(t, sink.received[0].Type, EventAllocated)
+	assert.Equal(t, sink.received[1].Type, EventReleased)
+	assert.Equal(t, sink.received[0].Source, SourceScheduler)
+}
+
+func TestRecorderSpool(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "spool")
+	r := NewRecorder(SourceDevicePlugin, &fakeSink{failures: 1}, 10)
+	assert.NilError(t, r.Spool(path))
+	for _, name := range []string{"a", "b"} {
+		ev := NewAllocationEvent(EventAllocated, testPod(), "node1", util.PodDevices{})
+		ev.Name = name
+		r.Record(ev)
+	}
+	// The sink is down, the events survive a restart in the spool.
+	assert.ErrorContains(t, r.flush(), "sink unavailable")
+
+	sink := &fakeSink{}
+	restarted := NewRecorder(SourceDevicePlugin, sink, 10)
+	assert.NilError(t, restarted.Spool(path))
+	assert.Equal(t, restarted.Pending(), 2)
+	restarted.Record(NewAllocationEvent(EventReleased, testPod(), "node1", util.PodDevices{}))
+	assert.NilError(t, restarted.flush())
+	assert.Equal(t, sink.count(), 3)
+	assert.Equal(t, sink.received[0].Name, "a")
+	assert.Equal(t, sink.received[2].Type, EventReleased)
+	assert.Equal(t, sink.received[2].Source, SourceDevicePlugin)
+
+	// Delivered events leave the spool.
+	_, spooled, err := openSpool(path)
+	assert.NilError(t, err)
+	assert.Equal(t, len(spooled), 0)
+}
+
+func TestRecorderSpoolSkipsTruncatedLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spool")
+	r := NewRecorder(SourceMonitor, &fakeSink{}, 10)
+	assert.NilError(t, r.Spool(path))
+	r.Record(NewAllocationEvent(EventReleased, testPod(), "node1", util.PodDevices{}))
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	assert.NilError(t, err)
+	_, err = f.WriteString(`{"seq":2,"event":{"type":"Rel`)
+	assert.NilError(t, err)
+	assert.NilError(t, f.Close())
+
+	restarted := NewRecorder(SourceMonitor, &fakeSink{}, 10)
+	assert.NilError(t, restarted.Spool(path))
+	assert.Equal(t, restarted.Pending(), 1)
+	// New events are numbered after the spooled ones.
+	restarted.Record(NewAllocationEvent(EventReleased, testPod(), "node1", util.PodDevices{}))
+	assert.Equal(t, restarted.buffer[1].Seq, uint64(2))
+}
+
+func TestRecorderDropsOldestWhenFull(t *testing.T) {
+	r := NewRecorder(SourceScheduler, &fakeSink{}, 2)
+	for _, name := range []string{"a", "b", "c"} {
+		ev := NewAllocationEvent(EventAllocated, testPod(), "node1", util.PodDevices{})
+		ev.Name = name
+		r.Record(ev)
+	}
+	assert.Equal(t, r.Pending(), 2)
+	assert.Equal(t, r.buffer[0].Event.Name, "b")
+}
+
+func TestNilRecorder(t *testing.T) {
+	var r *Recorder
+	r.Record(NewAllocationEvent(EventAllocated, testPod(), "node1", util.PodDevices{}))
+}
+
+func TestSinks(t *testing.T) {
+	var gotPath, gotContentType string
+	var gotBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotContentType = r.Header.Get("Content-Type")
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	events := []AllocationEvent{NewAllocationEvent(EventAllocated, testPod(), "node1", util.PodDevices{})}
+
+	webhook, err := NewSink(SinkTypeWebhook, server.URL+"/audit", "")
+	assert.NilError(t, err)
+	assert.NilError(t, webhook.Send(events))
+	assert.Equal(t, gotPath, "/audit")
+	var decoded []AllocationEvent
+	assert.NilError(t, json.Unmarshal(gotBody, &decoded))
+	assert.Equal(t, decoded[0].PodUID, "uid-1")
+
+	kafka, err := NewSink(SinkTypeKafkaREST, server.URL, "gpu-audit")
+	assert.NilError(t, err)
+	assert.NilError(t, kafka.Send(events))
+	assert.Equal(t, gotPath, "/topics/gpu-audit")
+	assert.Equal(t, gotContentType, "application/vnd.kafka.json.v2+json")
+
+	_, err = NewSink(SinkTypeKafkaREST, server.URL, "")
+	assert.ErrorContains(t, err, "topic")
+	_, err = NewSink("unknown", server.URL, "")
+	assert.ErrorContains(t, err, "unknown audit sink type")
+}
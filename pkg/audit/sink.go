@@ -0,0 +1,112 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	SinkTypeWebhook   = "webhook"
+	SinkTypeKafkaREST = "kafka-rest"
+)
+
+// Sink delivers a batch of events. A nil error means the whole batch was accepted.
+type Sink interface {
+	Name() string
+	Send(events []AllocationEvent) error
+}
+
+// NewSink returns the sink of the given type pointing at url.
+func NewSink(sinkType, url, topic string) (Sink, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	switch sinkType {
+	case "", SinkTypeWebhook:
+		return &WebhookSink{url: url, client: client}, nil
+	case SinkTypeKafkaREST:
+		if topic == "" {
+			return nil, fmt.Errorf("kafka topic must be set for sink type %s", SinkTypeKafkaREST)
+		}
+		return &KafkaRESTSink{url: strings.TrimSuffix(url, "/") + "/topics/" + topic, client: client}, nil
+	default:
+		return nil, fmt.Errorf("unknown audit sink type %q", sinkType)
+	}
+}
+
+// WebhookSink posts events as a JSON array to an HTTP endpoint.
+type WebhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *WebhookSink) Name() string {
+	return SinkTypeWebhook
+}
+
+func (s *WebhookSink) Send(events []AllocationEvent) error {
+	body, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	return post(s.client, s.url, "application/json", body)
+}
+
+// KafkaRESTSink produces events to a Kafka topic through a Kafka REST proxy
+// (v2 API), so no Kafka client library is needed in the scheduler.
+type KafkaRESTSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *KafkaRESTSink) Name() string {
+	return SinkTypeKafkaREST
+}
+
+func (s *KafkaRESTSink) Send(events []AllocationEvent) error {
+	type record struct {
+		Key   string          `json:"key"`
+		Value AllocationEvent `json:"value"`
+	}
+	payload := struct {
+		Records []record `json:"records"`
+	}{}
+	for _, ev := range events {
+		payload.Records = append(payload.Records, record{Key: ev.PodUID, Value: ev})
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return post(s.client, s.url, "application/vnd.kafka.json.v2+json", body)
+}
+
+func post(client *http.Client, url, contentType string, body []byte) error {
+	resp, err := client.Post(url, contentType, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("sink %s returned status %d", url, resp.StatusCode)
+	}
+	return nil
+}
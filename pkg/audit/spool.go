@@ -0,0 +1,123 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"k8s.io/klog/v2"
+)
+
+// spool keeps the undelivered events in a file of JSON lines. Recorded events are appended
+// to it, and it is rewritten with the remaining ones once some are delivered.
+type spool struct {
+	path  string
+	file  *os.File
+	lines int
+}
+
+// openSpool opens the spool at path and returns the events it holds. A line cut short by a
+// crash while it was appended is skipped.
+func openSpool(path string) (*spool, []bufferedEvent, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, nil, err
+	}
+	events := make([]bufferedEvent, 0)
+	f, err := os.Open(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, err
+	}
+	if err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			b := bufferedEvent{}
+			if err := json.Unmarshal(scanner.Bytes(), &b); err != nil {
+				klog.Warningf("Skipping invalid line of audit spool %s: %v", path, err)
+				continue
+			}
+			events = append(events, b)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, nil, err
+		}
+	}
+	return &spool{path: path}, events, nil
+}
+
+func (s *spool) append(b bufferedEvent) error {
+	if s.file == nil {
+		f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			return err
+		}
+		s.file = f
+	}
+	line, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	s.lines++
+	return nil
+}
+
+// rewrite replaces the spool with buffer.
+func (s *spool) rewrite(buffer []bufferedEvent) error {
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+	tmp := s.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, b := range buffer {
+		line, err := json.Marshal(b)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		w.Write(line)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	s.lines = len(buffer)
+	return nil
+}
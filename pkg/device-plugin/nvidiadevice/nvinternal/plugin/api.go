@@ -39,4 +39,6 @@ type Interface interface {
 	Devices() rm.Devices
 	Start() error
 	Stop() error
+	// Ready reports an error while the plugin can't serve allocations.
+	Ready() error
 }
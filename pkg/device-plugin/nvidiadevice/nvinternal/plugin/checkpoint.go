@@ -0,0 +1,221 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+	"github.com/Project-HAMi/HAMi/pkg/util/client"
+)
+
+// maxCheckpointedAssignments bounds the assignment checkpoint, the oldest assignments are
+// dropped first.
+const maxCheckpointedAssignments = 1024
+
+// assignment is the devices Allocate handed to a container.
+type assignment struct {
+	Namespace string    `json:"namespace"`
+	Pod       string    `json:"pod"`
+	UID       string    `json:"uid"`
+	Container string    `json:"container"`
+	Devices   string    `json:"devices"`
+	At        time.Time `json:"at"`
+}
+
+// assignmentCheckpoint remembers the devices Allocate handed to containers, so what the plugin
+// assigned before it went down can be told after a restart. Allocate only records in memory,
+// the file is written by flush once the in-flight calls drained on shutdown, and read back by
+// the next plugin, which reconciles it with the pods on the node before it serves Allocate.
+// A nil *assignmentCheckpoint records nothing.
+type assignmentCheckpoint struct {
+	path    string
+	mutex   sync.Mutex
+	entries map[string]assignment
+	dirty   bool
+}
+
+// assignmentCheckpointPath returns the checkpoint of the plugin serving resource, in the
+// directory of HAMi-core on the host.
+func assignmentCheckpointPath(resource string) string {
+	return fmt.Sprintf("%s/vgpu/assignments-%s.json", hostHookPath, strings.ReplaceAll(resource, "/", "_"))
+}
+
+// newAssignmentCheckpoint returns the checkpoint in path, with the assignments it already holds.
+func newAssignmentCheckpoint(path string) *assignmentCheckpoint {
+	c := &assignmentCheckpoint{path: path, entries: make(map[string]assignment)}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			klog.Warningf("Failed to read the assignment checkpoint %s: %v", path, err)
+		}
+		return c
+	}
+	var entries []assignment
+	if err := json.Unmarshal(data, &entries); err != nil {
+		klog.Warningf("Ignoring the invalid assignment checkpoint %s: %v", path, err)
+		return c
+	}
+	for _, e := range entries {
+		c.entries[e.UID+"/"+e.Container] = e
+	}
+	return c
+}
+
+// record remembers that devices were handed to container of pod at now.
+func (c *assignmentCheckpoint) record(pod *corev1.Pod, container string, devices util.ContainerDevices, now time.Time) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries[string(pod.UID)+"/"+container] = assignment{
+		Namespace: pod.Namespace,
+		Pod:       pod.Name,
+		UID:       string(pod.UID),
+		Container: container,
+		Devices:   util.EncodeContainerDevices(devices),
+		At:        now,
+	}
+	c.dirty = true
+}
+
+// flush writes the checkpoint if it changed since the last flush. The file is replaced
+// atomically, so a plugin killed while flushing leaves the previous checkpoint.
+func (c *assignmentCheckpoint) flush() error {
+	if c == nil {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.dirty {
+		return nil
+	}
+	entries := make([]assignment, 0, len(c.entries))
+	for _, e := range c.entries {
+		entries = append(entries, e)
+	}
+	slices.SortFunc(entries, func(a, b assignment) int { return b.At.Compare(a.At) })
+	if len(entries) > maxCheckpointedAssignments {
+		for _, e := range entries[maxCheckpointedAssignments:] {
+			delete(c.entries, e.UID+"/"+e.Container)
+		}
+		entries = entries[:maxCheckpointedAssignments]
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return err
+	}
+	c.dirty = false
+	return nil
+}
+
+// reconcile drops the assignments of the pods which are no longer on the node, and returns
+// the pods of pods, the ones on the node, still allocating although their containers were
+// handed devices: the plugin went down before it marked their allocation done.
+func (c *assignmentCheckpoint) reconcile(pods []corev1.Pod) []*corev1.Pod {
+	if c == nil {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	byUID := make(map[string]*corev1.Pod)
+	for i := range pods {
+		byUID[string(pods[i].UID)] = &pods[i]
+	}
+	unfinished := make([]*corev1.Pod, 0)
+	for key, e := range c.entries {
+		pod, ok := byUID[e.UID]
+		if !ok {
+			delete(c.entries, key)
+			c.dirty = true
+			continue
+		}
+		if pod.Annotations[util.DeviceBindPhase] == util.DeviceBindAllocating && !slices.Contains(unfinished, pod) {
+			unfinished = append(unfinished, pod)
+		}
+	}
+	return unfinished
+}
+
+// reconcileAssignments reconciles the checkpoint with the pods on the node. A pod left
+// allocating by the previous plugin would be taken by GetPendingPod for the next Allocate,
+// so its allocation is completed if all its devices were handed out.
+func (plugin *NvidiaDevicePlugin) reconcileAssignments() {
+	if plugin.checkpoint == nil {
+		return
+	}
+	pods, err := client.GetClient().CoreV1().Pods("").List(context.Background(), metav1.ListOptions{
+		FieldSelector: "spec.nodeName=" + util.NodeName,
+	})
+	if err != nil {
+		klog.Warningf("Failed to list the pods to reconcile the assignment checkpoint of '%s': %v", plugin.rm.Resource(), err)
+		return
+	}
+	for _, pod := range plugin.checkpoint.reconcile(pods.Items) {
+		klog.Infof("Completing the allocation of pod %s/%s the previous plugin handed devices to", pod.Namespace, pod.Name)
+		device.PodAllocationTrySuccess(util.NodeName, nvidia.NvidiaGPUDevice, NodeLockNvidia, pod)
+	}
+	if err := plugin.checkpoint.flush(); err != nil {
+		klog.Warningf("Failed to flush the assignment checkpoint of '%s': %v", plugin.rm.Resource(), err)
+	}
+}
@@ -0,0 +1,166 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/Project-HAMi/HAMi/pkg/util"
+	"github.com/Project-HAMi/HAMi/pkg/util/client"
+)
+
+func checkpointPod(name string) *corev1.Pod {
+	return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, UID: k8stypes.UID("uid-" + name)}}
+}
+
+func readCheckpoint(t *testing.T, path string) []assignment {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var entries []assignment
+	require.NoError(t, json.Unmarshal(data, &entries))
+	return entries
+}
+
+func TestAssignmentCheckpointFlush(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "assignments.json")
+	c := newAssignmentCheckpoint(path)
+	require.NoError(t, c.flush())
+	require.NoFileExists(t, path, "nothing was recorded")
+
+	now := time.Now().UTC().Truncate(time.Second)
+	devices := util.ContainerDevices{{UUID: "GPU-0", Type: "NVIDIA", Usedmem: 1000 * util.MiB, Usedcores: 30}}
+	c.record(checkpointPod("train"), "trainer", devices, now)
+	require.NoError(t, c.flush())
+	require.Equal(t, []assignment{{
+		Namespace: "default", Pod: "train", UID: "uid-train", Container: "trainer", Devices: "GPU-0,NVIDIA,1000,30:", At: now,
+	}}, readCheckpoint(t, path))
+
+	// A restarted plugin keeps the assignments of the previous one.
+	c = newAssignmentCheckpoint(path)
+	c.record(checkpointPod("serve"), "server", devices, now.Add(time.Second))
+	require.NoError(t, c.flush())
+	entries := readCheckpoint(t, path)
+	require.Len(t, entries, 2)
+	require.Equal(t, "serve", entries[0].Pod, "the newest assignment comes first")
+}
+
+func TestAssignmentCheckpointBounded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "assignments.json")
+	c := newAssignmentCheckpoint(path)
+	now := time.Now()
+	for i := range maxCheckpointedAssignments + 10 {
+		c.record(checkpointPod(fmt.Sprint(i)), "ctr", nil, now.Add(time.Duration(i)*time.Second))
+	}
+	require.NoError(t, c.flush())
+	entries := readCheckpoint(t, path)
+	require.Len(t, entries, maxCheckpointedAssignments)
+	require.Equal(t, fmt.Sprint(maxCheckpointedAssignments+9), entries[0].Pod)
+	require.Equal(t, "10", entries[len(entries)-1].Pod, "the oldest assignments are dropped")
+}
+
+func TestStopFlushesCheckpointAfterDrain(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "assignments.json")
+	plugin := &NvidiaDevicePlugin{
+		rm:         &fakeResourceManager{},
+		socket:     filepath.Join(dir, "nvidia.sock"),
+		server:     grpc.NewServer(),
+		stop:       make(chan any),
+		inflight:   &inflightTracker{},
+		checkpoint: newAssignmentCheckpoint(path),
+	}
+	// An Allocate call still running when the plugin is stopped records its assignment
+	// before the checkpoint is flushed.
+	require.True(t, plugin.inflight.acquire())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		plugin.checkpoint.record(checkpointPod("train"), "trainer", nil, time.Now())
+		plugin.inflight.release()
+	}()
+	require.NoError(t, plugin.Stop())
+	entries := readCheckpoint(t, path)
+	require.Len(t, entries, 1)
+	require.Equal(t, "train", entries[0].Pod)
+}
+
+func TestReconcileAssignments(t *testing.T) {
+	util.NodeName = "node1"
+	path := filepath.Join(t.TempDir(), "assignments.json")
+	c := newAssignmentCheckpoint(path)
+	now := time.Now()
+	for _, name := range []string{"gone", "stuck", "done"} {
+		c.record(checkpointPod(name), "ctr", nil, now)
+	}
+	require.NoError(t, c.flush())
+
+	onNode := func(name, phase string) *corev1.Pod {
+		pod := checkpointPod(name)
+		pod.Spec.NodeName = "node1"
+		pod.Annotations = map[string]string{util.DeviceBindPhase: phase}
+		return pod
+	}
+	// The previous plugin handed devices to stuck but went down before it marked the
+	// allocation done, a pod it didn't hand devices to is left alone.
+	stuck := onNode("stuck", util.DeviceBindAllocating)
+	pending := onNode("pending", util.DeviceBindAllocating)
+	kubeClient := fake.NewSimpleClientset(stuck, pending, onNode("done", util.DeviceBindSuccess))
+	client.KubeClient = kubeClient
+	plugin := &NvidiaDevicePlugin{rm: &fakeResourceManager{}, checkpoint: newAssignmentCheckpoint(path)}
+	plugin.reconcileAssignments()
+
+	stuck, err := kubeClient.CoreV1().Pods("default").Get(context.Background(), "stuck", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, util.DeviceBindSuccess, stuck.Annotations[util.DeviceBindPhase])
+	pending, err = kubeClient.CoreV1().Pods("default").Get(context.Background(), "pending", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, util.DeviceBindAllocating, pending.Annotations[util.DeviceBindPhase])
+
+	pods := make([]string, 0)
+	for _, e := range readCheckpoint(t, path) {
+		pods = append(pods, e.Pod)
+	}
+	require.ElementsMatch(t, []string{"stuck", "done"}, pods, "the assignments of the pods gone are dropped")
+}
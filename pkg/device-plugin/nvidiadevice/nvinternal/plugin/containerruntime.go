@@ -0,0 +1,255 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+const (
+	// EventReasonGPURuntimeMissing is recorded on the node when devices allocated on it won't
+	// be mounted into containers.
+	EventReasonGPURuntimeMissing = "GPURuntimeMissing"
+
+	// RuntimeCheckOff, RuntimeCheckWarn and RuntimeCheckEnforce are the values of RuntimeCheck.
+	RuntimeCheckOff     = "off"
+	RuntimeCheckWarn    = "warn"
+	RuntimeCheckEnforce = "enforce"
+)
+
+var (
+	// RuntimeCheck is what the plugin does when the container runtime of the node won't mount
+	// the allocated devices: "warn" logs it and records a node event, "enforce" also keeps the
+	// plugin from advertising devices, "off" doesn't check.
+	RuntimeCheck = RuntimeCheckWarn
+
+	// hostEtcPath is where the /etc directory of the host is mounted.
+	hostEtcPath = "/hostetc"
+	// hostUsrBinPath is where the /usr/bin directory of the host is mounted.
+	hostUsrBinPath = "/usrbin"
+
+	detectedRuntime atomic.Pointer[RuntimeInfo]
+
+	containerdDefaultNvidia = regexp.MustCompile(`default_runtime_name\s*=\s*"nvidia"`)
+	containerdCDI           = regexp.MustCompile(`enable_cdi\s*=\s*(true|false)`)
+	crioDefaultNvidia       = regexp.MustCompile(`default_runtime\s*=\s*"nvidia"`)
+)
+
+// RuntimeInfo is what the plugin found out about the container runtime of the node.
+type RuntimeInfo struct {
+	// Runtime is the name of the container runtime, e.g. "containerd", and Version its version.
+	Runtime string `json:"runtime"`
+	Version string `json:"version,omitempty"`
+	// NvidiaRuntimeInstalled is set if nvidia-container-runtime or its hook is on the host.
+	NvidiaRuntimeInstalled bool `json:"nvidiaRuntimeInstalled"`
+	// NvidiaRuntimeConfigured is set if the container runtime knows the nvidia runtime, as a
+	// runtime handler or as an OCI hook, and NvidiaRuntimeDefault if it applies to all pods.
+	NvidiaRuntimeConfigured bool `json:"nvidiaRuntimeConfigured"`
+	NvidiaRuntimeDefault    bool `json:"nvidiaRuntimeDefault"`
+	// CDIEnabled is set if the container runtime injects CDI devices.
+	CDIEnabled bool `json:"cdiEnabled"`
+	// CDIInjection is set if the plugin asks for its devices through CDI.
+	CDIInjection bool `json:"cdiInjection"`
+	// Injectable is unset if the allocated devices won't be mounted into containers.
+	Injectable bool `json:"injectable"`
+	// Problems are why devices won't be mounted, or might not be.
+	Problems  []string  `json:"problems,omitempty"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// DetectedRuntime returns the result of the last container runtime check, nil before the first.
+func DetectedRuntime() *RuntimeInfo {
+	return detectedRuntime.Load()
+}
+
+// readConfigs returns the contents of the files at paths of the host /etc, expanding globs.
+// Missing files are skipped.
+func readConfigs(paths ...string) (string, error) {
+	var b strings.Builder
+	found := false
+	for _, p := range paths {
+		matches, err := filepath.Glob(filepath.Join(hostEtcPath, p))
+		if err != nil {
+			return "", err
+		}
+		for _, m := range matches {
+			data, err := os.ReadFile(m)
+			if err != nil {
+				return "", err
+			}
+			found = true
+			b.Write(data)
+			b.WriteByte('\n')
+		}
+	}
+	if !found {
+		return "", os.ErrNotExist
+	}
+	return b.String(), nil
+}
+
+// detectRuntime inspects the configuration of the container runtime running with
+// runtimeVersion, as reported in the node status, e.g. "containerd://1.7.2". cdiInjection is
+// set if the plugin hands out its devices through CDI rather than the nvidia runtime.
+func detectRuntime(runtimeVersion string, cdiInjection bool) *RuntimeInfo {
+	info := &RuntimeInfo{CDIInjection: cdiInjection, CheckedAt: time.Now()}
+	info.Runtime, info.Version, _ = strings.Cut(runtimeVersion, "://")
+	for _, bin := range []string{"nvidia-container-runtime", "nvidia-container-runtime-hook", "nvidia-container-toolkit"} {
+		if _, err := os.Stat(filepath.Join(hostUsrBinPath, bin)); err == nil {
+			info.NvidiaRuntimeInstalled = true
+		}
+	}
+
+	var cfg string
+	var err error
+	switch info.Runtime {
+	case "containerd":
+		cfg, err = readConfigs("containerd/config.toml", "containerd/conf.d/*.toml")
+		if err == nil {
+			info.NvidiaRuntimeConfigured = strings.Contains(cfg, "nvidia-container-runtime")
+			info.NvidiaRuntimeDefault = info.NvidiaRuntimeConfigured && containerdDefaultNvidia.MatchString(cfg)
+			// containerd enables CDI by default since 2.0.
+			info.CDIEnabled = strings.HasPrefix(strings.TrimPrefix(info.Version, "v"), "2.")
+			if m := containerdCDI.FindStringSubmatch(cfg); m != nil {
+				info.CDIEnabled = m[1] == "true"
+			}
+		}
+	case "cri-o":
+		cfg, err = readConfigs("crio/crio.conf", "crio/crio.conf.d/*")
+		if err == nil {
+			info.NvidiaRuntimeConfigured = strings.Contains(cfg, "nvidia-container-runtime")
+			info.NvidiaRuntimeDefault = info.NvidiaRuntimeConfigured && crioDefaultNvidia.MatchString(cfg)
+			// CRI-O always injects CDI devices.
+			info.CDIEnabled = true
+		}
+		// An OCI hook applies to every container.
+		if hooks, hookErr := readConfigs("containers/oci/hooks.d/*nvidia*"); hookErr == nil && strings.Contains(hooks, "nvidia-container") {
+			info.NvidiaRuntimeConfigured, info.NvidiaRuntimeDefault, err = true, true, nil
+		}
+	case "docker":
+		cfg, err = readConfigs("docker/daemon.json")
+		if err == nil {
+			var daemon struct {
+				Runtimes       map[string]json.RawMessage `json:"runtimes"`
+				DefaultRuntime string                     `json:"default-runtime"`
+				Features       map[string]bool            `json:"features"`
+			}
+			if jsonErr := json.Unmarshal([]byte(cfg), &daemon); jsonErr != nil {
+				err = fmt.Errorf("docker/daemon.json: %w", jsonErr)
+				break
+			}
+			_, info.NvidiaRuntimeConfigured = daemon.Runtimes["nvidia"]
+			info.NvidiaRuntimeDefault = info.NvidiaRuntimeConfigured && daemon.DefaultRuntime == "nvidia"
+			info.CDIEnabled = daemon.Features["cdi"]
+		}
+	default:
+		info.Problems = append(info.Problems, fmt.Sprintf("unknown container runtime %q, can't check whether devices are mounted into containers", runtimeVersion))
+		info.Injectable = true
+		return info
+	}
+	if err != nil {
+		// The configuration isn't mounted, or the runtime runs with its built-in defaults.
+		if errors.Is(err, os.ErrNotExist) {
+			err = fmt.Errorf("no %s configuration found in %s", info.Runtime, hostEtcPath)
+		}
+		info.Problems = append(info.Problems, fmt.Sprintf("can't check the %s configuration: %v", info.Runtime, err))
+		info.Injectable = info.NvidiaRuntimeInstalled || cdiInjection
+		return info
+	}
+
+	if cdiInjection {
+		info.Injectable = info.CDIEnabled
+		if !info.CDIEnabled {
+			info.Problems = append(info.Problems, fmt.Sprintf("devices are requested through CDI, but CDI is not enabled in %s", info.Runtime))
+		}
+		return info
+	}
+	switch {
+	case !info.NvidiaRuntimeInstalled:
+		info.Problems = append(info.Problems, "nvidia-container-runtime is not installed on the node")
+	case !info.NvidiaRuntimeConfigured:
+		info.Problems = append(info.Problems, fmt.Sprintf("nvidia-container-runtime is not configured in %s", info.Runtime))
+	default:
+		info.Injectable = true
+		if !info.NvidiaRuntimeDefault {
+			info.Problems = append(info.Problems, fmt.Sprintf("nvidia is not the default runtime of %s, only pods with the nvidia runtimeClassName get their devices", info.Runtime))
+		}
+	}
+	return info
+}
+
+// checkRuntime checks whether the container runtime of the node mounts the devices the plugin
+// allocates, and returns an error if it doesn't and RuntimeCheck is "enforce".
+func (plugin *NvidiaDevicePlugin) checkRuntime() error {
+	if RuntimeCheck == RuntimeCheckOff {
+		return nil
+	}
+	node, err := util.GetNode(util.NodeName)
+	if err != nil {
+		klog.Warningf("Can't check the container runtime, failed to get node %s: %v", util.NodeName, err)
+		return nil
+	}
+	info := detectRuntime(node.Status.NodeInfo.ContainerRuntimeVersion, plugin.deviceListStrategies.IsCDIEnabled())
+	detectedRuntime.Store(info)
+	klog.Infof("Container runtime %s %s: nvidia runtime installed %t, configured %t, default %t, CDI enabled %t",
+		info.Runtime, info.Version, info.NvidiaRuntimeInstalled, info.NvidiaRuntimeConfigured, info.NvidiaRuntimeDefault, info.CDIEnabled)
+	for _, p := range info.Problems {
+		klog.Warningf("Container runtime check: %s", p)
+	}
+	if info.Injectable {
+		return nil
+	}
+	if plugin.nodeEvents == nil {
+		plugin.nodeEvents = newNodeEventRecorder()
+	}
+	msg := "Allocated GPUs won't be mounted into containers: " + strings.Join(info.Problems, "; ")
+	plugin.nodeEvents.Event(node, corev1.EventTypeWarning, EventReasonGPURuntimeMissing, msg)
+	klog.Error(msg)
+	if RuntimeCheck == RuntimeCheckEnforce {
+		return errors.New(msg)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectRuntime(t *testing.T) {
+	origEtc, origBin := hostEtcPath, hostUsrBinPath
+	defer func() { hostEtcPath, hostUsrBinPath = origEtc, origBin }()
+
+	tests := []struct {
+		name           string
+		runtime        string
+		files          map[string]string
+		binary         bool
+		cdiInjection   bool
+		wantInjectable bool
+		wantProblems   int
+		wantDefault    bool
+	}{
+		{
+			name:    "containerd with nvidia as default runtime",
+			runtime: "containerd://1.7.2",
+			files: map[string]string{"containerd/config.toml": `[plugins."io.containerd.grpc.v1.cri".containerd]
+  default_runtime_name = "nvidia"
+[plugins."io.containerd.grpc.v1.cri".containerd.runtimes.nvidia.options]
+  BinaryName = "/usr/bin/nvidia-container-runtime"`},
+			binary:         true,
+			wantInjectable: true,
+			wantDefault:    true,
+		},
+		{
+			name:    "containerd with nvidia as runtime class only",
+			runtime: "containerd://1.7.2",
+			files: map[string]string{"containerd/conf.d/99-nvidia.toml": `[plugins."io.containerd.grpc.v1.cri".containerd.runtimes.nvidia.options]
+  BinaryName = "/usr/bin/nvidia-container-runtime"`, "containerd/config.toml": `version = 2`},
+			binary:         true,
+			wantInjectable: true,
+			wantProblems:   1,
+		},
+		{
+			name:           "containerd without the nvidia runtime",
+			runtime:        "containerd://1.7.2",
+			files:          map[string]string{"containerd/config.toml": `version = 2`},
+			binary:         true,
+			wantInjectable: false,
+			wantProblems:   1,
+		},
+		{
+			name:           "toolkit not installed",
+			runtime:        "docker://24.0.5",
+			files:          map[string]string{"docker/daemon.json": `{"runtimes": {"nvidia": {"path": "nvidia-container-runtime"}}, "default-runtime": "nvidia"}`},
+			wantInjectable: false,
+			wantProblems:   1,
+			wantDefault:    true,
+		},
+		{
+			name:           "docker with nvidia as default runtime",
+			runtime:        "docker://24.0.5",
+			files:          map[string]string{"docker/daemon.json": `{"runtimes": {"nvidia": {"path": "nvidia-container-runtime"}}, "default-runtime": "nvidia"}`},
+			binary:         true,
+			wantInjectable: true,
+			wantDefault:    true,
+		},
+		{
+			name:           "cri-o with the nvidia OCI hook",
+			runtime:        "cri-o://1.28.1",
+			files:          map[string]string{"containers/oci/hooks.d/oci-nvidia-hook.json": `{"hook": {"path": "/usr/bin/nvidia-container-toolkit"}}`},
+			binary:         true,
+			wantInjectable: true,
+			wantDefault:    true,
+		},
+		{
+			name:           "CDI injection with containerd 2",
+			runtime:        "containerd://2.0.0",
+			files:          map[string]string{"containerd/config.toml": `version = 3`},
+			cdiInjection:   true,
+			wantInjectable: true,
+		},
+		{
+			name:           "CDI injection with CDI disabled",
+			runtime:        "containerd://1.7.2",
+			files:          map[string]string{"containerd/config.toml": `enable_cdi = false`},
+			cdiInjection:   true,
+			wantInjectable: false,
+			wantProblems:   1,
+		},
+		{
+			name:           "configuration not mounted",
+			runtime:        "containerd://1.7.2",
+			binary:         true,
+			wantInjectable: true,
+			wantProblems:   1,
+		},
+		{
+			name:           "unknown runtime",
+			runtime:        "remote://1.0",
+			wantInjectable: true,
+			wantProblems:   1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hostEtcPath, hostUsrBinPath = t.TempDir(), t.TempDir()
+			for name, content := range test.files {
+				path := filepath.Join(hostEtcPath, name)
+				require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+				require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+			}
+			if test.binary {
+				require.NoError(t, os.WriteFile(filepath.Join(hostUsrBinPath, "nvidia-container-runtime"), nil, 0o755))
+			}
+			info := detectRuntime(test.runtime, test.cdiInjection)
+			require.Equal(t, test.wantInjectable, info.Injectable, info.Problems)
+			require.Len(t, info.Problems, test.wantProblems, info.Problems)
+			require.Equal(t, test.wantDefault, info.NvidiaRuntimeDefault)
+		})
+	}
+}
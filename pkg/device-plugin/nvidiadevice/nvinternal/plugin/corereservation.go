@@ -0,0 +1,136 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+	"github.com/Project-HAMi/HAMi/pkg/util/client"
+)
+
+// EventReasonGPUCoreReservationExceeded is recorded on a node cordoned because its pods hold more
+// cores of a card than it advertises after a core reservation.
+const EventReasonGPUCoreReservationExceeded = "GPUCoreReservationExceeded"
+
+// coreOvercommit returns the cards of devices whose cores held by the running pods exceed the
+// cores advertised for them, with a description of each, sorted by card.
+func coreOvercommit(devices []*util.DeviceInfo, pods []corev1.Pod) []string {
+	held := make(map[string]int32)
+	for i := range pods {
+		p := &pods[i]
+		if p.Status.Phase == corev1.PodSucceeded || p.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		pd, err := util.DecodePodDevices(util.SupportDevices, p.Annotations)
+		if err != nil {
+			continue
+		}
+		for _, ctrdevs := range pd[nvidia.NvidiaGPUDevice] {
+			for _, d := range ctrdevs {
+				held[cardID(d.UUID)] += d.Usedcores
+			}
+		}
+	}
+	res := make([]string, 0)
+	for _, d := range devices {
+		if held[d.ID] > d.Devcore {
+			res = append(res, fmt.Sprintf("%s holds %d of %d cores", d.ID, held[d.ID], d.Devcore))
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// unenforcedCoreReservation returns why the cores held back by a core reservation aren't kept
+// free under cfg, "" if they are: the reservation only shrinks what is given to pods, the cores
+// are kept free by HAMi-core throttling the containers to their core limits.
+func unenforcedCoreReservation(cfg *nvidia.NvidiaConfig) string {
+	switch {
+	case cfg.DisableCoreLimit:
+		return "disableCoreLimit is set"
+	case cfg.GPUCorePolicy == nvidia.DisableCorePolicy:
+		return fmt.Sprintf("gpuCorePolicy is %s", nvidia.DisableCorePolicy)
+	}
+	return ""
+}
+
+// checkCoreReservation cordons node when its pods hold more cores of a card than advertised,
+// e.g. after a core reservation was added or raised. The pods keep running, and the node stays
+// cordoned until an admin uncordons it.
+func (plugin *NvidiaDevicePlugin) checkCoreReservation(node *corev1.Node, devices []*util.DeviceInfo) {
+	if nvidia.DevicePluginCoreReservation == nil {
+		return
+	}
+	ctx := context.Background()
+	pods, err := client.GetClient().CoreV1().Pods("").List(ctx, metav1.ListOptions{
+		FieldSelector: fmt.Sprintf("spec.nodeName=%s", node.Name),
+	})
+	if err != nil {
+		klog.Errorf("core reservation: failed to list pods of node %s: %v", node.Name, err)
+		return
+	}
+	exceeded := coreOvercommit(devices, pods.Items)
+	if len(exceeded) == 0 {
+		plugin.coreOvercommitReported = false
+		return
+	}
+	klog.Warningf("core reservation: pods on node %s hold more cores than advertised: %s", node.Name, strings.Join(exceeded, ", "))
+	if plugin.coreOvercommitReported {
+		return
+	}
+	plugin.coreOvercommitReported = true
+	if !node.Spec.Unschedulable {
+		patch := []byte(`{"spec":{"unschedulable":true}}`)
+		if _, err := client.GetClient().CoreV1().Nodes().Patch(ctx, node.Name, k8stypes.StrategicMergePatchType, patch, metav1.PatchOptions{}); err != nil {
+			klog.Errorf("core reservation: failed to cordon node %s: %v", node.Name, err)
+			plugin.coreOvercommitReported = false
+			return
+		}
+		klog.Warningf("core reservation: cordoned node %s", node.Name)
+	}
+	if plugin.nodeEvents == nil {
+		plugin.nodeEvents = newNodeEventRecorder()
+	}
+	plugin.nodeEvents.Eventf(node, corev1.EventTypeWarning, EventReasonGPUCoreReservationExceeded,
+		"Cordoned, pods hold more GPU cores than advertised after the core reservation: %s", strings.Join(exceeded, ", "))
+}
@@ -0,0 +1,104 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+	"github.com/Project-HAMi/HAMi/pkg/util/client"
+)
+
+func TestUnenforcedCoreReservation(t *testing.T) {
+	require.Equal(t, "", unenforcedCoreReservation(&nvidia.NvidiaConfig{}))
+	require.Equal(t, "", unenforcedCoreReservation(&nvidia.NvidiaConfig{GPUCorePolicy: nvidia.ForceCorePolicy}))
+	require.Equal(t, "gpuCorePolicy is disable", unenforcedCoreReservation(&nvidia.NvidiaConfig{GPUCorePolicy: nvidia.DisableCorePolicy}))
+	require.Equal(t, "disableCoreLimit is set", unenforcedCoreReservation(&nvidia.NvidiaConfig{DisableCoreLimit: true}))
+}
+
+func TestCoreOvercommit(t *testing.T) {
+	util.SupportDevices[nvidia.NvidiaGPUDevice] = "hami.io/vgpu-devices-allocated"
+	devices := []*util.DeviceInfo{{ID: "GPU-0", Devcore: 80}, {ID: "GPU-1", Devcore: 100}}
+	pods := []corev1.Pod{
+		*coTenantPod("a", "GPU-0", corev1.PodRunning),
+		*coTenantPod("b", "GPU-0", corev1.PodRunning),
+		*coTenantPod("c", "GPU-0", corev1.PodPending),
+		*coTenantPod("done", "GPU-0", corev1.PodSucceeded),
+		*coTenantPod("d", "GPU-1", corev1.PodRunning),
+	}
+	require.Equal(t, []string{"GPU-0 holds 90 of 80 cores"}, coreOvercommit(devices, pods))
+	require.Empty(t, coreOvercommit(devices, pods[:2]))
+}
+
+func TestCheckCoreReservation(t *testing.T) {
+	util.SupportDevices[nvidia.NvidiaGPUDevice] = "hami.io/vgpu-devices-allocated"
+	orig := nvidia.DevicePluginCoreReservation
+	defer func() { nvidia.DevicePluginCoreReservation = orig }()
+	nvidia.DevicePluginCoreReservation = &nvidia.CoreReservation{Cores: 20}
+
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+	kubeClient := fake.NewSimpleClientset(node)
+	for _, name := range []string{"a", "b", "c"} {
+		_, err := kubeClient.CoreV1().Pods("default").Create(context.Background(), coTenantPod(name, "GPU-0", corev1.PodRunning), metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+	client.KubeClient = kubeClient
+	events := record.NewFakeRecorder(10)
+	plugin := &NvidiaDevicePlugin{nodeEvents: events}
+	devices := []*util.DeviceInfo{{ID: "GPU-0", Devcore: 80}}
+
+	plugin.checkCoreReservation(node, devices)
+	got, err := kubeClient.CoreV1().Nodes().Get(context.Background(), "node1", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.True(t, got.Spec.Unschedulable)
+	require.Len(t, events.Events, 1)
+	require.Contains(t, <-events.Events, "GPU-0 holds 90 of 80 cores")
+
+	// The node is only cordoned once, even if an admin uncordons it meanwhile.
+	got.Spec.Unschedulable = false
+	_, err = kubeClient.CoreV1().Nodes().Update(context.Background(), got, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	plugin.checkCoreReservation(got, devices)
+	got, err = kubeClient.CoreV1().Nodes().Get(context.Background(), "node1", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.False(t, got.Spec.Unschedulable)
+	require.Empty(t, events.Events)
+}
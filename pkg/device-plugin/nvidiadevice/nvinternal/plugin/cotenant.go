@@ -0,0 +1,217 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+	"github.com/Project-HAMi/HAMi/pkg/util/client"
+)
+
+const (
+	// CoTenantPolicyRestart evicts the surviving co-tenants of a card, so their controllers recreate them.
+	CoTenantPolicyRestart = "restart"
+	// CoTenantPolicyReschedule additionally quarantines the card, so the replacements are placed on other cards.
+	CoTenantPolicyReschedule = "reschedule"
+
+	// EventReasonCoTenantXid is recorded on a pod evicted by the co-tenant guard.
+	EventReasonCoTenantXid = "CoTenantXid"
+)
+
+// coTenantGuard reacts to an application Xid on a shared card which follows the exit of one of
+// its co-tenants. Such a Xid is what a crashed or killed CUDA process leaves behind, and the
+// contexts of the other processes on the card may be corrupted by it without failing themselves.
+// The guard then restarts or reschedules the surviving co-tenants, trading their availability
+// for the correctness of their results. A nil *coTenantGuard does nothing.
+type coTenantGuard struct {
+	policy string
+	window time.Duration
+	now    func() time.Time
+
+	mutex sync.Mutex
+	// handled remembers when the guard last acted on a card. Evicting the survivors raises
+	// Xids of its own, which must not take down their replacements.
+	handled map[string]time.Time
+	events  record.EventRecorder
+}
+
+// newCoTenantGuard returns a guard applying policy to Xids within window after a co-tenant
+// exited, or nil if policy is empty.
+func newCoTenantGuard(policy string, window time.Duration) (*coTenantGuard, error) {
+	switch policy {
+	case "":
+		return nil, nil
+	case CoTenantPolicyRestart, CoTenantPolicyReschedule:
+	default:
+		return nil, fmt.Errorf("unknown co-tenant Xid policy %q, expected %q or %q", policy, CoTenantPolicyRestart, CoTenantPolicyReschedule)
+	}
+	return &coTenantGuard{
+		policy:  policy,
+		window:  window,
+		now:     time.Now,
+		handled: make(map[string]time.Time),
+	}, nil
+}
+
+// podUsesCard reports whether the devices allocated to pod include card.
+func podUsesCard(pod *corev1.Pod, card string) bool {
+	pd, err := util.DecodePodDevices(util.SupportDevices, pod.Annotations)
+	if err != nil {
+		return false
+	}
+	for _, ctrdevs := range pd[nvidia.NvidiaGPUDevice] {
+		for _, d := range ctrdevs {
+			if cardID(d.UUID) == card {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// exitedSince reports whether pod is terminating, or one of its containers terminated after since.
+func exitedSince(pod *corev1.Pod, since time.Time) bool {
+	if pod.DeletionTimestamp != nil {
+		return true
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		for _, state := range []corev1.ContainerState{cs.State, cs.LastTerminationState} {
+			if state.Terminated != nil && state.Terminated.FinishedAt.Time.After(since) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// splitCoTenants returns the pods of card which exited within the window and, if there is one,
+// the running pods which survived them.
+func (g *coTenantGuard) splitCoTenants(pods []corev1.Pod, card string) (exited, survivors []*corev1.Pod) {
+	since := g.now().Add(-g.window)
+	var running []*corev1.Pod
+	for i := range pods {
+		p := &pods[i]
+		if !podUsesCard(p, card) {
+			continue
+		}
+		switch {
+		case exitedSince(p, since):
+			exited = append(exited, p)
+		case p.Status.Phase == corev1.PodRunning:
+			running = append(running, p)
+		}
+	}
+	if len(exited) == 0 {
+		return nil, nil
+	}
+	return exited, running
+}
+
+// claim reports whether the guard may act on card, i.e. it didn't within the last window.
+func (g *coTenantGuard) claim(card string) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	now := g.now()
+	if last, ok := g.handled[card]; ok && now.Sub(last) < g.window {
+		return false
+	}
+	g.handled[card] = now
+	return true
+}
+
+func (g *coTenantGuard) recorder() record.EventRecorder {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.events == nil {
+		g.events = newNodeEventRecorder()
+	}
+	return g.events
+}
+
+// handleXid applies the policy to the co-tenants on card after an application Xid on it.
+func (g *coTenantGuard) handleXid(card string, xid uint64, q *cardQuarantine) {
+	if g == nil {
+		return
+	}
+	ctx := context.Background()
+	pods, err := client.GetClient().CoreV1().Pods("").List(ctx, metav1.ListOptions{
+		FieldSelector: fmt.Sprintf("spec.nodeName=%s", util.NodeName),
+	})
+	if err != nil {
+		klog.Errorf("co-tenant guard: failed to list pods after Xid %d on device %s: %v", xid, card, err)
+		return
+	}
+	exited, survivors := g.splitCoTenants(pods.Items, card)
+	if len(exited) == 0 {
+		klog.Infof("co-tenant guard: Xid %d on device %s doesn't follow the exit of a co-tenant, ignoring it", xid, card)
+		return
+	}
+	if len(survivors) == 0 || !g.claim(card) {
+		return
+	}
+	names := make([]string, 0, len(exited))
+	for _, p := range exited {
+		names = append(names, p.Namespace+"/"+p.Name)
+	}
+	cause := fmt.Sprintf("Xid %d on device %s after co-tenant %s exited", xid, card, strings.Join(names, ", "))
+	klog.Warningf("co-tenant guard: %s, applying policy %q to %d surviving co-tenant(s)", cause, g.policy, len(survivors))
+
+	if g.policy == CoTenantPolicyReschedule {
+		if q == nil {
+			klog.Warningf("co-tenant guard: can't quarantine device %s, the quarantine is disabled by allocate-failure-threshold=0", card)
+		}
+		q.hold(card, QuarantineBackoff, cause)
+	}
+	for _, p := range survivors {
+		// Evictions go through the PodDisruptionBudgets, which may refuse them.
+		eviction := &policyv1.Eviction{ObjectMeta: metav1.ObjectMeta{Name: p.Name, Namespace: p.Namespace}}
+		if err := client.GetClient().PolicyV1().Evictions(p.Namespace).Evict(ctx, eviction); err != nil {
+			klog.Errorf("co-tenant guard: failed to evict pod %s/%s: %v", p.Namespace, p.Name, err)
+			continue
+		}
+		klog.Warningf("co-tenant guard: evicted pod %s/%s sharing device %s", p.Namespace, p.Name, card)
+		g.recorder().Eventf(p, corev1.EventTypeWarning, EventReasonCoTenantXid, "Evicted by co-tenant Xid policy %q: %s", g.policy, cause)
+	}
+}
@@ -0,0 +1,140 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+	"github.com/Project-HAMi/HAMi/pkg/util/client"
+)
+
+func coTenantPod(name, card string, phase corev1.PodPhase) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Annotations: map[string]string{
+				util.SupportDevices[nvidia.NvidiaGPUDevice]: card + ",NVIDIA,1000,30:;",
+			},
+		},
+		Spec:   corev1.PodSpec{NodeName: "node1"},
+		Status: corev1.PodStatus{Phase: phase},
+	}
+}
+
+func TestNewCoTenantGuard(t *testing.T) {
+	g, err := newCoTenantGuard("", time.Minute)
+	require.NoError(t, err)
+	require.Nil(t, g)
+	g.handleXid("GPU-0", 43, nil)
+
+	_, err = newCoTenantGuard("evict", time.Minute)
+	require.ErrorContains(t, err, "unknown co-tenant Xid policy")
+}
+
+func TestCoTenantGuardHandleXid(t *testing.T) {
+	util.SupportDevices[nvidia.NvidiaGPUDevice] = "hami.io/vgpu-devices-allocated"
+	now := time.Now()
+
+	exited := coTenantPod("crashed", "GPU-0", corev1.PodRunning)
+	exited.Status.ContainerStatuses = []corev1.ContainerStatus{{
+		LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+			ExitCode:   139,
+			FinishedAt: metav1.NewTime(now.Add(-5 * time.Second)),
+		}},
+	}}
+	oldCrash := coTenantPod("survivor", "GPU-0", corev1.PodRunning)
+	oldCrash.Status.ContainerStatuses = []corev1.ContainerStatus{{
+		LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+			FinishedAt: metav1.NewTime(now.Add(-time.Hour)),
+		}},
+	}}
+	objects := []*corev1.Pod{
+		exited,
+		oldCrash,
+		coTenantPod("pending", "GPU-0", corev1.PodPending),
+		coTenantPod("other-card", "GPU-1", corev1.PodRunning),
+	}
+	kubeClient := fake.NewSimpleClientset()
+	for _, p := range objects {
+		_, err := kubeClient.CoreV1().Pods(p.Namespace).Create(context.Background(), p, metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+	var evicted []string
+	kubeClient.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "eviction" {
+			return false, nil, nil
+		}
+		evicted = append(evicted, action.(k8stesting.CreateAction).GetObject().(*policyv1.Eviction).Name)
+		return true, nil, nil
+	})
+	client.KubeClient = kubeClient
+
+	g, err := newCoTenantGuard(CoTenantPolicyReschedule, 30*time.Second)
+	require.NoError(t, err)
+	recorder := record.NewFakeRecorder(10)
+	g.events = recorder
+	q := newCardQuarantine(3, time.Minute)
+
+	// An Xid without a co-tenant exiting on the card is left alone.
+	g.handleXid("GPU-1", 43, q)
+	require.False(t, q.quarantined("GPU-1"))
+
+	g.handleXid("GPU-0", 43, q)
+	require.True(t, q.quarantined("GPU-0"))
+	require.Equal(t, []string{"survivor"}, evicted)
+	require.Len(t, recorder.Events, 1)
+	event := <-recorder.Events
+	require.True(t, strings.HasPrefix(event, "Warning "+EventReasonCoTenantXid))
+	require.Contains(t, event, "Xid 43 on device GPU-0 after co-tenant default/crashed exited")
+
+	// The guard acts once per card and window.
+	_, err = kubeClient.CoreV1().Pods("default").Create(context.Background(), coTenantPod("replacement", "GPU-0", corev1.PodRunning), metav1.CreateOptions{})
+	require.NoError(t, err)
+	g.handleXid("GPU-0", 45, q)
+	require.Equal(t, []string{"survivor"}, evicted)
+}
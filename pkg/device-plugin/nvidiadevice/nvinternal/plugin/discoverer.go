@@ -0,0 +1,218 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/device-plugin/nvidiadevice/nvinternal/rm"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+const (
+	// DeviceDiscoveryNVML and DeviceDiscoveryFake are the values of DeviceDiscovery.
+	DeviceDiscoveryNVML = "nvml"
+	DeviceDiscoveryFake = "fake"
+)
+
+var (
+	// DeviceDiscovery is how the plugin finds the GPUs of the node: "nvml" asks the driver,
+	// "fake" serves the GPUs of FakeDevices instead, so the plugin runs on nodes without any,
+	// e.g. CI runners.
+	DeviceDiscovery = DeviceDiscoveryNVML
+	// FakeDevices are the GPUs served with DeviceDiscoveryFake, see rm.LoadFakeDevices.
+	FakeDevices string
+)
+
+// errNoNVML is returned by initNVML with DeviceDiscoveryFake.
+var errNoNVML = errors.New("the GPUs of fake device discovery can't be read from NVML")
+
+// DiscoveredDevice is what a DeviceDiscoverer reports of a GPU.
+type DiscoveredDevice struct {
+	Index int
+	Model string
+	// MemoryTotal is in bytes.
+	MemoryTotal uint64
+	// ndev is the NVML handle the other attributes of the GPU are read from, nil for a GPU
+	// NVML doesn't know.
+	ndev *nvml.Device
+}
+
+// DeviceDiscoverer finds the GPUs of the node.
+type DeviceDiscoverer interface {
+	// Init prepares the discoverer for the other calls. It may be called repeatedly, the
+	// discoverer stays ready until Shutdown was called as many times.
+	Init() error
+	Shutdown()
+	// Count returns the number of GPUs of the node.
+	Count() (int, error)
+	// Device returns the GPU uuid. With confidentialCompute, the memory the driver sets aside
+	// for the unprotected bounce buffers is left out of its total.
+	Device(uuid string, confidentialCompute bool) (DiscoveredDevice, error)
+	// DriverVersions returns the version of the driver and the highest CUDA version it
+	// supports, "" for the ones it can't tell.
+	DriverVersions() (driver string, cuda string)
+}
+
+// NewDeviceDiscoverer returns the DeviceDiscoverer of DeviceDiscovery.
+func NewDeviceDiscoverer() (DeviceDiscoverer, error) {
+	switch DeviceDiscovery {
+	case DeviceDiscoveryNVML:
+		return nvmlDiscoverer{}, nil
+	case DeviceDiscoveryFake:
+		devices, err := rm.LoadFakeDevices(FakeDevices)
+		if err != nil {
+			return nil, err
+		}
+		return newFakeDiscoverer(devices), nil
+	}
+	return nil, fmt.Errorf("invalid device discovery %q, must be %s or %s", DeviceDiscovery, DeviceDiscoveryNVML, DeviceDiscoveryFake)
+}
+
+// initNVML initializes NVML for reading the GPUs beyond what the DeviceDiscoverer reports,
+// e.g. to sample or probe them. The GPUs of DeviceDiscoveryFake aren't known to NVML, so
+// with them it fails without trying, and the callers leave the GPUs alone.
+func initNVML() error {
+	if DeviceDiscovery == DeviceDiscoveryFake {
+		return errNoNVML
+	}
+	if ret := nvml.Init(); ret != nvml.SUCCESS {
+		return fmt.Errorf("nvml Init err: %s", nvml.ErrorString(ret))
+	}
+	return nil
+}
+
+// nvmlDiscoverer finds the GPUs through NVML.
+type nvmlDiscoverer struct{}
+
+func (nvmlDiscoverer) Init() error {
+	if ret := nvml.Init(); ret != nvml.SUCCESS {
+		return fmt.Errorf("nvml Init err: %s", nvml.ErrorString(ret))
+	}
+	return nil
+}
+
+func (nvmlDiscoverer) Shutdown() {
+	nvml.Shutdown()
+}
+
+func (nvmlDiscoverer) Count() (int, error) {
+	count, ret := nvml.DeviceGetCount()
+	if ret != nvml.SUCCESS {
+		return 0, fmt.Errorf("nvml get count error ret: %s", nvml.ErrorString(ret))
+	}
+	return count, nil
+}
+
+func (nvmlDiscoverer) Device(uuid string, confidentialCompute bool) (DiscoveredDevice, error) {
+	ndev, ret := nvml.DeviceGetHandleByUUID(uuid)
+	if ret != nvml.SUCCESS {
+		return DiscoveredDevice{}, fmt.Errorf("nvml new device by uuid error uuid=%s err=%s", uuid, nvml.ErrorString(ret))
+	}
+	idx, ret := ndev.GetIndex()
+	if ret != nvml.SUCCESS {
+		return DiscoveredDevice{}, fmt.Errorf("nvml get index error ret=%s", nvml.ErrorString(ret))
+	}
+	memory, ret := ndev.GetMemoryInfo()
+	if ret != nvml.SUCCESS {
+		return DiscoveredDevice{}, fmt.Errorf("nvml get memory error ret=%s", nvml.ErrorString(ret))
+	}
+	memoryTotal := memory.Total
+	if confidentialCompute {
+		// The memory the driver sets aside for the unprotected bounce buffers can't
+		// be used by the workload, so only the rest is advertised.
+		if memoryV2, ret := ndev.GetMemoryInfo_v2(); ret == nvml.SUCCESS && memoryV2.Total > memoryV2.Reserved {
+			memoryTotal = memoryV2.Total - memoryV2.Reserved
+		} else {
+			klog.Warningf("nvml get memory v2 error ret=%v, advertising the full memory of confidential computing device %v", ret, uuid)
+		}
+	}
+	model, ret := ndev.GetName()
+	if ret != nvml.SUCCESS {
+		return DiscoveredDevice{}, fmt.Errorf("nvml get name error ret=%s", nvml.ErrorString(ret))
+	}
+	return DiscoveredDevice{Index: idx, Model: model, MemoryTotal: memoryTotal, ndev: &ndev}, nil
+}
+
+func (nvmlDiscoverer) DriverVersions() (driver string, cuda string) {
+	driver, ret := nvml.SystemGetDriverVersion()
+	if ret != nvml.SUCCESS {
+		klog.V(4).InfoS("failed to get the NVIDIA driver version", "ret", ret)
+		driver = ""
+	}
+	if v, ret := nvml.SystemGetCudaDriverVersion(); ret == nvml.SUCCESS {
+		cuda = formatCUDAVersion(v)
+	} else {
+		klog.V(4).InfoS("failed to get the CUDA version of the NVIDIA driver", "ret", ret)
+	}
+	return driver, cuda
+}
+
+// fakeDiscoverer serves the GPUs of FakeDevices, see DeviceDiscoveryFake.
+type fakeDiscoverer struct {
+	devices map[string]DiscoveredDevice
+}
+
+func newFakeDiscoverer(devices []rm.FakeDevice) *fakeDiscoverer {
+	d := &fakeDiscoverer{devices: make(map[string]DiscoveredDevice, len(devices))}
+	for i, dev := range devices {
+		d.devices[dev.UUID] = DiscoveredDevice{Index: i, Model: dev.Model, MemoryTotal: dev.Memory * uint64(util.MiB)}
+	}
+	return d
+}
+
+func (d *fakeDiscoverer) Init() error {
+	return nil
+}
+
+func (d *fakeDiscoverer) Shutdown() {}
+
+func (d *fakeDiscoverer) Count() (int, error) {
+	return len(d.devices), nil
+}
+
+func (d *fakeDiscoverer) Device(uuid string, confidentialCompute bool) (DiscoveredDevice, error) {
+	dev, ok := d.devices[uuid]
+	if !ok {
+		return DiscoveredDevice{}, fmt.Errorf("fake device %s not found", uuid)
+	}
+	return dev, nil
+}
+
+func (d *fakeDiscoverer) DriverVersions() (driver string, cuda string) {
+	return "", ""
+}
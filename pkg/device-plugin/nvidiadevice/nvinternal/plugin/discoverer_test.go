@@ -0,0 +1,130 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	spec "github.com/NVIDIA/k8s-device-plugin/api/config/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Project-HAMi/HAMi/pkg/device-plugin/nvidiadevice/nvinternal/rm"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func TestNewDeviceDiscoverer(t *testing.T) {
+	prevDiscovery, prevDevices := DeviceDiscovery, FakeDevices
+	defer func() { DeviceDiscovery, FakeDevices = prevDiscovery, prevDevices }()
+
+	d, err := NewDeviceDiscoverer()
+	require.NoError(t, err)
+	require.Equal(t, nvmlDiscoverer{}, d)
+
+	DeviceDiscovery = DeviceDiscoveryFake
+	_, err = NewDeviceDiscoverer()
+	require.Error(t, err, "fake discovery without devices")
+	FakeDevices = `[{"uuid":"GPU-0","model":"Tesla T4","memory":15360}]`
+	d, err = NewDeviceDiscoverer()
+	require.NoError(t, err)
+	require.NoError(t, DiscoveryCheck())
+	count, err := d.Count()
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	DeviceDiscovery = "sysfs"
+	_, err = NewDeviceDiscoverer()
+	require.Error(t, err)
+}
+
+func TestFakeDiscovererAPIDevices(t *testing.T) {
+	devices := []rm.FakeDevice{
+		{UUID: "GPU-0", Model: "Tesla T4", Memory: 15360},
+		{UUID: "GPU-1", Model: "Tesla T4", Memory: 15360},
+	}
+	config := &nvidia.DeviceConfig{Config: &spec.Config{
+		Resources: spec.Resources{GPUs: []spec.Resource{{Pattern: "*", Name: "nvidia.com/gpu"}}},
+	}}
+	rms, err := rm.NewFakeResourceManagers(config, devices)
+	require.NoError(t, err)
+	require.Len(t, rms, 1)
+	plugin := &NvidiaDevicePlugin{
+		rm:         rms[0],
+		discoverer: newFakeDiscoverer(devices),
+		schedulerConfig: nvidia.NvidiaConfig{
+			DeviceSplitCount:    10,
+			DeviceMemoryScaling: 2,
+			DeviceCoreScaling:   1,
+		},
+	}
+
+	got := *plugin.getAPIDevices()
+	require.Len(t, got, 2)
+	byID := make(map[string]*util.DeviceInfo)
+	for _, d := range got {
+		byID[d.ID] = d
+	}
+	require.Equal(t, uint(1), byID["GPU-1"].Index)
+	require.Equal(t, "NVIDIA-Tesla T4", byID["GPU-1"].Type)
+	// The memory is scaled like the one of a real GPU.
+	require.Equal(t, int32(30720), byID["GPU-1"].Devmem)
+	require.Equal(t, int32(10), byID["GPU-1"].Count)
+	require.True(t, byID["GPU-1"].Health)
+	// What only NVML tells is left out.
+	require.Nil(t, byID["GPU-1"].ECCErrors)
+	require.Nil(t, byID["GPU-1"].PerformanceState)
+
+	_, err = plugin.discoverer.Device("GPU-9", false)
+	require.Error(t, err)
+}
+
+func TestFakeDiscoveryLeavesNVMLAlone(t *testing.T) {
+	prevDiscovery := DeviceDiscovery
+	defer func() { DeviceDiscovery = prevDiscovery }()
+	DeviceDiscovery = DeviceDiscoveryFake
+
+	// None of them may reach NVML, which has no library to load on a node without GPUs.
+	plugin := &NvidiaDevicePlugin{}
+	require.Nil(t, plugin.sampleUtilization())
+	require.Nil(t, plugin.sampleMemoryUsed())
+	require.Empty(t, plugin.nvlinkFabricHealth())
+	require.Nil(t, plugin.ncclTopologyEnvs(util.ContainerDevices{{UUID: "GPU-0"}, {UUID: "GPU-1"}}))
+	require.Nil(t, newEnergyMeter().sample([]string{"GPU-0"}, time.Now()))
+	_, err := migCards()
+	require.ErrorIs(t, err, errNoNVML)
+	_, _, err = GetIndexAndTypeFromUUID("GPU-0[0-1]")
+	require.ErrorIs(t, err, errNoNVML)
+	_, err = GetMigUUIDFromIndex("GPU-0[0-1]", 0)
+	require.ErrorIs(t, err, errNoNVML)
+}
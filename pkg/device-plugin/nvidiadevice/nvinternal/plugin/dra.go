@@ -0,0 +1,330 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	registerapi "k8s.io/kubelet/pkg/apis/pluginregistration/v1"
+	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
+	cdispec "tags.cncf.io/container-device-interface/specs-go"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+	"github.com/Project-HAMi/HAMi/pkg/util/client"
+)
+
+const (
+	// draCDIKind is the CDI kind of the devices the DRA node plugin hands to the kubelet,
+	// every request of a prepared claim is one device named after the claim UID and the request.
+	draCDIKind = "hami.io/claim"
+)
+
+var (
+	// EnableDRA serves the DRA driver next to the device plugin: the slots of the cards are
+	// published in ResourceSlices, and the ResourceClaims kube-scheduler allocates them to
+	// are prepared on this node.
+	EnableDRA bool
+	// DRAPluginDir holds the socket of the DRA node plugin.
+	DRAPluginDir = filepath.Join("/var/lib/kubelet/plugins", util.DRADriverName)
+	// DRARegistrationDir is watched by the kubelet for plugin registration sockets.
+	DRARegistrationDir = "/var/lib/kubelet/plugins_registry"
+	// DRACDIRoot is where the CDI specs of prepared claims are written.
+	DRACDIRoot = "/var/run/cdi"
+)
+
+// draNodePlugin implements the node side of the HAMi DRA driver, for structured parameters
+// (resource.k8s.io/v1beta1). It publishes every card as Count slots in the ResourceSlices of
+// the node, kube-scheduler allocates them to claims. NodePrepareResources turns the slots of
+// a claim into CDI devices carrying the same environment and mounts Allocate hands to
+// containers on the device-plugin path, with the memory and cores of the opaque
+// configuration of the claim.
+type draNodePlugin struct {
+	plugin   *NvidiaDevicePlugin
+	cdiCache *cdiapi.Cache
+
+	mutex        sync.Mutex
+	server       *grpc.Server
+	registration *grpc.Server
+	stop         chan struct{}
+
+	// cards are the cards of the node as last published.
+	cardsMutex sync.Mutex
+	cards      []*util.DeviceInfo
+}
+
+func newDRANodePlugin(plugin *NvidiaDevicePlugin) (*draNodePlugin, error) {
+	if err := os.MkdirAll(DRACDIRoot, 0755); err != nil {
+		return nil, err
+	}
+	cache, err := cdiapi.NewCache(cdiapi.WithSpecDirs(DRACDIRoot), cdiapi.WithAutoRefresh(false))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CDI cache: %v", err)
+	}
+	return &draNodePlugin{plugin: plugin, cdiCache: cache}, nil
+}
+
+func (d *draNodePlugin) socket() string {
+	return filepath.Join(DRAPluginDir, "plugin.sock")
+}
+
+func (d *draNodePlugin) registrationSocket() string {
+	return filepath.Join(DRARegistrationDir, util.DRADriverName+"-reg.sock")
+}
+
+// Start publishes the slots of the cards, serves the node plugin and registers it with the
+// kubelet through the plugin watcher.
+func (d *draNodePlugin) Start() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if err := os.MkdirAll(DRAPluginDir, 0750); err != nil {
+		return err
+	}
+	d.server = grpc.NewServer(grpc.ForceServerCodec(draCodec{}))
+	d.server.RegisterService(&draPluginServiceDesc, d)
+	if err := serveUnix(d.server, d.socket()); err != nil {
+		return err
+	}
+	d.registration = grpc.NewServer()
+	registerapi.RegisterRegistrationServer(d.registration, d)
+	if err := serveUnix(d.registration, d.registrationSocket()); err != nil {
+		d.server.Stop()
+		return err
+	}
+	d.stop = make(chan struct{})
+	go d.watchSlices(d.stop)
+	klog.Infof("Serving DRA driver %s on %s", util.DRADriverName, d.socket())
+	return nil
+}
+
+// Stop stops both servers and the publishing of the slots. The ResourceSlices are left for
+// the kubelet to remove, and the CDI specs of prepared claims for the kubelet to unprepare
+// them after a restart.
+func (d *draNodePlugin) Stop() {
+	if d == nil {
+		return
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.stop != nil {
+		close(d.stop)
+		d.stop = nil
+	}
+	for _, s := range []*grpc.Server{d.registration, d.server} {
+		if s != nil {
+			s.Stop()
+		}
+	}
+	d.server, d.registration = nil, nil
+	os.Remove(d.registrationSocket())
+	os.Remove(d.socket())
+}
+func serveUnix(server *grpc.Server, socket string) error {
+	os.Remove(socket)
+	sock, err := net.Listen("unix", socket)
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := server.Serve(sock); err != nil {
+			klog.Errorf("GRPC server on %s stopped: %v", socket, err)
+		}
+	}()
+	return nil
+}
+
+// GetInfo is the RPC invoked by the kubelet plugin watcher.
+func (d *draNodePlugin) GetInfo(ctx context.Context, req *registerapi.InfoRequest) (*registerapi.PluginInfo, error) {
+	return &registerapi.PluginInfo{
+		Type:              registerapi.DRAPlugin,
+		Name:              util.DRADriverName,
+		Endpoint:          d.socket(),
+		SupportedVersions: []string{draPluginService},
+	}, nil
+}
+
+// NotifyRegistrationStatus is called by the kubelet with the result of the registration.
+func (d *draNodePlugin) NotifyRegistrationStatus(ctx context.Context, status *registerapi.RegistrationStatus) (*registerapi.RegistrationStatusResponse, error) {
+	if !status.PluginRegistered {
+		klog.Errorf("Registration of DRA driver %s failed: %s", util.DRADriverName, status.Error)
+	} else {
+		klog.Infof("Registered DRA driver %s with kubelet", util.DRADriverName)
+	}
+	return &registerapi.RegistrationStatusResponse{}, nil
+}
+
+// NodePrepareResources prepares the claims the kubelet is about to start containers for.
+func (d *draNodePlugin) NodePrepareResources(ctx context.Context, req *draClaimsRequest) (*draPrepareResponse, error) {
+	resp := &draPrepareResponse{Claims: make(map[string]*draPrepareResult)}
+	for _, claim := range req.Claims {
+		devices, err := d.prepare(ctx, claim)
+		if err != nil {
+			klog.Errorf("Failed to prepare claim %s/%s: %v", claim.Namespace, claim.Name, err)
+			resp.Claims[claim.UID] = &draPrepareResult{Error: err.Error()}
+			continue
+		}
+		klog.Infof("Prepared claim %s/%s with devices %v", claim.Namespace, claim.Name, devices)
+		resp.Claims[claim.UID] = &draPrepareResult{Devices: devices}
+	}
+	return resp, nil
+}
+
+// NodeUnprepareResources releases the claims whose pods are gone.
+func (d *draNodePlugin) NodeUnprepareResources(ctx context.Context, req *draClaimsRequest) (*draUnprepareResponse, error) {
+	resp := &draUnprepareResponse{Claims: make(map[string]string)}
+	for _, claim := range req.Claims {
+		resp.Claims[claim.UID] = ""
+		if err := d.unprepare(claim); err != nil {
+			klog.Errorf("Failed to unprepare claim %s/%s: %v", claim.Namespace, claim.Name, err)
+			resp.Claims[claim.UID] = err.Error()
+		}
+	}
+	return resp, nil
+}
+
+func draCDISpecName(uid string) string {
+	return "hami-claim-" + uid + ".json"
+}
+
+// draCacheDir is the directory holding the HAMi-core caches of the requests of a claim.
+func draCacheDir(uid string) string {
+	return fmt.Sprintf("%s/vgpu/claims/%s", hostHookPath, uid)
+}
+
+// prepare writes the CDI spec of claim, with a device for each of its requests, and returns
+// the slots of the claim. The CDI device of a request is returned with its first slot only,
+// so a container using the request gets it once.
+func (d *draNodePlugin) prepare(ctx context.Context, claim *draClaim) ([]*draDevice, error) {
+	obj, err := client.GetDynamicClient().Resource(util.ResourceClaimResource).Namespace(claim.Namespace).Get(ctx, claim.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if string(obj.GetUID()) != claim.UID {
+		return nil, fmt.Errorf("claim has UID %s, not %s", obj.GetUID(), claim.UID)
+	}
+	c, err := util.ClaimFromUnstructured(obj.Object)
+	if err != nil {
+		return nil, err
+	}
+	allocated, err := c.AllocatedDevices()
+	if err != nil {
+		return nil, err
+	}
+	if len(allocated) == 0 {
+		return nil, fmt.Errorf("claim holds no devices of driver %s", util.DRADriverName)
+	}
+
+	var requests []string
+	devreqs := make(map[string]util.ContainerDevices)
+	for _, a := range allocated {
+		if a.Pool != util.NodeName {
+			return nil, fmt.Errorf("device %s belongs to pool %s, not this node", a.Device, a.Pool)
+		}
+		card, ok := d.card(a.Index)
+		if !ok {
+			return nil, fmt.Errorf("device %s does not belong to this node", a.Device)
+		}
+		if d.plugin.quarantine.quarantined(card.ID) {
+			return nil, fmt.Errorf("device %s is quarantined", card.ID)
+		}
+		if _, ok := devreqs[a.Request]; !ok {
+			requests = append(requests, a.Request)
+		}
+		devreqs[a.Request] = append(devreqs[a.Request], a.Config.ContainerDevice(nvidia.NvidiaGPUDevice, *card))
+	}
+
+	cdiDevices := make([]cdispec.Device, 0, len(requests))
+	for _, request := range requests {
+		devreq := devreqs[request]
+		uuids := make([]string, 0, len(devreq))
+		for _, dev := range devreq {
+			uuids = append(uuids, dev.UUID)
+		}
+		edits := cdispec.ContainerEdits{
+			Env: []string{fmt.Sprintf("%s=%s", d.plugin.deviceListEnvvar, strings.Join(uuids, ","))},
+		}
+		if d.plugin.operatingMode != "mig" {
+			for k, v := range d.plugin.hamiCoreEnvs(devreq) {
+				edits.Env = append(edits.Env, fmt.Sprintf("%s=%s", k, v))
+			}
+			cacheDir := filepath.Join(draCacheDir(claim.UID), request)
+			os.MkdirAll(cacheDir, 0777)
+			os.Chmod(cacheDir, 0777)
+			os.MkdirAll("/tmp/vgpulock", 0777)
+			os.Chmod("/tmp/vgpulock", 0777)
+			edits.Mounts = []*cdispec.Mount{
+				{HostPath: GetLibPath(), ContainerPath: fmt.Sprintf("%s/vgpu/libvgpu.so", hostHookPath), Options: []string{"ro", "nosuid", "nodev", "bind"}},
+				{HostPath: cacheDir, ContainerPath: fmt.Sprintf("%s/vgpu", hostHookPath), Options: []string{"rw", "nosuid", "nodev", "bind"}},
+				{HostPath: "/tmp/vgpulock", ContainerPath: "/tmp/vgpulock", Options: []string{"rw", "nosuid", "nodev", "bind"}},
+				{HostPath: hostHookPath + "/vgpu/ld.so.preload", ContainerPath: "/etc/ld.so.preload", Options: []string{"ro", "nosuid", "nodev", "bind"}},
+			}
+		}
+		cdiDevices = append(cdiDevices, cdispec.Device{Name: claim.UID + "-" + request, ContainerEdits: edits})
+	}
+	spec := &cdispec.Spec{
+		Version: cdispec.CurrentVersion,
+		Kind:    draCDIKind,
+		Devices: cdiDevices,
+	}
+	if err := d.cdiCache.WriteSpec(spec, draCDISpecName(claim.UID)); err != nil {
+		return nil, fmt.Errorf("failed to write CDI spec: %v", err)
+	}
+
+	devices := make([]*draDevice, 0, len(allocated))
+	seen := make(map[string]bool)
+	for _, a := range allocated {
+		dev := &draDevice{RequestNames: []string{a.Request}, PoolName: a.Pool, DeviceName: a.Device}
+		if !seen[a.Request] {
+			seen[a.Request] = true
+			dev.CDIDeviceIDs = []string{fmt.Sprintf("%s=%s-%s", draCDIKind, claim.UID, a.Request)}
+		}
+		devices = append(devices, dev)
+	}
+	return devices, nil
+}
+
+func (d *draNodePlugin) unprepare(claim *draClaim) error {
+	if err := d.cdiCache.RemoveSpec(draCDISpecName(claim.UID)); err != nil {
+		return err
+	}
+	return os.RemoveAll(draCacheDir(claim.UID))
+}
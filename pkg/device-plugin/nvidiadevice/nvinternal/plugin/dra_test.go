@@ -0,0 +1,241 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	spec "github.com/NVIDIA/k8s-device-plugin/api/config/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	kubeletdevicepluginv1beta1 "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+	drapbv1alpha3 "k8s.io/kubelet/pkg/apis/dra/v1alpha3"
+	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
+
+	"github.com/Project-HAMi/HAMi/pkg/device-plugin/nvidiadevice/nvinternal/rm"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+	"github.com/Project-HAMi/HAMi/pkg/util/client"
+)
+
+type fakeResourceManager struct {
+	rm.ResourceManager
+	devices rm.Devices
+}
+
+func (f *fakeResourceManager) Devices() rm.Devices {
+	return f.devices
+}
+
+func (f *fakeResourceManager) Resource() spec.ResourceName {
+	return "nvidia.com/gpu"
+}
+
+func draTestClients(t *testing.T, objs ...runtime.Object) {
+	util.NodeName = "node1"
+	client.KubeClient = fake.NewSimpleClientset(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1", UID: "node1-uid"}})
+	client.DynamicClient = dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			util.ResourceSliceResource: "ResourceSliceList",
+			util.ResourceClaimResource: "ResourceClaimList",
+		}, objs...)
+	t.Cleanup(func() {
+		util.NodeName = ""
+		client.KubeClient, client.DynamicClient = nil, nil
+	})
+}
+
+func TestDRAPublishSlices(t *testing.T) {
+	draTestClients(t)
+	d := &draNodePlugin{}
+	cards := []*util.DeviceInfo{
+		{ID: "GPU-0", Index: 0, Count: 100, Devmem: 8192, Devcore: 100, Type: "NVIDIA-A100", Health: true},
+		{ID: "GPU-1", Index: 1, Count: 100, Devmem: 8192, Devcore: 100, Type: "NVIDIA-A100", Health: true},
+		{ID: "GPU-2", Index: 2, Count: 100, Devmem: 8192, Devcore: 100, Type: "NVIDIA-A100", Health: false},
+	}
+	list := func() []unstructured.Unstructured {
+		l, err := client.GetDynamicClient().Resource(util.ResourceSliceResource).List(context.Background(), metav1.ListOptions{})
+		require.NoError(t, err)
+		return l.Items
+	}
+
+	// 200 slots of the healthy cards take two slices.
+	require.NoError(t, d.publishSlices(cards))
+	slices := list()
+	require.Len(t, slices, 2)
+	total := 0
+	for _, slice := range slices {
+		require.Equal(t, "node1", slice.GetOwnerReferences()[0].Name)
+		generation, _, _ := unstructured.NestedInt64(slice.Object, "spec", "pool", "generation")
+		require.Equal(t, int64(1), generation)
+		count, _, _ := unstructured.NestedInt64(slice.Object, "spec", "pool", "resourceSliceCount")
+		require.Equal(t, int64(2), count)
+		devices, _, _ := unstructured.NestedSlice(slice.Object, "spec", "devices")
+		total += len(devices)
+	}
+	require.Equal(t, 200, total)
+	first, _, _ := unstructured.NestedSlice(slices[0].Object, "spec", "devices")
+	memory, _, _ := unstructured.NestedString(first[0].(map[string]any), "basic", "capacity", "memory", "value")
+	require.Equal(t, "8Gi", memory)
+
+	// Nothing changed, nothing is written.
+	require.NoError(t, d.publishSlices(cards))
+	generation, _, _ := unstructured.NestedInt64(list()[0].Object, "spec", "pool", "generation")
+	require.Equal(t, int64(1), generation)
+
+	// A card going unhealthy leaves one slice of a newer generation.
+	cards[1].Health = false
+	require.NoError(t, d.publishSlices(cards))
+	slices = list()
+	require.Len(t, slices, 1)
+	require.Equal(t, draSliceName("node1", 0), slices[0].GetName())
+	generation, _, _ = unstructured.NestedInt64(slices[0].Object, "spec", "pool", "generation")
+	require.Equal(t, int64(2), generation)
+}
+
+func draTestClaim(uid string, devices ...string) *unstructured.Unstructured {
+	results := []any{}
+	for _, device := range devices {
+		results = append(results, map[string]any{"request": "gpu", "driver": util.DRADriverName, "pool": "node1", "device": device})
+	}
+	claim := &unstructured.Unstructured{Object: map[string]any{
+		"status": map[string]any{
+			"allocation": map[string]any{
+				"devices": map[string]any{
+					"results": results,
+					"config": []any{
+						map[string]any{"source": "FromClaim", "opaque": map[string]any{"driver": util.DRADriverName, "parameters": map[string]any{"memory": int64(3000), "cores": int64(30)}}},
+					},
+				},
+			},
+		},
+	}}
+	claim.SetAPIVersion(util.ResourceClaimResource.GroupVersion().String())
+	claim.SetKind("ResourceClaim")
+	claim.SetNamespace("default")
+	claim.SetName("c-" + uid)
+	claim.SetUID(k8stypes.UID(uid))
+	return claim
+}
+
+func TestDRANodePluginPrepare(t *testing.T) {
+	draTestClients(t, draTestClaim("uid-1", "gpu-0-0"), draTestClaim("uid-2", "gpu-9-0"))
+	root := t.TempDir()
+	hostHookPath = root
+	DRACDIRoot = filepath.Join(root, "cdi")
+	DRAPluginDir = filepath.Join(root, "plugin")
+	defer func() {
+		hostHookPath, DRACDIRoot = "", "/var/run/cdi"
+		DRAPluginDir = filepath.Join("/var/lib/kubelet/plugins", util.DRADriverName)
+	}()
+
+	plugin := &NvidiaDevicePlugin{
+		rm: &fakeResourceManager{devices: rm.Devices{
+			"GPU-0": &rm.Device{Device: kubeletdevicepluginv1beta1.Device{ID: "GPU-0"}},
+		}},
+		deviceListEnvvar: "NVIDIA_VISIBLE_DEVICES",
+	}
+	d, err := newDRANodePlugin(plugin)
+	require.NoError(t, err)
+	d.cards = []*util.DeviceInfo{{ID: "GPU-0", Index: 0, Count: 10, Devmem: 8192, Devcore: 100, Health: true}}
+
+	// The kubelet talks to the plugin in the protobuf encoding of the v1beta1.DRAPlugin service.
+	require.NoError(t, os.MkdirAll(DRAPluginDir, 0750))
+	server := grpc.NewServer(grpc.ForceServerCodec(draCodec{}))
+	server.RegisterService(&draPluginServiceDesc, d)
+	require.NoError(t, serveUnix(server, d.socket()))
+	defer server.Stop()
+	conn, err := grpc.NewClient("unix://"+d.socket(), grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(draCodec{})))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	req := &draClaimsRequest{Claims: []*draClaim{
+		{Namespace: "default", Name: "c-uid-1", UID: "uid-1"},
+		{Namespace: "default", Name: "c-uid-2", UID: "uid-2"},
+	}}
+	resp := &draPrepareResponse{}
+	require.NoError(t, conn.Invoke(context.Background(), "/v1beta1.DRAPlugin/NodePrepareResources", req, resp))
+	require.Empty(t, resp.Claims["uid-1"].Error)
+	require.Equal(t, []*draDevice{{RequestNames: []string{"gpu"}, PoolName: "node1", DeviceName: "gpu-0-0", CDIDeviceIDs: []string{"hami.io/claim=uid-1-gpu"}}}, resp.Claims["uid-1"].Devices)
+	require.Contains(t, resp.Claims["uid-2"].Error, "does not belong to this node")
+
+	cache, err := cdiapi.NewCache(cdiapi.WithSpecDirs(DRACDIRoot), cdiapi.WithAutoRefresh(false))
+	require.NoError(t, err)
+	dev := cache.GetDevice("hami.io/claim=uid-1-gpu")
+	require.NotNil(t, dev)
+	require.Contains(t, dev.ContainerEdits.Env, "NVIDIA_VISIBLE_DEVICES=GPU-0")
+	require.Contains(t, dev.ContainerEdits.Env, "CUDA_DEVICE_MEMORY_LIMIT_0=3000m")
+	require.Contains(t, dev.ContainerEdits.Env, "CUDA_DEVICE_SM_LIMIT=30")
+	require.DirExists(t, filepath.Join(draCacheDir("uid-1"), "gpu"))
+
+	unprep := &draUnprepareResponse{}
+	require.NoError(t, conn.Invoke(context.Background(), "/v1beta1.DRAPlugin/NodeUnprepareResources",
+		&draClaimsRequest{Claims: []*draClaim{{Namespace: "default", Name: "c-uid-1", UID: "uid-1"}}}, unprep))
+	e, ok := unprep.Claims["uid-1"]
+	require.True(t, ok)
+	require.Empty(t, e)
+	_, err = os.Stat(filepath.Join(DRACDIRoot, draCDISpecName("uid-1")))
+	require.True(t, os.IsNotExist(err))
+	require.NoDirExists(t, draCacheDir("uid-1"))
+}
+
+func TestDRAClaimsRequestWire(t *testing.T) {
+	// The Claim of v1beta1 keeps the field numbers of the one of v1alpha3.
+	data, err := (&drapbv1alpha3.NodePrepareResourcesRequest{Claims: []*drapbv1alpha3.Claim{
+		{Namespace: "default", Uid: "uid-1", Name: "c1", ResourceHandle: "ignored"},
+	}}).Marshal()
+	require.NoError(t, err)
+	req := &draClaimsRequest{}
+	require.NoError(t, req.unmarshal(data))
+	require.Equal(t, []*draClaim{{Namespace: "default", UID: "uid-1", Name: "c1"}}, req.Claims)
+
+	resp := &draPrepareResponse{Claims: map[string]*draPrepareResult{
+		"uid-1": {Devices: []*draDevice{{RequestNames: []string{"gpu"}, PoolName: "node1", DeviceName: "gpu-0-0", CDIDeviceIDs: []string{"hami.io/claim=uid-1-gpu"}}}},
+		"uid-2": {Error: "failed"},
+	}}
+	got := &draPrepareResponse{}
+	require.NoError(t, got.unmarshal(resp.marshal()))
+	require.Equal(t, resp, got)
+}
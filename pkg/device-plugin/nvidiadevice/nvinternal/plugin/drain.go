@@ -0,0 +1,102 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"sync"
+	"time"
+)
+
+// inflightTracker counts the Allocate calls being served, so Stop can wait for
+// them instead of cutting them off halfway through updating the pod annotations.
+// A nil *inflightTracker accepts every call and never waits.
+type inflightTracker struct {
+	mutex    sync.Mutex
+	draining bool
+	calls    sync.WaitGroup
+}
+
+// acquire registers a new call. It returns false once draining started, in which
+// case the call must be rejected and release must not be called.
+func (t *inflightTracker) acquire() bool {
+	if t == nil {
+		return true
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.draining {
+		return false
+	}
+	t.calls.Add(1)
+	return true
+}
+
+func (t *inflightTracker) release() {
+	if t == nil {
+		return
+	}
+	t.calls.Done()
+}
+
+// accepting reports whether new calls are still served.
+func (t *inflightTracker) accepting() bool {
+	if t == nil {
+		return true
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return !t.draining
+}
+
+// drain stops accepting new calls and waits up to timeout for the in-flight ones
+// to finish. It returns false if the timeout expired first.
+func (t *inflightTracker) drain(timeout time.Duration) bool {
+	if t == nil {
+		return true
+	}
+	t.mutex.Lock()
+	t.draining = true
+	t.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		t.calls.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,66 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInflightTrackerDrain(t *testing.T) {
+	tracker := &inflightTracker{}
+	require.True(t, tracker.acquire())
+
+	drained := make(chan bool)
+	go func() {
+		drained <- tracker.drain(5 * time.Second)
+	}()
+	require.Eventually(t, func() bool { return !tracker.acquire() }, time.Second, time.Millisecond, "new calls are rejected while draining")
+
+	select {
+	case <-drained:
+		t.Fatal("drain returned before the in-flight call finished")
+	case <-time.After(10 * time.Millisecond):
+	}
+	tracker.release()
+	require.True(t, <-drained)
+}
+
+func TestInflightTrackerDrainTimeout(t *testing.T) {
+	tracker := &inflightTracker{}
+	require.True(t, tracker.acquire())
+	require.False(t, tracker.drain(10*time.Millisecond))
+	require.False(t, tracker.acquire())
+}
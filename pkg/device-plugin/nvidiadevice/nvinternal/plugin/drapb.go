@@ -0,0 +1,374 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+// The kubelet prepares the claims of structured parameters DRA through the v1beta1.DRAPlugin
+// gRPC service of k8s.io/kubelet/pkg/apis/dra/v1beta1, which the kubelet libraries HAMi
+// builds with don't have. Its few messages are encoded here with protowire, and the server
+// of the service is forced to use draCodec for them.
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const draPluginService = "v1beta1.DRAPlugin"
+
+// draClaim is a Claim: namespace = 1, UID = 2, name = 3.
+type draClaim struct {
+	Namespace string
+	UID       string
+	Name      string
+}
+
+// draClaimsRequest is a NodePrepareResourcesRequest or a NodeUnprepareResourcesRequest,
+// both only have the claims = 1.
+type draClaimsRequest struct {
+	Claims []*draClaim
+}
+
+// draDevice is a Device: request_names = 1, pool_name = 2, device_name = 3, cdi_device_ids = 4.
+type draDevice struct {
+	RequestNames []string
+	PoolName     string
+	DeviceName   string
+	CDIDeviceIDs []string
+}
+
+// draPrepareResult is a NodePrepareResourceResponse: devices = 1, error = 2.
+type draPrepareResult struct {
+	Devices []*draDevice
+	Error   string
+}
+
+// draPrepareResponse is a NodePrepareResourcesResponse, claims = 1 maps claim UIDs to results.
+type draPrepareResponse struct {
+	Claims map[string]*draPrepareResult
+}
+
+// draUnprepareResponse is a NodeUnprepareResourcesResponse, claims = 1 maps claim UIDs to a
+// NodeUnprepareResourceResponse, whose error = 1.
+type draUnprepareResponse struct {
+	Claims map[string]string
+}
+
+// draPluginServer is the v1beta1.DRAPlugin service.
+type draPluginServer interface {
+	NodePrepareResources(context.Context, *draClaimsRequest) (*draPrepareResponse, error)
+	NodeUnprepareResources(context.Context, *draClaimsRequest) (*draUnprepareResponse, error)
+}
+
+var draPluginServiceDesc = grpc.ServiceDesc{
+	ServiceName: draPluginService,
+	HandlerType: (*draPluginServer)(nil),
+	Methods: []grpc.MethodDesc{
+		draPluginMethod("NodePrepareResources", func(srv draPluginServer, ctx context.Context, req *draClaimsRequest) (any, error) {
+			return srv.NodePrepareResources(ctx, req)
+		}),
+		draPluginMethod("NodeUnprepareResources", func(srv draPluginServer, ctx context.Context, req *draClaimsRequest) (any, error) {
+			return srv.NodeUnprepareResources(ctx, req)
+		}),
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "k8s.io/kubelet/pkg/apis/dra/v1beta1/api.proto",
+}
+
+func draPluginMethod(name string, call func(draPluginServer, context.Context, *draClaimsRequest) (any, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+			req := &draClaimsRequest{}
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			if interceptor == nil {
+				return call(srv.(draPluginServer), ctx, req)
+			}
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + draPluginService + "/" + name}
+			return interceptor(ctx, req, info, func(ctx context.Context, req any) (any, error) {
+				return call(srv.(draPluginServer), ctx, req.(*draClaimsRequest))
+			})
+		},
+	}
+}
+
+// draMessage is a message draCodec encodes.
+type draMessage interface {
+	marshal() []byte
+	unmarshal(b []byte) error
+}
+
+// draCodec encodes the messages of the v1beta1.DRAPlugin service in the protobuf wire format.
+type draCodec struct{}
+
+func (draCodec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(draMessage)
+	if !ok {
+		return nil, fmt.Errorf("unexpected DRA message %T", v)
+	}
+	return m.marshal(), nil
+}
+
+func (draCodec) Unmarshal(data []byte, v any) error {
+	m, ok := v.(draMessage)
+	if !ok {
+		return fmt.Errorf("unexpected DRA message %T", v)
+	}
+	return m.unmarshal(data)
+}
+
+func (draCodec) Name() string {
+	return "proto"
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendMessage(b []byte, num protowire.Number, m []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, m)
+}
+
+// consumeFields calls field with every length-delimited field of b, the only kind the
+// messages of the service have. Fields of other kinds are skipped.
+func consumeFields(b []byte, field func(num protowire.Number, v []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+			continue
+		}
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if err := field(num, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *draClaim) marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, c.Namespace)
+	b = appendString(b, 2, c.UID)
+	return appendString(b, 3, c.Name)
+}
+
+func (c *draClaim) unmarshal(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, v []byte) error {
+		switch num {
+		case 1:
+			c.Namespace = string(v)
+		case 2:
+			c.UID = string(v)
+		case 3:
+			c.Name = string(v)
+		}
+		return nil
+	})
+}
+
+func (r *draClaimsRequest) marshal() []byte {
+	var b []byte
+	for _, c := range r.Claims {
+		b = appendMessage(b, 1, c.marshal())
+	}
+	return b
+}
+
+func (r *draClaimsRequest) unmarshal(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, v []byte) error {
+		if num != 1 {
+			return nil
+		}
+		c := &draClaim{}
+		if err := c.unmarshal(v); err != nil {
+			return err
+		}
+		r.Claims = append(r.Claims, c)
+		return nil
+	})
+}
+
+func (d *draDevice) marshal() []byte {
+	var b []byte
+	for _, name := range d.RequestNames {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendString(b, name)
+	}
+	b = appendString(b, 2, d.PoolName)
+	b = appendString(b, 3, d.DeviceName)
+	for _, id := range d.CDIDeviceIDs {
+		b = protowire.AppendTag(b, 4, protowire.BytesType)
+		b = protowire.AppendString(b, id)
+	}
+	return b
+}
+
+func (d *draDevice) unmarshal(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, v []byte) error {
+		switch num {
+		case 1:
+			d.RequestNames = append(d.RequestNames, string(v))
+		case 2:
+			d.PoolName = string(v)
+		case 3:
+			d.DeviceName = string(v)
+		case 4:
+			d.CDIDeviceIDs = append(d.CDIDeviceIDs, string(v))
+		}
+		return nil
+	})
+}
+
+func (r *draPrepareResult) marshal() []byte {
+	var b []byte
+	for _, d := range r.Devices {
+		b = appendMessage(b, 1, d.marshal())
+	}
+	return appendString(b, 2, r.Error)
+}
+
+func (r *draPrepareResult) unmarshal(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, v []byte) error {
+		switch num {
+		case 1:
+			d := &draDevice{}
+			if err := d.unmarshal(v); err != nil {
+				return err
+			}
+			r.Devices = append(r.Devices, d)
+		case 2:
+			r.Error = string(v)
+		}
+		return nil
+	})
+}
+
+// appendMapEntry appends the entry of a map<string, message> field, value is always
+// written so the entry of an empty message is told from a missing one.
+func appendMapEntry(b []byte, num protowire.Number, key string, value []byte) []byte {
+	var entry []byte
+	entry = appendString(entry, 1, key)
+	entry = appendMessage(entry, 2, value)
+	return appendMessage(b, num, entry)
+}
+
+func consumeMapEntry(b []byte) (key string, value []byte, err error) {
+	err = consumeFields(b, func(num protowire.Number, v []byte) error {
+		switch num {
+		case 1:
+			key = string(v)
+		case 2:
+			value = v
+		}
+		return nil
+	})
+	return key, value, err
+}
+
+func (r *draPrepareResponse) marshal() []byte {
+	var b []byte
+	for uid, res := range r.Claims {
+		b = appendMapEntry(b, 1, uid, res.marshal())
+	}
+	return b
+}
+
+func (r *draPrepareResponse) unmarshal(b []byte) error {
+	r.Claims = make(map[string]*draPrepareResult)
+	return consumeFields(b, func(num protowire.Number, v []byte) error {
+		if num != 1 {
+			return nil
+		}
+		uid, value, err := consumeMapEntry(v)
+		if err != nil {
+			return err
+		}
+		res := &draPrepareResult{}
+		if err := res.unmarshal(value); err != nil {
+			return err
+		}
+		r.Claims[uid] = res
+		return nil
+	})
+}
+
+func (r *draUnprepareResponse) marshal() []byte {
+	var b []byte
+	for uid, e := range r.Claims {
+		b = appendMapEntry(b, 1, uid, appendString(nil, 1, e))
+	}
+	return b
+}
+
+func (r *draUnprepareResponse) unmarshal(b []byte) error {
+	r.Claims = make(map[string]string)
+	return consumeFields(b, func(num protowire.Number, v []byte) error {
+		if num != 1 {
+			return nil
+		}
+		uid, value, err := consumeMapEntry(v)
+		if err != nil {
+			return err
+		}
+		e := ""
+		err = consumeFields(value, func(num protowire.Number, v []byte) error {
+			if num == 1 {
+				e = string(v)
+			}
+			return nil
+		})
+		r.Claims[uid] = e
+		return err
+	})
+}
@@ -0,0 +1,225 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+	"github.com/Project-HAMi/HAMi/pkg/util/client"
+)
+
+const (
+	// draSliceMaxDevices is the most devices a ResourceSlice may hold.
+	draSliceMaxDevices = 128
+	// draSliceResync is how often the ResourceSlices are checked against the cards.
+	draSliceResync = 30 * time.Second
+)
+
+// draSliceSpecs returns the specs of the ResourceSlices publishing the slots of cards on
+// nodeName, without the generation of their pool. Every healthy card is split into Count
+// slots, as the extender splits it, so kube-scheduler shares it out the same way.
+func draSliceSpecs(nodeName string, cards []*util.DeviceInfo) []map[string]any {
+	var devices []any
+	for _, card := range cards {
+		if !card.Health || card.Quarantined || card.Draining || card.HeldExternally {
+			continue
+		}
+		memory := resource.NewQuantity(util.MemoryToBytes(nvidia.NvidiaGPUDevice, int64(card.Devmem)), resource.BinarySI)
+		for slot := int32(0); slot < card.Count; slot++ {
+			devices = append(devices, map[string]any{
+				"name": util.DRADeviceName(card.Index, slot),
+				"basic": map[string]any{
+					"attributes": map[string]any{
+						"uuid":  map[string]any{"string": card.ID},
+						"index": map[string]any{"int": int64(card.Index)},
+						"slot":  map[string]any{"int": int64(slot)},
+						"type":  map[string]any{"string": card.Type},
+						"numa":  map[string]any{"int": int64(card.Numa)},
+					},
+					"capacity": map[string]any{
+						"memory": map[string]any{"value": memory.String()},
+						"cores":  map[string]any{"value": fmt.Sprint(card.Devcore)},
+					},
+				},
+			})
+		}
+	}
+	var specs []map[string]any
+	for len(devices) > 0 {
+		n := min(len(devices), draSliceMaxDevices)
+		specs = append(specs, map[string]any{
+			"driver":   util.DRADriverName,
+			"nodeName": nodeName,
+			"devices":  devices[:n],
+		})
+		devices = devices[n:]
+	}
+	for _, spec := range specs {
+		spec["pool"] = map[string]any{"name": nodeName, "resourceSliceCount": int64(len(specs))}
+	}
+	return specs
+}
+
+func draSliceName(nodeName string, i int) string {
+	return fmt.Sprintf("%s-%s-%d", nodeName, util.DRADriverName, i)
+}
+
+// sliceSpecWithoutGeneration returns the spec of slice with the generation of its pool removed.
+func sliceSpecWithoutGeneration(slice *unstructured.Unstructured) map[string]any {
+	spec, _, _ := unstructured.NestedMap(slice.Object, "spec")
+	unstructured.RemoveNestedField(spec, "pool", "generation")
+	return spec
+}
+
+// publishSlices makes the ResourceSlices of the node publish the slots of cards. When they
+// change, the generation of the pool is raised above the one of the slices they replace.
+func (d *draNodePlugin) publishSlices(cards []*util.DeviceInfo) error {
+	ctx := context.Background()
+	node, err := client.GetClient().CoreV1().Nodes().Get(ctx, util.NodeName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	slices := client.GetDynamicClient().Resource(util.ResourceSliceResource)
+	list, err := slices.List(ctx, metav1.ListOptions{FieldSelector: "spec.nodeName=" + util.NodeName})
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]*unstructured.Unstructured)
+	generation := int64(0)
+	for i := range list.Items {
+		slice := &list.Items[i]
+		driver, _, _ := unstructured.NestedString(slice.Object, "spec", "driver")
+		nodeName, _, _ := unstructured.NestedString(slice.Object, "spec", "nodeName")
+		if driver != util.DRADriverName || nodeName != util.NodeName {
+			continue
+		}
+		existing[slice.GetName()] = slice
+		if g, _, _ := unstructured.NestedInt64(slice.Object, "spec", "pool", "generation"); g > generation {
+			generation = g
+		}
+	}
+
+	specs := draSliceSpecs(util.NodeName, cards)
+	changed := len(specs) != len(existing)
+	for i, spec := range specs {
+		cur, ok := existing[draSliceName(util.NodeName, i)]
+		if !ok || !reflect.DeepEqual(sliceSpecWithoutGeneration(cur), spec) {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	generation++
+	for i, spec := range specs {
+		name := draSliceName(util.NodeName, i)
+		spec["pool"].(map[string]any)["generation"] = generation
+		slice := &unstructured.Unstructured{Object: map[string]any{"spec": spec}}
+		slice.SetAPIVersion(util.ResourceSliceResource.GroupVersion().String())
+		slice.SetKind("ResourceSlice")
+		slice.SetName(name)
+		slice.SetOwnerReferences([]metav1.OwnerReference{{
+			APIVersion: "v1",
+			Kind:       "Node",
+			Name:       node.Name,
+			UID:        node.UID,
+			Controller: &[]bool{true}[0],
+		}})
+		if cur, ok := existing[name]; ok {
+			slice.SetResourceVersion(cur.GetResourceVersion())
+			_, err = slices.Update(ctx, slice, metav1.UpdateOptions{})
+		} else {
+			_, err = slices.Create(ctx, slice, metav1.CreateOptions{})
+		}
+		if err != nil {
+			return fmt.Errorf("failed to publish ResourceSlice %s: %w", name, err)
+		}
+		delete(existing, name)
+	}
+	for name := range existing {
+		if err := slices.Delete(ctx, name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete ResourceSlice %s: %w", name, err)
+		}
+	}
+	klog.Infof("Published %d ResourceSlices of DRA driver %s, generation %d", len(specs), util.DRADriverName, generation)
+	return nil
+}
+
+// watchSlices republishes the slots of the cards of the node while the DRA driver runs, so
+// unhealthy and withdrawn cards leave the ResourceSlices.
+func (d *draNodePlugin) watchSlices(stop <-chan struct{}) {
+	ticker := time.NewTicker(draSliceResync)
+	defer ticker.Stop()
+	for {
+		d.syncCards()
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// syncCards reads the cards of the node and publishes their slots.
+func (d *draNodePlugin) syncCards() {
+	cards := *d.plugin.getAPIDevices()
+	d.cardsMutex.Lock()
+	d.cards = cards
+	d.cardsMutex.Unlock()
+	if err := d.publishSlices(cards); err != nil {
+		klog.Errorf("Failed to publish the ResourceSlices of DRA driver %s: %v", util.DRADriverName, err)
+	}
+}
+
+// card returns the card with index, as last published.
+func (d *draNodePlugin) card(index uint) (*util.DeviceInfo, bool) {
+	d.cardsMutex.Lock()
+	defer d.cardsMutex.Unlock()
+	for _, card := range d.cards {
+		if card.Index == index {
+			return card, true
+		}
+	}
+	return nil, false
+}
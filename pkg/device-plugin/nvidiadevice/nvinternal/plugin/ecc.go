@@ -0,0 +1,116 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// eccErrorWindow is how far back the recent ECC errors of a card are counted.
+const eccErrorWindow = 24 * time.Hour
+
+// eccSample is the ECC error counts of a card at a point in time.
+type eccSample struct {
+	at                     time.Time
+	corrected, uncorrected uint64
+}
+
+// eccTracker remembers the ECC error counts of every card over eccErrorWindow, to tell the
+// errors of the window from the ones since the driver was loaded. Only samples with new
+// errors are kept, so the history stays short on healthy cards.
+type eccTracker struct {
+	mutex   sync.Mutex
+	samples map[string][]eccSample
+}
+
+func newECCTracker() *eccTracker {
+	return &eccTracker{samples: make(map[string][]eccSample)}
+}
+
+// observe records the counts of card at now and returns them with the errors of the window.
+func (t *eccTracker) observe(card string, corrected, uncorrected uint64, now time.Time) *util.DeviceECCErrors {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	samples := t.samples[card]
+	if n := len(samples); n > 0 && (corrected < samples[n-1].corrected || uncorrected < samples[n-1].uncorrected) {
+		// The volatile counters start over when the driver is reloaded.
+		samples = nil
+	}
+	if n := len(samples); n == 0 || corrected != samples[n-1].corrected || uncorrected != samples[n-1].uncorrected {
+		samples = append(samples, eccSample{at: now, corrected: corrected, uncorrected: uncorrected})
+	}
+	// The newest sample taken before the window is the baseline of the window, older ones
+	// aren't needed anymore.
+	start := 0
+	for i, s := range samples {
+		if now.Sub(s.at) >= eccErrorWindow {
+			start = i
+		}
+	}
+	samples = samples[start:]
+	t.samples[card] = samples
+
+	res := &util.DeviceECCErrors{Corrected: corrected, Uncorrected: uncorrected}
+	if base := samples[0]; now.Sub(base.at) >= eccErrorWindow {
+		res.RecentCorrected = corrected - base.corrected
+		res.RecentUncorrected = uncorrected - base.uncorrected
+	} else {
+		// Without a sample from before the window, the errors since the driver was loaded are
+		// counted, so a restart of the device plugin doesn't hide them.
+		res.RecentCorrected = corrected
+		res.RecentUncorrected = uncorrected
+	}
+	return res
+}
+
+// getECCErrors reads the volatile ECC error counts of ndev, nil if the card has no ECC or
+// doesn't report them.
+func (plugin *NvidiaDevicePlugin) getECCErrors(uuid string, ndev nvml.Device) *util.DeviceECCErrors {
+	corrected, ret := ndev.GetTotalEccErrors(nvml.MEMORY_ERROR_TYPE_CORRECTED, nvml.VOLATILE_ECC)
+	if ret != nvml.SUCCESS {
+		klog.V(5).InfoS("failed to get corrected ECC errors", "uuid", uuid, "err", ret)
+		return nil
+	}
+	uncorrected, ret := ndev.GetTotalEccErrors(nvml.MEMORY_ERROR_TYPE_UNCORRECTED, nvml.VOLATILE_ECC)
+	if ret != nvml.SUCCESS {
+		klog.V(5).InfoS("failed to get uncorrected ECC errors", "uuid", uuid, "err", ret)
+		return nil
+	}
+	return plugin.ecc.observe(uuid, corrected, uncorrected, time.Now())
+}
@@ -0,0 +1,62 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func TestECCTracker(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	tr := newECCTracker()
+
+	// Errors from before the device plugin started count as recent for a whole window.
+	require.Equal(t, &util.DeviceECCErrors{Corrected: 10, Uncorrected: 1, RecentCorrected: 10, RecentUncorrected: 1}, tr.observe("GPU-0", 10, 1, start))
+	require.Equal(t, &util.DeviceECCErrors{Corrected: 15, Uncorrected: 1, RecentCorrected: 15, RecentUncorrected: 1}, tr.observe("GPU-0", 15, 1, start.Add(time.Hour)))
+	// A window later, only the errors since its start count.
+	require.Equal(t, &util.DeviceECCErrors{Corrected: 15, Uncorrected: 1, RecentCorrected: 5}, tr.observe("GPU-0", 15, 1, start.Add(eccErrorWindow)))
+	require.Equal(t, &util.DeviceECCErrors{Corrected: 15, Uncorrected: 1}, tr.observe("GPU-0", 15, 1, start.Add(eccErrorWindow+time.Hour)))
+	// Unchanged counts aren't kept, so the history stays short.
+	require.Len(t, tr.samples["GPU-0"], 1)
+
+	// The driver was reloaded and the counters started over.
+	require.Equal(t, &util.DeviceECCErrors{Corrected: 2, RecentCorrected: 2}, tr.observe("GPU-0", 2, 0, start.Add(2*eccErrorWindow)))
+
+	// Cards are tracked separately.
+	require.Equal(t, &util.DeviceECCErrors{}, tr.observe("GPU-1", 0, 0, start))
+}
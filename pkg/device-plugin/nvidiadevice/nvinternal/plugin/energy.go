@@ -0,0 +1,250 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+	"github.com/Project-HAMi/HAMi/pkg/util/client"
+)
+
+// PodGPUEnergy is the energy the cards of the node used for every pod on them, approximated by
+// apportioning the energy of a shared card by the cores the pods reserve of it.
+var PodGPUEnergy = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "hami_device_plugin_pod_gpu_energy_joules_total",
+	Help: "Energy of the GPUs attributed to the pod in joules, apportioned by the cores reserved on shared GPUs",
+}, []string{"podnamespace", "podname", "costcenter"})
+
+// energyPod identifies a pod in PodGPUEnergy.
+type energyPod struct {
+	namespace, name, costCenter string
+}
+
+// energyShares returns the share of the energy of a card every pod on it gets from the cores the
+// pods reserve of it: its share of the reserved cores, with the cores left unreserved split evenly
+// among the pods reserving none, which HAMi-core doesn't limit.
+func energyShares(cores map[energyPod]int32) map[energyPod]float64 {
+	reserved, unlimited := int32(0), 0
+	for _, c := range cores {
+		reserved += c
+		if c == 0 {
+			unlimited++
+		}
+	}
+	weights := make(map[energyPod]float64, len(cores))
+	total := 0.0
+	for p, c := range cores {
+		w := float64(c)
+		if c == 0 {
+			w = float64(max(100-reserved, 0)) / float64(unlimited)
+		}
+		weights[p] = w
+		total += w
+	}
+	for p := range weights {
+		if total > 0 {
+			weights[p] /= total
+		}
+	}
+	return weights
+}
+
+// apportionEnergy splits the joules every card used among the pods holding it, as energyShares
+// tells. The energy of cards no pod holds isn't attributed.
+func apportionEnergy(joules map[string]float64, pods []corev1.Pod) map[energyPod]float64 {
+	cores := make(map[string]map[energyPod]int32)
+	for i := range pods {
+		p := &pods[i]
+		if p.Status.Phase == corev1.PodSucceeded || p.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		pd, err := util.DecodePodDevices(util.SupportDevices, p.Annotations)
+		if err != nil {
+			continue
+		}
+		key := energyPod{namespace: p.Namespace, name: p.Name, costCenter: p.Annotations[util.CostCenter]}
+		for _, ctrdevs := range pd[nvidia.NvidiaGPUDevice] {
+			for _, d := range ctrdevs {
+				card := cardID(d.UUID)
+				if cores[card] == nil {
+					cores[card] = make(map[energyPod]int32)
+				}
+				cores[card][key] += d.Usedcores
+			}
+		}
+	}
+	res := make(map[energyPod]float64)
+	for card, j := range joules {
+		for p, share := range energyShares(cores[card]) {
+			res[p] += j * share
+		}
+	}
+	return res
+}
+
+// energyMeter turns the energy counters, or else the power draw, of the cards into the joules
+// they used between two samples.
+type energyMeter struct {
+	// last is the total energy of a card in millijoules and when it was read, for the cards
+	// with an energy counter; the power draw in milliwatts for the others.
+	last map[string]energyReading
+	// pods are the pods PodGPUEnergy has series of.
+	pods map[energyPod]bool
+}
+
+type energyReading struct {
+	millijoules uint64
+	milliwatts  uint32
+	at          time.Time
+}
+
+func newEnergyMeter() *energyMeter {
+	return &energyMeter{last: make(map[string]energyReading), pods: make(map[energyPod]bool)}
+}
+
+// since returns the joules a card used between its readings r0 and r. Cards without an energy
+// counter are taken to have drawn the mean of both power readings meanwhile.
+func (r energyReading) since(r0 energyReading) float64 {
+	seconds := r.at.Sub(r0.at).Seconds()
+	if seconds <= 0 {
+		return 0
+	}
+	if r.millijoules > 0 && r0.millijoules > 0 {
+		if r.millijoules < r0.millijoules {
+			// The driver was reloaded.
+			return 0
+		}
+		return float64(r.millijoules-r0.millijoules) / 1000
+	}
+	return (float64(r.milliwatts) + float64(r0.milliwatts)) / 2 / 1000 * seconds
+}
+
+// sample reads the cards from NVML and returns the joules every card used since it was read
+// before. Cards NVML fails to read are left out.
+func (m *energyMeter) sample(cards []string, now time.Time) map[string]float64 {
+	if err := initNVML(); err != nil {
+		if !errors.Is(err, errNoNVML) {
+			klog.Errorln(err)
+		}
+		return nil
+	}
+	res := make(map[string]float64)
+	for _, card := range cards {
+		ndev, ret := nvml.DeviceGetHandleByUUID(card)
+		if ret != nvml.SUCCESS {
+			klog.V(4).InfoS("failed to get device", "uuid", card, "err", ret)
+			continue
+		}
+		r := energyReading{at: now}
+		if mj, ret := ndev.GetTotalEnergyConsumption(); ret == nvml.SUCCESS {
+			r.millijoules = mj
+		} else if mw, ret := ndev.GetPowerUsage(); ret == nvml.SUCCESS {
+			r.milliwatts = mw
+		} else {
+			klog.V(4).InfoS("failed to get energy or power", "uuid", card, "err", ret)
+			delete(m.last, card)
+			continue
+		}
+		if r0, ok := m.last[card]; ok {
+			res[card] = r.since(r0)
+		}
+		m.last[card] = r
+	}
+	return res
+}
+
+// record adds energy to PodGPUEnergy and drops the series of the pods which left the node.
+func (m *energyMeter) record(energy map[energyPod]float64, pods []corev1.Pod) {
+	present := make(map[energyPod]bool, len(pods))
+	for i := range pods {
+		p := &pods[i]
+		present[energyPod{namespace: p.Namespace, name: p.Name, costCenter: p.Annotations[util.CostCenter]}] = true
+	}
+	for p, j := range energy {
+		PodGPUEnergy.WithLabelValues(p.namespace, p.name, p.costCenter).Add(j)
+		m.pods[p] = true
+	}
+	for p := range m.pods {
+		if !present[p] {
+			PodGPUEnergy.DeleteLabelValues(p.namespace, p.name, p.costCenter)
+			delete(m.pods, p)
+		}
+	}
+}
+
+// WatchEnergy samples the energy of the cards every interval and attributes it to the pods on
+// them in PodGPUEnergy until stop is closed.
+func (plugin *NvidiaDevicePlugin) WatchEnergy(interval time.Duration, stop <-chan any) {
+	klog.InfoS("Starting WatchEnergy", "interval", interval)
+	meter := newEnergyMeter()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		cards := make([]string, 0)
+		seen := make(map[string]bool)
+		for UUID := range plugin.Devices() {
+			if card := cardID(UUID); !seen[card] {
+				seen[card] = true
+				cards = append(cards, card)
+			}
+		}
+		joules := meter.sample(cards, time.Now())
+		if joules == nil {
+			continue
+		}
+		pods, err := client.GetClient().CoreV1().Pods("").List(context.Background(), metav1.ListOptions{
+			FieldSelector: fmt.Sprintf("spec.nodeName=%s", util.NodeName),
+		})
+		if err != nil {
+			klog.Errorln("list pods error", err.Error())
+			continue
+		}
+		meter.record(apportionEnergy(joules, pods.Items), pods.Items)
+	}
+}
@@ -0,0 +1,129 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func energyTestPod(name, card string, cores int, costCenter string) corev1.Pod {
+	annos := map[string]string{util.SupportDevices[nvidia.NvidiaGPUDevice]: fmt.Sprintf("%s,NVIDIA,1000,%d:;", card, cores)}
+	if costCenter != "" {
+		annos[util.CostCenter] = costCenter
+	}
+	return corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Annotations: annos},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+}
+
+func TestEnergyShares(t *testing.T) {
+	a, b, c := energyPod{name: "a"}, energyPod{name: "b"}, energyPod{name: "c"}
+	require.Equal(t, map[energyPod]float64{a: 1}, energyShares(map[energyPod]int32{a: 0}))
+	require.Equal(t, map[energyPod]float64{a: 1}, energyShares(map[energyPod]int32{a: 30}))
+	require.Equal(t, map[energyPod]float64{a: 0.25, b: 0.75}, energyShares(map[energyPod]int32{a: 20, b: 60}))
+	// The 40 cores left unreserved go to the pods without a core limit.
+	require.Equal(t, map[energyPod]float64{a: 0.6, b: 0.2, c: 0.2}, energyShares(map[energyPod]int32{a: 60, b: 0, c: 0}))
+	require.Equal(t, map[energyPod]float64{a: 1, b: 0}, energyShares(map[energyPod]int32{a: 100, b: 0}))
+	require.Empty(t, energyShares(nil))
+}
+
+func TestApportionEnergy(t *testing.T) {
+	util.SupportDevices[nvidia.NvidiaGPUDevice] = "hami.io/vgpu-devices-allocated"
+	pods := []corev1.Pod{
+		energyTestPod("train", "GPU-0", 75, "research"),
+		energyTestPod("serve", "GPU-0", 25, ""),
+		energyTestPod("mig", "GPU-1[1-0]", 0, ""),
+		energyTestPod("done", "GPU-1[1-1]", 0, ""),
+	}
+	pods[3].Status.Phase = corev1.PodSucceeded
+	energy := apportionEnergy(map[string]float64{"GPU-0": 400, "GPU-1": 100, "GPU-2": 50}, pods)
+	require.Equal(t, map[energyPod]float64{
+		{namespace: "default", name: "train", costCenter: "research"}: 300,
+		{namespace: "default", name: "serve"}:                         100,
+		{namespace: "default", name: "mig"}:                           100,
+	}, energy)
+}
+
+func TestEnergyReadingSince(t *testing.T) {
+	t0 := time.Now()
+	t1 := t0.Add(10 * time.Second)
+	require.Equal(t, 1.5, energyReading{millijoules: 5000, at: t1}.since(energyReading{millijoules: 3500, at: t0}))
+	require.Equal(t, 0.0, energyReading{millijoules: 100, at: t1}.since(energyReading{millijoules: 3500, at: t0}), "the driver was reloaded")
+	require.Equal(t, 1500.0, energyReading{milliwatts: 200000, at: t1}.since(energyReading{milliwatts: 100000, at: t0}))
+	require.Equal(t, 0.0, energyReading{milliwatts: 200000, at: t0}.since(energyReading{milliwatts: 100000, at: t0}))
+}
+
+func TestEnergyMeterRecord(t *testing.T) {
+	util.SupportDevices[nvidia.NvidiaGPUDevice] = "hami.io/vgpu-devices-allocated"
+	PodGPUEnergy.Reset()
+	defer PodGPUEnergy.Reset()
+	m := newEnergyMeter()
+	pods := []corev1.Pod{energyTestPod("train", "GPU-0", 0, "research")}
+	train := energyPod{namespace: "default", name: "train", costCenter: "research"}
+
+	reg := prometheus.NewPedanticRegistry()
+	require.NoError(t, reg.Register(PodGPUEnergy))
+	gather := func() map[string]float64 {
+		families, err := reg.Gather()
+		require.NoError(t, err)
+		res := map[string]float64{}
+		for _, family := range families {
+			for _, metric := range family.GetMetric() {
+				labels := ""
+				for _, label := range metric.GetLabel() {
+					labels += label.GetName() + "=" + label.GetValue() + ","
+				}
+				res[labels] = metric.GetCounter().GetValue()
+			}
+		}
+		return res
+	}
+
+	m.record(map[energyPod]float64{train: 100}, pods)
+	m.record(map[energyPod]float64{train: 50}, pods)
+	require.Equal(t, map[string]float64{"costcenter=research,podname=train,podnamespace=default,": 150}, gather())
+
+	m.record(nil, nil)
+	require.Empty(t, gather(), "the series of a pod which left is dropped")
+}
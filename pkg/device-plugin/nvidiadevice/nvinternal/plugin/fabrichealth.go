@@ -0,0 +1,156 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/util"
+	"github.com/Project-HAMi/HAMi/pkg/util/client"
+)
+
+const (
+	// EventReasonNVLinkFabricUnhealthy is recorded on the node when its NVSwitch fabric goes down.
+	EventReasonNVLinkFabricUnhealthy = "NVLinkFabricUnhealthy"
+	// EventReasonNVLinkFabricHealthy is recorded on the node when its NVSwitch fabric recovers.
+	EventReasonNVLinkFabricHealthy = "NVLinkFabricHealthy"
+)
+
+type fabricProbe func(uuid string) (nvml.GpuFabricInfo, nvml.Return)
+
+func nvmlFabricProbe(uuid string) (nvml.GpuFabricInfo, nvml.Return) {
+	ndev, ret := nvml.DeviceGetHandleByUUID(uuid)
+	if ret != nvml.SUCCESS {
+		return nvml.GpuFabricInfo{}, ret
+	}
+	return ndev.GetGpuFabricInfo()
+}
+
+func fabricStateName(state uint8) string {
+	switch state {
+	case nvml.GPU_FABRIC_STATE_NOT_STARTED:
+		return "not started"
+	case nvml.GPU_FABRIC_STATE_IN_PROGRESS:
+		return "in progress"
+	case nvml.GPU_FABRIC_STATE_COMPLETED:
+		return "completed"
+	}
+	return fmt.Sprintf("in unknown state %d", state)
+}
+
+// evaluateNVLinkFabric returns the value of the NVLink fabric node annotation for the GPUs
+// uuids. A GPU on an HGX board only joins the NVLink fabric once the fabric manager registered
+// it, so a registration which didn't complete, or failed, means collectives across GPUs hang
+// although every single GPU looks healthy. GPUs without NVSwitch fabric, or a driver without
+// the NVML call, report no state and are left out.
+func evaluateNVLinkFabric(uuids []string, probe fabricProbe) string {
+	applicable := false
+	problems := make([]string, 0)
+	for _, uuid := range uuids {
+		info, ret := probe(uuid)
+		if ret != nvml.SUCCESS || info.State == nvml.GPU_FABRIC_STATE_NOT_SUPPORTED {
+			continue
+		}
+		applicable = true
+		switch {
+		case info.State != nvml.GPU_FABRIC_STATE_COMPLETED:
+			problems = append(problems, fmt.Sprintf("%s fabric registration %s", uuid, fabricStateName(info.State)))
+		case nvml.Return(info.Status) != nvml.SUCCESS:
+			problems = append(problems, fmt.Sprintf("%s fabric registration failed with nvml return code %d", uuid, info.Status))
+		}
+	}
+	if !applicable {
+		return ""
+	}
+	if len(problems) == 0 {
+		return util.NVLinkFabricHealthy
+	}
+	return util.NVLinkFabricUnhealthy + ": " + strings.Join(problems, ", ")
+}
+
+// nvlinkFabricHealth probes the NVLink fabric of the devices of the plugin.
+func (plugin *NvidiaDevicePlugin) nvlinkFabricHealth() string {
+	if err := initNVML(); err != nil {
+		if !errors.Is(err, errNoNVML) {
+			klog.Errorln(err)
+		}
+		return ""
+	}
+	defer nvml.Shutdown()
+	uuids := make([]string, 0)
+	for uuid := range plugin.Devices() {
+		uuids = append(uuids, uuid)
+	}
+	slices.Sort(uuids)
+	return evaluateNVLinkFabric(uuids, nvmlFabricProbe)
+}
+
+// recordFabricHealth records an event on node when the health of its NVLink fabric changes.
+func (plugin *NvidiaDevicePlugin) recordFabricHealth(node *corev1.Node, health string) {
+	prev := plugin.fabricHealth
+	plugin.fabricHealth = health
+	wasUnhealthy := strings.HasPrefix(prev, util.NVLinkFabricUnhealthy)
+	isUnhealthy := strings.HasPrefix(health, util.NVLinkFabricUnhealthy)
+	if wasUnhealthy == isUnhealthy {
+		return
+	}
+	if plugin.nodeEvents == nil {
+		plugin.nodeEvents = newNodeEventRecorder()
+	}
+	if isUnhealthy {
+		klog.Warningf("NVLink fabric of node %s is %s, multi-GPU pods won't be placed on it", node.Name, health)
+		plugin.nodeEvents.Eventf(node, corev1.EventTypeWarning, EventReasonNVLinkFabricUnhealthy, "NVLink fabric is %s, multi-GPU pods won't be placed on this node", health)
+	} else {
+		klog.Infof("NVLink fabric of node %s recovered", node.Name)
+		plugin.nodeEvents.Event(node, corev1.EventTypeNormal, EventReasonNVLinkFabricHealthy, "NVLink fabric recovered, multi-GPU pods can be placed on this node again")
+	}
+}
+
+func newNodeEventRecorder() record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&v1core.EventSinkImpl{Interface: client.GetClient().CoreV1().Events("")})
+	schema := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(schema)
+	return broadcaster.NewRecorder(schema, corev1.EventSource{Component: "hami-device-plugin", Host: util.NodeName})
+}
@@ -0,0 +1,92 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func TestEvaluateNVLinkFabric(t *testing.T) {
+	probe := func(infos map[string]nvml.GpuFabricInfo) fabricProbe {
+		return func(uuid string) (nvml.GpuFabricInfo, nvml.Return) {
+			info, ok := infos[uuid]
+			if !ok {
+				return nvml.GpuFabricInfo{}, nvml.ERROR_NOT_SUPPORTED
+			}
+			return info, nvml.SUCCESS
+		}
+	}
+	completed := nvml.GpuFabricInfo{State: nvml.GPU_FABRIC_STATE_COMPLETED, Status: uint32(nvml.SUCCESS)}
+
+	require.Equal(t, "", evaluateNVLinkFabric([]string{"GPU-0", "GPU-1"}, probe(map[string]nvml.GpuFabricInfo{
+		"GPU-0": {State: nvml.GPU_FABRIC_STATE_NOT_SUPPORTED},
+	})))
+	require.Equal(t, util.NVLinkFabricHealthy, evaluateNVLinkFabric([]string{"GPU-0", "GPU-1"}, probe(map[string]nvml.GpuFabricInfo{
+		"GPU-0": completed, "GPU-1": completed,
+	})))
+	require.Equal(t, util.NVLinkFabricUnhealthy+": GPU-0 fabric registration in progress, GPU-1 fabric registration failed with nvml return code 999",
+		evaluateNVLinkFabric([]string{"GPU-0", "GPU-1", "GPU-2"}, probe(map[string]nvml.GpuFabricInfo{
+			"GPU-0": {State: nvml.GPU_FABRIC_STATE_IN_PROGRESS},
+			"GPU-1": {State: nvml.GPU_FABRIC_STATE_COMPLETED, Status: uint32(nvml.ERROR_UNKNOWN)},
+			"GPU-2": completed,
+		})))
+}
+
+func TestRecordFabricHealth(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	plugin := &NvidiaDevicePlugin{nodeEvents: recorder}
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+
+	plugin.recordFabricHealth(node, util.NVLinkFabricHealthy)
+	plugin.recordFabricHealth(node, util.NVLinkFabricUnhealthy+": GPU-0 fabric registration in progress")
+	plugin.recordFabricHealth(node, util.NVLinkFabricUnhealthy+": GPU-0 fabric registration in progress")
+	plugin.recordFabricHealth(node, util.NVLinkFabricHealthy)
+	close(recorder.Events)
+
+	events := make([]string, 0)
+	for e := range recorder.Events {
+		events = append(events, e)
+	}
+	require.Len(t, events, 2)
+	require.True(t, strings.HasPrefix(events[0], "Warning "+EventReasonNVLinkFabricUnhealthy))
+	require.True(t, strings.HasPrefix(events[1], "Normal "+EventReasonNVLinkFabricHealthy))
+}
@@ -0,0 +1,102 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"k8s.io/klog/v2"
+	kubeletdevicepluginv1beta1 "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/device-plugin/nvidiadevice/nvinternal/rm"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+)
+
+// rmHealthChecker is the default health checker of NVIDIA GPUs: the NVML Xid events the resource
+// manager watches. The application Xids among them go to applicationXid, if not nil.
+type rmHealthChecker struct {
+	rm             rm.ResourceManager
+	applicationXid rm.ApplicationXidHandler
+}
+
+func (c *rmHealthChecker) CheckHealth(stop <-chan any, ids []string, unhealthy chan<- device.UnhealthyDevice) error {
+	watched := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		watched[id] = true
+	}
+	devices := make(chan *rm.Device)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case d := <-devices:
+				if !watched[d.ID] {
+					continue
+				}
+				select {
+				case unhealthy <- device.UnhealthyDevice{ID: d.ID, Reason: "critical Xid error"}:
+				case <-stop:
+					return
+				}
+			}
+		}
+	}()
+	return c.rm.CheckHealth(stop, devices, c.applicationXid)
+}
+
+// healthChecker returns the health checker registered for NVIDIA GPUs, the NVML Xid events of
+// the resource manager if none is. Only the latter passes application Xids to the co-tenant guard.
+func (plugin *NvidiaDevicePlugin) healthChecker() device.DeviceHealthChecker {
+	if c := device.HealthCheckerFor(nvidia.NvidiaGPUDevice); c != nil {
+		return c
+	}
+	c := &rmHealthChecker{rm: plugin.rm}
+	if plugin.cotenants != nil {
+		c.applicationXid = func(uuid string, xid uint64) {
+			go plugin.cotenants.handleXid(uuid, xid, plugin.quarantine)
+		}
+	}
+	return c
+}
+
+// markUnhealthy marks the device of u unhealthy. It reports whether the plugin has the device.
+func (plugin *NvidiaDevicePlugin) markUnhealthy(u device.UnhealthyDevice) bool {
+	d := plugin.rm.Devices().GetByID(u.ID)
+	if d == nil {
+		return false
+	}
+	// FIXME: there is no way to recover from the Unhealthy state.
+	d.Health = kubeletdevicepluginv1beta1.Unhealthy
+	klog.Infof("'%s' device marked unhealthy: %s: %s", plugin.rm.Resource(), d.ID, u.Reason)
+	return true
+}
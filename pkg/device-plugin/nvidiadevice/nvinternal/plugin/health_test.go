@@ -0,0 +1,109 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	kubeletdevicepluginv1beta1 "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/device-plugin/nvidiadevice/nvinternal/rm"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+)
+
+// xidResourceManager reports its devices unhealthy on CheckHealth, in order.
+type xidResourceManager struct {
+	fakeResourceManager
+}
+
+func (f *xidResourceManager) CheckHealth(stop <-chan any, unhealthy chan<- *rm.Device, applicationXid rm.ApplicationXidHandler) error {
+	for _, id := range []string{"GPU-0", "GPU-1"} {
+		unhealthy <- f.devices[id]
+	}
+	<-stop
+	return nil
+}
+
+// fakeHealthChecker reports every device it watches unhealthy.
+type fakeHealthChecker struct{}
+
+func (fakeHealthChecker) CheckHealth(stop <-chan any, ids []string, unhealthy chan<- device.UnhealthyDevice) error {
+	for _, id := range ids {
+		unhealthy <- device.UnhealthyDevice{ID: id, Reason: "fake"}
+	}
+	return nil
+}
+
+func healthTestDevices() rm.Devices {
+	return rm.Devices{
+		"GPU-0": &rm.Device{Device: kubeletdevicepluginv1beta1.Device{ID: "GPU-0", Health: kubeletdevicepluginv1beta1.Healthy}},
+		"GPU-1": &rm.Device{Device: kubeletdevicepluginv1beta1.Device{ID: "GPU-1", Health: kubeletdevicepluginv1beta1.Healthy}},
+	}
+}
+
+func TestRMHealthChecker(t *testing.T) {
+	c := &rmHealthChecker{rm: &xidResourceManager{fakeResourceManager{devices: healthTestDevices()}}}
+	stop := make(chan any)
+	unhealthy := make(chan device.UnhealthyDevice)
+	done := make(chan error)
+	go func() { done <- c.CheckHealth(stop, []string{"GPU-1"}, unhealthy) }()
+
+	// GPU-0 is not watched.
+	require.Equal(t, device.UnhealthyDevice{ID: "GPU-1", Reason: "critical Xid error"}, <-unhealthy)
+	close(stop)
+	require.NoError(t, <-done)
+}
+
+func TestPluginHealthChecker(t *testing.T) {
+	plugin := &NvidiaDevicePlugin{rm: &fakeResourceManager{devices: healthTestDevices()}}
+	c, ok := plugin.healthChecker().(*rmHealthChecker)
+	require.True(t, ok)
+	require.Nil(t, c.applicationXid)
+	// The application Xids go to the co-tenant guard only.
+	guarded := &NvidiaDevicePlugin{rm: plugin.rm, cotenants: &coTenantGuard{}}
+	require.NotNil(t, guarded.healthChecker().(*rmHealthChecker).applicationXid)
+
+	device.RegisterHealthChecker(nvidia.NvidiaGPUDevice, fakeHealthChecker{})
+	defer device.RegisterHealthChecker(nvidia.NvidiaGPUDevice, nil)
+	checker := plugin.healthChecker()
+	require.Equal(t, fakeHealthChecker{}, checker)
+
+	unhealthy := make(chan device.UnhealthyDevice, 3)
+	require.NoError(t, checker.CheckHealth(nil, []string{"GPU-1", "GPU-9"}, unhealthy))
+	require.True(t, plugin.markUnhealthy(<-unhealthy))
+	require.False(t, plugin.markUnhealthy(<-unhealthy))
+	require.Equal(t, kubeletdevicepluginv1beta1.Healthy, plugin.rm.Devices()["GPU-0"].Health)
+	require.Equal(t, kubeletdevicepluginv1beta1.Unhealthy, plugin.rm.Devices()["GPU-1"].Health)
+}
@@ -0,0 +1,208 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	spec "github.com/NVIDIA/k8s-device-plugin/api/config/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	kubeletdevicepluginv1beta1 "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device-plugin/nvidiadevice/nvinternal/rm"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+	"github.com/Project-HAMi/HAMi/pkg/util/client"
+)
+
+// fakeKubelet is the registration service of a kubelet, passing on the plugins registering.
+type fakeKubelet struct {
+	kubeletdevicepluginv1beta1.UnimplementedRegistrationServer
+	registered chan *kubeletdevicepluginv1beta1.RegisterRequest
+}
+
+func (k *fakeKubelet) Register(_ context.Context, r *kubeletdevicepluginv1beta1.RegisterRequest) (*kubeletdevicepluginv1beta1.Empty, error) {
+	k.registered <- r
+	return &kubeletdevicepluginv1beta1.Empty{}, nil
+}
+
+// startFakeKubelet serves a fakeKubelet on socket until the test ends.
+func startFakeKubelet(t *testing.T, socket string) *fakeKubelet {
+	lis, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	kubelet := &fakeKubelet{registered: make(chan *kubeletdevicepluginv1beta1.RegisterRequest, 1)}
+	server := grpc.NewServer()
+	kubeletdevicepluginv1beta1.RegisterRegistrationServer(server, kubelet)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+	return kubelet
+}
+
+// TestAllocateWithFakeDevices runs the device plugin against fake GPUs and a fake kubelet, from
+// registering to the Allocate of a pod the scheduler placed on one of them, without hardware.
+func TestAllocateWithFakeDevices(t *testing.T) {
+	dir := t.TempDir()
+	prevHookPath := hostHookPath
+	hostHookPath = dir
+	t.Cleanup(func() { hostHookPath = prevHookPath })
+	util.SupportDevices[nvidia.NvidiaGPUDevice] = "hami.io/vgpu-devices-allocated"
+	util.InRequestDevices[nvidia.NvidiaGPUDevice] = "hami.io/vgpu-devices-to-allocate"
+	util.NodeName = "node1"
+	t.Setenv(util.NodeNameEnvName, "node1")
+	prevCheck := RuntimeCheck
+	RuntimeCheck = RuntimeCheckOff
+	t.Cleanup(func() { RuntimeCheck = prevCheck })
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "trainer",
+			Namespace: "default",
+			UID:       "uid-1",
+			Annotations: map[string]string{
+				util.AssignedNodeAnnotations:                  "node1",
+				util.BindTimeAnnotations:                      "1700000000",
+				util.DeviceBindPhase:                          util.DeviceBindAllocating,
+				util.InRequestDevices[nvidia.NvidiaGPUDevice]: "GPU-fake-1,NVIDIA,3000,30:;",
+				util.SupportDevices[nvidia.NvidiaGPUDevice]:   "GPU-fake-1,NVIDIA,3000,30:;",
+			},
+		},
+		Spec:   corev1.PodSpec{NodeName: "node1", Containers: []corev1.Container{{Name: "main"}}},
+		Status: corev1.PodStatus{Phase: corev1.PodPending},
+	}
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1", Annotations: map[string]string{}}}
+	client.KubeClient = fake.NewSimpleClientset(node, pod)
+
+	devices := []rm.FakeDevice{
+		{UUID: "GPU-fake-0", Model: "Tesla T4", Memory: 15360},
+		{UUID: "GPU-fake-1", Model: "Tesla T4", Memory: 15360},
+	}
+	idStrategy, disabled := spec.DeviceIDStrategyUUID, false
+	config := &nvidia.DeviceConfig{Config: &spec.Config{
+		Flags: spec.Flags{CommandLineFlags: spec.CommandLineFlags{
+			GDSEnabled:   &disabled,
+			MOFEDEnabled: &disabled,
+			Plugin: &spec.PluginCommandLineFlags{
+				DeviceIDStrategy: &idStrategy,
+				PassDeviceSpecs:  &disabled,
+			},
+		}},
+		Resources: spec.Resources{GPUs: []spec.Resource{{Pattern: "*", Name: "nvidia.com/gpu"}}},
+	}}
+	rms, err := rm.NewFakeResourceManagers(config, devices)
+	require.NoError(t, err)
+	require.Len(t, rms, 1)
+	strategies, err := spec.NewDeviceListStrategies([]string{spec.DeviceListStrategyEnvvar})
+	require.NoError(t, err)
+
+	kubelet := startFakeKubelet(t, filepath.Join(dir, "kubelet.sock"))
+	plugin := &NvidiaDevicePlugin{
+		rm:                   rms[0],
+		discoverer:           newFakeDiscoverer(devices),
+		config:               config,
+		deviceListEnvvar:     "NVIDIA_VISIBLE_DEVICES",
+		deviceListStrategies: strategies,
+		socket:               filepath.Join(dir, "nvidia-gpu.sock"),
+		kubeletSocket:        filepath.Join(dir, "kubelet.sock"),
+		schedulerConfig:      nvidia.NvidiaConfig{DeviceSplitCount: 10},
+		quarantine:           newCardQuarantine(0, time.Minute),
+		ecc:                  newECCTracker(),
+		temperatures:         newTemperatureTracker(),
+	}
+	require.NoError(t, plugin.Start())
+	t.Cleanup(func() { plugin.Stop() })
+
+	var registered *kubeletdevicepluginv1beta1.RegisterRequest
+	select {
+	case registered = <-kubelet.registered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the device plugin didn't register with the kubelet")
+	}
+	require.Equal(t, "nvidia.com/gpu", registered.ResourceName)
+	require.Equal(t, "nvidia-gpu.sock", registered.Endpoint)
+
+	conn, err := grpc.NewClient("unix://"+plugin.socket, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	dp := kubeletdevicepluginv1beta1.NewDevicePluginClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := dp.ListAndWatch(ctx, &kubeletdevicepluginv1beta1.Empty{})
+	require.NoError(t, err)
+	list, err := stream.Recv()
+	require.NoError(t, err)
+	// Every card is advertised as DeviceSplitCount replicas.
+	require.Len(t, list.Devices, 20)
+
+	// The kubelet picks any replica, the plugin hands out the card the scheduler placed the
+	// container on.
+	resp, err := dp.Allocate(ctx, &kubeletdevicepluginv1beta1.AllocateRequest{ContainerRequests: []*kubeletdevicepluginv1beta1.ContainerAllocateRequest{
+		{DevicesIDs: []string{"GPU-fake-0-3"}},
+	}})
+	require.NoError(t, err)
+	require.Len(t, resp.ContainerResponses, 1)
+	ctr := resp.ContainerResponses[0]
+	require.Equal(t, "GPU-fake-1", ctr.Envs["NVIDIA_VISIBLE_DEVICES"])
+	require.Equal(t, "3000m", ctr.Envs["CUDA_DEVICE_MEMORY_LIMIT_0"])
+	require.Equal(t, "30", ctr.Envs["CUDA_DEVICE_SM_LIMIT"])
+	require.Contains(t, ctr.Envs, "CUDA_DEVICE_MEMORY_SHARED_CACHE")
+
+	cacheDir := filepath.Join(dir, "vgpu", "containers", "uid-1_main")
+	mounts := make(map[string]*kubeletdevicepluginv1beta1.Mount)
+	for _, m := range ctr.Mounts {
+		mounts[m.ContainerPath] = m
+	}
+	require.Equal(t, filepath.Join(dir, "vgpu", "libvgpu.so"), mounts[dir+"/vgpu/libvgpu.so"].HostPath)
+	require.True(t, mounts[dir+"/vgpu/libvgpu.so"].ReadOnly)
+	require.Equal(t, cacheDir, mounts[dir+"/vgpu"].HostPath)
+	require.False(t, mounts[dir+"/vgpu"].ReadOnly)
+	require.Equal(t, dir+"/vgpu/ld.so.preload", mounts["/etc/ld.so.preload"].HostPath)
+	require.Contains(t, mounts, "/tmp/vgpulock")
+	_, err = os.Stat(cacheDir)
+	require.NoError(t, err)
+
+	// The container got its devices, so the pod is done allocating.
+	got, err := client.KubeClient.CoreV1().Pods("default").Get(ctx, "trainer", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, util.DeviceBindSuccess, got.Annotations[util.DeviceBindPhase])
+}
@@ -0,0 +1,104 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	kubeletdevicepluginv1beta1 "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// ListAndWatchUpdates counts the device lists of ListAndWatch by resource and result: sent, unchanged
+// for a list equal to the one sent before, or coalesced for a change folded into a pending update.
+var ListAndWatchUpdates = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "hami_device_plugin_list_and_watch_updates_total",
+	Help: "Number of device list updates of ListAndWatch, by whether they were sent to the kubelet",
+}, []string{"resource", "result"})
+
+// RegisterMetrics registers the device plugin metrics with reg.
+func RegisterMetrics(reg prometheus.Registerer) {
+	reg.MustRegister(ListAndWatchUpdates, PodGPUEnergy)
+}
+
+// listWatchStream sends the device lists of a ListAndWatch stream. Every list is complete, as the
+// device plugin API requires, but only sent when it differs from the one sent before.
+type listWatchStream struct {
+	resource string
+	send     func(*kubeletdevicepluginv1beta1.ListAndWatchResponse) error
+	// last identifies the list sent before, "" before the first one.
+	last string
+}
+
+// update sends devices unless they equal the list sent before.
+func (s *listWatchStream) update(devices []*kubeletdevicepluginv1beta1.Device) error {
+	key := deviceListKey(devices)
+	if key == s.last {
+		ListAndWatchUpdates.WithLabelValues(s.resource, "unchanged").Inc()
+		return nil
+	}
+	if err := s.send(&kubeletdevicepluginv1beta1.ListAndWatchResponse{Devices: devices}); err != nil {
+		return err
+	}
+	s.last = key
+	ListAndWatchUpdates.WithLabelValues(s.resource, "sent").Inc()
+	return nil
+}
+
+// changed schedules an update ListAndWatchDebounce after the first change, folding the changes
+// until then into it. pending is the update already scheduled, nil if none.
+func (s *listWatchStream) changed(pending <-chan time.Time) <-chan time.Time {
+	if pending != nil {
+		ListAndWatchUpdates.WithLabelValues(s.resource, "coalesced").Inc()
+		return pending
+	}
+	return time.After(ListAndWatchDebounce)
+}
+
+// deviceListKey identifies devices by what the kubelet reads of them: the ID, health and NUMA
+// nodes of every device, in any order.
+func deviceListKey(devices []*kubeletdevicepluginv1beta1.Device) string {
+	entries := make([]string, 0, len(devices))
+	for _, d := range devices {
+		var numa []string
+		for _, n := range d.GetTopology().GetNodes() {
+			numa = append(numa, fmt.Sprint(n.GetID()))
+		}
+		entries = append(entries, d.ID+"/"+d.Health+"/"+strings.Join(numa, ","))
+	}
+	slices.Sort(entries)
+	return fmt.Sprintf("%d:%s", len(entries), strings.Join(entries, ";"))
+}
@@ -0,0 +1,128 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	kubeletdevicepluginv1beta1 "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// listWatchUpdates returns the value of ListAndWatchUpdates for resource and result.
+func listWatchUpdates(t *testing.T, resource, result string) float64 {
+	reg := prometheus.NewRegistry()
+	RegisterMetrics(reg)
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	for _, f := range families {
+		for _, m := range f.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels["resource"] == resource && labels["result"] == result {
+				return m.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+func listWatchDevices(health ...string) []*kubeletdevicepluginv1beta1.Device {
+	devices := make([]*kubeletdevicepluginv1beta1.Device, 0, len(health))
+	for i, h := range health {
+		devices = append(devices, &kubeletdevicepluginv1beta1.Device{
+			ID:       "GPU-" + string(rune('0'+i)),
+			Health:   h,
+			Topology: &kubeletdevicepluginv1beta1.TopologyInfo{Nodes: []*kubeletdevicepluginv1beta1.NUMANode{{ID: int64(i)}}},
+		})
+	}
+	return devices
+}
+
+func TestListWatchStreamUpdate(t *testing.T) {
+	var sent []*kubeletdevicepluginv1beta1.ListAndWatchResponse
+	stream := &listWatchStream{resource: "test/update", send: func(r *kubeletdevicepluginv1beta1.ListAndWatchResponse) error {
+		sent = append(sent, r)
+		return nil
+	}}
+	healthy, unhealthy := kubeletdevicepluginv1beta1.Healthy, kubeletdevicepluginv1beta1.Unhealthy
+
+	require.NoError(t, stream.update(listWatchDevices(healthy, healthy)))
+	// The same devices in another order are not sent again.
+	devices := listWatchDevices(healthy, healthy)
+	devices[0], devices[1] = devices[1], devices[0]
+	require.NoError(t, stream.update(devices))
+	require.Len(t, sent, 1)
+
+	// A health change sends the complete list.
+	require.NoError(t, stream.update(listWatchDevices(healthy, unhealthy)))
+	require.Len(t, sent, 2)
+	require.Len(t, sent[1].Devices, 2)
+	// So does a device going away.
+	require.NoError(t, stream.update(listWatchDevices(healthy)))
+	require.Len(t, sent, 3)
+
+	require.Equal(t, 3.0, listWatchUpdates(t, "test/update", "sent"))
+	require.Equal(t, 1.0, listWatchUpdates(t, "test/update", "unchanged"))
+}
+
+func TestListWatchStreamChanged(t *testing.T) {
+	prev := ListAndWatchDebounce
+	ListAndWatchDebounce = 10 * time.Millisecond
+	defer func() { ListAndWatchDebounce = prev }()
+	stream := &listWatchStream{resource: "test/changed"}
+
+	pending := stream.changed(nil)
+	require.NotNil(t, pending)
+	require.Equal(t, pending, stream.changed(pending))
+	require.Equal(t, pending, stream.changed(pending))
+	select {
+	case <-pending:
+	case <-time.After(time.Second):
+		t.Fatal("the pending update didn't fire")
+	}
+	require.Equal(t, 2.0, listWatchUpdates(t, "test/changed", "coalesced"))
+}
+
+func TestDeviceListKey(t *testing.T) {
+	healthy := kubeletdevicepluginv1beta1.Healthy
+	require.Equal(t, deviceListKey(listWatchDevices(healthy)), deviceListKey(listWatchDevices(healthy)))
+	moved := listWatchDevices(healthy)
+	moved[0].Topology = nil
+	require.NotEqual(t, deviceListKey(listWatchDevices(healthy)), deviceListKey(moved))
+	require.NotEqual(t, deviceListKey(nil), deviceListKey(listWatchDevices(healthy)))
+}
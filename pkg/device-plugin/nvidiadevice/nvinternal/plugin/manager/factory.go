@@ -40,6 +40,7 @@ import (
 	"k8s.io/klog/v2"
 
 	"github.com/Project-HAMi/HAMi/pkg/device-plugin/nvidiadevice/nvinternal/cdi"
+	"github.com/Project-HAMi/HAMi/pkg/device-plugin/nvidiadevice/nvinternal/plugin"
 	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
 )
 
@@ -73,6 +74,14 @@ func New(opts ...Option) (Interface, error) {
 		m.cdiHandler = cdi.NewNullHandler()
 	}
 
+	if plugin.DeviceDiscovery == plugin.DeviceDiscoveryFake {
+		if m.cdiEnabled {
+			klog.Warning("CDI is not supported with fake devices; disabling CDI.")
+			m.cdiEnabled = false
+		}
+		return (*fakemanager)(m), nil
+	}
+
 	mode, err := m.resolveMode()
 	if err != nil {
 		return nil, err
@@ -0,0 +1,70 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package manager
+
+import (
+	"fmt"
+
+	"github.com/Project-HAMi/HAMi/pkg/device-plugin/nvidiadevice/nvinternal/plugin"
+	"github.com/Project-HAMi/HAMi/pkg/device-plugin/nvidiadevice/nvinternal/rm"
+)
+
+type fakemanager manager
+
+// GetPlugins returns the plugins serving the fake devices of plugin.FakeDevices
+func (m *fakemanager) GetPlugins() ([]plugin.Interface, error) {
+	sConfig, mode, err := plugin.LoadNvidiaDevicePluginConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load nvidia plugin config: %v", err)
+	}
+
+	devices, err := rm.LoadFakeDevices(plugin.FakeDevices)
+	if err != nil {
+		return nil, err
+	}
+	rms, err := rm.NewFakeResourceManagers(m.config, devices)
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct fake resource managers: %v", err)
+	}
+
+	var plugins []plugin.Interface
+	for _, r := range rms {
+		plugins = append(plugins, plugin.NewNvidiaDevicePlugin(m.config, r, m.cdiHandler, m.cdiEnabled, sConfig, mode))
+	}
+	return plugins, nil
+}
+
+// CreateCDISpecFile is a no-op for the fake plugin
+func (m *fakemanager) CreateCDISpecFile() error {
+	return nil
+}
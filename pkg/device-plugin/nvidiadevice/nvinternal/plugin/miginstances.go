@@ -0,0 +1,121 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/device-plugin/nvidiadevice/nvinternal/mig"
+)
+
+// migCapabilitiesPath is where the driver lists the capabilities of MIG instances.
+const migCapabilitiesPath = "/proc/driver/nvidia/capabilities"
+
+// migInstanceDevicePaths returns the device nodes a container needs for the MIG instance gi/ci
+// of the card with minor: the card itself, and the capabilities granting access to the GPU
+// and the compute instance, looked up in caps as returned by mig.GetMigCapabilityDevicePaths.
+func migInstanceDevicePaths(minor, gi, ci int, caps map[string]string) ([]string, error) {
+	giCap := fmt.Sprintf("%s/gpu%d/mig/gi%d/access", migCapabilitiesPath, minor, gi)
+	ciCap := fmt.Sprintf("%s/gpu%d/mig/gi%d/ci%d/access", migCapabilitiesPath, minor, gi, ci)
+	paths := []string{fmt.Sprintf("/dev/nvidia%d", minor)}
+	for _, c := range []string{giCap, ciCap} {
+		p, ok := caps[c]
+		if !ok {
+			return nil, fmt.Errorf("missing MIG capability %s", c)
+		}
+		paths = append(paths, p)
+	}
+	return paths, nil
+}
+
+// migDevicePaths returns the device nodes of the MIG instances among ids, which the resource
+// manager doesn't know as the instances are created on allocation. Nodes shared by instances
+// of the same card are listed once.
+func migDevicePaths(ids []string, known func(...string) bool) []string {
+	var caps map[string]string
+	seen := make(map[string]bool)
+	res := make([]string, 0)
+	for _, id := range ids {
+		if !strings.HasPrefix(id, "MIG-") || known(id) {
+			continue
+		}
+		if caps == nil {
+			var err error
+			if caps, err = mig.GetMigCapabilityDevicePaths(); err != nil {
+				klog.Errorf("Failed to get MIG capability device paths: %v", err)
+				return res
+			}
+		}
+		paths, err := migInstancePaths(id, caps)
+		if err != nil {
+			klog.Errorf("Failed to get device paths of MIG instance %s: %v", id, err)
+			continue
+		}
+		for _, p := range paths {
+			if !seen[p] {
+				seen[p] = true
+				res = append(res, p)
+			}
+		}
+	}
+	return res
+}
+
+// migInstancePaths returns the device nodes of the MIG instance with uuid.
+func migInstancePaths(uuid string, caps map[string]string) ([]string, error) {
+	dev, ret := nvml.DeviceGetHandleByUUID(uuid)
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("error getting MIG device: %v", nvml.ErrorString(ret))
+	}
+	gi, ret := dev.GetGpuInstanceId()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("error getting GPU instance ID: %v", nvml.ErrorString(ret))
+	}
+	ci, ret := dev.GetComputeInstanceId()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("error getting compute instance ID: %v", nvml.ErrorString(ret))
+	}
+	parent, ret := dev.GetDeviceHandleFromMigDeviceHandle()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("error getting parent device: %v", nvml.ErrorString(ret))
+	}
+	minor, ret := parent.GetMinorNumber()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("error getting GPU device minor number: %v", nvml.ErrorString(ret))
+	}
+	return migInstanceDevicePaths(minor, gi, ci, caps)
+}
@@ -0,0 +1,57 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigInstanceDevicePaths(t *testing.T) {
+	caps := map[string]string{
+		"/proc/driver/nvidia/capabilities/gpu1/mig/gi2/access":     "/dev/nvidia-caps/nvidia-cap30",
+		"/proc/driver/nvidia/capabilities/gpu1/mig/gi2/ci0/access": "/dev/nvidia-caps/nvidia-cap31",
+	}
+	paths, err := migInstanceDevicePaths(1, 2, 0, caps)
+	require.NoError(t, err)
+	require.Equal(t, []string{"/dev/nvidia1", "/dev/nvidia-caps/nvidia-cap30", "/dev/nvidia-caps/nvidia-cap31"}, paths)
+
+	_, err = migInstanceDevicePaths(1, 3, 0, caps)
+	require.ErrorContains(t, err, "gpu1/mig/gi3/access")
+}
+
+func TestMigDevicePathsSkipsKnownDevices(t *testing.T) {
+	known := func(ids ...string) bool { return ids[0] == "MIG-known" }
+	require.Empty(t, migDevicePaths([]string{"GPU-0", "MIG-known"}, known))
+}
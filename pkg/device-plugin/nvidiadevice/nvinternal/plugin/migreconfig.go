@@ -0,0 +1,565 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	nvdevice "github.com/NVIDIA/go-nvlib/pkg/nvlib/device"
+	nvlibnvml "github.com/NVIDIA/go-nvlib/pkg/nvml"
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+	"github.com/Project-HAMi/HAMi/pkg/util/client"
+)
+
+const (
+	// migDrainSettle is how long a card is withdrawn before it's re-partitioned, so the scheduler
+	// stops placing pods on it and the pods it placed meanwhile show up in the annotations.
+	migDrainSettle = 30 * time.Second
+
+	// EventReasonMigReconfigured is recorded on the node after a card was re-partitioned.
+	EventReasonMigReconfigured = "MigReconfigured"
+	// EventReasonMigReconfigFailed is recorded on the node when re-partitioning a card failed.
+	EventReasonMigReconfigFailed = "MigReconfigFailed"
+)
+
+// migReconfigurer re-partitions idle cards in mig mode into the geometry serving the most pods
+// the scheduler couldn't place. It only touches a card nobody uses, on a node labeled with
+// util.MigReconfigNodeLabel, and withdraws the card while doing so. A nil *migReconfigurer
+// does nothing.
+type migReconfigurer struct {
+	interval time.Duration
+	settle   time.Duration
+
+	mutex    sync.Mutex
+	draining map[string]bool
+	events   record.EventRecorder
+}
+
+// newMigReconfigurer returns a reconfigurer checking the pending pods every interval, or nil if not enabled.
+func newMigReconfigurer(enabled bool, interval time.Duration) *migReconfigurer {
+	if !enabled || interval <= 0 {
+		return nil
+	}
+	return &migReconfigurer{
+		interval: interval,
+		settle:   migDrainSettle,
+		draining: make(map[string]bool),
+	}
+}
+
+// isDraining reports whether card is withdrawn to be re-partitioned.
+func (r *migReconfigurer) isDraining(card string) bool {
+	if r == nil {
+		return false
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.draining[cardID(card)]
+}
+
+func (r *migReconfigurer) setDraining(card string, draining bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if draining {
+		r.draining[card] = true
+	} else {
+		delete(r.draining, card)
+	}
+}
+
+func (r *migReconfigurer) recorder() record.EventRecorder {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.events == nil {
+		r.events = newNodeEventRecorder()
+	}
+	return r.events
+}
+
+// migDemand is what a pending container needs of one card.
+type migDemand struct {
+	memreq     int64
+	percentage int32
+}
+
+// bytes returns the memory the demand needs on a card of totalmem bytes.
+func (d migDemand) bytes(totalmem int64) int64 {
+	if d.memreq > 0 {
+		return d.memreq
+	}
+	return totalmem * int64(d.percentage) / 100
+}
+
+// unschedulable reports whether the scheduler tried and failed to place pod.
+func unschedulable(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodScheduled && c.Status == corev1.ConditionFalse && c.Reason == corev1.PodReasonUnschedulable {
+			return true
+		}
+	}
+	return false
+}
+
+// pendingMigDemand collects the NVIDIA cards wanted by the unschedulable pods, one entry per card.
+// Pods asking for another operating mode than mig or for specific cards are left out.
+func pendingMigDemand(pods []corev1.Pod) []migDemand {
+	dev, ok := device.GetDevices()[nvidia.NvidiaGPUDevice]
+	if !ok {
+		return nil
+	}
+	res := make([]migDemand, 0)
+	for i := range pods {
+		p := &pods[i]
+		if p.Spec.NodeName != "" || p.Status.Phase != corev1.PodPending || !unschedulable(p) {
+			continue
+		}
+		if mode, ok := p.Annotations[nvidia.AllocateMode]; ok && mode != "mig" {
+			continue
+		}
+		if _, ok := p.Annotations[nvidia.GPUUseUUID]; ok {
+			continue
+		}
+		for j := range p.Spec.Containers {
+			req := dev.GenerateResourceRequests(&p.Spec.Containers[j])
+			for n := int32(0); n < req.Nums; n++ {
+				res = append(res, migDemand{memreq: req.Memreq, percentage: req.MemPercentagereq})
+			}
+		}
+	}
+	return res
+}
+
+// migServed returns how many of the demands geometry can hold on a card of totalmem bytes,
+// giving every demand, largest first, the smallest instance it fits in.
+func migServed(geometry util.Geometry, demands []migDemand, totalmem int64) int {
+	free := make([]int64, 0)
+	for _, t := range geometry {
+		for n := int32(0); n < t.Count; n++ {
+			free = append(free, util.MemoryToBytes(nvidia.NvidiaGPUDevice, int64(t.Memory)))
+		}
+	}
+	slices.Sort(free)
+	wanted := make([]int64, 0, len(demands))
+	for _, d := range demands {
+		wanted = append(wanted, d.bytes(totalmem))
+	}
+	sort.Slice(wanted, func(i, j int) bool { return wanted[i] > wanted[j] })
+	served := 0
+	for _, w := range wanted {
+		for i, f := range free {
+			if f >= w {
+				free = slices.Delete(free, i, i+1)
+				served++
+				break
+			}
+		}
+	}
+	return served
+}
+
+// chooseMigGeometry returns the index of the geometry holding the most demands and how many it
+// holds, preferring earlier geometries on a tie. It returns -1 if none holds any.
+func chooseMigGeometry(geometries []util.Geometry, demands []migDemand, totalmem int64) (int, int) {
+	best, bestServed := -1, 0
+	for i, g := range geometries {
+		if served := migServed(g, demands, totalmem); served > bestServed {
+			best, bestServed = i, served
+		}
+	}
+	return best, bestServed
+}
+
+// migGeometries returns the known geometries of the card model, the same list GenerateMigTemplate
+// resolves the template index of a scheduled MIG instance in.
+func (plugin *NvidiaDevicePlugin) migGeometries(model string) []util.Geometry {
+	for _, m := range plugin.schedulerConfig.MigGeometriesList {
+		if containsModel(model, m.Models) {
+			return m.Geometries
+		}
+	}
+	return nil
+}
+
+// currentMigGeometry returns the index of the known geometry the card with index idx is
+// partitioned with, or nil if the card isn't partitioned with one of them.
+func (plugin *NvidiaDevicePlugin) currentMigGeometry(model string, idx int) *int {
+	plugin.migMutex.Lock()
+	defer plugin.migMutex.Unlock()
+	for _, c := range plugin.migCurrent.MigConfigs["current"] {
+		if !containsDevice(idx, c.Devices) {
+			continue
+		}
+		if !c.MigEnabled {
+			return nil
+		}
+		for i, g := range plugin.migGeometries(model) {
+			if maps.Equal(geometryCounts(g), c.MigDevices) {
+				return &i
+			}
+		}
+		return nil
+	}
+	return nil
+}
+
+func geometryCounts(g util.Geometry) map[string]int32 {
+	counts := make(map[string]int32, len(g))
+	for _, t := range g {
+		counts[t.Name] += t.Count
+	}
+	return counts
+}
+
+// setMigCurrent records that the card with index idx is partitioned into counts, splitting it
+// off the entry it shared with other cards, so GenerateMigTemplate doesn't re-partition it again.
+func (plugin *NvidiaDevicePlugin) setMigCurrent(idx int, counts map[string]int32) {
+	plugin.migMutex.Lock()
+	defer plugin.migMutex.Unlock()
+	if plugin.migCurrent.MigConfigs == nil {
+		plugin.migCurrent.MigConfigs = make(map[string]nvidia.MigConfigSpecSlice)
+	}
+	current := make(nvidia.MigConfigSpecSlice, 0, len(plugin.migCurrent.MigConfigs["current"])+1)
+	for _, c := range plugin.migCurrent.MigConfigs["current"] {
+		c.Devices = slices.DeleteFunc(slices.Clone(c.Devices), func(d int32) bool { return int(d) == idx })
+		if len(c.Devices) > 0 {
+			current = append(current, c)
+		}
+	}
+	current = append(current, nvidia.MigConfigSpec{
+		Devices:    []int32{int32(idx)},
+		MigEnabled: true,
+		MigDevices: counts,
+	})
+	plugin.migCurrent.MigConfigs["current"] = current
+}
+
+// cardBusy reports whether any pod holds or is being given card.
+func cardBusy(pods []corev1.Pod, card string) bool {
+	for i := range pods {
+		p := &pods[i]
+		if p.Status.Phase == corev1.PodSucceeded || p.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		if podUsesCard(p, card) {
+			return true
+		}
+	}
+	return false
+}
+
+// nodePods lists the pods holding devices of the node: the ones bound to it and the ones the
+// scheduler assigned to it but didn't bind yet.
+func nodePods(ctx context.Context) ([]corev1.Pod, error) {
+	bound, err := client.GetClient().CoreV1().Pods("").List(ctx, metav1.ListOptions{
+		FieldSelector: fmt.Sprintf("spec.nodeName=%s", util.NodeName),
+	})
+	if err != nil {
+		return nil, err
+	}
+	pending, err := client.GetClient().CoreV1().Pods("").List(ctx, metav1.ListOptions{
+		FieldSelector: "spec.nodeName=,status.phase=Pending",
+	})
+	if err != nil {
+		return nil, err
+	}
+	pods := bound.Items
+	for _, p := range pending.Items {
+		if p.Annotations[util.AssignedNodeAnnotations] == util.NodeName {
+			pods = append(pods, p)
+		}
+	}
+	return pods, nil
+}
+
+// WatchMigDemand re-partitions an idle card for the unschedulable pods every interval until stop is closed.
+func (plugin *NvidiaDevicePlugin) WatchMigDemand(stop <-chan any) {
+	r := plugin.migReconfig
+	klog.Infof("Starting MIG reconfigurer, checking pending pods every %v", r.interval)
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		if err := plugin.reconfigureMig(context.Background(), stop); err != nil {
+			klog.Errorf("MIG reconfigurer: %v", err)
+		}
+	}
+}
+
+// migCard is a card of the node the reconfigurer may re-partition.
+type migCard struct {
+	uuid     string
+	index    int
+	model    string
+	totalmem int64
+}
+
+// reconfigureMig re-partitions at most one idle card into the geometry serving the most
+// unschedulable pods, if that serves more of them than its current geometry.
+func (plugin *NvidiaDevicePlugin) reconfigureMig(ctx context.Context, stop <-chan any) error {
+	node, err := client.GetClient().CoreV1().Nodes().Get(ctx, util.NodeName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if node.Labels[util.MigReconfigNodeLabel] != util.MigReconfigAllowed {
+		klog.V(4).Infof("MIG reconfigurer: node %s isn't labeled %s=%s, skipping", util.NodeName, util.MigReconfigNodeLabel, util.MigReconfigAllowed)
+		return nil
+	}
+	pending, err := client.GetClient().CoreV1().Pods("").List(ctx, metav1.ListOptions{
+		FieldSelector: "spec.nodeName=,status.phase=Pending",
+	})
+	if err != nil {
+		return err
+	}
+	demands := pendingMigDemand(pending.Items)
+	if len(demands) == 0 {
+		return nil
+	}
+	pods, err := nodePods(ctx)
+	if err != nil {
+		return err
+	}
+	cards, err := migCards()
+	if err != nil {
+		return err
+	}
+	for _, card := range cards {
+		geometries := plugin.migGeometries(card.model)
+		if len(geometries) == 0 || cardBusy(pods, card.uuid) || plugin.quarantine.quarantined(card.uuid) {
+			continue
+		}
+		best, served := chooseMigGeometry(geometries, demands, card.totalmem)
+		current := plugin.currentMigGeometry(card.model, card.index)
+		if best < 0 || (current != nil && (*current == best || migServed(geometries[*current], demands, card.totalmem) >= served)) {
+			continue
+		}
+		klog.Infof("MIG reconfigurer: geometry %d of %s serves %d of %d pending card request(s), re-partitioning idle device %s", best, card.model, served, len(demands), card.uuid)
+		return plugin.repartition(ctx, node, card, best, geometries[best], stop)
+	}
+	return nil
+}
+
+// repartition withdraws card, waits for the scheduler to notice, checks the card is still idle
+// and re-partitions it into the geometry with index idx.
+func (plugin *NvidiaDevicePlugin) repartition(ctx context.Context, node *corev1.Node, card migCard, idx int, geometry util.Geometry, stop <-chan any) error {
+	r := plugin.migReconfig
+	r.setDraining(card.uuid, true)
+	defer func() {
+		r.setDraining(card.uuid, false)
+		if err := plugin.RegistrInAnnotation(); err != nil {
+			klog.Errorf("MIG reconfigurer: failed to re-register device %s: %v", card.uuid, err)
+		}
+	}()
+	if err := plugin.RegistrInAnnotation(); err != nil {
+		return fmt.Errorf("failed to withdraw device %s: %v", card.uuid, err)
+	}
+	select {
+	case <-stop:
+		return nil
+	case <-time.After(r.settle):
+	}
+	pods, err := nodePods(ctx)
+	if err != nil {
+		return err
+	}
+	if cardBusy(pods, card.uuid) {
+		klog.Infof("MIG reconfigurer: device %s got a pod while being withdrawn, leaving it alone", card.uuid)
+		return nil
+	}
+	counts, err := applyMigGeometry(card.uuid, geometry)
+	if err != nil {
+		r.recorder().Eventf(node, corev1.EventTypeWarning, EventReasonMigReconfigFailed, "Failed to re-partition device %s into geometry %d: %v", card.uuid, idx, err)
+		return fmt.Errorf("failed to re-partition device %s: %v", card.uuid, err)
+	}
+	plugin.setMigCurrent(card.index, counts)
+	if !maps.Equal(counts, geometryCounts(geometry)) {
+		r.recorder().Eventf(node, corev1.EventTypeWarning, EventReasonMigReconfigFailed, "Device %s is partitioned into %v instead of geometry %d", card.uuid, counts, idx)
+		return fmt.Errorf("device %s is partitioned into %v instead of %v", card.uuid, counts, geometryCounts(geometry))
+	}
+	klog.Infof("MIG reconfigurer: device %s re-partitioned into %v", card.uuid, counts)
+	r.recorder().Eventf(node, corev1.EventTypeNormal, EventReasonMigReconfigured, "Re-partitioned idle device %s into geometry %d %v for pending pods", card.uuid, idx, counts)
+	return nil
+}
+
+// migCards lists the MIG enabled cards of the node.
+func migCards() ([]migCard, error) {
+	if err := initNVML(); err != nil {
+		return nil, err
+	}
+	count, ret := nvml.DeviceGetCount()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("nvml get count failed: %s", nvml.ErrorString(ret))
+	}
+	cards := make([]migCard, 0, count)
+	for i := 0; i < count; i++ {
+		ndev, ret := nvml.DeviceGetHandleByIndex(i)
+		if ret != nvml.SUCCESS {
+			continue
+		}
+		if mode, _, ret := ndev.GetMigMode(); ret != nvml.SUCCESS || mode != nvml.DEVICE_MIG_ENABLE {
+			continue
+		}
+		uuid, ret := ndev.GetUUID()
+		if ret != nvml.SUCCESS {
+			continue
+		}
+		model, ret := ndev.GetName()
+		if ret != nvml.SUCCESS {
+			continue
+		}
+		memory, ret := ndev.GetMemoryInfo()
+		if ret != nvml.SUCCESS {
+			continue
+		}
+		cards = append(cards, migCard{uuid: uuid, index: i, model: model, totalmem: int64(memory.Total)})
+	}
+	return cards, nil
+}
+
+// applyMigGeometry destroys all compute and GPU instances of the card uuid and creates the
+// instances of geometry in its order, which is how the scheduler numbers them. It returns the
+// instances found on the card afterwards, by profile name.
+func applyMigGeometry(uuid string, geometry util.Geometry) (map[string]int32, error) {
+	ndev, ret := nvml.DeviceGetHandleByUUID(uuid)
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("nvml get device failed: %s", nvml.ErrorString(ret))
+	}
+	lib := nvlibnvml.New()
+	if ret := lib.Init(); ret != nvlibnvml.SUCCESS {
+		return nil, fmt.Errorf("nvml init failed: %s", lib.ErrorString(ret))
+	}
+	defer lib.Shutdown()
+	dev, err := nvdevice.New(nvdevice.WithNvml(lib)).NewDeviceByUUID(uuid)
+	if err != nil {
+		return nil, err
+	}
+	profiles, err := dev.GetMigProfiles()
+	if err != nil {
+		return nil, err
+	}
+	if err := destroyMigInstances(ndev); err != nil {
+		return nil, err
+	}
+	for _, t := range geometry {
+		var profile nvdevice.MigProfile
+		for _, p := range profiles {
+			if p.Matches(t.Name) {
+				profile = p
+				break
+			}
+		}
+		if profile == nil {
+			return nil, fmt.Errorf("device doesn't support MIG profile %s", t.Name)
+		}
+		info := profile.GetInfo()
+		giInfo, ret := ndev.GetGpuInstanceProfileInfo(info.GIProfileID)
+		if ret != nvml.SUCCESS {
+			return nil, fmt.Errorf("failed to get GPU instance profile of %s: %s", t.Name, nvml.ErrorString(ret))
+		}
+		for n := int32(0); n < t.Count; n++ {
+			gi, ret := ndev.CreateGpuInstance(&giInfo)
+			if ret != nvml.SUCCESS {
+				return nil, fmt.Errorf("failed to create GPU instance %s: %s", t.Name, nvml.ErrorString(ret))
+			}
+			ciInfo, ret := gi.GetComputeInstanceProfileInfo(info.CIProfileID, info.CIEngProfileID)
+			if ret != nvml.SUCCESS {
+				return nil, fmt.Errorf("failed to get compute instance profile of %s: %s", t.Name, nvml.ErrorString(ret))
+			}
+			if _, ret := gi.CreateComputeInstance(&ciInfo); ret != nvml.SUCCESS {
+				return nil, fmt.Errorf("failed to create compute instance %s: %s", t.Name, nvml.ErrorString(ret))
+			}
+		}
+	}
+	counts := make(map[string]int32)
+	err = dev.VisitMigDevices(func(_ int, m nvdevice.MigDevice) error {
+		p, err := m.GetProfile()
+		if err != nil {
+			return err
+		}
+		counts[p.String()]++
+		return nil
+	})
+	return counts, err
+}
+
+// destroyMigInstances destroys the compute instances and then the GPU instances of ndev.
+func destroyMigInstances(ndev nvml.Device) error {
+	for p := 0; p < nvml.GPU_INSTANCE_PROFILE_COUNT; p++ {
+		giInfo, ret := ndev.GetGpuInstanceProfileInfo(p)
+		if ret != nvml.SUCCESS {
+			continue
+		}
+		gis, ret := ndev.GetGpuInstances(&giInfo)
+		if ret != nvml.SUCCESS {
+			continue
+		}
+		for _, gi := range gis {
+			for c := 0; c < nvml.COMPUTE_INSTANCE_PROFILE_COUNT; c++ {
+				ciInfo, ret := gi.GetComputeInstanceProfileInfo(c, nvml.COMPUTE_INSTANCE_ENGINE_PROFILE_SHARED)
+				if ret != nvml.SUCCESS {
+					continue
+				}
+				cis, ret := gi.GetComputeInstances(&ciInfo)
+				if ret != nvml.SUCCESS {
+					continue
+				}
+				for _, ci := range cis {
+					if ret := ci.Destroy(); ret != nvml.SUCCESS {
+						return fmt.Errorf("failed to destroy compute instance: %s", nvml.ErrorString(ret))
+					}
+				}
+			}
+			if ret := gi.Destroy(); ret != nvml.SUCCESS {
+				return fmt.Errorf("failed to destroy GPU instance: %s", nvml.ErrorString(ret))
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+var testMigGeometries = []util.Geometry{
+	{{Name: "1g.10gb", Memory: 10240, Count: 7}},
+	{{Name: "3g.40gb", Memory: 40960, Count: 2}},
+	{{Name: "7g.80gb", Memory: 81920, Count: 1}},
+}
+
+func pendingGPUPod(name string, cards, memory int64, annos map[string]string) corev1.Pod {
+	return corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Annotations: annos},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name: "main",
+				Resources: corev1.ResourceRequirements{
+					Limits: corev1.ResourceList{
+						"nvidia.com/gpu":    *resource.NewQuantity(cards, resource.DecimalSI),
+						"nvidia.com/gpumem": *resource.NewQuantity(memory, resource.DecimalSI),
+					},
+				},
+			}},
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodPending,
+			Conditions: []corev1.PodCondition{{
+				Type:   corev1.PodScheduled,
+				Status: corev1.ConditionFalse,
+				Reason: corev1.PodReasonUnschedulable,
+			}},
+		},
+	}
+}
+
+func TestPendingMigDemand(t *testing.T) {
+	device.InitDefaultDevices()
+	waiting := pendingGPUPod("waiting", 1, 1000, nil)
+	waiting.Status.Conditions = nil
+	bound := pendingGPUPod("bound", 1, 1000, nil)
+	bound.Spec.NodeName = "node1"
+	pods := []corev1.Pod{
+		pendingGPUPod("two-cards", 2, 30000, nil),
+		pendingGPUPod("mig", 1, 5000, map[string]string{nvidia.AllocateMode: "mig"}),
+		pendingGPUPod("hami-core", 1, 5000, map[string]string{nvidia.AllocateMode: "hami-core"}),
+		pendingGPUPod("pinned", 1, 5000, map[string]string{nvidia.GPUUseUUID: "GPU-0"}),
+		waiting,
+		bound,
+	}
+	demands := pendingMigDemand(pods)
+	require.Len(t, demands, 3)
+	require.Equal(t, util.MemoryToBytes(nvidia.NvidiaGPUDevice, 30000), demands[0].memreq)
+	require.Equal(t, util.MemoryToBytes(nvidia.NvidiaGPUDevice, 5000), demands[2].memreq)
+
+	require.Equal(t, int64(500), migDemand{percentage: 50}.bytes(1000))
+}
+
+func TestChooseMigGeometry(t *testing.T) {
+	gib := func(n int64) migDemand { return migDemand{memreq: n << 30} }
+	totalmem := int64(80 << 30)
+
+	best, served := chooseMigGeometry(testMigGeometries, []migDemand{gib(30), gib(30), gib(5)}, totalmem)
+	require.Equal(t, 1, best)
+	require.Equal(t, 2, served)
+
+	best, served = chooseMigGeometry(testMigGeometries, []migDemand{gib(5), gib(5)}, totalmem)
+	require.Equal(t, 0, best)
+	require.Equal(t, 2, served)
+
+	// A whole card request only fits the single instance geometry.
+	best, served = chooseMigGeometry(testMigGeometries, []migDemand{{percentage: 100}}, totalmem)
+	require.Equal(t, 2, best)
+	require.Equal(t, 1, served)
+
+	best, _ = chooseMigGeometry(testMigGeometries, []migDemand{gib(100)}, totalmem)
+	require.Equal(t, -1, best)
+}
+
+func TestMigCurrent(t *testing.T) {
+	plugin := &NvidiaDevicePlugin{
+		schedulerConfig: nvidia.NvidiaConfig{
+			MigGeometriesList: []util.AllowedMigGeometries{{Models: []string{"A100"}, Geometries: testMigGeometries}},
+		},
+		migCurrent: nvidia.MigPartedSpec{MigConfigs: map[string]nvidia.MigConfigSpecSlice{
+			"current": {{Devices: []int32{0, 1}, MigEnabled: true, MigDevices: map[string]int32{"1g.10gb": 7}}},
+		}},
+	}
+	require.Equal(t, 0, *plugin.currentMigGeometry("NVIDIA A100-SXM4-80GB", 1))
+	require.Nil(t, plugin.currentMigGeometry("NVIDIA H100", 1))
+	require.Nil(t, plugin.currentMigGeometry("NVIDIA A100-SXM4-80GB", 2))
+
+	plugin.setMigCurrent(1, map[string]int32{"3g.40gb": 2})
+	require.Equal(t, 0, *plugin.currentMigGeometry("NVIDIA A100-SXM4-80GB", 0))
+	require.Equal(t, 1, *plugin.currentMigGeometry("NVIDIA A100-SXM4-80GB", 1))
+	require.Len(t, plugin.migCurrent.MigConfigs["current"], 2)
+
+	// An unknown layout isn't reported as one of the geometries.
+	plugin.setMigCurrent(0, map[string]int32{"1g.10gb": 3, "3g.40gb": 1})
+	require.Nil(t, plugin.currentMigGeometry("NVIDIA A100-SXM4-80GB", 0))
+	require.Len(t, plugin.migCurrent.MigConfigs["current"], 2)
+}
+
+func TestCardBusy(t *testing.T) {
+	running := *coTenantPod("running", "GPU-0", corev1.PodRunning)
+	done := *coTenantPod("done", "GPU-1", corev1.PodSucceeded)
+	mig := *coTenantPod("mig", "GPU-2[1-0]", corev1.PodPending)
+	pods := []corev1.Pod{running, done, mig}
+	require.True(t, cardBusy(pods, "GPU-0"))
+	require.False(t, cardBusy(pods, "GPU-1"))
+	require.True(t, cardBusy(pods, "GPU-2"))
+	require.False(t, cardBusy(pods, "GPU-3"))
+}
+
+func TestMigReconfigurerDraining(t *testing.T) {
+	require.Nil(t, newMigReconfigurer(false, time.Minute))
+	var disabled *migReconfigurer
+	require.False(t, disabled.isDraining("GPU-0"))
+
+	r := newMigReconfigurer(true, time.Minute)
+	r.setDraining("GPU-0", true)
+	require.True(t, r.isDraining("GPU-0[1-2]"))
+	r.setDraining("GPU-0", false)
+	require.False(t, r.isDraining("GPU-0"))
+}
@@ -0,0 +1,148 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// ncclEnvNames are the NCCL variables set for pods annotated with hami.io/nccl-topology. A
+// container setting any of them itself is left alone.
+var ncclEnvNames = []string{"NCCL_P2P_LEVEL", "NCCL_P2P_DISABLE", "NCCL_TOPO_FILE"}
+
+// gpuPath is how two GPUs reach each other.
+type gpuPath struct {
+	nvlink bool
+	level  nvml.GpuTopologyLevel
+}
+
+type gpuPathProbe func(a, b string) (gpuPath, error)
+
+func nvmlGPUPathProbe(a, b string) (gpuPath, error) {
+	da, ret := nvml.DeviceGetHandleByUUID(a)
+	if ret != nvml.SUCCESS {
+		return gpuPath{}, fmt.Errorf("failed to get device %s: %v", a, nvml.ErrorString(ret))
+	}
+	db, ret := nvml.DeviceGetHandleByUUID(b)
+	if ret != nvml.SUCCESS {
+		return gpuPath{}, fmt.Errorf("failed to get device %s: %v", b, nvml.ErrorString(ret))
+	}
+	level, ret := da.GetTopologyCommonAncestor(db)
+	if ret != nvml.SUCCESS {
+		return gpuPath{}, fmt.Errorf("failed to get the common ancestor of %s and %s: %v", a, b, nvml.ErrorString(ret))
+	}
+	status, ret := da.GetP2PStatus(db, nvml.P2P_CAPS_INDEX_NVLINK)
+	return gpuPath{nvlink: ret == nvml.SUCCESS && status == nvml.P2P_STATUS_OK, level: level}, nil
+}
+
+// ncclTopologyEnvs returns the NCCL variables for a container using the GPUs uuids, from the
+// slowest path between any two of them: peer to peer over NVLink if all of them are linked,
+// over PCIe up to the common ancestor of the slowest pair otherwise, and no peer to peer at
+// all across CPU sockets. A single GPU gets none.
+func ncclTopologyEnvs(uuids []string, probe gpuPathProbe) (map[string]string, error) {
+	if len(uuids) < 2 {
+		return nil, nil
+	}
+	nvlink := true
+	worst := nvml.TOPOLOGY_INTERNAL
+	for i := range uuids {
+		for j := i + 1; j < len(uuids); j++ {
+			path, err := probe(uuids[i], uuids[j])
+			if err != nil {
+				return nil, err
+			}
+			nvlink = nvlink && path.nvlink
+			worst = max(worst, path.level)
+		}
+	}
+	if nvlink {
+		return map[string]string{"NCCL_P2P_LEVEL": "NVL"}, nil
+	}
+	switch worst {
+	case nvml.TOPOLOGY_INTERNAL, nvml.TOPOLOGY_SINGLE:
+		return map[string]string{"NCCL_P2P_LEVEL": "PIX"}, nil
+	case nvml.TOPOLOGY_MULTIPLE:
+		return map[string]string{"NCCL_P2P_LEVEL": "PXB"}, nil
+	case nvml.TOPOLOGY_HOSTBRIDGE, nvml.TOPOLOGY_NODE:
+		return map[string]string{"NCCL_P2P_LEVEL": "PHB"}, nil
+	}
+	return map[string]string{"NCCL_P2P_DISABLE": "1"}, nil
+}
+
+// wantsNCCLTopology reports whether the NCCL variables are set for ctr of pod: the pod opted
+// in and the container sets none of them itself.
+func wantsNCCLTopology(pod *corev1.Pod, ctr corev1.Container) bool {
+	if pod.Annotations[util.NCCLTopology] != "true" {
+		return false
+	}
+	for _, env := range ctr.Env {
+		if slices.Contains(ncclEnvNames, env.Name) {
+			return false
+		}
+	}
+	return true
+}
+
+// ncclTopologyEnvs returns the NCCL variables for the devices devreq, none if their topology
+// can't be read.
+func (plugin *NvidiaDevicePlugin) ncclTopologyEnvs(devreq util.ContainerDevices) map[string]string {
+	uuids := make([]string, 0, len(devreq))
+	for _, dev := range devreq {
+		uuids = append(uuids, strings.Split(dev.UUID, "[")[0])
+	}
+	if len(uuids) < 2 {
+		return nil
+	}
+	if err := initNVML(); err != nil {
+		if !errors.Is(err, errNoNVML) {
+			klog.Errorln(err)
+		}
+		return nil
+	}
+	defer nvml.Shutdown()
+	envs, err := ncclTopologyEnvs(uuids, nvmlGPUPathProbe)
+	if err != nil {
+		klog.ErrorS(err, "Failed to read the topology of the allocated devices, NCCL variables not set", "devices", uuids)
+		return nil
+	}
+	return envs
+}
@@ -0,0 +1,99 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func TestNCCLTopologyEnvs(t *testing.T) {
+	// paths are keyed by the pair of GPUs, a pair not listed is linked by NVLink on the same board.
+	probe := func(paths map[string]gpuPath) gpuPathProbe {
+		return func(a, b string) (gpuPath, error) {
+			if path, ok := paths[a+"/"+b]; ok {
+				return path, nil
+			}
+			return gpuPath{nvlink: true, level: nvml.TOPOLOGY_INTERNAL}, nil
+		}
+	}
+	envs := func(paths map[string]gpuPath, uuids ...string) map[string]string {
+		e, err := ncclTopologyEnvs(uuids, probe(paths))
+		require.NoError(t, err)
+		return e
+	}
+
+	require.Nil(t, envs(nil, "GPU-0"))
+	require.Equal(t, map[string]string{"NCCL_P2P_LEVEL": "NVL"}, envs(map[string]gpuPath{
+		"GPU-0/GPU-1": {nvlink: true, level: nvml.TOPOLOGY_SYSTEM},
+	}, "GPU-0", "GPU-1", "GPU-2"))
+	require.Equal(t, map[string]string{"NCCL_P2P_LEVEL": "PIX"}, envs(map[string]gpuPath{
+		"GPU-0/GPU-1": {level: nvml.TOPOLOGY_SINGLE},
+	}, "GPU-0", "GPU-1"))
+	require.Equal(t, map[string]string{"NCCL_P2P_LEVEL": "PXB"}, envs(map[string]gpuPath{
+		"GPU-0/GPU-2": {level: nvml.TOPOLOGY_SINGLE},
+		"GPU-1/GPU-2": {level: nvml.TOPOLOGY_MULTIPLE},
+	}, "GPU-0", "GPU-1", "GPU-2"))
+	require.Equal(t, map[string]string{"NCCL_P2P_LEVEL": "PHB"}, envs(map[string]gpuPath{
+		"GPU-0/GPU-1": {level: nvml.TOPOLOGY_NODE},
+	}, "GPU-0", "GPU-1"))
+	require.Equal(t, map[string]string{"NCCL_P2P_DISABLE": "1"}, envs(map[string]gpuPath{
+		"GPU-0/GPU-1": {level: nvml.TOPOLOGY_SINGLE},
+		"GPU-1/GPU-2": {level: nvml.TOPOLOGY_SYSTEM},
+	}, "GPU-0", "GPU-1", "GPU-2"))
+
+	_, err := ncclTopologyEnvs([]string{"GPU-0", "GPU-1"}, func(a, b string) (gpuPath, error) {
+		return gpuPath{}, errors.New("lost")
+	})
+	require.Error(t, err)
+}
+
+func TestWantsNCCLTopology(t *testing.T) {
+	pod := func(v string) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{util.NCCLTopology: v}}}
+	}
+	ctr := corev1.Container{Env: []corev1.EnvVar{{Name: "NCCL_DEBUG", Value: "INFO"}}}
+	require.True(t, wantsNCCLTopology(pod("true"), ctr))
+	require.False(t, wantsNCCLTopology(pod("false"), ctr))
+	require.False(t, wantsNCCLTopology(&corev1.Pod{}, ctr))
+
+	ctr.Env = append(ctr.Env, corev1.EnvVar{Name: "NCCL_P2P_DISABLE", Value: "1"})
+	require.False(t, wantsNCCLTopology(pod("true"), ctr))
+}
@@ -0,0 +1,214 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/k8sutil"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+	"github.com/Project-HAMi/HAMi/pkg/util/client"
+)
+
+const (
+	// EventReasonGPUMemoryPressure is recorded on a pod evicted because its card ran out of memory.
+	EventReasonGPUMemoryPressure = "GPUMemoryPressure"
+
+	// memoryPressureInterval is how often the memory in use on the cards is checked.
+	memoryPressureInterval = 10 * time.Second
+	// memoryPressureBackoff is how long the guard waits for an evicted pod to free its memory
+	// before it evicts another one from the same card.
+	memoryPressureBackoff = time.Minute
+)
+
+// memoryPressureGuard evicts soft and best-effort pods from cards whose memory in use, as
+// reported by NVML, reaches the threshold. The scheduler may oversubscribe the memory of a card
+// for such pods, so together they can allocate more than the card has. A nil *memoryPressureGuard does nothing.
+type memoryPressureGuard struct {
+	threshold float64
+	now       func() time.Time
+
+	mutex sync.Mutex
+	// evicted remembers when the guard last evicted a pod from a card.
+	evicted map[string]time.Time
+	events  record.EventRecorder
+}
+
+// newMemoryPressureGuard returns a guard evicting pods from cards with more than threshold of
+// their memory in use, or nil if threshold is 0.
+func newMemoryPressureGuard(threshold float64) (*memoryPressureGuard, error) {
+	if threshold == 0 {
+		return nil, nil
+	}
+	if threshold < 0 || threshold > 1 {
+		return nil, fmt.Errorf("memory pressure threshold %v is not between 0 and 1", threshold)
+	}
+	return &memoryPressureGuard{
+		threshold: threshold,
+		now:       time.Now,
+		evicted:   make(map[string]time.Time),
+	}, nil
+}
+
+// pressureTiers are the GPU tiers of the pods the guard evicts, the ones evicted first first.
+// Soft pods go first, they only ever hold memory other pods may take.
+var pressureTiers = []string{util.SoftReservation, util.BestEffort}
+
+// pressureVictim returns the pod on card of the first tier of pressureTiers with any, with the
+// lowest GPU reclaim priority and the newest among those. It returns nil while a pod of card
+// is terminating, as that frees memory anyway.
+func pressureVictim(pods []corev1.Pod, card string) *corev1.Pod {
+	var victim *corev1.Pod
+	victimTier := len(pressureTiers)
+	for i := range pods {
+		p := &pods[i]
+		if !podUsesCard(p, card) {
+			continue
+		}
+		if p.DeletionTimestamp != nil {
+			return nil
+		}
+		tier := slices.Index(pressureTiers, p.Annotations[util.GPUTier])
+		if p.Status.Phase != corev1.PodRunning || tier < 0 || tier > victimTier {
+			continue
+		}
+		if victim == nil || tier < victimTier {
+			victim, victimTier = p, tier
+			continue
+		}
+		pp, vp := k8sutil.GPUReclaimPriority(p, nil), k8sutil.GPUReclaimPriority(victim, nil)
+		if pp < vp || (pp == vp && p.CreationTimestamp.After(victim.CreationTimestamp.Time)) {
+			victim = p
+		}
+	}
+	return victim
+}
+
+// claim reports whether the guard may evict from card, i.e. it didn't within the backoff.
+func (g *memoryPressureGuard) claim(card string) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	now := g.now()
+	if last, ok := g.evicted[card]; ok && now.Sub(last) < memoryPressureBackoff {
+		return false
+	}
+	g.evicted[card] = now
+	return true
+}
+
+func (g *memoryPressureGuard) recorder() record.EventRecorder {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.events == nil {
+		g.events = newNodeEventRecorder()
+	}
+	return g.events
+}
+
+// relieve evicts one soft or best-effort pod from card if used of its total memory reach the threshold.
+func (g *memoryPressureGuard) relieve(card string, used, total uint64) {
+	if g == nil || total == 0 || float64(used) < g.threshold*float64(total) {
+		return
+	}
+	ctx := context.Background()
+	pods, err := client.GetClient().CoreV1().Pods("").List(ctx, metav1.ListOptions{
+		FieldSelector: fmt.Sprintf("spec.nodeName=%s", util.NodeName),
+	})
+	if err != nil {
+		klog.Errorf("memory pressure guard: failed to list pods for device %s: %v", card, err)
+		return
+	}
+	victim := pressureVictim(pods.Items, card)
+	if victim == nil {
+		klog.V(4).Infof("memory pressure guard: device %s has %d of %d bytes in use, but no soft or best-effort pod to evict", card, used, total)
+		return
+	}
+	if !g.claim(card) {
+		return
+	}
+	eviction := &policyv1.Eviction{ObjectMeta: metav1.ObjectMeta{Name: victim.Name, Namespace: victim.Namespace}}
+	if err := client.GetClient().PolicyV1().Evictions(victim.Namespace).Evict(ctx, eviction); err != nil {
+		klog.Errorf("memory pressure guard: failed to evict pod %s/%s from device %s: %v", victim.Namespace, victim.Name, card, err)
+		return
+	}
+	klog.Warningf("memory pressure guard: evicted pod %s/%s, device %s has %d of %d bytes in use", victim.Namespace, victim.Name, card, used, total)
+	g.recorder().Eventf(victim, corev1.EventTypeWarning, EventReasonGPUMemoryPressure,
+		"Evicted as best-effort pod with GPU reclaim priority %d, device %s has %d of %d MiB in use", k8sutil.GPUReclaimPriority(victim, nil), card, used/uint64(util.MiB), total/uint64(util.MiB))
+}
+
+// WatchMemoryPressure checks the memory in use on every card until stop is closed, and
+// relieves the cards reaching the threshold.
+func (plugin *NvidiaDevicePlugin) WatchMemoryPressure(stop <-chan any) {
+	klog.InfoS("Starting WatchMemoryPressure", "threshold", plugin.pressure.threshold)
+	ticker := time.NewTicker(memoryPressureInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		if err := initNVML(); err != nil {
+			if !errors.Is(err, errNoNVML) {
+				klog.Errorln(err)
+			}
+			continue
+		}
+		for UUID := range plugin.Devices() {
+			card := cardID(UUID)
+			ndev, ret := nvml.DeviceGetHandleByUUID(card)
+			if ret != nvml.SUCCESS {
+				klog.V(4).InfoS("failed to get device", "uuid", card, "err", ret)
+				continue
+			}
+			memory, ret := ndev.GetMemoryInfo()
+			if ret != nvml.SUCCESS {
+				klog.V(4).InfoS("failed to get memory info", "uuid", card, "err", ret)
+				continue
+			}
+			plugin.pressure.relieve(card, memory.Used, memory.Total)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+	"github.com/Project-HAMi/HAMi/pkg/util/client"
+)
+
+func bestEffortPod(name, card, priority string, created time.Time) *corev1.Pod {
+	p := coTenantPod(name, card, corev1.PodRunning)
+	p.CreationTimestamp = metav1.NewTime(created)
+	p.Annotations[util.GPUTier] = util.BestEffort
+	if priority != "" {
+		p.Annotations[util.GPUReclaimPriority] = priority
+	}
+	return p
+}
+
+func TestNewMemoryPressureGuard(t *testing.T) {
+	g, err := newMemoryPressureGuard(0)
+	require.NoError(t, err)
+	require.Nil(t, g)
+	g.relieve("GPU-0", 100, 100)
+
+	_, err = newMemoryPressureGuard(95)
+	require.ErrorContains(t, err, "not between 0 and 1")
+}
+
+func TestPressureVictim(t *testing.T) {
+	util.SupportDevices[nvidia.NvidiaGPUDevice] = "hami.io/vgpu-devices-allocated"
+	now := time.Now()
+	guaranteed := coTenantPod("guaranteed", "GPU-0", corev1.PodRunning)
+	guaranteed.Annotations[util.GPUReclaimPriority] = "-100"
+	pods := []corev1.Pod{
+		*guaranteed,
+		*bestEffortPod("old-low", "GPU-0", "-10", now.Add(-time.Hour)),
+		*bestEffortPod("new-low", "GPU-0", "-10", now),
+		*bestEffortPod("high", "GPU-0", "-1", now),
+		*bestEffortPod("other-card", "GPU-1", "0", now),
+	}
+	require.Equal(t, "new-low", pressureVictim(pods, "GPU-0").Name)
+	require.Nil(t, pressureVictim(pods, "GPU-2"))
+
+	// Soft pods go before best-effort ones, whatever their priority.
+	soft := bestEffortPod("soft", "GPU-0", "100", now.Add(-time.Hour))
+	soft.Annotations[util.GPUTier] = util.SoftReservation
+	require.Equal(t, "soft", pressureVictim(append(pods, *soft), "GPU-0").Name)
+
+	// A terminating pod frees its memory anyway.
+	pods[1].DeletionTimestamp = &metav1.Time{Time: now}
+	require.Nil(t, pressureVictim(pods, "GPU-0"))
+}
+
+func TestMemoryPressureGuardRelieve(t *testing.T) {
+	util.SupportDevices[nvidia.NvidiaGPUDevice] = "hami.io/vgpu-devices-allocated"
+	now := time.Now()
+	kubeClient := fake.NewSimpleClientset()
+	for _, p := range []*corev1.Pod{
+		bestEffortPod("low", "GPU-0", "-10", now),
+		bestEffortPod("high", "GPU-0", "-1", now),
+	} {
+		_, err := kubeClient.CoreV1().Pods(p.Namespace).Create(context.Background(), p, metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+	var evicted []string
+	kubeClient.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "eviction" {
+			return false, nil, nil
+		}
+		evicted = append(evicted, action.(k8stesting.CreateAction).GetObject().(*policyv1.Eviction).Name)
+		return true, nil, nil
+	})
+	client.KubeClient = kubeClient
+
+	g, err := newMemoryPressureGuard(0.9)
+	require.NoError(t, err)
+	recorder := record.NewFakeRecorder(10)
+	g.events = recorder
+
+	g.relieve("GPU-0", 80*uint64(util.MiB), 100*uint64(util.MiB))
+	require.Empty(t, evicted)
+	g.relieve("GPU-0", 95*uint64(util.MiB), 100*uint64(util.MiB))
+	require.Equal(t, []string{"low"}, evicted)
+	event := <-recorder.Events
+	require.True(t, strings.HasPrefix(event, "Warning "+EventReasonGPUMemoryPressure))
+	require.Contains(t, event, "device GPU-0 has 95 of 100 MiB in use")
+
+	// The evicted pod gets time to go before the next one is evicted.
+	g.relieve("GPU-0", 95*uint64(util.MiB), 100*uint64(util.MiB))
+	require.Equal(t, []string{"low"}, evicted)
+	g.now = func() time.Time { return now.Add(2 * memoryPressureBackoff) }
+	g.relieve("GPU-0", 95*uint64(util.MiB), 100*uint64(util.MiB))
+	require.Equal(t, []string{"low", "low"}, evicted)
+}
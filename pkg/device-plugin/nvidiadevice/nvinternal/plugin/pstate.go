@@ -0,0 +1,119 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"sync"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"k8s.io/klog/v2"
+)
+
+// wakePerformanceState is the lowest performance state a card is left in by WakeIdleGPUs,
+// kernels run in P0 to P2.
+const wakePerformanceState = 2
+
+// performanceState returns the P-state NVML reported as 0 to 15, nil if it is unknown.
+func performanceState(p nvml.Pstates) *int {
+	if p < nvml.PSTATE_0 || p > nvml.PSTATE_15 {
+		return nil
+	}
+	state := int(p)
+	return &state
+}
+
+// cardWaker keeps idle cards out of their low power states by locking their graphics clock, so
+// the first kernel of a pod doesn't wait for the card to ramp up. Every card is woken once, the
+// lock lasts until it is reset or the driver is reloaded. A nil *cardWaker wakes nothing.
+type cardWaker struct {
+	mutex sync.Mutex
+	woken map[string]bool
+}
+
+func newCardWaker(enabled bool) *cardWaker {
+	if !enabled {
+		return nil
+	}
+	return &cardWaker{woken: make(map[string]bool)}
+}
+
+// needsWake reports whether the card uuid in state is to be woken, and marks it woken.
+func (w *cardWaker) needsWake(uuid string, state *int) bool {
+	if w == nil || state == nil || *state <= wakePerformanceState {
+		return false
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.woken[uuid] {
+		return false
+	}
+	w.woken[uuid] = true
+	return true
+}
+
+// wakeCard locks the graphics clock of ndev between its default application clock and its max
+// clock, the range it runs kernels in, and reports whether it succeeded.
+func wakeCard(uuid string, ndev nvml.Device) bool {
+	maxClock, ret := ndev.GetMaxClockInfo(nvml.CLOCK_GRAPHICS)
+	if ret != nvml.SUCCESS {
+		klog.Warningf("Can't wake GPU %s, failed to get its max graphics clock: %v", uuid, ret)
+		return false
+	}
+	minClock, ret := ndev.GetDefaultApplicationsClock(nvml.CLOCK_GRAPHICS)
+	if ret != nvml.SUCCESS || minClock > maxClock {
+		minClock = maxClock
+	}
+	if ret := ndev.SetGpuLockedClocks(minClock, maxClock); ret != nvml.SUCCESS {
+		klog.Warningf("Can't wake GPU %s, failed to lock its graphics clock to %d-%d MHz: %v", uuid, minClock, maxClock, ret)
+		return false
+	}
+	klog.Infof("Woke GPU %s, its graphics clock is locked to %d-%d MHz", uuid, minClock, maxClock)
+	return true
+}
+
+// getPerformanceState reads the P-state of ndev, nil if NVML can't tell. An idle card is woken
+// first if WakeIdleGPUs is set.
+func (plugin *NvidiaDevicePlugin) getPerformanceState(uuid string, ndev nvml.Device) *int {
+	p, ret := ndev.GetPerformanceState()
+	if ret != nvml.SUCCESS {
+		klog.V(5).InfoS("failed to get the performance state", "uuid", uuid, "err", ret)
+		return nil
+	}
+	state := performanceState(p)
+	if plugin.waker.needsWake(uuid, state) && wakeCard(uuid, ndev) {
+		if p, ret := ndev.GetPerformanceState(); ret == nvml.SUCCESS {
+			state = performanceState(p)
+		}
+	}
+	return state
+}
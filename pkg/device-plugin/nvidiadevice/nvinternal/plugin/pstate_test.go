@@ -0,0 +1,63 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"testing"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPerformanceState(t *testing.T) {
+	require.Nil(t, performanceState(nvml.PSTATE_UNKNOWN))
+	require.Equal(t, 0, *performanceState(nvml.PSTATE_0))
+	require.Equal(t, 8, *performanceState(nvml.PSTATE_8))
+}
+
+func TestCardWaker(t *testing.T) {
+	p0, p2, p8 := 0, 2, 8
+
+	// Nothing is woken unless enabled.
+	require.False(t, newCardWaker(false).needsWake("GPU-0", &p8))
+
+	w := newCardWaker(true)
+	// Cards running kernels already and cards in an unknown state are left alone.
+	require.False(t, w.needsWake("GPU-0", &p0))
+	require.False(t, w.needsWake("GPU-0", &p2))
+	require.False(t, w.needsWake("GPU-0", nil))
+	// An idle card is woken once.
+	require.True(t, w.needsWake("GPU-0", &p8))
+	require.False(t, w.needsWake("GPU-0", &p8))
+	require.True(t, w.needsWake("GPU-1", &p8))
+}
@@ -0,0 +1,198 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// maxQuarantineBackoff caps how long a card stays quarantined after failing again and again.
+const maxQuarantineBackoff = time.Hour
+
+// cardQuarantine is a per-card circuit breaker for Allocate. After threshold consecutive
+// allocation failures a card is quarantined for a backoff. Once released, the next failure
+// quarantines it again with twice the previous backoff, while a successful allocation resets it.
+// A nil *cardQuarantine never quarantines anything.
+type cardQuarantine struct {
+	threshold int
+	backoff   time.Duration
+	now       func() time.Time
+
+	mutex   sync.Mutex
+	cards   map[string]*cardFailures
+	changed chan struct{}
+}
+
+type cardFailures struct {
+	consecutive int
+	backoff     time.Duration
+	until       time.Time
+}
+
+// newCardQuarantine returns a quarantine tripping after threshold failures, or nil if threshold is 0.
+func newCardQuarantine(threshold int, backoff time.Duration) *cardQuarantine {
+	if threshold <= 0 {
+		return nil
+	}
+	return &cardQuarantine{
+		threshold: threshold,
+		backoff:   backoff,
+		now:       time.Now,
+		cards:     make(map[string]*cardFailures),
+		changed:   make(chan struct{}, 1),
+	}
+}
+
+// recordFailure counts a failed allocation on card and quarantines it once the threshold is reached.
+func (q *cardQuarantine) recordFailure(card string) {
+	if q == nil {
+		return
+	}
+	card = cardID(card)
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	f, ok := q.cards[card]
+	if !ok {
+		f = &cardFailures{}
+		q.cards[card] = f
+	}
+	now := q.now()
+	if now.Before(f.until) {
+		return
+	}
+	f.consecutive++
+	if f.consecutive < q.threshold {
+		klog.Warningf("allocation on device %s failed %d time(s) in a row, quarantining it after %d", card, f.consecutive, q.threshold)
+		return
+	}
+	if f.backoff == 0 {
+		f.backoff = q.backoff
+	} else {
+		f.backoff = min(f.backoff*2, maxQuarantineBackoff)
+	}
+	f.until = now.Add(f.backoff)
+	// A single failure after the release is enough to trip again.
+	f.consecutive = q.threshold - 1
+	klog.Errorf("device %s quarantined for %v after repeated allocation failures", card, f.backoff)
+	time.AfterFunc(f.backoff, func() {
+		klog.Infof("device %s released from quarantine", card)
+		q.notify()
+	})
+	q.notify()
+}
+
+// hold quarantines card for d regardless of its failure count, e.g. after the co-tenant guard
+// found its state suspect. It doesn't shorten a longer quarantine already in place.
+func (q *cardQuarantine) hold(card string, d time.Duration, reason string) {
+	if q == nil {
+		return
+	}
+	card = cardID(card)
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	f, ok := q.cards[card]
+	if !ok {
+		f = &cardFailures{}
+		q.cards[card] = f
+	}
+	until := q.now().Add(d)
+	if until.Before(f.until) {
+		return
+	}
+	f.until = until
+	klog.Errorf("device %s quarantined for %v: %s", card, d, reason)
+	time.AfterFunc(d, func() {
+		klog.Infof("device %s released from quarantine", card)
+		q.notify()
+	})
+	q.notify()
+}
+
+// recordSuccess resets the failure count and backoff of card.
+func (q *cardQuarantine) recordSuccess(card string) {
+	if q == nil {
+		return
+	}
+	card = cardID(card)
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if _, ok := q.cards[card]; ok {
+		delete(q.cards, card)
+		klog.Infof("allocation on device %s succeeded, resetting its quarantine state", card)
+	}
+}
+
+// quarantined reports whether card is quarantined. id may also be a replica ID
+// as handed to the kubelet, i.e. the card UUID followed by "-<replica>".
+func (q *cardQuarantine) quarantined(id string) bool {
+	if q == nil {
+		return false
+	}
+	id = cardID(id)
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	now := q.now()
+	if f, ok := q.cards[id]; ok && now.Before(f.until) {
+		return true
+	}
+	if i := strings.LastIndex(id, "-"); i > 0 {
+		if f, ok := q.cards[id[:i]]; ok && now.Before(f.until) {
+			return true
+		}
+	}
+	return false
+}
+
+// changes is signalled whenever a card enters or leaves quarantine.
+func (q *cardQuarantine) changes() <-chan struct{} {
+	if q == nil {
+		return nil
+	}
+	return q.changed
+}
+
+// cardID strips the MIG template suffix of a dynamically partitioned card, e.g. "GPU-0[1-2]".
+func cardID(uuid string) string {
+	return strings.Split(uuid, "[")[0]
+}
+
+func (q *cardQuarantine) notify() {
+	select {
+	case q.changed <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,107 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	kubeletdevicepluginv1beta1 "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device-plugin/nvidiadevice/nvinternal/rm"
+)
+
+func TestCardQuarantine(t *testing.T) {
+	now := time.Now()
+	q := newCardQuarantine(2, time.Minute)
+	q.now = func() time.Time { return now }
+
+	q.recordFailure("GPU-0")
+	require.False(t, q.quarantined("GPU-0"))
+	q.recordFailure("GPU-0[1-2]")
+	require.True(t, q.quarantined("GPU-0"))
+	require.True(t, q.quarantined("GPU-0-3"), "replica IDs map to their card")
+	require.False(t, q.quarantined("GPU-1"))
+	select {
+	case <-q.changes():
+	default:
+		t.Fatal("expected a change notification")
+	}
+
+	// After the backoff one more failure trips it again, for twice as long.
+	now = now.Add(time.Minute)
+	require.False(t, q.quarantined("GPU-0"))
+	q.recordFailure("GPU-0")
+	require.True(t, q.quarantined("GPU-0"))
+	now = now.Add(time.Minute)
+	require.True(t, q.quarantined("GPU-0"))
+	now = now.Add(time.Minute)
+	require.False(t, q.quarantined("GPU-0"))
+
+	// A success resets the count and backoff.
+	q.recordSuccess("GPU-0")
+	q.recordFailure("GPU-0")
+	require.False(t, q.quarantined("GPU-0"))
+}
+
+func TestCardQuarantineDisabled(t *testing.T) {
+	q := newCardQuarantine(0, time.Minute)
+	require.Nil(t, q)
+	q.recordFailure("GPU-0")
+	q.recordSuccess("GPU-0")
+	require.False(t, q.quarantined("GPU-0"))
+	require.Nil(t, q.changes())
+}
+
+func TestQuarantineLeavesMigDevicesOfResourceManager(t *testing.T) {
+	devices := rm.Devices{}
+	for _, id := range []string{"MIG-0", "MIG-1"} {
+		devices[id] = &rm.Device{Device: kubeletdevicepluginv1beta1.Device{ID: id, Health: kubeletdevicepluginv1beta1.Healthy}}
+	}
+	plugin := &NvidiaDevicePlugin{
+		rm:         &fakeResourceManager{devices: devices},
+		quarantine: newCardQuarantine(1, time.Minute),
+	}
+	plugin.quarantine.recordFailure("MIG-0")
+
+	for _, d := range plugin.apiDevices() {
+		if d.ID == "MIG-0" {
+			require.Equal(t, kubeletdevicepluginv1beta1.Unhealthy, d.Health)
+		} else {
+			require.Equal(t, kubeletdevicepluginv1beta1.Healthy, d.Health)
+		}
+	}
+	// The device of the resource manager keeps its health, to be advertised once the quarantine ends.
+	require.Equal(t, kubeletdevicepluginv1beta1.Healthy, devices["MIG-0"].Health)
+}
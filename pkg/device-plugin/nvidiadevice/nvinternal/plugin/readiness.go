@@ -0,0 +1,79 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"fmt"
+	"time"
+)
+
+// registrationTimeout is how long after the last registration of its devices in the node
+// annotations a plugin is still ready. The registration is repeated every 30s.
+const registrationTimeout = 2 * time.Minute
+
+// DiscoveryCheck fails if the GPUs of the node can't be discovered or there are none, e.g.
+// after the driver was unloaded underneath the plugin.
+func DiscoveryCheck() error {
+	discoverer, err := NewDeviceDiscoverer()
+	if err != nil {
+		return err
+	}
+	if err := discoverer.Init(); err != nil {
+		return fmt.Errorf("failed to initialize the device discovery: %v", err)
+	}
+	defer discoverer.Shutdown()
+	count, err := discoverer.Count()
+	if err != nil {
+		return fmt.Errorf("failed to count the devices: %v", err)
+	}
+	if count == 0 {
+		return fmt.Errorf("%s discovery finds no devices", DeviceDiscovery)
+	}
+	return nil
+}
+
+// Ready fails unless the plugin is registered with the kubelet and recently registered its
+// devices on the node, so the scheduler can place pods on them.
+func (plugin *NvidiaDevicePlugin) Ready() error {
+	if !plugin.serving.Load() {
+		return fmt.Errorf("'%s' is not registered with the kubelet", plugin.rm.Resource())
+	}
+	last := plugin.registeredAt.Load()
+	if last == 0 {
+		return fmt.Errorf("devices of '%s' are not registered on the node yet", plugin.rm.Resource())
+	}
+	if at := time.Unix(0, last); time.Since(at) > registrationTimeout {
+		return fmt.Errorf("devices of '%s' were last registered on the node at %s", plugin.rm.Resource(), at.Format(time.RFC3339))
+	}
+	return nil
+}
@@ -33,8 +33,11 @@
 package plugin
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -42,6 +45,7 @@ import (
 	"github.com/NVIDIA/go-nvml/pkg/nvml"
 	"k8s.io/klog/v2"
 
+	"github.com/Project-HAMi/HAMi/pkg/device-plugin/nvidiadevice/nvinternal/info"
 	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
 	"github.com/Project-HAMi/HAMi/pkg/util"
 )
@@ -107,44 +111,216 @@ func parseNvidiaNumaInfo(idx int, nvidiaTopoStr string) (int, error) {
 	return result, nil
 }
 
+// sysfsPCIDevicesPath is where the kernel exposes PCI devices as symlinks into the device tree.
+var sysfsPCIDevicesPath = "/sys/bus/pci/devices"
+
+// getPCIeSwitch returns the upstream bridge the GPU at busID hangs off, read from sysfs.
+// The resolved device path looks like
+// /sys/devices/pci0000:3a/0000:3a:00.0/0000:3b:00.0/0000:3c:08.0/0000:3d:00.0
+// where 0000:3c:08.0 is the switch downstream port and 0000:3b:00.0 the switch itself,
+// so GPUs sharing that grandparent share a PCIe switch. A GPU on the root bus, e.g.
+// /sys/devices/pci0000:00/0000:00:05.0, has no upstream bridge and gets "".
+func getPCIeSwitch(busID string) (string, error) {
+	devicePath, err := filepath.EvalSymlinks(filepath.Join(sysfsPCIDevicesPath, busID))
+	if err != nil {
+		return "", err
+	}
+	port := filepath.Dir(devicePath)
+	if strings.HasPrefix(filepath.Base(port), "pci") {
+		return "", nil
+	}
+	if !strings.HasPrefix(filepath.Base(port), "0000:") {
+		return "", fmt.Errorf("unexpected pci device path %s", devicePath)
+	}
+	return filepath.Base(filepath.Dir(port)), nil
+}
+
+// pciBusID converts an NVML bus id such as 00000000:3B:00.0 into the sysfs form 0000:3b:00.0.
+func pciBusID(busID [32]int8) string {
+	b := make([]byte, 0, len(busID))
+	for _, c := range busID {
+		if c == 0 {
+			break
+		}
+		b = append(b, byte(c))
+	}
+	return strings.ToLower(strings.TrimPrefix(string(b), "0000"))
+}
+
+// sysfsInfinibandPath is where the kernel exposes RDMA devices and their ports.
+var sysfsInfinibandPath = "/sys/class/infiniband"
+
+// detectFabric reports the interconnect fabric of the node: "infiniband" if any RDMA port
+// runs InfiniBand, "roce" if RDMA only runs over Ethernet and "ethernet" without RDMA devices.
+func detectFabric() string {
+	layers, _ := filepath.Glob(filepath.Join(sysfsInfinibandPath, "*", "ports", "*", "link_layer"))
+	fabric := "ethernet"
+	for _, path := range layers {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		switch strings.TrimSpace(string(data)) {
+		case "InfiniBand":
+			return "infiniband"
+		case "Ethernet":
+			fabric = "roce"
+		}
+	}
+	return fabric
+}
+
+// procDriverVersionPath is where the NVIDIA kernel module reports its version.
+var procDriverVersionPath = "/proc/driver/nvidia/version"
+
+// detectKernelModule reports the variant of the loaded NVIDIA kernel module, "open" for the
+// open GPU kernel modules and "proprietary" otherwise, or "" if no module reports its version.
+func detectKernelModule() string {
+	data, err := os.ReadFile(procDriverVersionPath)
+	if err != nil {
+		klog.V(4).InfoS("failed to read the NVIDIA kernel module version", "path", procDriverVersionPath, "err", err)
+		return ""
+	}
+	// e.g. "NVRM version: NVIDIA UNIX Open Kernel Module for x86_64  535.104.05  Release Build ..."
+	// against "NVRM version: NVIDIA UNIX x86_64 Kernel Module  535.104.05  Sat Aug 19 01:15:15 UTC 2023"
+	for _, line := range strings.Split(string(data), "\n") {
+		if !strings.HasPrefix(line, "NVRM version:") {
+			continue
+		}
+		if strings.Contains(line, "Open Kernel Module") {
+			return util.NvidiaKernelModuleOpen
+		}
+		return util.NvidiaKernelModuleProprietary
+	}
+	return ""
+}
+
+// formatCUDAVersion turns the CUDA version NVML reports, e.g. 12020, into major.minor, e.g. "12.2".
+func formatCUDAVersion(v int) string {
+	return fmt.Sprintf("%d.%d", v/1000, v%1000/10)
+}
+
+// computePerfTier maps how close a card runs to its full clock and power budget to a tier
+// from 1 (heavily capped) to 4 (full performance). The more restrictive ratio wins.
+func computePerfTier(clockRatio, powerRatio float64) int {
+	ratio := min(clockRatio, powerRatio)
+	switch {
+	case ratio >= 0.95:
+		return 4
+	case ratio >= 0.75:
+		return 3
+	case ratio >= 0.5:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// hasEncoder reports whether ndev has NVENC encoders. NVML doesn't support the encoder
+// capacity query on models without them, e.g. the A100.
+func hasEncoder(ndev nvml.Device) bool {
+	capacity, ret := ndev.GetEncoderCapacity(nvml.ENCODER_QUERY_H264)
+	return ret == nvml.SUCCESS && capacity > 0
+}
+
+// deviceKindOf maps the virtualization mode NVML reports for a card to util.GPUDeviceKind. A
+// card passed through to a VM whole, or seen from the host of vGPUs, is physical; only the
+// vGPU a VM gets, e.g. a mediated device or an SR-IOV virtual function, is virtual.
+func deviceKindOf(mode nvml.GpuVirtualizationMode) string {
+	switch mode {
+	case nvml.GPU_VIRTUALIZATION_MODE_VGPU:
+		return util.GPUDeviceKindVirtual
+	case nvml.GPU_VIRTUALIZATION_MODE_NONE, nvml.GPU_VIRTUALIZATION_MODE_PASSTHROUGH,
+		nvml.GPU_VIRTUALIZATION_MODE_HOST_VGPU, nvml.GPU_VIRTUALIZATION_MODE_HOST_VSGA:
+		return util.GPUDeviceKindPhysical
+	}
+	return ""
+}
+
+// getDeviceKind reports whether ndev is a physical card or a vGPU, "" if NVML can't tell.
+func getDeviceKind(ndev nvml.Device) string {
+	mode, ret := ndev.GetVirtualizationMode()
+	if ret != nvml.SUCCESS {
+		klog.V(4).InfoS("failed to get the virtualization mode", "ret", ret)
+		return ""
+	}
+	return deviceKindOf(mode)
+}
+
+// getPerfTier derives the performance tier of ndev from NVML: the application SM clock
+// against the max SM clock, and the enforced power limit against the default one.
+// It returns 0 when NVML does not expose enough information.
+func getPerfTier(ndev nvml.Device) int {
+	maxClock, ret := ndev.GetMaxClockInfo(nvml.CLOCK_SM)
+	if ret != nvml.SUCCESS || maxClock == 0 {
+		return 0
+	}
+	appClock, ret := ndev.GetApplicationsClock(nvml.CLOCK_SM)
+	if ret != nvml.SUCCESS {
+		return 0
+	}
+	powerRatio := 1.0
+	defaultLimit, ret := ndev.GetPowerManagementDefaultLimit()
+	if ret == nvml.SUCCESS && defaultLimit > 0 {
+		if enforcedLimit, ret := ndev.GetEnforcedPowerLimit(); ret == nvml.SUCCESS {
+			powerRatio = float64(enforcedLimit) / float64(defaultLimit)
+		}
+	}
+	return computePerfTier(float64(appClock)/float64(maxClock), powerRatio)
+}
+
+// detectConfidentialCompute reports whether the GPUs of the node run in confidential
+// computing mode. The NVML bindings in use do not expose the conf-compute API yet, so
+// nvidia-smi is asked instead; if it can't tell, the mode is assumed to be off.
+func detectConfidentialCompute() bool {
+	out, err := exec.Command("nvidia-smi", "conf-compute", "-f").Output()
+	if err != nil {
+		klog.V(5).InfoS("nvidia-smi conf-compute failed, assuming confidential computing is off", "err", err)
+		return false
+	}
+	return parseConfidentialComputeState(string(out))
+}
+
+// parseConfidentialComputeState parses the "CC status: ON" line of nvidia-smi conf-compute -f.
+func parseConfidentialComputeState(out string) bool {
+	for _, line := range strings.Split(out, "\n") {
+		k, v, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(k), "CC status") {
+			return strings.EqualFold(strings.TrimSpace(v), "ON")
+		}
+	}
+	return false
+}
+
 func (plugin *NvidiaDevicePlugin) getAPIDevices() *[]*util.DeviceInfo {
 	devs := plugin.Devices()
 	klog.V(5).InfoS("getAPIDevices", "devices", devs)
-	if nvret := nvml.Init(); nvret != nvml.SUCCESS {
-		klog.Errorln("nvml Init err: ", nvret)
+	if err := plugin.discoverer.Init(); err != nil {
+		klog.Errorln("device discovery Init err: ", err)
 		panic(0)
 	}
 	res := make([]*util.DeviceInfo, 0, len(devs))
+	confidentialCompute := detectConfidentialCompute()
 	for UUID := range devs {
-		ndev, ret := nvml.DeviceGetHandleByUUID(UUID)
-		if ret != nvml.SUCCESS {
-			klog.Errorln("nvml new device by index error uuid=", UUID, "err=", ret)
-			panic(0)
-		}
-		idx, ret := ndev.GetIndex()
-		if ret != nvml.SUCCESS {
-			klog.Errorln("nvml get index error ret=", ret)
-			panic(0)
-		}
-		memoryTotal := 0
-		memory, ret := ndev.GetMemoryInfo()
-		if ret == nvml.SUCCESS {
-			memoryTotal = int(memory.Total)
-		} else {
-			klog.Error("nvml get memory error ret=", ret)
-			panic(0)
-		}
-		Model, ret := ndev.GetName()
-		if ret != nvml.SUCCESS {
-			klog.Error("nvml get name error ret=", ret)
+		card, err := plugin.discoverer.Device(UUID, confidentialCompute)
+		if err != nil {
+			klog.Errorln("device discovery error uuid=", UUID, "err=", err)
 			panic(0)
 		}
+		idx, Model := card.Index, card.Model
 
-		registeredmem := int32(memoryTotal / 1024 / 1024)
+		registeredmem := int32(card.MemoryTotal / 1024 / 1024)
 		if plugin.schedulerConfig.DeviceMemoryScaling != 1 {
 			registeredmem = int32(float64(registeredmem) * plugin.schedulerConfig.DeviceMemoryScaling)
 		}
 		klog.Infoln("MemoryScaling=", plugin.schedulerConfig.DeviceMemoryScaling, "registeredmem=", registeredmem)
+		if plugin.memoryTotals == nil {
+			plugin.memoryTotals = make(map[string]int32)
+		}
+		if prev, ok := plugin.memoryTotals[UUID]; ok && prev != registeredmem {
+			klog.Warningf("device %v total memory changed from %vMiB to %vMiB, advertising the new capacity", UUID, prev, registeredmem)
+		}
+		plugin.memoryTotals[UUID] = registeredmem
 		health := true
 		for _, val := range devs {
 			if strings.Compare(val.ID, UUID) == 0 {
@@ -158,22 +334,50 @@ func (plugin *NvidiaDevicePlugin) getAPIDevices() *[]*util.DeviceInfo {
 				break
 			}
 		}
-		numa, err := plugin.getNumaInformation(idx)
-		if err != nil {
-			klog.ErrorS(err, "failed to get numa information", "idx", idx)
-		}
-		res = append(res, &util.DeviceInfo{
-			ID:      UUID,
-			Index:   uint(idx),
-			Count:   int32(plugin.schedulerConfig.DeviceSplitCount),
-			Devmem:  registeredmem,
-			Devcore: int32(plugin.schedulerConfig.DeviceCoreScaling * 100),
-			Type:    fmt.Sprintf("%v-%v", "NVIDIA", Model),
-			Numa:    numa,
-			Mode:    plugin.operatingMode,
-			Health:  health,
-		})
-		klog.Infof("nvml registered device id=%v, memory=%v, type=%v, numa=%v", idx, registeredmem, Model, numa)
+		var migGeometry *int
+		if plugin.operatingMode == "mig" {
+			migGeometry = plugin.currentMigGeometry(Model, idx)
+		}
+		info := &util.DeviceInfo{
+			ID:                  UUID,
+			Index:               uint(idx),
+			Count:               int32(plugin.schedulerConfig.DeviceSplitCount),
+			Devmem:              registeredmem,
+			Devcore:             nvidia.AdvertisedCores(nvidia.ScaledCores(plugin.schedulerConfig.DeviceCoreScaling, plugin.schedulerConfig.CoreRounding), uint(idx)),
+			Type:                fmt.Sprintf("%v-%v", "NVIDIA", Model),
+			Mode:                plugin.operatingMode,
+			Health:              health,
+			Quarantined:         plugin.quarantine.quarantined(UUID),
+			Draining:            plugin.migReconfig.isDraining(UUID),
+			HeldExternally:      plugin.stock.held(UUID),
+			ConfidentialCompute: confidentialCompute,
+			MemoryType:          nvidia.MemoryTypeOf(Model, plugin.schedulerConfig.CardMemoryTypes),
+			MigGeometry:         migGeometry,
+		}
+		// The topology and the health of a GPU NVML doesn't know, e.g. a fake one, can't be told.
+		if card.ndev != nil {
+			ndev := *card.ndev
+			info.Numa, err = plugin.getNumaInformation(idx)
+			if err != nil {
+				klog.ErrorS(err, "failed to get numa information", "idx", idx)
+			}
+			if pciInfo, ret := ndev.GetPciInfo(); ret == nvml.SUCCESS {
+				info.PCIeSwitch, err = getPCIeSwitch(pciBusID(pciInfo.BusId))
+				if err != nil {
+					klog.ErrorS(err, "failed to get pcie topology", "idx", idx)
+				}
+			} else {
+				klog.Errorln("nvml get pci info error ret=", ret)
+			}
+			info.PerfTier = getPerfTier(ndev)
+			info.Encoder = hasEncoder(ndev)
+			info.DeviceKind = getDeviceKind(ndev)
+			info.ECCErrors = plugin.getECCErrors(UUID, ndev)
+			info.PerformanceState = plugin.getPerformanceState(UUID, ndev)
+			info.Temperature = plugin.getTemperature(UUID, ndev)
+		}
+		res = append(res, info)
+		klog.Infof("nvml registered device id=%v, memory=%v, type=%v, numa=%v, pcie switch=%v, confidential compute=%v, memory type=%v", idx, registeredmem, Model, info.Numa, info.PCIeSwitch, confidentialCompute, info.MemoryType)
 	}
 	return &res
 }
@@ -181,6 +385,7 @@ func (plugin *NvidiaDevicePlugin) getAPIDevices() *[]*util.DeviceInfo {
 func (plugin *NvidiaDevicePlugin) RegistrInAnnotation() error {
 	devices := plugin.getAPIDevices()
 	klog.InfoS("start working on the devices", "devices", devices)
+	plugin.textfile.setDevices(*devices)
 	annos := make(map[string]string)
 	node, err := util.GetNode(util.NodeName)
 	if err != nil {
@@ -190,13 +395,31 @@ func (plugin *NvidiaDevicePlugin) RegistrInAnnotation() error {
 	encodeddevices := util.EncodeNodeDevices(*devices)
 	annos[nvidia.HandshakeAnnos] = "Reported " + time.Now().String()
 	annos[nvidia.RegisterAnnos] = encodeddevices
+	annos[nvidia.DeviceAttributesAnnos] = util.EncodeNodeDeviceAttributes(*devices)
+	annos[util.NodeFabricAnnos] = detectFabric()
+	annos[util.NodeDevicePluginVersionAnnos] = info.GetVersion()
+	if module := detectKernelModule(); module != "" {
+		annos[util.NodeNvidiaKernelModuleAnnos] = module
+	}
+	driverVersion, cudaVersion := plugin.discoverer.DriverVersions()
+	if driverVersion != "" {
+		annos[util.NodeNvidiaDriverVersionAnnos] = driverVersion
+	}
+	if cudaVersion != "" {
+		annos[util.NodeNvidiaCUDAVersionAnnos] = cudaVersion
+	}
+	fabricHealth := plugin.nvlinkFabricHealth()
+	annos[util.NodeNVLinkFabricAnnos] = fabricHealth
+	plugin.recordFabricHealth(node, fabricHealth)
 	klog.Infof("patch node with the following annos %v", fmt.Sprintf("%v", annos))
 	err = util.PatchNodeAnnotations(node, annos)
 
 	if err != nil {
 		klog.Errorln("patch node error", err.Error())
+		return err
 	}
-	return err
+	plugin.checkCoreReservation(node, *devices)
+	return nil
 }
 
 func (plugin *NvidiaDevicePlugin) WatchAndRegister() {
@@ -210,8 +433,64 @@ func (plugin *NvidiaDevicePlugin) WatchAndRegister() {
 			klog.Infof("Retrying in %v seconds...", errorSleepInterval)
 			time.Sleep(errorSleepInterval)
 		} else {
+			plugin.registeredAt.Store(time.Now().UnixNano())
 			klog.Infof("Successfully registered annotation. Next check in %v seconds...", successSleepInterval)
 			time.Sleep(successSleepInterval)
 		}
 	}
 }
+
+// sampleUtilization reads the SM and memory bandwidth utilization of every device from NVML.
+// Devices NVML fails to sample are left out, so the scheduler ignores them.
+func (plugin *NvidiaDevicePlugin) sampleUtilization() map[string]util.DeviceUtilization {
+	if err := initNVML(); err != nil {
+		if !errors.Is(err, errNoNVML) {
+			klog.Errorln(err)
+		}
+		return nil
+	}
+	now := time.Now().UTC()
+	res := make(map[string]util.DeviceUtilization)
+	for UUID := range plugin.Devices() {
+		ndev, ret := nvml.DeviceGetHandleByUUID(UUID)
+		if ret != nvml.SUCCESS {
+			klog.Errorln("nvml new device by uuid error uuid=", UUID, "err=", ret)
+			continue
+		}
+		rates, ret := ndev.GetUtilizationRates()
+		if ret != nvml.SUCCESS {
+			klog.V(4).InfoS("failed to get utilization rates", "uuid", UUID, "err", ret)
+			continue
+		}
+		res[UUID] = util.DeviceUtilization{SM: int(rates.Gpu), Memory: int(rates.Memory), Timestamp: now}
+	}
+	return res
+}
+
+// WatchUtilization publishes the live utilization of the devices in the
+// DeviceUtilizationAnnos node annotation every interval until stop is closed.
+func (plugin *NvidiaDevicePlugin) WatchUtilization(interval time.Duration, stop <-chan any) {
+	klog.InfoS("Starting WatchUtilization", "interval", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		utils := plugin.sampleUtilization()
+		if utils == nil {
+			continue
+		}
+		node, err := util.GetNode(util.NodeName)
+		if err != nil {
+			klog.Errorln("get node error", err.Error())
+			continue
+		}
+		annos := map[string]string{nvidia.DeviceUtilizationAnnos: util.EncodeNodeDeviceUtilization(utils)}
+		if err := util.PatchNodeAnnotations(node, annos); err != nil {
+			klog.Errorln("patch node utilization error", err.Error())
+		}
+	}
+}
@@ -32,7 +32,15 @@
 
 package plugin
 
-import "testing"
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
 
 func Test_parseNvidiaNumaInfo(t *testing.T) {
 
@@ -90,3 +98,219 @@ GPU0	X`,
 		})
 	}
 }
+
+func Test_getPCIeSwitch(t *testing.T) {
+	root := t.TempDir()
+	devices := filepath.Join(root, "devices", "pci0000:3a", "0000:3a:00.0")
+	gpus := map[string]string{
+		"0000:3d:00.0": filepath.Join(devices, "0000:3b:00.0", "0000:3c:08.0", "0000:3d:00.0"),
+		"0000:3e:00.0": filepath.Join(devices, "0000:3b:00.0", "0000:3c:10.0", "0000:3e:00.0"),
+		"0000:3f:00.0": filepath.Join(devices, "0000:3f:00.0"),
+		"0000:00:05.0": filepath.Join(root, "devices", "pci0000:00", "0000:00:05.0"),
+	}
+	bus := filepath.Join(root, "bus")
+	if err := os.MkdirAll(bus, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for busID, path := range gpus {
+		if err := os.MkdirAll(path, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(path, filepath.Join(bus, busID)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	orig := sysfsPCIDevicesPath
+	sysfsPCIDevicesPath = bus
+	defer func() { sysfsPCIDevicesPath = orig }()
+
+	tests := []struct {
+		busID   string
+		want    string
+		wantErr bool
+	}{
+		{busID: "0000:3d:00.0", want: "0000:3b:00.0"},
+		{busID: "0000:3e:00.0", want: "0000:3b:00.0"},
+		{busID: "0000:3f:00.0", want: "pci0000:3a"},
+		{busID: "0000:00:05.0", want: ""},
+		{busID: "0000:40:00.0", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.busID, func(t *testing.T) {
+			got, err := getPCIeSwitch(tt.busID)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getPCIeSwitch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("getPCIeSwitch() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_detectFabric(t *testing.T) {
+	orig := sysfsInfinibandPath
+	defer func() { sysfsInfinibandPath = orig }()
+
+	addPort := func(root, dev, port, layer string) {
+		dir := filepath.Join(root, dev, "ports", port)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "link_layer"), []byte(layer+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sysfsInfinibandPath = filepath.Join(t.TempDir(), "missing")
+	if got := detectFabric(); got != "ethernet" {
+		t.Errorf("detectFabric() without rdma devices = %v, want ethernet", got)
+	}
+
+	roce := t.TempDir()
+	addPort(roce, "mlx5_0", "1", "Ethernet")
+	sysfsInfinibandPath = roce
+	if got := detectFabric(); got != "roce" {
+		t.Errorf("detectFabric() with roce ports = %v, want roce", got)
+	}
+
+	ib := t.TempDir()
+	addPort(ib, "mlx5_0", "1", "Ethernet")
+	addPort(ib, "mlx5_1", "1", "InfiniBand")
+	sysfsInfinibandPath = ib
+	if got := detectFabric(); got != "infiniband" {
+		t.Errorf("detectFabric() with infiniband ports = %v, want infiniband", got)
+	}
+}
+
+func Test_detectKernelModule(t *testing.T) {
+	orig := procDriverVersionPath
+	defer func() { procDriverVersionPath = orig }()
+
+	tests := []struct {
+		name    string
+		version string
+		want    string
+	}{
+		{
+			name:    "open kernel module",
+			version: "NVRM version: NVIDIA UNIX Open Kernel Module for x86_64  535.104.05  Release Build  (dvs-builder@U16-I3-B03-4-3)  Sat Aug 19 01:13:25 UTC 2023\nGCC version:  gcc version 12.3.0\n",
+			want:    util.NvidiaKernelModuleOpen,
+		},
+		{
+			name:    "proprietary kernel module",
+			version: "NVRM version: NVIDIA UNIX x86_64 Kernel Module  535.104.05  Sat Aug 19 01:15:15 UTC 2023\nGCC version:  gcc version 12.3.0\n",
+			want:    util.NvidiaKernelModuleProprietary,
+		},
+		{
+			name:    "no version line",
+			version: "GCC version:  gcc version 12.3.0\n",
+			want:    "",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			procDriverVersionPath = filepath.Join(t.TempDir(), "version")
+			if err := os.WriteFile(procDriverVersionPath, []byte(test.version), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if got := detectKernelModule(); got != test.want {
+				t.Errorf("detectKernelModule() = %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	procDriverVersionPath = filepath.Join(t.TempDir(), "missing")
+	if got := detectKernelModule(); got != "" {
+		t.Errorf("detectKernelModule() without a driver = %q, want empty", got)
+	}
+}
+
+func Test_formatCUDAVersion(t *testing.T) {
+	tests := []struct {
+		v    int
+		want string
+	}{
+		{v: 12020, want: "12.2"},
+		{v: 11080, want: "11.8"},
+		{v: 12000, want: "12.0"},
+		{v: 10010, want: "10.1"},
+	}
+	for _, tt := range tests {
+		if got := formatCUDAVersion(tt.v); got != tt.want {
+			t.Errorf("formatCUDAVersion(%d) = %v, want %v", tt.v, got, tt.want)
+		}
+	}
+}
+
+func Test_deviceKindOf(t *testing.T) {
+	tests := []struct {
+		name string
+		mode nvml.GpuVirtualizationMode
+		want string
+	}{
+		{name: "bare metal", mode: nvml.GPU_VIRTUALIZATION_MODE_NONE, want: util.GPUDeviceKindPhysical},
+		{name: "passthrough", mode: nvml.GPU_VIRTUALIZATION_MODE_PASSTHROUGH, want: util.GPUDeviceKindPhysical},
+		{name: "vgpu host", mode: nvml.GPU_VIRTUALIZATION_MODE_HOST_VGPU, want: util.GPUDeviceKindPhysical},
+		{name: "vgpu guest", mode: nvml.GPU_VIRTUALIZATION_MODE_VGPU, want: util.GPUDeviceKindVirtual},
+		{name: "unknown mode", mode: nvml.GpuVirtualizationMode(42), want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := deviceKindOf(tt.mode); got != tt.want {
+				t.Errorf("deviceKindOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_pciBusID(t *testing.T) {
+	var busID [32]int8
+	for i, c := range "00000000:3B:00.0" {
+		busID[i] = int8(c)
+	}
+	if got := pciBusID(busID); got != "0000:3b:00.0" {
+		t.Errorf("pciBusID() = %v, want 0000:3b:00.0", got)
+	}
+}
+
+func Test_computePerfTier(t *testing.T) {
+	tests := []struct {
+		name       string
+		clockRatio float64
+		powerRatio float64
+		want       int
+	}{
+		{name: "full performance", clockRatio: 1, powerRatio: 1, want: 4},
+		{name: "power capped", clockRatio: 1, powerRatio: 0.8, want: 3},
+		{name: "clock capped", clockRatio: 0.6, powerRatio: 1, want: 2},
+		{name: "heavily capped", clockRatio: 0.9, powerRatio: 0.4, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := computePerfTier(tt.clockRatio, tt.powerRatio); got != tt.want {
+				t.Errorf("computePerfTier() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseConfidentialComputeState(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want bool
+	}{
+		{name: "on", out: "CC status: ON\n", want: true},
+		{name: "off", out: "CC status: OFF\n"},
+		{name: "devtools mode is reported separately", out: "CC status: ON\nCC DevTools: OFF\n", want: true},
+		{name: "unrelated output", out: "No devices were found\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseConfidentialComputeState(tt.out); got != tt.want {
+				t.Errorf("parseConfidentialComputeState() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
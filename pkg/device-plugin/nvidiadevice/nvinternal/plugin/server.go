@@ -44,17 +44,24 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	spec "github.com/NVIDIA/k8s-device-plugin/api/config/v1"
 	"github.com/google/uuid"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 	kubeletdevicepluginv1beta1 "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
 	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
 
+	"github.com/Project-HAMi/HAMi/pkg/audit"
 	"github.com/Project-HAMi/HAMi/pkg/device"
 	"github.com/Project-HAMi/HAMi/pkg/device-plugin/nvidiadevice/nvinternal/cdi"
 	"github.com/Project-HAMi/HAMi/pkg/device-plugin/nvidiadevice/nvinternal/rm"
@@ -72,6 +79,46 @@ const (
 var (
 	hostHookPath string
 	ConfigFile   *string
+	// UtilizationSampleInterval is how often the live device utilization is published. 0 disables it.
+	UtilizationSampleInterval time.Duration
+	// EnergySampleInterval is how often the energy of the cards is sampled and attributed to the pods on them. 0 disables it.
+	EnergySampleInterval time.Duration
+	// AllocateFailureThreshold is the number of consecutive Allocate failures after which a card is quarantined. 0 disables it.
+	AllocateFailureThreshold = 3
+	// QuarantineBackoff is how long a card stays quarantined the first time.
+	QuarantineBackoff = 5 * time.Minute
+	// ListAndWatchDebounce is how long ListAndWatch waits after a change of the devices before it
+	// sends them, so rapid changes like health flaps are sent once. 0 sends them right away.
+	ListAndWatchDebounce = time.Second
+	// DrainTimeout is how long Stop waits for in-flight Allocate calls to finish.
+	DrainTimeout = 10 * time.Second
+	// CoTenantXidPolicy is applied to the co-tenants of a card hit by an application Xid right
+	// after another of its co-tenants exited: "restart", "reschedule" or empty to disable it.
+	CoTenantXidPolicy string
+	// CoTenantXidWindow is how long after a co-tenant exited an Xid is attributed to its exit.
+	CoTenantXidWindow = 30 * time.Second
+	// MigAutoReconfig lets the plugin re-partition idle cards in mig mode for pending pods, on nodes
+	// carrying the util.MigReconfigNodeLabel label.
+	MigAutoReconfig bool
+	// MigReconfigInterval is how often the pending pods are checked by MigAutoReconfig.
+	MigReconfigInterval = time.Minute
+	// MemoryPressureThreshold is the fraction of the memory of a card in use at which a best-effort
+	// pod is evicted from it. 0 disables it.
+	MemoryPressureThreshold float64
+	// StockPluginResource is the resource of the stock NVIDIA device plugin running next to HAMi,
+	// e.g. nvidia.com/gpu. The cards it hands out to pods are withdrawn. Empty disables it.
+	StockPluginResource string
+	// TextfilePath is the file the per-card metrics are written to for the textfile collector of
+	// node-exporter, ending in .prom. Empty disables it.
+	TextfilePath string
+	// TextfileInterval is how often the textfile is written.
+	TextfileInterval = time.Minute
+	// WakeIdleGPUs locks the graphics clock of the cards found in a low power state before they
+	// are registered, so they stay ready to run kernels.
+	WakeIdleGPUs bool
+	// Auditor records the devices Allocate hands to the containers of a pod in the audit trail.
+	// Nil disables it.
+	Auditor *audit.Recorder
 )
 
 func init() {
@@ -81,21 +128,63 @@ func init() {
 // NvidiaDevicePlugin implements the Kubernetes device plugin API
 type NvidiaDevicePlugin struct {
 	rm                   rm.ResourceManager
+	discoverer           DeviceDiscoverer
 	config               *nvidia.DeviceConfig
 	deviceListEnvvar     string
 	deviceListStrategies spec.DeviceListStrategies
 	socket               string
-	schedulerConfig      nvidia.NvidiaConfig
+	// kubeletSocket is the registration socket of the kubelet.
+	kubeletSocket   string
+	schedulerConfig nvidia.NvidiaConfig
 
 	cdiHandler          cdi.Interface
 	cdiEnabled          bool
 	cdiAnnotationPrefix string
 
 	operatingMode string
-	migCurrent    nvidia.MigPartedSpec
+	// migMutex guards migCurrent, which the MIG reconfigurer updates next to Allocate.
+	migMutex   sync.Mutex
+	migCurrent nvidia.MigPartedSpec
+	// migReconfig re-partitions idle cards for pending pods when MigAutoReconfig is set.
+	migReconfig *migReconfigurer
+	// memoryTotals remembers the last registered memory of each device, so a
+	// change after a driver update or ECC toggle can be reported.
+	memoryTotals map[string]int32
+	// quarantine withdraws cards whose allocations keep failing.
+	quarantine *cardQuarantine
+	// ecc remembers the ECC error counts of the cards, to publish the recent ones.
+	ecc *eccTracker
+	// temperatures remembers the temperatures published for the cards, to decay them.
+	temperatures *temperatureTracker
+	// waker wakes idle cards when WakeIdleGPUs is set.
+	waker *cardWaker
+	// inflight tracks the Allocate calls Stop has to wait for.
+	inflight *inflightTracker
+	// checkpoint remembers the devices Allocate handed out, it is flushed by Stop.
+	checkpoint *assignmentCheckpoint
+	// dra serves ResourceClaims when EnableDRA is set.
+	dra *draNodePlugin
+	// fabricHealth is the last reported health of the NVLink fabric of the node.
+	fabricHealth string
+	nodeEvents   record.EventRecorder
+	// cotenants restarts the co-tenants of a card after an Xid left by an exiting one.
+	cotenants *coTenantGuard
+	// pressure evicts best-effort pods from cards running out of memory.
+	pressure *memoryPressureGuard
+	// stock tracks the cards the stock device plugin handed out when StockPluginResource is set.
+	stock *stockPluginCards
+	// textfile writes the per-card metrics for node-exporter when TextfilePath is set.
+	textfile *textfileExporter
+	// coreOvercommitReported is set once the node was cordoned for pods holding more cores than
+	// advertised, until they fit again.
+	coreOvercommitReported bool
+	// serving is set while the plugin is registered with the kubelet.
+	serving atomic.Bool
+	// registeredAt is the time of the last registration of the devices on the node, in Unix nanoseconds.
+	registeredAt atomic.Int64
 
 	server *grpc.Server
-	health chan *rm.Device
+	health chan device.UnhealthyDevice
 	stop   chan any
 }
 
@@ -126,6 +215,25 @@ func readFromConfigFile(sConfig *nvidia.NvidiaConfig) (string, error) {
 			if val.FilterDevice != nil && (len(val.FilterDevice.UUID) > 0 || len(val.FilterDevice.Index) > 0) {
 				nvidia.DevicePluginFilterDevice = val.FilterDevice
 			}
+			if val.SystemReserved != nil && (len(val.SystemReserved.Index) > 0 || val.SystemReserved.Count > 0) {
+				nvidia.DevicePluginSystemReserved = val.SystemReserved
+				klog.Infof("SystemReserved: %v", val.SystemReserved)
+			}
+			if val.CoreReservation != nil && val.CoreReservation.Cores > 0 {
+				if val.CoreReservation.Cores >= 100 {
+					klog.Errorf("core reservation of %d%% leaves no cores to advertise, ignoring it", val.CoreReservation.Cores)
+				} else {
+					nvidia.DevicePluginCoreReservation = val.CoreReservation
+					klog.Infof("CoreReservation: %v", val.CoreReservation)
+					if reason := unenforcedCoreReservation(sConfig); reason != "" {
+						klog.Warningf("core reservation of %d%% isn't enforced, %s: containers aren't throttled to their core limits and may use the cores held back", val.CoreReservation.Cores, reason)
+					}
+				}
+			}
+			if val.HealthConditions != nil {
+				nvidia.DevicePluginHealthConditions = val.HealthConditions
+				klog.Infof("HealthConditions: %+v", *val.HealthConditions)
+			}
 			if len(val.OperatingMode) > 0 {
 				mode = val.OperatingMode
 			}
@@ -159,18 +267,51 @@ func NewNvidiaDevicePlugin(config *nvidia.DeviceConfig, resourceManager rm.Resou
 	if err := device.InitDevicesWithConfig(sConfig); err != nil {
 		klog.Fatalf("failed to initialize devices: %v", err)
 	}
+	cotenants, err := newCoTenantGuard(CoTenantXidPolicy, CoTenantXidWindow)
+	if err != nil {
+		klog.Fatalf("failed to initialize the co-tenant guard: %v", err)
+	}
+	pressure, err := newMemoryPressureGuard(MemoryPressureThreshold)
+	if err != nil {
+		klog.Fatalf("failed to initialize the memory pressure guard: %v", err)
+	}
+	textfile, err := newTextfileExporter(TextfilePath, TextfileInterval)
+	if err != nil {
+		klog.Fatalf("failed to initialize the textfile metrics: %v", err)
+	}
+	discoverer, err := NewDeviceDiscoverer()
+	if err != nil {
+		klog.Fatalf("failed to initialize the device discovery: %v", err)
+	}
+	switch RuntimeCheck {
+	case RuntimeCheckOff, RuntimeCheckWarn, RuntimeCheckEnforce:
+	default:
+		klog.Fatalf("invalid runtime check %q, must be %s, %s or %s", RuntimeCheck, RuntimeCheckWarn, RuntimeCheckEnforce, RuntimeCheckOff)
+	}
 	return &NvidiaDevicePlugin{
 		rm:                   resourceManager,
+		discoverer:           discoverer,
 		config:               config,
 		deviceListEnvvar:     "NVIDIA_VISIBLE_DEVICES",
 		deviceListStrategies: deviceListStrategies,
 		socket:               kubeletdevicepluginv1beta1.DevicePluginPath + "nvidia-" + name + ".sock",
+		kubeletSocket:        kubeletdevicepluginv1beta1.KubeletSocket,
 		cdiHandler:           cdiHandler,
 		cdiEnabled:           cdiEnabled,
 		cdiAnnotationPrefix:  *config.Flags.Plugin.CDIAnnotationPrefix,
 		schedulerConfig:      sConfig.NvidiaConfig,
 		operatingMode:        mode,
 		migCurrent:           nvidia.MigPartedSpec{},
+		quarantine:           newCardQuarantine(AllocateFailureThreshold, QuarantineBackoff),
+		ecc:                  newECCTracker(),
+		temperatures:         newTemperatureTracker(),
+		waker:                newCardWaker(WakeIdleGPUs),
+		cotenants:            cotenants,
+		pressure:             pressure,
+		stock:                newStockPluginCards(StockPluginResource, string(resourceManager.Resource())),
+		textfile:             textfile,
+		migReconfig:          newMigReconfigurer(MigAutoReconfig && mode == "mig", MigReconfigInterval),
+		checkpoint:           newAssignmentCheckpoint(assignmentCheckpointPath(string(resourceManager.Resource()))),
 
 		// These will be reinitialized every
 		// time the plugin server is restarted.
@@ -182,7 +323,8 @@ func NewNvidiaDevicePlugin(config *nvidia.DeviceConfig, resourceManager rm.Resou
 
 func (plugin *NvidiaDevicePlugin) initialize() {
 	plugin.server = grpc.NewServer([]grpc.ServerOption{}...)
-	plugin.health = make(chan *rm.Device)
+	plugin.inflight = &inflightTracker{}
+	plugin.health = make(chan device.UnhealthyDevice)
 	plugin.stop = make(chan any)
 }
 
@@ -203,10 +345,14 @@ func (plugin *NvidiaDevicePlugin) Devices() rm.Devices {
 func (plugin *NvidiaDevicePlugin) Start() error {
 	plugin.initialize()
 
-	deviceNumbers, err := GetDeviceNums()
+	deviceNumbers, err := GetDeviceNums(plugin.discoverer)
 	if err != nil {
 		return err
 	}
+	if err := plugin.checkRuntime(); err != nil {
+		return err
+	}
+	plugin.reconcileAssignments()
 
 	err = plugin.Serve()
 	if err != nil {
@@ -224,6 +370,18 @@ func (plugin *NvidiaDevicePlugin) Start() error {
 	}
 	klog.Infof("Registered device plugin for '%s' with Kubelet", plugin.rm.Resource())
 
+	if EnableDRA {
+		plugin.dra, err = newDRANodePlugin(plugin)
+		if err == nil {
+			err = plugin.dra.Start()
+		}
+		if err != nil {
+			klog.Infof("Could not start DRA driver: %s", err)
+			plugin.Stop()
+			return err
+		}
+	}
+
 	if plugin.operatingMode == "mig" {
 		cmd := exec.Command("nvidia-mig-parted", "export")
 		var stdout, stderr bytes.Buffer
@@ -246,8 +404,11 @@ func (plugin *NvidiaDevicePlugin) Start() error {
 		}
 		klog.Infoln("Mig export", plugin.migCurrent)
 	}
+	if plugin.migReconfig != nil {
+		go plugin.WatchMigDemand(plugin.stop)
+	}
 	go func() {
-		err := plugin.rm.CheckHealth(plugin.stop, plugin.health)
+		err := plugin.healthChecker().CheckHealth(plugin.stop, plugin.rm.Devices().GetIDs(), plugin.health)
 		if err != nil {
 			klog.Infof("Failed to start health check: %v; continuing with health checks disabled", err)
 		}
@@ -257,15 +418,44 @@ func (plugin *NvidiaDevicePlugin) Start() error {
 		plugin.WatchAndRegister()
 	}()
 
+	if UtilizationSampleInterval > 0 {
+		go plugin.WatchUtilization(UtilizationSampleInterval, plugin.stop)
+	}
+	if EnergySampleInterval > 0 {
+		go plugin.WatchEnergy(EnergySampleInterval, plugin.stop)
+	}
+	if plugin.pressure != nil {
+		go plugin.WatchMemoryPressure(plugin.stop)
+	}
+	if plugin.stock != nil {
+		go plugin.WatchStockPluginCards(plugin.stop)
+	}
+	if plugin.textfile != nil {
+		go plugin.WriteTextfileMetrics(plugin.stop)
+	}
+
+	plugin.serving.Store(true)
 	return nil
 }
 
-// Stop stops the gRPC server.
+// Stop stops the gRPC server. New Allocate and ListAndWatch calls are rejected
+// right away, while the in-flight Allocate calls get up to DrainTimeout to finish
+// writing their assignment to the pod before the assignment checkpoint is flushed
+// and the server goes down.
 func (plugin *NvidiaDevicePlugin) Stop() error {
 	if plugin == nil || plugin.server == nil {
 		return nil
 	}
 	klog.Infof("Stopping to serve '%s' on %s", plugin.rm.Resource(), plugin.socket)
+	plugin.serving.Store(false)
+	if !plugin.inflight.drain(DrainTimeout) {
+		klog.Warningf("Timed out after %s waiting for in-flight Allocate calls of '%s'", DrainTimeout, plugin.rm.Resource())
+	}
+	if err := plugin.checkpoint.flush(); err != nil {
+		klog.Warningf("Failed to flush the assignment checkpoint of '%s': %v", plugin.rm.Resource(), err)
+	}
+	plugin.dra.Stop()
+	plugin.dra = nil
 	plugin.server.Stop()
 	if err := os.Remove(plugin.socket); err != nil && !os.IsNotExist(err) {
 		return err
@@ -326,7 +516,7 @@ func (plugin *NvidiaDevicePlugin) Serve() error {
 
 // Register registers the device plugin for the given resourceName with Kubelet.
 func (plugin *NvidiaDevicePlugin) Register() error {
-	conn, err := plugin.dial(kubeletdevicepluginv1beta1.KubeletSocket, 5*time.Second)
+	conn, err := plugin.dial(plugin.kubeletSocket, 5*time.Second)
 	if err != nil {
 		return err
 	}
@@ -359,17 +549,33 @@ func (plugin *NvidiaDevicePlugin) GetDevicePluginOptions(context.Context, *kubel
 
 // ListAndWatch lists devices and update that list according to the health status
 func (plugin *NvidiaDevicePlugin) ListAndWatch(e *kubeletdevicepluginv1beta1.Empty, s kubeletdevicepluginv1beta1.DevicePlugin_ListAndWatchServer) error {
-	s.Send(&kubeletdevicepluginv1beta1.ListAndWatchResponse{Devices: plugin.apiDevices()})
+	if !plugin.inflight.accepting() {
+		return status.Error(codes.Unavailable, "device plugin is shutting down")
+	}
+	stream := &listWatchStream{resource: string(plugin.rm.Resource()), send: s.Send}
+	if err := stream.update(plugin.apiDevices()); err != nil {
+		return err
+	}
 
+	// flush is the pending update of the changes since the last one, nil if none.
+	var flush <-chan time.Time
 	for {
 		select {
 		case <-plugin.stop:
 			return nil
-		case d := <-plugin.health:
-			// FIXME: there is no way to recover from the Unhealthy state.
-			d.Health = kubeletdevicepluginv1beta1.Unhealthy
-			klog.Infof("'%s' device marked unhealthy: %s", plugin.rm.Resource(), d.ID)
-			s.Send(&kubeletdevicepluginv1beta1.ListAndWatchResponse{Devices: plugin.apiDevices()})
+		case <-plugin.quarantine.changes():
+			flush = stream.changed(flush)
+		case <-plugin.stock.changes():
+			flush = stream.changed(flush)
+		case u := <-plugin.health:
+			if plugin.markUnhealthy(u) {
+				flush = stream.changed(flush)
+			}
+		case <-flush:
+			flush = nil
+			if err := stream.update(plugin.apiDevices()); err != nil {
+				return err
+			}
 		}
 	}
 }
@@ -395,6 +601,10 @@ func (plugin *NvidiaDevicePlugin) GetPreferredAllocation(ctx context.Context, r
 // Allocate which return list of devices.
 func (plugin *NvidiaDevicePlugin) Allocate(ctx context.Context, reqs *kubeletdevicepluginv1beta1.AllocateRequest) (*kubeletdevicepluginv1beta1.AllocateResponse, error) {
 	klog.InfoS("Allocate", "request", reqs)
+	if !plugin.inflight.acquire() {
+		return nil, status.Error(codes.Unavailable, "device plugin is shutting down")
+	}
+	defer plugin.inflight.release()
 	responses := kubeletdevicepluginv1beta1.AllocateResponse{}
 	nodename := os.Getenv(util.NodeNameEnvName)
 	current, err := util.GetPendingPod(ctx, nodename)
@@ -403,6 +613,7 @@ func (plugin *NvidiaDevicePlugin) Allocate(ctx context.Context, reqs *kubeletdev
 		return &kubeletdevicepluginv1beta1.AllocateResponse{}, err
 	}
 	klog.Infof("Allocate pod name is %s/%s, annotation is %+v", current.Namespace, current.Name, current.Annotations)
+	assigned := make(map[string]util.ContainerDevices)
 
 	for idx, req := range reqs.ContainerRequests {
 		// If the devices being allocated are replicas, then (conditionally)
@@ -440,10 +651,27 @@ func (plugin *NvidiaDevicePlugin) Allocate(ctx context.Context, reqs *kubeletdev
 				device.PodAllocationFailed(nodename, current, NodeLockNvidia)
 				return &kubeletdevicepluginv1beta1.AllocateResponse{}, errors.New("device number not matched")
 			}
-			response, err := plugin.getAllocateResponse(plugin.GetContainerDeviceStrArray(devreq))
+			for _, dev := range devreq {
+				if plugin.quarantine.quarantined(dev.UUID) {
+					device.PodAllocationFailed(nodename, current, NodeLockNvidia)
+					return &kubeletdevicepluginv1beta1.AllocateResponse{}, fmt.Errorf("device %s is quarantined after repeated allocation failures", dev.UUID)
+				}
+			}
+			devices, err := plugin.GetContainerDeviceStrArray(devreq)
 			if err != nil {
+				device.PodAllocationFailed(nodename, current, NodeLockNvidia)
+				return &kubeletdevicepluginv1beta1.AllocateResponse{}, err
+			}
+			response, err := plugin.getAllocateResponse(devices)
+			if err != nil {
+				for _, dev := range devreq {
+					plugin.quarantine.recordFailure(dev.UUID)
+				}
 				return nil, fmt.Errorf("failed to get allocate response: %v", err)
 			}
+			for _, dev := range devreq {
+				plugin.quarantine.recordSuccess(dev.UUID)
+			}
 
 			err = EraseNextDeviceTypeFromAnnotation(nvidia.NvidiaGPUDevice, *current)
 			if err != nil {
@@ -451,18 +679,25 @@ func (plugin *NvidiaDevicePlugin) Allocate(ctx context.Context, reqs *kubeletdev
 				return &kubeletdevicepluginv1beta1.AllocateResponse{}, err
 			}
 
-			if plugin.operatingMode != "mig" {
-				for i, dev := range devreq {
-					limitKey := fmt.Sprintf("CUDA_DEVICE_MEMORY_LIMIT_%v", i)
-					response.Envs[limitKey] = fmt.Sprintf("%vm", dev.Usedmem)
+			// Pods sharing the compute of a MIG instance are limited within it by HAMi-core.
+			if plugin.operatingMode != "mig" || current.Annotations[nvidia.MigSharedCompute] == "true" {
+				for k, v := range plugin.hamiCoreEnvs(devreq) {
+					response.Envs[k] = v
+				}
+				if wantsNCCLTopology(current, currentCtr) {
+					for k, v := range plugin.ncclTopologyEnvs(devreq) {
+						response.Envs[k] = v
+					}
 				}
-				response.Envs["CUDA_DEVICE_SM_LIMIT"] = fmt.Sprint(devreq[0].Usedcores)
-				response.Envs["CUDA_DEVICE_MEMORY_SHARED_CACHE"] = fmt.Sprintf("%s/vgpu/%v.cache", hostHookPath, uuid.New().String())
-				if plugin.schedulerConfig.DeviceMemoryScaling > 1 {
-					response.Envs["CUDA_OVERSUBSCRIBE"] = "true"
+				if current.Annotations[util.GPUWarmup] == "true" {
+					// The vGPU monitor finds the file in the cache directory of the container.
+					response.Envs[util.GPUWarmupDoneEnv] = fmt.Sprintf("%s/vgpu/%s", hostHookPath, util.GPUWarmupDoneFile)
 				}
-				if plugin.schedulerConfig.DisableCoreLimit {
-					response.Envs[util.CoreLimitSwitch] = "disable"
+				if current.Annotations[util.ScaleDownCheckpoint] == "true" {
+					// The vGPU monitor creates the pending file and finds the ready file in the cache
+					// directory of the container.
+					response.Envs[util.ScaleDownPendingEnv] = fmt.Sprintf("%s/vgpu/%s", hostHookPath, util.ScaleDownPendingFile)
+					response.Envs[util.ScaleDownReadyEnv] = fmt.Sprintf("%s/vgpu/%s", hostHookPath, util.ScaleDownReadyFile)
 				}
 				cacheFileHostDirectory := fmt.Sprintf("%s/vgpu/containers/%s_%s", hostHookPath, current.UID, currentCtr.Name)
 				os.RemoveAll(cacheFileHostDirectory)
@@ -515,14 +750,47 @@ func (plugin *NvidiaDevicePlugin) Allocate(ctx context.Context, reqs *kubeletdev
 					})
 				}
 			}
+			assigned[currentCtr.Name] = devreq
 			responses.ContainerResponses = append(responses.ContainerResponses, response)
 		}
 	}
 	klog.Infoln("Allocate Response", responses.ContainerResponses)
+	for ctr, devreq := range assigned {
+		plugin.checkpoint.record(current, ctr, devreq, time.Now())
+	}
 	device.PodAllocationTrySuccess(nodename, nvidia.NvidiaGPUDevice, NodeLockNvidia, current)
+	Auditor.Record(allocationAuditEvent(current, nodename, assigned))
 	return &responses, nil
 }
 
+// allocationAuditEvent returns the audit event of the devices Allocate assigned to the
+// containers of pod, by container name.
+func allocationAuditEvent(pod *corev1.Pod, nodename string, assigned map[string]util.ContainerDevices) audit.AllocationEvent {
+	ctrdevs := make(util.PodSingleDevice, len(pod.Spec.Containers))
+	for i, ctr := range pod.Spec.Containers {
+		ctrdevs[i] = assigned[ctr.Name]
+	}
+	return audit.NewAllocationEvent(audit.EventAllocated, pod, nodename, util.PodDevices{nvidia.NvidiaGPUDevice: ctrdevs})
+}
+
+// hamiCoreEnvs returns the environment HAMi-core enforces the limits of devreq with.
+func (plugin *NvidiaDevicePlugin) hamiCoreEnvs(devreq util.ContainerDevices) map[string]string {
+	envs := make(map[string]string)
+	for i, dev := range devreq {
+		limitKey := fmt.Sprintf("CUDA_DEVICE_MEMORY_LIMIT_%v", i)
+		envs[limitKey] = util.MemoryLimitEnvValue(dev.Usedmem)
+	}
+	envs["CUDA_DEVICE_SM_LIMIT"] = fmt.Sprint(devreq[0].Usedcores)
+	envs["CUDA_DEVICE_MEMORY_SHARED_CACHE"] = fmt.Sprintf("%s/vgpu/%v.cache", hostHookPath, uuid.New().String())
+	if plugin.schedulerConfig.DeviceMemoryScaling > 1 {
+		envs["CUDA_OVERSUBSCRIBE"] = "true"
+	}
+	if plugin.schedulerConfig.DisableCoreLimit {
+		envs[util.CoreLimitSwitch] = "disable"
+	}
+	return envs
+}
+
 func (plugin *NvidiaDevicePlugin) getAllocateResponse(requestIds []string) (*kubeletdevicepluginv1beta1.ContainerAllocateResponse, error) {
 	deviceIDs := plugin.deviceIDsFromAnnotatedDeviceIDs(requestIds)
 
@@ -643,7 +911,17 @@ func (plugin *NvidiaDevicePlugin) deviceIDsFromAnnotatedDeviceIDs(ids []string)
 }
 
 func (plugin *NvidiaDevicePlugin) apiDevices() []*kubeletdevicepluginv1beta1.Device {
-	return plugin.rm.Devices().GetPluginDevices(plugin.schedulerConfig.DeviceSplitCount)
+	devs := plugin.rm.Devices().GetPluginDevices(plugin.schedulerConfig.DeviceSplitCount)
+	for i, d := range devs {
+		if plugin.quarantine.quarantined(d.ID) || plugin.stock.held(d.ID) {
+			// In MIG mode the devices are the ones of the resource manager, whose health
+			// the health checks own, so a copy is marked.
+			unhealthy := *d
+			unhealthy.Health = kubeletdevicepluginv1beta1.Unhealthy
+			devs[i] = &unhealthy
+		}
+	}
+	return devs
 }
 
 func (plugin *NvidiaDevicePlugin) apiEnvs(envvar string, deviceIDs []string) map[string]string {
@@ -661,6 +939,8 @@ func (plugin *NvidiaDevicePlugin) apiDeviceSpecs(driverRoot string, ids []string
 	}
 
 	paths := plugin.rm.GetDevicePaths(ids)
+	// Instances of dynamic MIG, e.g. several of one profile for a single container.
+	paths = append(paths, migDevicePaths(ids, plugin.rm.Devices().Contains)...)
 
 	var specs []*kubeletdevicepluginv1beta1.DeviceSpec
 	for _, p := range paths {
@@ -37,9 +37,13 @@ import (
 	"testing"
 
 	v1 "github.com/NVIDIA/k8s-device-plugin/api/config/v1"
+	"github.com/Project-HAMi/HAMi/pkg/audit"
 	"github.com/Project-HAMi/HAMi/pkg/device-plugin/nvidiadevice/nvinternal/cdi"
 	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
 	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kubeletdevicepluginv1beta1 "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
 )
 
@@ -198,3 +202,23 @@ func Test_pathGeneration(t *testing.T) {
 		t.Errorf("Expected %s, got %s", expected, result)
 	}
 }
+
+func TestAllocationAuditEvent(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "p1", Namespace: "default", UID: "uid-1"},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "init"}, {Name: "gpu"}}},
+	}
+	ev := allocationAuditEvent(pod, "node1", map[string]util.ContainerDevices{
+		"gpu": {{UUID: "GPU-0", Type: nvidia.NvidiaGPUDevice, Usedmem: 1024, Usedcores: 30}},
+	})
+	require.Equal(t, audit.EventAllocated, ev.Type)
+	require.Equal(t, "node1", ev.Node)
+	require.Equal(t, []audit.DeviceRecord{{
+		Vendor:       nvidia.NvidiaGPUDevice,
+		ContainerIdx: 1,
+		Container:    "gpu",
+		UUID:         "GPU-0",
+		Usedmem:      1024,
+		Usedcores:    30,
+	}}, ev.Devices)
+}
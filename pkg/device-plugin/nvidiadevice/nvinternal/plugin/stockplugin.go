@@ -0,0 +1,218 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"k8s.io/klog/v2"
+	podresourcesv1 "k8s.io/kubelet/pkg/apis/podresources/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device-plugin/nvidiadevice/nvinternal/rm"
+)
+
+const (
+	// podResourcesSocket is the pod resources API of the kubelet.
+	podResourcesSocket = "/var/lib/kubelet/pod-resources/kubelet.sock"
+	// stockPluginInterval is how often the cards handed out by the stock plugin are listed.
+	stockPluginInterval = 15 * time.Second
+)
+
+// stockPluginCards tracks the cards the stock NVIDIA device plugin handed out to pods, when
+// it runs next to HAMi on a node, e.g. while migrating. Those cards are reported unhealthy and
+// registered as held externally, so HAMi doesn't place its pods on a card another pod owns entirely.
+// A nil *stockPluginCards holds no card.
+type stockPluginCards struct {
+	resource string
+	list     func(ctx context.Context) ([]*podresourcesv1.PodResources, error)
+
+	mutex sync.Mutex
+	// cards are the UUIDs of the held cards, with the pod holding each.
+	cards   map[string]string
+	changed chan struct{}
+}
+
+// newStockPluginCards returns the tracker of the cards of resource, or nil if resource is
+// empty or the resource of HAMi itself.
+func newStockPluginCards(resource, own string) *stockPluginCards {
+	if resource == "" {
+		return nil
+	}
+	if resource == own {
+		klog.Warningf("stock plugin resource %s is the resource of HAMi, ignoring it", resource)
+		return nil
+	}
+	return &stockPluginCards{
+		resource: resource,
+		list:     listPodResources,
+		cards:    make(map[string]string),
+		changed:  make(chan struct{}, 1),
+	}
+}
+
+// listPodResources lists the devices of the pods on the node through the kubelet.
+func listPodResources(ctx context.Context) ([]*podresourcesv1.PodResources, error) {
+	conn, err := grpc.DialContext(ctx, podResourcesSocket,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", addr)
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	resp, err := podresourcesv1.NewPodResourcesListerClient(conn).List(ctx, &podresourcesv1.ListPodResourcesRequest{})
+	if err != nil {
+		return nil, err
+	}
+	return resp.GetPodResources(), nil
+}
+
+// stockHeldCards returns the cards of the node the containers of pods got as resource, with
+// the pod holding each. ids maps the device IDs the stock plugin may use, UUIDs or indexes,
+// to the UUID of the card.
+func stockHeldCards(pods []*podresourcesv1.PodResources, resource string, ids map[string]string) map[string]string {
+	held := make(map[string]string)
+	for _, p := range pods {
+		for _, c := range p.GetContainers() {
+			for _, d := range c.GetDevices() {
+				if d.GetResourceName() != resource {
+					continue
+				}
+				for _, id := range d.GetDeviceIds() {
+					if uuid, ok := ids[id]; ok {
+						held[uuid] = p.GetNamespace() + "/" + p.GetName()
+					}
+				}
+			}
+		}
+	}
+	return held
+}
+
+// stockPluginIDs maps the UUIDs and indexes of devices to their UUIDs.
+func stockPluginIDs(devices rm.Devices) map[string]string {
+	ids := make(map[string]string, 2*len(devices))
+	for _, d := range devices {
+		ids[d.ID] = d.ID
+		if d.Index != "" {
+			ids[d.Index] = d.ID
+		}
+	}
+	return ids
+}
+
+// refresh lists the cards of devices held by the stock plugin, and signals changes() if they changed.
+func (s *stockPluginCards) refresh(ctx context.Context, devices rm.Devices) error {
+	pods, err := s.list(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list pod resources: %w", err)
+	}
+	held := stockHeldCards(pods, s.resource, stockPluginIDs(devices))
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if maps.Equal(held, s.cards) {
+		return nil
+	}
+	for uuid, pod := range held {
+		if _, ok := s.cards[uuid]; !ok {
+			klog.Warningf("device %s was handed out as %s to pod %s by another device plugin, withdrawing it", uuid, s.resource, pod)
+		}
+	}
+	for uuid := range s.cards {
+		if _, ok := held[uuid]; !ok {
+			klog.Infof("device %s is no longer held by a %s pod, advertising it again", uuid, s.resource)
+		}
+	}
+	s.cards = held
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// held reports whether the stock plugin handed out card. id may also be a replica ID as
+// handed to the kubelet, i.e. the card UUID followed by "-<replica>".
+func (s *stockPluginCards) held(id string) bool {
+	if s == nil {
+		return false
+	}
+	id = cardID(id)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.cards[id]; ok {
+		return true
+	}
+	if i := strings.LastIndex(id, "-"); i > 0 {
+		_, ok := s.cards[id[:i]]
+		return ok
+	}
+	return false
+}
+
+// changes is signalled whenever a card is handed out or given back by the stock plugin.
+func (s *stockPluginCards) changes() <-chan struct{} {
+	if s == nil {
+		return nil
+	}
+	return s.changed
+}
+
+// WatchStockPluginCards lists the cards handed out by the stock plugin every stockPluginInterval until stop is closed.
+func (plugin *NvidiaDevicePlugin) WatchStockPluginCards(stop <-chan any) {
+	klog.InfoS("Starting WatchStockPluginCards", "resource", plugin.stock.resource)
+	ticker := time.NewTicker(stockPluginInterval)
+	defer ticker.Stop()
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), stockPluginInterval)
+		if err := plugin.stock.refresh(ctx, plugin.Devices()); err != nil {
+			klog.ErrorS(err, "Failed to check the cards of the stock device plugin", "resource", plugin.stock.resource)
+		}
+		cancel()
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,148 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	kubeletdevicepluginv1beta1 "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+	podresourcesv1 "k8s.io/kubelet/pkg/apis/podresources/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device-plugin/nvidiadevice/nvinternal/rm"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+)
+
+func stockPluginPod(name, resource string, ids ...string) *podresourcesv1.PodResources {
+	return &podresourcesv1.PodResources{
+		Name:      name,
+		Namespace: "default",
+		Containers: []*podresourcesv1.ContainerResources{{
+			Name:    "ctr",
+			Devices: []*podresourcesv1.ContainerDevices{{ResourceName: resource, DeviceIds: ids}},
+		}},
+	}
+}
+
+func stockPluginDevices() rm.Devices {
+	devices := rm.Devices{}
+	for i, id := range []string{"GPU-0", "GPU-1", "GPU-2"} {
+		devices[id] = &rm.Device{
+			Device: kubeletdevicepluginv1beta1.Device{ID: id, Health: kubeletdevicepluginv1beta1.Healthy},
+			Index:  string(rune('0' + i)),
+		}
+	}
+	return devices
+}
+
+func TestNewStockPluginCards(t *testing.T) {
+	require.Nil(t, newStockPluginCards("", "hami.io/vgpu"))
+	require.Nil(t, newStockPluginCards("nvidia.com/gpu", "nvidia.com/gpu"))
+	require.NotNil(t, newStockPluginCards("nvidia.com/gpu", "hami.io/vgpu"))
+
+	var none *stockPluginCards
+	require.False(t, none.held("GPU-0"))
+	require.Nil(t, none.changes())
+}
+
+func TestStockPluginCards(t *testing.T) {
+	var pods []*podresourcesv1.PodResources
+	s := newStockPluginCards("nvidia.com/gpu", "hami.io/vgpu")
+	s.list = func(context.Context) ([]*podresourcesv1.PodResources, error) { return pods, nil }
+
+	// A stock-plugin pod holds GPU-1 by UUID and one GPU-2 by index, a HAMi pod shares GPU-0.
+	pods = []*podresourcesv1.PodResources{
+		stockPluginPod("stock-uuid", "nvidia.com/gpu", "GPU-1"),
+		stockPluginPod("stock-index", "nvidia.com/gpu", "2"),
+		stockPluginPod("hami", "hami.io/vgpu", "GPU-0-0"),
+		stockPluginPod("other", "example.com/fpga", "GPU-0"),
+	}
+	require.NoError(t, s.refresh(context.Background(), stockPluginDevices()))
+	require.False(t, s.held("GPU-0"))
+	require.True(t, s.held("GPU-1"))
+	require.True(t, s.held("GPU-1-3"), "replica IDs map to their card")
+	require.True(t, s.held("GPU-2"))
+	select {
+	case <-s.changes():
+	default:
+		t.Fatal("expected a change notification")
+	}
+
+	// The HAMi resource only advertises the free GPU to the kubelet.
+	plugin := &NvidiaDevicePlugin{
+		rm:              &fakeResourceManager{devices: stockPluginDevices()},
+		schedulerConfig: nvidia.NvidiaConfig{DeviceSplitCount: 2},
+		stock:           s,
+	}
+	healthy := 0
+	for _, d := range plugin.apiDevices() {
+		if d.Health == kubeletdevicepluginv1beta1.Healthy {
+			require.Contains(t, []string{"GPU-0-0", "GPU-0-1"}, d.ID)
+			healthy++
+		}
+	}
+	require.Equal(t, 2, healthy)
+
+	// Nothing changed, no notification.
+	require.NoError(t, s.refresh(context.Background(), stockPluginDevices()))
+	select {
+	case <-s.changes():
+		t.Fatal("unexpected change notification")
+	default:
+	}
+
+	// The stock-plugin pods are gone, the GPUs are advertised again.
+	pods = pods[2:]
+	require.NoError(t, s.refresh(context.Background(), stockPluginDevices()))
+	require.False(t, s.held("GPU-1"))
+	require.False(t, s.held("GPU-2"))
+	<-s.changes()
+
+	// A failing kubelet keeps the last known cards.
+	pods = []*podresourcesv1.PodResources{stockPluginPod("stock-uuid", "nvidia.com/gpu", "GPU-1")}
+	require.NoError(t, s.refresh(context.Background(), stockPluginDevices()))
+	s.list = func(context.Context) ([]*podresourcesv1.PodResources, error) { return nil, errors.New("kubelet down") }
+	require.Error(t, s.refresh(context.Background(), stockPluginDevices()))
+	require.True(t, s.held("GPU-1"))
+}
+
+func TestStockHeldCards(t *testing.T) {
+	ids := stockPluginIDs(stockPluginDevices())
+	held := stockHeldCards([]*podresourcesv1.PodResources{
+		stockPluginPod("a", "nvidia.com/gpu", "0", "GPU-9"),
+	}, "nvidia.com/gpu", ids)
+	require.Equal(t, map[string]string{"GPU-0": "default/a"}, held)
+	require.Empty(t, stockHeldCards(nil, "nvidia.com/gpu", ids))
+}
@@ -0,0 +1,87 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"k8s.io/klog/v2"
+)
+
+// temperatureHalfLife is how fast the published temperature of a card follows a drop, so a card
+// which was hot a moment ago keeps counting as hot for a while, but not indefinitely.
+const temperatureHalfLife = 2 * time.Minute
+
+// temperatureSample is the temperature published for a card and when.
+type temperatureSample struct {
+	at      time.Time
+	celsius float64
+}
+
+// temperatureTracker remembers the temperature last published for every card, to decay it.
+type temperatureTracker struct {
+	mutex   sync.Mutex
+	samples map[string]temperatureSample
+}
+
+func newTemperatureTracker() *temperatureTracker {
+	return &temperatureTracker{samples: make(map[string]temperatureSample)}
+}
+
+// observe records the temperature of card read at now and returns the one to publish. A rise
+// is published at once, while a drop halves the gap to the temperature published before every
+// temperatureHalfLife.
+func (t *temperatureTracker) observe(card string, celsius uint32, now time.Time) *int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	cur := float64(celsius)
+	if prev, ok := t.samples[card]; ok && prev.celsius > cur {
+		cur += (prev.celsius - cur) * math.Pow(0.5, float64(now.Sub(prev.at))/float64(temperatureHalfLife))
+	}
+	t.samples[card] = temperatureSample{at: now, celsius: cur}
+	res := int(math.Round(cur))
+	return &res
+}
+
+// getTemperature reads the temperature of the GPU die of ndev, nil if NVML can't tell.
+func (plugin *NvidiaDevicePlugin) getTemperature(uuid string, ndev nvml.Device) *int {
+	celsius, ret := ndev.GetTemperature(nvml.TEMPERATURE_GPU)
+	if ret != nvml.SUCCESS {
+		klog.V(5).InfoS("failed to get the temperature", "uuid", uuid, "err", ret)
+		return nil
+	}
+	return plugin.temperatures.observe(uuid, celsius, time.Now())
+}
@@ -0,0 +1,60 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemperatureTracker(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	tr := newTemperatureTracker()
+	celsius := func(card string, c uint32, at time.Duration) int {
+		return *tr.observe(card, c, start.Add(at))
+	}
+
+	require.Equal(t, 60, celsius("GPU-0", 60, 0))
+	// A rise is published at once.
+	require.Equal(t, 90, celsius("GPU-0", 90, 30*time.Second))
+	// A drop halves the gap every half-life.
+	require.Equal(t, 75, celsius("GPU-0", 60, 30*time.Second+temperatureHalfLife))
+	require.Equal(t, 68, celsius("GPU-0", 60, 30*time.Second+2*temperatureHalfLife))
+	// Until the card counts as cool again.
+	require.Equal(t, 60, celsius("GPU-0", 60, 30*time.Second+10*temperatureHalfLife))
+
+	// Cards are tracked separately.
+	require.Equal(t, 40, celsius("GPU-1", 40, 30*time.Second+temperatureHalfLife))
+}
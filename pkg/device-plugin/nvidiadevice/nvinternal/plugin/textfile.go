@@ -0,0 +1,250 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+	"github.com/Project-HAMi/HAMi/pkg/util/client"
+)
+
+// textfileLabels are the labels of the per-card metrics written to the textfile, the same as
+// the ones of the scheduler metrics, so both can be joined.
+var textfileLabels = []string{"nodeid", "deviceuuid", "deviceidx", "devicetype"}
+
+// textfileExporter periodically writes the allocation and usage of the cards of the node to a
+// file of the textfile collector of node-exporter, for clusters which don't scrape HAMi itself.
+// A nil *textfileExporter writes nothing.
+type textfileExporter struct {
+	path     string
+	interval time.Duration
+
+	mutex sync.Mutex
+	// devices are the cards last registered on the node.
+	devices []*util.DeviceInfo
+}
+
+// newTextfileExporter returns the exporter writing to path every interval, or nil if path is
+// empty. node-exporter only reads files ending in .prom.
+func newTextfileExporter(path string, interval time.Duration) (*textfileExporter, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if filepath.Ext(path) != ".prom" {
+		return nil, fmt.Errorf("textfile path %s doesn't end in .prom, node-exporter would ignore it", path)
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("textfile interval %s is not positive", interval)
+	}
+	return &textfileExporter{path: path, interval: interval}, nil
+}
+
+// setDevices records the cards registered on the node.
+func (e *textfileExporter) setDevices(devices []*util.DeviceInfo) {
+	if e == nil {
+		return
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.devices = devices
+}
+
+func (e *textfileExporter) registeredDevices() []*util.DeviceInfo {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.devices
+}
+
+// textfileRegistry returns the metrics of the devices of node: their capacity, what the pods on
+// the node were allocated of them and the memory in use on the cards of used, as sampled from NVML.
+func textfileRegistry(node string, devices []*util.DeviceInfo, pods []corev1.Pod, used map[string]uint64) *prometheus.Registry {
+	gauge := func(name, help string) *prometheus.GaugeVec {
+		return prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, textfileLabels)
+	}
+	var (
+		memoryLimit     = gauge("hami_device_plugin_gpu_memory_limit_bytes", "Device memory registered for scheduling in bytes")
+		coreLimit       = gauge("hami_device_plugin_gpu_core_limit", "Device cores registered for scheduling in percent of the card")
+		memoryAllocated = gauge("hami_device_plugin_gpu_memory_allocated_bytes", "Device memory allocated to the pods on the node in bytes")
+		coreAllocated   = gauge("hami_device_plugin_gpu_core_allocated", "Device cores allocated to the pods on the node in percent of the card")
+		sharedNum       = gauge("hami_device_plugin_gpu_shared_containers", "Number of containers sharing the device")
+		memoryUsed      = gauge("hami_device_plugin_gpu_memory_used_bytes", "Device memory in use as reported by NVML in bytes")
+		healthy         = gauge("hami_device_plugin_gpu_healthy", "Whether the device is healthy")
+		quarantined     = gauge("hami_device_plugin_gpu_quarantined", "Whether the device is withdrawn from scheduling")
+		eccCorrected    = gauge("hami_device_plugin_gpu_ecc_corrected_errors", "Corrected ECC errors of the device since the driver was loaded")
+		eccUncorrected  = gauge("hami_device_plugin_gpu_ecc_uncorrected_errors", "Uncorrected ECC errors of the device since the driver was loaded")
+		pstate          = gauge("hami_device_plugin_gpu_performance_state", "Performance state of the device, 0 (highest) to 15 (lowest)")
+		temperature     = gauge("hami_device_plugin_gpu_temperature_celsius", "Temperature of the device in degrees Celsius as published to the scheduler")
+	)
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(memoryLimit, coreLimit, memoryAllocated, coreAllocated, sharedNum, memoryUsed, healthy, quarantined, eccCorrected, eccUncorrected, pstate, temperature)
+
+	type allocation struct {
+		mem        int64
+		cores      int32
+		containers int
+	}
+	allocated := make(map[string]*allocation)
+	for i := range pods {
+		p := &pods[i]
+		if p.Status.Phase == corev1.PodSucceeded || p.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		pd, err := util.DecodePodDevices(util.SupportDevices, p.Annotations)
+		if err != nil {
+			continue
+		}
+		for _, ctrdevs := range pd[nvidia.NvidiaGPUDevice] {
+			for _, d := range ctrdevs {
+				a, ok := allocated[cardID(d.UUID)]
+				if !ok {
+					a = &allocation{}
+					allocated[cardID(d.UUID)] = a
+				}
+				a.mem += d.Usedmem
+				a.cores += d.Usedcores
+				a.containers++
+			}
+		}
+	}
+
+	boolValue := func(b bool) float64 {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	for _, d := range devices {
+		labels := prometheus.Labels{"nodeid": node, "deviceuuid": d.ID, "deviceidx": strconv.Itoa(int(d.Index)), "devicetype": d.Type}
+		memoryLimit.With(labels).Set(float64(util.MemoryToBytes(nvidia.NvidiaGPUDevice, int64(d.Devmem))))
+		coreLimit.With(labels).Set(float64(d.Devcore))
+		a := allocated[d.ID]
+		if a == nil {
+			a = &allocation{}
+		}
+		memoryAllocated.With(labels).Set(float64(a.mem))
+		coreAllocated.With(labels).Set(float64(a.cores))
+		sharedNum.With(labels).Set(float64(a.containers))
+		if u, ok := used[d.ID]; ok {
+			memoryUsed.With(labels).Set(float64(u))
+		}
+		healthy.With(labels).Set(boolValue(d.Health))
+		quarantined.With(labels).Set(boolValue(d.Quarantined || d.Draining || d.HeldExternally))
+		if d.ECCErrors != nil {
+			eccCorrected.With(labels).Set(float64(d.ECCErrors.Corrected))
+			eccUncorrected.With(labels).Set(float64(d.ECCErrors.Uncorrected))
+		}
+		if d.PerformanceState != nil {
+			pstate.With(labels).Set(float64(*d.PerformanceState))
+		}
+		if d.Temperature != nil {
+			temperature.With(labels).Set(float64(*d.Temperature))
+		}
+	}
+	return reg
+}
+
+// sampleMemoryUsed reads the memory in use on every card from NVML. Cards NVML fails to sample
+// are left out.
+func (plugin *NvidiaDevicePlugin) sampleMemoryUsed() map[string]uint64 {
+	if err := initNVML(); err != nil {
+		if !errors.Is(err, errNoNVML) {
+			klog.Errorln(err)
+		}
+		return nil
+	}
+	res := make(map[string]uint64)
+	for UUID := range plugin.Devices() {
+		card := cardID(UUID)
+		ndev, ret := nvml.DeviceGetHandleByUUID(card)
+		if ret != nvml.SUCCESS {
+			klog.V(4).InfoS("failed to get device", "uuid", card, "err", ret)
+			continue
+		}
+		memory, ret := ndev.GetMemoryInfo()
+		if ret != nvml.SUCCESS {
+			klog.V(4).InfoS("failed to get memory info", "uuid", card, "err", ret)
+			continue
+		}
+		res[card] = memory.Used
+	}
+	return res
+}
+
+// writeTextfile writes the metrics of the cards last registered to the textfile. The file is
+// replaced atomically, so node-exporter never reads half of it.
+func (plugin *NvidiaDevicePlugin) writeTextfile() error {
+	devices := plugin.textfile.registeredDevices()
+	if devices == nil {
+		// Not registered yet, an empty file would look like a node without cards.
+		return nil
+	}
+	pods, err := client.GetClient().CoreV1().Pods("").List(context.Background(), metav1.ListOptions{
+		FieldSelector: fmt.Sprintf("spec.nodeName=%s", util.NodeName),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list pods: %w", err)
+	}
+	reg := textfileRegistry(util.NodeName, devices, pods.Items, plugin.sampleMemoryUsed())
+	return prometheus.WriteToTextfile(plugin.textfile.path, reg)
+}
+
+// WriteTextfileMetrics writes the metrics of the cards to the textfile every interval until stop is closed.
+func (plugin *NvidiaDevicePlugin) WriteTextfileMetrics(stop <-chan any) {
+	klog.InfoS("Starting WriteTextfileMetrics", "path", plugin.textfile.path, "interval", plugin.textfile.interval)
+	ticker := time.NewTicker(plugin.textfile.interval)
+	defer ticker.Stop()
+	for {
+		if err := plugin.writeTextfile(); err != nil {
+			klog.ErrorS(err, "Failed to write the textfile metrics", "path", plugin.textfile.path)
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,109 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func TestNewTextfileExporter(t *testing.T) {
+	e, err := newTextfileExporter("", time.Minute)
+	require.NoError(t, err)
+	require.Nil(t, e)
+	e.setDevices([]*util.DeviceInfo{{ID: "GPU-0"}})
+
+	_, err = newTextfileExporter("/var/lib/node-exporter/hami.txt", time.Minute)
+	require.ErrorContains(t, err, "doesn't end in .prom")
+	_, err = newTextfileExporter("/var/lib/node-exporter/hami.prom", 0)
+	require.ErrorContains(t, err, "is not positive")
+}
+
+func TestTextfileRegistry(t *testing.T) {
+	util.SupportDevices[nvidia.NvidiaGPUDevice] = "hami.io/vgpu-devices-allocated"
+	pstate, temperature := 8, 74
+	devices := []*util.DeviceInfo{
+		{ID: "GPU-0", Index: 0, Devmem: 16384, Devcore: 100, Type: "NVIDIA-Tesla T4", Health: true, ECCErrors: &util.DeviceECCErrors{Corrected: 7, Uncorrected: 1}, PerformanceState: &pstate, Temperature: &temperature},
+		{ID: "GPU-1", Index: 1, Devmem: 16384, Devcore: 100, Type: "NVIDIA-Tesla T4", Quarantined: true},
+	}
+	pods := []corev1.Pod{
+		*coTenantPod("a", "GPU-0", corev1.PodRunning),
+		*coTenantPod("b", "GPU-0", corev1.PodPending),
+		*coTenantPod("done", "GPU-0", corev1.PodSucceeded),
+	}
+	path := filepath.Join(t.TempDir(), "hami.prom")
+	reg := textfileRegistry("node1", devices, pods, map[string]uint64{"GPU-0": 512 * uint64(util.MiB)})
+	require.NoError(t, prometheus.WriteToTextfile(path, reg))
+
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	got := string(raw)
+	gpu0 := `{deviceidx="0",devicetype="NVIDIA-Tesla T4",deviceuuid="GPU-0",nodeid="node1"}`
+	gpu1 := `{deviceidx="1",devicetype="NVIDIA-Tesla T4",deviceuuid="GPU-1",nodeid="node1"}`
+	for _, line := range []string{
+		"# TYPE hami_device_plugin_gpu_memory_limit_bytes gauge",
+		"hami_device_plugin_gpu_memory_limit_bytes" + gpu0 + " 1.7179869184e+10",
+		"hami_device_plugin_gpu_core_limit" + gpu0 + " 100",
+		"hami_device_plugin_gpu_memory_allocated_bytes" + gpu0 + " 2.097152e+09",
+		"hami_device_plugin_gpu_core_allocated" + gpu0 + " 60",
+		"hami_device_plugin_gpu_shared_containers" + gpu0 + " 2",
+		"hami_device_plugin_gpu_memory_used_bytes" + gpu0 + " 5.36870912e+08",
+		"hami_device_plugin_gpu_healthy" + gpu0 + " 1",
+		"hami_device_plugin_gpu_quarantined" + gpu0 + " 0",
+		"hami_device_plugin_gpu_ecc_corrected_errors" + gpu0 + " 7",
+		"hami_device_plugin_gpu_ecc_uncorrected_errors" + gpu0 + " 1",
+		"hami_device_plugin_gpu_performance_state" + gpu0 + " 8",
+		"hami_device_plugin_gpu_temperature_celsius" + gpu0 + " 74",
+		"hami_device_plugin_gpu_memory_allocated_bytes" + gpu1 + " 0",
+		"hami_device_plugin_gpu_shared_containers" + gpu1 + " 0",
+		"hami_device_plugin_gpu_healthy" + gpu1 + " 0",
+		"hami_device_plugin_gpu_quarantined" + gpu1 + " 1",
+	} {
+		require.Contains(t, got, line+"\n")
+	}
+	// The succeeded pod holds nothing, NVML didn't sample GPU-1 and its memory in use is left out.
+	require.NotContains(t, got, "hami_device_plugin_gpu_memory_used_bytes"+gpu1)
+	// GPU-1 has no ECC.
+	require.NotContains(t, got, "hami_device_plugin_gpu_ecc_corrected_errors"+gpu1)
+	// Nor a known performance state.
+	require.NotContains(t, got, "hami_device_plugin_gpu_performance_state"+gpu1)
+}
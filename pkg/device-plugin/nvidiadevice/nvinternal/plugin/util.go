@@ -87,33 +87,33 @@ func EraseNextDeviceTypeFromAnnotation(dtype string, p corev1.Pod) error {
 		}
 	}
 	klog.Infoln("After erase res=", res)
+	value, err := util.ReencodeDevicesAnnotation(&p, util.InRequestDevices[dtype], util.EncodePodSingleDevice(res))
+	if err != nil {
+		return err
+	}
 	newannos := make(map[string]string)
-	newannos[util.InRequestDevices[dtype]] = util.EncodePodSingleDevice(res)
+	newannos[util.InRequestDevices[dtype]] = value
 	return util.PatchPodAnnotations(&p, newannos)
 }
 
-func GetIndexAndTypeFromUUID(uuid string) (string, int) {
-	if nvret := nvml.Init(); nvret != nvml.SUCCESS {
-		klog.Errorln("nvml Init err: ", nvret)
-		panic(0)
+func GetIndexAndTypeFromUUID(uuid string) (string, int, error) {
+	if err := initNVML(); err != nil {
+		return "", 0, err
 	}
 	originuuid := strings.Split(uuid, "[")[0]
 	ndev, ret := nvml.DeviceGetHandleByUUID(originuuid)
 	if ret != nvml.SUCCESS {
-		klog.Error("nvml get handlebyuuid error ret=", ret)
-		panic(0)
+		return "", 0, fmt.Errorf("nvml get handlebyuuid error ret=%s", nvml.ErrorString(ret))
 	}
 	Model, ret := ndev.GetName()
 	if ret != nvml.SUCCESS {
-		klog.Error("nvml get name error ret=", ret)
-		panic(0)
+		return "", 0, fmt.Errorf("nvml get name error ret=%s", nvml.ErrorString(ret))
 	}
 	index, ret := ndev.GetIndex()
 	if ret != nvml.SUCCESS {
-		klog.Error("nvml get index error ret=", ret)
-		panic(0)
+		return "", 0, fmt.Errorf("nvml get index error ret=%s", nvml.ErrorString(ret))
 	}
-	return Model, index
+	return Model, index, nil
 }
 
 func GetMigUUIDFromSmiOutput(output string, uuid string, idx int) string {
@@ -148,16 +148,14 @@ func GetMigUUIDFromSmiOutput(output string, uuid string, idx int) string {
 	return ""
 }
 
-func GetMigUUIDFromIndex(uuid string, idx int) string {
-	if nvret := nvml.Init(); nvret != nvml.SUCCESS {
-		klog.Errorln("nvml Init err: ", nvret)
-		panic(0)
+func GetMigUUIDFromIndex(uuid string, idx int) (string, error) {
+	if err := initNVML(); err != nil {
+		return "", err
 	}
 	originuuid := strings.Split(uuid, "[")[0]
 	ndev, ret := nvml.DeviceGetHandleByUUID(originuuid)
 	if ret != nvml.SUCCESS {
-		klog.Error(`nvml get device uuid error ret=`, ret)
-		panic(0)
+		return "", fmt.Errorf("nvml get device uuid error ret=%s", nvml.ErrorString(ret))
 	}
 	migdev, ret := nvml.DeviceGetMigDeviceHandleByIndex(ndev, idx)
 	if ret != nvml.SUCCESS {
@@ -168,29 +166,28 @@ func GetMigUUIDFromIndex(uuid string, idx int) string {
 		cmd.Stderr = &stderr
 		err := cmd.Run()
 		if err != nil {
-			klog.Fatalf("nvidia-smi -L failed with %s\n", err)
+			return "", fmt.Errorf("nvidia-smi -L failed with %s", err)
 		}
 		outStr := stdout.String()
 		uuid := GetMigUUIDFromSmiOutput(outStr, originuuid, idx)
-		return uuid
+		return uuid, nil
 	}
 	res, ret := migdev.GetUUID()
 	if ret != nvml.SUCCESS {
-		klog.Error(`nvml get mig uuid error ret=`, ret)
-		panic(0)
+		return "", fmt.Errorf("nvml get mig uuid error ret=%s", nvml.ErrorString(ret))
 	}
-	return res
+	return res, nil
 }
 
-func GetDeviceNums() (int, error) {
-	if nvret := nvml.Init(); nvret != nvml.SUCCESS {
-		klog.Errorln("nvml Init err: ", nvret)
-		return 0, fmt.Errorf("nvml Init err: %s", nvml.ErrorString(nvret))
+func GetDeviceNums(discoverer DeviceDiscoverer) (int, error) {
+	if err := discoverer.Init(); err != nil {
+		klog.Errorln("device discovery Init err: ", err)
+		return 0, err
 	}
-	count, ret := nvml.DeviceGetCount()
-	if ret != nvml.SUCCESS {
-		klog.Error(`nvml get count error ret=`, ret)
-		return 0, fmt.Errorf("nvml get count error ret: %s", nvml.ErrorString(ret))
+	count, err := discoverer.Count()
+	if err != nil {
+		klog.Error(`device discovery get count error: `, err)
+		return 0, err
 	}
 	return count, nil
 }
@@ -290,7 +287,7 @@ func containsDevice(target int, devices []int32) bool {
 	return false
 }
 
-func (nv *NvidiaDevicePlugin) GetContainerDeviceStrArray(c util.ContainerDevices) []string {
+func (nv *NvidiaDevicePlugin) GetContainerDeviceStrArray(c util.ContainerDevices) ([]string, error) {
 	tmp := []string{}
 	needsreset := false
 	position := 0
@@ -298,14 +295,23 @@ func (nv *NvidiaDevicePlugin) GetContainerDeviceStrArray(c util.ContainerDevices
 		if !strings.Contains(val.UUID, "[") {
 			tmp = append(tmp, val.UUID)
 		} else {
-			devtype, devindex := GetIndexAndTypeFromUUID(val.UUID)
+			devtype, devindex, err := GetIndexAndTypeFromUUID(val.UUID)
+			if err != nil {
+				return nil, err
+			}
+			nv.migMutex.Lock()
 			position, needsreset = nv.GenerateMigTemplate(devtype, devindex, val)
 			if needsreset {
 				nv.ApplyMigTemplate()
 			}
-			tmp = append(tmp, GetMigUUIDFromIndex(val.UUID, position))
+			nv.migMutex.Unlock()
+			miguuid, err := GetMigUUIDFromIndex(val.UUID, position)
+			if err != nil {
+				return nil, err
+			}
+			tmp = append(tmp, miguuid)
 		}
 	}
 	klog.V(3).Infoln("mig current=", nv.migCurrent, ":", needsreset, "position=", position, "uuid lists", tmp)
-	return tmp
+	return tmp, nil
 }
@@ -0,0 +1,132 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package rm
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+)
+
+// FakeDevice is a GPU of a node without NVML, e.g. a CI runner, which the device plugin serves
+// like a real one. Its index is its position in the list.
+type FakeDevice struct {
+	UUID  string `json:"uuid"`
+	Model string `json:"model"`
+	// Memory is in MiB.
+	Memory uint64 `json:"memory"`
+}
+
+// LoadFakeDevices parses a JSON list of FakeDevice, e.g.
+// [{"uuid":"GPU-0","model":"Tesla T4","memory":15360}], given inline or as the path of a file
+// holding it.
+func LoadFakeDevices(source string) ([]FakeDevice, error) {
+	source = strings.TrimSpace(source)
+	if source == "" {
+		return nil, fmt.Errorf("no fake devices given")
+	}
+	data := []byte(source)
+	if !strings.HasPrefix(source, "[") {
+		var err error
+		data, err = os.ReadFile(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the fake devices: %v", err)
+		}
+	}
+	var devices []FakeDevice
+	if err := json.Unmarshal(data, &devices); err != nil {
+		return nil, fmt.Errorf("failed to parse the fake devices: %v", err)
+	}
+	seen := make(map[string]bool, len(devices))
+	for i, d := range devices {
+		switch {
+		case d.UUID == "":
+			return nil, fmt.Errorf("fake device %d has no uuid", i)
+		case seen[d.UUID]:
+			return nil, fmt.Errorf("fake device %s is listed twice", d.UUID)
+		case d.Model == "":
+			return nil, fmt.Errorf("fake device %s has no model", d.UUID)
+		case d.Memory == 0:
+			return nil, fmt.Errorf("fake device %s has no memory", d.UUID)
+		}
+		seen[d.UUID] = true
+	}
+	return devices, nil
+}
+
+// buildFakeDeviceMap creates a DeviceMap of devices, matching their models against the
+// resource patterns like the NVML devices.
+func buildFakeDeviceMap(config *nvidia.DeviceConfig, devices []FakeDevice) (DeviceMap, error) {
+	deviceMap := make(DeviceMap)
+	for i, d := range devices {
+		matched := false
+		for _, resource := range config.Resources.GPUs {
+			if resource.Pattern.Matches(d.Model) {
+				if err := deviceMap.setEntry(resource.Name, fmt.Sprintf("%d", i), &fakeDevice{uuid: d.UUID}); err != nil {
+					return nil, err
+				}
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("GPU name '%v' does not match any resource patterns", d.Model)
+		}
+	}
+	return deviceMap, nil
+}
+
+type fakeDevice struct {
+	uuid string
+}
+
+var _ deviceInfo = (*fakeDevice)(nil)
+
+// GetUUID returns the UUID of the fake device.
+func (d *fakeDevice) GetUUID() (string, error) {
+	return d.uuid, nil
+}
+
+// GetPaths returns the paths for a fake device.
+// A fake device has no device nodes.
+func (d *fakeDevice) GetPaths() ([]string, error) {
+	return nil, nil
+}
+
+// GetNumaNode always returns unsupported for a fake device
+func (d *fakeDevice) GetNumaNode() (bool, int, error) {
+	return false, -1, nil
+}
@@ -0,0 +1,98 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package rm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	spec "github.com/NVIDIA/k8s-device-plugin/api/config/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+)
+
+func TestLoadFakeDevices(t *testing.T) {
+	want := []FakeDevice{
+		{UUID: "GPU-0", Model: "Tesla T4", Memory: 15360},
+		{UUID: "GPU-1", Model: "A100-SXM4-40GB", Memory: 40960},
+	}
+	list := `[{"uuid":"GPU-0","model":"Tesla T4","memory":15360},{"uuid":"GPU-1","model":"A100-SXM4-40GB","memory":40960}]`
+
+	devices, err := LoadFakeDevices(list)
+	require.NoError(t, err)
+	require.Equal(t, want, devices)
+
+	path := filepath.Join(t.TempDir(), "devices.json")
+	require.NoError(t, os.WriteFile(path, []byte(list), 0o644))
+	devices, err = LoadFakeDevices(path)
+	require.NoError(t, err)
+	require.Equal(t, want, devices)
+
+	for _, invalid := range []string{
+		"",
+		"[{",
+		filepath.Join(t.TempDir(), "missing.json"),
+		`[{"model":"Tesla T4","memory":15360}]`,
+		`[{"uuid":"GPU-0","memory":15360}]`,
+		`[{"uuid":"GPU-0","model":"Tesla T4"}]`,
+		`[{"uuid":"GPU-0","model":"Tesla T4","memory":15360},{"uuid":"GPU-0","model":"Tesla T4","memory":15360}]`,
+	} {
+		_, err := LoadFakeDevices(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestNewFakeResourceManagers(t *testing.T) {
+	config := &nvidia.DeviceConfig{Config: &spec.Config{
+		Resources: spec.Resources{GPUs: []spec.Resource{{Pattern: "*", Name: "nvidia.com/gpu"}}},
+	}}
+	devices := []FakeDevice{
+		{UUID: "GPU-0", Model: "Tesla T4", Memory: 15360},
+		{UUID: "GPU-1", Model: "Tesla T4", Memory: 15360},
+	}
+
+	rms, err := NewFakeResourceManagers(config, devices)
+	require.NoError(t, err)
+	require.Len(t, rms, 1)
+	require.Equal(t, spec.ResourceName("nvidia.com/gpu"), rms[0].Resource())
+	require.ElementsMatch(t, []string{"GPU-0", "GPU-1"}, rms[0].Devices().GetIDs())
+	require.Equal(t, "1", rms[0].Devices().GetByID("GPU-1").Index)
+	require.Empty(t, rms[0].GetDevicePaths([]string{"GPU-0"}))
+
+	// Like an NVML device, a fake one must match a resource.
+	config.Resources.GPUs[0].Pattern = "A100*"
+	_, err = NewFakeResourceManagers(config, devices)
+	require.Error(t, err)
+}
@@ -37,9 +37,12 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/NVIDIA/go-nvlib/pkg/nvml"
 	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
 )
 
 const (
@@ -54,8 +57,24 @@ const (
 	maxSuccessiveEventErrorCount = 3
 )
 
+// ApplicationXidHandler is called by CheckHealth, if not nil, with the UUID of the GPU for every
+// application Xid on a managed device. These Xids don't make the device unhealthy and are
+// skipped otherwise. The handler runs on the health check loop and must not block.
+type ApplicationXidHandler func(uuid string, xid uint64)
+
+// FIXME: formalize the full list and document it.
+// http://docs.nvidia.com/deploy/xid-errors/index.html#topic_4
+// Application errors: the GPU should still be healthy
+var applicationErrorXids = []uint64{
+	13, // Graphics Engine Exception
+	31, // GPU memory page fault
+	43, // GPU stopped processing
+	45, // Preemptive cleanup, due to previous errors
+	68, // Video processor exception
+}
+
 // CheckHealth performs health checks on a set of devices, writing to the 'unhealthy' channel with any unhealthy devices
-func (r *nvmlResourceManager) checkHealth(stop <-chan any, devices Devices, unhealthy chan<- *Device) error {
+func (r *nvmlResourceManager) checkHealth(stop <-chan any, devices Devices, unhealthy chan<- *Device, applicationXid ApplicationXidHandler) error {
 	disableHealthChecks := strings.ToLower(os.Getenv(envDisableHealthChecks))
 	if disableHealthChecks == "all" {
 		disableHealthChecks = allHealthChecks
@@ -78,25 +97,8 @@ func (r *nvmlResourceManager) checkHealth(stop <-chan any, devices Devices, unhe
 		}
 	}()
 
-	// FIXME: formalize the full list and document it.
-	// http://docs.nvidia.com/deploy/xid-errors/index.html#topic_4
-	// Application errors: the GPU should still be healthy
-	applicationErrorXids := []uint64{
-		13, // Graphics Engine Exception
-		31, // GPU memory page fault
-		43, // GPU stopped processing
-		45, // Preemptive cleanup, due to previous errors
-		68, // Video processor exception
-	}
-
-	skippedXids := make(map[uint64]bool)
-	for _, id := range applicationErrorXids {
-		skippedXids[id] = true
-	}
-
-	for _, additionalXid := range getAdditionalXids(disableHealthChecks) {
-		skippedXids[additionalXid] = true
-	}
+	xids := newXidFilter(nvidia.DevicePluginHealthConditions, getAdditionalXids(disableHealthChecks))
+	conditions := newConditionWatch(nvidia.DevicePluginHealthConditions)
 
 	eventSet, ret := r.nvml.EventSetCreate()
 	if ret != nvml.SUCCESS {
@@ -105,6 +107,8 @@ func (r *nvmlResourceManager) checkHealth(stop <-chan any, devices Devices, unhe
 	defer eventSet.Free()
 
 	parentToDeviceMap := make(map[string]*Device)
+	// parentToDevices are all the devices of every card, for the conditions of a whole card.
+	parentToDevices := make(map[string][]*Device)
 	deviceIDToGiMap := make(map[string]int)
 	deviceIDToCiMap := make(map[string]int)
 
@@ -119,6 +123,7 @@ func (r *nvmlResourceManager) checkHealth(stop <-chan any, devices Devices, unhe
 		deviceIDToGiMap[d.ID] = gi
 		deviceIDToCiMap[d.ID] = ci
 		parentToDeviceMap[uuid] = d
+		parentToDevices[uuid] = append(parentToDevices[uuid], d)
 
 		gpu, ret := r.nvml.DeviceGetHandleByUUID(uuid)
 		if ret != nvml.SUCCESS {
@@ -144,6 +149,7 @@ func (r *nvmlResourceManager) checkHealth(stop <-chan any, devices Devices, unhe
 		}
 	}
 
+	var lastConditionCheck time.Time
 	for {
 		select {
 		case <-stop:
@@ -151,6 +157,23 @@ func (r *nvmlResourceManager) checkHealth(stop <-chan any, devices Devices, unhe
 		default:
 		}
 
+		if conditions != nil && time.Since(lastConditionCheck) >= healthConditionInterval {
+			lastConditionCheck = time.Now()
+			for uuid, ds := range parentToDevices {
+				readings, err := conditions.read(uuid)
+				if err != nil {
+					klog.Warningf("Failed to read the health conditions of %v: %v", uuid, err)
+					continue
+				}
+				if reason := conditions.observe(uuid, readings, lastConditionCheck); reason != "" {
+					klog.Infof("Health condition met on Device=%s: %s; marking device as unhealthy.", uuid, reason)
+					for _, d := range ds {
+						unhealthy <- d
+					}
+				}
+			}
+		}
+
 		e, ret := eventSet.Wait(5000)
 		if ret == nvml.ERROR_TIMEOUT {
 			continue
@@ -168,7 +191,14 @@ func (r *nvmlResourceManager) checkHealth(stop <-chan any, devices Devices, unhe
 			continue
 		}
 
-		if skippedXids[e.EventData] {
+		if !xids.critical(e.EventData) {
+			if xids.application[e.EventData] && applicationXid != nil {
+				if uuid, ret := e.Device.GetUUID(); ret == nvml.SUCCESS {
+					if _, exists := parentToDeviceMap[uuid]; exists {
+						applicationXid(uuid, e.EventData)
+					}
+				}
+			}
 			klog.Infof("Skipping event %+v", e)
 			continue
 		}
@@ -34,8 +34,12 @@ package rm
 
 import (
 	"testing"
+	"time"
 
+	gonvml "github.com/NVIDIA/go-nvml/pkg/nvml"
 	"github.com/stretchr/testify/require"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
 )
 
 func TestGetAdditionalXids(t *testing.T) {
@@ -98,3 +102,91 @@ func TestGetAdditionalXids(t *testing.T) {
 		})
 	}
 }
+
+func TestXidFilter(t *testing.T) {
+	testCases := []struct {
+		description string
+		conditions  *nvidia.HealthConditions
+		additional  []uint64
+		critical    []uint64
+		skipped     []uint64
+	}{
+		{
+			description: "Default skips the application Xids",
+			critical:    []uint64{48, 79},
+			skipped:     []uint64{13, 31, 43, 45, 68},
+		},
+		{
+			description: "Additional Xids are skipped",
+			additional:  []uint64{79},
+			critical:    []uint64{48},
+			skipped:     []uint64{13, 79},
+		},
+		{
+			description: "Ignored Xids are skipped",
+			conditions:  &nvidia.HealthConditions{IgnoredXids: []uint64{48}},
+			critical:    []uint64{79},
+			skipped:     []uint64{13, 48},
+		},
+		{
+			description: "Only the listed Xids are critical",
+			conditions:  &nvidia.HealthConditions{Xids: []uint64{13, 79}},
+			critical:    []uint64{13, 79},
+			skipped:     []uint64{31, 48},
+		},
+		{
+			description: "Ignoring wins over listing",
+			conditions:  &nvidia.HealthConditions{Xids: []uint64{48, 79}, IgnoredXids: []uint64{79}},
+			additional:  []uint64{48},
+			skipped:     []uint64{48, 79},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			f := newXidFilter(tc.conditions, tc.additional)
+			for _, xid := range tc.critical {
+				require.True(t, f.critical(xid), "Xid %d", xid)
+			}
+			for _, xid := range tc.skipped {
+				require.False(t, f.critical(xid), "Xid %d", xid)
+			}
+		})
+	}
+}
+
+func TestNewConditionWatch(t *testing.T) {
+	require.Nil(t, newConditionWatch(nil))
+	require.Nil(t, newConditionWatch(&nvidia.HealthConditions{Xids: []uint64{79}}))
+	require.Nil(t, newConditionWatch(&nvidia.HealthConditions{ThrottleReasons: []string{"unknown"}}))
+
+	w := newConditionWatch(&nvidia.HealthConditions{ThrottleReasons: []string{"HW_Slowdown", " hw_thermal_slowdown", "unknown"}})
+	require.NotNil(t, w)
+	require.EqualValues(t, gonvml.ClocksThrottleReasonHwSlowdown|gonvml.ClocksThrottleReasonHwThermalSlowdown, w.throttleMask)
+}
+
+func TestConditionWatchObserve(t *testing.T) {
+	now := time.Now()
+
+	t.Run("ECC thresholds", func(t *testing.T) {
+		w := newConditionWatch(&nvidia.HealthConditions{UncorrectedECC: 1, CorrectedECC: 100})
+		require.Empty(t, w.observe("GPU-0", cardReadings{correctedECC: 99}, now))
+		require.Contains(t, w.observe("GPU-0", cardReadings{correctedECC: 100}, now), "100 corrected ECC errors")
+		require.Contains(t, w.observe("GPU-1", cardReadings{uncorrectedECC: 1}, now), "1 uncorrected ECC errors")
+		// A card is reported once.
+		require.Empty(t, w.observe("GPU-1", cardReadings{uncorrectedECC: 2}, now))
+	})
+
+	t.Run("Throttling lasting the grace period", func(t *testing.T) {
+		w := newConditionWatch(&nvidia.HealthConditions{ThrottleReasons: []string{"hw_slowdown"}})
+		hw := cardReadings{throttleReasons: gonvml.ClocksThrottleReasonHwSlowdown}
+		require.Empty(t, w.observe("GPU-0", cardReadings{throttleReasons: gonvml.ClocksThrottleReasonSwPowerCap}, now))
+		require.Empty(t, w.observe("GPU-0", hw, now))
+		require.Empty(t, w.observe("GPU-0", hw, now.Add(throttleGracePeriod/2)))
+		// Throttling which stops starts over.
+		require.Empty(t, w.observe("GPU-0", cardReadings{}, now.Add(throttleGracePeriod/2)))
+		require.Empty(t, w.observe("GPU-0", hw, now.Add(throttleGracePeriod)))
+		require.Empty(t, w.observe("GPU-0", hw, now.Add(throttleGracePeriod*3/2)))
+		require.Contains(t, w.observe("GPU-0", hw, now.Add(throttleGracePeriod*2)), "hw_slowdown")
+	})
+}
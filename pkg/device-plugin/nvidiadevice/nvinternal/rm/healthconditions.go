@@ -0,0 +1,223 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package rm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	gonvml "github.com/NVIDIA/go-nvml/pkg/nvml"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+)
+
+const (
+	// healthConditionInterval is how often the ECC counts and clock throttle reasons of the
+	// cards are read.
+	healthConditionInterval = 5 * time.Second
+	// throttleGracePeriod is how long the clocks of a card may stay throttled for a reason
+	// marking it unhealthy before it does, so a short spike doesn't take the card away.
+	throttleGracePeriod = time.Minute
+)
+
+// throttleReasons are the clock throttle reasons HealthConditions.ThrottleReasons names.
+var throttleReasons = map[string]uint64{
+	"sw_power_cap":            gonvml.ClocksThrottleReasonSwPowerCap,
+	"hw_slowdown":             gonvml.ClocksThrottleReasonHwSlowdown,
+	"sync_boost":              gonvml.ClocksThrottleReasonSyncBoost,
+	"sw_thermal_slowdown":     gonvml.ClocksThrottleReasonSwThermalSlowdown,
+	"hw_thermal_slowdown":     gonvml.ClocksThrottleReasonHwThermalSlowdown,
+	"hw_power_brake_slowdown": gonvml.ClocksThrottleReasonHwPowerBrakeSlowdown,
+}
+
+// xidFilter tells the Xids which mark a card unhealthy.
+type xidFilter struct {
+	only        map[uint64]bool
+	ignored     map[uint64]bool
+	application map[uint64]bool
+}
+
+// newXidFilter returns the filter of conditions, also ignoring additionalIgnored.
+func newXidFilter(conditions *nvidia.HealthConditions, additionalIgnored []uint64) xidFilter {
+	f := xidFilter{
+		only:        make(map[uint64]bool),
+		ignored:     make(map[uint64]bool),
+		application: make(map[uint64]bool),
+	}
+	for _, xid := range applicationErrorXids {
+		f.application[xid] = true
+	}
+	for _, xid := range additionalIgnored {
+		f.ignored[xid] = true
+	}
+	if conditions != nil {
+		for _, xid := range conditions.Xids {
+			f.only[xid] = true
+		}
+		for _, xid := range conditions.IgnoredXids {
+			f.ignored[xid] = true
+		}
+	}
+	return f
+}
+
+// critical reports whether xid marks a card unhealthy: an Xid listed as the only ones to, or
+// any but the application ones if none are, unless it is ignored.
+func (f xidFilter) critical(xid uint64) bool {
+	if f.ignored[xid] {
+		return false
+	}
+	if len(f.only) > 0 {
+		return f.only[xid]
+	}
+	return !f.application[xid]
+}
+
+// cardReadings are the counters of a card the health conditions other than Xids look at.
+type cardReadings struct {
+	correctedECC, uncorrectedECC uint64
+	throttleReasons              uint64
+}
+
+// conditionWatch evaluates the ECC and clock throttle conditions of the cards. A nil
+// *conditionWatch watches nothing.
+type conditionWatch struct {
+	correctedECC, uncorrectedECC uint64
+	throttleMask                 uint64
+	// throttledSince is when the clocks of a card started being throttled for a reason of
+	// throttleMask.
+	throttledSince map[string]time.Time
+	// reported are the cards found unhealthy already, as a card doesn't recover.
+	reported map[string]bool
+}
+
+// newConditionWatch returns the watch of conditions, nil if they watch neither ECC errors nor
+// throttling. Unknown throttle reasons are logged and ignored.
+func newConditionWatch(conditions *nvidia.HealthConditions) *conditionWatch {
+	if conditions == nil {
+		return nil
+	}
+	w := &conditionWatch{
+		correctedECC:   conditions.CorrectedECC,
+		uncorrectedECC: conditions.UncorrectedECC,
+		throttledSince: make(map[string]time.Time),
+		reported:       make(map[string]bool),
+	}
+	for _, name := range conditions.ThrottleReasons {
+		mask, ok := throttleReasons[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			klog.Warningf("Ignoring unknown clock throttle reason %q in the health conditions", name)
+			continue
+		}
+		w.throttleMask |= mask
+	}
+	if w.correctedECC == 0 && w.uncorrectedECC == 0 && w.throttleMask == 0 {
+		return nil
+	}
+	return w
+}
+
+// observe returns why the card uuid with readings r at now is unhealthy, "" if it isn't or
+// was reported already.
+func (w *conditionWatch) observe(uuid string, r cardReadings, now time.Time) string {
+	if w.reported[uuid] {
+		return ""
+	}
+	reason := ""
+	switch {
+	case w.uncorrectedECC > 0 && r.uncorrectedECC >= w.uncorrectedECC:
+		reason = fmt.Sprintf("%d uncorrected ECC errors, the threshold is %d", r.uncorrectedECC, w.uncorrectedECC)
+	case w.correctedECC > 0 && r.correctedECC >= w.correctedECC:
+		reason = fmt.Sprintf("%d corrected ECC errors, the threshold is %d", r.correctedECC, w.correctedECC)
+	case r.throttleReasons&w.throttleMask != 0:
+		since, ok := w.throttledSince[uuid]
+		if !ok {
+			w.throttledSince[uuid] = now
+			return ""
+		}
+		if now.Sub(since) < throttleGracePeriod {
+			return ""
+		}
+		reason = fmt.Sprintf("clocks throttled for %s since %s", throttleReasonNames(r.throttleReasons&w.throttleMask), since.Format(time.RFC3339))
+	default:
+		delete(w.throttledSince, uuid)
+		return ""
+	}
+	w.reported[uuid] = true
+	return reason
+}
+
+// read returns the readings of the card uuid the watch looks at.
+func (w *conditionWatch) read(uuid string) (cardReadings, error) {
+	var r cardReadings
+	gpu, ret := gonvml.DeviceGetHandleByUUID(uuid)
+	if ret != gonvml.SUCCESS {
+		return r, fmt.Errorf("failed to get device handle: %v", gonvml.ErrorString(ret))
+	}
+	if w.correctedECC > 0 || w.uncorrectedECC > 0 {
+		// Cards without ECC count no errors.
+		if n, ret := gpu.GetTotalEccErrors(gonvml.MEMORY_ERROR_TYPE_CORRECTED, gonvml.VOLATILE_ECC); ret == gonvml.SUCCESS {
+			r.correctedECC = n
+		} else if ret != gonvml.ERROR_NOT_SUPPORTED {
+			return r, fmt.Errorf("failed to get corrected ECC errors: %v", gonvml.ErrorString(ret))
+		}
+		if n, ret := gpu.GetTotalEccErrors(gonvml.MEMORY_ERROR_TYPE_UNCORRECTED, gonvml.VOLATILE_ECC); ret == gonvml.SUCCESS {
+			r.uncorrectedECC = n
+		} else if ret != gonvml.ERROR_NOT_SUPPORTED {
+			return r, fmt.Errorf("failed to get uncorrected ECC errors: %v", gonvml.ErrorString(ret))
+		}
+	}
+	if w.throttleMask != 0 {
+		reasons, ret := gpu.GetCurrentClocksThrottleReasons()
+		if ret != gonvml.SUCCESS && ret != gonvml.ERROR_NOT_SUPPORTED {
+			return r, fmt.Errorf("failed to get clock throttle reasons: %v", gonvml.ErrorString(ret))
+		}
+		r.throttleReasons = reasons
+	}
+	return r, nil
+}
+
+// throttleReasonNames returns the names of the throttle reasons in mask.
+func throttleReasonNames(mask uint64) string {
+	var names []string
+	for name, m := range throttleReasons {
+		if mask&m != 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -34,6 +34,8 @@ package rm
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
 
@@ -66,6 +68,8 @@ func NewNVMLResourceManagers(nvmllib nvml.Interface, config *nvidia.DeviceConfig
 		return nil, fmt.Errorf("error building device map: %v", err)
 	}
 
+	removeSystemReserved(deviceMap)
+
 	var rms []ResourceManager
 	for resourceName, devices := range deviceMap {
 		if len(devices) == 0 {
@@ -92,6 +96,38 @@ func NewNVMLResourceManagers(nvmllib nvml.Interface, config *nvidia.DeviceConfig
 	return rms, nil
 }
 
+// removeSystemReserved drops the cards of the system pool, including all their MIG
+// instances, so they are never advertised.
+func removeSystemReserved(deviceMap DeviceMap) {
+	if nvidia.DevicePluginSystemReserved == nil {
+		return
+	}
+	parent := func(d *Device) (uint, bool) {
+		idx, _, _ := strings.Cut(d.Index, ":")
+		i, err := strconv.Atoi(idx)
+		return uint(i), err == nil
+	}
+	indexes := make([]uint, 0)
+	for _, devices := range deviceMap {
+		for _, d := range devices {
+			if idx, ok := parent(d); ok {
+				indexes = append(indexes, idx)
+			}
+		}
+	}
+	reserved := nvidia.SystemReservedIndexes(indexes)
+	for _, devices := range deviceMap {
+		for key, d := range devices {
+			if idx, ok := parent(d); ok {
+				if _, ok := reserved[idx]; ok {
+					klog.InfoS("Keeping device in the system reserved pool", "device", d.ID, "index", d.Index)
+					delete(devices, key)
+				}
+			}
+		}
+	}
+}
+
 // GetPreferredAllocation runs an allocation algorithm over the inputs.
 // The algorithm chosen is based both on the incoming set of available devices and various config settings.
 func (r *nvmlResourceManager) GetPreferredAllocation(available, required []string, size int) ([]string, error) {
@@ -115,6 +151,6 @@ func (r *nvmlResourceManager) GetDevicePaths(ids []string) []string {
 }
 
 // CheckHealth performs health checks on a set of devices, writing to the 'unhealthy' channel with any unhealthy devices
-func (r *nvmlResourceManager) CheckHealth(stop <-chan any, unhealthy chan<- *Device) error {
-	return r.checkHealth(stop, r.devices, unhealthy)
+func (r *nvmlResourceManager) CheckHealth(stop <-chan any, unhealthy chan<- *Device, applicationXid ApplicationXidHandler) error {
+	return r.checkHealth(stop, r.devices, unhealthy, applicationXid)
 }
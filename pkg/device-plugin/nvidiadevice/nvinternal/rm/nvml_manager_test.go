@@ -0,0 +1,71 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * The HAMi Contributors require contributions made to
+ * this file be licensed under the Apache-2.0 license or a
+ * compatible open source license.
+ */
+
+/*
+ * Licensed to NVIDIA CORPORATION under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. NVIDIA CORPORATION licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * Modifications Copyright The HAMi Authors. See
+ * GitHub history for details.
+ */
+
+package rm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	kubeletdevicepluginv1beta1 "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+)
+
+func TestRemoveSystemReserved(t *testing.T) {
+	newDevice := func(id, index string) *Device {
+		return &Device{Device: kubeletdevicepluginv1beta1.Device{ID: id}, Index: index}
+	}
+	deviceMap := DeviceMap{
+		"nvidia.com/gpu": Devices{
+			"GPU-0": newDevice("GPU-0", "0"),
+			"GPU-1": newDevice("GPU-1", "1"),
+		},
+		"nvidia.com/mig-1g.10gb": Devices{
+			"MIG-2-0": newDevice("MIG-2-0", "2:0"),
+			"MIG-2-1": newDevice("MIG-2-1", "2:1"),
+		},
+	}
+	orig := nvidia.DevicePluginSystemReserved
+	defer func() { nvidia.DevicePluginSystemReserved = orig }()
+
+	// Count takes the highest index, the MIG card goes away with all its instances.
+	nvidia.DevicePluginSystemReserved = &nvidia.SystemReserved{Count: 1}
+	removeSystemReserved(deviceMap)
+	require.Len(t, deviceMap["nvidia.com/gpu"], 2)
+	require.Len(t, deviceMap["nvidia.com/mig-1g.10gb"], 0)
+
+	nvidia.DevicePluginSystemReserved = &nvidia.SystemReserved{Index: []uint{0}, Count: 1}
+	removeSystemReserved(deviceMap)
+	require.Contains(t, deviceMap["nvidia.com/gpu"], "GPU-1")
+	require.NotContains(t, deviceMap["nvidia.com/gpu"], "GPU-0")
+}
@@ -89,6 +89,7 @@ func InitDevices(config []VNPUConfig) []*Devices {
 		util.InRequestDevices[commonWord] = fmt.Sprintf("hami.io/%s-devices-to-allocate", commonWord)
 		util.SupportDevices[commonWord] = fmt.Sprintf("hami.io/%s-devices-allocated", commonWord)
 		util.HandshakeAnnos[commonWord] = dev.handshakeAnno
+		util.MemoryUnits[commonWord] = util.MiB
 		devs = append(devs, dev)
 		klog.Infof("load ascend vnpu config %s: %v", commonWord, dev.config)
 	}
@@ -154,7 +155,7 @@ func (dev *Devices) PatchAnnotations(annoInput *map[string]string, pd util.PodDe
 		var rtInfo []RuntimeInfo
 		for _, dp := range devList {
 			for _, val := range dp {
-				_, temp := dev.trimMemory(int64(val.Usedmem))
+				_, temp := dev.trimMemory(util.MemoryFromBytes(commonWord, val.Usedmem))
 				rtInfo = append(rtInfo, RuntimeInfo{
 					UUID: val.UUID,
 					Temp: temp,
@@ -267,7 +268,7 @@ func (dev *Devices) GenerateResourceRequests(ctr *corev1.Container) util.Contain
 			return util.ContainerDeviceRequest{
 				Nums:             int32(n),
 				Type:             dev.CommonWord(),
-				Memreq:           int32(memnum),
+				Memreq:           util.MemoryToBytes(dev.CommonWord(), int64(memnum)),
 				MemPercentagereq: int32(mempnum),
 				Coresreq:         corenum,
 			}
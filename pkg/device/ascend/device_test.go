@@ -305,7 +305,7 @@ func Test_PatchAnnotations(t *testing.T) {
 								UUID:      "device-0",
 								Type:      "Ascend",
 								Usedcores: 1,
-								Usedmem:   8738,
+								Usedmem:   8738 * util.MiB,
 							},
 						},
 					},
@@ -736,7 +736,7 @@ func Test_GenerateResourceRequests(t *testing.T) {
 			want: util.ContainerDeviceRequest{
 				Nums:             int32(2),
 				Type:             "Ascend910A",
-				Memreq:           int32(8738),
+				Memreq:           8738 * util.MiB,
 				MemPercentagereq: int32(0),
 				Coresreq:         int32(0),
 			},
@@ -756,7 +756,7 @@ func Test_GenerateResourceRequests(t *testing.T) {
 			want: util.ContainerDeviceRequest{
 				Nums:             int32(2),
 				Type:             "Ascend910A",
-				Memreq:           int32(0),
+				Memreq:           int64(0),
 				MemPercentagereq: int32(100),
 				Coresreq:         int32(0),
 			},
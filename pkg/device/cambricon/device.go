@@ -81,6 +81,7 @@ func InitMLUDevice(config CambriconConfig) *CambriconDevices {
 	MLUResourceCores = config.ResourceCoreName
 	util.InRequestDevices[CambriconMLUDevice] = "hami.io/cambricon-mlu-devices-to-allocate"
 	util.SupportDevices[CambriconMLUDevice] = "hami.io/cambricon-mlu-devices-allocated"
+	util.MemoryUnits[CambriconMLUDevice] = util.MiB
 	return &CambriconDevices{}
 }
 
@@ -284,7 +285,7 @@ func (dev *CambriconDevices) GenerateResourceRequests(ctr *corev1.Container) uti
 			return util.ContainerDeviceRequest{
 				Nums:             int32(n),
 				Type:             CambriconMLUDevice,
-				Memreq:           int32(memnum),
+				Memreq:           util.MemoryToBytes(CambriconMLUDevice, int64(memnum)),
 				MemPercentagereq: int32(mempnum),
 				Coresreq:         corenum,
 			}
@@ -299,7 +300,7 @@ func (dev *CambriconDevices) PatchAnnotations(annoinput *map[string]string, pd u
 	devlist, ok := pd[CambriconMLUDevice]
 	if ok {
 		(*annoinput)[DsmluResourceAssigned] = "false"
-		(*annoinput)[DsmluProfile] = fmt.Sprintf("%d_%d_%d", devlist[0][0].Idx, devlist[0][0].Usedcores, devlist[0][0].Usedmem/256)
+		(*annoinput)[DsmluProfile] = fmt.Sprintf("%d_%d_%d", devlist[0][0].Idx, devlist[0][0].Usedcores, util.MemoryFromBytes(CambriconMLUDevice, devlist[0][0].Usedmem)/256)
 		deviceStr := util.EncodePodSingleDevice(devlist)
 		(*annoinput)[util.InRequestDevices[CambriconMLUDevice]] = deviceStr
 		(*annoinput)[util.SupportDevices[CambriconMLUDevice]] = deviceStr
@@ -326,7 +326,7 @@ func Test_GenerateResourceRequests(t *testing.T) {
 			want: util.ContainerDeviceRequest{
 				Nums:             int32(1),
 				Type:             CambriconMLUDevice,
-				Memreq:           int32(256000),
+				Memreq:           256000 * util.MiB,
 				MemPercentagereq: int32(0),
 				Coresreq:         int32(2),
 			},
@@ -348,7 +348,7 @@ func Test_GenerateResourceRequests(t *testing.T) {
 			want: util.ContainerDeviceRequest{
 				Nums:             int32(1),
 				Type:             CambriconMLUDevice,
-				Memreq:           int32(256000),
+				Memreq:           256000 * util.MiB,
 				MemPercentagereq: int32(0),
 				Coresreq:         int32(100),
 			},
@@ -370,7 +370,7 @@ func Test_GenerateResourceRequests(t *testing.T) {
 			want: util.ContainerDeviceRequest{
 				Nums:             int32(1),
 				Type:             CambriconMLUDevice,
-				Memreq:           int32(0),
+				Memreq:           int64(0),
 				MemPercentagereq: int32(100),
 				Coresreq:         int32(2),
 			},
@@ -415,7 +415,7 @@ func Test_PatchAnnotations(t *testing.T) {
 								UUID:      "device-0",
 								Type:      "MLU",
 								Usedcores: 1,
-								Usedmem:   256000,
+								Usedmem:   256000 * util.MiB,
 							},
 						},
 					},
@@ -0,0 +1,112 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package device
+
+import (
+	"fmt"
+	"slices"
+)
+
+// CardPartition sets cards of some nodes aside for the pods it selects. On those nodes the
+// pods only get cards of the partition, and the cards only go to the pods of the partition.
+type CardPartition struct {
+	Name string `yaml:"name"`
+	// Nodes are the names of the nodes whose cards are partitioned.
+	Nodes []string `yaml:"nodes"`
+	// Index and UUIDs are the cards of the partition on the nodes.
+	Index []uint   `yaml:"index"`
+	UUIDs []string `yaml:"uuids"`
+	// Namespaces and PodLabels select the pods of the partition: the pods in one of the
+	// namespaces, every namespace if empty, which have all the labels.
+	Namespaces []string          `yaml:"namespaces"`
+	PodLabels  map[string]string `yaml:"podLabels"`
+}
+
+// HasCard reports whether the card with index and uuid belongs to the partition.
+func (p CardPartition) HasCard(index uint, uuid string) bool {
+	return slices.Contains(p.Index, index) || slices.Contains(p.UUIDs, uuid)
+}
+
+// Selects reports whether a pod in namespace with labels belongs to the partition.
+func (p CardPartition) Selects(namespace string, labels map[string]string) bool {
+	if len(p.Namespaces) > 0 && !slices.Contains(p.Namespaces, namespace) {
+		return false
+	}
+	for k, v := range p.PodLabels {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateCardPartitions rejects partitions without a name, node, card or pod selector, and
+// cards set aside for two partitions of the same node.
+func ValidateCardPartitions(partitions []CardPartition) error {
+	names := make(map[string]bool, len(partitions))
+	// owners are the partitions of every card of every node, by index and by UUID.
+	owners := make(map[string]string)
+	for _, p := range partitions {
+		if p.Name == "" {
+			return fmt.Errorf("card partition without name")
+		}
+		if names[p.Name] {
+			return fmt.Errorf("card partition %s is listed twice", p.Name)
+		}
+		names[p.Name] = true
+		if len(p.Nodes) == 0 {
+			return fmt.Errorf("card partition %s lists no node", p.Name)
+		}
+		if len(p.Index) == 0 && len(p.UUIDs) == 0 {
+			return fmt.Errorf("card partition %s lists no card", p.Name)
+		}
+		if len(p.Namespaces) == 0 && len(p.PodLabels) == 0 {
+			return fmt.Errorf("card partition %s selects no pod, set namespaces or podLabels", p.Name)
+		}
+		for _, node := range p.Nodes {
+			cards := make([]string, 0, len(p.Index)+len(p.UUIDs))
+			for _, idx := range p.Index {
+				cards = append(cards, fmt.Sprintf("%s/%d", node, idx))
+			}
+			for _, uuid := range p.UUIDs {
+				cards = append(cards, node+"/"+uuid)
+			}
+			for _, card := range cards {
+				if owner, ok := owners[card]; ok && owner != p.Name {
+					return fmt.Errorf("card %s is in card partitions %s and %s", card, owner, p.Name)
+				}
+				owners[card] = p.Name
+			}
+		}
+	}
+	return nil
+}
+
+// NodeCardPartitions returns the card partitions of the config the devices were initialized
+// with which partition the cards of node, in the order they are listed.
+func NodeCardPartitions(node string) []CardPartition {
+	if activeConfig == nil {
+		return nil
+	}
+	var partitions []CardPartition
+	for _, p := range activeConfig.CardPartitions {
+		if slices.Contains(p.Nodes, node) {
+			partitions = append(partitions, p)
+		}
+	}
+	return partitions
+}
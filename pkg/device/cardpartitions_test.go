@@ -0,0 +1,54 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package device
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestValidateCardPartitions(t *testing.T) {
+	nodes := []string{"node1"}
+	assert.NilError(t, ValidateCardPartitions([]CardPartition{
+		{Name: "team-a", Nodes: nodes, Index: []uint{0, 1, 2, 3}, Namespaces: []string{"team-a"}},
+		{Name: "team-b", Nodes: nodes, Index: []uint{4, 5, 6, 7}, PodLabels: map[string]string{"team": "b"}},
+		{Name: "team-c", Nodes: []string{"node2"}, Index: []uint{0}, Namespaces: []string{"team-c"}},
+	}))
+	assert.ErrorContains(t, ValidateCardPartitions([]CardPartition{{Nodes: nodes, Index: []uint{0}, Namespaces: []string{"a"}}}), "without name")
+	assert.ErrorContains(t, ValidateCardPartitions([]CardPartition{
+		{Name: "a", Nodes: nodes, Index: []uint{0}, Namespaces: []string{"a"}},
+		{Name: "a", Nodes: nodes, Index: []uint{1}, Namespaces: []string{"a"}},
+	}), "listed twice")
+	assert.ErrorContains(t, ValidateCardPartitions([]CardPartition{{Name: "a", Index: []uint{0}, Namespaces: []string{"a"}}}), "no node")
+	assert.ErrorContains(t, ValidateCardPartitions([]CardPartition{{Name: "a", Nodes: nodes, Namespaces: []string{"a"}}}), "no card")
+	assert.ErrorContains(t, ValidateCardPartitions([]CardPartition{{Name: "a", Nodes: nodes, Index: []uint{0}}}), "selects no pod")
+	assert.ErrorContains(t, ValidateCardPartitions([]CardPartition{
+		{Name: "a", Nodes: nodes, Index: []uint{0, 1}, Namespaces: []string{"a"}},
+		{Name: "b", Nodes: []string{"node2", "node1"}, Index: []uint{1}, Namespaces: []string{"b"}},
+	}), "card node1/1 is in card partitions a and b")
+}
+
+func TestCardPartition(t *testing.T) {
+	p := CardPartition{Name: "a", Index: []uint{0}, UUIDs: []string{"GPU-1"}, Namespaces: []string{"team-a"}, PodLabels: map[string]string{"tier": "prod"}}
+	assert.Equal(t, p.HasCard(0, "GPU-0"), true)
+	assert.Equal(t, p.HasCard(1, "GPU-1"), true)
+	assert.Equal(t, p.HasCard(2, "GPU-2"), false)
+	assert.Equal(t, p.Selects("team-a", map[string]string{"tier": "prod", "app": "x"}), true)
+	assert.Equal(t, p.Selects("team-a", nil), false)
+	assert.Equal(t, p.Selects("team-b", map[string]string{"tier": "prod"}), false)
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package device
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CardRule limits what the scheduler allocates on a single card on top of its memory, cores
+// and split count. Limits left at 0 don't apply.
+type CardRule struct {
+	Name string `yaml:"name"`
+	// Types restricts the rule to cards whose type contains one of them, every card if empty.
+	Types []string `yaml:"types"`
+	// MaxMemoryFraction caps the memory reserved on the card, e.g. 0.8 keeps a fifth of it free.
+	MaxMemoryFraction float64 `yaml:"maxMemoryFraction"`
+	// MaxCores caps the cores reserved on the card, in the unit of the core request.
+	MaxCores int32 `yaml:"maxCores"`
+	// MaxCount caps the number of allocations on the card matching Shape.
+	MaxCount int32 `yaml:"maxCount"`
+	// Shape selects the allocations counted by MaxCount, every allocation if empty.
+	Shape CardRuleShape `yaml:"shape"`
+}
+
+// CardRuleShape matches the allocations requesting at least the given cores and memory.
+type CardRuleShape struct {
+	MinCores int32 `yaml:"minCores"`
+	// MinMemoryFraction is the fraction of the memory of the card.
+	MinMemoryFraction float64 `yaml:"minMemoryFraction"`
+}
+
+// AppliesTo reports whether the rule covers cards of cardType.
+func (r CardRule) AppliesTo(cardType string) bool {
+	if len(r.Types) == 0 {
+		return true
+	}
+	for _, t := range r.Types {
+		if strings.Contains(strings.ToUpper(cardType), strings.ToUpper(t)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateCardRules rejects rules without a name or limit and limits out of range.
+func ValidateCardRules(rules []CardRule) error {
+	names := make(map[string]bool, len(rules))
+	for _, r := range rules {
+		if r.Name == "" {
+			return fmt.Errorf("card rule without name")
+		}
+		if names[r.Name] {
+			return fmt.Errorf("card rule %s is listed twice", r.Name)
+		}
+		names[r.Name] = true
+		if r.MaxMemoryFraction < 0 || r.MaxMemoryFraction > 1 || r.Shape.MinMemoryFraction < 0 || r.Shape.MinMemoryFraction > 1 {
+			return fmt.Errorf("card rule %s: memory fractions must be between 0 and 1", r.Name)
+		}
+		if r.MaxCores < 0 || r.MaxCount < 0 || r.Shape.MinCores < 0 {
+			return fmt.Errorf("card rule %s: maxCores, maxCount and minCores must not be negative", r.Name)
+		}
+		if r.MaxMemoryFraction == 0 && r.MaxCores == 0 && r.MaxCount == 0 {
+			return fmt.Errorf("card rule %s sets no limit", r.Name)
+		}
+		if r.MaxCount == 0 && r.Shape != (CardRuleShape{}) {
+			return fmt.Errorf("card rule %s: shape only applies to maxCount", r.Name)
+		}
+	}
+	return nil
+}
+
+// CardRules returns the card rules of the config the devices were initialized with.
+func CardRules() []CardRule {
+	if activeConfig == nil {
+		return nil
+	}
+	return activeConfig.CardRules
+}
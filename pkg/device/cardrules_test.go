@@ -0,0 +1,39 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package device
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestValidateCardRules(t *testing.T) {
+	assert.NilError(t, ValidateCardRules([]CardRule{
+		{Name: "headroom", MaxMemoryFraction: 0.8},
+		{Name: "full-core", Types: []string{"A100"}, MaxCount: 2, Shape: CardRuleShape{MinCores: 100}},
+	}))
+	assert.ErrorContains(t, ValidateCardRules([]CardRule{{MaxCores: 100}}), "without name")
+	assert.ErrorContains(t, ValidateCardRules([]CardRule{{Name: "a", MaxCores: 1}, {Name: "a", MaxCores: 2}}), "listed twice")
+	assert.ErrorContains(t, ValidateCardRules([]CardRule{{Name: "a", MaxMemoryFraction: 80}}), "between 0 and 1")
+	assert.ErrorContains(t, ValidateCardRules([]CardRule{{Name: "a"}}), "no limit")
+	assert.ErrorContains(t, ValidateCardRules([]CardRule{{Name: "a", MaxCores: 100, Shape: CardRuleShape{MinCores: 50}}}), "shape only applies")
+
+	rule := CardRule{Name: "a", Types: []string{"a100"}, MaxCores: 1}
+	assert.Equal(t, rule.AppliesTo("NVIDIA-A100-SXM4-40GB"), true)
+	assert.Equal(t, rule.AppliesTo("NVIDIA-Tesla T4"), false)
+}
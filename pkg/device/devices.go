@@ -70,12 +70,20 @@ type Config struct {
 	IluvatarConfig  iluvatar.IluvatarConfig   `yaml:"iluvatar"`
 	EnflameConfig   enflame.EnflameConfig     `yaml:"enflame"`
 	VNPUs           []ascend.VNPUConfig       `yaml:"vnpus"`
+	// CardRules limit the allocations on every card of the types they select, see CardRule.
+	CardRules []CardRule `yaml:"cardRules"`
+	// CardPartitions set cards of some nodes aside for the pods they select, see CardPartition.
+	CardPartitions []CardPartition `yaml:"cardPartitions"`
 }
 
 var (
-	HandshakeAnnos  = map[string]string{}
-	RegisterAnnos   = map[string]string{}
-	devicesMap      map[string]Devices
+	HandshakeAnnos = map[string]string{}
+	RegisterAnnos  = map[string]string{}
+	devicesMap     map[string]Devices
+	// activeConfig is the config devicesMap was initialized with.
+	activeConfig *Config
+	// resourceNames are the configured device resources whose values must be positive integers.
+	resourceNames   map[corev1.ResourceName]struct{}
 	DevicesToHandle []string
 	configFile      string
 	DebugMode       bool
@@ -85,11 +93,24 @@ func GetDevices() map[string]Devices {
 	return devicesMap
 }
 
+// ActiveConfig returns the config the devices were last initialized with, nil before initialization.
+func ActiveConfig() *Config {
+	return activeConfig
+}
+
 func InitDevicesWithConfig(config *Config) error {
 	if err := validateConfig(config); err != nil {
 		klog.Errorf("Invalid configuration: %v", err)
 		return err
 	}
+	if err := ValidateCardRules(config.CardRules); err != nil {
+		klog.Errorf("Invalid configuration: %v", err)
+		return err
+	}
+	if err := ValidateCardPartitions(config.CardPartitions); err != nil {
+		klog.Errorf("Invalid configuration: %v", err)
+		return err
+	}
 
 	klog.Info("Initializing devices with configuration")
 
@@ -123,6 +144,21 @@ func InitDevicesWithConfig(config *Config) error {
 			if !ok {
 				return nil, fmt.Errorf("invalid configuration for %s", nvidia.NvidiaGPUCommonWord)
 			}
+			if err := nvidia.ValidateDeviceClasses(nvidiaConfig.DeviceClasses); err != nil {
+				return nil, err
+			}
+			if err := nvidia.ValidateCardTFLOPS(nvidiaConfig.CardTFLOPS); err != nil {
+				return nil, err
+			}
+			if err := nvidia.ValidateCoreRounding(nvidiaConfig.CoreRounding, nvidiaConfig.DeviceCoreScaling); err != nil {
+				return nil, err
+			}
+			if err := nvidia.ValidateCardMemoryTypes(nvidiaConfig.CardMemoryTypes); err != nil {
+				return nil, err
+			}
+			if err := nvidia.ValidateCoreLogLevel(nvidiaConfig.CoreLogLevel); err != nil {
+				return nil, err
+			}
 			return nvidia.InitNvidiaDevice(nvidiaConfig), nil
 		}, config.NvidiaConfig},
 		{cambricon.CambriconMLUDevice, cambricon.CambriconMLUCommonWord, func(cfg any) (Devices, error) {
@@ -189,6 +225,9 @@ func InitDevicesWithConfig(config *Config) error {
 		klog.Infof("Ascend device %s initialized", commonWord)
 	}
 
+	registerResourceNames(config)
+	activeConfig = config
+
 	if len(initErrors) > 0 {
 		return fmt.Errorf("errors occurred during initialization: %v", initErrors)
 	}
@@ -197,6 +236,37 @@ func InitDevicesWithConfig(config *Config) error {
 	return nil
 }
 
+func registerResourceNames(config *Config) {
+	// Priority resources are left out on purpose, 0 is a valid priority.
+	names := []string{
+		config.NvidiaConfig.ResourceCountName, config.NvidiaConfig.ResourceMemoryName,
+		config.NvidiaConfig.ResourceMemoryPercentageName, config.NvidiaConfig.ResourceCoreName,
+		config.CambriconConfig.ResourceCountName, config.CambriconConfig.ResourceMemoryName, config.CambriconConfig.ResourceCoreName,
+		config.HygonConfig.ResourceCountName, config.HygonConfig.ResourceMemoryName, config.HygonConfig.ResourceCoreName,
+		config.IluvatarConfig.ResourceCountName, config.IluvatarConfig.ResourceMemoryName, config.IluvatarConfig.ResourceCoreName,
+		config.MthreadsConfig.ResourceCountName, config.MthreadsConfig.ResourceMemoryName, config.MthreadsConfig.ResourceCoreName,
+		config.EnflameConfig.ResourceCountName, config.EnflameConfig.ResourcePercentageName,
+		config.EnflameConfig.ResourceMemoryName, config.EnflameConfig.ResourceCoreName,
+		config.MetaxConfig.ResourceCountName, config.MetaxConfig.ResourceVCountName,
+		config.MetaxConfig.ResourceVMemoryName, config.MetaxConfig.ResourceVCoreName,
+	}
+	for _, vnpu := range config.VNPUs {
+		names = append(names, vnpu.ResourceName, vnpu.ResourceMemoryName)
+	}
+	resourceNames = make(map[corev1.ResourceName]struct{})
+	for _, name := range names {
+		if name != "" {
+			resourceNames[corev1.ResourceName(name)] = struct{}{}
+		}
+	}
+}
+
+// IsDeviceResource reports whether name is a resource of a configured device.
+func IsDeviceResource(name corev1.ResourceName) bool {
+	_, ok := resourceNames[name]
+	return ok
+}
+
 func InitDevices() {
 	if len(devicesMap) > 0 {
 		klog.Info("Devices are already initialized, skipping initialization")
@@ -361,7 +431,11 @@ func PodAllocationTrySuccess(nodeName string, devName string, lockName string, p
 		klog.Errorf("Error getting pod %s/%s: %v", pod.Namespace, pod.Name, err)
 		return
 	}
-	annos := refreshed.Annotations[util.InRequestDevices[devName]]
+	annos, err := util.ExpandDevicesAnnotation(refreshed.Annotations[util.InRequestDevices[devName]])
+	if err != nil {
+		klog.Errorf("Error reading the devices to allocate of pod %s/%s: %v", pod.Namespace, pod.Name, err)
+		return
+	}
 	klog.Infof("Trying allocation success: %s", annos)
 	for _, val := range DevicesToHandle {
 		if strings.Contains(annos, val) {
@@ -25,6 +25,7 @@ import (
 	"gopkg.in/yaml.v2"
 	"gotest.tools/v3/assert"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/fake"
 
@@ -62,6 +63,9 @@ hygon:
   resourceCoreName: hygon.com/dcucores
 metax:
   resourceCountName: "metax-tech.com/gpu"
+  resourceVCountName: "metax-tech.com/sgpu"
+  resourceVMemoryName: "metax-tech.com/vmemory"
+  resourceVCoreName: "metax-tech.com/vcore"
 mthreads:
   resourceCountName: "mthreads.com/vgpu"
   resourceMemoryName: "mthreads.com/sgpu-memory"
@@ -70,6 +74,9 @@ iluvatar:
   resourceCountName: iluvatar.ai/vgpu
   resourceMemoryName: iluvatar.ai/vcuda-memory
   resourceCoreName: iluvatar.ai/vcuda-core
+enflame:
+  resourceCountName: enflame.com/vgcu
+  resourcePercentageName: enflame.com/vgcu-percentage
 vnpus:
 - chipName: 910B
   commonWord: Ascend910A
@@ -245,7 +252,10 @@ func createMthreadsConfig() mthreads.MthreadsConfig {
 
 func createMetaxConfig() metax.MetaxConfig {
 	return metax.MetaxConfig{
-		ResourceCountName: "metax-tech.com/gpu",
+		ResourceCountName:   "metax-tech.com/gpu",
+		ResourceVCountName:  "metax-tech.com/sgpu",
+		ResourceVMemoryName: "metax-tech.com/vmemory",
+		ResourceVCoreName:   "metax-tech.com/vcore",
 	}
 }
 
@@ -395,6 +405,84 @@ func Test_GetDevices(t *testing.T) {
 	}
 }
 
+// Test_VendorMemoryRoundTrip requests memory and cores from every registered vendor in its own
+// resources and checks that the bytes the scheduler accounts for encode back into the native
+// units of the vendor in the allocation annotation.
+func Test_VendorMemoryRoundTrip(t *testing.T) {
+	setupTest(t)
+
+	tests := map[string]struct {
+		limits map[string]string
+		// unit is the size in bytes of the native memory unit of the vendor.
+		unit int64
+		// mem and cores are the native values the annotation carries.
+		mem   int64
+		cores int32
+	}{
+		nvidia.NvidiaGPUDevice: {
+			limits: map[string]string{"nvidia.com/gpu": "1", "nvidia.com/gpumem": "3000", "nvidia.com/gpucores": "30"},
+			unit:   util.MiB, mem: 3000, cores: 30,
+		},
+		cambricon.CambriconMLUDevice: {
+			// The memory resource counts blocks of 256 MiB.
+			limits: map[string]string{"cambricon.com/vmlu": "1", "cambricon.com/mlu.smlu.vmemory": "4", "cambricon.com/mlu.smlu.vcore": "50"},
+			unit:   util.MiB, mem: 1024, cores: 50,
+		},
+		hygon.HygonDCUDevice: {
+			limits: map[string]string{"hygon.com/dcunum": "1", "hygon.com/dcumem": "2048", "hygon.com/dcucores": "40"},
+			unit:   util.MiB, mem: 2048, cores: 40,
+		},
+		mthreads.MthreadsGPUDevice: {
+			// The memory resource counts blocks of 512 MiB.
+			limits: map[string]string{"mthreads.com/vgpu": "1", "mthreads.com/sgpu-memory": "4", "mthreads.com/sgpu-core": "8"},
+			unit:   util.MiB, mem: 2048, cores: 8,
+		},
+		iluvatar.IluvatarGPUDevice: {
+			// The memory resource counts blocks of 256 MiB.
+			limits: map[string]string{"iluvatar.ai/vgpu": "1", "iluvatar.ai/vcuda-memory": "16", "iluvatar.ai/vcuda-core": "25"},
+			unit:   util.MiB, mem: 4096, cores: 25,
+		},
+		enflame.EnflameGPUDevice: {
+			// Memory is a percentage of the card, the unit of the annotations is 1.
+			limits: map[string]string{"enflame.com/vgcu": "1", "enflame.com/vgcu-percentage": "25"},
+			unit:   1, mem: 25, cores: 0,
+		},
+		metax.MetaxGPUDevice: {
+			// Whole cards only.
+			limits: map[string]string{"metax-tech.com/gpu": "1"},
+			unit:   util.MiB, mem: 0, cores: 100,
+		},
+		metax.MetaxSGPUDevice: {
+			// Memory without a unit is in GiB.
+			limits: map[string]string{"metax-tech.com/sgpu": "1", "metax-tech.com/vmemory": "4", "metax-tech.com/vcore": "60"},
+			unit:   util.MiB, mem: 4096, cores: 60,
+		},
+	}
+	for devType, dev := range GetDevices() {
+		t.Run(devType, func(t *testing.T) {
+			test, ok := tests[devType]
+			assert.Assert(t, ok, "add a case for the registered vendor %s", devType)
+			assert.Equal(t, util.MemoryUnits[devType], test.unit)
+
+			ctr := &corev1.Container{Name: "ctr", Resources: corev1.ResourceRequirements{Limits: corev1.ResourceList{}}}
+			for name, v := range test.limits {
+				ctr.Resources.Limits[corev1.ResourceName(name)] = resource.MustParse(v)
+			}
+			req := dev.GenerateResourceRequests(ctr)
+			assert.Equal(t, req.Type, devType)
+			assert.Equal(t, req.Memreq, test.mem*test.unit)
+			assert.Equal(t, req.Coresreq, test.cores)
+
+			allocated := util.ContainerDevices{{UUID: "dev-0", Type: req.Type, Usedmem: req.Memreq, Usedcores: req.Coresreq}}
+			encoded := util.EncodeContainerDevices(allocated)
+			assert.Equal(t, encoded, fmt.Sprintf("dev-0,%s,%d,%d:", devType, test.mem, test.cores))
+			decoded, err := util.DecodeContainerDevices(encoded)
+			assert.NilError(t, err)
+			assert.DeepEqual(t, decoded, allocated)
+		})
+	}
+}
+
 func Test_InitDefaultDevices(t *testing.T) {
 	InitDefaultDevices()
 	assert.Assert(t, len(devicesMap) > 0, "Expected devicesMap to be populated")
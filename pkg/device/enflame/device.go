@@ -67,6 +67,10 @@ func InitEnflameDevice(config EnflameConfig) *EnflameDevices {
 	EnflameResourceCount = config.ResourceCountName
 	EnflameResourcePercentage = config.ResourcePercentageName
 	util.SupportDevices[EnflameGPUDevice] = "hami.io/enflame-vgpu-devices-allocated"
+	// Enflame accounts memory in percentage shares of a card rather than in bytes,
+	// so shares are carried through unscaled.
+	util.MemoryUnits[EnflameGPUDevice] = 1
+	util.MemoryShares[EnflameGPUDevice] = true
 	return &EnflameDevices{
 		factor: 0,
 	}
@@ -229,7 +233,7 @@ func (dev *EnflameDevices) GenerateResourceRequests(ctr *corev1.Container) util.
 			return util.ContainerDeviceRequest{
 				Nums:             int32(n),
 				Type:             EnflameGPUDevice,
-				Memreq:           int32(memnum),
+				Memreq:           util.MemoryToBytes(EnflameGPUDevice, int64(memnum)),
 				MemPercentagereq: 0,
 				Coresreq:         0,
 			}
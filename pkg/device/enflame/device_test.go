@@ -390,7 +390,7 @@ func Test_GenerateResourceRequests(t *testing.T) {
 			want: util.ContainerDeviceRequest{
 				Nums:             int32(1),
 				Type:             EnflameGPUDevice,
-				Memreq:           int32(15),
+				Memreq:           int64(15),
 				MemPercentagereq: int32(0),
 				Coresreq:         int32(0),
 			},
@@ -420,7 +420,7 @@ func Test_GenerateResourceRequests(t *testing.T) {
 			want: util.ContainerDeviceRequest{
 				Nums:             int32(1),
 				Type:             EnflameGPUDevice,
-				Memreq:           int32(100),
+				Memreq:           int64(100),
 				MemPercentagereq: int32(0),
 				Coresreq:         int32(0),
 			},
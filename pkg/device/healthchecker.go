@@ -0,0 +1,59 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package device
+
+import "sync"
+
+// UnhealthyDevice is a device a DeviceHealthChecker found unhealthy.
+type UnhealthyDevice struct {
+	// ID is the ID the device is advertised to the kubelet with.
+	ID string
+	// Reason is why the device is unhealthy, e.g. the Xid of an NVIDIA GPU.
+	Reason string
+}
+
+// DeviceHealthChecker watches the health signals of the devices of one vendor, e.g. the Xid
+// events of NVIDIA GPUs or the fault codes of Ascend NPUs.
+type DeviceHealthChecker interface {
+	// CheckHealth watches the devices with ids until stop is closed and sends every one of them
+	// turning unhealthy to unhealthy. It returns an error if the health signals can't be watched.
+	CheckHealth(stop <-chan any, ids []string, unhealthy chan<- UnhealthyDevice) error
+}
+
+var (
+	healthCheckersMutex sync.RWMutex
+	healthCheckers      = map[string]DeviceHealthChecker{}
+)
+
+// RegisterHealthChecker makes checker the health checker of the device plugins of vendor, e.g.
+// nvidia.NvidiaGPUDevice, replacing the one registered before.
+func RegisterHealthChecker(vendor string, checker DeviceHealthChecker) {
+	healthCheckersMutex.Lock()
+	defer healthCheckersMutex.Unlock()
+	if checker == nil {
+		delete(healthCheckers, vendor)
+		return
+	}
+	healthCheckers[vendor] = checker
+}
+
+// HealthCheckerFor returns the health checker registered for vendor, nil if none is.
+func HealthCheckerFor(vendor string) DeviceHealthChecker {
+	healthCheckersMutex.RLock()
+	defer healthCheckersMutex.RUnlock()
+	return healthCheckers[vendor]
+}
@@ -0,0 +1,40 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package device
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+type fakeHealthChecker struct{}
+
+func (fakeHealthChecker) CheckHealth(stop <-chan any, ids []string, unhealthy chan<- UnhealthyDevice) error {
+	return nil
+}
+
+func TestRegisterHealthChecker(t *testing.T) {
+	assert.Assert(t, HealthCheckerFor("vendor") == nil)
+
+	RegisterHealthChecker("vendor", fakeHealthChecker{})
+	assert.Equal(t, HealthCheckerFor("vendor"), DeviceHealthChecker(fakeHealthChecker{}))
+	assert.Assert(t, HealthCheckerFor("other") == nil)
+
+	RegisterHealthChecker("vendor", nil)
+	assert.Assert(t, HealthCheckerFor("vendor") == nil)
+}
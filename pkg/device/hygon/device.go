@@ -68,6 +68,7 @@ func InitDCUDevice(config HygonConfig) *DCUDevices {
 	HygonResourceCores = config.ResourceCoreName
 	util.InRequestDevices[HygonDCUDevice] = "hami.io/dcu-devices-to-allocate"
 	util.SupportDevices[HygonDCUDevice] = "hami.io/dcu-devices-allocated"
+	util.MemoryUnits[HygonDCUDevice] = util.MiB
 	util.HandshakeAnnos[HygonDCUDevice] = HandshakeAnnos
 	return &DCUDevices{}
 }
@@ -243,7 +244,7 @@ func (dev *DCUDevices) GenerateResourceRequests(ctr *corev1.Container) util.Cont
 			return util.ContainerDeviceRequest{
 				Nums:             int32(n),
 				Type:             HygonDCUDevice,
-				Memreq:           int32(memnum),
+				Memreq:           util.MemoryToBytes(HygonDCUDevice, int64(memnum)),
 				MemPercentagereq: int32(mempnum),
 				Coresreq:         corenum,
 			}
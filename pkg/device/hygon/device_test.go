@@ -545,7 +545,7 @@ func Test_PatchAnnotations(t *testing.T) {
 								Idx:       1,
 								UUID:      "test1",
 								Type:      HygonDCUDevice,
-								Usedmem:   int32(2048),
+								Usedmem:   2048 * util.MiB,
 								Usedcores: int32(1),
 							},
 						},
@@ -613,7 +613,7 @@ func Test_GenerateResourceRequests(t *testing.T) {
 			want: util.ContainerDeviceRequest{
 				Nums:             int32(1),
 				Type:             HygonDCUDevice,
-				Memreq:           int32(1024),
+				Memreq:           1024 * util.MiB,
 				MemPercentagereq: int32(0),
 				Coresreq:         int32(1),
 			},
@@ -635,7 +635,7 @@ func Test_GenerateResourceRequests(t *testing.T) {
 			want: util.ContainerDeviceRequest{
 				Nums:             int32(1),
 				Type:             HygonDCUDevice,
-				Memreq:           int32(1024),
+				Memreq:           1024 * util.MiB,
 				MemPercentagereq: int32(0),
 				Coresreq:         int32(1),
 			},
@@ -656,7 +656,7 @@ func Test_GenerateResourceRequests(t *testing.T) {
 			want: util.ContainerDeviceRequest{
 				Nums:             int32(1),
 				Type:             HygonDCUDevice,
-				Memreq:           int32(0),
+				Memreq:           int64(0),
 				MemPercentagereq: int32(100),
 				Coresreq:         int32(1),
 			},
@@ -62,6 +62,7 @@ func InitIluvatarDevice(config IluvatarConfig) *IluvatarDevices {
 	IluvatarResourceCores = config.ResourceCoreName
 	util.InRequestDevices[IluvatarGPUDevice] = "hami.io/iluvatar-vgpu-devices-to-allocate"
 	util.SupportDevices[IluvatarGPUDevice] = "hami.io/iluvatar-vgpu-devices-allocated"
+	util.MemoryUnits[IluvatarGPUDevice] = util.MiB
 	return &IluvatarDevices{}
 }
 
@@ -212,7 +213,7 @@ func (dev *IluvatarDevices) GenerateResourceRequests(ctr *corev1.Container) util
 			return util.ContainerDeviceRequest{
 				Nums:             int32(n),
 				Type:             IluvatarGPUDevice,
-				Memreq:           int32(memnum),
+				Memreq:           util.MemoryToBytes(IluvatarGPUDevice, int64(memnum)),
 				MemPercentagereq: int32(mempnum),
 				Coresreq:         corenum,
 			}
@@ -389,7 +389,7 @@ func Test_GenerateResourceRequests(t *testing.T) {
 			want: util.ContainerDeviceRequest{
 				Nums:             int32(1),
 				Type:             IluvatarGPUDevice,
-				Memreq:           int32(256000),
+				Memreq:           256000 * util.MiB,
 				MemPercentagereq: int32(0),
 				Coresreq:         int32(100),
 			},
@@ -419,7 +419,7 @@ func Test_GenerateResourceRequests(t *testing.T) {
 			want: util.ContainerDeviceRequest{
 				Nums:             int32(1),
 				Type:             IluvatarGPUDevice,
-				Memreq:           int32(0),
+				Memreq:           int64(0),
 				MemPercentagereq: int32(100),
 				Coresreq:         int32(0),
 			},
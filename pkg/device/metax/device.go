@@ -46,6 +46,7 @@ func InitMetaxDevice(config MetaxConfig) *MetaxDevices {
 	MetaxResourceCount = config.ResourceCountName
 	util.InRequestDevices[MetaxGPUDevice] = "hami.io/metax-gpu-devices-to-allocate"
 	util.SupportDevices[MetaxGPUDevice] = "hami.io/metax-gpu-devices-allocated"
+	util.MemoryUnits[MetaxGPUDevice] = util.MiB
 	return &MetaxDevices{}
 }
 
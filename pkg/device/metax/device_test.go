@@ -342,7 +342,7 @@ func Test_CustomFilterRule(t *testing.T) {
 								Type:      MetaxGPUDevice,
 								UUID:      "test-0000",
 								Usedcores: int32(1),
-								Usedmem:   int32(1000),
+								Usedmem:   1000 * util.MiB,
 							},
 						},
 					},
@@ -372,7 +372,7 @@ func Test_CustomFilterRule(t *testing.T) {
 								Type:      MetaxGPUDevice,
 								UUID:      "test-0000",
 								Usedcores: int32(1),
-								Usedmem:   int32(1000),
+								Usedmem:   1000 * util.MiB,
 							},
 						},
 					},
@@ -426,14 +426,14 @@ func Test_ScoreNode(t *testing.T) {
 							Idx:       int(0),
 							UUID:      "test-0",
 							Type:      MetaxGPUDevice,
-							Usedmem:   int32(1000),
+							Usedmem:   1000 * util.MiB,
 							Usedcores: int32(1),
 						},
 						{
 							Idx:       int(1),
 							UUID:      "test-1",
 							Type:      MetaxGPUDevice,
-							Usedmem:   int32(1000),
+							Usedmem:   1000 * util.MiB,
 							Usedcores: int32(1),
 						},
 					},
@@ -462,7 +462,7 @@ func Test_ScoreNode(t *testing.T) {
 							Idx:       int(0),
 							UUID:      "test-0",
 							Type:      MetaxGPUDevice,
-							Usedmem:   int32(1000),
+							Usedmem:   1000 * util.MiB,
 							Usedcores: int32(1),
 						},
 					},
@@ -110,7 +110,7 @@ func convertHAMIPodDeviceToMetaxPodDevice(hamiPodDevices util.PodSingleDevice) P
 		for deviceIdx, device := range ctrDevices {
 			metaxDevices[ctrIdx][deviceIdx] = ContainerMetaxSDevice{
 				UUID:    device.UUID,
-				VRam:    device.Usedmem,
+				VRam:    int32(util.MemoryFromBytes(MetaxSGPUDevice, device.Usedmem)),
 				Compute: device.Usedcores,
 			}
 		}
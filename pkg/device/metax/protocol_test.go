@@ -116,14 +116,14 @@ func TestConvertHAMIPodDeviceToMetaxPodDevice(t *testing.T) {
 						Idx:       0,
 						UUID:      "GPU-a16ac188-0592-5c8f-2b6e-8bd8e7a604a0",
 						Type:      MetaxGPUDevice,
-						Usedmem:   10,
+						Usedmem:   10 * util.MiB,
 						Usedcores: 50,
 					},
 					{
 						Idx:       1,
 						UUID:      "GPU-a16ac188-0592-5c8f-2b6e-8bd8e7a604a1",
 						Type:      MetaxGPUDevice,
-						Usedmem:   1024,
+						Usedmem:   1024 * util.MiB,
 						Usedcores: 30,
 					},
 				},
@@ -132,14 +132,14 @@ func TestConvertHAMIPodDeviceToMetaxPodDevice(t *testing.T) {
 						Idx:       3,
 						UUID:      "GPU-a16ac188-0592-5c8f-2b6e-8bd8e7a604a3",
 						Type:      MetaxGPUDevice,
-						Usedmem:   10 * 1024,
+						Usedmem:   10 * 1024 * util.MiB,
 						Usedcores: 20,
 					},
 					{
 						Idx:       7,
 						UUID:      "GPU-a16ac188-0592-5c8f-2b6e-8bd8e7a604a7",
 						Type:      MetaxGPUDevice,
-						Usedmem:   64 * 1024,
+						Usedmem:   64 * 1024 * util.MiB,
 						Usedcores: 80,
 					},
 				},
@@ -54,6 +54,7 @@ func InitMetaxSDevice(config MetaxConfig) *MetaxSDevices {
 
 	util.InRequestDevices[MetaxSGPUDevice] = "hami.io/metax-sgpu-devices-to-allocate"
 	util.SupportDevices[MetaxSGPUDevice] = "hami.io/metax-sgpu-devices-allocated"
+	util.MemoryUnits[MetaxSGPUDevice] = util.MiB
 
 	return &MetaxSDevices{}
 }
@@ -242,7 +243,7 @@ func (sdev *MetaxSDevices) GenerateResourceRequests(ctr *corev1.Container) util.
 	return util.ContainerDeviceRequest{
 		Nums:             int32(count),
 		Type:             MetaxSGPUDevice,
-		Memreq:           int32(mem),
+		Memreq:           util.MemoryToBytes(MetaxSGPUDevice, mem),
 		MemPercentagereq: int32(memPercent),
 		Coresreq:         int32(core),
 	}
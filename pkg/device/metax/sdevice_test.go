@@ -103,7 +103,7 @@ func TestGenerateResourceRequests(t *testing.T) {
 			expected: util.ContainerDeviceRequest{
 				Nums:             1,
 				Type:             MetaxSGPUDevice,
-				Memreq:           16 * 1024,
+				Memreq:           16 * 1024 * util.MiB,
 				MemPercentagereq: 0,
 				Coresreq:         100,
 			},
@@ -123,7 +123,7 @@ func TestGenerateResourceRequests(t *testing.T) {
 			expected: util.ContainerDeviceRequest{
 				Nums:             1,
 				Type:             MetaxSGPUDevice,
-				Memreq:           16 * 1024,
+				Memreq:           16 * 1024 * util.MiB,
 				MemPercentagereq: 0,
 				Coresreq:         60,
 			},
@@ -143,7 +143,7 @@ func TestGenerateResourceRequests(t *testing.T) {
 			expected: util.ContainerDeviceRequest{
 				Nums:             1,
 				Type:             MetaxSGPUDevice,
-				Memreq:           1024,
+				Memreq:           1024 * util.MiB,
 				MemPercentagereq: 0,
 				Coresreq:         60,
 			},
@@ -163,7 +163,7 @@ func TestGenerateResourceRequests(t *testing.T) {
 			expected: util.ContainerDeviceRequest{
 				Nums:             1,
 				Type:             MetaxSGPUDevice,
-				Memreq:           16 * 1024,
+				Memreq:           16 * 1024 * util.MiB,
 				MemPercentagereq: 0,
 				Coresreq:         60,
 			},
@@ -69,6 +69,7 @@ func InitMthreadsDevice(config MthreadsConfig) *MthreadsDevices {
 	MthreadsResourceMemory = config.ResourceMemoryName
 	util.InRequestDevices[MthreadsGPUDevice] = "hami.io/mthreads-vgpu-devices-to-allocate"
 	util.SupportDevices[MthreadsGPUDevice] = "hami.io/mthreads-vgpu-devices-allocated"
+	util.MemoryUnits[MthreadsGPUDevice] = util.MiB
 	return &MthreadsDevices{}
 }
 
@@ -242,7 +243,7 @@ func (dev *MthreadsDevices) GenerateResourceRequests(ctr *corev1.Container) util
 			return util.ContainerDeviceRequest{
 				Nums:             int32(n),
 				Type:             MthreadsGPUDevice,
-				Memreq:           int32(memnum) / int32(n),
+				Memreq:           util.MemoryToBytes(MthreadsGPUDevice, int64(memnum)/n),
 				MemPercentagereq: int32(mempnum),
 				Coresreq:         corenum / int32(n),
 			}
@@ -245,7 +245,7 @@ func Test_PatchAnnotations(t *testing.T) {
 								Idx:       0,
 								UUID:      "test1",
 								Type:      MthreadsGPUDevice,
-								Usedmem:   int32(1000),
+								Usedmem:   1000 * util.MiB,
 								Usedcores: int32(1),
 							},
 						},
@@ -443,7 +443,7 @@ func Test_GenerateResourceRequests(t *testing.T) {
 			want: util.ContainerDeviceRequest{
 				Nums:             int32(1),
 				Type:             MthreadsGPUDevice,
-				Memreq:           int32(512000),
+				Memreq:           512000 * util.MiB,
 				MemPercentagereq: int32(0),
 				Coresreq:         int32(1),
 			},
@@ -474,7 +474,7 @@ func Test_GenerateResourceRequests(t *testing.T) {
 			want: util.ContainerDeviceRequest{
 				Nums:             int32(1),
 				Type:             MthreadsGPUDevice,
-				Memreq:           int32(0),
+				Memreq:           int64(0),
 				MemPercentagereq: int32(100),
 				Coresreq:         int32(0),
 			},
@@ -0,0 +1,90 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nvidia
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// DeviceClass is a named GPU request, e.g. "inference-small" for 4GB and 25% of the cores of a T4.
+// Admins can re-map a class to other hardware without touching the pods requesting it.
+type DeviceClass struct {
+	Name string `yaml:"name"`
+	// Count is the number of cards, 1 if unset.
+	Count int32 `yaml:"count"`
+	// Memory is the device memory of every card in MiB.
+	Memory int32 `yaml:"memory"`
+	// MemoryPercentage is the device memory of every card in percent of the card memory.
+	MemoryPercentage int32 `yaml:"memoryPercentage"`
+	// Cores is the percentage of the compute cores of every card.
+	Cores int32 `yaml:"cores"`
+	// Types restricts the class to cards whose type contains one of them, like nvidia.com/use-gputype.
+	Types []string `yaml:"types"`
+}
+
+// ValidateDeviceClasses rejects classes which couldn't be expanded into a valid request.
+func ValidateDeviceClasses(classes []DeviceClass) error {
+	names := make([]string, 0, len(classes))
+	for _, c := range classes {
+		if c.Name == "" || strings.ContainsAny(c.Name, ", =") {
+			return fmt.Errorf("invalid device class name %q", c.Name)
+		}
+		if slices.Contains(names, c.Name) {
+			return fmt.Errorf("device class %s is defined twice", c.Name)
+		}
+		names = append(names, c.Name)
+		switch {
+		case c.Count < 0:
+			return fmt.Errorf("device class %s: count must not be negative", c.Name)
+		case c.Memory < 0:
+			return fmt.Errorf("device class %s: memory must not be negative", c.Name)
+		case c.MemoryPercentage < 0 || c.MemoryPercentage > 100:
+			return fmt.Errorf("device class %s: memoryPercentage must be between 0 and 100", c.Name)
+		case c.Cores < 0 || c.Cores > 100:
+			return fmt.Errorf("device class %s: cores must be between 0 and 100", c.Name)
+		case c.Memory > 0 && c.MemoryPercentage > 0:
+			return fmt.Errorf("device class %s: memory and memoryPercentage are exclusive", c.Name)
+		}
+		for _, t := range c.Types {
+			if strings.TrimSpace(t) == "" || strings.Contains(t, ",") {
+				return fmt.Errorf("device class %s: invalid type %q", c.Name, t)
+			}
+		}
+	}
+	return nil
+}
+
+// DeviceClass returns the class called name.
+func (dev *NvidiaGPUDevices) DeviceClass(name string) (DeviceClass, bool) {
+	for _, c := range dev.config.DeviceClasses {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return DeviceClass{}, false
+}
+
+// DeviceClassNames returns the names of the configured classes.
+func (dev *NvidiaGPUDevices) DeviceClassNames() []string {
+	names := make([]string, 0, len(dev.config.DeviceClasses))
+	for _, c := range dev.config.DeviceClasses {
+		names = append(names, c.Name)
+	}
+	return names
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nvidia
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func Test_ValidateDeviceClasses(t *testing.T) {
+	tests := []struct {
+		name    string
+		classes []DeviceClass
+		err     string
+	}{
+		{name: "valid", classes: []DeviceClass{{Name: "inference-small", Memory: 4096, Cores: 25, Types: []string{"T4"}}, {Name: "training", Count: 8}}},
+		{name: "no name", classes: []DeviceClass{{Memory: 4096}}, err: `invalid device class name ""`},
+		{name: "twice", classes: []DeviceClass{{Name: "a"}, {Name: "a"}}, err: "defined twice"},
+		{name: "memory and percentage", classes: []DeviceClass{{Name: "a", Memory: 4096, MemoryPercentage: 50}}, err: "exclusive"},
+		{name: "cores out of range", classes: []DeviceClass{{Name: "a", Cores: 120}}, err: "cores must be between 0 and 100"},
+		{name: "type list", classes: []DeviceClass{{Name: "a", Types: []string{"T4,A10"}}}, err: `invalid type "T4,A10"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateDeviceClasses(test.classes)
+			if test.err == "" {
+				assert.NilError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, test.err)
+		})
+	}
+
+	dev := InitNvidiaDevice(NvidiaConfig{DeviceClasses: []DeviceClass{{Name: "inference-small", Memory: 4096}}})
+	class, ok := dev.DeviceClass("inference-small")
+	assert.Assert(t, ok)
+	assert.Equal(t, class.Memory, int32(4096))
+	_, ok = dev.DeviceClass("training")
+	assert.Assert(t, !ok)
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nvidia
+
+import (
+	"fmt"
+	"math"
+)
+
+// CoreRounding is how a share of the cores of a card which isn't a whole percentage, e.g. the
+// share delivering a hami.io/tflops request, is turned into the cores HAMi-core enforces.
+type CoreRounding string
+
+const (
+	// CoreRoundingCeil rounds up: a pod never gets less than it asked for, but fewer pods fit a card.
+	CoreRoundingCeil CoreRounding = "ceil"
+	// CoreRoundingFloor rounds down, to at least 1: more pods fit a card, each may get slightly less.
+	CoreRoundingFloor CoreRounding = "floor"
+	// CoreRoundingExact doesn't round: a share which isn't a whole percentage doesn't fit.
+	CoreRoundingExact CoreRounding = "exact"
+)
+
+// coreRoundingTolerance absorbs the float error of shares meant to be whole, e.g. 1.15*100.
+const coreRoundingTolerance = 1e-6
+
+// ValidateCoreRounding rejects unknown policies, and a deviceCoreScaling which doesn't advertise
+// a whole number of cores under CoreRoundingExact.
+func ValidateCoreRounding(r CoreRounding, coreScaling float64) error {
+	switch r {
+	case "", CoreRoundingCeil, CoreRoundingFloor, CoreRoundingExact:
+	default:
+		return fmt.Errorf("unknown coreRounding %q, %s, %s or %s are allowed", r, CoreRoundingCeil, CoreRoundingFloor, CoreRoundingExact)
+	}
+	if coreScaling > 0 {
+		if _, ok := RoundCores(coreScaling*100, r); !ok {
+			return fmt.Errorf("deviceCoreScaling %v advertises a fraction of a core, which coreRounding %s can't", coreScaling, r)
+		}
+	}
+	return nil
+}
+
+// RoundCores returns cores, a share of the cores of a card in percent, as the whole number
+// enforced by HAMi-core under r, empty meaning CoreRoundingCeil. It returns false if r is
+// CoreRoundingExact and cores isn't whole.
+func RoundCores(cores float64, r CoreRounding) (int32, bool) {
+	if whole := math.Round(cores); math.Abs(cores-whole) < coreRoundingTolerance {
+		return int32(whole), true
+	}
+	switch r {
+	case CoreRoundingFloor:
+		return int32(max(math.Floor(cores), 1)), true
+	case CoreRoundingExact:
+		return 0, false
+	default:
+		return int32(math.Ceil(cores)), true
+	}
+}
+
+// ScaledCores returns the cores a card advertises with deviceCoreScaling, rounded with r like
+// the shares pods get, so the cores advertised and the cores enforced add up the same way.
+func ScaledCores(coreScaling float64, r CoreRounding) int32 {
+	cores, ok := RoundCores(coreScaling*100, r)
+	if !ok {
+		// ValidateCoreRounding rejects this, advertise no more than the card has anyway.
+		cores, _ = RoundCores(coreScaling*100, CoreRoundingFloor)
+	}
+	return cores
+}
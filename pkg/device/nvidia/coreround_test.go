@@ -0,0 +1,75 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nvidia
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func Test_RoundCores(t *testing.T) {
+	tests := []struct {
+		cores float64
+		r     CoreRounding
+		want  int32
+		ok    bool
+	}{
+		{cores: 100.0 / 3, r: "", want: 34, ok: true},
+		{cores: 100.0 / 3, r: CoreRoundingCeil, want: 34, ok: true},
+		{cores: 100.0 / 3, r: CoreRoundingFloor, want: 33, ok: true},
+		{cores: 100.0 / 3, r: CoreRoundingExact, ok: false},
+		{cores: 0.4, r: CoreRoundingFloor, want: 1, ok: true},
+		// Float error of shares meant to be whole isn't rounded away.
+		{cores: 1.15 * 100, r: CoreRoundingFloor, want: 115, ok: true},
+		{cores: 1.15 * 100, r: CoreRoundingExact, want: 115, ok: true},
+		{cores: 25, r: CoreRoundingCeil, want: 25, ok: true},
+	}
+	for _, test := range tests {
+		got, ok := RoundCores(test.cores, test.r)
+		assert.Equal(t, ok, test.ok, "%v %s", test.cores, test.r)
+		assert.Equal(t, got, test.want, "%v %s", test.cores, test.r)
+	}
+}
+
+func Test_ValidateCoreRounding(t *testing.T) {
+	assert.NilError(t, ValidateCoreRounding("", 1))
+	assert.NilError(t, ValidateCoreRounding(CoreRoundingExact, 1.5))
+	assert.ErrorContains(t, ValidateCoreRounding("round", 1), "unknown coreRounding")
+	assert.ErrorContains(t, ValidateCoreRounding(CoreRoundingExact, 1.3333), "fraction of a core")
+	assert.NilError(t, ValidateCoreRounding(CoreRoundingFloor, 1.3333))
+
+	assert.Equal(t, ScaledCores(1.3333, CoreRoundingCeil), int32(134))
+	assert.Equal(t, ScaledCores(1.3333, CoreRoundingFloor), int32(133))
+	assert.Equal(t, ScaledCores(1.15, CoreRoundingFloor), int32(115))
+	assert.Equal(t, ScaledCores(1, CoreRoundingExact), int32(100))
+}
+
+func Test_TFLOPSCoresRounding(t *testing.T) {
+	for r, want := range map[CoreRounding]int32{CoreRoundingCeil: 34, CoreRoundingFloor: 33} {
+		dev := InitNvidiaDevice(NvidiaConfig{CardTFLOPS: []CardTFLOPS{{Model: "L40", TFLOPS: 90}}, CoreRounding: r})
+		cores, ok := dev.TFLOPSCores("NVIDIA-L40", 30)
+		assert.Assert(t, ok)
+		assert.Equal(t, cores, want, "%s", r)
+	}
+	dev := InitNvidiaDevice(NvidiaConfig{CardTFLOPS: []CardTFLOPS{{Model: "L40", TFLOPS: 90}}, CoreRounding: CoreRoundingExact})
+	_, ok := dev.TFLOPSCores("NVIDIA-L40", 30)
+	assert.Assert(t, !ok)
+	cores, ok := dev.TFLOPSCores("NVIDIA-L40", 45)
+	assert.Assert(t, ok)
+	assert.Equal(t, cores, int32(50))
+}
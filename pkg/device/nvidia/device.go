@@ -21,6 +21,7 @@ import (
 	"flag"
 	"fmt"
 	"slices"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -34,23 +35,37 @@ import (
 )
 
 const (
-	HandshakeAnnos      = "hami.io/node-handshake"
-	RegisterAnnos       = "hami.io/node-nvidia-register"
-	NvidiaGPUDevice     = "NVIDIA"
-	NvidiaGPUCommonWord = "GPU"
-	GPUInUse            = "nvidia.com/use-gputype"
-	GPUNoUse            = "nvidia.com/nouse-gputype"
-	NumaBind            = "nvidia.com/numa-bind"
-	NodeLockNvidia      = "hami.io/mutex.lock"
+	HandshakeAnnos = "hami.io/node-handshake"
+	RegisterAnnos  = "hami.io/node-nvidia-register"
+	// DeviceAttributesAnnos holds per-device attributes such as PCIe topology, keyed by UUID.
+	DeviceAttributesAnnos = "hami.io/node-nvidia-device-attributes"
+	// DeviceUtilizationAnnos holds the live SM and memory bandwidth utilization sampled by the device plugin, keyed by UUID.
+	DeviceUtilizationAnnos = "hami.io/node-nvidia-device-utilization"
+	NvidiaGPUDevice        = "NVIDIA"
+	NvidiaGPUCommonWord    = "GPU"
+	GPUInUse               = "nvidia.com/use-gputype"
+	GPUNoUse               = "nvidia.com/nouse-gputype"
+	NumaBind               = "nvidia.com/numa-bind"
+	NodeLockNvidia         = "hami.io/mutex.lock"
 	// GPUUseUUID is user can use specify GPU device for set GPU UUID.
 	GPUUseUUID = "nvidia.com/use-gpuuuid"
 	// GPUNoUseUUID is user can not use specify GPU device for set GPU UUID.
 	GPUNoUseUUID = "nvidia.com/nouse-gpuuuid"
 	AllocateMode = "nvidia.com/vgpu-mode"
+	// MigSameProfile set to "true" makes the nvidia.com/gpu count of every container a number of
+	// MIG instances of a single profile, several of which may come from the same card.
+	MigSameProfile = "nvidia.com/mig-same-profile"
+	// MigSharedCompute set to "true" has the containers of a pod share MIG instances with other
+	// such pods, each limited to its nvidia.com/gpucores of the compute of the instance by
+	// HAMi-core.
+	MigSharedCompute = "nvidia.com/mig-shared-compute"
 
 	MigMode      = "mig"
 	HamiCoreMode = "hami-core"
 	MpsMode      = "mps"
+
+	// AllocatedDevicesAnnos holds the NVIDIA devices allocated to the containers of a pod.
+	AllocatedDevicesAnnos = "hami.io/vgpu-devices-allocated"
 )
 
 var (
@@ -60,6 +75,12 @@ var (
 
 	// DevicePluginFilterDevice need device-plugin filter this device, don't register this device.
 	DevicePluginFilterDevice *FilterDevice
+	// DevicePluginSystemReserved are whole cards the device-plugin keeps out of normal scheduling.
+	DevicePluginSystemReserved *SystemReserved
+	// DevicePluginCoreReservation is the part of the cores of cards the device-plugin doesn't advertise.
+	DevicePluginCoreReservation *CoreReservation
+	// DevicePluginHealthConditions are the NVML conditions the device-plugin marks cards unhealthy on.
+	DevicePluginHealthConditions *HealthConditions
 )
 
 type MigPartedSpec struct {
@@ -105,6 +126,18 @@ type NvidiaConfig struct {
 	MigGeometriesList []util.AllowedMigGeometries `yaml:"knownMigGeometries"`
 	// GPUCorePolicy through webhook automatic injected to container env
 	GPUCorePolicy GPUCoreUtilizationPolicy `yaml:"gpuCorePolicy"`
+	// DeviceClasses are named requests pods can refer to with the hami.io/class annotation.
+	DeviceClasses []DeviceClass `yaml:"deviceClasses"`
+	// CardTFLOPS is the throughput of the card models pods can request with hami.io/tflops.
+	CardTFLOPS []CardTFLOPS `yaml:"cardTFLOPS"`
+	// CoreRounding is how shares of the cores of a card which aren't whole percentages are
+	// rounded, by the scheduler and the device plugin alike. Empty means CoreRoundingCeil.
+	CoreRounding CoreRounding `yaml:"coreRounding"`
+	// CardMemoryTypes add card models to the built-in memory type table, or override it.
+	CardMemoryTypes []CardMemoryType `yaml:"cardMemoryTypes"`
+	// CoreLogLevel is the HAMi-core log level of GPU containers, 0 to MaxCoreLogLevel. Empty
+	// leaves the default of HAMi-core. Pods override it with hami.io/core-log-level.
+	CoreLogLevel string `yaml:"coreLogLevel"`
 }
 
 type FilterDevice struct {
@@ -114,15 +147,52 @@ type FilterDevice struct {
 	Index []uint `json:"index"`
 }
 
+// SystemReserved is a pool of whole cards kept free for emergency or debug workloads.
+type SystemReserved struct {
+	// Index lists the reserved cards by index.
+	Index []uint `json:"index"`
+	// Count reserves any Count cards when Index is empty.
+	Count uint `json:"count"`
+}
+
+// CoreReservation holds back part of the cores of cards, e.g. for a system service running
+// outside HAMi. Pods are only given the rest, as percentages of the whole card.
+type CoreReservation struct {
+	// Cores is the percentage of the cores of a card held back.
+	Cores int32 `json:"cores"`
+	// Index restricts the reservation to the cards with these indexes, all cards if empty.
+	Index []uint `json:"index"`
+}
+
+// HealthConditions selects the NVML conditions which mark a card unhealthy. Without it only
+// the critical Xids other than the application ones do.
+type HealthConditions struct {
+	// Xids, if set, are the only Xids marking a card unhealthy.
+	Xids []uint64 `json:"xids"`
+	// IgnoredXids never mark a card unhealthy.
+	IgnoredXids []uint64 `json:"ignoredxids"`
+	// UncorrectedECC marks a card unhealthy once it counts this many uncorrected ECC errors
+	// since the driver was loaded, 0 disables it.
+	UncorrectedECC uint64 `json:"uncorrectedecc"`
+	// CorrectedECC is UncorrectedECC for corrected ECC errors.
+	CorrectedECC uint64 `json:"correctedecc"`
+	// ThrottleReasons mark a card unhealthy once its clocks stay throttled for one of them,
+	// e.g. hw_thermal_slowdown.
+	ThrottleReasons []string `json:"throttlereasons"`
+}
+
 type DevicePluginConfigs struct {
 	Nodeconfig []struct {
-		Name                string        `json:"name"`
-		OperatingMode       string        `json:"operatingmode"`
-		Devicememoryscaling float64       `json:"devicememoryscaling"`
-		Devicecorescaling   float64       `json:"devicecorescaling"`
-		Devicesplitcount    uint          `json:"devicesplitcount"`
-		Migstrategy         string        `json:"migstrategy"`
-		FilterDevice        *FilterDevice `json:"filterdevices"`
+		Name                string            `json:"name"`
+		OperatingMode       string            `json:"operatingmode"`
+		Devicememoryscaling float64           `json:"devicememoryscaling"`
+		Devicecorescaling   float64           `json:"devicecorescaling"`
+		Devicesplitcount    uint              `json:"devicesplitcount"`
+		Migstrategy         string            `json:"migstrategy"`
+		FilterDevice        *FilterDevice     `json:"filterdevices"`
+		SystemReserved      *SystemReserved   `json:"systemreserved"`
+		CoreReservation     *CoreReservation  `json:"corereservation"`
+		HealthConditions    *HealthConditions `json:"healthconditions"`
 	} `json:"nodeconfig"`
 }
 
@@ -140,13 +210,24 @@ type NvidiaGPUDevices struct {
 func InitNvidiaDevice(nvconfig NvidiaConfig) *NvidiaGPUDevices {
 	klog.InfoS("initializing nvidia device", "resourceName", nvconfig.ResourceCountName, "resourceMem", nvconfig.ResourceMemoryName, "DefaultGPUNum", nvconfig.DefaultGPUNum)
 	util.InRequestDevices[NvidiaGPUDevice] = "hami.io/vgpu-devices-to-allocate"
-	util.SupportDevices[NvidiaGPUDevice] = "hami.io/vgpu-devices-allocated"
+	util.SupportDevices[NvidiaGPUDevice] = AllocatedDevicesAnnos
 	util.HandshakeAnnos[NvidiaGPUDevice] = HandshakeAnnos
+	util.MemoryUnits[NvidiaGPUDevice] = util.MiB
 	return &NvidiaGPUDevices{
 		config: nvconfig,
 	}
 }
 
+// ResourceNames returns the configured resource names for the GPU count, memory and memory percentage.
+func (dev *NvidiaGPUDevices) ResourceNames() (count, mem, memPercentage string) {
+	return dev.config.ResourceCountName, dev.config.ResourceMemoryName, dev.config.ResourceMemoryPercentageName
+}
+
+// CoreResourceName returns the name of the core percentage resource.
+func (dev *NvidiaGPUDevices) CoreResourceName() string {
+	return dev.config.ResourceCoreName
+}
+
 func (dev *NvidiaGPUDevices) CommonWord() string {
 	return NvidiaGPUCommonWord
 }
@@ -183,6 +264,52 @@ func FilterDeviceToRegister(uuid, indexStr string) bool {
 	return false
 }
 
+// SystemReservedIndexes returns which of the card indexes found on the node belong to the
+// system pool. Explicit indexes win over Count; Count takes the highest indexes so the same
+// cards stay reserved across restarts.
+func SystemReservedIndexes(indexes []uint) map[uint]struct{} {
+	reserved := make(map[uint]struct{})
+	if DevicePluginSystemReserved == nil {
+		return reserved
+	}
+	present := make(map[uint]struct{}, len(indexes))
+	for _, idx := range indexes {
+		present[idx] = struct{}{}
+	}
+	if len(DevicePluginSystemReserved.Index) > 0 {
+		for _, idx := range DevicePluginSystemReserved.Index {
+			if _, ok := present[idx]; ok {
+				reserved[idx] = struct{}{}
+			} else {
+				klog.Warningf("system reserved device index %d not found on node", idx)
+			}
+		}
+		return reserved
+	}
+	sorted := make([]uint, 0, len(present))
+	for idx := range present {
+		sorted = append(sorted, idx)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] > sorted[j] })
+	if int(DevicePluginSystemReserved.Count) > len(sorted) {
+		klog.Warningf("system reserved count %d exceeds the %d devices on node, reserving all of them", DevicePluginSystemReserved.Count, len(sorted))
+	}
+	for i := 0; i < len(sorted) && i < int(DevicePluginSystemReserved.Count); i++ {
+		reserved[sorted[i]] = struct{}{}
+	}
+	return reserved
+}
+
+// AdvertisedCores returns the cores of the card at idx to register, out of total, the cores of
+// the whole card after scaling, without the part held back by DevicePluginCoreReservation.
+func AdvertisedCores(total int32, idx uint) int32 {
+	r := DevicePluginCoreReservation
+	if r == nil || r.Cores <= 0 || (len(r.Index) > 0 && !slices.Contains(r.Index, idx)) {
+		return total
+	}
+	return max(total-total*min(r.Cores, 100)/100, 0)
+}
+
 func (dev *NvidiaGPUDevices) NodeCleanUp(nn string) error {
 	return util.MarkAnnotationsToDelete(HandshakeAnnos, nn)
 }
@@ -233,6 +360,16 @@ func (dev *NvidiaGPUDevices) GetNodeDevices(n corev1.Node) ([]*util.DeviceInfo,
 		klog.InfoS("no nvidia gpu device found", "node", n.Name, "device annotation", devEncoded)
 		return []*util.DeviceInfo{}, errors.New("no gpu found on node")
 	}
+	if attrs, ok := n.Annotations[DeviceAttributesAnnos]; ok {
+		if err := util.DecodeNodeDeviceAttributes(attrs, nodedevices); err != nil {
+			klog.ErrorS(err, "failed to decode node device attributes", "node", n.Name, "device attributes annotation", attrs)
+		}
+	}
+	if utils, ok := n.Annotations[DeviceUtilizationAnnos]; ok {
+		if err := util.DecodeNodeDeviceUtilization(utils, nodedevices); err != nil {
+			klog.ErrorS(err, "failed to decode node device utilization", "node", n.Name, "device utilization annotation", utils)
+		}
+	}
 	for _, val := range nodedevices {
 		if val.Mode == "mig" {
 			val.MIGTemplate = make([]util.Geometry, 0)
@@ -276,6 +413,7 @@ func (dev *NvidiaGPUDevices) MutateAdmission(ctr *corev1.Container, p *corev1.Po
 
 	_, resourceNameOK := ctr.Resources.Limits[corev1.ResourceName(dev.config.ResourceCountName)]
 	if resourceNameOK {
+		dev.setCoreLogLevel(ctr, p)
 		return resourceNameOK, nil
 	}
 
@@ -287,6 +425,7 @@ func (dev *NvidiaGPUDevices) MutateAdmission(ctr *corev1.Container, p *corev1.Po
 		if dev.config.DefaultGPUNum > 0 {
 			ctr.Resources.Limits[corev1.ResourceName(dev.config.ResourceCountName)] = *resource.NewQuantity(int64(dev.config.DefaultGPUNum), resource.BinarySI)
 			resourceNameOK = true
+			dev.setCoreLogLevel(ctr, p)
 		}
 	}
 
@@ -429,7 +568,7 @@ func (dev *NvidiaGPUDevices) GenerateResourceRequests(ctr *corev1.Container) uti
 			return util.ContainerDeviceRequest{
 				Nums:             int32(n),
 				Type:             NvidiaGPUDevice,
-				Memreq:           int32(memnum),
+				Memreq:           util.MemoryToBytes(NvidiaGPUDevice, int64(memnum)),
 				MemPercentagereq: int32(mempnum),
 				Coresreq:         int32(corenum),
 			}
@@ -438,6 +577,26 @@ func (dev *NvidiaGPUDevices) GenerateResourceRequests(ctr *corev1.Container) uti
 	return util.ContainerDeviceRequest{}
 }
 
+// migMemory converts the memory of a MIG template, configured in MiB, into bytes.
+func migMemory(m int32) int64 {
+	return util.MemoryToBytes(NvidiaGPUDevice, int64(m))
+}
+
+// idleMigTemplate returns the MIG template an idle card is partitioned with for a container
+// needing memreq bytes: the geometry the card is already partitioned with if it fits, so the
+// device plugin doesn't have to re-partition it, otherwise the first fitting one.
+func idleMigTemplate(device *util.DeviceUsage, memreq int64) (int, bool) {
+	if g := device.MigGeometry; g != nil && *g >= 0 && *g < len(device.MigTemplate) && migMemory(device.MigTemplate[*g][0].Memory) >= memreq {
+		return *g, true
+	}
+	for tidx, templates := range device.MigTemplate {
+		if migMemory(templates[0].Memory) >= memreq {
+			return tidx, true
+		}
+	}
+	return -1, false
+}
+
 func (dev *NvidiaGPUDevices) CustomFilterRule(allocated *util.PodDevices, request util.ContainerDeviceRequest, toAllocate util.ContainerDevices, device *util.DeviceUsage) bool {
 	//memreq := request.Memreq
 	deviceUsageSnapshot := device.MigUsage
@@ -447,24 +606,16 @@ func (dev *NvidiaGPUDevices) CustomFilterRule(allocated *util.PodDevices, reques
 	deviceUsageCurrent.UsageList = append(deviceUsageCurrent.UsageList, deviceUsageSnapshot.UsageList...)
 	if device.Mode == "mig" {
 		if len(deviceUsageCurrent.UsageList) == 0 {
-			tmpfound := false
-			for tidx, templates := range device.MigTemplate {
-				if templates[0].Memory < request.Memreq {
-					continue
-				} else {
-					util.PlatternMIG(&deviceUsageCurrent, device.MigTemplate, tidx)
-					tmpfound = true
-					break
-				}
-			}
-			if !tmpfound {
+			if tidx, ok := idleMigTemplate(device, request.Memreq); ok {
+				util.PlatternMIG(&deviceUsageCurrent, device.MigTemplate, tidx)
+			} else {
 				klog.Infoln("MIG entry no template fit", deviceUsageCurrent.UsageList, "request=", request)
 			}
 		}
 		for _, val := range toAllocate {
 			found := false
 			for idx := range deviceUsageCurrent.UsageList {
-				if !deviceUsageCurrent.UsageList[idx].InUse && deviceUsageCurrent.UsageList[idx].Memory > val.Usedmem {
+				if !deviceUsageCurrent.UsageList[idx].InUse && migMemory(deviceUsageCurrent.UsageList[idx].Memory) > val.Usedmem {
 					deviceUsageCurrent.UsageList[idx].InUse = true
 					found = true
 					break
@@ -476,7 +627,7 @@ func (dev *NvidiaGPUDevices) CustomFilterRule(allocated *util.PodDevices, reques
 			}
 		}
 		for idx := range deviceUsageCurrent.UsageList {
-			if !deviceUsageCurrent.UsageList[idx].InUse && deviceUsageCurrent.UsageList[idx].Memory > request.Memreq {
+			if !deviceUsageCurrent.UsageList[idx].InUse && migMemory(deviceUsageCurrent.UsageList[idx].Memory) > request.Memreq {
 				deviceUsageCurrent.UsageList[idx].InUse = true
 				klog.Infoln("MIG entry device usage true=", deviceUsageCurrent.UsageList, "request", request, "toAllocate", toAllocate)
 				return true
@@ -505,30 +656,53 @@ func (dev *NvidiaGPUDevices) migNeedsReset(n *util.DeviceUsage) bool {
 	return true
 }
 
+// addMigInstance marks the MIG instance ctr names on n in use, partitioning n with the
+// template of the instance if none of its instances is in use.
+func (dev *NvidiaGPUDevices) addMigInstance(n *util.DeviceUsage, ctr *util.ContainerDevice) error {
+	tidx, pos, err := util.ExtractMigTemplatesFromUUID(ctr.UUID)
+	if err != nil {
+		return err
+	}
+	if dev.migNeedsReset(n) {
+		if tidx < 0 || tidx >= len(n.MigTemplate) {
+			return fmt.Errorf("mig template %d not found for device %s", tidx, n.ID)
+		}
+		util.PlatternMIG(&n.MigUsage, n.MigTemplate, tidx)
+		n.MigUsage.Index = int32(tidx)
+	}
+	if int32(tidx) != n.MigUsage.Index || pos < 0 || pos >= len(n.MigUsage.UsageList) || n.MigUsage.UsageList[pos].InUse {
+		return fmt.Errorf("mig instance %s is not free", ctr.UUID)
+	}
+	n.MigUsage.UsageList[pos].InUse = true
+	ctr.Usedmem = migMemory(n.MigUsage.UsageList[pos].Memory)
+	return nil
+}
+
 func (dev *NvidiaGPUDevices) AddResourceUsage(n *util.DeviceUsage, ctr *util.ContainerDevice) error {
 	n.Used++
-	if n.Mode == "mig" {
+	if n.Mode == "mig" && strings.Contains(ctr.UUID, "[") {
+		// The instance was picked by the scheduler already, e.g. for a pod wanting
+		// several instances of one profile.
+		if err := dev.addMigInstance(n, ctr); err != nil {
+			return err
+		}
+	} else if n.Mode == "mig" {
 		if dev.migNeedsReset(n) {
-			for tidx, templates := range n.MigTemplate {
-				if templates[0].Memory < ctr.Usedmem {
-					continue
-				} else {
-					util.PlatternMIG(&n.MigUsage, n.MigTemplate, tidx)
-					ctr.Usedmem = n.MigUsage.UsageList[0].Memory
-					if !strings.Contains(ctr.UUID, "[") {
-						ctr.UUID = ctr.UUID + "[" + fmt.Sprint(tidx) + "-0]"
-					}
-					n.MigUsage.Index = int32(tidx)
-					n.MigUsage.UsageList[0].InUse = true
-					break
+			if tidx, ok := idleMigTemplate(n, ctr.Usedmem); ok {
+				util.PlatternMIG(&n.MigUsage, n.MigTemplate, tidx)
+				ctr.Usedmem = migMemory(n.MigUsage.UsageList[0].Memory)
+				if !strings.Contains(ctr.UUID, "[") {
+					ctr.UUID = ctr.UUID + "[" + fmt.Sprint(tidx) + "-0]"
 				}
+				n.MigUsage.Index = int32(tidx)
+				n.MigUsage.UsageList[0].InUse = true
 			}
 		} else {
 			found := false
 			for idx, val := range n.MigUsage.UsageList {
-				if !val.InUse && val.Memory > ctr.Usedmem {
+				if !val.InUse && migMemory(val.Memory) > ctr.Usedmem {
 					n.MigUsage.UsageList[idx].InUse = true
-					ctr.Usedmem = n.MigUsage.UsageList[idx].Memory
+					ctr.Usedmem = migMemory(n.MigUsage.UsageList[idx].Memory)
 					if !strings.Contains(ctr.UUID, "[") {
 						ctr.UUID = ctr.UUID + "[" + fmt.Sprint(n.MigUsage.Index) + "-" + fmt.Sprint(idx) + "]"
 					}
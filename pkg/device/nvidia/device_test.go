@@ -296,6 +296,53 @@ func Test_CheckType(t *testing.T) {
 	}
 }
 
+func Test_SystemReservedIndexes(t *testing.T) {
+	orig := DevicePluginSystemReserved
+	defer func() { DevicePluginSystemReserved = orig }()
+	tests := []struct {
+		name     string
+		reserved *SystemReserved
+		want     map[uint]struct{}
+	}{
+		{name: "not configured", reserved: nil, want: map[uint]struct{}{}},
+		{name: "by index", reserved: &SystemReserved{Index: []uint{1, 7}}, want: map[uint]struct{}{1: {}}},
+		{name: "any two", reserved: &SystemReserved{Count: 2}, want: map[uint]struct{}{2: {}, 3: {}}},
+		{name: "index wins over count", reserved: &SystemReserved{Index: []uint{0}, Count: 2}, want: map[uint]struct{}{0: {}}},
+		{name: "count larger than node", reserved: &SystemReserved{Count: 9}, want: map[uint]struct{}{0: {}, 1: {}, 2: {}, 3: {}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			DevicePluginSystemReserved = test.reserved
+			assert.DeepEqual(t, SystemReservedIndexes([]uint{0, 1, 2, 3, 3}), test.want)
+		})
+	}
+}
+
+func Test_AdvertisedCores(t *testing.T) {
+	orig := DevicePluginCoreReservation
+	defer func() { DevicePluginCoreReservation = orig }()
+	tests := []struct {
+		name        string
+		reservation *CoreReservation
+		total       int32
+		idx         uint
+		want        int32
+	}{
+		{name: "not configured", total: 100, want: 100},
+		{name: "every card", reservation: &CoreReservation{Cores: 20}, total: 100, idx: 3, want: 80},
+		{name: "scaled cores", reservation: &CoreReservation{Cores: 20}, total: 200, want: 160},
+		{name: "listed card", reservation: &CoreReservation{Cores: 30, Index: []uint{1}}, total: 100, idx: 1, want: 70},
+		{name: "other card", reservation: &CoreReservation{Cores: 30, Index: []uint{1}}, total: 100, idx: 0, want: 100},
+		{name: "whole card", reservation: &CoreReservation{Cores: 150}, total: 100, want: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			DevicePluginCoreReservation = test.reservation
+			assert.Equal(t, AdvertisedCores(test.total, test.idx), test.want)
+		})
+	}
+}
+
 func Test_FilterDeviceToRegister(t *testing.T) {
 	tests := []struct {
 		name string
@@ -496,7 +543,7 @@ func Test_PatchAnnotations(t *testing.T) {
 								Idx:       0,
 								UUID:      "nvidia-device-0",
 								Type:      "NVIDIA",
-								Usedmem:   2000,
+								Usedmem:   2000 * util.MiB,
 								Usedcores: 1,
 							},
 						},
@@ -614,3 +661,57 @@ func Test_GetNodeDevices(t *testing.T) {
 		})
 	}
 }
+
+func Test_idleMigTemplate(t *testing.T) {
+	geometry := func(i int) *int { return &i }
+	dev := &util.DeviceUsage{
+		Mode: "mig",
+		MigTemplate: []util.Geometry{
+			{{Name: "1g.10gb", Memory: 10240, Count: 7}},
+			{{Name: "3g.40gb", Memory: 40960, Count: 2}},
+			{{Name: "7g.80gb", Memory: 81920, Count: 1}},
+		},
+	}
+	tidx, ok := idleMigTemplate(dev, migMemory(5000))
+	assert.Equal(t, ok, true)
+	assert.Equal(t, tidx, 0)
+
+	// The geometry the card is already partitioned with wins if it fits.
+	dev.MigGeometry = geometry(1)
+	tidx, _ = idleMigTemplate(dev, migMemory(5000))
+	assert.Equal(t, tidx, 1)
+	tidx, _ = idleMigTemplate(dev, migMemory(50000))
+	assert.Equal(t, tidx, 2)
+
+	dev.MigGeometry = geometry(5)
+	tidx, _ = idleMigTemplate(dev, migMemory(5000))
+	assert.Equal(t, tidx, 0)
+
+	_, ok = idleMigTemplate(dev, migMemory(100000))
+	assert.Equal(t, ok, false)
+}
+
+func Test_addMigInstance(t *testing.T) {
+	dev := &NvidiaGPUDevices{}
+	card := &util.DeviceUsage{
+		ID:   "GPU-0",
+		Mode: "mig",
+		MigTemplate: []util.Geometry{
+			{{Name: "1g.10gb", Memory: 10240, Count: 7}},
+			{{Name: "3g.40gb", Memory: 40960, Count: 2}},
+		},
+	}
+	// The instances picked by the scheduler are taken as they are.
+	for _, uuid := range []string{"GPU-0[1-1]", "GPU-0[1-0]"} {
+		ctr := &util.ContainerDevice{UUID: uuid}
+		assert.NilError(t, dev.AddResourceUsage(card, ctr))
+		assert.Equal(t, ctr.UUID, uuid)
+		assert.Equal(t, ctr.Usedmem, migMemory(40960))
+	}
+	assert.Equal(t, card.MigUsage.Index, int32(1))
+	assert.Equal(t, card.Used, int32(2))
+	assert.Equal(t, card.Usedmem, 2*migMemory(40960))
+
+	assert.ErrorContains(t, dev.AddResourceUsage(card, &util.ContainerDevice{UUID: "GPU-0[1-0]"}), "not free")
+	assert.ErrorContains(t, dev.AddResourceUsage(card, &util.ContainerDevice{UUID: "GPU-0[0-3]"}), "not free")
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nvidia
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// MaxCoreLogLevel is the most verbose HAMi-core log level, which logs every intercepted call.
+// 0 logs errors only.
+const MaxCoreLogLevel = 4
+
+// ValidateCoreLogLevel rejects a HAMi-core log level other than 0 to MaxCoreLogLevel. Empty
+// leaves the level of HAMi-core alone.
+func ValidateCoreLogLevel(level string) error {
+	if level == "" {
+		return nil
+	}
+	if n, err := strconv.Atoi(level); err == nil && n >= 0 && n <= MaxCoreLogLevel {
+		return nil
+	}
+	return fmt.Errorf("unknown HAMi-core log level %q, 0 to %d are allowed", level, MaxCoreLogLevel)
+}
+
+// ParseCoreLogLevels parses a hami.io/core-log-level annotation: either a level for every GPU
+// container, returned for the empty container name, or levels by container name, e.g.
+// "trainer=4,loader=3".
+func ParseCoreLogLevels(value string) (map[string]string, error) {
+	value = strings.TrimSpace(value)
+	if !strings.Contains(value, "=") {
+		if value == "" {
+			return nil, fmt.Errorf("empty HAMi-core log level")
+		}
+		return map[string]string{"": value}, ValidateCoreLogLevel(value)
+	}
+	res := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		name, level, ok := strings.Cut(entry, "=")
+		name, level = strings.TrimSpace(name), strings.TrimSpace(level)
+		if !ok || name == "" || level == "" {
+			return nil, fmt.Errorf("invalid entry %q, container=level expected", entry)
+		}
+		if _, dup := res[name]; dup {
+			return nil, fmt.Errorf("container %s is listed twice", name)
+		}
+		if err := ValidateCoreLogLevel(level); err != nil {
+			return nil, fmt.Errorf("container %s: %v", name, err)
+		}
+		res[name] = level
+	}
+	return res, nil
+}
+
+// coreLogLevel returns the HAMi-core log level of the GPU container ctr of pod p: the one of the
+// hami.io/core-log-level annotation, else configured, the level of the device config. The
+// annotation was validated by the webhook already, an invalid one is ignored here.
+func coreLogLevel(ctr *corev1.Container, p *corev1.Pod, configured string) string {
+	if v, ok := p.Annotations[util.CoreLogLevel]; ok {
+		if levels, err := ParseCoreLogLevels(v); err == nil {
+			if level, ok := levels[""]; ok {
+				return level
+			}
+			if level, ok := levels[ctr.Name]; ok {
+				return level
+			}
+		}
+	}
+	return configured
+}
+
+// setCoreLogLevel sets the HAMi-core log level of the GPU container ctr of pod p, unless the
+// container sets util.CoreLogLevelEnv itself.
+func (dev *NvidiaGPUDevices) setCoreLogLevel(ctr *corev1.Container, p *corev1.Pod) {
+	level := coreLogLevel(ctr, p, dev.config.CoreLogLevel)
+	if level == "" {
+		return
+	}
+	for _, env := range ctr.Env {
+		if env.Name == util.CoreLogLevelEnv {
+			return
+		}
+	}
+	ctr.Env = append(ctr.Env, corev1.EnvVar{Name: util.CoreLogLevelEnv, Value: level})
+}
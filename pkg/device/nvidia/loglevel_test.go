@@ -0,0 +1,108 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nvidia
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func Test_ParseCoreLogLevels(t *testing.T) {
+	levels, err := ParseCoreLogLevels("4")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, levels, map[string]string{"": "4"})
+	levels, err = ParseCoreLogLevels("trainer=4, loader=0")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, levels, map[string]string{"trainer": "4", "loader": "0"})
+
+	_, err = ParseCoreLogLevels("5")
+	assert.ErrorContains(t, err, "0 to 4 are allowed")
+	_, err = ParseCoreLogLevels("debug")
+	assert.ErrorContains(t, err, "unknown HAMi-core log level")
+	_, err = ParseCoreLogLevels("")
+	assert.ErrorContains(t, err, "empty")
+	_, err = ParseCoreLogLevels("trainer=4,3")
+	assert.ErrorContains(t, err, "container=level expected")
+	_, err = ParseCoreLogLevels("trainer=4,trainer=3")
+	assert.ErrorContains(t, err, "listed twice")
+	_, err = ParseCoreLogLevels("trainer=-1")
+	assert.ErrorContains(t, err, "container trainer")
+}
+
+func Test_MutateAdmissionCoreLogLevel(t *testing.T) {
+	gpuDevices := &NvidiaGPUDevices{config: NvidiaConfig{
+		ResourceCountName: "nvidia.com/gpu",
+		ResourceCoreName:  "nvidia.com/gpucores",
+		DefaultGPUNum:     1,
+		CoreLogLevel:      "1",
+	}}
+	ctr := func(name string, resourceName string, env ...corev1.EnvVar) *corev1.Container {
+		return &corev1.Container{Name: name, Env: env, Resources: corev1.ResourceRequirements{Limits: corev1.ResourceList{
+			corev1.ResourceName(resourceName): *resource.NewQuantity(1, resource.BinarySI),
+		}}}
+	}
+	pod := func(level string) *corev1.Pod {
+		if level == "" {
+			return &corev1.Pod{}
+		}
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{util.CoreLogLevel: level}}}
+	}
+	levelEnv := func(c *corev1.Container) string {
+		for _, env := range c.Env {
+			if env.Name == util.CoreLogLevelEnv {
+				return env.Value
+			}
+		}
+		return ""
+	}
+	tests := []struct {
+		name string
+		ctr  *corev1.Container
+		pod  *corev1.Pod
+		want string
+	}{
+		{name: "device config", ctr: ctr("trainer", "nvidia.com/gpu"), pod: pod(""), want: "1"},
+		{name: "whole pod", ctr: ctr("trainer", "nvidia.com/gpu"), pod: pod("4"), want: "4"},
+		{name: "named container", ctr: ctr("trainer", "nvidia.com/gpu"), pod: pod("trainer=4,loader=3"), want: "4"},
+		{name: "other containers keep the device config", ctr: ctr("serve", "nvidia.com/gpu"), pod: pod("trainer=4"), want: "1"},
+		{name: "defaulted GPU count", ctr: ctr("trainer", "nvidia.com/gpucores"), pod: pod("4"), want: "4"},
+		{name: "containers without GPUs are left alone", ctr: ctr("sidecar", "cpu"), pod: pod("4"), want: ""},
+		{
+			name: "the env of the container wins",
+			ctr:  ctr("trainer", "nvidia.com/gpu", corev1.EnvVar{Name: util.CoreLogLevelEnv, Value: "2"}),
+			pod:  pod("4"),
+			want: "2",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			envs := len(test.ctr.Env)
+			_, err := gpuDevices.MutateAdmission(test.ctr, test.pod)
+			assert.NilError(t, err)
+			assert.Equal(t, levelEnv(test.ctr), test.want)
+			if test.want == "" || envs > 0 {
+				assert.Equal(t, len(test.ctr.Env), envs)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nvidia
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// CardMemoryType is the memory technology of a card model, see util.GPUMemoryType.
+type CardMemoryType struct {
+	// Model is matched as a whole word against the card type, e.g. "A100".
+	Model      string `yaml:"model"`
+	MemoryType string `yaml:"memoryType"`
+}
+
+// builtinCardMemoryTypes are the memory types of the card models known to HAMi. Models are
+// matched as whole words, so "A10" doesn't match an "A100" nor "L40" an "L40S".
+var builtinCardMemoryTypes = []CardMemoryType{
+	{Model: "P100", MemoryType: util.GPUMemoryTypeHBM},
+	{Model: "V100", MemoryType: util.GPUMemoryTypeHBM},
+	{Model: "V100S", MemoryType: util.GPUMemoryTypeHBM},
+	{Model: "GV100", MemoryType: util.GPUMemoryTypeHBM},
+	{Model: "TITAN V", MemoryType: util.GPUMemoryTypeHBM},
+	{Model: "A30", MemoryType: util.GPUMemoryTypeHBM},
+	{Model: "A100", MemoryType: util.GPUMemoryTypeHBM},
+	{Model: "A800", MemoryType: util.GPUMemoryTypeHBM},
+	{Model: "H20", MemoryType: util.GPUMemoryTypeHBM},
+	{Model: "H100", MemoryType: util.GPUMemoryTypeHBM},
+	{Model: "H200", MemoryType: util.GPUMemoryTypeHBM},
+	{Model: "H800", MemoryType: util.GPUMemoryTypeHBM},
+	{Model: "GH200", MemoryType: util.GPUMemoryTypeHBM},
+	{Model: "B100", MemoryType: util.GPUMemoryTypeHBM},
+	{Model: "B200", MemoryType: util.GPUMemoryTypeHBM},
+	{Model: "GB200", MemoryType: util.GPUMemoryTypeHBM},
+	{Model: "P4", MemoryType: util.GPUMemoryTypeGDDR},
+	{Model: "P40", MemoryType: util.GPUMemoryTypeGDDR},
+	{Model: "M60", MemoryType: util.GPUMemoryTypeGDDR},
+	{Model: "T4", MemoryType: util.GPUMemoryTypeGDDR},
+	{Model: "A2", MemoryType: util.GPUMemoryTypeGDDR},
+	{Model: "A10", MemoryType: util.GPUMemoryTypeGDDR},
+	{Model: "A10G", MemoryType: util.GPUMemoryTypeGDDR},
+	{Model: "A16", MemoryType: util.GPUMemoryTypeGDDR},
+	{Model: "A40", MemoryType: util.GPUMemoryTypeGDDR},
+	{Model: "L4", MemoryType: util.GPUMemoryTypeGDDR},
+	{Model: "L20", MemoryType: util.GPUMemoryTypeGDDR},
+	{Model: "L40", MemoryType: util.GPUMemoryTypeGDDR},
+	{Model: "L40S", MemoryType: util.GPUMemoryTypeGDDR},
+	{Model: "RTX", MemoryType: util.GPUMemoryTypeGDDR},
+}
+
+// ValidateCardMemoryTypes rejects entries which couldn't be matched or carry an unknown memory type.
+func ValidateCardMemoryTypes(entries []CardMemoryType) error {
+	models := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if strings.TrimSpace(e.Model) == "" || strings.Contains(e.Model, ",") {
+			return fmt.Errorf("invalid card model %q in cardMemoryTypes", e.Model)
+		}
+		model := strings.ToUpper(e.Model)
+		if slices.Contains(models, model) {
+			return fmt.Errorf("card model %s is listed twice in cardMemoryTypes", e.Model)
+		}
+		models = append(models, model)
+		if e.MemoryType != util.GPUMemoryTypeHBM && e.MemoryType != util.GPUMemoryTypeGDDR {
+			return fmt.Errorf("card model %s: memoryType must be %q or %q, got %q", e.Model, util.GPUMemoryTypeHBM, util.GPUMemoryTypeGDDR, e.MemoryType)
+		}
+	}
+	return nil
+}
+
+// containsWord reports whether word occurs in s delimited by anything but letters and digits.
+func containsWord(s, word string) bool {
+	isAlnum := func(c byte) bool {
+		return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9'
+	}
+	for i := 0; i+len(word) <= len(s); {
+		j := strings.Index(s[i:], word)
+		if j < 0 {
+			return false
+		}
+		start, end := i+j, i+j+len(word)
+		if (start == 0 || !isAlnum(s[start-1])) && (end == len(s) || !isAlnum(s[end])) {
+			return true
+		}
+		i = start + 1
+	}
+	return false
+}
+
+// MemoryTypeOf returns the memory type of a card of cardType, e.g. "NVIDIA A100-SXM4-80GB".
+// The longest model of entries found in cardType wins, then the one of the built-in table.
+// It returns "" for an unknown model.
+func MemoryTypeOf(cardType string, entries []CardMemoryType) string {
+	cardType = strings.ToUpper(cardType)
+	for _, table := range [][]CardMemoryType{entries, builtinCardMemoryTypes} {
+		best := CardMemoryType{}
+		for _, e := range table {
+			if len(e.Model) > len(best.Model) && containsWord(cardType, strings.ToUpper(e.Model)) {
+				best = e
+			}
+		}
+		if best.Model != "" {
+			return best.MemoryType
+		}
+	}
+	return ""
+}
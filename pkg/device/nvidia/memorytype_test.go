@@ -0,0 +1,59 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nvidia
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func Test_ValidateCardMemoryTypes(t *testing.T) {
+	assert.NilError(t, ValidateCardMemoryTypes([]CardMemoryType{{Model: "MI300", MemoryType: util.GPUMemoryTypeHBM}, {Model: "RTX 5090", MemoryType: util.GPUMemoryTypeGDDR}}))
+	assert.ErrorContains(t, ValidateCardMemoryTypes([]CardMemoryType{{Model: " ", MemoryType: util.GPUMemoryTypeHBM}}), "invalid card model")
+	assert.ErrorContains(t, ValidateCardMemoryTypes([]CardMemoryType{{Model: "X1", MemoryType: util.GPUMemoryTypeHBM}, {Model: "x1", MemoryType: util.GPUMemoryTypeGDDR}}), "listed twice")
+	assert.ErrorContains(t, ValidateCardMemoryTypes([]CardMemoryType{{Model: "X1", MemoryType: "lpddr"}}), `memoryType must be "hbm" or "gddr"`)
+}
+
+func Test_MemoryTypeOf(t *testing.T) {
+	for cardType, want := range map[string]string{
+		"NVIDIA A100-SXM4-80GB":    util.GPUMemoryTypeHBM,
+		"NVIDIA-NVIDIA A10":        util.GPUMemoryTypeGDDR,
+		"NVIDIA A10G":              util.GPUMemoryTypeGDDR,
+		"NVIDIA H100 80GB HBM3":    util.GPUMemoryTypeHBM,
+		"Tesla V100-SXM2-32GB":     util.GPUMemoryTypeHBM,
+		"Tesla T4":                 util.GPUMemoryTypeGDDR,
+		"NVIDIA L40S":              util.GPUMemoryTypeGDDR,
+		"NVIDIA GeForce RTX 4090":  util.GPUMemoryTypeGDDR,
+		"NVIDIA RTX A3000":         util.GPUMemoryTypeGDDR,
+		"NVIDIA TITAN V":           util.GPUMemoryTypeHBM,
+		"NVIDIA GH200 480GB":       util.GPUMemoryTypeHBM,
+		"NVIDIA Jetson AGX Orin":   "",
+		"NVIDIA GeForce GTX 1080":  "",
+		"NVIDIA A1000-Not-A-Model": "",
+	} {
+		assert.Equal(t, MemoryTypeOf(cardType, nil), want, cardType)
+	}
+
+	// The entries of the config win over the built-in table, and add unknown models.
+	entries := []CardMemoryType{{Model: "GTX 1080", MemoryType: util.GPUMemoryTypeGDDR}, {Model: "T4", MemoryType: util.GPUMemoryTypeHBM}}
+	assert.Equal(t, MemoryTypeOf("NVIDIA GeForce GTX 1080", entries), util.GPUMemoryTypeGDDR)
+	assert.Equal(t, MemoryTypeOf("Tesla T4", entries), util.GPUMemoryTypeHBM)
+	assert.Equal(t, MemoryTypeOf("NVIDIA A100-PCIE-40GB", entries), util.GPUMemoryTypeHBM)
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nvidia
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+// CardTFLOPS is the peak throughput of a card model, used to turn a hami.io/tflops request into cores.
+type CardTFLOPS struct {
+	// Model is matched against the card type like nvidia.com/use-gputype, e.g. "A100".
+	Model  string  `yaml:"model"`
+	TFLOPS float64 `yaml:"tflops"`
+}
+
+// ValidateCardTFLOPS rejects entries which couldn't be matched or divided by.
+func ValidateCardTFLOPS(entries []CardTFLOPS) error {
+	models := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if strings.TrimSpace(e.Model) == "" || strings.Contains(e.Model, ",") {
+			return fmt.Errorf("invalid card model %q in cardTFLOPS", e.Model)
+		}
+		model := strings.ToUpper(e.Model)
+		if slices.Contains(models, model) {
+			return fmt.Errorf("card model %s is listed twice in cardTFLOPS", e.Model)
+		}
+		models = append(models, model)
+		if e.TFLOPS <= 0 || math.IsInf(e.TFLOPS, 0) || math.IsNaN(e.TFLOPS) {
+			return fmt.Errorf("card model %s: tflops must be positive", e.Model)
+		}
+	}
+	return nil
+}
+
+// CardTFLOPS returns the throughput of the longest model contained in cardType,
+// so "A100-80GB" can be told apart from "A100".
+func (dev *NvidiaGPUDevices) CardTFLOPS(cardType string) (CardTFLOPS, bool) {
+	cardType = strings.ToUpper(cardType)
+	best, found := CardTFLOPS{}, false
+	for _, e := range dev.config.CardTFLOPS {
+		if strings.Contains(cardType, strings.ToUpper(e.Model)) && len(e.Model) > len(best.Model) {
+			best, found = e, true
+		}
+	}
+	return best, found
+}
+
+// TFLOPSCores returns the percentage of the cores of a card of cardType delivering target TFLOPS,
+// rounded with the coreRounding of the config. It returns false if the model is unknown, the
+// card is too slow, or the percentage isn't whole under CoreRoundingExact.
+func (dev *NvidiaGPUDevices) TFLOPSCores(cardType string, target float64) (int32, bool) {
+	e, ok := dev.CardTFLOPS(cardType)
+	if !ok {
+		return 0, false
+	}
+	cores, ok := RoundCores(target*100/e.TFLOPS, dev.config.CoreRounding)
+	if !ok || cores > 100 {
+		return 0, false
+	}
+	return max(cores, 1), true
+}
+
+// TFLOPSModels returns the models in the table which pass the card type annotations of annos
+// and deliver target TFLOPS.
+func (dev *NvidiaGPUDevices) TFLOPSModels(annos map[string]string, target float64) []string {
+	models := make([]string, 0)
+	for _, e := range dev.config.CardTFLOPS {
+		if e.TFLOPS >= target && checkGPUtype(annos, e.Model) {
+			models = append(models, e.Model)
+		}
+	}
+	return models
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nvidia
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func Test_ValidateCardTFLOPS(t *testing.T) {
+	assert.NilError(t, ValidateCardTFLOPS([]CardTFLOPS{{Model: "A100", TFLOPS: 312}, {Model: "T4", TFLOPS: 65}}))
+	assert.ErrorContains(t, ValidateCardTFLOPS([]CardTFLOPS{{Model: "", TFLOPS: 312}}), "invalid card model")
+	assert.ErrorContains(t, ValidateCardTFLOPS([]CardTFLOPS{{Model: "A100", TFLOPS: 312}, {Model: "a100", TFLOPS: 156}}), "listed twice")
+	assert.ErrorContains(t, ValidateCardTFLOPS([]CardTFLOPS{{Model: "A100"}}), "tflops must be positive")
+}
+
+func Test_TFLOPSCores(t *testing.T) {
+	dev := InitNvidiaDevice(NvidiaConfig{CardTFLOPS: []CardTFLOPS{
+		{Model: "A100", TFLOPS: 312},
+		{Model: "A100-80GB", TFLOPS: 400},
+		{Model: "T4", TFLOPS: 65},
+	}})
+	e, ok := dev.CardTFLOPS("NVIDIA-A100-80GB-PCIe")
+	assert.Assert(t, ok)
+	assert.Equal(t, e.TFLOPS, float64(400))
+
+	cores, ok := dev.TFLOPSCores("NVIDIA-A100-SXM4-40GB", 20)
+	assert.Assert(t, ok)
+	assert.Equal(t, cores, int32(7))
+	cores, ok = dev.TFLOPSCores("NVIDIA-Tesla T4", 65)
+	assert.Assert(t, ok)
+	assert.Equal(t, cores, int32(100))
+	_, ok = dev.TFLOPSCores("NVIDIA-Tesla T4", 100)
+	assert.Assert(t, !ok)
+	_, ok = dev.TFLOPSCores("NVIDIA-H100", 20)
+	assert.Assert(t, !ok)
+
+	assert.DeepEqual(t, dev.TFLOPSModels(map[string]string{}, 100), []string{"A100", "A100-80GB"})
+	assert.DeepEqual(t, dev.TFLOPSModels(map[string]string{GPUNoUse: "A100"}, 100), []string{})
+}
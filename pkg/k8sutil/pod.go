@@ -17,10 +17,16 @@ limitations under the License.
 package k8sutil
 
 import (
+	"encoding/json"
+	"slices"
+	"strconv"
+	"strings"
+
 	"github.com/Project-HAMi/HAMi/pkg/device"
 	"github.com/Project-HAMi/HAMi/pkg/util"
 
 	corev1 "k8s.io/api/core/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/klog/v2"
 )
 
@@ -62,3 +68,62 @@ func IsPodInTerminatedState(pod *corev1.Pod) bool {
 func AllContainersCreated(pod *corev1.Pod) bool {
 	return len(pod.Status.ContainerStatuses) >= len(pod.Spec.Containers)
 }
+
+// SoftMemoryLimit returns the memory per card, in bytes, the scheduler asked a pod of the
+// soft GPU tier to shrink to, and false if it didn't.
+func SoftMemoryLimit(pod *corev1.Pod) (int64, bool) {
+	value, ok := pod.Annotations[util.SoftMemoryLimit]
+	if !ok {
+		return 0, false
+	}
+	mib, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || mib < 0 {
+		klog.Warningf("pod %s/%s has an invalid %s annotation %q, ignoring it", pod.Namespace, pod.Name, util.SoftMemoryLimit, value)
+		return 0, false
+	}
+	return mib * util.MiB, true
+}
+
+// NodeIdleMemoryLimits returns the memory per card, in bytes, the vGPU monitor of node lowered
+// the limits of its idle pods to, by pod UID. Only the monitor writes it, unlike the
+// hami.io/gpu-idle-memory-limit annotation of the pods, which only shows it.
+func NodeIdleMemoryLimits(node *corev1.Node) map[k8stypes.UID]int64 {
+	value, ok := node.Annotations[util.GPUIdleMemoryLimits]
+	if !ok {
+		return nil
+	}
+	var mibs map[k8stypes.UID]int64
+	if err := json.Unmarshal([]byte(value), &mibs); err != nil {
+		klog.Warningf("node %s has an invalid %s annotation %q, ignoring it", node.Name, util.GPUIdleMemoryLimits, value)
+		return nil
+	}
+	limits := make(map[k8stypes.UID]int64, len(mibs))
+	for uid, mib := range mibs {
+		if mib > 0 {
+			limits[uid] = mib * util.MiB
+		}
+	}
+	return limits
+}
+
+// GPUReclaimPriority returns the GPU reclaim priority of pod: the hami.io/gpu-reclaim-priority
+// annotation, or the pod priority without it. The annotation only raises the priority above
+// the one of the PriorityClass of the pod in the trusted namespaces, anywhere else it can
+// only lower it.
+func GPUReclaimPriority(pod *corev1.Pod, trusted []string) int32 {
+	var priority int32
+	if pod.Spec.Priority != nil {
+		priority = *pod.Spec.Priority
+	}
+	if value, ok := pod.Annotations[util.GPUReclaimPriority]; ok {
+		p, err := strconv.ParseInt(strings.TrimSpace(value), 10, 32)
+		if err != nil {
+			klog.Warningf("pod %s/%s has an invalid %s annotation %q, using the pod priority", pod.Namespace, pod.Name, util.GPUReclaimPriority, value)
+			return priority
+		}
+		if int32(p) <= priority || slices.Contains(trusted, pod.Namespace) {
+			return int32(p)
+		}
+	}
+	return priority
+}
@@ -26,6 +26,7 @@ import (
 	"gotest.tools/v3/assert"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/klog/v2"
 )
 
@@ -90,7 +91,7 @@ func Test_Resourcereqs(t *testing.T) {
 					nvidia.NvidiaGPUDevice: util.ContainerDeviceRequest{
 						Nums:             1,
 						Type:             nvidia.NvidiaGPUDevice,
-						Memreq:           1000,
+						Memreq:           1000 * util.MiB,
 						MemPercentagereq: 101,
 						Coresreq:         30,
 					},
@@ -126,7 +127,7 @@ func Test_Resourcereqs(t *testing.T) {
 					nvidia.NvidiaGPUDevice: util.ContainerDeviceRequest{
 						Nums:             1,
 						Type:             nvidia.NvidiaGPUDevice,
-						Memreq:           1000,
+						Memreq:           1000 * util.MiB,
 						MemPercentagereq: 101,
 						Coresreq:         30,
 					},
@@ -170,7 +171,7 @@ func Test_Resourcereqs(t *testing.T) {
 					nvidia.NvidiaGPUDevice: util.ContainerDeviceRequest{
 						Nums:             1,
 						Type:             nvidia.NvidiaGPUDevice,
-						Memreq:           1000,
+						Memreq:           1000 * util.MiB,
 						MemPercentagereq: 101,
 						Coresreq:         30,
 					},
@@ -216,7 +217,7 @@ func Test_Resourcereqs(t *testing.T) {
 					nvidia.NvidiaGPUDevice: util.ContainerDeviceRequest{
 						Nums:             1,
 						Type:             nvidia.NvidiaGPUDevice,
-						Memreq:           1000,
+						Memreq:           1000 * util.MiB,
 						MemPercentagereq: 101,
 						Coresreq:         30,
 					},
@@ -262,7 +263,7 @@ func Test_Resourcereqs(t *testing.T) {
 					nvidia.NvidiaGPUDevice: util.ContainerDeviceRequest{
 						Nums:             1,
 						Type:             nvidia.NvidiaGPUDevice,
-						Memreq:           1000,
+						Memreq:           1000 * util.MiB,
 						MemPercentagereq: 101,
 						Coresreq:         30,
 					},
@@ -419,3 +420,42 @@ func Test_AllContainersCreated(t *testing.T) {
 		})
 	}
 }
+
+func Test_SoftMemoryLimit(t *testing.T) {
+	_, ok := SoftMemoryLimit(&corev1.Pod{})
+	assert.Equal(t, ok, false)
+	pod := &corev1.Pod{}
+	pod.Annotations = map[string]string{util.SoftMemoryLimit: "2048"}
+	limit, ok := SoftMemoryLimit(pod)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, limit, 2048*util.MiB)
+	pod.Annotations[util.SoftMemoryLimit] = "-1"
+	_, ok = SoftMemoryLimit(pod)
+	assert.Equal(t, ok, false)
+}
+
+func Test_NodeIdleMemoryLimits(t *testing.T) {
+	assert.Equal(t, len(NodeIdleMemoryLimits(&corev1.Node{})), 0)
+	node := &corev1.Node{}
+	node.Annotations = map[string]string{util.GPUIdleMemoryLimits: `{"uid-1":512,"uid-2":0}`}
+	limits := NodeIdleMemoryLimits(node)
+	assert.Equal(t, len(limits), 1)
+	assert.Equal(t, limits["uid-1"], 512*util.MiB)
+	node.Annotations[util.GPUIdleMemoryLimits] = "half"
+	assert.Equal(t, len(NodeIdleMemoryLimits(node)), 0)
+}
+
+func Test_GPUReclaimPriority(t *testing.T) {
+	priority := int32(1000)
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "batch"}, Spec: corev1.PodSpec{Priority: &priority}}
+	assert.Equal(t, GPUReclaimPriority(pod, nil), int32(1000))
+	pod.Annotations = map[string]string{util.GPUReclaimPriority: "-5"}
+	assert.Equal(t, GPUReclaimPriority(pod, nil), int32(-5))
+	pod.Annotations[util.GPUReclaimPriority] = "high"
+	assert.Equal(t, GPUReclaimPriority(pod, nil), int32(1000))
+	assert.Equal(t, GPUReclaimPriority(&corev1.Pod{}, nil), int32(0))
+	// Only pods of the trusted namespaces raise their priority.
+	pod.Annotations[util.GPUReclaimPriority] = "5000"
+	assert.Equal(t, GPUReclaimPriority(pod, nil), int32(1000))
+	assert.Equal(t, GPUReclaimPriority(pod, []string{"batch"}), int32(5000))
+}
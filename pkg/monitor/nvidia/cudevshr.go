@@ -28,6 +28,8 @@ import (
 	"time"
 	"unsafe"
 
+	"github.com/Project-HAMi/HAMi/pkg/audit"
+	"github.com/Project-HAMi/HAMi/pkg/k8sutil"
 	v0 "github.com/Project-HAMi/HAMi/pkg/monitor/nvidia/v0"
 	v1 "github.com/Project-HAMi/HAMi/pkg/monitor/nvidia/v1"
 	"github.com/Project-HAMi/HAMi/pkg/util"
@@ -56,12 +58,14 @@ type UsageInfo interface {
 	DeviceMemoryOffset(idx int) uint64
 	DeviceMemoryTotal(idx int) uint64
 	DeviceSmUtil(idx int) uint64
+	DeviceSmLimit(idx int) uint64
 	SetDeviceSmLimit(l uint64)
 	IsValidUUID(idx int) bool
 	DeviceUUID(idx int) string
 	DeviceMemoryLimit(idx int) uint64
 	SetDeviceMemoryLimit(l uint64)
 	LastKernelTime() int64
+	HostPids() []int32
 	//UsedMemory(idx int) (uint64, error)
 	GetPriority() int
 	GetRecentKernel() int32
@@ -75,6 +79,12 @@ type ContainerUsage struct {
 	ContainerName string
 	data          []byte
 	Info          UsageInfo
+	// SoftMemoryLimit is the memory per card, in bytes, the scheduler asked the pod of the
+	// soft GPU tier to shrink to, 0 if it didn't.
+	SoftMemoryLimit uint64
+	// IdleMemoryLimit is the memory per card, in bytes, the vGPU monitor lowered the limit of
+	// the idle pod to, 0 if it didn't.
+	IdleMemoryLimit uint64
 }
 
 type ContainerLister struct {
@@ -82,6 +92,9 @@ type ContainerLister struct {
 	containers    map[string]*ContainerUsage
 	mutex         sync.Mutex
 	clientset     *kubernetes.Clientset
+	// auditor records the pods releasing their devices, found by releases. Nil disables it.
+	auditor  *audit.Recorder
+	releases *ReleaseTracker
 }
 
 func NewContainerLister() (*ContainerLister, error) {
@@ -106,6 +119,14 @@ func NewContainerLister() (*ContainerLister, error) {
 	}, nil
 }
 
+// SetAuditor has the pods of the node which release their devices recorded by auditor.
+func (l *ContainerLister) SetAuditor(auditor *audit.Recorder) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.auditor = auditor
+	l.releases = NewReleaseTracker()
+}
+
 func (l *ContainerLister) Lock() {
 	l.mutex.Lock()
 }
@@ -122,6 +143,12 @@ func (l *ContainerLister) Clientset() *kubernetes.Clientset {
 	return l.clientset
 }
 
+// ContainerPath returns the directory holding the HAMi-core directories of the containers,
+// named <pod uid>_<container name>.
+func (l *ContainerLister) ContainerPath() string {
+	return l.containerPath
+}
+
 func (l *ContainerLister) Update() error {
 	nodename := os.Getenv(util.NodeNameEnvName)
 	if nodename == "" {
@@ -133,9 +160,19 @@ func (l *ContainerLister) Update() error {
 	if err != nil {
 		return err
 	}
+	node, err := l.clientset.CoreV1().Nodes().Get(context.Background(), nodename, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	idleLimits := k8sutil.NodeIdleMemoryLimits(node)
 
 	l.mutex.Lock()
 	defer l.mutex.Unlock()
+	if l.auditor != nil {
+		for _, ev := range l.releases.Update(nodename, pods.Items) {
+			l.auditor.Record(ev)
+		}
+	}
 	entries, err := os.ReadDir(l.containerPath)
 	if err != nil {
 		return err
@@ -175,6 +212,23 @@ func (l *ContainerLister) Update() error {
 		l.containers[entry.Name()] = usage
 		klog.Infof("Adding ctr dirname %s in monitorpath", dirName)
 	}
+	for i := range pods.Items {
+		soft, softOK := k8sutil.SoftMemoryLimit(&pods.Items[i])
+		idle, idleOK := idleLimits[pods.Items[i].UID]
+		idleOK = idleOK && Reclaimable(&pods.Items[i])
+		for _, c := range l.containers {
+			if c.PodUID != string(pods.Items[i].UID) {
+				continue
+			}
+			if softOK {
+				c.SoftMemoryLimit = uint64(soft)
+			}
+			c.IdleMemoryLimit = 0
+			if idleOK {
+				c.IdleMemoryLimit = uint64(idle)
+			}
+		}
+	}
 	return nil
 }
 
@@ -0,0 +1,129 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nvidia
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	devicenvidia "github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// IdleMemoryReclaimer tells the pods with reclaimable memory whose GPUs were idle for a whole
+// window.
+type IdleMemoryReclaimer struct {
+	window time.Duration
+
+	mutex sync.Mutex
+	// lastActive is when each pod was last seen using its GPUs, or first seen at all.
+	lastActive map[string]time.Time
+}
+
+// NewIdleMemoryReclaimer returns a reclaimer over window, or nil if window is 0.
+func NewIdleMemoryReclaimer(window time.Duration) (*IdleMemoryReclaimer, error) {
+	if window == 0 {
+		return nil, nil
+	}
+	if window < 0 {
+		return nil, fmt.Errorf("idle memory reclaim window %s is negative", window)
+	}
+	return &IdleMemoryReclaimer{window: window, lastActive: make(map[string]time.Time)}, nil
+}
+
+// Window returns how long the GPUs of a pod have to be idle.
+func (r *IdleMemoryReclaimer) Window() time.Duration {
+	return r.window
+}
+
+// Observe records whether the pod podUID used its GPUs at now, and reports whether it didn't
+// for the whole window, counted from when it was first observed.
+func (r *IdleMemoryReclaimer) Observe(podUID string, active bool, now time.Time) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	last, ok := r.lastActive[podUID]
+	if !ok || active {
+		r.lastActive[podUID] = now
+		return false
+	}
+	return now.Sub(last) >= r.window
+}
+
+// Forget drops the pods keep doesn't report.
+func (r *IdleMemoryReclaimer) Forget(keep func(string) bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for uid := range r.lastActive {
+		if !keep(uid) {
+			delete(r.lastActive, uid)
+		}
+	}
+}
+
+// Reclaimable reports whether the memory of pod may be reclaimed while it is idle. Pods of the
+// soft GPU tier yield their memory anyway and aren't.
+func Reclaimable(pod *corev1.Pod) bool {
+	return pod.Annotations[util.GPUReclaimableMemory] == "true" && pod.Annotations[util.GPUTier] != util.SoftReservation
+}
+
+// IdleMemoryLimit returns the limit, in bytes, an idle container using used bytes on its
+// fullest device is lowered to: the memory it uses, rounded up to a MiB as the device plugin
+// rounds the limits it injects.
+func IdleMemoryLimit(used uint64) uint64 {
+	mib := uint64(util.MiB)
+	return (used + mib - 1) / mib * mib
+}
+
+// InjectedContainerMemoryLimit returns the memory limit, in bytes, the device plugin injected
+// for HAMi-core into container of pod, the largest one of its devices. ok is false for a
+// container without NVIDIA devices or with MIG instances.
+func InjectedContainerMemoryLimit(pod *corev1.Pod, container string) (limit uint64, ok bool) {
+	value, found := pod.Annotations[devicenvidia.AllocatedDevicesAnnos]
+	if !found {
+		return 0, false
+	}
+	value, err := util.ExpandDevicesAnnotation(value)
+	if err != nil {
+		return 0, false
+	}
+	entries := strings.Split(value, util.OnePodMultiContainerSplitSymbol)
+	for i, ctr := range pod.Spec.Containers {
+		if ctr.Name != container || i >= len(entries) {
+			continue
+		}
+		devices, err := util.DecodeContainerDevices(entries[i])
+		if err != nil {
+			return 0, false
+		}
+		for _, d := range devices {
+			if d.UUID == "" || strings.Contains(d.UUID, "[") {
+				return 0, false
+			}
+			l, err := util.ParseMemoryLimitEnv(util.MemoryLimitEnvValue(d.Usedmem))
+			if err != nil {
+				return 0, false
+			}
+			limit = max(limit, uint64(l))
+		}
+		return limit, limit > 0
+	}
+	return 0, false
+}
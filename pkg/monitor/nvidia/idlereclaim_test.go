@@ -0,0 +1,87 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nvidia
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	devicenvidia "github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func TestIdleMemoryReclaimer(t *testing.T) {
+	r, err := NewIdleMemoryReclaimer(0)
+	assert.NilError(t, err)
+	assert.Assert(t, r == nil)
+	_, err = NewIdleMemoryReclaimer(-time.Minute)
+	assert.ErrorContains(t, err, "negative")
+
+	r, err = NewIdleMemoryReclaimer(10 * time.Minute)
+	assert.NilError(t, err)
+	start := time.Now()
+	// The window counts from when a pod is first seen.
+	assert.Equal(t, r.Observe("pod-1", false, start), false)
+	assert.Equal(t, r.Observe("pod-1", false, start.Add(9*time.Minute)), false)
+	assert.Equal(t, r.Observe("pod-1", false, start.Add(10*time.Minute)), true)
+	// Any use of the GPUs starts it over.
+	assert.Equal(t, r.Observe("pod-1", true, start.Add(11*time.Minute)), false)
+	assert.Equal(t, r.Observe("pod-1", false, start.Add(20*time.Minute)), false)
+	assert.Equal(t, r.Observe("pod-1", false, start.Add(21*time.Minute)), true)
+
+	r.Forget(func(string) bool { return false })
+	assert.Equal(t, r.Observe("pod-1", false, start.Add(40*time.Minute)), false)
+}
+
+func TestReclaimable(t *testing.T) {
+	pod := func(annos map[string]string) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: annos}}
+	}
+	assert.Equal(t, Reclaimable(pod(nil)), false)
+	assert.Equal(t, Reclaimable(pod(map[string]string{util.GPUReclaimableMemory: "true"})), true)
+	assert.Equal(t, Reclaimable(pod(map[string]string{util.GPUReclaimableMemory: "false"})), false)
+	assert.Equal(t, Reclaimable(pod(map[string]string{util.GPUReclaimableMemory: "true", util.GPUTier: util.SoftReservation})), false)
+}
+
+func TestIdleMemoryLimit(t *testing.T) {
+	mib := uint64(util.MiB)
+	assert.Equal(t, IdleMemoryLimit(0), uint64(0))
+	assert.Equal(t, IdleMemoryLimit(mib), mib)
+	assert.Equal(t, IdleMemoryLimit(mib+1), 2*mib)
+}
+
+func TestInjectedContainerMemoryLimit(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+			devicenvidia.AllocatedDevicesAnnos: "GPU-0,NVIDIA,1000,10:GPU-1,NVIDIA,3000,10:;;GPU-2[1-0],NVIDIA,5000,0:;",
+		}},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "main"}, {Name: "sidecar"}, {Name: "mig"}}},
+	}
+	limit, ok := InjectedContainerMemoryLimit(pod, "main")
+	assert.Equal(t, ok, true)
+	assert.Equal(t, limit, uint64(3000*util.MiB))
+	_, ok = InjectedContainerMemoryLimit(pod, "sidecar")
+	assert.Equal(t, ok, false)
+	_, ok = InjectedContainerMemoryLimit(pod, "mig")
+	assert.Equal(t, ok, false)
+	_, ok = InjectedContainerMemoryLimit(pod, "missing")
+	assert.Equal(t, ok, false)
+}
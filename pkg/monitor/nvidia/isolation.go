@@ -0,0 +1,196 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nvidia
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+
+	devicenvidia "github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// Isolation states of the containers of GPU pods.
+const (
+	// IsolationActive is a container whose HAMi-core region holds the limits injected into it.
+	IsolationActive = "active"
+	// IsolationInactive is a container running GPU processes without a HAMi-core region, e.g.
+	// because its image drops /etc/ld.so.preload or its runtime skipped the mounts.
+	IsolationInactive = "inactive"
+	// IsolationLimitMismatch is a container whose HAMi-core region holds other memory limits
+	// than the ones injected into it.
+	IsolationLimitMismatch = "limit_mismatch"
+)
+
+// IsolationKey identifies a container of a pod.
+type IsolationKey struct {
+	PodUID    string
+	Container string
+}
+
+// IsolationStatus is the outcome of the isolation audit of a container.
+type IsolationStatus struct {
+	IsolationKey
+	State string
+	// Detail tells what is wrong with the isolation, "" if it is active.
+	Detail string
+}
+
+// InjectedMemoryLimits returns the memory limits, in bytes, the device plugin injects for
+// HAMi-core into the containers of pod, by device UUID. It is nil for a pod without NVIDIA
+// devices or with MIG instances, which don't use HAMi-core.
+func InjectedMemoryLimits(pod *corev1.Pod) map[string][]uint64 {
+	value, ok := pod.Annotations[devicenvidia.AllocatedDevicesAnnos]
+	if !ok {
+		return nil
+	}
+	value, err := util.ExpandDevicesAnnotation(value)
+	if err != nil {
+		return nil
+	}
+	limits := make(map[string][]uint64)
+	for _, entry := range strings.Split(value, util.OnePodMultiContainerSplitSymbol) {
+		devices, err := util.DecodeContainerDevices(entry)
+		if err != nil {
+			return nil
+		}
+		for _, d := range devices {
+			if d.UUID == "" || strings.Contains(d.UUID, "[") {
+				return nil
+			}
+			limit, err := util.ParseMemoryLimitEnv(util.MemoryLimitEnvValue(d.Usedmem))
+			if err != nil {
+				return nil
+			}
+			limits[d.UUID] = append(limits[d.UUID], uint64(limit))
+		}
+	}
+	if len(limits) == 0 {
+		return nil
+	}
+	return limits
+}
+
+// hamiCoreDisabled reports whether ctr opted out of HAMi-core with CUDA_DISABLE_CONTROL.
+func hamiCoreDisabled(ctr *corev1.Container) bool {
+	for _, env := range ctr.Env {
+		if env.Name == "CUDA_DISABLE_CONTROL" {
+			disabled, _ := strconv.ParseBool(env.Value)
+			return disabled
+		}
+	}
+	return false
+}
+
+// AuditIsolation checks the isolation of ctr of pod against limits, the InjectedMemoryLimits of
+// the pod. usage is the HAMi-core region of the container, nil if it has none, and
+// gpuProcesses whether NVML reports processes of the container. It returns false for a
+// container which isn't audited: one which opted out of HAMi-core, or hasn't used a GPU yet.
+func AuditIsolation(pod *corev1.Pod, ctr *corev1.Container, limits map[string][]uint64, usage *ContainerUsage, gpuProcesses bool) (IsolationStatus, bool) {
+	status := IsolationStatus{IsolationKey: IsolationKey{PodUID: string(pod.UID), Container: ctr.Name}, State: IsolationActive}
+	if len(limits) == 0 || hamiCoreDisabled(ctr) {
+		return status, false
+	}
+	if usage == nil || usage.Info == nil {
+		if !gpuProcesses {
+			return status, false
+		}
+		status.State = IsolationInactive
+		status.Detail = "the container runs GPU processes, but HAMi-core was not loaded into them"
+		return status, true
+	}
+	for i := range usage.Info.DeviceMax() {
+		if !usage.Info.IsValidUUID(i) {
+			continue
+		}
+		uuid := strings.TrimRight(usage.Info.DeviceUUID(i), "\x00")
+		limit := usage.Info.DeviceMemoryLimit(i)
+		injected, ok := limits[uuid]
+		if !ok {
+			status.State = IsolationLimitMismatch
+			status.Detail = fmt.Sprintf("HAMi-core limits device %s, which is not allocated to the pod", uuid)
+			return status, true
+		}
+		// The vGPU monitor lowers the limit of soft and idle pods itself.
+		if slices.Contains(injected, limit) || (usage.SoftMemoryLimit > 0 && limit == usage.SoftMemoryLimit) ||
+			(usage.IdleMemoryLimit > 0 && limit == usage.IdleMemoryLimit) {
+			continue
+		}
+		want := make([]string, 0, len(injected))
+		for _, l := range injected {
+			want = append(want, fmt.Sprint(l/uint64(util.MiB)))
+		}
+		status.State = IsolationLimitMismatch
+		status.Detail = fmt.Sprintf("HAMi-core limits the memory of device %s to %d MiB, %s MiB were injected", uuid, limit/uint64(util.MiB), strings.Join(want, " or "))
+		return status, true
+	}
+	return status, true
+}
+
+// IsolationAuditor keeps the last isolation status of every audited container.
+type IsolationAuditor struct {
+	mutex    sync.Mutex
+	statuses map[IsolationKey]IsolationStatus
+}
+
+func NewIsolationAuditor() *IsolationAuditor {
+	return &IsolationAuditor{statuses: make(map[IsolationKey]IsolationStatus)}
+}
+
+// Observe records status. It reports whether the state of the container changed, which is the
+// case for the first status of a container too.
+func (a *IsolationAuditor) Observe(status IsolationStatus) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	prev, ok := a.statuses[status.IsolationKey]
+	a.statuses[status.IsolationKey] = status
+	return !ok || prev.State != status.State
+}
+
+// Forget drops the statuses of the containers keep doesn't report.
+func (a *IsolationAuditor) Forget(keep func(IsolationKey) bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for key := range a.statuses {
+		if !keep(key) {
+			delete(a.statuses, key)
+		}
+	}
+}
+
+// Statuses returns the last status of every audited container.
+func (a *IsolationAuditor) Statuses() []IsolationStatus {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	statuses := make([]IsolationStatus, 0, len(a.statuses))
+	for _, s := range a.statuses {
+		statuses = append(statuses, s)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].PodUID != statuses[j].PodUID {
+			return statuses[i].PodUID < statuses[j].PodUID
+		}
+		return statuses[i].Container < statuses[j].Container
+	})
+	return statuses
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nvidia
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	devicenvidia "github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// fakeUsageInfo is the HAMi-core region of a container limiting the devices in uuids.
+type fakeUsageInfo struct {
+	UsageInfo
+	uuids  []string
+	limits []uint64
+}
+
+func (f fakeUsageInfo) DeviceMax() int                   { return 16 }
+func (f fakeUsageInfo) IsValidUUID(idx int) bool         { return idx < len(f.uuids) }
+func (f fakeUsageInfo) DeviceMemoryLimit(idx int) uint64 { return f.limits[idx] }
+
+// DeviceUUID is padded with NULs like the fixed size UUIDs of the region.
+func (f fakeUsageInfo) DeviceUUID(idx int) string {
+	return f.uuids[idx] + "\x00\x00\x00"
+}
+
+func isolationPod(annos map[string]string, env ...corev1.EnvVar) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "p1", UID: "uid1", Annotations: annos},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "sidecar"}, {Name: "train", Env: env}}},
+	}
+}
+
+func TestInjectedMemoryLimits(t *testing.T) {
+	mib := uint64(util.MiB)
+	pod := isolationPod(map[string]string{devicenvidia.AllocatedDevicesAnnos: "GPU-0,NVIDIA,3000,30:;GPU-0,NVIDIA,1000,0:GPU-1,NVIDIA,2000,0:;"})
+	assert.DeepEqual(t, InjectedMemoryLimits(pod), map[string][]uint64{"GPU-0": {3000 * mib, 1000 * mib}, "GPU-1": {2000 * mib}})
+
+	assert.Assert(t, InjectedMemoryLimits(isolationPod(nil)) == nil)
+	mig := isolationPod(map[string]string{devicenvidia.AllocatedDevicesAnnos: "GPU-0[1g.5gb-0],NVIDIA,5120,0:;"})
+	assert.Assert(t, InjectedMemoryLimits(mig) == nil)
+}
+
+func TestAuditIsolation(t *testing.T) {
+	mib := uint64(util.MiB)
+	limits := map[string][]uint64{"GPU-0": {3000 * mib}}
+	pod := isolationPod(nil)
+	train := &pod.Spec.Containers[1]
+	usage := func(uuid string, limit uint64) *ContainerUsage {
+		return &ContainerUsage{Info: fakeUsageInfo{uuids: []string{uuid}, limits: []uint64{limit}}}
+	}
+
+	status, ok := AuditIsolation(pod, train, limits, usage("GPU-0", 3000*mib), true)
+	assert.Assert(t, ok)
+	assert.Equal(t, status.State, IsolationActive)
+	assert.Equal(t, status.IsolationKey, IsolationKey{PodUID: "uid1", Container: "train"})
+
+	// Without a region, only a container running GPU processes is audited.
+	_, ok = AuditIsolation(pod, train, limits, nil, false)
+	assert.Assert(t, !ok)
+	status, ok = AuditIsolation(pod, train, limits, nil, true)
+	assert.Assert(t, ok)
+	assert.Equal(t, status.State, IsolationInactive)
+
+	status, _ = AuditIsolation(pod, train, limits, usage("GPU-0", 8000*mib), true)
+	assert.Equal(t, status.State, IsolationLimitMismatch)
+	assert.Equal(t, status.Detail, "HAMi-core limits the memory of device GPU-0 to 8000 MiB, 3000 MiB were injected")
+	status, _ = AuditIsolation(pod, train, limits, usage("GPU-1", 3000*mib), true)
+	assert.Equal(t, status.State, IsolationLimitMismatch)
+	assert.Equal(t, status.Detail, "HAMi-core limits device GPU-1, which is not allocated to the pod")
+
+	// A soft pod may have been lowered by the monitor.
+	soft := usage("GPU-0", 1000*mib)
+	soft.SoftMemoryLimit = 1000 * mib
+	status, _ = AuditIsolation(pod, train, limits, soft, true)
+	assert.Equal(t, status.State, IsolationActive)
+
+	disabled := isolationPod(nil, corev1.EnvVar{Name: "CUDA_DISABLE_CONTROL", Value: "true"})
+	_, ok = AuditIsolation(disabled, &disabled.Spec.Containers[1], limits, nil, true)
+	assert.Assert(t, !ok)
+}
+
+func TestIsolationAuditor(t *testing.T) {
+	a := NewIsolationAuditor()
+	key := IsolationKey{PodUID: "uid1", Container: "train"}
+	assert.Assert(t, a.Observe(IsolationStatus{IsolationKey: key, State: IsolationActive}))
+	assert.Assert(t, !a.Observe(IsolationStatus{IsolationKey: key, State: IsolationActive}))
+	assert.Assert(t, a.Observe(IsolationStatus{IsolationKey: key, State: IsolationInactive}))
+	assert.DeepEqual(t, a.Statuses(), []IsolationStatus{{IsolationKey: key, State: IsolationInactive}})
+
+	a.Forget(func(IsolationKey) bool { return false })
+	assert.Equal(t, len(a.Statuses()), 0)
+}
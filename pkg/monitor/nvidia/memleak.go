@@ -0,0 +1,154 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nvidia
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryLeakSteps is the number of steps a window is sampled in. Usage is only compared
+// between steps, so allocations freed and made again within a step don't break the trend.
+const memoryLeakSteps = 10
+
+// MemoryLeakKey identifies the memory a pod uses on one device.
+type MemoryLeakKey struct {
+	PodUID     string
+	DeviceUUID string
+}
+
+// MemoryLeak is the memory use of a pod on one device suspected to leak.
+type MemoryLeak struct {
+	MemoryLeakKey
+	// From and Used are the memory in use at the start and the end of the window, in bytes.
+	From  uint64
+	Used  uint64
+	Limit uint64
+}
+
+type memorySample struct {
+	at   time.Time
+	used uint64
+}
+
+// MemoryLeakDetector suspects a pod to leak memory on a device when the memory it uses there
+// grew at every step of the window and reached threshold of its limit.
+type MemoryLeakDetector struct {
+	window    time.Duration
+	threshold float64
+
+	mutex   sync.Mutex
+	samples map[MemoryLeakKey][]memorySample
+	leaks   map[MemoryLeakKey]MemoryLeak
+}
+
+// NewMemoryLeakDetector returns a detector over window, or nil if window is 0.
+func NewMemoryLeakDetector(window time.Duration, threshold float64) (*MemoryLeakDetector, error) {
+	if window == 0 {
+		return nil, nil
+	}
+	if window < 0 {
+		return nil, fmt.Errorf("memory leak window %s is negative", window)
+	}
+	if threshold <= 0 || threshold > 1 {
+		return nil, fmt.Errorf("memory leak threshold %v is not above 0 and at most 1", threshold)
+	}
+	return &MemoryLeakDetector{
+		window:    window,
+		threshold: threshold,
+		samples:   make(map[MemoryLeakKey][]memorySample),
+		leaks:     make(map[MemoryLeakKey]MemoryLeak),
+	}, nil
+}
+
+// Window returns the window the memory use has to grow over.
+func (d *MemoryLeakDetector) Window() time.Duration {
+	return d.window
+}
+
+// Observe records that the pod of key uses used of limit bytes on its device at now. It
+// returns the leak if the pod is newly suspected.
+func (d *MemoryLeakDetector) Observe(key MemoryLeakKey, used, limit uint64, now time.Time) (MemoryLeak, bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	samples := d.samples[key]
+	if n := len(samples); n == 0 || now.Sub(samples[n-1].at) >= d.window/memoryLeakSteps {
+		samples = append(samples, memorySample{at: now, used: used})
+	}
+	// Drop the samples before the window, keeping the one it starts from.
+	for len(samples) > 1 && now.Sub(samples[1].at) >= d.window {
+		samples = samples[1:]
+	}
+	d.samples[key] = samples
+
+	leak, leaking := d.leaking(key, samples, used, limit, now)
+	if !leaking {
+		delete(d.leaks, key)
+		return MemoryLeak{}, false
+	}
+	_, known := d.leaks[key]
+	d.leaks[key] = leak
+	return leak, !known
+}
+
+// leaking reports whether the memory use of key, samples up to used now, grew at every step of
+// the window.
+func (d *MemoryLeakDetector) leaking(key MemoryLeakKey, samples []memorySample, used, limit uint64, now time.Time) (MemoryLeak, bool) {
+	if limit == 0 || len(samples) < 2 || now.Sub(samples[0].at) < d.window {
+		return MemoryLeak{}, false
+	}
+	for i := 1; i < len(samples); i++ {
+		if samples[i].used < samples[i-1].used {
+			return MemoryLeak{}, false
+		}
+	}
+	if used < samples[len(samples)-1].used || used <= samples[0].used || float64(used) < d.threshold*float64(limit) {
+		return MemoryLeak{}, false
+	}
+	return MemoryLeak{MemoryLeakKey: key, From: samples[0].used, Used: used, Limit: limit}, true
+}
+
+// Forget drops the samples of the pods and devices keep doesn't report.
+func (d *MemoryLeakDetector) Forget(keep func(MemoryLeakKey) bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for key := range d.samples {
+		if !keep(key) {
+			delete(d.samples, key)
+			delete(d.leaks, key)
+		}
+	}
+}
+
+// Leaks returns the memory use currently suspected to leak, by pod and device.
+func (d *MemoryLeakDetector) Leaks() []MemoryLeak {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	leaks := make([]MemoryLeak, 0, len(d.leaks))
+	for _, l := range d.leaks {
+		leaks = append(leaks, l)
+	}
+	sort.Slice(leaks, func(i, j int) bool {
+		if leaks[i].PodUID != leaks[j].PodUID {
+			return leaks[i].PodUID < leaks[j].PodUID
+		}
+		return leaks[i].DeviceUUID < leaks[j].DeviceUUID
+	})
+	return leaks
+}
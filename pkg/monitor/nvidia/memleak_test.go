@@ -0,0 +1,90 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nvidia
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestMemoryLeakDetector(t *testing.T) {
+	const mib = uint64(1024 * 1024)
+	key := MemoryLeakKey{PodUID: "pod-1", DeviceUUID: "GPU-0"}
+	start := time.Now()
+	tests := []struct {
+		name string
+		// usage is the memory in use, in MiB, once per minute.
+		usage []uint64
+		want  bool
+	}{
+		{name: "grows toward the limit", usage: []uint64{1000, 1500, 2000, 2500, 3000, 3500, 4000, 4500, 5000, 5500, 7500}, want: true},
+		{name: "flat at times", usage: []uint64{5000, 5000, 5500, 5500, 6000, 6000, 6500, 6500, 7000, 7000, 7500}, want: true},
+		{name: "below the threshold", usage: []uint64{1000, 1100, 1200, 1300, 1400, 1500, 1600, 1700, 1800, 1900, 2000}, want: false},
+		{name: "drops once", usage: []uint64{5000, 5500, 6000, 6500, 6000, 6500, 7000, 7100, 7200, 7300, 7500}, want: false},
+		{name: "steady", usage: []uint64{7500, 7500, 7500, 7500, 7500, 7500, 7500, 7500, 7500, 7500, 7500}, want: false},
+		{name: "window not covered", usage: []uint64{1000, 2000, 3000, 4000, 5000, 6000, 7500}, want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d, err := NewMemoryLeakDetector(10*time.Minute, 0.9)
+			assert.NilError(t, err)
+			reported := false
+			for i, used := range test.usage {
+				_, newly := d.Observe(key, used*mib, 8000*mib, start.Add(time.Duration(i)*time.Minute))
+				reported = reported || newly
+			}
+			assert.Equal(t, reported, test.want)
+			assert.Equal(t, len(d.Leaks()), map[bool]int{true: 1}[test.want])
+		})
+	}
+}
+
+func TestMemoryLeakDetectorReportsOnce(t *testing.T) {
+	const mib = uint64(1024 * 1024)
+	key := MemoryLeakKey{PodUID: "pod-1", DeviceUUID: "GPU-0"}
+	d, err := NewMemoryLeakDetector(10*time.Minute, 0.5)
+	assert.NilError(t, err)
+	start := time.Now()
+	newlyAt := make([]int, 0)
+	observe := func(i int, used uint64) {
+		if leak, newly := d.Observe(key, used*mib, 8000*mib, start.Add(time.Duration(i)*time.Minute)); newly {
+			newlyAt = append(newlyAt, i)
+			assert.Equal(t, leak.Used, used*mib)
+		}
+	}
+	for i := range 15 {
+		observe(i, 4000+uint64(i)*100)
+	}
+	assert.DeepEqual(t, newlyAt, []int{10})
+
+	// Once the usage drops, the pod is no longer suspected.
+	observe(15, 1000)
+	assert.Equal(t, len(d.Leaks()), 0)
+
+	d.Forget(func(MemoryLeakKey) bool { return false })
+	assert.Equal(t, len(d.samples), 0)
+}
+
+func TestNewMemoryLeakDetector(t *testing.T) {
+	d, err := NewMemoryLeakDetector(0, 0.9)
+	assert.NilError(t, err)
+	assert.Assert(t, d == nil)
+	_, err = NewMemoryLeakDetector(time.Minute, 1.5)
+	assert.ErrorContains(t, err, "threshold")
+}
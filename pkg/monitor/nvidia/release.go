@@ -0,0 +1,82 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nvidia
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/audit"
+	devicenvidia "github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// ReleaseTracker follows the pods of the node holding the NVIDIA devices the device plugin
+// allocated to them, and tells when they stop holding them for the audit trail.
+type ReleaseTracker struct {
+	holding map[k8stypes.UID]*corev1.Pod
+}
+
+func NewReleaseTracker() *ReleaseTracker {
+	return &ReleaseTracker{holding: make(map[k8stypes.UID]*corev1.Pod)}
+}
+
+// holdsDevices reports whether the device plugin allocated the devices of pod and it still runs.
+func holdsDevices(pod *corev1.Pod) bool {
+	if pod.Annotations[util.DeviceBindPhase] != util.DeviceBindSuccess {
+		return false
+	}
+	if _, ok := pod.Annotations[devicenvidia.AllocatedDevicesAnnos]; !ok {
+		return false
+	}
+	return pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed
+}
+
+// Update takes the pods on the node and returns the release events of the pods which held
+// their devices at the last update and no longer do, as they terminated or were deleted.
+// Pods first seen terminated, e.g. after a restart of the monitor, are left out, as their
+// release may have been recorded already.
+func (t *ReleaseTracker) Update(nodename string, pods []corev1.Pod) []audit.AllocationEvent {
+	events := make([]audit.AllocationEvent, 0)
+	seen := make(map[k8stypes.UID]bool)
+	for i := range pods {
+		pod := &pods[i]
+		if holdsDevices(pod) {
+			t.holding[pod.UID] = pod
+			seen[pod.UID] = true
+		}
+	}
+	for uid, pod := range t.holding {
+		if seen[uid] {
+			continue
+		}
+		for i := range pods {
+			if pods[i].UID == uid {
+				// Terminated, the last state tells the most.
+				pod = &pods[i]
+			}
+		}
+		pd, err := util.DecodePodDevices(map[string]string{devicenvidia.NvidiaGPUDevice: devicenvidia.AllocatedDevicesAnnos}, pod.Annotations)
+		if err != nil {
+			klog.ErrorS(err, "Failed to decode the devices of the released pod", "pod", klog.KObj(pod))
+		}
+		events = append(events, audit.NewAllocationEvent(audit.EventReleased, pod, nodename, pd))
+		delete(t.holding, uid)
+	}
+	return events
+}
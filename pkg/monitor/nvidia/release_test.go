@@ -0,0 +1,68 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nvidia
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+
+	"github.com/Project-HAMi/HAMi/pkg/audit"
+	devicenvidia "github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func releasePod(uid, bindPhase string, phase corev1.PodPhase) corev1.Pod {
+	return corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: uid, Namespace: "default", UID: k8stypes.UID(uid), Annotations: map[string]string{
+			util.DeviceBindPhase:               bindPhase,
+			devicenvidia.AllocatedDevicesAnnos: "GPU-0,NVIDIA,1024,30:;",
+		}},
+		Spec:   corev1.PodSpec{Containers: []corev1.Container{{Name: "gpu"}}},
+		Status: corev1.PodStatus{Phase: phase},
+	}
+}
+
+func TestReleaseTracker(t *testing.T) {
+	tracker := NewReleaseTracker()
+	running := releasePod("running", util.DeviceBindSuccess, corev1.PodRunning)
+	deleted := releasePod("deleted", util.DeviceBindSuccess, corev1.PodRunning)
+	pending := releasePod("pending", util.DeviceBindAllocating, corev1.PodPending)
+	done := releasePod("done", util.DeviceBindSuccess, corev1.PodSucceeded)
+	assert.Equal(t, len(tracker.Update("node1", []corev1.Pod{running, deleted, pending, done})), 0)
+
+	// A pod allocated by the device plugin releases when it terminates or is deleted, a pod
+	// never allocated or first seen terminated doesn't.
+	running.Status.Phase = corev1.PodFailed
+	events := tracker.Update("node1", []corev1.Pod{running, pending, done})
+	assert.Equal(t, len(events), 2)
+	byPod := map[string]audit.AllocationEvent{}
+	for _, ev := range events {
+		byPod[ev.PodUID] = ev
+	}
+	assert.Equal(t, byPod["running"].Type, audit.EventReleased)
+	assert.Equal(t, byPod["running"].Node, "node1")
+	assert.DeepEqual(t, byPod["deleted"].Devices, []audit.DeviceRecord{{
+		Vendor: devicenvidia.NvidiaGPUDevice, Container: "gpu", UUID: "GPU-0", Usedmem: 1024 << 20, Usedcores: 30,
+	}})
+
+	// Every release is told once.
+	assert.Equal(t, len(tracker.Update("node1", []corev1.Pod{running, pending, done})), 0)
+}
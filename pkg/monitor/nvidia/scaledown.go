@@ -0,0 +1,134 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nvidia
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// ScaleDownStep is what the monitor does next for a hami.io/scale-down-checkpoint pod.
+type ScaleDownStep int
+
+const (
+	// ScaleDownWait leaves the pod as it is.
+	ScaleDownWait ScaleDownStep = iota
+	// ScaleDownSignal tells the pod its node is about to be removed and keeps the autoscaler
+	// from evicting it.
+	ScaleDownSignal
+	// ScaleDownRelease lets the autoscaler evict the pod again.
+	ScaleDownRelease
+	// ScaleDownRearm forgets an earlier signal, as the node is no longer removed.
+	ScaleDownRearm
+)
+
+// WantsScaleDownCheckpoint reports whether pod checkpoints before a scale-down of its node. A pod
+// setting the safe-to-evict annotation of the autoscaler itself is left to it, unless the monitor
+// set it.
+func WantsScaleDownCheckpoint(pod *corev1.Pod) bool {
+	if pod.Annotations[util.ScaleDownCheckpoint] != "true" {
+		return false
+	}
+	_, signaled := pod.Annotations[util.ScaleDownSignaledAt]
+	_, own := pod.Annotations[util.SafeToEvict]
+	return signaled || !own
+}
+
+// ScaleDownGrace returns how long the GPU containers of pod may take to checkpoint.
+func ScaleDownGrace(pod *corev1.Pod) time.Duration {
+	if d, err := time.ParseDuration(pod.Annotations[util.ScaleDownGrace]); err == nil && d > 0 {
+		return d
+	}
+	return util.DefaultScaleDownGrace
+}
+
+// ScaleDownCandidate reports whether the cluster autoscaler found node unneeded or is removing it.
+func ScaleDownCandidate(node *corev1.Node) bool {
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == util.DeletionCandidateTaint || taint.Key == util.ToBeDeletedTaint {
+			return true
+		}
+	}
+	return false
+}
+
+// scaleDownTime returns the time the annotation key of pod records.
+func scaleDownTime(pod *corev1.Pod, key string) (time.Time, bool) {
+	t, err := time.Parse(time.RFC3339, pod.Annotations[key])
+	return t, err == nil
+}
+
+// ScaleDownContainerDirs returns the HAMi-core directories of the containers of pod in
+// containerPath. Containers without one don't use GPUs through HAMi-core.
+func ScaleDownContainerDirs(pod *corev1.Pod, containerPath string) []string {
+	dirs := make([]string, 0)
+	for _, c := range pod.Spec.Containers {
+		dir := filepath.Join(containerPath, string(pod.UID)+"_"+c.Name)
+		if _, err := os.Stat(dir); err == nil {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// NextScaleDownStep returns what to do next for pod at now, with reason, from whether its node is
+// a scale-down candidate and the files in the HAMi-core directories of its containers in
+// containerPath:
+//   - a pod not signaled yet is signaled once its node is a candidate;
+//   - a signaled pod is released once every GPU container created util.ScaleDownReadyFile since,
+//     or its grace period elapsed;
+//   - a released pod whose node has been no candidate for a grace period is rearmed, for the
+//     next scale-down.
+func NextScaleDownStep(pod *corev1.Pod, containerPath string, candidate bool, now time.Time) (ScaleDownStep, string) {
+	grace := ScaleDownGrace(pod)
+	signaled, ok := scaleDownTime(pod, util.ScaleDownSignaledAt)
+	if !ok {
+		if candidate {
+			return ScaleDownSignal, fmt.Sprintf("node is about to be removed by the cluster autoscaler, checkpoint within %s", grace)
+		}
+		return ScaleDownWait, ""
+	}
+	if released, ok := scaleDownTime(pod, util.ScaleDownReleasedAt); ok {
+		if !candidate && now.Sub(released) >= grace {
+			return ScaleDownRearm, "node is no longer removed by the cluster autoscaler"
+		}
+		return ScaleDownWait, ""
+	}
+	var waiting []string
+	for _, dir := range ScaleDownContainerDirs(pod, containerPath) {
+		// A file left by an earlier scale-down is older than the signal.
+		info, err := os.Stat(filepath.Join(dir, util.ScaleDownReadyFile))
+		if err != nil || info.ModTime().Before(signaled) {
+			waiting = append(waiting, strings.TrimPrefix(filepath.Base(dir), string(pod.UID)+"_"))
+		}
+	}
+	switch {
+	case len(waiting) == 0:
+		return ScaleDownRelease, "GPU containers checkpointed"
+	case now.Sub(signaled) >= grace:
+		return ScaleDownRelease, fmt.Sprintf("containers %s didn't checkpoint within %s", strings.Join(waiting, ", "), grace)
+	default:
+		return ScaleDownWait, ""
+	}
+}
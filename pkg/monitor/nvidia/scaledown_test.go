@@ -0,0 +1,97 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nvidia
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func TestWantsScaleDownCheckpoint(t *testing.T) {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{util.ScaleDownCheckpoint: "true"}}}
+	assert.Assert(t, WantsScaleDownCheckpoint(pod))
+	pod.Annotations[util.SafeToEvict] = "false"
+	assert.Assert(t, !WantsScaleDownCheckpoint(pod), "the pod decides on its eviction itself")
+	pod.Annotations[util.ScaleDownSignaledAt] = time.Now().Format(time.RFC3339)
+	assert.Assert(t, WantsScaleDownCheckpoint(pod), "the monitor set safe-to-evict")
+	pod.Annotations[util.ScaleDownCheckpoint] = "false"
+	assert.Assert(t, !WantsScaleDownCheckpoint(pod))
+}
+
+func TestScaleDownCandidate(t *testing.T) {
+	node := &corev1.Node{}
+	assert.Assert(t, !ScaleDownCandidate(node))
+	node.Spec.Taints = []corev1.Taint{{Key: util.DeletionCandidateTaint, Effect: corev1.TaintEffectPreferNoSchedule}}
+	assert.Assert(t, ScaleDownCandidate(node))
+	node.Spec.Taints = []corev1.Taint{{Key: util.ToBeDeletedTaint, Effect: corev1.TaintEffectNoSchedule}}
+	assert.Assert(t, ScaleDownCandidate(node))
+}
+
+func TestNextScaleDownStep(t *testing.T) {
+	containerPath := t.TempDir()
+	signaled := time.Now().Add(-time.Minute).Truncate(time.Second)
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "trainer", UID: "uid1", Annotations: map[string]string{util.ScaleDownCheckpoint: "true", util.ScaleDownGrace: "5m"}},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "train"}, {Name: "logger"}}},
+	}
+	dir := filepath.Join(containerPath, "uid1_train")
+	assert.NilError(t, os.MkdirAll(dir, 0o777))
+	ready := filepath.Join(dir, util.ScaleDownReadyFile)
+
+	step, _ := NextScaleDownStep(pod, containerPath, false, signaled)
+	assert.Equal(t, step, ScaleDownWait)
+	step, reason := NextScaleDownStep(pod, containerPath, true, signaled)
+	assert.Equal(t, step, ScaleDownSignal)
+	assert.Equal(t, reason, "node is about to be removed by the cluster autoscaler, checkpoint within 5m0s")
+
+	pod.Annotations[util.ScaleDownSignaledAt] = signaled.UTC().Format(time.RFC3339)
+	// The node stops being a candidate once the pod may no longer be evicted; the pod still
+	// checkpoints.
+	step, _ = NextScaleDownStep(pod, containerPath, false, signaled.Add(time.Minute))
+	assert.Equal(t, step, ScaleDownWait)
+
+	// A file of an earlier scale-down doesn't count.
+	assert.NilError(t, os.WriteFile(ready, nil, 0o666))
+	assert.NilError(t, os.Chtimes(ready, signaled.Add(-time.Hour), signaled.Add(-time.Hour)))
+	step, _ = NextScaleDownStep(pod, containerPath, false, signaled.Add(time.Minute))
+	assert.Equal(t, step, ScaleDownWait)
+	step, reason = NextScaleDownStep(pod, containerPath, false, signaled.Add(5*time.Minute))
+	assert.Equal(t, step, ScaleDownRelease)
+	assert.Equal(t, reason, "containers train didn't checkpoint within 5m0s")
+
+	assert.NilError(t, os.Chtimes(ready, signaled.Add(time.Second), signaled.Add(time.Second)))
+	step, reason = NextScaleDownStep(pod, containerPath, false, signaled.Add(time.Minute))
+	assert.Equal(t, step, ScaleDownRelease)
+	assert.Equal(t, reason, "GPU containers checkpointed")
+
+	released := signaled.Add(time.Minute)
+	pod.Annotations[util.ScaleDownReleasedAt] = released.UTC().Format(time.RFC3339)
+	step, _ = NextScaleDownStep(pod, containerPath, true, released.Add(time.Hour))
+	assert.Equal(t, step, ScaleDownWait, "the node is being removed")
+	step, _ = NextScaleDownStep(pod, containerPath, false, released.Add(time.Minute))
+	assert.Equal(t, step, ScaleDownWait, "the autoscaler may not have found the node unneeded again yet")
+	step, _ = NextScaleDownStep(pod, containerPath, false, released.Add(5*time.Minute))
+	assert.Equal(t, step, ScaleDownRearm)
+}
@@ -129,6 +129,10 @@ func (s Spec) DeviceSmUtil(idx int) uint64 {
 	return v
 }
 
+func (s Spec) DeviceSmLimit(idx int) uint64 {
+	return s.sr.smLimit[idx]
+}
+
 func (s Spec) SetDeviceSmLimit(l uint64) {
 	idx := uint64(0)
 	for idx < s.sr.num {
@@ -161,6 +165,17 @@ func (s Spec) LastKernelTime() int64 {
 	return 0
 }
 
+// HostPids returns the host pids of the processes registered in the shared region.
+func (s Spec) HostPids() []int32 {
+	pids := make([]int32, 0)
+	for i := range min(int(s.sr.procnum), len(s.sr.procs)) {
+		if s.sr.procs[i].hostpid > 0 {
+			pids = append(pids, s.sr.procs[i].hostpid)
+		}
+	}
+	return pids
+}
+
 func CastSpec(data []byte) Spec {
 	return Spec{
 		sr: (*sharedRegionT)(unsafe.Pointer(&data[0])),
@@ -642,6 +642,16 @@ func Test_DeviceSmUtil(t *testing.T) {
 	}
 }
 
+func Test_DeviceSmLimit(t *testing.T) {
+	s := &Spec{
+		sr: &sharedRegionT{
+			smLimit: [16]uint64{30, 50},
+		},
+	}
+	assert.Equal(t, s.DeviceSmLimit(0), uint64(30))
+	assert.Equal(t, s.DeviceSmLimit(1), uint64(50))
+}
+
 func Test_SetDeviceSmLimit(t *testing.T) {
 	tests := []struct {
 		name string
@@ -933,6 +943,37 @@ func Test_LastKernelTime(t *testing.T) {
 	}
 }
 
+func Test_HostPids(t *testing.T) {
+	tests := []struct {
+		name string
+		args *Spec
+		want []int32
+	}{
+		{
+			name: "registered processes with a host pid",
+			args: &Spec{
+				sr: &sharedRegionT{
+					procnum: 3,
+					procs: [1024]shrregProcSlotT{
+						{pid: 1, hostpid: 4321},
+						{pid: 2},
+						{pid: 3, hostpid: 4323},
+						{pid: 4, hostpid: 4324},
+					},
+				},
+			},
+			want: []int32{4321, 4323},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := test.args
+			result := s.HostPids()
+			assert.DeepEqual(t, result, test.want)
+		})
+	}
+}
+
 func Test_GetPriority(t *testing.T) {
 	tests := []struct {
 		name string
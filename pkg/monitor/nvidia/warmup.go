@@ -0,0 +1,118 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nvidia
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// Reasons of the hami.io/gpu-warmup condition of a pod.
+const (
+	// WarmupComplete is a pod whose GPU containers all reported their warmup complete.
+	WarmupComplete = "WarmupComplete"
+	// WarmingUp is a pod with GPU containers still warming up within the timeout.
+	WarmingUp = "WarmingUp"
+	// WarmupTimedOut is a pod with GPU containers still warming up past the timeout.
+	WarmupTimedOut = "WarmupTimedOut"
+)
+
+// WarmupStatus is the hami.io/gpu-warmup condition of a pod.
+type WarmupStatus struct {
+	Status  corev1.ConditionStatus
+	Reason  string
+	Message string
+}
+
+// WantsWarmup reports whether pod gates its readiness on the warmup of its GPU containers.
+func WantsWarmup(pod *corev1.Pod) bool {
+	if pod.Annotations[util.GPUWarmup] != "true" {
+		return false
+	}
+	for _, gate := range pod.Spec.ReadinessGates {
+		if gate.ConditionType == util.GPUWarmupCondition {
+			return true
+		}
+	}
+	return false
+}
+
+// WarmupTimeout returns how long the GPU containers of pod may take to warm up.
+func WarmupTimeout(pod *corev1.Pod) time.Duration {
+	if d, err := time.ParseDuration(pod.Annotations[util.GPUWarmupTimeout]); err == nil && d > 0 {
+		return d
+	}
+	return util.DefaultGPUWarmupTimeout
+}
+
+// CheckWarmup returns the warmup condition of pod at now from the HAMi-core directories of its
+// containers in containerPath. A container has warmed up once it created util.GPUWarmupDoneFile
+// there since it last started, so a restarted container warms up again. ok is false while a
+// container of the pod isn't running, as the pod isn't ready anyway.
+func CheckWarmup(pod *corev1.Pod, containerPath string, now time.Time) (status WarmupStatus, ok bool) {
+	if len(pod.Status.ContainerStatuses) == 0 {
+		return WarmupStatus{}, false
+	}
+	var started time.Time
+	gpuContainers := 0
+	var waiting []string
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.State.Running == nil {
+			return WarmupStatus{}, false
+		}
+		startedAt := cs.State.Running.StartedAt.Time
+		if startedAt.After(started) {
+			started = startedAt
+		}
+		dir := filepath.Join(containerPath, string(pod.UID)+"_"+cs.Name)
+		if _, err := os.Stat(dir); err != nil {
+			// Not a container with HAMi-core.
+			continue
+		}
+		gpuContainers++
+		// A file left by an earlier run of the container is older than its start.
+		info, err := os.Stat(filepath.Join(dir, util.GPUWarmupDoneFile))
+		if err != nil || info.ModTime().Before(startedAt) {
+			waiting = append(waiting, cs.Name)
+		}
+	}
+	timeout := WarmupTimeout(pod)
+	switch {
+	case gpuContainers == 0 && now.Sub(started) >= timeout:
+		return WarmupStatus{Status: corev1.ConditionFalse, Reason: WarmupTimedOut,
+			Message: "No container of the pod runs with HAMi-core to report its GPU warmup"}, true
+	case gpuContainers == 0:
+		return WarmupStatus{Status: corev1.ConditionFalse, Reason: WarmingUp,
+			Message: "Waiting for the GPU containers to start"}, true
+	case len(waiting) == 0:
+		return WarmupStatus{Status: corev1.ConditionTrue, Reason: WarmupComplete,
+			Message: "The GPU containers reported their warmup complete"}, true
+	case now.Sub(started) >= timeout:
+		return WarmupStatus{Status: corev1.ConditionFalse, Reason: WarmupTimedOut,
+			Message: fmt.Sprintf("Containers %s didn't report their GPU warmup complete within %s", strings.Join(waiting, ", "), timeout)}, true
+	default:
+		return WarmupStatus{Status: corev1.ConditionFalse, Reason: WarmingUp,
+			Message: fmt.Sprintf("Waiting for containers %s to report their GPU warmup complete", strings.Join(waiting, ", "))}, true
+	}
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nvidia
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func TestWantsWarmup(t *testing.T) {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{util.GPUWarmup: "true"}}}
+	assert.Assert(t, !WantsWarmup(pod))
+	pod.Spec.ReadinessGates = []corev1.PodReadinessGate{{ConditionType: util.GPUWarmupCondition}}
+	assert.Assert(t, WantsWarmup(pod))
+	pod.Annotations[util.GPUWarmup] = "false"
+	assert.Assert(t, !WantsWarmup(pod))
+}
+
+func TestCheckWarmup(t *testing.T) {
+	containerPath := t.TempDir()
+	started := time.Now().Add(-time.Minute).Truncate(time.Second)
+	running := func(name string, at time.Time) corev1.ContainerStatus {
+		return corev1.ContainerStatus{Name: name, State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: metav1.NewTime(at)}}}
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "server", UID: "uid1", Annotations: map[string]string{util.GPUWarmup: "true", util.GPUWarmupTimeout: "5m"}},
+		Status:     corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{running("model", started), running("proxy", started)}},
+	}
+	dir := filepath.Join(containerPath, "uid1_model")
+	assert.NilError(t, os.MkdirAll(dir, 0o777))
+	done := filepath.Join(dir, util.GPUWarmupDoneFile)
+
+	status, ok := CheckWarmup(pod, containerPath, started.Add(time.Minute))
+	assert.Assert(t, ok)
+	assert.Equal(t, status.Status, corev1.ConditionFalse)
+	assert.Equal(t, status.Reason, WarmingUp)
+	assert.Equal(t, status.Message, "Waiting for containers model to report their GPU warmup complete")
+
+	status, _ = CheckWarmup(pod, containerPath, started.Add(5*time.Minute))
+	assert.Equal(t, status.Reason, WarmupTimedOut)
+	assert.Equal(t, status.Message, "Containers model didn't report their GPU warmup complete within 5m0s")
+
+	// The proxy container without HAMi-core doesn't have to report anything.
+	assert.NilError(t, os.WriteFile(done, nil, 0o666))
+	status, _ = CheckWarmup(pod, containerPath, started.Add(5*time.Minute))
+	assert.Equal(t, status.Status, corev1.ConditionTrue)
+	assert.Equal(t, status.Reason, WarmupComplete)
+
+	// A restarted container warms up again.
+	assert.NilError(t, os.Chtimes(done, started, started))
+	pod.Status.ContainerStatuses[0] = running("model", started.Add(10*time.Second))
+	status, _ = CheckWarmup(pod, containerPath, started.Add(time.Minute))
+	assert.Equal(t, status.Reason, WarmingUp)
+
+	// Nothing is reported while a container isn't running.
+	pod.Status.ContainerStatuses[1].State = corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}
+	_, ok = CheckWarmup(pod, containerPath, started.Add(time.Minute))
+	assert.Assert(t, !ok)
+}
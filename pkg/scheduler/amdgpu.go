@@ -0,0 +1,84 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/device/hygon"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+)
+
+// AMDGPUResource is the resource of the ROCm device plugin.
+const AMDGPUResource corev1.ResourceName = "amd.com/gpu"
+
+// translateAMDGPU turns the amd.com/gpu resources of the containers of a pod in one of the
+// namespaces of --amd-gpu-translation-namespaces into as many whole Hygon DCUs.
+func translateAMDGPU(pod *corev1.Pod) error {
+	if !slices.Contains(config.AMDGPUTranslationNamespaces, pod.Namespace) {
+		return nil
+	}
+	for idx := range pod.Spec.Containers {
+		c := &pod.Spec.Containers[idx]
+		n, ok, err := amdGPUCount(c)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if _, enabled := device.GetDevices()[hygon.HygonDCUDevice]; !enabled || hygon.HygonResourceCount == "" {
+			return fmt.Errorf("container %s: %s can't be translated, the Hygon DCU device is not enabled", c.Name, AMDGPUResource)
+		}
+		for _, name := range []string{hygon.HygonResourceCount, hygon.HygonResourceMemory, hygon.HygonResourceCores} {
+			_, inLimits := c.Resources.Limits[corev1.ResourceName(name)]
+			_, inRequests := c.Resources.Requests[corev1.ResourceName(name)]
+			if inLimits || inRequests {
+				return fmt.Errorf("container %s: %s conflicts with the explicit resource %s, use one of them", c.Name, AMDGPUResource, name)
+			}
+		}
+		delete(c.Resources.Limits, AMDGPUResource)
+		delete(c.Resources.Requests, AMDGPUResource)
+		if c.Resources.Limits == nil {
+			c.Resources.Limits = corev1.ResourceList{}
+		}
+		// Without memory and cores the DCUs are reserved whole.
+		c.Resources.Limits[corev1.ResourceName(hygon.HygonResourceCount)] = *resource.NewQuantity(n, resource.DecimalSI)
+	}
+	return nil
+}
+
+// amdGPUCount returns the amd.com/gpu of c, the limit or else the request, and whether it has any.
+func amdGPUCount(c *corev1.Container) (int64, bool, error) {
+	q, ok := c.Resources.Limits[AMDGPUResource]
+	if !ok {
+		q, ok = c.Resources.Requests[AMDGPUResource]
+	}
+	if !ok {
+		return 0, false, nil
+	}
+	n, isInt := q.AsInt64()
+	if !isInt || n <= 0 {
+		return 0, false, fmt.Errorf("container %s: %s must be a positive integer, got %s", c.Name, AMDGPUResource, q.String())
+	}
+	return n, true, nil
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/hygon"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+)
+
+func Test_translateAMDGPU(t *testing.T) {
+	config.AMDGPUTranslationNamespaces = []string{"rocm"}
+	count, mem := hygon.HygonResourceCount, hygon.HygonResourceMemory
+	hygon.HygonResourceCount, hygon.HygonResourceMemory = "hygon.com/dcunum", "hygon.com/dcumem"
+	defer func() {
+		config.AMDGPUTranslationNamespaces = nil
+		hygon.HygonResourceCount, hygon.HygonResourceMemory = count, mem
+	}()
+	amdGPU := func(name string, n int64) corev1.Container {
+		return corev1.Container{Name: name, Resources: corev1.ResourceRequirements{
+			Limits:   corev1.ResourceList{AMDGPUResource: *resource.NewQuantity(n, resource.DecimalSI)},
+			Requests: corev1.ResourceList{AMDGPUResource: *resource.NewQuantity(n, resource.DecimalSI)},
+		}}
+	}
+	newPod := func(namespace string, ctrs ...corev1.Container) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "p1", Namespace: namespace}, Spec: corev1.PodSpec{Containers: ctrs}}
+	}
+
+	pod := newPod("rocm", corev1.Container{Name: "sidecar"}, amdGPU("train", 2))
+	assert.NilError(t, translateAMDGPU(pod))
+	assert.Equal(t, len(pod.Spec.Containers[0].Resources.Limits), 0)
+	train := pod.Spec.Containers[1].Resources
+	assert.Equal(t, len(train.Limits), 1)
+	assert.Equal(t, len(train.Requests), 0)
+	q := train.Limits[corev1.ResourceName(hygon.HygonResourceCount)]
+	assert.Equal(t, q.Value(), int64(2))
+
+	// Other namespaces keep their resources.
+	pod = newPod("default", amdGPU("train", 2))
+	assert.NilError(t, translateAMDGPU(pod))
+	_, ok := pod.Spec.Containers[0].Resources.Limits[AMDGPUResource]
+	assert.Assert(t, ok)
+
+	explicit := amdGPU("train", 1)
+	explicit.Resources.Limits[corev1.ResourceName(hygon.HygonResourceMemory)] = *resource.NewQuantity(1000, resource.DecimalSI)
+	fraction := amdGPU("train", 1)
+	fraction.Resources.Limits[AMDGPUResource] = resource.MustParse("500m")
+	assert.ErrorContains(t, translateAMDGPU(newPod("rocm", explicit)), "conflicts with the explicit resource "+hygon.HygonResourceMemory)
+	assert.ErrorContains(t, translateAMDGPU(newPod("rocm", fraction)), "must be a positive integer")
+
+	hygon.HygonResourceCount = ""
+	assert.ErrorContains(t, translateAMDGPU(newPod("rocm", amdGPU("train", 1))), "the Hygon DCU device is not enabled")
+}
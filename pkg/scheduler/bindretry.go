@@ -0,0 +1,96 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/metrics"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// EventReasonBindWriteFailed indicates that a write of the scheduler for a pod failed because
+// the API server stayed unreachable for the whole retry budget.
+const EventReasonBindWriteFailed = "BindWriteFailed"
+
+// bindRetryMaxBackoff caps the doubling wait between writes deferred while the API server is
+// unreachable, so a write goes through soon after it is back.
+const bindRetryMaxBackoff = 2 * time.Second
+
+// isAPIUnreachable reports whether err means the API server couldn't be reached at all, e.g.
+// while it restarts: the connection was refused, timed out, or its name didn't resolve. Other
+// errors, e.g. a connection lost after the request was sent, aren't taken as unreachable, as
+// the write may have gone through.
+func isAPIUnreachable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var dnsErr *net.DNSError
+	return utilnet.IsConnectionRefused(err) ||
+		utilnet.IsTimeout(err) ||
+		errors.As(err, &dnsErr)
+}
+
+// deferBindWrite reports whether a write failing with err is tried again because the API server
+// is unreachable and waiting *backoff stays within the retry budget ending at deadline. It waits
+// before returning true, and doubles *backoff up to bindRetryMaxBackoff.
+func deferBindWrite(err error, deadline time.Time, backoff *time.Duration) bool {
+	if !isAPIUnreachable(err) || time.Now().Add(*backoff).After(deadline) {
+		return false
+	}
+	metrics.BindWritesDeferred.Inc()
+	klog.InfoS("API server unreachable, deferring write", "backoff", *backoff, "err", err)
+	time.Sleep(*backoff)
+	*backoff = min(*backoff*2, bindRetryMaxBackoff)
+	return true
+}
+
+// patchPodAnnotationsDeferred patches the annotations of pod like util.PatchPodAnnotations,
+// deferring the write while the API server is unreachable for up to --bind-retry-budget.
+func patchPodAnnotationsDeferred(pod *corev1.Pod, annotations map[string]string) error {
+	deadline := time.Now().Add(config.BindRetryBudget)
+	backoff := config.BindRetryBackoff
+	for {
+		err := util.PatchPodAnnotations(pod, annotations)
+		if err == nil || !deferBindWrite(err, deadline, &backoff) {
+			return err
+		}
+	}
+}
+
+// recordBindWriteFailed counts a step for pod which failed with err because the API server
+// stayed unreachable for the whole retry budget, and records why on pod. It returns false,
+// recording nothing, if err has another cause.
+func (s *Scheduler) recordBindWriteFailed(pod *corev1.Pod, step string, err error) bool {
+	if !isAPIUnreachable(err) {
+		return false
+	}
+	metrics.BindWritesFailed.Inc()
+	if pod != nil && s.eventRecorder != nil {
+		s.eventRecorder.Event(pod, corev1.EventTypeWarning, EventReasonBindWriteFailed,
+			fmt.Sprintf("Failed to %s, the API server was unreachable for the retry budget of %s: %v", step, config.BindRetryBudget, err))
+	}
+	return true
+}
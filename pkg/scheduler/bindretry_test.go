@@ -0,0 +1,249 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+	extenderv1 "k8s.io/kube-scheduler/extender/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+	"github.com/Project-HAMi/HAMi/pkg/util/client"
+)
+
+func connectionRefused() error {
+	return &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+}
+
+func Test_isAPIUnreachable(t *testing.T) {
+	assert.Assert(t, isAPIUnreachable(connectionRefused()))
+	assert.Assert(t, isAPIUnreachable(fmt.Errorf("patch pod: %w", syscall.ECONNREFUSED)))
+	assert.Assert(t, isAPIUnreachable(&url.Error{Op: "Patch", URL: "https://apiserver", Err: &net.DNSError{Err: "no such host", Name: "apiserver", IsNotFound: true}}))
+	assert.Assert(t, isAPIUnreachable(&url.Error{Op: "Patch", URL: "https://apiserver", Err: &net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded}}))
+	// The write may have gone through before the connection was lost.
+	assert.Assert(t, !isAPIUnreachable(&url.Error{Op: "Patch", URL: "https://apiserver", Err: io.ErrUnexpectedEOF}))
+	assert.Assert(t, !isAPIUnreachable(&url.Error{Op: "Patch", URL: "https://apiserver", Err: errors.New("tls: bad certificate")}))
+	assert.Assert(t, !isAPIUnreachable(nil))
+	assert.Assert(t, !isAPIUnreachable(apierrors.NewConflict(corev1.Resource("pods"), "p1", nil)))
+	assert.Assert(t, !isAPIUnreachable(apierrors.NewForbidden(corev1.Resource("pods"), "p1", nil)))
+}
+
+func Test_deferBindWrite(t *testing.T) {
+	backoff := time.Millisecond
+	deadline := time.Now().Add(time.Hour)
+	assert.Assert(t, deferBindWrite(connectionRefused(), deadline, &backoff))
+	assert.Equal(t, backoff, 2*time.Millisecond)
+	assert.Assert(t, !deferBindWrite(apierrors.NewConflict(corev1.Resource("pods"), "p1", nil), deadline, &backoff))
+
+	// The wait is capped, and never runs past the deadline.
+	backoff = time.Minute
+	assert.Assert(t, !deferBindWrite(connectionRefused(), deadline.Add(-59*time.Minute), &backoff))
+	backoff = bindRetryMaxBackoff
+	assert.Assert(t, !deferBindWrite(connectionRefused(), time.Now(), &backoff))
+}
+
+// bindDuringOutage binds a pod while the API server is unreachable for the first outage binding
+// attempts, and returns the result, the binding attempts and the events recorded on the pod.
+func bindDuringOutage(t *testing.T, outage int) (*extenderv1.ExtenderBindingResult, int, []string) {
+	fakeClient := fake.NewSimpleClientset(
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "p1", Namespace: "default", UID: "uid-1"}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}},
+	)
+	calls := 0
+	fakeClient.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "binding" {
+			return false, nil, nil
+		}
+		calls++
+		if calls <= outage {
+			return true, nil, connectionRefused()
+		}
+		return true, nil, nil
+	})
+	client.KubeClient = fakeClient
+	s := NewScheduler()
+	s.kubeClient = fakeClient
+	recorder := record.NewFakeRecorder(10)
+	s.eventRecorder = recorder
+
+	res, err := s.Bind(extenderv1.ExtenderBindingArgs{PodName: "p1", PodNamespace: "default", PodUID: "uid-1", Node: "node1"})
+	assert.NilError(t, err)
+	var events []string
+	for len(recorder.Events) > 0 {
+		events = append(events, <-recorder.Events)
+	}
+	return res, calls, events
+}
+
+func Test_BindDuringAPIOutage(t *testing.T) {
+	prevBackoff, prevCount, prevBudget := config.BindRetryBackoff, config.BindRetryCount, config.BindRetryBudget
+	defer func() {
+		config.BindRetryBackoff, config.BindRetryCount, config.BindRetryBudget = prevBackoff, prevCount, prevBudget
+	}()
+	config.BindRetryBackoff = time.Millisecond
+	config.BindRetryCount = 1
+
+	// A short outage is waited out within the budget, beyond the retries of transient errors.
+	config.BindRetryBudget = time.Minute
+	res, calls, events := bindDuringOutage(t, 4)
+	assert.Equal(t, res.Error, "")
+	assert.Equal(t, calls, 5)
+	assert.Equal(t, len(events), 1)
+	assert.Assert(t, strings.HasPrefix(events[0], "Normal "+EventReasonBindingSucceed), events[0])
+
+	// An outage outlasting the budget fails the bind with a clear event.
+	config.BindRetryBudget = 5 * time.Millisecond
+	res, calls, events = bindDuringOutage(t, 100)
+	assert.Assert(t, strings.Contains(res.Error, "connect"), res.Error)
+	assert.Assert(t, calls < 100)
+	assert.Equal(t, len(events), 1)
+	assert.Assert(t, strings.HasPrefix(events[0], "Warning "+EventReasonBindWriteFailed), events[0])
+	assert.Assert(t, strings.Contains(events[0], "bind the pod to node node1, the API server was unreachable for the retry budget of 5ms"), events[0])
+}
+
+func Test_FilterDefersWriteOutsidePolicyLock(t *testing.T) {
+	prev := device.ActiveConfig()
+	initTFLOPSDevices(t)
+	defer func() { assert.NilError(t, device.InitDevicesWithConfig(prev)) }()
+	prevBackoff, prevBudget := config.BindRetryBackoff, config.BindRetryBudget
+	defer func() { config.BindRetryBackoff, config.BindRetryBudget = prevBackoff, prevBudget }()
+	config.BindRetryBackoff = time.Millisecond
+	config.BindRetryBudget = time.Minute
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "p1", Namespace: "default", UID: "uid-1"},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name: "gpu",
+			Resources: corev1.ResourceRequirements{Limits: corev1.ResourceList{
+				"hami.io/gpu": resource.MustParse("1"),
+			}},
+		}}},
+	}
+	fakeClient := fake.NewSimpleClientset(pod)
+	outage := make(chan struct{})
+	deferred := make(chan struct{})
+	var once sync.Once
+	fakeClient.PrependReactor("patch", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		select {
+		case <-outage:
+			return false, nil, nil
+		default:
+			once.Do(func() { close(deferred) })
+			return true, nil, connectionRefused()
+		}
+	})
+	client.KubeClient = fakeClient
+	s := NewScheduler()
+	s.kubeClient = fakeClient
+	s.eventRecorder = record.NewFakeRecorder(10)
+	s.addNode("node1", &util.NodeInfo{
+		ID:      "node1",
+		Node:    &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}},
+		Devices: []util.DeviceInfo{{ID: "GPU-0", Count: 10, Devmem: 8000, Devcore: 100, Type: nvidia.NvidiaGPUDevice, Health: true}},
+	})
+
+	results := make(chan *extenderv1.ExtenderFilterResult, 1)
+	go func() {
+		res, err := s.Filter(extenderv1.ExtenderArgs{Pod: pod, NodeNames: &[]string{"node1"}})
+		assert.Check(t, err)
+		results <- res
+	}()
+	<-deferred
+	// A policy reload isn't held off while the filter defers its write.
+	locked := make(chan struct{})
+	go func() {
+		s.policyMutex.Lock()
+		s.policyMutex.Unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the policy lock is held while the filter defers its write")
+	}
+	close(outage)
+	res := <-results
+	assert.Assert(t, res != nil)
+	assert.DeepEqual(t, *res.NodeNames, []string{"node1"})
+}
+
+func Test_FilterWriteFailureLeavesNoPlacement(t *testing.T) {
+	prev := device.ActiveConfig()
+	initTFLOPSDevices(t)
+	defer func() { assert.NilError(t, device.InitDevicesWithConfig(prev)) }()
+	prevTTL := config.StickyPlacementTTL
+	defer func() { config.StickyPlacementTTL = prevTTL }()
+	config.StickyPlacementTTL = time.Minute
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "p1", Namespace: "default", UID: "uid-1",
+			Annotations: map[string]string{StickyPlacementAnnotation: "true", util.Reservation: "token"},
+		},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name: "gpu",
+			Resources: corev1.ResourceRequirements{Limits: corev1.ResourceList{
+				"hami.io/gpu": resource.MustParse("1"),
+			}},
+		}}},
+	}
+	fakeClient := fake.NewSimpleClientset(pod)
+	fakeClient.PrependReactor("patch", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(corev1.Resource("pods"), "p1", errors.New("denied"))
+	})
+	client.KubeClient = fakeClient
+	s := NewScheduler()
+	s.kubeClient = fakeClient
+	s.eventRecorder = record.NewFakeRecorder(10)
+	s.addNode("node1", &util.NodeInfo{
+		ID:      "node1",
+		Node:    &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}},
+		Devices: []util.DeviceInfo{{ID: "GPU-0", Count: 10, Devmem: 8000, Devcore: 100, Type: nvidia.NvidiaGPUDevice, Health: true}},
+	})
+	assert.NilError(t, s.reservations.hold("token", []*podInfo{{NodeID: "node1"}}, time.Now().Add(time.Minute)))
+
+	_, err := s.Filter(extenderv1.ExtenderArgs{Pod: pod, NodeNames: &[]string{"node1"}})
+	assert.Assert(t, err != nil)
+	// Neither the devices nor the placement, nor the reservation of the pod are taken.
+	_, ok := s.getPod(pod.UID)
+	assert.Assert(t, !ok)
+	_, ok = s.sticky.lookup(pod)
+	assert.Assert(t, !ok)
+	assert.Equal(t, len(s.reservations.ListPodsInfo("", time.Now())), 1)
+}
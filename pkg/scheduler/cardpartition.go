@@ -0,0 +1,78 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// cardPartitions are the card partitions of a node as seen by one pod.
+type cardPartitions struct {
+	all []device.CardPartition
+	// own is the partition of the pod, the first one selecting it, nil if none does.
+	own *device.CardPartition
+}
+
+// nodeCardPartitions returns the card partitions of node for pod.
+func nodeCardPartitions(node *corev1.Node, pod *corev1.Pod) cardPartitions {
+	if node == nil {
+		return cardPartitions{}
+	}
+	parts := cardPartitions{all: device.NodeCardPartitions(node.Name)}
+	if pod == nil {
+		return parts
+	}
+	for i, p := range parts.all {
+		if p.Selects(pod.Namespace, pod.Labels) {
+			parts.own = &parts.all[i]
+			break
+		}
+	}
+	return parts
+}
+
+// allows reports whether d may go to the pod: a card of its own partition, or a card of no
+// partition if the pod has none.
+func (parts cardPartitions) allows(d *util.DeviceUsage) bool {
+	if parts.own != nil {
+		return parts.own.HasCard(d.Index, d.ID)
+	}
+	for _, p := range parts.all {
+		if p.HasCard(d.Index, d.ID) {
+			return false
+		}
+	}
+	return true
+}
+
+// rejection returns why the cards of the node the pod may use don't fit it.
+func (parts cardPartitions) rejection() string {
+	if parts.own != nil {
+		return fmt.Sprintf("card partition %s is full", parts.own.Name)
+	}
+	names := make([]string, 0, len(parts.all))
+	for _, p := range parts.all {
+		names = append(names, p.Name)
+	}
+	return fmt.Sprintf("the cards outside of card partitions %s are full", strings.Join(names, ","))
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/policy"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func Test_calcScoreCardPartitions(t *testing.T) {
+	prev := device.ActiveConfig()
+	initTFLOPSDevices(t)
+	defer func() { assert.NilError(t, device.InitDevicesWithConfig(prev)) }()
+	cfg := *device.ActiveConfig()
+	cfg.CardPartitions = []device.CardPartition{
+		{Name: "team-a", Nodes: []string{"node1"}, Index: []uint{0, 1}, Namespaces: []string{"team-a"}},
+		{Name: "team-b", Nodes: []string{"node1"}, UUIDs: []string{"GPU-2"}, PodLabels: map[string]string{"team": "b"}},
+	}
+	assert.NilError(t, device.InitDevicesWithConfig(&cfg))
+
+	// Cards 0 and 1 are team-a's, card 2 team-b's and card 3 is shared. fullCards are in use
+	// up to their memory.
+	newNodes := func(fullCards ...int) map[string]*NodeUsage {
+		devs := make([]*policy.DeviceListsScore, 0, 4)
+		for i := range 4 {
+			d := &util.DeviceUsage{ID: fmt.Sprintf("GPU-%d", i), Index: uint(i), Type: "NVIDIA-A100", Count: 10, Totalmem: 8000 * util.MiB, Totalcore: 100, Health: true}
+			for _, full := range fullCards {
+				if full == i {
+					d.Usedmem, d.Used = 8000*util.MiB, 1
+				}
+			}
+			devs = append(devs, &policy.DeviceListsScore{Device: d})
+		}
+		return map[string]*NodeUsage{"node1": {
+			Node:    &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}},
+			Devices: policy.DeviceUsageList{Policy: util.GPUSchedulerPolicySpread.String(), DeviceLists: devs},
+		}}
+	}
+	nums := util.PodDeviceRequests{{nvidia.NvidiaGPUDevice: util.ContainerDeviceRequest{Nums: 1, Type: nvidia.NvidiaGPUDevice, Memreq: 1000 * util.MiB, Coresreq: 10}}}
+	place := func(pod *corev1.Pod, fullCards ...int) (string, map[string]string) {
+		nodes := newNodes(fullCards...)
+		failedNodes := map[string]string{}
+		res, err := NewScheduler().calcScore(&nodes, nums, nil, pod, failedNodes)
+		assert.NilError(t, err)
+		if len(res.NodeList) == 0 {
+			return "", failedNodes
+		}
+		return res.NodeList[0].Devices[nvidia.NvidiaGPUDevice][0][0].UUID, failedNodes
+	}
+	teamA := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "team-a"}}
+	teamB := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "default", Labels: map[string]string{"team": "b"}}}
+	other := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "c", Namespace: "default"}}
+
+	card, _ := place(teamA, 0)
+	assert.Equal(t, card, "GPU-1")
+	card, _ = place(teamB)
+	assert.Equal(t, card, "GPU-2")
+	card, _ = place(other)
+	assert.Equal(t, card, "GPU-3")
+
+	card, failed := place(teamA, 0, 1)
+	assert.Equal(t, card, "")
+	assert.Equal(t, failed["node1"], "node not fit pod, card partition team-a is full")
+	card, failed = place(other, 3)
+	assert.Equal(t, card, "")
+	assert.Equal(t, failed["node1"], "node not fit pod, the cards outside of card partitions team-a,team-b are full")
+
+	// Nodes without partitions are not restricted.
+	nodes := newNodes()
+	nodes["node1"].Node.Name = "node2"
+	res, err := NewScheduler().calcScore(&nodes, nums, nil, teamA, map[string]string{})
+	assert.NilError(t, err)
+	assert.Equal(t, len(res.NodeList), 1)
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	k8stypes "k8s.io/apimachinery/pkg/types"
+
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// ErrCardNotFound is wrapped by the errors of CardPods for an unknown node or card.
+var ErrCardNotFound = errors.New("card not found")
+
+const (
+	// CardHolderPod is a pod the scheduler placed on the card.
+	CardHolderPod = "Pod"
+	// CardHolderResourceClaim is a DRA ResourceClaim allocated on the card.
+	CardHolderResourceClaim = "ResourceClaim"
+	// CardHolderReservation is a pod of a reservation not created yet.
+	CardHolderReservation = "Reservation"
+)
+
+// CardHolder is a pod, or another holder of capacity, sharing a card.
+type CardHolder struct {
+	// Kind is CardHolderPod, CardHolderResourceClaim or CardHolderReservation.
+	Kind      string       `json:"kind"`
+	Namespace string       `json:"namespace"`
+	Name      string       `json:"name"`
+	UID       k8stypes.UID `json:"uid"`
+	// Containers counts the containers of the pod on the card.
+	Containers int `json:"containers"`
+	// Memory is the memory reserved on the card in MiB, Cores the percentage of its cores.
+	Memory int64 `json:"memory"`
+	Cores  int32 `json:"cores"`
+	// Soft is set for pods of the soft GPU tier, whose memory doesn't count against the card.
+	Soft bool `json:"soft,omitempty"`
+	// AddedAt is when the scheduler started accounting for the holder.
+	AddedAt time.Time `json:"addedAt"`
+}
+
+// CardPods is what currently holds a card, to know what cordoning it affects.
+type CardPods struct {
+	Node   string `json:"node"`
+	Device string `json:"device"`
+	Type   string `json:"type"`
+	// Memory is the memory of the card in MiB, Cores the percentage of its cores it advertises.
+	Memory  int64        `json:"memory"`
+	Cores   int32        `json:"cores"`
+	Holders []CardHolder `json:"holders"`
+}
+
+// CardPods returns the pods, DRA claims and reservations holding the card with uuid on nodeID,
+// oldest first. MIG instances of the card count as the card.
+func (s *Scheduler) CardPods(nodeID, uuid string) (*CardPods, error) {
+	node, err := s.GetNode(nodeID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: node %s is not registered", ErrCardNotFound, nodeID)
+	}
+	var res *CardPods
+	for _, d := range node.Devices {
+		if d.ID == uuid {
+			res = &CardPods{Node: nodeID, Device: uuid, Type: d.Type, Memory: util.MemoryToBytes(d.DeviceVendor, int64(d.Devmem)) / util.MiB, Cores: d.Devcore, Holders: []CardHolder{}}
+			break
+		}
+	}
+	if res == nil {
+		return nil, fmt.Errorf("%w: node %s has no card %s", ErrCardNotFound, nodeID, uuid)
+	}
+	add := func(kind string, pods []*podInfo) {
+		for _, p := range pods {
+			if p.NodeID != nodeID {
+				continue
+			}
+			holder := CardHolder{Kind: kind, Namespace: p.Namespace, Name: p.Name, UID: p.UID, Soft: p.Soft, AddedAt: p.AddedAt}
+			for _, podSingle := range p.Devices {
+				for _, ctrdevs := range podSingle {
+					found := false
+					for _, udevice := range ctrdevs {
+						if strings.Split(udevice.UUID, "[")[0] != uuid {
+							continue
+						}
+						found = true
+						holder.Memory += udevice.Usedmem / util.MiB
+						holder.Cores += udevice.Usedcores
+					}
+					if found {
+						holder.Containers++
+					}
+				}
+			}
+			if holder.Containers > 0 {
+				res.Holders = append(res.Holders, holder)
+			}
+		}
+	}
+	add(CardHolderPod, s.ListPodsInfo())
+	if s.draClaims != nil {
+		add(CardHolderResourceClaim, s.draClaims.ListPodsInfo())
+	}
+	add(CardHolderReservation, s.reservations.ListPodsInfo("", time.Now()))
+	sort.SliceStable(res.Holders, func(i, j int) bool {
+		return res.Holders[i].AddedAt.Before(res.Holders[j].AddedAt)
+	})
+	return res, nil
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func TestCardPods(t *testing.T) {
+	s := gpuHealthScheduler(true, true)
+	ctr := func(uuid string, mem int64, cores int32) util.ContainerDevices {
+		return util.ContainerDevices{{UUID: uuid, Type: nvidia.NvidiaGPUDevice, Usedmem: mem * util.MiB, Usedcores: cores}}
+	}
+	pod := func(name string) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, UID: k8stypes.UID("uid-" + name)}}
+	}
+	s.addPod(pod("train"), "node1", util.PodDevices{nvidia.NvidiaGPUDevice: {ctr("GPU0", 2000, 30), ctr("GPU0", 1000, 10), ctr("GPU1", 500, 0)}})
+	time.Sleep(time.Millisecond)
+	s.addPod(pod("infer"), "node1", util.PodDevices{nvidia.NvidiaGPUDevice: {ctr("GPU0[1g.10gb]", 1000, 0)}})
+	s.addPod(pod("other"), "node1", util.PodDevices{nvidia.NvidiaGPUDevice: {ctr("GPU1", 500, 0)}})
+	assert.NilError(t, s.reservations.hold("batch", []*podInfo{{Name: "worker", NodeID: "node1", Devices: util.PodDevices{nvidia.NvidiaGPUDevice: {ctr("GPU0", 100, 5)}}, AddedAt: time.Now()}}, time.Now().Add(time.Minute)))
+
+	res, err := s.CardPods("node1", "GPU0")
+	assert.NilError(t, err)
+	assert.Equal(t, res.Memory, int64(8000))
+	assert.Equal(t, res.Type, nvidia.NvidiaGPUDevice)
+	assert.DeepEqual(t, res.Holders, []CardHolder{
+		{Kind: CardHolderPod, Namespace: "default", Name: "train", UID: "uid-train", Containers: 2, Memory: 3000, Cores: 40, AddedAt: res.Holders[0].AddedAt},
+		{Kind: CardHolderPod, Namespace: "default", Name: "infer", UID: "uid-infer", Containers: 1, Memory: 1000, AddedAt: res.Holders[1].AddedAt},
+		{Kind: CardHolderReservation, Name: "worker", Containers: 1, Memory: 100, Cores: 5, AddedAt: res.Holders[2].AddedAt},
+	})
+
+	_, err = s.CardPods("node1", "GPU9")
+	assert.Assert(t, errors.Is(err, ErrCardNotFound))
+	_, err = s.CardPods("node9", "GPU0")
+	assert.Assert(t, errors.Is(err, ErrCardNotFound))
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// matchesShape reports whether an allocation of memreq and coresreq on d has the shape.
+func matchesShape(shape device.CardRuleShape, d *util.DeviceUsage, memreq int64, coresreq int32) bool {
+	if coresreq < shape.MinCores {
+		return false
+	}
+	return shape.MinMemoryFraction == 0 || (d.Totalmem > 0 && float64(memreq) >= shape.MinMemoryFraction*float64(d.Totalmem))
+}
+
+// checkCardRule returns why rule forbids allocating memreq and coresreq on d, or "" if it doesn't.
+func checkCardRule(rule device.CardRule, d *util.DeviceUsage, memreq int64, coresreq int32) string {
+	if !rule.AppliesTo(d.Type) {
+		return ""
+	}
+	if rule.MaxMemoryFraction > 0 && float64(d.Usedmem+memreq) > rule.MaxMemoryFraction*float64(d.Totalmem) {
+		return fmt.Sprintf("card rule %s: reserved memory would reach %d of %d MiB, at most %.0f%% allowed",
+			rule.Name, (d.Usedmem+memreq)/util.MiB, d.Totalmem/util.MiB, rule.MaxMemoryFraction*100)
+	}
+	if rule.MaxCores > 0 && d.Usedcores+coresreq > rule.MaxCores {
+		return fmt.Sprintf("card rule %s: reserved cores would reach %d, at most %d allowed", rule.Name, d.Usedcores+coresreq, rule.MaxCores)
+	}
+	if rule.MaxCount > 0 && matchesShape(rule.Shape, d, memreq, coresreq) {
+		count := int32(1)
+		for _, a := range d.Allocations {
+			if matchesShape(rule.Shape, d, a.Usedmem, a.Usedcores) {
+				count++
+			}
+		}
+		if count > rule.MaxCount {
+			return fmt.Sprintf("card rule %s: %d matching allocations would share the card, at most %d allowed", rule.Name, count, rule.MaxCount)
+		}
+	}
+	return ""
+}
+
+// checkCardRules returns why the card rules forbid allocating memreq and coresreq on d, or "" if none does.
+func checkCardRules(d *util.DeviceUsage, memreq int64, coresreq int32) string {
+	for _, rule := range device.CardRules() {
+		if reason := checkCardRule(rule, d, memreq, coresreq); reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
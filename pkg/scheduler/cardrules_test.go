@@ -0,0 +1,123 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/policy"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func Test_checkCardRule(t *testing.T) {
+	card := func(usedmem int64, usedcores int32, allocs ...util.ContainerDevice) *util.DeviceUsage {
+		return &util.DeviceUsage{ID: "GPU-0", Type: "NVIDIA-A100", Count: 10, Totalmem: 10240 * util.MiB, Totalcore: 100,
+			Used: int32(len(allocs)), Usedmem: usedmem, Usedcores: usedcores, Allocations: allocs}
+	}
+	tests := []struct {
+		name     string
+		rule     device.CardRule
+		d        *util.DeviceUsage
+		memreq   int64
+		coresreq int32
+		want     string
+	}{
+		{
+			name:   "memory fraction leaves headroom",
+			rule:   device.CardRule{Name: "headroom", MaxMemoryFraction: 0.8},
+			d:      card(6144*util.MiB, 0),
+			memreq: 2048 * util.MiB,
+		},
+		{
+			name:   "memory fraction exceeded",
+			rule:   device.CardRule{Name: "headroom", MaxMemoryFraction: 0.8},
+			d:      card(6144*util.MiB, 0),
+			memreq: 2049 * util.MiB,
+			want:   "card rule headroom: reserved memory would reach 8193 of 10240 MiB, at most 80% allowed",
+		},
+		{
+			name:     "cores exceeded",
+			rule:     device.CardRule{Name: "cores", MaxCores: 80},
+			d:        card(0, 60),
+			coresreq: 30,
+			want:     "card rule cores: reserved cores would reach 90, at most 80 allowed",
+		},
+		{
+			name:     "count by shape exceeded",
+			rule:     device.CardRule{Name: "full-core", MaxCount: 2, Shape: device.CardRuleShape{MinCores: 100}},
+			d:        card(0, 200, util.ContainerDevice{Usedcores: 100}, util.ContainerDevice{Usedcores: 100}, util.ContainerDevice{Usedcores: 10}),
+			coresreq: 100,
+			want:     "card rule full-core: 3 matching allocations would share the card, at most 2 allowed",
+		},
+		{
+			name:     "count ignores other shapes",
+			rule:     device.CardRule{Name: "full-core", MaxCount: 2, Shape: device.CardRuleShape{MinCores: 100}},
+			d:        card(0, 200, util.ContainerDevice{Usedcores: 100}, util.ContainerDevice{Usedcores: 100}),
+			coresreq: 10,
+		},
+		{
+			name:   "count by memory shape",
+			rule:   device.CardRule{Name: "large", MaxCount: 1, Shape: device.CardRuleShape{MinMemoryFraction: 0.5}},
+			d:      card(5120*util.MiB, 0, util.ContainerDevice{Usedmem: 5120 * util.MiB}),
+			memreq: 5120 * util.MiB,
+			want:   "card rule large: 2 matching allocations would share the card, at most 1 allowed",
+		},
+		{
+			name:     "other card types",
+			rule:     device.CardRule{Name: "t4", Types: []string{"T4"}, MaxCores: 10},
+			d:        card(0, 60),
+			coresreq: 30,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, checkCardRule(test.rule, test.d, test.memreq, test.coresreq), test.want)
+		})
+	}
+}
+
+func Test_fitInCertainDeviceCardRules(t *testing.T) {
+	cfg := &device.Config{
+		NvidiaConfig: nvidia.NvidiaConfig{
+			ResourceCountName:            "hami.io/gpu",
+			ResourceMemoryName:           "hami.io/gpumem",
+			ResourceMemoryPercentageName: "hami.io/gpumem-percentage",
+			ResourceCoreName:             "hami.io/gpucores",
+			DefaultGPUNum:                1,
+		},
+		CardRules: []device.CardRule{{Name: "headroom", MaxMemoryFraction: 0.5}},
+	}
+	prev := device.ActiveConfig()
+	assert.NilError(t, device.InitDevicesWithConfig(cfg))
+	defer func() { assert.NilError(t, device.InitDevicesWithConfig(prev)) }()
+	node := &NodeUsage{Devices: policy.DeviceUsageList{DeviceLists: []*policy.DeviceListsScore{
+		{Device: &util.DeviceUsage{ID: "GPU-0", Type: "NVIDIA-A100", Count: 10, Totalmem: 10240, Totalcore: 100}},
+	}}}
+	request := util.ContainerDeviceRequest{Nums: 1, Type: nvidia.NvidiaGPUDevice, Memreq: 6144, MemPercentagereq: 101}
+	fit, _ := fitInCertainDevice(node, request, nil, &corev1.Pod{}, &util.PodDevices{})
+	assert.Equal(t, fit, false)
+	assert.Assert(t, node.cardRuleRejection != "")
+
+	// Whole cards aren't subject to card rules.
+	fit, _ = fitInCertainDevice(node, request, map[string]string{util.Exclusive: "true"}, &corev1.Pod{}, &util.PodDevices{})
+	assert.Equal(t, fit, true)
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// cardSpan returns the number of distinct cards the devices of pd are on. MIG instances
+// count as the card they are carved from.
+func cardSpan(pd util.PodDevices) int {
+	cards := make(map[string]bool)
+	for _, podSingle := range pd {
+		for _, ctrdevs := range podSingle {
+			for _, udevice := range ctrdevs {
+				if udevice.UUID != "" {
+					cards[strings.Split(udevice.UUID, "[")[0]] = true
+				}
+			}
+		}
+	}
+	return len(cards)
+}
+
+// cardSpanExceeded returns why the devices of pd may not be allocated to a single pod with
+// --max-cards-per-pod, or "" if they may.
+func cardSpanExceeded(pd util.PodDevices) string {
+	if config.MaxCardsPerPod <= 0 {
+		return ""
+	}
+	if n := cardSpan(pd); n > config.MaxCardsPerPod {
+		return fmt.Sprintf("pod would span %d cards, at most %d are allowed per pod", n, config.MaxCardsPerPod)
+	}
+	return ""
+}
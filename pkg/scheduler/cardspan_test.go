@@ -0,0 +1,71 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/policy"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func Test_cardSpan(t *testing.T) {
+	pd := util.PodDevices{nvidia.NvidiaGPUDevice: util.PodSingleDevice{
+		{{UUID: "GPU-0"}, {UUID: "GPU-1"}},
+		{{UUID: "GPU-1"}, {UUID: "GPU-2[1g.10gb-0]"}},
+		{{}},
+	}}
+	assert.Equal(t, cardSpan(pd), 3)
+	assert.Equal(t, cardSpan(util.PodDevices{}), 0)
+}
+
+func Test_calcScoreMaxCardsPerPod(t *testing.T) {
+	defer func(prev int) { config.MaxCardsPerPod = prev }(config.MaxCardsPerPod)
+	newNodes := func() map[string]*NodeUsage {
+		devices := policy.DeviceUsageList{Policy: util.GPUSchedulerPolicySpread.String()}
+		for i := range 8 {
+			devices.DeviceLists = append(devices.DeviceLists, &policy.DeviceListsScore{Device: &util.DeviceUsage{
+				ID: fmt.Sprintf("GPU-%d", i), Type: nvidia.NvidiaGPUDevice, Count: 10, Totalmem: 8000, Totalcore: 100, Health: true,
+			}})
+		}
+		return map[string]*NodeUsage{"node1": {Node: &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}, Devices: devices}}
+	}
+	// Six cards would be spread over by the request.
+	nums := util.PodDeviceRequests{{nvidia.NvidiaGPUDevice: util.ContainerDeviceRequest{Nums: 6, Type: nvidia.NvidiaGPUDevice, Memreq: 1000, Coresreq: 10}}}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "sprawl", Namespace: "default"}}
+
+	config.MaxCardsPerPod = 0
+	nodes := newNodes()
+	res, err := NewScheduler().calcScore(&nodes, nums, nil, pod, map[string]string{})
+	assert.NilError(t, err)
+	assert.Equal(t, len(res.NodeList), 1)
+
+	config.MaxCardsPerPod = 4
+	nodes = newNodes()
+	failedNodes := map[string]string{}
+	res, err = NewScheduler().calcScore(&nodes, nums, nil, pod, failedNodes)
+	assert.NilError(t, err)
+	assert.Equal(t, len(res.NodeList), 0)
+	assert.Equal(t, failedNodes["node1"], "pod would span 6 cards, at most 4 are allowed per pod")
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// expandDeviceClass turns the hami.io/class annotations of pod into the NVIDIA device resources
+// of the containers they target, and the card types of the classes into nvidia.com/use-gputype.
+// The card types apply to the whole pod, so all classes of a pod must agree on them.
+func expandDeviceClass(pod *corev1.Pod) error {
+	targets, err := annotatedContainers(pod, util.DeviceClass, util.DeviceClassPrefix)
+	if err != nil || len(targets) == 0 {
+		return err
+	}
+	shorthands, err := annotatedContainers(pod, util.GPUShorthand, util.GPUShorthandPrefix)
+	if err != nil {
+		return err
+	}
+	dev, ok := device.GetDevices()[nvidia.NvidiaGPUDevice].(*nvidia.NvidiaGPUDevices)
+	if !ok {
+		return fmt.Errorf("annotation %s needs the NVIDIA device to be enabled", util.DeviceClass)
+	}
+	types, typesFrom := "", ""
+	for idx := range pod.Spec.Containers {
+		c := &pod.Spec.Containers[idx]
+		name, ok := targets[c.Name]
+		if !ok {
+			continue
+		}
+		if _, ok := shorthands[c.Name]; ok {
+			return fmt.Errorf("container %s: %s and %s are exclusive", c.Name, util.DeviceClass, util.GPUShorthand)
+		}
+		class, ok := dev.DeviceClass(strings.TrimSpace(name))
+		if !ok {
+			return fmt.Errorf("container %s: unknown device class %q, known classes are [%s]", c.Name, name, strings.Join(dev.DeviceClassNames(), ", "))
+		}
+		req := gpuShorthand{count: max(int64(class.Count), 1), memMiB: int64(class.Memory), memPercentage: int64(class.MemoryPercentage), cores: int64(class.Cores)}
+		if err := setGPUResources(c, dev, req, util.DeviceClass); err != nil {
+			return err
+		}
+		classTypes := strings.Join(class.Types, ",")
+		if typesFrom != "" && classTypes != types {
+			return fmt.Errorf("device classes %s and %s select different card types, which can't be combined in one pod", typesFrom, class.Name)
+		}
+		types, typesFrom = classTypes, class.Name
+	}
+	if types == "" {
+		return nil
+	}
+	if inuse, ok := pod.Annotations[nvidia.GPUInUse]; ok && inuse != types {
+		return fmt.Errorf("device class %s selects the card types %s, which conflicts with %s=%s", typesFrom, types, nvidia.GPUInUse, inuse)
+	}
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[nvidia.GPUInUse] = types
+	return nil
+}
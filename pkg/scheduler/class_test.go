@@ -0,0 +1,79 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func Test_expandDeviceClass(t *testing.T) {
+	newPod := func(annos map[string]string, ctrs ...corev1.Container) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "p1", Annotations: annos}, Spec: corev1.PodSpec{Containers: ctrs}}
+	}
+	limit := func(pod *corev1.Pod, idx int, name string) string {
+		q, ok := pod.Spec.Containers[idx].Resources.Limits[corev1.ResourceName(name)]
+		if !ok {
+			return ""
+		}
+		return q.String()
+	}
+
+	pod := newPod(map[string]string{util.DeviceClass: "inference-small"}, corev1.Container{Name: "main"})
+	assert.NilError(t, expandDeviceClass(pod))
+	assert.Equal(t, limit(pod, 0, "hami.io/gpu"), "1")
+	assert.Equal(t, limit(pod, 0, "hami.io/gpumem"), "4096")
+	assert.Equal(t, limit(pod, 0, "hami.io/gpucores"), "25")
+	assert.Equal(t, pod.Annotations[nvidia.GPUInUse], "T4")
+
+	pod = newPod(map[string]string{util.DeviceClassPrefix + "train": "training", util.DeviceClassPrefix + "eval": "training"},
+		corev1.Container{Name: "train"}, corev1.Container{Name: "eval"}, corev1.Container{Name: "sidecar"})
+	assert.NilError(t, expandDeviceClass(pod))
+	assert.Equal(t, limit(pod, 0, "hami.io/gpu"), "2")
+	assert.Equal(t, limit(pod, 1, "hami.io/gpumem-percentage"), "100")
+	assert.Equal(t, len(pod.Spec.Containers[2].Resources.Limits), 0)
+	assert.Equal(t, pod.Annotations[nvidia.GPUInUse], "A100,H100")
+
+	// A class without card types leaves the type constraint of the pod alone.
+	pod = newPod(map[string]string{util.DeviceClass: "any-half", nvidia.GPUInUse: "V100"}, corev1.Container{Name: "main"})
+	assert.NilError(t, expandDeviceClass(pod))
+	assert.Equal(t, limit(pod, 0, "hami.io/gpumem-percentage"), "50")
+	assert.Equal(t, pod.Annotations[nvidia.GPUInUse], "V100")
+
+	tests := []struct {
+		name string
+		pod  *corev1.Pod
+		err  string
+	}{
+		{name: "unknown class", pod: newPod(map[string]string{util.DeviceClass: "inference-large"}, corev1.Container{Name: "a"}), err: `unknown device class "inference-large", known classes are [inference-small, training, any-half]`},
+		{name: "ambiguous", pod: newPod(map[string]string{util.DeviceClass: "training"}, corev1.Container{Name: "a"}, corev1.Container{Name: "b"}), err: "ambiguous"},
+		{name: "with shorthand", pod: newPod(map[string]string{util.DeviceClass: "training", util.GPUShorthand: "count=1"}, corev1.Container{Name: "a"}), err: "exclusive"},
+		{name: "different types", pod: newPod(map[string]string{util.DeviceClassPrefix + "a": "training", util.DeviceClassPrefix + "b": "inference-small"}, corev1.Container{Name: "a"}, corev1.Container{Name: "b"}), err: "different card types"},
+		{name: "conflicting type annotation", pod: newPod(map[string]string{util.DeviceClass: "training", nvidia.GPUInUse: "T4"}, corev1.Container{Name: "a"}), err: "conflicts with nvidia.com/use-gputype=T4"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.ErrorContains(t, expandDeviceClass(test.pod), test.err)
+		})
+	}
+}
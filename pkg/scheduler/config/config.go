@@ -16,7 +16,11 @@ limitations under the License.
 
 package config
 
-import "github.com/Project-HAMi/HAMi/pkg/util"
+import (
+	"time"
+
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
 
 var (
 	QPS                float32
@@ -36,4 +40,200 @@ var (
 
 	// NodeLabelSelector is scheduler filter node by node label.
 	NodeLabelSelector map[string]string
+
+	// ImageLocalityWeight is the weight of the soft score preferring nodes that already have the pod's images. 0 disables it.
+	ImageLocalityWeight float64
+
+	// PerfTierWeight is the weight of the soft score steering latency-sensitive pods to higher performance tier cards.
+	PerfTierWeight float64
+	// UtilizationWeight is the weight of the soft score steering latency-sensitive pods to less utilized cards. 0 disables it.
+	UtilizationWeight float64
+	// UtilizationMaxAge is how old a utilization sample may be before the score ignores it.
+	UtilizationMaxAge time.Duration
+	// PCIeContentionWeight is the weight of the soft score steering bandwidth-heavy pods to PCIe switches
+	// with fewer other bandwidth-heavy pods. 0 disables it.
+	PCIeContentionWeight float64
+	// NoiseToleranceWeight is the weight of the soft score steering pods with a low
+	// hami.io/noise-tolerance to cards with fewer and less busy co-tenants. 0 disables it.
+	NoiseToleranceWeight float64
+	// MemoryTypeWeight is the weight of the soft score steering pods to cards with the memory type
+	// of their hami.io/preferred-gpu-memory-type. 0 disables it.
+	MemoryTypeWeight float64
+	// ECCErrorWeight is the weight of the soft score steering pods to cards with fewer recent ECC
+	// errors. 0 disables it.
+	ECCErrorWeight float64
+	// ECCCorrectedThreshold and ECCUncorrectedThreshold are the recent corrected and uncorrected
+	// ECC errors from which a card takes no new pods. 0 disables them.
+	ECCCorrectedThreshold   int
+	ECCUncorrectedThreshold int
+	// PerformanceStateWeight is the weight of the soft score steering pods annotated with
+	// hami.io/latency-sensitive to cards in a high performance state. 0 disables it.
+	PerformanceStateWeight float64
+	// GPUTemperatureThreshold is the temperature in degrees Celsius from which a card takes no
+	// new pods. 0 disables it.
+	GPUTemperatureThreshold int
+	// GPUTemperatureSoftThreshold is the temperature in degrees Celsius above which cards are
+	// avoided, the more the hotter, weighted by GPUTemperatureWeight. 0 disables it.
+	GPUTemperatureSoftThreshold int
+	GPUTemperatureWeight        float64
+
+	// ExtenderMaxConcurrency is the number of filter requests served at the same time. 0 disables the limit.
+	ExtenderMaxConcurrency int
+	// ExtenderMaxQueue is the number of requests allowed to wait for a free slot before being rejected.
+	ExtenderMaxQueue int
+	// ExtenderQueueTimeout is how long a request may wait for a free slot before being rejected.
+	ExtenderQueueTimeout time.Duration
+
+	// StickyPlacementTTL is how long the last placement of a deleted sticky pod is remembered.
+	StickyPlacementTTL time.Duration
+
+	// FabricNodeLabel is the node label holding the interconnect fabric, it takes precedence over
+	// the fabric detected by the device plugin.
+	FabricNodeLabel string
+
+	// MetricsSidecarImage is the image of the per-pod GPU metrics sidecar. Empty disables injection.
+	MetricsSidecarImage string
+	// MetricsSidecarArgs are the arguments passed to the metrics sidecar.
+	MetricsSidecarArgs []string
+	// MetricsSidecarNamespaces are the namespaces where the sidecar is injected unless a pod opts out.
+	MetricsSidecarNamespaces []string
+
+	// IsolatedNamespaces are the namespaces whose pods share cards only with pods of the same
+	// namespace, unless a pod opts out with hami.io/namespace-isolation.
+	IsolatedNamespaces []string
+	// MetricsSidecarCacheHostPath is the host directory the device plugin keeps per-container HAMi-core caches in.
+	MetricsSidecarCacheHostPath string
+
+	// AMDGPUTranslationNamespaces are the namespaces where the amd.com/gpu resources of pods are
+	// translated into whole Hygon DCUs.
+	AMDGPUTranslationNamespaces []string
+
+	// AuditSinkURL is the endpoint allocation/release audit records are sent to. Empty disables auditing.
+	AuditSinkURL string
+	// AuditSinkType is `webhook` or `kafka-rest`.
+	AuditSinkType string
+	// AuditKafkaTopic is the topic used when AuditSinkType is `kafka-rest`.
+	AuditKafkaTopic string
+	// AuditBufferSize is the number of undelivered audit records kept.
+	AuditBufferSize int
+	// AuditSpoolPath is the file undelivered audit records are kept in across restarts. Empty
+	// keeps them in memory only.
+	AuditSpoolPath string
+
+	// ProfileConfigFile holds the HAMi policies of kube-scheduler profiles. Empty applies the global policy to every pod.
+	ProfileConfigFile string
+
+	// DriftCheckInterval is how often recorded allocations are checked against the advertised capacity. 0 disables it.
+	DriftCheckInterval time.Duration
+	// DriftAutoCorrect lets the drift check refresh the capacity and release allocations of pods which no longer exist.
+	DriftAutoCorrect bool
+
+	// DecisionCacheSize is the number of recent scheduling decisions kept for the debug endpoint. 0 disables it.
+	DecisionCacheSize int
+
+	// ReservationMaxTTL is the longest a reservation holds capacity for pods not created yet. 0
+	// disables reservations.
+	ReservationMaxTTL time.Duration
+	// ResumeReservationTTL is how long the capacity of the pods of a GPU workload resumed after
+	// being suspended or scaled to zero is held for them. 0 disables it.
+	ResumeReservationTTL time.Duration
+
+	// FilterRecordFile is where every filter request and its outcome is written for replay, "-"
+	// for the scheduler log. Empty disables it.
+	FilterRecordFile string
+	// FilterRecordRedact are the pod fields redacted in the filter records: env, command, image,
+	// labels or annotation keys.
+	FilterRecordRedact []string
+
+	// BindRetryCount is how often a bind failing with a conflict, a held node lock or a transient
+	// API server error is retried before the pod goes back to kube-scheduler. 0 disables retries.
+	BindRetryCount int
+	// BindRetryBackoff is the wait before the first bind retry, doubled on every further one.
+	BindRetryBackoff time.Duration
+	// BindRetryBudget is how long binds, and the writes of the filter, are tried again while the
+	// API server is unreachable, on top of BindRetryCount.
+	BindRetryBudget time.Duration
+	// NodeLockCoalesceWindow is how long the release of the node locks of a failed bind is
+	// deferred, so a retry of the pod or the next pod on the node within it doesn't write the node twice.
+	// 0 releases them right away.
+	NodeLockCoalesceWindow time.Duration
+
+	// CompactDeviceAnnotations writes the devices assigned to pods gzip compressed. Enable it
+	// once every device plugin of the cluster reads the compact format.
+	CompactDeviceAnnotations bool
+	// DeviceAnnotationOverflowSize is the size in bytes above which the devices assigned to a pod
+	// are kept in a ConfigMap of its node instead of the annotation. 0 keeps them on the pod.
+	DeviceAnnotationOverflowSize int
+	// DeviceAnnotationOverflowNamespace is the namespace of the ConfigMaps of DeviceAnnotationOverflowSize.
+	DeviceAnnotationOverflowNamespace string
+
+	// EnableDRA accounts for the card slots kube-scheduler allocates to ResourceClaims from the HAMi DRA driver.
+	EnableDRA bool
+
+	// FairnessAgingWeight is the priority a pod waiting for devices gains per minute. A pod
+	// ahead of another by at least 1 keeps the room it fits into from being taken by the other. 0 disables it.
+	FairnessAgingWeight float64
+
+	// NVLinkFabricGate keeps pods with more than one NVIDIA GPU off nodes whose device plugin
+	// reports an unhealthy NVLink fabric. Pods with a single GPU are placed there regardless.
+	NVLinkFabricGate bool
+
+	// EventAggregationWindow is the time within which identical events on the same object are
+	// recorded once. It is also the interval of the client-go event correlator. 0 records every event.
+	EventAggregationWindow time.Duration
+
+	// GPUReclaim lets a pod which fits nowhere evict pods with a lower GPU reclaim priority
+	// from the node where the fewest of them have to go.
+	GPUReclaim bool
+	// GPUReclaimPriorityNamespaces are the namespaces whose pods may raise their GPU reclaim
+	// priority above their PriorityClass with the hami.io/gpu-reclaim-priority annotation.
+	GPUReclaimPriorityNamespaces []string
+
+	// TFLOPSRequests enables the experimental hami.io/tflops annotation, which requests the
+	// cores of a card by throughput instead of by percentage.
+	TFLOPSRequests bool
+
+	// MemoryOversubscriptionRatio is how many times the memory of a card pods of the best-effort
+	// GPU tier may reserve together with the others on the card. Values up to 1 disable it.
+	MemoryOversubscriptionRatio float64
+	// CoreOvercommit multiplies the cores every card registered, independently of the memory,
+	// e.g. 2 lets 200% of them be allocated. Scheduler profiles may override it, 0 keeps the cores.
+	CoreOvercommit float64
+
+	// MaxCardsPerPod is how many distinct cards the devices of a single pod may span. 0 is unlimited.
+	MaxCardsPerPod int
+
+	// CostCenters are the values of the hami.io/cost-center annotation the allocation metrics are
+	// labeled with, others are labeled "other". Empty leaves the metrics without cost centers.
+	CostCenters []string
+
+	// NodeExtendedResources publishes the memory and cores of every device type of a node, and
+	// the part of them allocated to pods, as extended resources of the node.
+	NodeExtendedResources bool
+
+	// DevicePluginVersionSkew is how many minor versions the device plugin of a node may be apart
+	// from the scheduler, with the same major version, for GPU pods to be placed on the node.
+	// Negative disables the check.
+	DevicePluginVersionSkew int
+
+	// GPUAllocationCRD publishes the devices and allocations of every node as a GPUAllocation
+	// custom resource, whose CRD must be installed.
+	GPUAllocationCRD bool
+
+	// GPUTypeFallbackAfter is how long a pod with hami.io/gpu-type-order waits for the cards of
+	// one type of its order before it also accepts the next one.
+	GPUTypeFallbackAfter time.Duration
+
+	// ZeroHealthyGPUPolicy is how nodes whose GPUs are all unhealthy are reported to
+	// kube-scheduler: "exclude" as unresolvable, "keep" as failed for the pod only.
+	ZeroHealthyGPUPolicy string
+
+	// GPUMemoryPadding is added by the webhook to every NVIDIA memory request, for the memory the
+	// CUDA context takes: a quantity like "256Mi", a percentage like "10%", or "0" for none.
+	GPUMemoryPadding string
+
+	// CUDAVersionCheck is what is done with pods whose hami.io/cuda-version the driver of a node
+	// doesn't support: "off" ignores it, "warn" records a warning on the pods placed there anyway,
+	// "filter" excludes the node.
+	CUDAVersionCheck string
 )
@@ -0,0 +1,232 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/k8sutil"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// Kinds of the inconsistencies the consistency audit finds.
+const (
+	// ConsistencyOverAllocation is a device with more recorded allocations than its node advertises.
+	ConsistencyOverAllocation = "over-allocation"
+	// ConsistencyOrphanAllocation is an allocation of a pod which no longer exists or terminated.
+	ConsistencyOrphanAllocation = "orphan-allocation"
+	// ConsistencyMissingAllocation is a live pod placed by HAMi whose allocation isn't recorded.
+	ConsistencyMissingAllocation = "missing-allocation"
+	// ConsistencyCapacityDrift is a device registered with another capacity than its node
+	// currently advertises, or registered or advertised only.
+	ConsistencyCapacityDrift = "capacity-drift"
+	// ConsistencyUnknownNode is an allocation on a node the scheduler doesn't know.
+	ConsistencyUnknownNode = "unknown-node"
+)
+
+// ConsistencyFinding is an inconsistency of the accounting of a node.
+type ConsistencyFinding struct {
+	Kind    string `json:"kind"`
+	Device  string `json:"device,omitempty"`
+	Pod     string `json:"pod,omitempty"`
+	Message string `json:"message"`
+	// Repaired is set if the repair mode fixed the inconsistency.
+	Repaired bool `json:"repaired,omitempty"`
+}
+
+// NodeConsistency is the outcome of the consistency audit of a node.
+type NodeConsistency struct {
+	Node       string               `json:"node"`
+	Consistent bool                 `json:"consistent"`
+	Findings   []ConsistencyFinding `json:"findings,omitempty"`
+}
+
+// ConsistencySummary sums up the consistency audit of the cluster.
+type ConsistencySummary struct {
+	Nodes             int            `json:"nodes"`
+	InconsistentNodes int            `json:"inconsistentNodes"`
+	Findings          map[string]int `json:"findings"`
+	Repaired          int            `json:"repaired"`
+}
+
+// ConsistencyReport is the outcome of the consistency audit of the cluster.
+type ConsistencyReport struct {
+	CheckedAt time.Time          `json:"checkedAt"`
+	Repair    bool               `json:"repair"`
+	Summary   ConsistencySummary `json:"summary"`
+	Nodes     []NodeConsistency  `json:"nodes"`
+}
+
+// CheckConsistency cross-checks the capacity the scheduler registered for every node with the
+// one the node currently advertises, the recorded allocations with the capacity and with the
+// live pods, and reports every inconsistency per node. With repair, it refreshes the capacity
+// of drifting nodes, releases the allocations of pods which no longer exist and records the
+// ones of live pods it missed, like the drift check. Allocations of live pods exceeding the
+// capacity are reported but never released.
+func (s *Scheduler) CheckConsistency(repair bool) (*ConsistencyReport, error) {
+	pods, err := s.podLister.List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %v", err)
+	}
+	nodes := s.nodeSnapshot()
+	findings := make(map[string][]ConsistencyFinding, len(nodes))
+	for nodeID := range nodes {
+		findings[nodeID] = []ConsistencyFinding{}
+	}
+	add := func(nodeID string, f ConsistencyFinding) {
+		findings[nodeID] = append(findings[nodeID], f)
+	}
+
+	for nodeID, info := range nodes {
+		drift := s.capacityDrift(info)
+		if repair && len(drift) > 0 {
+			klog.InfoS("Refreshing drifting node capacity", "node", nodeID)
+			s.refreshNodeDevices(nodeID)
+		}
+		for _, f := range drift {
+			f.Repaired = repair
+			add(nodeID, f)
+		}
+	}
+
+	live := make(map[k8stypes.UID]*corev1.Pod, len(pods))
+	for _, pod := range pods {
+		if !k8sutil.IsPodInTerminatedState(pod) {
+			live[pod.UID] = pod
+		}
+	}
+	recorded := s.ListPodsInfo()
+	for _, p := range recorded {
+		name := p.Namespace + "/" + p.Name
+		if _, ok := nodes[p.NodeID]; !ok {
+			add(p.NodeID, ConsistencyFinding{Kind: ConsistencyUnknownNode, Pod: name, Message: fmt.Sprintf("pod holds devices on node %s the scheduler doesn't know", p.NodeID)})
+		}
+		if _, ok := live[p.UID]; ok {
+			continue
+		}
+		f := ConsistencyFinding{Kind: ConsistencyOrphanAllocation, Pod: name, Message: fmt.Sprintf("pod %s recorded since %s no longer exists or terminated", p.UID, p.AddedAt.Format(time.RFC3339))}
+		if repair {
+			klog.InfoS("Releasing orphan allocation", "pod", klog.KRef(p.Namespace, p.Name), "uid", p.UID, "node", p.NodeID)
+			s.releasePod(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: p.Namespace, Name: p.Name, UID: p.UID}})
+			f.Repaired = true
+		}
+		add(p.NodeID, f)
+	}
+	for _, pod := range live {
+		nodeID, ok := pod.Annotations[util.AssignedNodeAnnotations]
+		if !ok {
+			continue
+		}
+		if _, ok := s.getPod(pod.UID); ok {
+			continue
+		}
+		podDev, err := util.DecodePodDevices(util.SupportDevices, pod.Annotations)
+		if err != nil || len(podDev) == 0 {
+			continue
+		}
+		f := ConsistencyFinding{Kind: ConsistencyMissingAllocation, Pod: pod.Namespace + "/" + pod.Name, Message: "live pod placed on the node holds devices the scheduler doesn't account"}
+		if repair {
+			klog.InfoS("Recording missing allocation", "pod", klog.KObj(pod), "node", nodeID)
+			s.addPod(pod, nodeID, podDev)
+			f.Repaired = true
+		}
+		add(nodeID, f)
+	}
+	if repair {
+		s.resources.changed()
+		s.allocations.changed()
+	}
+
+	// Over-allocations are found once the repairs above applied.
+	for _, d := range findDrift(s.nodeSnapshot(), s.ListPodsInfo(), s.memoryOversubscriptionRatio(), s.coreOvercommit()) {
+		add(d.NodeID, ConsistencyFinding{Kind: ConsistencyOverAllocation, Device: d.DeviceID, Message: d.describe()})
+	}
+
+	report := &ConsistencyReport{
+		CheckedAt: time.Now().UTC(),
+		Repair:    repair,
+		Summary:   ConsistencySummary{Findings: map[string]int{}},
+		Nodes:     make([]NodeConsistency, 0, len(findings)),
+	}
+	for nodeID, fs := range findings {
+		report.Nodes = append(report.Nodes, NodeConsistency{Node: nodeID, Consistent: len(fs) == 0, Findings: fs})
+		if len(fs) > 0 {
+			report.Summary.InconsistentNodes++
+		}
+		for _, f := range fs {
+			report.Summary.Findings[f.Kind]++
+			if f.Repaired {
+				report.Summary.Repaired++
+			}
+		}
+	}
+	report.Summary.Nodes = len(report.Nodes)
+	sort.Slice(report.Nodes, func(i, j int) bool { return report.Nodes[i].Node < report.Nodes[j].Node })
+	klog.InfoS("Consistency audit done", "repair", repair, "nodes", report.Summary.Nodes, "inconsistentNodes", report.Summary.InconsistentNodes, "findings", report.Summary.Findings)
+	return report, nil
+}
+
+// capacityDrift compares the devices registered for info with the ones its node currently
+// advertises in its annotations.
+func (s *Scheduler) capacityDrift(info *util.NodeInfo) []ConsistencyFinding {
+	node, err := s.nodeLister.Get(info.ID)
+	if err != nil {
+		return []ConsistencyFinding{{Kind: ConsistencyCapacityDrift, Message: fmt.Sprintf("node can't be read: %v", err)}}
+	}
+	registered := make(map[string]util.DeviceInfo, len(info.Devices))
+	for _, d := range info.Devices {
+		registered[d.ID] = d
+	}
+	res := make([]ConsistencyFinding, 0)
+	// Vendors which don't advertise devices at all are left to the health check of their handshake.
+	decoded := make(map[string]bool)
+	for vendor, devInstance := range device.GetDevices() {
+		advertised, err := devInstance.GetNodeDevices(*node)
+		if err != nil {
+			continue
+		}
+		decoded[vendor] = true
+		for _, d := range advertised {
+			r, ok := registered[d.ID]
+			switch {
+			case !ok:
+				res = append(res, ConsistencyFinding{Kind: ConsistencyCapacityDrift, Device: d.ID, Message: fmt.Sprintf("%s device advertised by the node isn't registered", vendor)})
+			case r.Count != d.Count || r.Devmem != d.Devmem || r.Devcore != d.Devcore || r.Health != d.Health:
+				res = append(res, ConsistencyFinding{Kind: ConsistencyCapacityDrift, Device: d.ID, Message: fmt.Sprintf(
+					"registered with count %d, memory %d, cores %d, healthy %t, advertised with count %d, memory %d, cores %d, healthy %t",
+					r.Count, r.Devmem, r.Devcore, r.Health, d.Count, d.Devmem, d.Devcore, d.Health)})
+			}
+			delete(registered, d.ID)
+		}
+	}
+	for id, r := range registered {
+		if decoded[r.DeviceVendor] {
+			res = append(res, ConsistencyFinding{Kind: ConsistencyCapacityDrift, Device: id, Message: "registered device is no longer advertised by the node"})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Device < res[j].Device })
+	return res
+}
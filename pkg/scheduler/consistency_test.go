@@ -0,0 +1,103 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	listerscorev1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func TestCheckConsistency(t *testing.T) {
+	prev := device.ActiveConfig()
+	initTFLOPSDevices(t)
+	defer func() { assert.NilError(t, device.InitDevicesWithConfig(prev)) }()
+
+	now := time.Now()
+	s := NewScheduler()
+	s.nodes = driftNodes()
+	s.nodes["node1"].Devices[0].Health = true
+	// The node advertises twice the memory it was registered with.
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1", Annotations: map[string]string{
+		nvidia.RegisterAnnos: util.EncodeNodeDevices([]*util.DeviceInfo{
+			{ID: "GPU-0", Count: 10, Devmem: 2048, Devcore: 100, Type: "NVIDIA-Tesla T4", Health: true},
+		}),
+	}}}
+	s.nodes["node1"].Node = node
+	nodeIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	assert.NilError(t, nodeIndexer.Add(node))
+	s.nodeLister = listerscorev1.NewNodeLister(nodeIndexer)
+	podIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	s.podLister = listerscorev1.NewPodLister(podIndexer)
+
+	for _, p := range []*podInfo{
+		driftPod("gone", now.Add(-time.Hour), "GPU-0", 600*util.MiB),
+		driftPod("live", now, "GPU-0", 600*util.MiB),
+	} {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: p.Namespace, Name: p.Name, UID: p.UID}}
+		s.addPod(pod, p.NodeID, p.Devices)
+		if p.Name == "live" {
+			assert.NilError(t, podIndexer.Add(pod))
+		}
+	}
+	missed := driftPod("missed", now, "GPU-0", 100*util.MiB)
+	assert.NilError(t, podIndexer.Add(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Namespace: missed.Namespace, Name: missed.Name, UID: missed.UID,
+		Annotations: map[string]string{
+			util.AssignedNodeAnnotations:                "node1",
+			util.SupportDevices[nvidia.NvidiaGPUDevice]: util.EncodePodSingleDevice(missed.Devices[nvidia.NvidiaGPUDevice]),
+		},
+	}}))
+
+	report, err := s.CheckConsistency(false)
+	assert.NilError(t, err)
+	assert.Equal(t, report.Summary.Nodes, 1)
+	assert.Equal(t, report.Summary.InconsistentNodes, 1)
+	assert.Equal(t, report.Summary.Repaired, 0)
+	assert.DeepEqual(t, report.Summary.Findings, map[string]int{
+		ConsistencyCapacityDrift:     1,
+		ConsistencyOrphanAllocation:  1,
+		ConsistencyMissingAllocation: 1,
+		ConsistencyOverAllocation:    1,
+	})
+	assert.Equal(t, len(s.ListPodsInfo()), 2, "the read-only audit changes nothing")
+	assert.Equal(t, s.nodeSnapshot()["node1"].Devices[0].Devmem, int32(1024))
+
+	report, err = s.CheckConsistency(true)
+	assert.NilError(t, err)
+	assert.Equal(t, report.Summary.Repaired, 3)
+	assert.Equal(t, report.Summary.Findings[ConsistencyOverAllocation], 0, "the repairs resolve the over-allocation")
+	_, ok := s.getPod("uid-gone")
+	assert.Assert(t, !ok)
+	_, ok = s.getPod("uid-missed")
+	assert.Assert(t, ok)
+	assert.Equal(t, s.nodeSnapshot()["node1"].Devices[0].Devmem, int32(2048))
+
+	report, err = s.CheckConsistency(false)
+	assert.NilError(t, err)
+	assert.Equal(t, report.Summary.InconsistentNodes, 0)
+	assert.Assert(t, report.Nodes[0].Consistent)
+}
@@ -0,0 +1,45 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// validateCoreLogLevel checks the hami.io/core-log-level annotation of a pod whose containers
+// using devices are gpuContainers. Containers named by it must be among them, so a typo doesn't
+// go unnoticed.
+func validateCoreLogLevel(annos map[string]string, gpuContainers []string) error {
+	v, ok := annos[util.CoreLogLevel]
+	if !ok {
+		return nil
+	}
+	levels, err := nvidia.ParseCoreLogLevels(v)
+	if err != nil {
+		return fmt.Errorf("invalid %s annotation: %v", util.CoreLogLevel, err)
+	}
+	for name := range levels {
+		if name != "" && !slices.Contains(gpuContainers, name) {
+			return fmt.Errorf("invalid %s annotation: container %s doesn't use GPUs", util.CoreLogLevel, name)
+		}
+	}
+	return nil
+}
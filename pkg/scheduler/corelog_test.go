@@ -0,0 +1,37 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func Test_validateCoreLogLevel(t *testing.T) {
+	gpuContainers := []string{"trainer", "loader"}
+	assert.NilError(t, validateCoreLogLevel(nil, gpuContainers))
+	assert.NilError(t, validateCoreLogLevel(map[string]string{util.CoreLogLevel: "4"}, gpuContainers))
+	assert.NilError(t, validateCoreLogLevel(map[string]string{util.CoreLogLevel: "4"}, nil))
+	assert.NilError(t, validateCoreLogLevel(map[string]string{util.CoreLogLevel: "trainer=4,loader=3"}, gpuContainers))
+	assert.ErrorContains(t, validateCoreLogLevel(map[string]string{util.CoreLogLevel: "verbose"}, gpuContainers),
+		"invalid hami.io/core-log-level annotation: unknown HAMi-core log level")
+	assert.ErrorContains(t, validateCoreLogLevel(map[string]string{util.CoreLogLevel: "trainer=4,sidecar=4"}, gpuContainers),
+		"container sidecar doesn't use GPUs")
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"slices"
+	"sort"
+
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// otherCostCenter labels the allocations of pods whose cost center isn't in config.CostCenters,
+// so the number of label values stays bounded.
+const otherCostCenter = "other"
+
+// CostCenterUsage is what the pods of a cost center currently hold.
+type CostCenterUsage struct {
+	CostCenter string `json:"costCenter"`
+	Pods       int    `json:"pods"`
+	// Devices counts device slices, e.g. a card shared by two containers counts twice.
+	Devices int `json:"devices"`
+	// Memory is in MiB, devices accounting memory in shares are left out, see util.MemoryShares.
+	Memory int64 `json:"memory"`
+	Cores  int64 `json:"cores"`
+}
+
+// costCenter returns the cost center the allocations of a pod with annos are reported under:
+// its hami.io/cost-center annotation if that is one of config.CostCenters, "other" if it isn't,
+// and "" if the pod has none or no cost centers are configured.
+func costCenter(annos map[string]string) string {
+	cc, ok := annos[util.CostCenter]
+	if !ok || len(config.CostCenters) == 0 {
+		return ""
+	}
+	if slices.Contains(config.CostCenters, cc) {
+		return cc
+	}
+	return otherCostCenter
+}
+
+// CostCenterUsage sums the devices held by the pods of every cost center, pods without one
+// under "". It is sorted by cost center.
+func (s *Scheduler) CostCenterUsage() []CostCenterUsage {
+	pods := s.ListPodsInfo()
+	if s.draClaims != nil {
+		pods = append(pods, s.draClaims.ListPodsInfo()...)
+	}
+	usage := make(map[string]*CostCenterUsage)
+	for _, p := range pods {
+		u, ok := usage[p.CostCenter]
+		if !ok {
+			u = &CostCenterUsage{CostCenter: p.CostCenter}
+			usage[p.CostCenter] = u
+		}
+		u.Pods++
+		for _, podSingle := range p.Devices {
+			for _, ctrdevs := range podSingle {
+				for _, udevice := range ctrdevs {
+					if udevice.UUID == "" {
+						continue
+					}
+					u.Devices++
+					if !util.MemoryShares[udevice.Type] {
+						u.Memory += udevice.Usedmem / util.MiB
+					}
+					u.Cores += int64(udevice.Usedcores)
+				}
+			}
+		}
+	}
+	res := make([]CostCenterUsage, 0, len(usage))
+	for _, u := range usage {
+		res = append(res, *u)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].CostCenter < res[j].CostCenter })
+	return res
+}
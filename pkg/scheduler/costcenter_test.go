@@ -0,0 +1,80 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/enflame"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func Test_costCenter(t *testing.T) {
+	defer func(prev []string) { config.CostCenters = prev }(config.CostCenters)
+	annos := map[string]string{util.CostCenter: "research"}
+
+	config.CostCenters = nil
+	assert.Equal(t, costCenter(annos), "")
+
+	config.CostCenters = []string{"research", "platform"}
+	assert.Equal(t, costCenter(annos), "research")
+	assert.Equal(t, costCenter(map[string]string{util.CostCenter: "marketing"}), otherCostCenter)
+	assert.Equal(t, costCenter(nil), "")
+}
+
+func Test_CostCenterUsage(t *testing.T) {
+	defer func(prev []string) { config.CostCenters = prev }(config.CostCenters)
+	config.CostCenters = []string{"research"}
+
+	s := NewScheduler()
+	pod := func(name, cc string) *corev1.Pod {
+		p := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: k8stypes.UID(name)}}
+		if cc != "" {
+			p.Annotations = map[string]string{util.CostCenter: cc}
+		}
+		return p
+	}
+	devices := func(mem int64) util.PodDevices {
+		return util.PodDevices{nvidia.NvidiaGPUDevice: util.PodSingleDevice{
+			{{UUID: "GPU-0", Usedmem: mem * util.MiB, Usedcores: 20}},
+			{{UUID: "GPU-1", Usedmem: mem * util.MiB, Usedcores: 20}},
+		}}
+	}
+	s.addPod(pod("train-0", "research"), "node1", devices(2000))
+	s.addPod(pod("train-1", "research"), "node1", devices(1000))
+	s.addPod(pod("ads", "marketing"), "node1", devices(500))
+	s.addPod(pod("untagged", ""), "node1", devices(100))
+	// The memory of Enflame is a share of the card, which isn't added to the MiB.
+	util.MemoryShares[enflame.EnflameGPUDevice] = true
+	defer delete(util.MemoryShares, enflame.EnflameGPUDevice)
+	s.addPod(pod("gcu", ""), "node1", util.PodDevices{enflame.EnflameGPUDevice: util.PodSingleDevice{
+		{{UUID: "node1-enflame-0", Type: enflame.EnflameGPUDevice, Usedmem: 50, Usedcores: 50}},
+	}})
+
+	assert.DeepEqual(t, s.CostCenterUsage(), []CostCenterUsage{
+		{CostCenter: "", Pods: 2, Devices: 3, Memory: 200, Cores: 90},
+		{CostCenter: otherCostCenter, Pods: 1, Devices: 2, Memory: 1000, Cores: 40},
+		{CostCenter: "research", Pods: 2, Devices: 4, Memory: 6000, Cores: 80},
+	})
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+const (
+	// CUDAVersionCheckOff ignores the hami.io/cuda-version annotation.
+	CUDAVersionCheckOff = "off"
+	// CUDAVersionCheckWarn places pods regardless of their CUDA version, and records a warning
+	// on the pods placed on a node whose driver doesn't support it.
+	CUDAVersionCheckWarn = "warn"
+	// CUDAVersionCheckFilter excludes the nodes whose driver doesn't support the CUDA version of
+	// the pod.
+	CUDAVersionCheckFilter = "filter"
+)
+
+// EventReasonCUDAVersionUnsupported indicates that a pod was placed on a node whose driver
+// doesn't support the CUDA version it requires.
+const EventReasonCUDAVersionUnsupported = "CUDAVersionUnsupported"
+
+// ValidateCUDAVersionCheck rejects unknown values of --cuda-version-check.
+func ValidateCUDAVersionCheck(c string) error {
+	switch c {
+	case CUDAVersionCheckOff, CUDAVersionCheckWarn, CUDAVersionCheckFilter:
+		return nil
+	}
+	return fmt.Errorf("unknown cuda version check %q, %s, %s or %s are allowed", c, CUDAVersionCheckOff, CUDAVersionCheckWarn, CUDAVersionCheckFilter)
+}
+
+// cudaVersion is a CUDA version as major.minor, e.g. 12.2.
+type cudaVersion struct {
+	major, minor int
+}
+
+// parseCUDAVersion parses a version like "12.2".
+func parseCUDAVersion(v string) (cudaVersion, error) {
+	major, minor, ok := strings.Cut(strings.TrimSpace(v), ".")
+	if !ok {
+		return cudaVersion{}, fmt.Errorf("%q isn't a major.minor version", v)
+	}
+	var (
+		res cudaVersion
+		err error
+	)
+	if res.major, err = strconv.Atoi(major); err != nil || res.major < 0 {
+		return cudaVersion{}, fmt.Errorf("%q isn't a major.minor version", v)
+	}
+	if res.minor, err = strconv.Atoi(minor); err != nil || res.minor < 0 {
+		return cudaVersion{}, fmt.Errorf("%q isn't a major.minor version", v)
+	}
+	return res, nil
+}
+
+func (v cudaVersion) less(o cudaVersion) bool {
+	return v.major < o.major || v.major == o.major && v.minor < o.minor
+}
+
+// cudaVersionMismatch returns why the driver of node doesn't support the CUDA version a pod
+// requires with the hami.io/cuda-version annotation, or "" if it does. Nodes whose device plugin
+// hasn't reported the CUDA version of the driver yet don't support it either, until they do.
+func cudaVersionMismatch(node *corev1.Node, annos map[string]string) string {
+	want, ok := annos[util.CUDAVersion]
+	if !ok {
+		return ""
+	}
+	wanted, err := parseCUDAVersion(want)
+	if err != nil {
+		// The webhook denies such pods, they were created before it ran.
+		return fmt.Sprintf("invalid %s annotation: %v", util.CUDAVersion, err)
+	}
+	var got, driver string
+	if node != nil {
+		got = node.Annotations[util.NodeNvidiaCUDAVersionAnnos]
+		driver = node.Annotations[util.NodeNvidiaDriverVersionAnnos]
+	}
+	if got == "" {
+		return fmt.Sprintf("node hasn't reported the CUDA version of its driver yet, %s requested", want)
+	}
+	supported, err := parseCUDAVersion(got)
+	if err != nil {
+		return fmt.Sprintf("node reported an invalid CUDA version %q, %s requested", got, want)
+	}
+	if !supported.less(wanted) {
+		return ""
+	}
+	return fmt.Sprintf("node driver %s supports CUDA up to %s, %s requested", driver, got, want)
+}
+
+// cudaVersionFilterReason is cudaVersionMismatch under CUDAVersionCheckFilter, "" otherwise.
+func cudaVersionFilterReason(node *corev1.Node, annos map[string]string) string {
+	if config.CUDAVersionCheck != CUDAVersionCheckFilter {
+		return ""
+	}
+	return cudaVersionMismatch(node, annos)
+}
+
+// warnCUDAVersion logs and records on pod that it was placed on node although the driver of node
+// doesn't support its CUDA version, under CUDAVersionCheckWarn.
+func (s *Scheduler) warnCUDAVersion(pod *corev1.Pod, node *corev1.Node) {
+	if config.CUDAVersionCheck != CUDAVersionCheckWarn || pod == nil || node == nil {
+		return
+	}
+	reason := cudaVersionMismatch(node, pod.Annotations)
+	if reason == "" {
+		return
+	}
+	klog.InfoS("Pod placed on a node whose driver may not support its CUDA version", "pod", klog.KObj(pod), "node", node.Name, "reason", reason)
+	if s.eventRecorder != nil {
+		s.eventRecorder.Eventf(pod, corev1.EventTypeWarning, EventReasonCUDAVersionUnsupported, "Placed on node %s whose driver may not run the pod: %s", node.Name, reason)
+	}
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/policy"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func cudaVersionNode(name, cuda string) *corev1.Node {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: map[string]string{}}}
+	if cuda != "" {
+		node.Annotations[util.NodeNvidiaDriverVersionAnnos] = "535.104.05"
+		node.Annotations[util.NodeNvidiaCUDAVersionAnnos] = cuda
+	}
+	return node
+}
+
+func Test_ValidateCUDAVersionCheck(t *testing.T) {
+	for _, c := range []string{CUDAVersionCheckOff, CUDAVersionCheckWarn, CUDAVersionCheckFilter} {
+		assert.NilError(t, ValidateCUDAVersionCheck(c))
+	}
+	assert.ErrorContains(t, ValidateCUDAVersionCheck("deny"), "unknown cuda version check")
+}
+
+func Test_parseCUDAVersion(t *testing.T) {
+	v, err := parseCUDAVersion("12.10")
+	assert.NilError(t, err)
+	assert.Equal(t, v, cudaVersion{major: 12, minor: 10})
+	assert.Assert(t, cudaVersion{major: 12, minor: 2}.less(v))
+	assert.Assert(t, cudaVersion{major: 11, minor: 8}.less(cudaVersion{major: 12, minor: 0}))
+	for _, bad := range []string{"12", "12.x", "v12.2", "-1.0", ""} {
+		_, err := parseCUDAVersion(bad)
+		assert.ErrorContains(t, err, "isn't a major.minor version", bad)
+	}
+}
+
+func Test_cudaVersionMismatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		annos map[string]string
+		node  *corev1.Node
+		want  string
+	}{
+		{name: "no requirement", annos: map[string]string{}, node: cudaVersionNode("node1", ""), want: ""},
+		{name: "same version", annos: map[string]string{util.CUDAVersion: "12.2"}, node: cudaVersionNode("node1", "12.2"), want: ""},
+		{name: "older requirement", annos: map[string]string{util.CUDAVersion: "11.8"}, node: cudaVersionNode("node1", "12.2"), want: ""},
+		{
+			name:  "newer requirement",
+			annos: map[string]string{util.CUDAVersion: "12.4"},
+			node:  cudaVersionNode("node1", "12.2"),
+			want:  "node driver 535.104.05 supports CUDA up to 12.2, 12.4 requested",
+		},
+		{
+			name:  "minor compared as a number",
+			annos: map[string]string{util.CUDAVersion: "12.10"},
+			node:  cudaVersionNode("node1", "12.9"),
+			want:  "node driver 535.104.05 supports CUDA up to 12.9, 12.10 requested",
+		},
+		{
+			name:  "version not reported",
+			annos: map[string]string{util.CUDAVersion: "12.4"},
+			node:  cudaVersionNode("node1", ""),
+			want:  "node hasn't reported the CUDA version of its driver yet, 12.4 requested",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, cudaVersionMismatch(test.node, test.annos), test.want)
+		})
+	}
+}
+
+func cudaVersionNodes() map[string]*NodeUsage {
+	nodes := map[string]*NodeUsage{}
+	for name, cuda := range map[string]string{"new-driver": "12.4", "old-driver": "12.2", "new-node": ""} {
+		nodes[name] = &NodeUsage{
+			Node: cudaVersionNode(name, cuda),
+			Devices: policy.DeviceUsageList{
+				Policy: util.GPUSchedulerPolicySpread.String(),
+				DeviceLists: []*policy.DeviceListsScore{{Device: &util.DeviceUsage{
+					ID: name + "-gpu", Type: nvidia.NvidiaGPUDevice, Count: 10, Totalmem: 8000, Totalcore: 100, Health: true,
+				}}},
+			},
+		}
+	}
+	return nodes
+}
+
+func Test_calcScoreCUDAVersion(t *testing.T) {
+	prev := config.CUDAVersionCheck
+	defer func() { config.CUDAVersionCheck = prev }()
+
+	nums := util.PodDeviceRequests{{nvidia.NvidiaGPUDevice: util.ContainerDeviceRequest{Nums: 1, Type: nvidia.NvidiaGPUDevice, Memreq: 1000, Coresreq: 10}}}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "trainer", Namespace: "default", Annotations: map[string]string{util.CUDAVersion: "12.4"}}}
+
+	config.CUDAVersionCheck = CUDAVersionCheckFilter
+	nodes := cudaVersionNodes()
+	failedNodes := map[string]string{}
+	res, err := NewScheduler().calcScore(&nodes, nums, pod.Annotations, pod, failedNodes)
+	assert.NilError(t, err)
+	assert.Equal(t, len(res.NodeList), 1)
+	assert.Equal(t, res.NodeList[0].NodeID, "new-driver")
+	assert.Equal(t, failedNodes["old-driver"], "node driver 535.104.05 supports CUDA up to 12.2, 12.4 requested")
+	assert.Equal(t, failedNodes["new-node"], "node hasn't reported the CUDA version of its driver yet, 12.4 requested")
+
+	for _, c := range []string{CUDAVersionCheckWarn, CUDAVersionCheckOff} {
+		config.CUDAVersionCheck = c
+		nodes = cudaVersionNodes()
+		failedNodes = map[string]string{}
+		res, err = NewScheduler().calcScore(&nodes, nums, pod.Annotations, pod, failedNodes)
+		assert.NilError(t, err)
+		assert.Equal(t, len(res.NodeList), 3, c)
+		assert.Equal(t, len(failedNodes), 0, c)
+	}
+}
+
+func Test_warnCUDAVersion(t *testing.T) {
+	prev := config.CUDAVersionCheck
+	defer func() { config.CUDAVersionCheck = prev }()
+
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "trainer", Namespace: "default", Annotations: map[string]string{util.CUDAVersion: "12.4"}}}
+	recorder := record.NewFakeRecorder(10)
+	s := NewScheduler()
+	s.eventRecorder = recorder
+
+	config.CUDAVersionCheck = CUDAVersionCheckWarn
+	s.warnCUDAVersion(pod, cudaVersionNode("new-driver", "12.4"))
+	assert.Equal(t, len(recorder.Events), 0)
+	s.warnCUDAVersion(pod, cudaVersionNode("old-driver", "12.2"))
+	assert.Equal(t, len(recorder.Events), 1)
+	event := <-recorder.Events
+	assert.Assert(t, strings.HasPrefix(event, "Warning "+EventReasonCUDAVersionUnsupported), event)
+	assert.Assert(t, strings.Contains(event, "node driver 535.104.05 supports CUDA up to 12.2, 12.4 requested"), event)
+
+	config.CUDAVersionCheck = CUDAVersionCheckFilter
+	s.warnCUDAVersion(pod, cudaVersionNode("old-driver", "12.2"))
+	assert.Equal(t, len(recorder.Events), 0)
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// EventReasonSchedulingDeadlineExceeded is the event and status reason of pods failed because no
+// device fit them within their hami.io/scheduling-deadline.
+const EventReasonSchedulingDeadlineExceeded = "SchedulingDeadlineExceeded"
+
+// errNotPending is returned for a pod which got placed or stopped meanwhile.
+var errNotPending = errors.New("pod is no longer pending")
+
+// parseSchedulingDeadline parses the value of the hami.io/scheduling-deadline annotation.
+func parseSchedulingDeadline(v string) (time.Duration, error) {
+	after, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, err
+	}
+	if after <= 0 {
+		return 0, fmt.Errorf("duration %s isn't positive", v)
+	}
+	return after, nil
+}
+
+// schedulingDeadline returns when pod has waited its hami.io/scheduling-deadline since it was
+// created, and the wait. ok is false for pods without one.
+func schedulingDeadline(pod *corev1.Pod) (deadline time.Time, after time.Duration, ok bool) {
+	v, set := pod.Annotations[util.SchedulingDeadline]
+	if !set {
+		return time.Time{}, 0, false
+	}
+	after, err := parseSchedulingDeadline(v)
+	if err != nil {
+		// Rejected by the webhook, so only seen for pods admitted before it checked them.
+		klog.V(4).InfoS("Ignoring invalid scheduling deadline", "pod", klog.KObj(pod), "deadline", v, "err", err)
+		return time.Time{}, 0, false
+	}
+	return pod.CreationTimestamp.Add(after), after, true
+}
+
+// failPastDeadline marks pod failed if no node fits it, for reason, and it is past its
+// hami.io/scheduling-deadline at now, so it stops taking a place in the scheduling queue. It
+// reports whether it did.
+func (s *Scheduler) failPastDeadline(pod *corev1.Pod, reason string, now time.Time) bool {
+	deadline, after, ok := schedulingDeadline(pod)
+	if !ok || now.Before(deadline) || s.kubeClient == nil {
+		return false
+	}
+	msg := fmt.Sprintf("No GPU became available within the scheduling deadline of %s: %s", after, reason)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		current, err := s.kubeClient.CoreV1().Pods(pod.Namespace).Get(context.Background(), pod.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if current.UID != pod.UID || current.Spec.NodeName != "" || current.Status.Phase != corev1.PodPending {
+			return errNotPending
+		}
+		current.Status.Phase = corev1.PodFailed
+		current.Status.Reason = EventReasonSchedulingDeadlineExceeded
+		current.Status.Message = msg
+		_, err = s.kubeClient.CoreV1().Pods(pod.Namespace).UpdateStatus(context.Background(), current, metav1.UpdateOptions{})
+		return err
+	})
+	if errors.Is(err, errNotPending) {
+		return false
+	}
+	if err != nil {
+		klog.ErrorS(err, "Failed to fail pod past its scheduling deadline", "pod", klog.KObj(pod), "deadline", deadline)
+		return false
+	}
+	klog.InfoS("Failed pod past its scheduling deadline", "pod", klog.KObj(pod), "deadline", deadline, "reason", reason)
+	if s.eventRecorder != nil {
+		s.eventRecorder.Event(pod, corev1.EventTypeWarning, EventReasonSchedulingDeadlineExceeded, msg)
+	}
+	return true
+}
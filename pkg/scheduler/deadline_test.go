@@ -0,0 +1,89 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func Test_parseSchedulingDeadline(t *testing.T) {
+	after, err := parseSchedulingDeadline("30m")
+	assert.NilError(t, err)
+	assert.Equal(t, after, 30*time.Minute)
+	for _, v := range []string{"", "soon", "0s", "-1m"} {
+		_, err := parseSchedulingDeadline(v)
+		assert.Assert(t, err != nil, v)
+	}
+}
+
+func Test_failPastDeadline(t *testing.T) {
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	pending := func(name string, annos map[string]string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name, Namespace: "default", UID: k8stypes.UID("uid-" + name), Annotations: annos,
+				CreationTimestamp: metav1.NewTime(created),
+			},
+			Status: corev1.PodStatus{Phase: corev1.PodPending},
+		}
+	}
+	batch := pending("batch", map[string]string{util.SchedulingDeadline: "30m"})
+	plain := pending("plain", nil)
+	invalid := pending("invalid", map[string]string{util.SchedulingDeadline: "soon"})
+	bound := pending("bound", map[string]string{util.SchedulingDeadline: "30m"})
+	bound.Spec.NodeName = "node1"
+
+	s := NewScheduler()
+	recorder := record.NewFakeRecorder(10)
+	s.eventRecorder = recorder
+	s.kubeClient = fake.NewSimpleClientset(batch, plain, invalid, bound)
+	reason := "0/2 nodes are available: 2 insufficient GPU memory"
+
+	// Before the deadline, and for pods without a valid one or already bound, nothing changes.
+	assert.Assert(t, !s.failPastDeadline(batch, reason, created.Add(29*time.Minute)))
+	for _, p := range []*corev1.Pod{plain, invalid, bound} {
+		assert.Assert(t, !s.failPastDeadline(p, reason, created.Add(time.Hour)), p.Name)
+		got, err := s.kubeClient.CoreV1().Pods("default").Get(context.Background(), p.Name, metav1.GetOptions{})
+		assert.NilError(t, err)
+		assert.Equal(t, got.Status.Phase, corev1.PodPending, p.Name)
+	}
+	assert.Equal(t, len(recorder.Events), 0)
+
+	assert.Assert(t, s.failPastDeadline(batch, reason, created.Add(30*time.Minute)))
+	got, err := s.kubeClient.CoreV1().Pods("default").Get(context.Background(), "batch", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.Equal(t, got.Status.Phase, corev1.PodFailed)
+	assert.Equal(t, got.Status.Reason, EventReasonSchedulingDeadlineExceeded)
+	assert.Equal(t, got.Status.Message, "No GPU became available within the scheduling deadline of 30m0s: "+reason)
+	event := <-recorder.Events
+	assert.Assert(t, strings.HasPrefix(event, "Warning SchedulingDeadlineExceeded"), event)
+
+	// A failed pod isn't failed again.
+	assert.Assert(t, !s.failPastDeadline(batch, reason, created.Add(time.Hour)))
+}
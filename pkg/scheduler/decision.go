@@ -0,0 +1,151 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/policy"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// NodeDecision is the outcome of the filter and score phases for a single node.
+type NodeDecision struct {
+	Node string `json:"node"`
+	Fit  bool   `json:"fit"`
+	// Reason is why the node was filtered out.
+	Reason string  `json:"reason,omitempty"`
+	Score  float32 `json:"score,omitempty"`
+	// Breakdown is what the devices and every node preference contributed to Score.
+	Breakdown map[string]float32 `json:"breakdown,omitempty"`
+}
+
+// SchedulingDecision records how the scheduler placed a pod.
+type SchedulingDecision struct {
+	PodUID     types.UID       `json:"podUID"`
+	Namespace  string          `json:"namespace"`
+	Name       string          `json:"name"`
+	Timestamp  time.Time       `json:"timestamp"`
+	NodePolicy string          `json:"nodePolicy"`
+	Nodes      []NodeDecision  `json:"nodes"`
+	Selected   string          `json:"selectedNode,omitempty"`
+	Devices    util.PodDevices `json:"devices,omitempty"`
+	Rationale  string          `json:"rationale"`
+}
+
+// newSchedulingDecision builds the decision of pod from the sorted node scores, the
+// selected node being the last one, and the reasons of the nodes filtered out.
+func newSchedulingDecision(pod *corev1.Pod, scores *policy.NodeScoreList, failedNodes map[string]string) *SchedulingDecision {
+	d := &SchedulingDecision{
+		PodUID:     pod.UID,
+		Namespace:  pod.Namespace,
+		Name:       pod.Name,
+		Timestamp:  time.Now().UTC(),
+		NodePolicy: scores.Policy,
+		Nodes:      make([]NodeDecision, 0, len(scores.NodeList)+len(failedNodes)),
+	}
+	for _, ns := range scores.NodeList {
+		d.Nodes = append(d.Nodes, NodeDecision{Node: ns.NodeID, Fit: true, Score: ns.Score, Breakdown: ns.Breakdown})
+	}
+	failed := make([]string, 0, len(failedNodes))
+	for node := range failedNodes {
+		failed = append(failed, node)
+	}
+	sort.Strings(failed)
+	for _, node := range failed {
+		d.Nodes = append(d.Nodes, NodeDecision{Node: node, Reason: failedNodes[node]})
+	}
+
+	if len(scores.NodeList) == 0 {
+		d.Rationale = fmt.Sprintf("no node fits the pod, %d nodes were filtered out", len(failed))
+		return d
+	}
+	m := scores.NodeList[len(scores.NodeList)-1]
+	d.Selected = m.NodeID
+	d.Devices = m.Devices
+	best := "highest"
+	if scores.Policy == util.NodeSchedulerPolicySpread.String() {
+		best = "lowest"
+	}
+	d.Rationale = fmt.Sprintf("node %s has the %s score %.2f of %d fitting nodes under the %s node policy", m.NodeID, best, m.Score, len(scores.NodeList), scores.Policy)
+	return d
+}
+
+// decisionCache keeps the most recent scheduling decisions keyed by pod UID. Once
+// full, the oldest decision is evicted. A nil *decisionCache records nothing.
+type decisionCache struct {
+	capacity int
+
+	mutex   sync.Mutex
+	order   []types.UID
+	entries map[types.UID]*SchedulingDecision
+}
+
+func newDecisionCache(capacity int) *decisionCache {
+	if capacity <= 0 {
+		return nil
+	}
+	return &decisionCache{
+		capacity: capacity,
+		order:    make([]types.UID, 0, capacity),
+		entries:  make(map[types.UID]*SchedulingDecision),
+	}
+}
+
+func (c *decisionCache) record(d *SchedulingDecision) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.entries[d.PodUID]; ok {
+		// A rescheduled pod moves to the back of the queue.
+		for i, uid := range c.order {
+			if uid == d.PodUID {
+				c.order = append(c.order[:i], c.order[i+1:]...)
+				break
+			}
+		}
+	}
+	for len(c.order) >= c.capacity {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.order = append(c.order, d.PodUID)
+	c.entries[d.PodUID] = d
+}
+
+func (c *decisionCache) get(uid types.UID) (*SchedulingDecision, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	d, ok := c.entries[uid]
+	return d, ok
+}
+
+// Decision returns the recorded scheduling decision of the pod with the given UID.
+func (s *Scheduler) Decision(uid types.UID) (*SchedulingDecision, bool) {
+	return s.decisions.get(uid)
+}
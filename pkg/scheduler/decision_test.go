@@ -0,0 +1,77 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"sort"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/policy"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func decisionPod(uid string) *corev1.Pod {
+	return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "p-" + uid, Namespace: "default", UID: k8stypes.UID(uid)}}
+}
+
+func Test_newSchedulingDecision(t *testing.T) {
+	scores := &policy.NodeScoreList{
+		Policy: util.NodeSchedulerPolicyBinpack.String(),
+		NodeList: []*policy.NodeScore{
+			{NodeID: "node1", Score: 3, Breakdown: map[string]float32{"devices": 2, "sticky": 1}},
+			{NodeID: "node2", Score: 1},
+		},
+	}
+	sort.Sort(scores)
+	d := newSchedulingDecision(decisionPod("a"), scores, map[string]string{"node3": "node not fit pod"})
+	assert.Equal(t, d.Selected, "node1")
+	assert.Equal(t, len(d.Nodes), 3)
+	assert.DeepEqual(t, d.Nodes[1].Breakdown, map[string]float32{"devices": 2, "sticky": 1})
+	assert.DeepEqual(t, d.Nodes[2], NodeDecision{Node: "node3", Reason: "node not fit pod"})
+	assert.Equal(t, d.Rationale, "node node1 has the highest score 3.00 of 2 fitting nodes under the binpack node policy")
+
+	d = newSchedulingDecision(decisionPod("b"), &policy.NodeScoreList{Policy: "binpack"}, map[string]string{"node3": "node not fit pod"})
+	assert.Equal(t, d.Selected, "")
+	assert.Equal(t, d.Rationale, "no node fits the pod, 1 nodes were filtered out")
+}
+
+func Test_decisionCache(t *testing.T) {
+	c := newDecisionCache(2)
+	c.record(&SchedulingDecision{PodUID: "a"})
+	c.record(&SchedulingDecision{PodUID: "b"})
+	c.record(&SchedulingDecision{PodUID: "a", Selected: "node2"})
+	c.record(&SchedulingDecision{PodUID: "c"})
+
+	_, ok := c.get("b")
+	assert.Assert(t, !ok, "the oldest decision is evicted")
+	d, ok := c.get("a")
+	assert.Assert(t, ok)
+	assert.Equal(t, d.Selected, "node2")
+	_, ok = c.get("c")
+	assert.Assert(t, ok)
+
+	var disabled *decisionCache
+	assert.Assert(t, newDecisionCache(0) == nil)
+	disabled.record(&SchedulingDecision{PodUID: "a"})
+	_, ok = disabled.get("a")
+	assert.Assert(t, !ok)
+}
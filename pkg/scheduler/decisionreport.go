@@ -0,0 +1,210 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// redactedValue replaces the values of labels in a redacted report.
+const redactedValue = "<redacted>"
+
+// DecisionReport is everything the scheduler considered for a pod, self-contained to be attached
+// to an issue about why the pod is pending.
+type DecisionReport struct {
+	GeneratedAt      time.Time `json:"generatedAt"`
+	SchedulerVersion string    `json:"schedulerVersion"`
+	// Redacted is set when the namespaces and label values were replaced.
+	Redacted bool `json:"redacted"`
+	// Pod is unset once the pod is gone.
+	Pod      *ReportPod          `json:"pod,omitempty"`
+	Decision *SchedulingDecision `json:"decision"`
+	// Nodes are the devices of the nodes the decision considered as the scheduler accounts them
+	// now, which may differ from when the pod was scheduled.
+	Nodes  []ReportNode    `json:"nodes"`
+	Policy EffectivePolicy `json:"policy"`
+}
+
+// ReportPod is the part of a pod which decides where it goes.
+type ReportPod struct {
+	Namespace     string            `json:"namespace"`
+	Name          string            `json:"name"`
+	SchedulerName string            `json:"schedulerName"`
+	Labels        map[string]string `json:"labels,omitempty"`
+	// Annotations leave out the ones of Kubernetes itself, e.g. the last applied configuration.
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	Containers   []ReportContainer `json:"containers"`
+}
+
+// ReportContainer is the resources a container of the pod requests.
+type ReportContainer struct {
+	Name   string              `json:"name"`
+	Limits corev1.ResourceList `json:"limits,omitempty"`
+}
+
+// ReportNode is the devices of a node and what is left of them.
+type ReportNode struct {
+	Node  string       `json:"node"`
+	Known bool         `json:"known"`
+	Cards []ReportCard `json:"cards,omitempty"`
+}
+
+// ReportCard is a card as in its GPUAllocation, with what is left of it.
+type ReportCard struct {
+	GPUAllocationCard
+	FreeSharers   int64 `json:"freeSharers"`
+	FreeMemoryMiB int64 `json:"freeMemoryMiB"`
+	FreeCores     int64 `json:"freeCores"`
+}
+
+// newReportPod returns the report of pod.
+func newReportPod(pod *corev1.Pod) *ReportPod {
+	p := &ReportPod{
+		Namespace:     pod.Namespace,
+		Name:          pod.Name,
+		SchedulerName: pod.Spec.SchedulerName,
+		Labels:        pod.Labels,
+		NodeSelector:  pod.Spec.NodeSelector,
+		Containers:    make([]ReportContainer, 0, len(pod.Spec.Containers)),
+	}
+	for k, v := range pod.Annotations {
+		if prefix, _, ok := strings.Cut(k, "/"); ok && (strings.HasSuffix(prefix, "kubernetes.io") || strings.HasSuffix(prefix, "k8s.io")) {
+			continue
+		}
+		if p.Annotations == nil {
+			p.Annotations = make(map[string]string)
+		}
+		p.Annotations[k] = v
+	}
+	for _, c := range pod.Spec.Containers {
+		p.Containers = append(p.Containers, ReportContainer{Name: c.Name, Limits: c.Resources.Limits})
+	}
+	return p
+}
+
+// newReportNode returns the report of the devices of node, counted like its GPUAllocation.
+func newReportNode(status GPUAllocationStatus) ReportNode {
+	n := ReportNode{Node: status.Node, Known: true, Cards: make([]ReportCard, 0, len(status.Cards))}
+	for _, c := range status.Cards {
+		n.Cards = append(n.Cards, ReportCard{
+			GPUAllocationCard: c,
+			FreeSharers:       max(c.MaxSharers-c.Sharers, 0),
+			FreeMemoryMiB:     max(c.MemoryMiB-c.UsedMemoryMiB, 0),
+			FreeCores:         max(c.Cores-c.UsedCores, 0),
+		})
+	}
+	return n
+}
+
+// DecisionReport returns the report of the pod with the given UID, ok is false without a
+// recorded decision. With redact, the namespaces are replaced with placeholders, the same
+// namespace with the same placeholder, and the values of labels and node selectors with
+// redactedValue.
+func (s *Scheduler) DecisionReport(uid types.UID, redact bool) (report *DecisionReport, ok bool, err error) {
+	decision, ok := s.Decision(uid)
+	if !ok {
+		return nil, false, nil
+	}
+	policy, err := s.EffectivePolicy()
+	if err != nil {
+		return nil, true, err
+	}
+	report = &DecisionReport{
+		GeneratedAt:      time.Now().UTC(),
+		SchedulerVersion: schedulerVersion,
+		Decision:         decision,
+		Nodes:            make([]ReportNode, 0, len(decision.Nodes)),
+		Policy:           policy,
+	}
+	if s.podLister != nil {
+		if pod, err := s.podLister.Pods(decision.Namespace).Get(decision.Name); err == nil && pod.UID == uid {
+			report.Pod = newReportPod(pod)
+		}
+	}
+	nodes := s.nodeSnapshot()
+	pods := s.ListPodsInfo()
+	if s.draClaims != nil {
+		pods = append(pods, s.draClaims.ListPodsInfo()...)
+	}
+	for _, nd := range decision.Nodes {
+		info, found := nodes[nd.Node]
+		if !found {
+			report.Nodes = append(report.Nodes, ReportNode{Node: nd.Node})
+			continue
+		}
+		report.Nodes = append(report.Nodes, newReportNode(nodeGPUAllocation(info, pods)))
+	}
+	if redact {
+		report.redact()
+	}
+	return report, true, nil
+}
+
+// redact replaces the namespaces and the values of labels and node selectors of r, leaving the
+// recorded decision untouched.
+func (r *DecisionReport) redact() {
+	r.Redacted = true
+	placeholders := make(map[string]string)
+	namespace := func(ns string) string {
+		if ns == "" {
+			return ""
+		}
+		if _, ok := placeholders[ns]; !ok {
+			placeholders[ns] = fmt.Sprintf("namespace-%d", len(placeholders)+1)
+		}
+		return placeholders[ns]
+	}
+	decision := *r.Decision
+	decision.Namespace = namespace(decision.Namespace)
+	r.Decision = &decision
+	if r.Pod != nil {
+		pod := *r.Pod
+		pod.Namespace = namespace(pod.Namespace)
+		pod.Labels = redactValues(pod.Labels)
+		pod.NodeSelector = redactValues(pod.NodeSelector)
+		r.Pod = &pod
+	}
+	for i := range r.Nodes {
+		for j := range r.Nodes[i].Cards {
+			card := &r.Nodes[i].Cards[j]
+			pods := make([]GPUAllocationPod, len(card.Pods))
+			for k, p := range card.Pods {
+				p.Namespace = namespace(p.Namespace)
+				pods[k] = p
+			}
+			card.Pods = pods
+		}
+	}
+}
+
+// redactValues returns m with its values replaced with redactedValue.
+func redactValues(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	res := make(map[string]string, len(m))
+	for k := range m {
+		res[k] = redactedValue
+	}
+	return res
+}
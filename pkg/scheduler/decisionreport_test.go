@@ -0,0 +1,90 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	listerscorev1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func Test_DecisionReport(t *testing.T) {
+	s := NewScheduler()
+	s.decisions = newDecisionCache(10)
+	podIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	s.podLister = listerscorev1.NewPodLister(podIndexer)
+	s.addNode("node1", extendedResourcesNode())
+	s.addPod(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "trainer", Namespace: "team-b", UID: "trainer"}}, "node1",
+		util.PodDevices{nvidia.NvidiaGPUDevice: util.PodSingleDevice{{{UUID: "GPU-0", Usedmem: 8192 * util.MiB, Usedcores: 50}}}})
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pending", Namespace: "team-a", UID: "pending",
+			Labels: map[string]string{"app": "inference"},
+			Annotations: map[string]string{
+				"nvidia.com/use-gputype":                           "A100",
+				"kubectl.kubernetes.io/last-applied-configuration": "{}",
+			}},
+		Spec: corev1.PodSpec{
+			NodeSelector: map[string]string{"pool": "gpu"},
+			Containers:   []corev1.Container{{Name: "server"}},
+		},
+	}
+	assert.NilError(t, podIndexer.Add(pod))
+	s.decisions.record(&SchedulingDecision{PodUID: "pending", Namespace: "team-a", Name: "pending", Nodes: []NodeDecision{
+		{Node: "node1", Reason: "node not fit pod"},
+		{Node: "gone", Reason: "node unregistered"},
+	}})
+
+	_, ok, err := s.DecisionReport("unknown", false)
+	assert.NilError(t, err)
+	assert.Assert(t, !ok)
+
+	report, ok, err := s.DecisionReport("pending", false)
+	assert.NilError(t, err)
+	assert.Assert(t, ok)
+	assert.Equal(t, report.Pod.Namespace, "team-a")
+	assert.DeepEqual(t, report.Pod.Labels, map[string]string{"app": "inference"})
+	// The annotations of Kubernetes itself are left out.
+	assert.DeepEqual(t, report.Pod.Annotations, map[string]string{"nvidia.com/use-gputype": "A100"})
+	assert.Equal(t, len(report.Nodes), 2)
+	gpu0 := report.Nodes[0].Cards[0]
+	assert.Equal(t, gpu0.ID, "GPU-0")
+	assert.Equal(t, gpu0.FreeSharers, int64(9))
+	assert.Equal(t, gpu0.FreeMemoryMiB, int64(40960-8192))
+	assert.Equal(t, gpu0.FreeCores, int64(50))
+	assert.DeepEqual(t, gpu0.Pods, []GPUAllocationPod{{Namespace: "team-b", Name: "trainer", MemoryMiB: 8192, Cores: 50}})
+	assert.DeepEqual(t, report.Nodes[1], ReportNode{Node: "gone"})
+
+	report, _, err = s.DecisionReport("pending", true)
+	assert.NilError(t, err)
+	assert.Assert(t, report.Redacted)
+	assert.Equal(t, report.Decision.Namespace, "namespace-1")
+	assert.Equal(t, report.Pod.Namespace, "namespace-1")
+	assert.DeepEqual(t, report.Pod.Labels, map[string]string{"app": redactedValue})
+	assert.DeepEqual(t, report.Pod.NodeSelector, map[string]string{"pool": redactedValue})
+	assert.Equal(t, report.Nodes[0].Cards[0].Pods[0].Namespace, "namespace-2")
+	// The recorded decision is left as it was.
+	decision, _ := s.Decision("pending")
+	assert.Equal(t, decision.Namespace, "team-a")
+}
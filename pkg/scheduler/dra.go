@@ -0,0 +1,136 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// draClaimResync is how often the claims are handled again, so a claim allocated on a node
+// the scheduler didn't know yet is accounted for once it does.
+const draClaimResync = time.Minute
+
+// startDRAWatch accounts for the card slots kube-scheduler allocates to ResourceClaims from
+// the ResourceSlices of the HAMi driver. Allocation is kube-scheduler's, the accounting keeps
+// the extender from giving the memory and cores of those slots to device-plugin pods.
+func (s *Scheduler) startDRAWatch() {
+	klog.InfoS("Watching ResourceClaims", "driver", util.DRADriverName)
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(s.dynamicClient, draClaimResync)
+	factory.ForResource(util.ResourceClaimResource).Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj any) { s.onDRAClaim(obj) },
+		UpdateFunc: func(_, obj any) { s.onDRAClaim(obj) },
+		DeleteFunc: s.onDRAClaimDeleted,
+	})
+	factory.Start(s.stopCh)
+}
+
+func claimOwner(claim *util.DRAClaim) *corev1.Pod {
+	return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: claim.Name, Namespace: claim.Namespace, UID: claim.UID}}
+}
+
+func (s *Scheduler) onDRAClaim(obj any) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+	claim, err := util.ClaimFromUnstructured(u.Object)
+	if err != nil {
+		klog.ErrorS(err, "Failed to read ResourceClaim", "claim", klog.KObj(u))
+		return
+	}
+	node, pd, err := s.claimDevices(claim)
+	if err != nil {
+		klog.ErrorS(err, "Failed to account for ResourceClaim", "claim", klog.KObj(claim))
+		return
+	}
+	pi, accounted := s.draClaims.getPod(claim.UID)
+	if pd == nil {
+		// Deallocated, or not holding slots of the HAMi driver.
+		if accounted {
+			s.draClaims.delPod(claimOwner(claim))
+		}
+		return
+	}
+	if accounted {
+		if pi.NodeID == node && reflect.DeepEqual(pi.Devices, pd) {
+			return
+		}
+		s.draClaims.delPod(claimOwner(claim))
+	}
+	s.draClaims.addPod(claimOwner(claim), node, pd)
+}
+
+func (s *Scheduler) onDRAClaimDeleted(obj any) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+	if _, ok := s.draClaims.getPod(u.GetUID()); ok {
+		s.draClaims.delPod(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: u.GetName(), Namespace: u.GetNamespace(), UID: u.GetUID()}})
+	}
+}
+
+// claimDevices returns the node and the devices of the slots of the HAMi driver allocated to
+// claim, nil devices if it holds none. The pool of a slot is its node, its name tells the
+// index of its card.
+func (s *Scheduler) claimDevices(claim *util.DRAClaim) (string, util.PodDevices, error) {
+	allocated, err := claim.AllocatedDevices()
+	if err != nil || len(allocated) == 0 {
+		return "", nil, err
+	}
+	nodeID := allocated[0].Pool
+	node, err := s.GetNode(nodeID)
+	if err != nil {
+		return "", nil, err
+	}
+	devs := util.ContainerDevices{}
+	for _, a := range allocated {
+		if a.Pool != nodeID {
+			return "", nil, fmt.Errorf("slots %s and %s are on different nodes", allocated[0].Device, a.Device)
+		}
+		card, ok := cardOfIndex(node, a.Index)
+		if !ok {
+			return "", nil, fmt.Errorf("node %s has no card for slot %s", nodeID, a.Device)
+		}
+		devs = append(devs, a.Config.ContainerDevice(nvidia.NvidiaGPUDevice, card))
+	}
+	return nodeID, util.PodDevices{nvidia.NvidiaGPUDevice: util.PodSingleDevice{devs}}, nil
+}
+
+func cardOfIndex(node *util.NodeInfo, index uint) (util.DeviceInfo, bool) {
+	for _, d := range node.Devices {
+		if d.Index == index && (d.DeviceVendor == "" || d.DeviceVendor == nvidia.NvidiaGPUDevice) {
+			return d, true
+		}
+	}
+	return util.DeviceInfo{}, false
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func draClaim(results ...string) *unstructured.Unstructured {
+	claim := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "resource.k8s.io/v1beta1",
+		"kind":       "ResourceClaim",
+		"metadata":   map[string]any{"name": "c1", "namespace": "default", "uid": "claim-uid"},
+	}}
+	if len(results) == 0 {
+		return claim
+	}
+	list := []any{}
+	for _, device := range results {
+		list = append(list, map[string]any{"request": "gpu", "driver": util.DRADriverName, "pool": "node1", "device": device})
+	}
+	claim.Object["status"] = map[string]any{
+		"allocation": map[string]any{
+			"devices": map[string]any{
+				"results": list,
+				"config": []any{
+					map[string]any{"source": "FromClaim", "opaque": map[string]any{"driver": util.DRADriverName, "parameters": map[string]any{"memory": int64(3000), "cores": int64(30)}}},
+				},
+			},
+		},
+	}
+	return claim
+}
+
+func Test_onDRAClaim(t *testing.T) {
+	s := NewScheduler()
+	s.addNode("node1", &util.NodeInfo{
+		ID: "node1",
+		Devices: []util.DeviceInfo{
+			{ID: "GPU-0", Index: 0, Count: 10, Devmem: 8192, Devcore: 100, Type: nvidia.NvidiaGPUDevice, Health: true},
+			{ID: "GPU-1", Index: 1, Count: 10, Devmem: 8192, Devcore: 100, Type: nvidia.NvidiaGPUDevice, Health: true},
+		},
+	})
+
+	// An unallocated claim holds nothing.
+	s.onDRAClaim(draClaim())
+	_, ok := s.draClaims.getPod("claim-uid")
+	assert.Equal(t, ok, false)
+
+	s.onDRAClaim(draClaim("gpu-1-4"))
+	pi, ok := s.draClaims.getPod("claim-uid")
+	assert.Equal(t, ok, true)
+	assert.Equal(t, pi.NodeID, "node1")
+	assert.DeepEqual(t, pi.Devices, util.PodDevices{nvidia.NvidiaGPUDevice: util.PodSingleDevice{{
+		{UUID: "GPU-1", Type: nvidia.NvidiaGPUDevice, Usedmem: 3000 * util.MiB, Usedcores: 30},
+	}}})
+
+	// The usage of the claim counts for device-plugin pods on the node.
+	nodes, _, err := s.getNodesUsage(&[]string{"node1"}, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "p1", Namespace: "default"}})
+	assert.NilError(t, err)
+	found := false
+	for _, d := range (*nodes)["node1"].Devices.DeviceLists {
+		if d.Device.ID == "GPU-1" {
+			found = true
+			assert.Equal(t, d.Device.Usedmem, int64(3000)*util.MiB)
+			assert.Equal(t, d.Device.Usedcores, int32(30))
+		}
+	}
+	assert.Assert(t, found)
+
+	// A slot of an unknown card is not accounted.
+	s.onDRAClaim(draClaim("gpu-0-0", "gpu-7-0"))
+	pi, ok = s.draClaims.getPod("claim-uid")
+	assert.Equal(t, ok, true)
+	assert.Equal(t, pi.Devices[nvidia.NvidiaGPUDevice][0][0].UUID, "GPU-1")
+
+	// Deallocation releases the slots.
+	s.onDRAClaim(draClaim())
+	_, ok = s.draClaims.getPod("claim-uid")
+	assert.Equal(t, ok, false)
+
+	s.onDRAClaim(draClaim("gpu-0-0", "gpu-0-1"))
+	pi, ok = s.draClaims.getPod("claim-uid")
+	assert.Equal(t, ok, true)
+	assert.Equal(t, len(pi.Devices[nvidia.NvidiaGPUDevice][0]), 2)
+	s.onDRAClaimDeleted(cache.DeletedFinalStateUnknown{Key: "default/c1", Obj: draClaim("gpu-0-0", "gpu-0-1")})
+	_, ok = s.draClaims.getPod("claim-uid")
+	assert.Equal(t, ok, false)
+}
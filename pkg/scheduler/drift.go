@@ -0,0 +1,264 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/k8sutil"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/metrics"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// deviceDrift describes a device whose recorded allocations exceed what its node advertises.
+// A device the node no longer advertises at all has zero capacity.
+type deviceDrift struct {
+	NodeID    string
+	DeviceID  string
+	Known     bool
+	Used      int32
+	Count     int32
+	Usedmem   int64
+	Totalmem  int64
+	Usedcores int32
+	Totalcore int32
+	// MemoryRatio is the MemoryOversubscriptionRatio the memory is checked against.
+	MemoryRatio float64
+	// Pods are the pods holding the device, oldest first.
+	Pods []*podInfo
+}
+
+func (d *deviceDrift) exceeded() bool {
+	return d.Used > d.Count || d.Usedmem > oversubscribedMemoryAt(d.Totalmem, d.MemoryRatio) || d.Usedcores > d.Totalcore
+}
+
+// describe tells how d exceeds the capacity of its device.
+func (d *deviceDrift) describe() string {
+	if !d.Known {
+		return fmt.Sprintf("%d allocations on a device the node doesn't advertise", d.Used)
+	}
+	return fmt.Sprintf("allocations %d/%d, memory %d/%d MiB, cores %d/%d", d.Used, d.Count, d.Usedmem/util.MiB, d.Totalmem/util.MiB, d.Usedcores, d.Totalcore)
+}
+
+// findDrift sums the recorded allocations of pods per device and returns every device of
+// nodes whose allocations exceed its advertised capacity, memory oversubscribed by memoryRatio
+// and cores overcommitted by coreRatio.
+func findDrift(nodes map[string]*util.NodeInfo, pods []*podInfo, memoryRatio, coreRatio float64) []*deviceDrift {
+	usage := make(map[string]map[string]*deviceDrift)
+	for nodeID, node := range nodes {
+		usage[nodeID] = make(map[string]*deviceDrift)
+		for _, d := range node.Devices {
+			usage[nodeID][d.ID] = &deviceDrift{
+				NodeID:      nodeID,
+				DeviceID:    d.ID,
+				Known:       true,
+				Count:       d.Count,
+				Totalmem:    util.MemoryToBytes(d.DeviceVendor, int64(d.Devmem)),
+				Totalcore:   overcommittedCores(d.Devcore, coreRatio),
+				MemoryRatio: memoryRatio,
+			}
+		}
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].AddedAt.Before(pods[j].AddedAt) })
+	for _, p := range pods {
+		devs, ok := usage[p.NodeID]
+		if !ok {
+			continue
+		}
+		held := make(map[string]bool)
+		for _, podSingle := range p.Devices {
+			for _, ctrdevs := range podSingle {
+				for _, udevice := range ctrdevs {
+					if len(udevice.UUID) == 0 {
+						continue
+					}
+					deviceID := strings.Split(udevice.UUID, "[")[0]
+					d, ok := devs[deviceID]
+					if !ok {
+						d = &deviceDrift{NodeID: p.NodeID, DeviceID: deviceID, MemoryRatio: memoryRatio}
+						devs[deviceID] = d
+					}
+					d.Used++
+					// Soft pods yield their memory, so they don't overcommit it.
+					if !p.Soft {
+						d.Usedmem += udevice.Usedmem
+					}
+					d.Usedcores += udevice.Usedcores
+					if !held[deviceID] {
+						held[deviceID] = true
+						d.Pods = append(d.Pods, p)
+					}
+				}
+			}
+		}
+	}
+	res := make([]*deviceDrift, 0)
+	for _, devs := range usage {
+		for _, d := range devs {
+			if d.exceeded() {
+				res = append(res, d)
+			}
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].NodeID != res[j].NodeID {
+			return res[i].NodeID < res[j].NodeID
+		}
+		return res[i].DeviceID < res[j].DeviceID
+	})
+	return res
+}
+
+// WatchAllocationDrift runs checkAllocationDrift every config.DriftCheckInterval until the scheduler stops.
+func (s *Scheduler) WatchAllocationDrift() {
+	if config.DriftCheckInterval <= 0 {
+		return
+	}
+	klog.InfoS("Starting allocation drift check", "interval", config.DriftCheckInterval, "autoCorrect", config.DriftAutoCorrect)
+	ticker := time.NewTicker(config.DriftCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-ticker.C:
+			s.checkAllocationDrift()
+		}
+	}
+}
+
+// checkAllocationDrift reports every device with more recorded allocations than it advertises.
+// With config.DriftAutoCorrect it first refreshes the capacity of the drifting nodes from their
+// annotations, then releases the allocations of pods which no longer exist, oldest first, until
+// the device fits again. Allocations of live pods are never released.
+func (s *Scheduler) checkAllocationDrift() {
+	// The ratios are read once, a policy reload during the pass applies to the next one.
+	memoryRatio, coreRatio := s.memoryOversubscriptionRatio(), s.coreOvercommit()
+	drifts := s.reportDrift(memoryRatio, coreRatio)
+	if len(drifts) == 0 || !config.DriftAutoCorrect {
+		return
+	}
+	refreshed := make(map[string]bool)
+	for _, d := range drifts {
+		if !refreshed[d.NodeID] {
+			refreshed[d.NodeID] = true
+			s.refreshNodeDevices(d.NodeID)
+		}
+	}
+	for _, d := range findDrift(s.nodeSnapshot(), s.ListPodsInfo(), memoryRatio, coreRatio) {
+		for _, p := range d.Pods {
+			if !d.exceeded() {
+				break
+			}
+			if s.podExists(p) {
+				continue
+			}
+			klog.InfoS("Releasing phantom allocation", "pod", klog.KRef(p.Namespace, p.Name), "uid", p.UID, "node", d.NodeID, "device", d.DeviceID, "addedAt", p.AddedAt)
+			s.releasePod(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: p.Namespace, Name: p.Name, UID: p.UID}})
+			for _, ctrdevs := range p.Devices {
+				for _, ctr := range ctrdevs {
+					for _, udevice := range ctr {
+						if strings.Split(udevice.UUID, "[")[0] == d.DeviceID {
+							d.Used--
+							if !p.Soft {
+								d.Usedmem -= udevice.Usedmem
+							}
+							d.Usedcores -= udevice.Usedcores
+						}
+					}
+				}
+			}
+		}
+		if d.exceeded() {
+			klog.Warningf("device %v on node %v still exceeds its capacity after releasing phantom allocations, the remaining pods are alive", d.DeviceID, d.NodeID)
+		}
+	}
+}
+
+// reportDrift logs and counts every drifting device.
+func (s *Scheduler) reportDrift(memoryRatio, coreRatio float64) []*deviceDrift {
+	drifts := findDrift(s.nodeSnapshot(), s.ListPodsInfo(), memoryRatio, coreRatio)
+	for _, d := range drifts {
+		pods := make([]string, 0, len(d.Pods))
+		for _, p := range d.Pods {
+			pods = append(pods, p.Namespace+"/"+p.Name)
+		}
+		klog.InfoS("Allocation drift detected", "node", d.NodeID, "device", d.DeviceID, "advertised", d.Known,
+			"used", d.Used, "count", d.Count, "usedmem", d.Usedmem, "totalmem", d.Totalmem,
+			"usedcores", d.Usedcores, "totalcores", d.Totalcore, "pods", pods)
+		metrics.AllocationDriftIncidents.WithLabelValues(d.NodeID).Inc()
+	}
+	return drifts
+}
+
+// nodeSnapshot copies the registered nodes, so the check can run without holding the node lock.
+func (s *Scheduler) nodeSnapshot() map[string]*util.NodeInfo {
+	s.nodeManager.mutex.RLock()
+	defer s.nodeManager.mutex.RUnlock()
+	res := make(map[string]*util.NodeInfo, len(s.nodes))
+	for id, n := range s.nodes {
+		res[id] = &util.NodeInfo{ID: n.ID, Node: n.Node, Devices: append([]util.DeviceInfo{}, n.Devices...)}
+	}
+	return res
+}
+
+// refreshNodeDevices re-reads the devices of nodeID from its current annotations.
+func (s *Scheduler) refreshNodeDevices(nodeID string) {
+	node, err := s.nodeLister.Get(nodeID)
+	if err != nil {
+		klog.ErrorS(err, "Failed to get node for drift correction", "node", nodeID)
+		return
+	}
+	for devhandsk, devInstance := range device.GetDevices() {
+		nodedevices, err := devInstance.GetNodeDevices(*node)
+		if err != nil {
+			continue
+		}
+		nodeInfo := &util.NodeInfo{ID: nodeID, Node: node, Devices: make([]util.DeviceInfo, 0, len(nodedevices))}
+		for _, deviceinfo := range nodedevices {
+			if deviceinfo.DeviceVendor == "" {
+				deviceinfo.DeviceVendor = devhandsk
+			}
+			nodeInfo.Devices = append(nodeInfo.Devices, *deviceinfo)
+		}
+		s.addNode(nodeID, nodeInfo)
+	}
+}
+
+// podExists reports whether the pod behind p is still present and not terminated.
+// Pods the lister fails to look up for other reasons are assumed to exist.
+func (s *Scheduler) podExists(p *podInfo) bool {
+	pod, err := s.podLister.Pods(p.Namespace).Get(p.Name)
+	if apierrors.IsNotFound(err) {
+		return false
+	}
+	if err != nil {
+		klog.ErrorS(err, "Failed to look up pod for drift correction", "pod", klog.KRef(p.Namespace, p.Name))
+		return true
+	}
+	return pod.UID == p.UID && !k8sutil.IsPodInTerminatedState(pod)
+}
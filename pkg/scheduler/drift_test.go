@@ -0,0 +1,150 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	listerscorev1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func driftPod(name string, added time.Time, uuid string, mem int64) *podInfo {
+	return &podInfo{
+		Namespace: "default",
+		Name:      name,
+		UID:       k8stypes.UID("uid-" + name),
+		NodeID:    "node1",
+		AddedAt:   added,
+		Devices: util.PodDevices{nvidia.NvidiaGPUDevice: util.PodSingleDevice{
+			{{UUID: uuid, Type: nvidia.NvidiaGPUDevice, Usedmem: mem, Usedcores: 10}},
+		}},
+	}
+}
+
+func driftNodes() map[string]*util.NodeInfo {
+	return map[string]*util.NodeInfo{
+		"node1": {ID: "node1", Devices: []util.DeviceInfo{
+			{ID: "GPU-0", Count: 10, Devmem: 1024, Devcore: 100, DeviceVendor: nvidia.NvidiaGPUDevice},
+		}},
+	}
+}
+
+func Test_findDrift(t *testing.T) {
+	now := time.Now()
+	pods := []*podInfo{
+		driftPod("b", now, "GPU-0", 600*util.MiB),
+		driftPod("a", now.Add(-time.Hour), "GPU-0", 600*util.MiB),
+		driftPod("c", now, "GPU-9", 100*util.MiB),
+	}
+	drifts := findDrift(driftNodes(), pods, 0, 0)
+	assert.Equal(t, len(drifts), 2)
+	assert.Equal(t, drifts[0].DeviceID, "GPU-0")
+	assert.Equal(t, drifts[0].Usedmem, 1200*util.MiB)
+	assert.Equal(t, drifts[0].Totalmem, 1024*util.MiB)
+	assert.Equal(t, drifts[0].Pods[0].Name, "a")
+	assert.Equal(t, drifts[1].DeviceID, "GPU-9")
+	assert.Assert(t, !drifts[1].Known)
+
+	assert.Equal(t, len(findDrift(driftNodes(), pods[:1], 0, 0)), 0)
+
+	// Cores within the overcommitted ones aren't drift.
+	cores := []*podInfo{driftPod("d", now, "GPU-0", 100*util.MiB), driftPod("e", now, "GPU-0", 100*util.MiB)}
+	for _, p := range cores {
+		p.Devices[nvidia.NvidiaGPUDevice][0][0].Usedcores = 60
+	}
+	assert.Equal(t, len(findDrift(driftNodes(), cores, 0, 0)), 1)
+	assert.Equal(t, len(findDrift(driftNodes(), cores, 0, 2)), 0)
+}
+
+func Test_checkAllocationDrift(t *testing.T) {
+	now := time.Now()
+	s := NewScheduler()
+	s.nodes = driftNodes()
+	s.nodes["node1"].Node = &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+	nodeIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	s.nodeLister = listerscorev1.NewNodeLister(nodeIndexer)
+	podIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	s.podLister = listerscorev1.NewPodLister(podIndexer)
+
+	for _, p := range []*podInfo{
+		driftPod("old-phantom", now.Add(-2*time.Hour), "GPU-0", 400*util.MiB),
+		driftPod("new-phantom", now.Add(-time.Hour), "GPU-0", 400*util.MiB),
+		driftPod("live", now, "GPU-0", 600*util.MiB),
+	} {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: p.Namespace, Name: p.Name, UID: p.UID}}
+		s.addPod(pod, p.NodeID, p.Devices)
+		s.pods[p.UID].AddedAt = p.AddedAt
+		if p.Name == "live" {
+			assert.NilError(t, podIndexer.Add(pod))
+		}
+	}
+
+	config.DriftAutoCorrect = false
+	s.checkAllocationDrift()
+	assert.Equal(t, len(s.ListPodsInfo()), 3)
+
+	config.DriftAutoCorrect = true
+	defer func() { config.DriftAutoCorrect = false }()
+	s.checkAllocationDrift()
+	_, ok := s.getPod("uid-old-phantom")
+	assert.Assert(t, !ok, "the oldest phantom is released")
+	_, ok = s.getPod("uid-new-phantom")
+	assert.Assert(t, ok, "released no more than needed")
+	_, ok = s.getPod("uid-live")
+	assert.Assert(t, ok)
+	assert.Equal(t, len(findDrift(s.nodeSnapshot(), s.ListPodsInfo(), 0, 0)), 0)
+}
+
+func Test_checkAllocationDriftDuringPolicyReload(t *testing.T) {
+	keepPolicyFlags(t)
+	s := NewScheduler()
+	s.nodes = driftNodes()
+	// Over the plain memory of the card, within it oversubscribed by 1.5.
+	pod := driftPod("best-effort", time.Now(), "GPU-0", 1200*util.MiB)
+	s.addPod(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: pod.Namespace, Name: pod.Name, UID: pod.UID}}, pod.NodeID, pod.Devices)
+
+	path := writeProfiles(t, "memoryOversubscriptionRatio: 1.5\n")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 50 {
+			content := "memoryOversubscriptionRatio: 1.5\n"
+			if i%2 == 1 {
+				content = "memoryOversubscriptionRatio: 1\n"
+			}
+			assert.Check(t, os.WriteFile(path, []byte(content), 0o644))
+			s.reloadPolicy(path)
+		}
+	}()
+	for range 50 {
+		s.checkAllocationDrift()
+	}
+	<-done
+	assert.Equal(t, len(findDrift(s.nodeSnapshot(), s.ListPodsInfo(), 1.5, 0)), 0)
+	assert.Equal(t, len(findDrift(s.nodeSnapshot(), s.ListPodsInfo(), 1, 0)), 1)
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// eccUnhealthy returns why a card with the ECC errors e takes no new pods, "" if it does.
+func eccUnhealthy(e *util.DeviceECCErrors) string {
+	if e == nil {
+		return ""
+	}
+	if config.ECCUncorrectedThreshold > 0 && e.RecentUncorrected >= uint64(config.ECCUncorrectedThreshold) {
+		return fmt.Sprintf("%d uncorrected ECC errors in the last 24 hours, the threshold is %d", e.RecentUncorrected, config.ECCUncorrectedThreshold)
+	}
+	if config.ECCCorrectedThreshold > 0 && e.RecentCorrected >= uint64(config.ECCCorrectedThreshold) {
+		return fmt.Sprintf("%d corrected ECC errors in the last 24 hours, the threshold is %d", e.RecentCorrected, config.ECCCorrectedThreshold)
+	}
+	return ""
+}
+
+// preferFewECCErrors raises the score of cards with fewer recent ECC errors, scaled between the
+// card with the fewest and the one with the most on the node. Cards without ECC counts are left
+// untouched, and so are nodes whose cards all have as many errors.
+func preferFewECCErrors(node *NodeUsage, weight float32) {
+	errors := func(d *util.DeviceUsage) (uint64, bool) {
+		if d.ECCErrors == nil {
+			return 0, false
+		}
+		return d.ECCErrors.RecentCorrected + d.ECCErrors.RecentUncorrected, true
+	}
+	var fewest, most uint64
+	found := false
+	for _, d := range node.Devices.DeviceLists {
+		n, ok := errors(d.Device)
+		if !ok {
+			continue
+		}
+		if !found || n < fewest {
+			fewest = n
+		}
+		most = max(most, n)
+		found = true
+	}
+	if fewest == most {
+		return
+	}
+	for _, d := range node.Devices.DeviceLists {
+		if n, ok := errors(d.Device); ok {
+			d.AddPreference(node.Devices.Policy, weight*float32(most-n)/float32(most-fewest))
+		}
+	}
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func eccThresholds(t *testing.T, corrected, uncorrected int) {
+	prevCorrected, prevUncorrected := config.ECCCorrectedThreshold, config.ECCUncorrectedThreshold
+	t.Cleanup(func() { config.ECCCorrectedThreshold, config.ECCUncorrectedThreshold = prevCorrected, prevUncorrected })
+	config.ECCCorrectedThreshold, config.ECCUncorrectedThreshold = corrected, uncorrected
+}
+
+func Test_eccUnhealthy(t *testing.T) {
+	eccThresholds(t, 100, 1)
+	assert.Equal(t, eccUnhealthy(nil), "")
+	assert.Equal(t, eccUnhealthy(&util.DeviceECCErrors{Corrected: 500, Uncorrected: 3, RecentCorrected: 99}), "")
+	assert.Equal(t, eccUnhealthy(&util.DeviceECCErrors{RecentCorrected: 100}), "100 corrected ECC errors in the last 24 hours, the threshold is 100")
+	assert.Equal(t, eccUnhealthy(&util.DeviceECCErrors{RecentCorrected: 100, RecentUncorrected: 2}), "2 uncorrected ECC errors in the last 24 hours, the threshold is 1")
+
+	eccThresholds(t, 0, 0)
+	assert.Equal(t, eccUnhealthy(&util.DeviceECCErrors{RecentCorrected: 1000, RecentUncorrected: 10}), "")
+}
+
+func Test_eccErrorsPlacement(t *testing.T) {
+	prev := device.ActiveConfig()
+	initTFLOPSDevices(t)
+	defer func() { assert.NilError(t, device.InitDevicesWithConfig(prev)) }()
+	prevWeight := config.ECCErrorWeight
+	defer func() { config.ECCErrorWeight = prevWeight }()
+	config.ECCErrorWeight = 10
+	eccThresholds(t, 0, 1)
+
+	// GPU-0 has the most memory, so the spread policy picks it unless its ECC errors count.
+	newScheduler := func(errs ...*util.DeviceECCErrors) *Scheduler {
+		s := NewScheduler()
+		info := &util.NodeInfo{ID: "node1", Node: &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}}
+		for i, e := range errs {
+			info.Devices = append(info.Devices, util.DeviceInfo{
+				ID: "GPU-" + string(rune('0'+i)), Index: uint(i), Count: 10, Devmem: 8000 - int32(i)*1000, Devcore: 100,
+				Type: "NVIDIA-Tesla T4", Health: true, DeviceVendor: nvidia.NvidiaGPUDevice, ECCErrors: e,
+			})
+		}
+		s.addNode("node1", info)
+		return s
+	}
+	nums := util.PodDeviceRequests{{nvidia.NvidiaGPUDevice: util.ContainerDeviceRequest{Nums: 1, Type: nvidia.NvidiaGPUDevice, Memreq: 1000, Coresreq: 10}}}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "trainer", Namespace: "default"}}
+	place := func(s *Scheduler) string {
+		names := []string{"node1"}
+		nodes, failedNodes, err := s.getNodesUsage(&names, pod)
+		assert.NilError(t, err)
+		for _, node := range *nodes {
+			node.Devices.Policy = util.GPUSchedulerPolicySpread.String()
+		}
+		res, err := s.calcScore(nodes, nums, nil, pod, failedNodes)
+		assert.NilError(t, err)
+		if len(res.NodeList) == 0 {
+			return ""
+		}
+		return res.NodeList[0].Devices[nvidia.NvidiaGPUDevice][0][0].UUID
+	}
+
+	assert.Equal(t, place(newScheduler(nil, nil)), "GPU-0")
+	// Recent corrected errors steer the pod to the other card, old ones don't.
+	assert.Equal(t, place(newScheduler(&util.DeviceECCErrors{Corrected: 50, RecentCorrected: 50}, &util.DeviceECCErrors{})), "GPU-1")
+	assert.Equal(t, place(newScheduler(&util.DeviceECCErrors{Corrected: 50}, &util.DeviceECCErrors{})), "GPU-0")
+	// A card over the threshold takes no new pods at all.
+	assert.Equal(t, place(newScheduler(&util.DeviceECCErrors{Uncorrected: 1, RecentUncorrected: 1}, nil)), "GPU-1")
+	assert.Equal(t, place(newScheduler(&util.DeviceECCErrors{RecentUncorrected: 1})), "")
+
+	config.ECCErrorWeight = 0
+	assert.Equal(t, place(newScheduler(&util.DeviceECCErrors{Corrected: 50, RecentCorrected: 50}, &util.DeviceECCErrors{})), "GPU-0")
+}
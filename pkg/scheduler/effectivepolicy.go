@@ -0,0 +1,110 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	sigsyaml "sigs.k8s.io/yaml"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+)
+
+// EffectivePolicy is the scheduling policy the scheduler currently applies, merged from
+// its flags, the scheduler profiles and the device config.
+type EffectivePolicy struct {
+	SchedulerName       string `json:"schedulerName"`
+	NodeSchedulerPolicy string `json:"nodeSchedulerPolicy"`
+	GPUSchedulerPolicy  string `json:"gpuSchedulerPolicy"`
+	// Weights are the weights of the soft scores, 0 means the score is disabled.
+	Weights map[string]float64 `json:"weights"`
+	// Defaults are applied to containers which request a device without memory, cores or count.
+	Defaults PolicyDefaults `json:"defaults"`
+	// MemoryOversubscriptionRatio is how many times the memory of a card best-effort pods may reserve.
+	MemoryOversubscriptionRatio float64 `json:"memoryOversubscriptionRatio"`
+	// CoreOvercommit multiplies the cores of every card for the pods of no profile overriding it.
+	CoreOvercommit float64 `json:"coreOvercommit"`
+	// Profiles override the global policy for the pods of other kube-scheduler profiles.
+	Profiles []Profile `json:"profiles"`
+	// Devices is the device config the devices were initialized with, keyed like the device ConfigMap.
+	// It holds the per-device-type settings such as deviceMemoryScaling and deviceSplitCount.
+	Devices json.RawMessage `json:"devices,omitempty"`
+	// PolicyFile is the state of the policy file, unset without --profile-config-file.
+	PolicyFile *PolicyFileStatus `json:"policyFile,omitempty"`
+}
+
+type PolicyDefaults struct {
+	Memory      int32 `json:"memory"`
+	Cores       int32 `json:"cores"`
+	ResourceNum int32 `json:"resourceNum"`
+}
+
+// EffectivePolicy returns the policy the scheduler applies right now.
+func (s *Scheduler) EffectivePolicy() (EffectivePolicy, error) {
+	s.policyMutex.RLock()
+	defer s.policyMutex.RUnlock()
+	p := EffectivePolicy{
+		SchedulerName:       config.SchedulerName,
+		NodeSchedulerPolicy: config.NodeSchedulerPolicy,
+		GPUSchedulerPolicy:  config.GPUSchedulerPolicy,
+		Weights: map[string]float64{
+			"imageLocality":    config.ImageLocalityWeight,
+			"perfTier":         config.PerfTierWeight,
+			"utilization":      config.UtilizationWeight,
+			"pcieContention":   config.PCIeContentionWeight,
+			"noiseTolerance":   config.NoiseToleranceWeight,
+			"memoryType":       config.MemoryTypeWeight,
+			"eccErrors":        config.ECCErrorWeight,
+			"performanceState": config.PerformanceStateWeight,
+			"temperature":      config.GPUTemperatureWeight,
+			"fairnessAging":    config.FairnessAgingWeight,
+		},
+		Defaults: PolicyDefaults{
+			Memory:      config.DefaultMem,
+			Cores:       config.DefaultCores,
+			ResourceNum: config.DefaultResourceNum,
+		},
+		MemoryOversubscriptionRatio: config.MemoryOversubscriptionRatio,
+		CoreOvercommit:              config.CoreOvercommit,
+		Profiles:                    make([]Profile, 0, len(s.profiles)),
+	}
+	for _, profile := range s.profiles {
+		p.Profiles = append(p.Profiles, profile)
+	}
+	slices.SortFunc(p.Profiles, func(a, b Profile) int {
+		return strings.Compare(a.SchedulerName, b.SchedulerName)
+	})
+	if s.policyFile.Path != "" {
+		status := s.policyFile
+		p.PolicyFile = &status
+	}
+	if cfg := device.ActiveConfig(); cfg != nil {
+		// The device config only carries yaml tags, so it goes through yaml to keep the ConfigMap keys.
+		data, err := yaml.Marshal(cfg)
+		if err != nil {
+			return p, err
+		}
+		if p.Devices, err = sigsyaml.YAMLToJSON(data); err != nil {
+			return p, err
+		}
+	}
+	return p, nil
+}
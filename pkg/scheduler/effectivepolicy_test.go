@@ -0,0 +1,62 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"encoding/json"
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+)
+
+func TestEffectivePolicy(t *testing.T) {
+	device.InitDefaultDevices()
+	weight := config.UtilizationWeight
+	config.UtilizationWeight = 2
+	defer func() { config.UtilizationWeight = weight }()
+
+	s := NewScheduler()
+	assert.NilError(t, s.LoadProfiles(writeProfiles(t, `
+profiles:
+  - schedulerName: online
+    gpuSchedulerPolicy: spread
+  - schedulerName: batch
+    memoryOvercommit: 1.5
+    maxSharers: 2
+`)))
+	p, err := s.EffectivePolicy()
+	assert.NilError(t, err)
+	assert.Equal(t, p.NodeSchedulerPolicy, config.NodeSchedulerPolicy)
+	assert.Equal(t, p.Weights["utilization"], 2.0)
+	assert.Equal(t, len(p.Profiles), 2)
+	assert.Equal(t, p.Profiles[0].SchedulerName, "batch")
+
+	data, err := json.Marshal(p)
+	assert.NilError(t, err)
+	var decoded struct {
+		Profiles []map[string]any `json:"profiles"`
+		Devices  struct {
+			Nvidia map[string]any `json:"nvidia"`
+		} `json:"devices"`
+	}
+	assert.NilError(t, json.Unmarshal(data, &decoded))
+	assert.DeepEqual(t, decoded.Profiles[1], map[string]any{"schedulerName": "online", "gpuSchedulerPolicy": "spread"})
+	assert.Equal(t, decoded.Devices.Nvidia["resourceCountName"], "nvidia.com/gpu")
+}
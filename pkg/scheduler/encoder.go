@@ -0,0 +1,63 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"strings"
+
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// addEncoderUsage counts a pod using the encoders of its cards as mode, see util.Encoder,
+// once on every card of node it holds.
+func addEncoderUsage(node *NodeUsage, pd util.PodDevices, mode string) {
+	cards := make(map[string]bool)
+	for _, podSingle := range pd {
+		for _, ctrdevs := range podSingle {
+			for _, udevice := range ctrdevs {
+				cards[strings.Split(udevice.UUID, "[")[0]] = true
+			}
+		}
+	}
+	for _, d := range node.Devices.DeviceLists {
+		if !cards[d.Device.ID] {
+			continue
+		}
+		d.Device.EncoderPods++
+		if mode == util.EncoderExclusive {
+			d.Device.EncoderExclusive = true
+		}
+	}
+}
+
+// checkEncoder returns why the encoders of d can't be used as the pod with annos asks,
+// "" if they can or the pod doesn't use them.
+func checkEncoder(annos map[string]string, d *util.DeviceUsage) string {
+	mode, ok := annos[util.Encoder]
+	if !ok {
+		return ""
+	}
+	switch {
+	case !d.Encoder:
+		return "card has no NVENC encoder"
+	case d.EncoderExclusive:
+		return "NVENC encoders of the card are held exclusively by another pod"
+	case mode == util.EncoderExclusive && d.EncoderPods > 0:
+		return "NVENC encoders of the card are used by another pod, exclusive access can't be granted"
+	}
+	return ""
+}
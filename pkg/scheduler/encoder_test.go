@@ -0,0 +1,86 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/policy"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func Test_calcScoreEncoder(t *testing.T) {
+	prev := device.ActiveConfig()
+	initTFLOPSDevices(t)
+	defer func() { assert.NilError(t, device.InitDevicesWithConfig(prev)) }()
+
+	// GPU-0 has encoders and holds a pod using them, GPU-1 has none.
+	newNodes := func(holder string) map[string]*NodeUsage {
+		devices := policy.DeviceUsageList{Policy: util.GPUSchedulerPolicySpread.String()}
+		for i, encoder := range []bool{true, false} {
+			devices.DeviceLists = append(devices.DeviceLists, &policy.DeviceListsScore{Device: &util.DeviceUsage{
+				ID: fmt.Sprintf("GPU-%d", i), Type: "NVIDIA-Tesla T4", Count: 10, Totalmem: 8000 * util.MiB, Totalcore: 100, Health: true, Encoder: encoder,
+			}})
+		}
+		node := &NodeUsage{Node: &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}, Devices: devices}
+		held := util.PodDevices{nvidia.NvidiaGPUDevice: util.PodSingleDevice{{{UUID: "GPU-0", Usedmem: 1000 * util.MiB, Usedcores: 10}}}}
+		addPodUsage(node, held)
+		if holder != "" {
+			addEncoderUsage(node, held, holder)
+		}
+		return map[string]*NodeUsage{"node1": node}
+	}
+	nums := util.PodDeviceRequests{{nvidia.NvidiaGPUDevice: util.ContainerDeviceRequest{Nums: 1, Type: nvidia.NvidiaGPUDevice, Memreq: 1000 * util.MiB, Coresreq: 10}}}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "transcoder", Namespace: "default"}}
+	place := func(holder string, annos map[string]string) (string, string) {
+		nodes := newNodes(holder)
+		failedNodes := map[string]string{}
+		res, err := NewScheduler().calcScore(&nodes, nums, annos, pod, failedNodes)
+		assert.NilError(t, err)
+		if len(res.NodeList) == 0 {
+			return "", failedNodes["node1"]
+		}
+		return res.NodeList[0].Devices[nvidia.NvidiaGPUDevice][0][0].UUID, ""
+	}
+	exclusive := map[string]string{util.Encoder: util.EncoderExclusive}
+	shared := map[string]string{util.Encoder: util.EncoderShared}
+
+	// Exclusive access is granted on the card with encoders while no other pod uses them,
+	// whatever else shares the card.
+	card, _ := place("", exclusive)
+	assert.Equal(t, card, "GPU-0")
+	_, reason := place(util.EncoderShared, exclusive)
+	assert.Equal(t, reason, "node not fit pod, NVENC encoders of the card are used by another pod, exclusive access can't be granted")
+
+	card, _ = place(util.EncoderShared, shared)
+	assert.Equal(t, card, "GPU-0")
+	_, reason = place(util.EncoderExclusive, shared)
+	assert.Equal(t, reason, "node not fit pod, NVENC encoders of the card are held exclusively by another pod")
+
+	// Pods without encoder use still share the card of an exclusive encoder pod.
+	nodes := newNodes(util.EncoderExclusive)
+	res, err := NewScheduler().calcScore(&nodes, nums, map[string]string{nvidia.GPUUseUUID: "GPU-0"}, pod, map[string]string{})
+	assert.NilError(t, err)
+	assert.Equal(t, len(res.NodeList), 1)
+}
@@ -18,6 +18,8 @@ package scheduler
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
 
@@ -40,17 +42,30 @@ const (
 	EventReasonBindingFailed = "BindingFailed"
 	// EventReasonBindingSucceed indicates that  binding succeed.
 	EventReasonBindingSucceed = "BindingSucceed"
+
+	// EventReasonDeviceCordoned indicates that a device of a node is not used for new pods.
+	EventReasonDeviceCordoned = "DeviceCordoned"
+
+	// EventReasonNoHealthyGPU indicates that every GPU of a node is unhealthy.
+	EventReasonNoHealthyGPU = "NoHealthyGPU"
+	// EventReasonGPUHealthRecovered indicates that a node without healthy GPU got one back.
+	EventReasonGPUHealthRecovered = "GPUHealthRecovered"
 )
 
 func (s *Scheduler) addAllEventHandlers() {
 
 	eventBroadcaster := record.NewBroadcaster()
+	if config.EventAggregationWindow > 0 {
+		eventBroadcaster = record.NewBroadcasterWithCorrelatorOptions(record.CorrelatorOptions{
+			MaxIntervalInSeconds: int(config.EventAggregationWindow.Seconds()),
+		})
+	}
 	eventBroadcaster.StartStructuredLogging(0)
 	eventBroadcaster.StartRecordingToSink(&v1core.EventSinkImpl{Interface: s.kubeClient.CoreV1().Events(metav1.NamespaceAll)})
 	schema := runtime.NewScheme()
 
 	_ = clientgoscheme.AddToScheme(schema)
-	s.eventRecorder = eventBroadcaster.NewRecorder(schema, corev1.EventSource{Component: config.SchedulerName})
+	s.eventRecorder = newEventAggregator(eventBroadcaster.NewRecorder(schema, corev1.EventSource{Component: config.SchedulerName}), config.EventAggregationWindow)
 }
 
 func (s *Scheduler) recordScheduleBindingResultEvent(pod *corev1.Pod, eventReason string, nodeResult []string, schedulerErr error) {
@@ -76,3 +91,46 @@ func (s *Scheduler) recordScheduleFilterResultEvent(pod *corev1.Pod, eventReason
 		s.eventRecorder.Event(pod, corev1.EventTypeWarning, eventReason, schedulerErr.Error())
 	}
 }
+
+// recordDeviceCordonedEvent records on node that device is left out of scheduling for reason.
+func (s *Scheduler) recordDeviceCordonedEvent(node *corev1.Node, device string, reason string) {
+	if node == nil || s.eventRecorder == nil {
+		return
+	}
+	s.eventRecorder.Eventf(node, corev1.EventTypeWarning, EventReasonDeviceCordoned, "Device %s is not used for new pods: %s", device, reason)
+}
+
+// recordGPUHealthEvent records on node that its GPUs became all unhealthy or recovered.
+func (s *Scheduler) recordGPUHealthEvent(node *corev1.Node, eventType, reason, message string) {
+	if node == nil || s.eventRecorder == nil {
+		return
+	}
+	s.eventRecorder.Event(node, eventType, reason, message)
+}
+
+// summarizeFailedNodes counts the nodes of failedNodes by reason, e.g.
+// "0/5 nodes are available: 3 node not fit pod, 2 node unregistered". The part of a
+// reason after ": " is a detail of the node and is left out, so the summary stays
+// the same for every pod rejected for the same reasons.
+func summarizeFailedNodes(failedNodes map[string]string, nodes int) string {
+	counts := make(map[string]int)
+	for _, reason := range failedNodes {
+		reason, _, _ = strings.Cut(reason, ": ")
+		counts[reason]++
+	}
+	reasons := make([]string, 0, len(counts))
+	for reason := range counts {
+		reasons = append(reasons, reason)
+	}
+	sort.Slice(reasons, func(i, j int) bool {
+		if counts[reasons[i]] != counts[reasons[j]] {
+			return counts[reasons[i]] > counts[reasons[j]]
+		}
+		return reasons[i] < reasons[j]
+	})
+	parts := make([]string, 0, len(reasons))
+	for _, reason := range reasons {
+		parts = append(parts, fmt.Sprintf("%d %s", counts[reason], reason))
+	}
+	return fmt.Sprintf("0/%d nodes are available: %s", nodes, strings.Join(parts, ", "))
+}
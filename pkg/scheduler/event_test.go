@@ -204,3 +204,15 @@ func TestRecordScheduleFilterResultEvent(t *testing.T) {
 		})
 	}
 }
+
+func TestSummarizeFailedNodes(t *testing.T) {
+	failedNodes := map[string]string{
+		"node-1": "node not fit pod",
+		"node-2": "NVLink fabric unhealthy, multi-GPU pods are not placed: GPU-0 fabric registration in progress",
+		"node-3": "node not fit pod",
+		"node-4": "NVLink fabric unhealthy, multi-GPU pods are not placed: GPU-3 fabric registration in progress",
+		"node-5": "node unregistered",
+	}
+	assert.Equal(t, "0/5 nodes are available: 2 NVLink fabric unhealthy, multi-GPU pods are not placed, 2 node not fit pod, 1 node unregistered",
+		summarizeFailedNodes(failedNodes, 5))
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+)
+
+type eventKey struct {
+	uid       types.UID
+	kind      string
+	namespace string
+	name      string
+	eventType string
+	reason    string
+	message   string
+}
+
+type eventCount struct {
+	first      time.Time
+	suppressed int
+}
+
+// eventAggregator collapses identical events on the same object within window before they
+// reach the API server: the first one is recorded, repeats are counted, and the first one
+// after the window carries the number of repeats. The client-go correlator behind the
+// recorder still patches the count of an event it has seen, but every patch is a write to
+// etcd, which adds up when a batch of pending pods is retried every scheduling cycle.
+type eventAggregator struct {
+	recorder record.EventRecorder
+	window   time.Duration
+	now      func() time.Time
+
+	mutex     sync.Mutex
+	seen      map[eventKey]*eventCount
+	lastSweep time.Time
+}
+
+var _ record.EventRecorder = &eventAggregator{}
+
+// newEventAggregator wraps recorder, a window of 0 returns recorder as is.
+func newEventAggregator(recorder record.EventRecorder, window time.Duration) record.EventRecorder {
+	if window <= 0 {
+		return recorder
+	}
+	return &eventAggregator{
+		recorder: recorder,
+		window:   window,
+		now:      time.Now,
+		seen:     make(map[eventKey]*eventCount),
+	}
+}
+
+func (a *eventAggregator) Event(object runtime.Object, eventtype, reason, message string) {
+	if msg, ok := a.admit(object, eventtype, reason, message); ok {
+		a.recorder.Event(object, eventtype, reason, msg)
+	}
+}
+
+func (a *eventAggregator) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	a.Event(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func (a *eventAggregator) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	message := fmt.Sprintf(messageFmt, args...)
+	if msg, ok := a.admit(object, eventtype, reason, message); ok {
+		a.recorder.AnnotatedEventf(object, annotations, eventtype, reason, "%s", msg)
+	}
+}
+
+// admit reports whether the event is to be recorded, and the message to record it with.
+func (a *eventAggregator) admit(object runtime.Object, eventtype, reason, message string) (string, bool) {
+	key := eventKey{kind: fmt.Sprintf("%T", object), eventType: eventtype, reason: reason, message: message}
+	if accessor, err := meta.Accessor(object); err == nil {
+		key.uid, key.namespace, key.name = accessor.GetUID(), accessor.GetNamespace(), accessor.GetName()
+	}
+	now := a.now()
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.sweep(now)
+	entry, ok := a.seen[key]
+	if ok && now.Sub(entry.first) < a.window {
+		entry.suppressed++
+		return "", false
+	}
+	if ok && entry.suppressed > 0 {
+		message = fmt.Sprintf("%s (repeated %d times in the last %v)", message, entry.suppressed, now.Sub(entry.first).Round(time.Second))
+	}
+	a.seen[key] = &eventCount{first: now}
+	return message, true
+}
+
+// sweep forgets events whose window expired without repeats, and the repeats of events
+// which didn't occur again within another window, at most once per window.
+func (a *eventAggregator) sweep(now time.Time) {
+	if now.Sub(a.lastSweep) < a.window {
+		return
+	}
+	a.lastSweep = now
+	for key, entry := range a.seen {
+		age := now.Sub(entry.first)
+		if (entry.suppressed == 0 && age >= a.window) || age >= 2*a.window {
+			delete(a.seen, key)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func drainEvents(recorder *record.FakeRecorder) []string {
+	events := make([]string, 0)
+	for {
+		select {
+		case e := <-recorder.Events:
+			events = append(events, e)
+		default:
+			return events
+		}
+	}
+}
+
+func TestEventAggregator(t *testing.T) {
+	fake := record.NewFakeRecorder(100)
+	now := time.Unix(0, 0)
+	a := newEventAggregator(fake, time.Minute).(*eventAggregator)
+	a.now = func() time.Time { return now }
+	p1 := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "p1", Namespace: "default", UID: "uid-1"}}
+	p2 := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "p2", Namespace: "default", UID: "uid-2"}}
+
+	for range 5 {
+		a.Event(p1, corev1.EventTypeWarning, EventReasonFilteringFailed, "no available node")
+		now = now.Add(time.Second)
+	}
+	a.Event(p2, corev1.EventTypeWarning, EventReasonFilteringFailed, "no available node")
+	a.Event(p1, corev1.EventTypeWarning, EventReasonFilteringFailed, "another reason")
+	assert.Equal(t, []string{
+		"Warning FilteringFailed no available node",
+		"Warning FilteringFailed no available node",
+		"Warning FilteringFailed another reason",
+	}, drainEvents(fake))
+
+	now = now.Add(time.Minute)
+	a.Eventf(p1, corev1.EventTypeWarning, EventReasonFilteringFailed, "no available %s", "node")
+	assert.Equal(t, []string{"Warning FilteringFailed no available node (repeated 4 times in the last 1m5s)"}, drainEvents(fake))
+
+	// Events without repeats are forgotten once their window expired.
+	now = now.Add(time.Minute)
+	a.Event(p2, corev1.EventTypeNormal, EventReasonFilteringSucceed, "placed")
+	assert.Equal(t, 1, len(a.seen))
+
+	assert.Equal(t, record.EventRecorder(fake), newEventAggregator(fake, 0))
+}
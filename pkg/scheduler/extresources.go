@@ -0,0 +1,223 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+const (
+	extendedResourcePrefix = "hami.io/"
+	// gpumemResourceSuffix is the suffix of the memory of a device type, in MiB.
+	gpumemResourceSuffix   = "-gpumem"
+	gpucoresResourceSuffix = "-gpucores"
+	// usedResourceSuffix is appended to a resource for the part of it allocated to pods.
+	usedResourceSuffix = "-used"
+
+	// extendedResourceResync is how often the extended resources of all nodes are checked
+	// even if no allocation changed.
+	extendedResourceResync = time.Minute
+)
+
+// resourceExporter publishes the devices of every node per device type as extended resources
+// of the node, for tools which don't read HAMi annotations. A nil *resourceExporter does nothing.
+type resourceExporter struct {
+	notify chan struct{}
+}
+
+func newResourceExporter(enabled bool) *resourceExporter {
+	if !enabled {
+		return nil
+	}
+	return &resourceExporter{notify: make(chan struct{}, 1)}
+}
+
+// changed tells the exporter that allocations or devices changed.
+func (e *resourceExporter) changed() {
+	if e == nil {
+		return
+	}
+	select {
+	case e.notify <- struct{}{}:
+	default:
+	}
+}
+
+// deviceTypeResourceName returns the extended resource of deviceType with suffix, e.g.
+// hami.io/nvidia-a100-sxm4-40gb-gpumem.
+func deviceTypeResourceName(deviceType, suffix string) corev1.ResourceName {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(deviceType) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	name := strings.TrimSuffix(b.String(), "-")
+	// The name part of a qualified name is at most 63 characters.
+	if maxLen := 63 - len(suffix); len(name) > maxLen {
+		name = strings.TrimSuffix(name[:maxLen], "-")
+	}
+	return corev1.ResourceName(extendedResourcePrefix + name + suffix)
+}
+
+// isExportedResource reports whether name is an extended resource published by the exporter.
+func isExportedResource(name corev1.ResourceName) bool {
+	if !strings.HasPrefix(string(name), extendedResourcePrefix) {
+		return false
+	}
+	n := strings.TrimSuffix(string(name), usedResourceSuffix)
+	return strings.HasSuffix(n, gpumemResourceSuffix) || strings.HasSuffix(n, gpucoresResourceSuffix)
+}
+
+// nodeExtendedResources returns the memory, in MiB, and the cores of the devices of node per
+// device type, and the part of them allocated to pods, counted as the scheduler counts them.
+func nodeExtendedResources(node *util.NodeInfo, pods []*podInfo) corev1.ResourceList {
+	typeOf := make(map[string]string, len(node.Devices))
+	mem := make(map[string]int64)
+	cores := make(map[string]int64)
+	usedMem := make(map[string]int64)
+	usedCores := make(map[string]int64)
+	for _, d := range node.Devices {
+		typeOf[d.ID] = d.Type
+		mem[d.Type] += util.MemoryToBytes(d.DeviceVendor, int64(d.Devmem))
+		cores[d.Type] += int64(d.Devcore)
+	}
+	for _, p := range pods {
+		if p.NodeID != node.ID {
+			continue
+		}
+		for _, podSingle := range p.Devices {
+			for _, ctrdevs := range podSingle {
+				for _, udevice := range ctrdevs {
+					t, ok := typeOf[strings.Split(udevice.UUID, "[")[0]]
+					if !ok {
+						continue
+					}
+					if p.Soft {
+						usedMem[t] += softMemory(p, udevice)
+					} else {
+						usedMem[t] += udevice.Usedmem
+					}
+					usedCores[t] += int64(udevice.Usedcores)
+				}
+			}
+		}
+	}
+	res := make(corev1.ResourceList, 4*len(mem))
+	for t := range mem {
+		res[deviceTypeResourceName(t, gpumemResourceSuffix)] = *resource.NewQuantity(mem[t]/util.MiB, resource.DecimalSI)
+		res[deviceTypeResourceName(t, gpumemResourceSuffix+usedResourceSuffix)] = *resource.NewQuantity(usedMem[t]/util.MiB, resource.DecimalSI)
+		res[deviceTypeResourceName(t, gpucoresResourceSuffix)] = *resource.NewQuantity(cores[t], resource.DecimalSI)
+		res[deviceTypeResourceName(t, gpucoresResourceSuffix+usedResourceSuffix)] = *resource.NewQuantity(usedCores[t], resource.DecimalSI)
+	}
+	return res
+}
+
+// extendedResourcesPatch returns the merge patch of the status of node setting the capacity
+// and allocatable of the exported resources to want, or nil if they are already.
+func extendedResourcesPatch(node *corev1.Node, want corev1.ResourceList) []byte {
+	capacity := make(map[corev1.ResourceName]any)
+	allocatable := make(map[corev1.ResourceName]any)
+	for name, q := range want {
+		if cur, ok := node.Status.Capacity[name]; !ok || cur.Cmp(q) != 0 {
+			capacity[name] = q.String()
+		}
+		if cur, ok := node.Status.Allocatable[name]; !ok || cur.Cmp(q) != 0 {
+			allocatable[name] = q.String()
+		}
+	}
+	for name := range node.Status.Capacity {
+		if _, ok := want[name]; !ok && isExportedResource(name) {
+			capacity[name] = nil
+		}
+	}
+	for name := range node.Status.Allocatable {
+		if _, ok := want[name]; !ok && isExportedResource(name) {
+			allocatable[name] = nil
+		}
+	}
+	if len(capacity) == 0 && len(allocatable) == 0 {
+		return nil
+	}
+	patch, _ := json.Marshal(map[string]any{"status": map[string]any{"capacity": capacity, "allocatable": allocatable}})
+	return patch
+}
+
+// WatchNodeExtendedResources keeps the extended resources of the nodes up to date.
+func (s *Scheduler) WatchNodeExtendedResources() {
+	if s.resources == nil {
+		return
+	}
+	klog.InfoS("Publishing device types as node extended resources")
+	ticker := time.NewTicker(extendedResourceResync)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-s.resources.notify:
+		case <-ticker.C:
+		}
+		s.exportNodeExtendedResources()
+	}
+}
+
+// exportNodeExtendedResources patches the status of every node whose extended resources
+// differ from the devices registered for it and the allocations on them.
+func (s *Scheduler) exportNodeExtendedResources() {
+	nodes, err := s.ListNodes()
+	if err != nil {
+		klog.ErrorS(err, "Failed to list nodes for extended resources")
+		return
+	}
+	pods := s.ListPodsInfo()
+	if s.draClaims != nil {
+		pods = append(pods, s.draClaims.ListPodsInfo()...)
+	}
+	for nodeID, info := range nodes {
+		node, err := s.nodeLister.Get(nodeID)
+		if err != nil {
+			klog.V(4).InfoS("Node not found for extended resources", "node", nodeID, "err", err)
+			continue
+		}
+		patch := extendedResourcesPatch(node, nodeExtendedResources(info, pods))
+		if patch == nil {
+			continue
+		}
+		if _, err := s.kubeClient.CoreV1().Nodes().Patch(context.Background(), nodeID, k8stypes.MergePatchType, patch, metav1.PatchOptions{}, "status"); err != nil {
+			klog.ErrorS(err, "Failed to patch node extended resources", "node", nodeID)
+			continue
+		}
+		klog.V(4).InfoS("Updated node extended resources", "node", nodeID, "patch", string(patch))
+	}
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	listerscorev1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func Test_deviceTypeResourceName(t *testing.T) {
+	assert.Equal(t, deviceTypeResourceName("NVIDIA-NVIDIA A100-SXM4-40GB", gpumemResourceSuffix), corev1.ResourceName("hami.io/nvidia-nvidia-a100-sxm4-40gb-gpumem"))
+	assert.Equal(t, deviceTypeResourceName("MLU370 (X8)", gpucoresResourceSuffix+usedResourceSuffix), corev1.ResourceName("hami.io/mlu370-x8-gpucores-used"))
+	long := deviceTypeResourceName(strings.Repeat("a", 100), gpumemResourceSuffix)
+	assert.Equal(t, len(strings.TrimPrefix(string(long), extendedResourcePrefix)), 63)
+
+	assert.Assert(t, isExportedResource("hami.io/nvidia-t4-gpumem-used"))
+	assert.Assert(t, !isExportedResource("hami.io/vgpu"))
+	assert.Assert(t, !isExportedResource("example.com/t4-gpumem"))
+}
+
+func extendedResourcesNode() *util.NodeInfo {
+	return &util.NodeInfo{
+		ID: "node1",
+		Devices: []util.DeviceInfo{
+			{ID: "GPU-0", Count: 10, Devmem: 40960, Devcore: 100, Type: "NVIDIA-A100", DeviceVendor: nvidia.NvidiaGPUDevice},
+			{ID: "GPU-1", Count: 10, Devmem: 40960, Devcore: 100, Type: "NVIDIA-A100", DeviceVendor: nvidia.NvidiaGPUDevice},
+			{ID: "GPU-2", Count: 10, Devmem: 15360, Devcore: 100, Type: "NVIDIA-Tesla T4", DeviceVendor: nvidia.NvidiaGPUDevice},
+		},
+	}
+}
+
+func Test_nodeExtendedResources(t *testing.T) {
+	pods := []*podInfo{
+		{NodeID: "node1", SoftLimit: -1, Devices: util.PodDevices{nvidia.NvidiaGPUDevice: util.PodSingleDevice{
+			{{UUID: "GPU-0", Usedmem: 10240 * util.MiB, Usedcores: 30}, {UUID: "GPU-1", Usedmem: 10240 * util.MiB, Usedcores: 30}},
+		}}},
+		{NodeID: "node1", Soft: true, SoftLimit: 1024 * util.MiB, Devices: util.PodDevices{nvidia.NvidiaGPUDevice: util.PodSingleDevice{
+			{{UUID: "GPU-2", Usedmem: 4096 * util.MiB, Usedcores: 10}},
+		}}},
+		{NodeID: "node2", SoftLimit: -1, Devices: util.PodDevices{nvidia.NvidiaGPUDevice: util.PodSingleDevice{
+			{{UUID: "GPU-0", Usedmem: 4096 * util.MiB}},
+		}}},
+	}
+	res := nodeExtendedResources(extendedResourcesNode(), pods)
+	want := map[corev1.ResourceName]int64{
+		"hami.io/nvidia-a100-gpumem":            81920,
+		"hami.io/nvidia-a100-gpumem-used":       20480,
+		"hami.io/nvidia-a100-gpucores":          200,
+		"hami.io/nvidia-a100-gpucores-used":     60,
+		"hami.io/nvidia-tesla-t4-gpumem":        15360,
+		"hami.io/nvidia-tesla-t4-gpumem-used":   1024,
+		"hami.io/nvidia-tesla-t4-gpucores":      100,
+		"hami.io/nvidia-tesla-t4-gpucores-used": 10,
+	}
+	assert.Equal(t, len(res), len(want))
+	for name, v := range want {
+		q := res[name]
+		assert.Equal(t, q.Value(), v, name)
+	}
+}
+
+func Test_exportNodeExtendedResources(t *testing.T) {
+	fakeClient := fake.NewSimpleClientset()
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+		Status: corev1.NodeStatus{Capacity: corev1.ResourceList{
+			corev1.ResourceCPU:                  resource.MustParse("8"),
+			"hami.io/nvidia-v100-gpumem":        resource.MustParse("16384"),
+			"hami.io/nvidia-v100-gpumem-used":   resource.MustParse("0"),
+			"hami.io/nvidia-v100-gpucores":      resource.MustParse("100"),
+			"hami.io/nvidia-v100-gpucores-used": resource.MustParse("0"),
+		}},
+	}
+	_, err := fakeClient.CoreV1().Nodes().Create(context.Background(), node, metav1.CreateOptions{})
+	assert.NilError(t, err)
+	nodeIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	assert.NilError(t, nodeIndexer.Add(node))
+
+	s := NewScheduler()
+	s.kubeClient = fakeClient
+	s.nodeLister = listerscorev1.NewNodeLister(nodeIndexer)
+	s.addNode("node1", extendedResourcesNode())
+	s.addPod(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "trainer", Namespace: "default", UID: "trainer"}}, "node1",
+		util.PodDevices{nvidia.NvidiaGPUDevice: util.PodSingleDevice{{{UUID: "GPU-0", Usedmem: 8192 * util.MiB, Usedcores: 50}}}})
+
+	s.exportNodeExtendedResources()
+	got, err := fakeClient.CoreV1().Nodes().Get(context.Background(), "node1", metav1.GetOptions{})
+	assert.NilError(t, err)
+	used := got.Status.Capacity["hami.io/nvidia-a100-gpumem-used"]
+	assert.Equal(t, used.Value(), int64(8192))
+	total := got.Status.Allocatable["hami.io/nvidia-a100-gpumem"]
+	assert.Equal(t, total.Value(), int64(81920))
+	// Device types no longer on the node are removed, other resources are kept.
+	_, stale := got.Status.Capacity["hami.io/nvidia-v100-gpumem"]
+	assert.Assert(t, !stale)
+	cpu := got.Status.Capacity[corev1.ResourceCPU]
+	assert.Equal(t, cpu.Value(), int64(8))
+
+	// Nothing is written while the resources match the accounting.
+	assert.NilError(t, nodeIndexer.Update(got))
+	fakeClient.ClearActions()
+	s.exportNodeExtendedResources()
+	assert.Equal(t, len(fakeClient.Actions()), 0)
+}
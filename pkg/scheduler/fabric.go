@@ -0,0 +1,93 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// requestedFabrics returns the fabrics a pod accepts, nil if it has no fabric constraint. An
+// annotation listing no fabric is no constraint, the webhook rejects it anyway.
+func requestedFabrics(annos map[string]string) []string {
+	var fabrics []string
+	for _, f := range strings.Split(annos[util.InterconnectFabric], ",") {
+		if f = strings.ToLower(strings.TrimSpace(f)); f != "" {
+			fabrics = append(fabrics, f)
+		}
+	}
+	return fabrics
+}
+
+// nodeFabric returns the interconnect fabric of node. The admin provided label wins over
+// what the device plugin detected.
+func nodeFabric(node *corev1.Node) string {
+	if node == nil {
+		return ""
+	}
+	if config.FabricNodeLabel != "" {
+		if f, ok := node.Labels[config.FabricNodeLabel]; ok {
+			return strings.ToLower(strings.TrimSpace(f))
+		}
+	}
+	return strings.ToLower(strings.TrimSpace(node.Annotations[util.NodeFabricAnnos]))
+}
+
+// fitInFabric reports whether node has one of the fabrics in fabrics. A node with an
+// unknown fabric never satisfies a constraint.
+func fitInFabric(node *corev1.Node, fabrics []string) bool {
+	if fabrics == nil {
+		return true
+	}
+	f := nodeFabric(node)
+	if f == "" {
+		return false
+	}
+	for _, want := range fabrics {
+		if want == f {
+			return true
+		}
+	}
+	return false
+}
+
+// nvidiaDeviceCount returns the number of NVIDIA GPUs requested by all containers of a pod.
+func nvidiaDeviceCount(nums util.PodDeviceRequests) int32 {
+	count := int32(0)
+	for _, ctrReqs := range nums {
+		count += ctrReqs[nvidia.NvidiaGPUDevice].Nums
+	}
+	return count
+}
+
+// unhealthyNVLinkFabric returns the reason the device plugin reported the NVLink fabric of
+// node unhealthy for, or "" if it is healthy or the node has none.
+func unhealthyNVLinkFabric(node *corev1.Node) string {
+	if node == nil {
+		return ""
+	}
+	health := node.Annotations[util.NodeNVLinkFabricAnnos]
+	if !strings.HasPrefix(health, util.NVLinkFabricUnhealthy) {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(health, util.NVLinkFabricUnhealthy), ":"))
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/policy"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func fabricNode(label, detected string) *corev1.Node {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{}, Annotations: map[string]string{}}}
+	if label != "" {
+		node.Labels[config.FabricNodeLabel] = label
+	}
+	if detected != "" {
+		node.Annotations[util.NodeFabricAnnos] = detected
+	}
+	return node
+}
+
+func Test_fitInFabric(t *testing.T) {
+	config.FabricNodeLabel = "hami.io/interconnect-fabric"
+	tests := []struct {
+		name  string
+		annos map[string]string
+		node  *corev1.Node
+		want  bool
+	}{
+		{name: "no constraint", annos: map[string]string{}, node: fabricNode("", ""), want: true},
+		{name: "detected fabric matches", annos: map[string]string{util.InterconnectFabric: "InfiniBand"}, node: fabricNode("", "infiniband"), want: true},
+		{name: "label overrides detection", annos: map[string]string{util.InterconnectFabric: "infiniband"}, node: fabricNode("ethernet", "infiniband"), want: false},
+		{name: "one of several fabrics", annos: map[string]string{util.InterconnectFabric: "infiniband, roce"}, node: fabricNode("roce", ""), want: true},
+		{name: "unknown fabric", annos: map[string]string{util.InterconnectFabric: "infiniband"}, node: fabricNode("", ""), want: false},
+		{name: "empty annotation", annos: map[string]string{util.InterconnectFabric: ""}, node: fabricNode("", ""), want: true},
+		{name: "only commas", annos: map[string]string{util.InterconnectFabric: " , ,"}, node: fabricNode("ethernet", ""), want: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, fitInFabric(test.node, requestedFabrics(test.annos)), test.want)
+		})
+	}
+}
+
+func Test_calcScoreFabric(t *testing.T) {
+	config.FabricNodeLabel = "hami.io/interconnect-fabric"
+	nodes := map[string]*NodeUsage{}
+	for name, fabric := range map[string]string{"ib-node": "infiniband", "eth-node": "ethernet"} {
+		nodes[name] = &NodeUsage{
+			Node: fabricNode(fabric, ""),
+			Devices: policy.DeviceUsageList{
+				Policy: util.GPUSchedulerPolicySpread.String(),
+				DeviceLists: []*policy.DeviceListsScore{{Device: &util.DeviceUsage{
+					ID: name + "-gpu", Type: nvidia.NvidiaGPUDevice, Count: 10, Totalmem: 8000, Totalcore: 100, Health: true,
+				}}},
+			},
+		}
+	}
+	// The Ethernet node has more free GPU capacity but the wrong fabric.
+	nodes["ib-node"].Devices.DeviceLists[0].Device.Usedmem = 4000
+	nums := util.PodDeviceRequests{{nvidia.NvidiaGPUDevice: util.ContainerDeviceRequest{Nums: 1, Type: nvidia.NvidiaGPUDevice, Memreq: 1000, Coresreq: 10}}}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "trainer", Namespace: "default", Annotations: map[string]string{util.InterconnectFabric: "infiniband"}}}
+
+	failedNodes := map[string]string{}
+	res, err := NewScheduler().calcScore(&nodes, nums, pod.Annotations, pod, failedNodes)
+	assert.NilError(t, err)
+	assert.Equal(t, len(res.NodeList), 1)
+	assert.Equal(t, res.NodeList[0].NodeID, "ib-node")
+	assert.Equal(t, failedNodes["eth-node"], "node lacks requested interconnect fabric")
+}
+
+func Test_calcScoreNVLinkFabric(t *testing.T) {
+	config.NVLinkFabricGate = true
+	newNodes := func() map[string]*NodeUsage {
+		node := fabricNode("", "")
+		node.Annotations[util.NodeNVLinkFabricAnnos] = util.NVLinkFabricUnhealthy + ": GPU-0 fabric registration in progress"
+		devices := make([]*policy.DeviceListsScore, 0)
+		for _, id := range []string{"gpu-0", "gpu-1"} {
+			devices = append(devices, &policy.DeviceListsScore{Device: &util.DeviceUsage{
+				ID: id, Type: nvidia.NvidiaGPUDevice, Count: 10, Totalmem: 8000, Totalcore: 100, Health: true,
+			}})
+		}
+		return map[string]*NodeUsage{"hgx-node": {
+			Node:    node,
+			Devices: policy.DeviceUsageList{Policy: util.GPUSchedulerPolicySpread.String(), DeviceLists: devices},
+		}}
+	}
+	request := func(n int32) util.PodDeviceRequests {
+		return util.PodDeviceRequests{{nvidia.NvidiaGPUDevice: util.ContainerDeviceRequest{Nums: n, Type: nvidia.NvidiaGPUDevice, Memreq: 1000, Coresreq: 10}}}
+	}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "trainer", Namespace: "default"}}
+
+	nodes := newNodes()
+	failedNodes := map[string]string{}
+	res, err := NewScheduler().calcScore(&nodes, request(2), pod.Annotations, pod, failedNodes)
+	assert.NilError(t, err)
+	assert.Equal(t, len(res.NodeList), 0)
+	assert.Equal(t, failedNodes["hgx-node"], "NVLink fabric unhealthy, multi-GPU pods are not placed: GPU-0 fabric registration in progress")
+
+	nodes = newNodes()
+	res, err = NewScheduler().calcScore(&nodes, request(1), pod.Annotations, pod, map[string]string{})
+	assert.NilError(t, err)
+	assert.Equal(t, len(res.NodeList), 1)
+
+	config.NVLinkFabricGate = false
+	defer func() { config.NVLinkFabricGate = true }()
+	nodes = newNodes()
+	res, err = NewScheduler().calcScore(&nodes, request(2), pod.Annotations, pod, map[string]string{})
+	assert.NilError(t, err)
+	assert.Equal(t, len(res.NodeList), 1)
+}
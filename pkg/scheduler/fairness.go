@@ -0,0 +1,212 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/policy"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+const (
+	// fairnessMaxHolders bounds the number of waiting pods a filter call keeps room for.
+	fairnessMaxHolders = 5
+	// fairnessForgetAfter drops a waiting pod which hasn't been filtered for that long,
+	// kube-scheduler retries unschedulable pods at least every 5 minutes.
+	fairnessForgetAfter = 10 * time.Minute
+)
+
+type waitingPod struct {
+	pod   *corev1.Pod
+	nums  util.PodDeviceRequests
+	annos map[string]string
+	// nodes are the candidate nodes of the last filter call of the pod.
+	nodes    map[string]bool
+	since    time.Time
+	lastSeen time.Time
+}
+
+// fairnessTracker ages the pods the scheduler couldn't place. A pod gains weight priority
+// per minute it waits; a pod whose priority exceeds another's by at least 1 holds the
+// room it fits into, so the other pod can't take it. This keeps a stream of large (or small)
+// requests from starving the other kind, whoever happens to be filtered first once cards free up.
+type fairnessTracker struct {
+	mutex   sync.Mutex
+	weight  float64
+	now     func() time.Time
+	waiting map[k8stypes.UID]*waitingPod
+}
+
+// newFairnessTracker returns nil, which disables aging, if weight is not positive.
+func newFairnessTracker(weight float64) *fairnessTracker {
+	if weight <= 0 {
+		return nil
+	}
+	return &fairnessTracker{
+		weight:  weight,
+		now:     time.Now,
+		waiting: make(map[k8stypes.UID]*waitingPod),
+	}
+}
+
+// observe records a filter call of pod and returns since when the pod waits.
+func (f *fairnessTracker) observe(pod *corev1.Pod, nums util.PodDeviceRequests, annos map[string]string, nodeNames *[]string) time.Time {
+	if f == nil {
+		return time.Time{}
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	now := f.now()
+	for uid, w := range f.waiting {
+		if now.Sub(w.lastSeen) > fairnessForgetAfter {
+			delete(f.waiting, uid)
+		}
+	}
+	nodes := make(map[string]bool)
+	if nodeNames != nil {
+		for _, n := range *nodeNames {
+			nodes[n] = true
+		}
+	}
+	w, ok := f.waiting[pod.UID]
+	if !ok {
+		w = &waitingPod{since: now}
+		f.waiting[pod.UID] = w
+	}
+	w.pod, w.nums, w.annos, w.nodes, w.lastSeen = pod, nums, annos, nodes, now
+	return w.since
+}
+
+// forget stops aging pod, once it is placed or deleted.
+func (f *fairnessTracker) forget(uid k8stypes.UID) {
+	if f == nil {
+		return
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	delete(f.waiting, uid)
+}
+
+func (f *fairnessTracker) priority(since, now time.Time) float64 {
+	return f.weight * now.Sub(since).Minutes()
+}
+
+// elders returns the waiting pods which take precedence over pod waiting since since, longest waiting first.
+func (f *fairnessTracker) elders(uid k8stypes.UID, since time.Time) []*waitingPod {
+	if f == nil {
+		return nil
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	now := f.now()
+	own := f.priority(since, now)
+	res := make([]*waitingPod, 0)
+	for u, w := range f.waiting {
+		if u != uid && f.priority(w.since, now)-own >= 1 {
+			res = append(res, w)
+		}
+	}
+	slices.SortFunc(res, func(a, b *waitingPod) int {
+		return a.since.Compare(b.since)
+	})
+	if len(res) > fairnessMaxHolders {
+		res = res[:fairnessMaxHolders]
+	}
+	return res
+}
+
+func cloneNodeUsage(node *NodeUsage) *NodeUsage {
+	c := &NodeUsage{
+		Node:          node.Node,
+		Devices:       policy.DeviceUsageList{Policy: node.Devices.Policy, DeviceLists: make([]*policy.DeviceListsScore, 0, len(node.Devices.DeviceLists))},
+		stickyDevices: node.stickyDevices,
+		switchLoad:    maps.Clone(node.switchLoad),
+		cards:         node.cards,
+		healthyCards:  node.healthyCards,
+		unhealthy:     node.unhealthy,
+	}
+	for _, d := range node.Devices.DeviceLists {
+		dev := *d.Device
+		dev.MigUsage.UsageList = slices.Clone(d.Device.MigUsage.UsageList)
+		dev.Allocations = slices.Clone(d.Device.Allocations)
+		c.Devices.DeviceLists = append(c.Devices.DeviceLists, &policy.DeviceListsScore{Device: &dev, Score: d.Score})
+	}
+	return c
+}
+
+// fitsOn reports whether w fits on a copy of node.
+func (w *waitingPod) fitsOn(nodeID string, node *NodeUsage) bool {
+	if !w.nodes[nodeID] {
+		return false
+	}
+	c := cloneNodeUsage(node)
+	pd := util.PodDevices{}
+	for _, n := range w.nums {
+		if fit, _ := fitInDevices(c, n, w.annos, w.pod, &pd); !fit {
+			return false
+		}
+	}
+	return true
+}
+
+// fittingElders returns, per node, the elders which currently fit on it.
+func fittingElders(nodes map[string]*NodeUsage, elders []*waitingPod) map[string][]*waitingPod {
+	res := make(map[string][]*waitingPod)
+	if len(elders) == 0 {
+		return res
+	}
+	for nodeID, node := range nodes {
+		for _, w := range elders {
+			if w.fitsOn(nodeID, node) {
+				res[nodeID] = append(res[nodeID], w)
+			}
+		}
+	}
+	return res
+}
+
+// holdForElders drops the nodes of scores on which the placement of the filtered pod would
+// take the room of an elder which fitted there before. nodes carry the usage including that
+// placement, as left by calcScore.
+func holdForElders(scores *policy.NodeScoreList, nodes map[string]*NodeUsage, fitting map[string][]*waitingPod, failedNodes map[string]string) {
+	if len(fitting) == 0 {
+		return
+	}
+	kept := make([]*policy.NodeScore, 0, len(scores.NodeList))
+	for _, score := range scores.NodeList {
+		idx := slices.IndexFunc(fitting[score.NodeID], func(w *waitingPod) bool {
+			return !w.fitsOn(score.NodeID, nodes[score.NodeID])
+		})
+		if idx < 0 {
+			kept = append(kept, score)
+			continue
+		}
+		w := fitting[score.NodeID][idx]
+		klog.InfoS("Holding node for a longer waiting pod", "node", score.NodeID, "waitingPod", klog.KObj(w.pod), "waitingSince", w.since)
+		failedNodes[score.NodeID] = fmt.Sprintf("node held for pod %s/%s waiting since %s", w.pod.Namespace, w.pod.Name, w.since.Format(time.RFC3339))
+	}
+	scores.NodeList = kept
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	extenderv1 "k8s.io/kube-scheduler/extender/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+	"github.com/Project-HAMi/HAMi/pkg/util/client"
+)
+
+func fairnessTestPod(name string, mem int64) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: k8stypes.UID(name)},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name: "ctr",
+				Resources: corev1.ResourceRequirements{
+					Limits: corev1.ResourceList{
+						"hami.io/gpu":    *resource.NewQuantity(1, resource.BinarySI),
+						"hami.io/gpumem": *resource.NewQuantity(mem, resource.BinarySI),
+					},
+				},
+			}},
+		},
+	}
+}
+
+// runLargeStream frees the card for a new large pod every 30 seconds, each filtered
+// right before the retry of a small pod which waits since the card filled up. It returns
+// the round the small pod got placed in, or -1.
+func runLargeStream(t *testing.T, weight float64, rounds int) int {
+	initTFLOPSDevices(t)
+	client.KubeClient = fake.NewSimpleClientset()
+	s := NewScheduler()
+	s.kubeClient = client.KubeClient
+	s.eventRecorder = record.NewFakeRecorder(1000)
+	now := time.Now()
+	s.fairness = newFairnessTracker(weight)
+	if s.fairness != nil {
+		s.fairness.now = func() time.Time { return now }
+	}
+	s.addNode("node1", &util.NodeInfo{
+		ID:      "node1",
+		Devices: []util.DeviceInfo{{ID: "GPU-0", Count: 10, Devmem: 8000, Devcore: 100, Type: nvidia.NvidiaGPUDevice, Health: true}},
+	})
+	filter := func(pod *corev1.Pod) bool {
+		if _, err := client.KubeClient.CoreV1().Pods(pod.Namespace).Get(context.Background(), pod.Name, metav1.GetOptions{}); err != nil {
+			_, err = client.KubeClient.CoreV1().Pods(pod.Namespace).Create(context.Background(), pod, metav1.CreateOptions{})
+			assert.NilError(t, err)
+		}
+		res, err := s.Filter(extenderv1.ExtenderArgs{Pod: pod, NodeNames: &[]string{"node1"}})
+		assert.NilError(t, err)
+		return res.NodeNames != nil && len(*res.NodeNames) == 1
+	}
+
+	large := fairnessTestPod("large-0", 8000)
+	assert.Equal(t, filter(large), true)
+	small := fairnessTestPod("small", 2000)
+	assert.Equal(t, filter(small), false)
+	for round := 1; round <= rounds; round++ {
+		now = now.Add(30 * time.Second)
+		s.delPod(large)
+		next := fairnessTestPod(fmt.Sprintf("large-%d", round), 8000)
+		if filter(next) {
+			large = next
+		}
+		if filter(small) {
+			return round
+		}
+	}
+	return -1
+}
+
+func Test_fairnessSmallRequestIsNotStarved(t *testing.T) {
+	assert.Equal(t, runLargeStream(t, 0, 10), -1, "without aging every freed card goes to the next large pod")
+	assert.Equal(t, runLargeStream(t, 1, 10), 2, "the small pod holds the card once it waited a minute longer")
+}
+
+func Test_fairnessTracker(t *testing.T) {
+	assert.Assert(t, newFairnessTracker(0) == nil)
+	var disabled *fairnessTracker
+	assert.Equal(t, len(disabled.elders("a", time.Now())), 0)
+	disabled.forget("a")
+
+	now := time.Now()
+	f := newFairnessTracker(2)
+	f.now = func() time.Time { return now }
+	old := f.observe(fairnessTestPod("old", 1000), nil, nil, &[]string{"node1"})
+	now = now.Add(20 * time.Second)
+	mid := f.observe(fairnessTestPod("mid", 1000), nil, nil, &[]string{"node1"})
+	now = now.Add(20 * time.Second)
+	young := f.observe(fairnessTestPod("young", 1000), nil, nil, &[]string{"node1"})
+	assert.Equal(t, f.observe(fairnessTestPod("old", 1000), nil, nil, nil), old, "the wait starts at the first filter call")
+
+	// Weight 2 means 30 seconds of extra waiting give precedence.
+	assert.Equal(t, len(f.elders("mid", mid)), 0)
+	elders := f.elders("young", young)
+	assert.Equal(t, len(elders), 1)
+	assert.Equal(t, elders[0].pod.Name, "old")
+
+	f.forget("old")
+	assert.Equal(t, len(f.elders("young", young)), 0)
+
+	now = now.Add(fairnessForgetAfter + time.Second)
+	f.observe(fairnessTestPod("new", 1000), nil, nil, nil)
+	assert.Equal(t, len(f.waiting), 1, "pods not filtered for long are dropped")
+}
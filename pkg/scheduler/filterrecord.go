@@ -0,0 +1,215 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	extenderv1 "k8s.io/kube-scheduler/extender/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+const (
+	// FilterRecordsToLog writes the filter records to the scheduler log instead of a file.
+	FilterRecordsToLog = "-"
+
+	// Fields of the recorded pods which can be redacted. Any other entry of the redacted
+	// fields is the key of an annotation.
+	RedactEnv     = "env"
+	RedactCommand = "command"
+	RedactImage   = "image"
+	RedactLabels  = "labels"
+)
+
+// FilterRecord is a filter request of kube-scheduler and its outcome. Request can be posted
+// to the /plan endpoint as is to replay the pod against the capacity of that scheduler.
+type FilterRecord struct {
+	Timestamp time.Time `json:"timestamp"`
+	PodUID    types.UID `json:"podUID"`
+	// SpecDigest is the sha256 of the pod spec before redaction, so the same spec is
+	// recognized across records even with redacted fields.
+	SpecDigest string           `json:"specDigest"`
+	Request    BatchPlanRequest `json:"request"`
+	// FitNodes are the nodes the filter returned, the selected one if the pod requests devices.
+	FitNodes    []string          `json:"fitNodes,omitempty"`
+	Devices     util.PodDevices   `json:"devices,omitempty"`
+	FailedNodes map[string]string `json:"failedNodes,omitempty"`
+	Error       string            `json:"error,omitempty"`
+}
+
+// filterRecorder writes a FilterRecord per filter request as JSON lines. A nil *filterRecorder
+// does nothing.
+type filterRecorder struct {
+	mutex  sync.Mutex
+	out    io.WriteCloser
+	redact map[string]bool
+}
+
+// OpenFilterRecords records every filter request to path, or to the log if path is
+// FilterRecordsToLog, with the fields of redact redacted. An empty path records nothing.
+func (s *Scheduler) OpenFilterRecords(path string, redact []string) error {
+	if path == "" {
+		return nil
+	}
+	r := &filterRecorder{redact: make(map[string]bool, len(redact))}
+	for _, field := range redact {
+		r.redact[field] = true
+	}
+	if path != FilterRecordsToLog {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			return err
+		}
+		r.out = f
+	}
+	s.filterRecords = r
+	klog.InfoS("Recording filter requests", "path", path, "redact", redact)
+	return nil
+}
+
+// newFilterRecord builds the record of the filter of pod over nodeNames, which returned res
+// and err and allocated devices.
+func (r *filterRecorder) newFilterRecord(pod *corev1.Pod, nodeNames *[]string, res *extenderv1.ExtenderFilterResult, devices util.PodDevices, err error) FilterRecord {
+	rec := FilterRecord{
+		Timestamp:  time.Now().UTC(),
+		PodUID:     pod.UID,
+		SpecDigest: specDigest(pod.Spec),
+		Request: BatchPlanRequest{
+			Pods: []corev1.PodTemplateSpec{r.redacted(pod)},
+		},
+		Devices: devices,
+	}
+	if nodeNames != nil {
+		rec.Request.NodeNames = *nodeNames
+	}
+	if res != nil {
+		if res.NodeNames != nil {
+			rec.FitNodes = *res.NodeNames
+		}
+		rec.FailedNodes = res.FailedNodes
+		rec.Error = res.Error
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	return rec
+}
+
+// specDigest returns the sha256 of the JSON of spec.
+func specDigest(spec corev1.PodSpec) string {
+	data, _ := json.Marshal(spec)
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// redactValue replaces v by a short hash of it, so equal values stay equal.
+func redactValue(v string) string {
+	sum := sha256.Sum256([]byte(v))
+	return "redacted-" + hex.EncodeToString(sum[:6])
+}
+
+// redacted returns the template of pod with the fields of r redacted. Only the metadata the
+// filter reads is kept.
+func (r *filterRecorder) redacted(pod *corev1.Pod) corev1.PodTemplateSpec {
+	tmpl := corev1.PodTemplateSpec{Spec: *pod.Spec.DeepCopy()}
+	tmpl.Name = pod.Name
+	tmpl.Namespace = pod.Namespace
+	tmpl.Labels = make(map[string]string, len(pod.Labels))
+	for k, v := range pod.Labels {
+		if r.redact[RedactLabels] {
+			v = redactValue(v)
+		}
+		tmpl.Labels[k] = v
+	}
+	tmpl.Annotations = make(map[string]string, len(pod.Annotations))
+	for k, v := range pod.Annotations {
+		if r.redact[k] {
+			v = redactValue(v)
+		}
+		tmpl.Annotations[k] = v
+	}
+	redactContainer := func(c *corev1.Container) {
+		if r.redact[RedactEnv] {
+			for i := range c.Env {
+				if c.Env[i].Value != "" {
+					c.Env[i].Value = redactValue(c.Env[i].Value)
+				}
+			}
+		}
+		if r.redact[RedactCommand] {
+			for i := range c.Command {
+				c.Command[i] = redactValue(c.Command[i])
+			}
+			for i := range c.Args {
+				c.Args[i] = redactValue(c.Args[i])
+			}
+		}
+		if r.redact[RedactImage] {
+			c.Image = redactValue(c.Image)
+		}
+	}
+	for i := range tmpl.Spec.InitContainers {
+		redactContainer(&tmpl.Spec.InitContainers[i])
+	}
+	for i := range tmpl.Spec.Containers {
+		redactContainer(&tmpl.Spec.Containers[i])
+	}
+	return tmpl
+}
+
+// record writes the record of the filter of pod over nodeNames.
+func (r *filterRecorder) record(pod *corev1.Pod, nodeNames *[]string, res *extenderv1.ExtenderFilterResult, devices util.PodDevices, err error) {
+	if r == nil || pod == nil {
+		return
+	}
+	data, merr := json.Marshal(r.newFilterRecord(pod, nodeNames, res, devices, err))
+	if merr != nil {
+		klog.ErrorS(merr, "Failed to encode filter record", "pod", klog.KObj(pod))
+		return
+	}
+	if r.out == nil {
+		klog.InfoS("Filter record", "record", string(data))
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, werr := r.out.Write(append(data, '\n')); werr != nil {
+		klog.ErrorS(werr, "Failed to write filter record", "pod", klog.KObj(pod))
+	}
+}
+
+// close closes the file the records are written to.
+func (r *filterRecorder) close() {
+	if r == nil || r.out == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if err := r.out.Close(); err != nil {
+		klog.ErrorS(err, "Failed to close filter records")
+	}
+}
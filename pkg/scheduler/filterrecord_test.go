@@ -0,0 +1,120 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	extenderv1 "k8s.io/kube-scheduler/extender/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func recordedPod() *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "gpu-pod",
+			Namespace:   "default",
+			UID:         "uid1",
+			Labels:      map[string]string{"team": "search"},
+			Annotations: map[string]string{"nvidia.com/use-gputype": "A100", "secret/token": "abc"},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:    "ctr",
+				Image:   "registry/app:v1",
+				Command: []string{"run", "--password=abc"},
+				Env:     []corev1.EnvVar{{Name: "TOKEN", Value: "abc"}, {Name: "FROM_SECRET"}},
+			}},
+		},
+	}
+}
+
+func Test_filterRecorderRedacted(t *testing.T) {
+	pod := recordedPod()
+	r := &filterRecorder{redact: map[string]bool{RedactEnv: true, RedactCommand: true, "secret/token": true}}
+	tmpl := r.redacted(pod)
+
+	ctr := tmpl.Spec.Containers[0]
+	assert.Equal(t, ctr.Env[0].Value, redactValue("abc"))
+	assert.Equal(t, ctr.Env[1].Value, "")
+	assert.DeepEqual(t, ctr.Command, []string{redactValue("run"), redactValue("--password=abc")})
+	assert.Equal(t, ctr.Image, "registry/app:v1")
+	assert.Equal(t, tmpl.Labels["team"], "search")
+	assert.Equal(t, tmpl.Annotations["secret/token"], redactValue("abc"))
+	assert.Equal(t, tmpl.Annotations["nvidia.com/use-gputype"], "A100")
+	assert.Equal(t, tmpl.Name, "gpu-pod")
+	assert.Equal(t, string(tmpl.UID), "")
+
+	// The pod itself is left alone.
+	assert.Equal(t, pod.Spec.Containers[0].Env[0].Value, "abc")
+	assert.Equal(t, pod.Annotations["secret/token"], "abc")
+}
+
+func Test_specDigest(t *testing.T) {
+	a, b := recordedPod(), recordedPod()
+	assert.Equal(t, specDigest(a.Spec), specDigest(b.Spec))
+	b.Spec.Containers[0].Env[0].Value = "xyz"
+	assert.Assert(t, specDigest(a.Spec) != specDigest(b.Spec))
+}
+
+func Test_OpenFilterRecords(t *testing.T) {
+	s := &Scheduler{}
+	assert.NilError(t, s.OpenFilterRecords("", nil))
+	assert.Assert(t, s.filterRecords == nil)
+
+	path := filepath.Join(t.TempDir(), "records.jsonl")
+	assert.NilError(t, s.OpenFilterRecords(path, []string{RedactEnv}))
+	pod := recordedPod()
+	devices := util.PodDevices{"NVIDIA": util.PodSingleDevice{{{Idx: 0, UUID: "GPU-0", Type: "NVIDIA", Usedmem: 1000, Usedcores: 30}}}}
+	s.filterRecords.record(pod, &[]string{"node1", "node2"}, &extenderv1.ExtenderFilterResult{NodeNames: &[]string{"node1"}}, devices, nil)
+	s.filterRecords.record(pod, &[]string{"node2"}, &extenderv1.ExtenderFilterResult{FailedNodes: map[string]string{"node2": "node not fit pod"}}, nil, nil)
+	s.filterRecords.record(pod, &[]string{"node2"}, nil, nil, errors.New("calcScore failed"))
+	s.filterRecords.close()
+
+	f, err := os.Open(path)
+	assert.NilError(t, err)
+	defer f.Close()
+	var records []FilterRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec FilterRecord
+		assert.NilError(t, json.Unmarshal(scanner.Bytes(), &rec))
+		records = append(records, rec)
+	}
+	assert.Equal(t, len(records), 3)
+
+	assert.Equal(t, records[0].PodUID, pod.UID)
+	assert.Equal(t, records[0].SpecDigest, specDigest(pod.Spec))
+	assert.DeepEqual(t, records[0].Request.NodeNames, []string{"node1", "node2"})
+	assert.Equal(t, len(records[0].Request.Pods), 1)
+	assert.Equal(t, records[0].Request.Pods[0].Spec.Containers[0].Env[0].Value, redactValue("abc"))
+	assert.DeepEqual(t, records[0].FitNodes, []string{"node1"})
+	assert.DeepEqual(t, records[0].Devices, devices)
+
+	assert.Equal(t, len(records[1].FitNodes), 0)
+	assert.DeepEqual(t, records[1].FailedNodes, map[string]string{"node2": "node not fit pod"})
+	assert.Equal(t, records[2].Error, "calcScore failed")
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// validateGPUMinFreeBlock rejects a hami.io/gpu-min-free-block annotation which isn't a positive
+// number of MiB.
+func validateGPUMinFreeBlock(annos map[string]string) error {
+	v, ok := annos[util.GPUMinFreeBlock]
+	if !ok {
+		return nil
+	}
+	if n, err := strconv.ParseInt(v, 10, 64); err != nil || n <= 0 {
+		return fmt.Errorf("annotation %s must be a positive number of MiB, got %q", util.GPUMinFreeBlock, v)
+	}
+	return nil
+}
+
+// minFreeBlock returns the contiguous free memory in bytes the pod with annos wants on each of
+// its cards, 0 if it wants none.
+func minFreeBlock(annos map[string]string) int64 {
+	n, err := strconv.ParseInt(annos[util.GPUMinFreeBlock], 10, 64)
+	if err != nil || n <= 0 {
+		return 0
+	}
+	return n * util.MiB
+}
+
+// largestFreeBlock returns the largest contiguous block of free memory of d in bytes. No vendor
+// reports how the free memory of a card is fragmented, HAMi-core only counts the memory of every
+// container, so all free memory of the card counts as a single block.
+func largestFreeBlock(d *util.DeviceUsage) int64 {
+	return max(d.Totalmem-d.Usedmem, 0)
+}
+
+// checkFreeBlock returns why d lacks a free block of want bytes, "" if it has one or want is 0.
+func checkFreeBlock(want int64, d *util.DeviceUsage) string {
+	if want <= 0 {
+		return ""
+	}
+	if largest := largestFreeBlock(d); largest < want {
+		return fmt.Sprintf("largest free memory block of the card is %d MiB, %d MiB wanted", largest/util.MiB, want/util.MiB)
+	}
+	return ""
+}
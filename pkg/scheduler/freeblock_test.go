@@ -0,0 +1,81 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/policy"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func Test_validateGPUMinFreeBlock(t *testing.T) {
+	assert.NilError(t, validateGPUMinFreeBlock(nil))
+	assert.NilError(t, validateGPUMinFreeBlock(map[string]string{util.GPUMinFreeBlock: "4096"}))
+	assert.ErrorContains(t, validateGPUMinFreeBlock(map[string]string{util.GPUMinFreeBlock: "4Gi"}), `annotation hami.io/gpu-min-free-block must be a positive number of MiB, got "4Gi"`)
+	assert.ErrorContains(t, validateGPUMinFreeBlock(map[string]string{util.GPUMinFreeBlock: "0"}), "hami.io/gpu-min-free-block")
+}
+
+func Test_calcScoreFreeBlock(t *testing.T) {
+	prev := device.ActiveConfig()
+	initTFLOPSDevices(t)
+	defer func() { assert.NilError(t, device.InitDevicesWithConfig(prev)) }()
+
+	// Each card has 8000 MiB, GPU-i has i*2000 MiB of it in use. The binpack policy picks the
+	// fullest card that fits.
+	newNodes := func(cards int) map[string]*NodeUsage {
+		devices := policy.DeviceUsageList{Policy: util.GPUSchedulerPolicyBinpack.String()}
+		for i := range cards {
+			devices.DeviceLists = append(devices.DeviceLists, &policy.DeviceListsScore{Device: &util.DeviceUsage{
+				ID: fmt.Sprintf("GPU-%d", i), Type: "NVIDIA-Tesla T4", Count: 10, Totalmem: 8000 * util.MiB, Totalcore: 100, Health: true,
+				Used: int32(i), Usedmem: int64(i) * 2000 * util.MiB, Usedcores: int32(i) * 10,
+			}})
+		}
+		node := &NodeUsage{Node: &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}, Devices: devices}
+		return map[string]*NodeUsage{"node1": node}
+	}
+	nums := util.PodDeviceRequests{{nvidia.NvidiaGPUDevice: util.ContainerDeviceRequest{Nums: 1, Type: nvidia.NvidiaGPUDevice, Memreq: 1000 * util.MiB, Coresreq: 10}}}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "trainer", Namespace: "default"}}
+	place := func(annos map[string]string, cards int) (string, string) {
+		nodes := newNodes(cards)
+		failedNodes := map[string]string{}
+		res, err := NewScheduler().calcScore(&nodes, nums, annos, pod, failedNodes)
+		assert.NilError(t, err)
+		if len(res.NodeList) == 0 {
+			return "", failedNodes["node1"]
+		}
+		return res.NodeList[0].Devices[nvidia.NvidiaGPUDevice][0][0].UUID, ""
+	}
+
+	card, _ := place(nil, 4)
+	assert.Equal(t, card, "GPU-3")
+	card, _ = place(map[string]string{util.GPUMinFreeBlock: "4000"}, 4)
+	assert.Equal(t, card, "GPU-2")
+	card, _ = place(map[string]string{util.GPUMinFreeBlock: "8000"}, 4)
+	assert.Equal(t, card, "GPU-0")
+
+	// Without contiguity reported, all free memory of a card counts as one block.
+	_, reason := place(map[string]string{util.GPUMinFreeBlock: "9000"}, 1)
+	assert.Equal(t, reason, "node not fit pod, largest free memory block of the card is 8000 MiB, 9000 MiB wanted")
+}
@@ -0,0 +1,287 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/k8sutil"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+const (
+	// gpuAllocationManagedBy labels the GPUAllocation objects the scheduler maintains.
+	gpuAllocationManagedBy = "hami-scheduler"
+	// gpuAllocationResync is how often the GPUAllocation objects are checked even if no
+	// allocation changed, e.g. to restore one deleted by hand.
+	gpuAllocationResync = time.Minute
+	// gpuAllocationMinInterval is the least time between two updates, so a burst of placements
+	// costs a single round of writes.
+	gpuAllocationMinInterval = 5 * time.Second
+)
+
+// gpuAllocationResource is the GPUAllocation custom resource, one per node, cluster scoped and
+// named after the node.
+var gpuAllocationResource = schema.GroupVersionResource{Group: "hami.io", Version: "v1alpha1", Resource: "gpuallocations"}
+
+// GPUAllocationStatus is the status of a GPUAllocation: the devices of a node and what the
+// scheduler allocated of them to which pods.
+type GPUAllocationStatus struct {
+	Node          string              `json:"node"`
+	CardCount     int                 `json:"cardCount"`
+	PodCount      int                 `json:"podCount"`
+	MemoryMiB     int64               `json:"memoryMiB"`
+	UsedMemoryMiB int64               `json:"usedMemoryMiB"`
+	Cores         int64               `json:"cores"`
+	UsedCores     int64               `json:"usedCores"`
+	Cards         []GPUAllocationCard `json:"cards"`
+}
+
+// GPUAllocationCard is a device of a node and its allocations.
+type GPUAllocationCard struct {
+	ID            string             `json:"id"`
+	Index         int64              `json:"index"`
+	Type          string             `json:"type"`
+	Healthy       bool               `json:"healthy"`
+	Sharers       int64              `json:"sharers"`
+	MaxSharers    int64              `json:"maxSharers"`
+	MemoryMiB     int64              `json:"memoryMiB"`
+	UsedMemoryMiB int64              `json:"usedMemoryMiB"`
+	Cores         int64              `json:"cores"`
+	UsedCores     int64              `json:"usedCores"`
+	Pods          []GPUAllocationPod `json:"pods"`
+}
+
+// GPUAllocationPod is what a pod holds of a card, over all its containers.
+type GPUAllocationPod struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	MemoryMiB int64  `json:"memoryMiB"`
+	Cores     int64  `json:"cores"`
+}
+
+// allocationMirror keeps a GPUAllocation object per node in line with the accounting of the
+// scheduler, for operators who query allocations with kubectl. A nil *allocationMirror does
+// nothing.
+type allocationMirror struct {
+	notify chan struct{}
+}
+
+func newAllocationMirror(enabled bool) *allocationMirror {
+	if !enabled {
+		return nil
+	}
+	return &allocationMirror{notify: make(chan struct{}, 1)}
+}
+
+// changed tells the mirror that allocations or devices changed.
+func (m *allocationMirror) changed() {
+	if m == nil {
+		return
+	}
+	select {
+	case m.notify <- struct{}{}:
+	default:
+	}
+}
+
+// nodeGPUAllocation returns the status of the GPUAllocation of node, counted as the scheduler
+// counts the allocations of pods.
+func nodeGPUAllocation(node *util.NodeInfo, pods []*podInfo) GPUAllocationStatus {
+	res := GPUAllocationStatus{Node: node.ID, Cards: make([]GPUAllocationCard, 0, len(node.Devices))}
+	cards := make(map[string]int, len(node.Devices))
+	vendors := make(map[string]string, len(node.Devices))
+	for _, d := range node.Devices {
+		cards[d.ID] = len(res.Cards)
+		vendors[d.ID] = d.DeviceVendor
+		res.Cards = append(res.Cards, GPUAllocationCard{
+			ID:         d.ID,
+			Index:      int64(d.Index),
+			Type:       d.Type,
+			Healthy:    d.Health,
+			MaxSharers: int64(d.Count),
+			MemoryMiB:  util.MemoryToBytes(d.DeviceVendor, int64(d.Devmem)) / util.MiB,
+			Cores:      int64(d.Devcore),
+			Pods:       []GPUAllocationPod{},
+		})
+	}
+	var idleLimits map[k8stypes.UID]int64
+	if node.Node != nil {
+		idleLimits = k8sutil.NodeIdleMemoryLimits(node.Node)
+	}
+	podsOn := make(map[string]bool)
+	for _, p := range pods {
+		if p.NodeID != node.ID {
+			continue
+		}
+		held := make(map[string]*GPUAllocationPod)
+		for _, podSingle := range p.Devices {
+			for _, ctrdevs := range podSingle {
+				for _, udevice := range ctrdevs {
+					id := strings.Split(udevice.UUID, "[")[0]
+					if _, ok := cards[id]; !ok {
+						continue
+					}
+					if held[id] == nil {
+						held[id] = &GPUAllocationPod{Namespace: p.Namespace, Name: p.Name}
+					}
+					mem := udevice.Usedmem
+					if p.Soft {
+						mem = softMemory(p, udevice)
+					}
+					if limit := idleMemoryLimit(idleLimits, p); limit > 0 {
+						mem = idleMemory(limit, udevice)
+					}
+					held[id].MemoryMiB += mem / util.MiB
+					held[id].Cores += int64(udevice.Usedcores)
+				}
+			}
+		}
+		for id, h := range held {
+			card := &res.Cards[cards[id]]
+			card.Sharers++
+			card.UsedMemoryMiB += h.MemoryMiB
+			card.UsedCores += h.Cores
+			card.Pods = append(card.Pods, *h)
+			podsOn[p.Namespace+"/"+p.Name] = true
+		}
+	}
+	sort.Slice(res.Cards, func(i, j int) bool {
+		if res.Cards[i].Index != res.Cards[j].Index {
+			return res.Cards[i].Index < res.Cards[j].Index
+		}
+		return res.Cards[i].ID < res.Cards[j].ID
+	})
+	for i := range res.Cards {
+		card := &res.Cards[i]
+		sort.Slice(card.Pods, func(a, b int) bool {
+			if card.Pods[a].Namespace != card.Pods[b].Namespace {
+				return card.Pods[a].Namespace < card.Pods[b].Namespace
+			}
+			return card.Pods[a].Name < card.Pods[b].Name
+		})
+		res.MemoryMiB += card.MemoryMiB
+		res.UsedMemoryMiB += card.UsedMemoryMiB
+		res.Cores += card.Cores
+		res.UsedCores += card.UsedCores
+	}
+	res.CardCount = len(res.Cards)
+	res.PodCount = len(podsOn)
+	return res
+}
+
+// newGPUAllocation returns the GPUAllocation object of a node with status.
+func newGPUAllocation(status GPUAllocationStatus) (*unstructured.Unstructured, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+	if err != nil {
+		return nil, err
+	}
+	obj := &unstructured.Unstructured{Object: map[string]any{"status": content}}
+	obj.SetAPIVersion(gpuAllocationResource.GroupVersion().String())
+	obj.SetKind("GPUAllocation")
+	obj.SetName(status.Node)
+	obj.SetLabels(map[string]string{"app.kubernetes.io/managed-by": gpuAllocationManagedBy})
+	return obj, nil
+}
+
+// WatchGPUAllocations keeps the GPUAllocation objects up to date.
+func (s *Scheduler) WatchGPUAllocations() {
+	if s.allocations == nil {
+		return
+	}
+	klog.InfoS("Publishing allocations as GPUAllocation objects")
+	ticker := time.NewTicker(gpuAllocationResync)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-s.allocations.notify:
+		case <-ticker.C:
+		}
+		s.syncGPUAllocations()
+		select {
+		case <-s.stopCh:
+			return
+		case <-time.After(gpuAllocationMinInterval):
+		}
+	}
+}
+
+// syncGPUAllocations creates or updates the GPUAllocation of every node whose status differs
+// from the accounting, and deletes the ones of nodes the scheduler no longer knows.
+func (s *Scheduler) syncGPUAllocations() {
+	if s.dynamicClient == nil {
+		return
+	}
+	ctx := context.Background()
+	client := s.dynamicClient.Resource(gpuAllocationResource)
+	list, err := client.List(ctx, metav1.ListOptions{LabelSelector: "app.kubernetes.io/managed-by=" + gpuAllocationManagedBy})
+	if err != nil {
+		klog.ErrorS(err, "Failed to list GPUAllocation objects, is the CRD installed?")
+		return
+	}
+	existing := make(map[string]*unstructured.Unstructured, len(list.Items))
+	for i := range list.Items {
+		existing[list.Items[i].GetName()] = &list.Items[i]
+	}
+	pods := s.ListPodsInfo()
+	if s.draClaims != nil {
+		pods = append(pods, s.draClaims.ListPodsInfo()...)
+	}
+	for nodeID, info := range s.nodeSnapshot() {
+		want, err := newGPUAllocation(nodeGPUAllocation(info, pods))
+		if err != nil {
+			klog.ErrorS(err, "Failed to build GPUAllocation", "node", nodeID)
+			continue
+		}
+		cur, ok := existing[nodeID]
+		delete(existing, nodeID)
+		if !ok {
+			if _, err := client.Create(ctx, want, metav1.CreateOptions{}); err != nil {
+				klog.ErrorS(err, "Failed to create GPUAllocation", "node", nodeID)
+			}
+			continue
+		}
+		if reflect.DeepEqual(cur.Object["status"], want.Object["status"]) {
+			continue
+		}
+		want.SetResourceVersion(cur.GetResourceVersion())
+		if _, err := client.Update(ctx, want, metav1.UpdateOptions{}); err != nil {
+			klog.ErrorS(err, "Failed to update GPUAllocation", "node", nodeID)
+			continue
+		}
+		klog.V(4).InfoS("Updated GPUAllocation", "node", nodeID)
+	}
+	for name := range existing {
+		if err := client.Delete(ctx, name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			klog.ErrorS(err, "Failed to delete GPUAllocation", "node", name)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func Test_nodeGPUAllocation(t *testing.T) {
+	pods := []*podInfo{
+		{Namespace: "default", Name: "trainer", NodeID: "node1", SoftLimit: -1, Devices: util.PodDevices{nvidia.NvidiaGPUDevice: util.PodSingleDevice{
+			{{UUID: "GPU-0", Usedmem: 10240 * util.MiB, Usedcores: 30}, {UUID: "GPU-1", Usedmem: 10240 * util.MiB, Usedcores: 30}},
+			{{UUID: "GPU-0", Usedmem: 2048 * util.MiB, Usedcores: 10}},
+		}}},
+		{Namespace: "batch", Name: "soft", NodeID: "node1", Soft: true, SoftLimit: 1024 * util.MiB, Devices: util.PodDevices{nvidia.NvidiaGPUDevice: util.PodSingleDevice{
+			{{UUID: "GPU-0", Usedmem: 4096 * util.MiB, Usedcores: 10}},
+		}}},
+		{Namespace: "default", Name: "elsewhere", NodeID: "node2", SoftLimit: -1, Devices: util.PodDevices{nvidia.NvidiaGPUDevice: util.PodSingleDevice{
+			{{UUID: "GPU-0", Usedmem: 4096 * util.MiB}},
+		}}},
+	}
+	node := extendedResourcesNode()
+	node.Devices[2].Index = 2
+	node.Devices[1].Index = 1
+	status := nodeGPUAllocation(node, pods)
+	assert.Equal(t, status.Node, "node1")
+	assert.Equal(t, status.CardCount, 3)
+	assert.Equal(t, status.PodCount, 2)
+	assert.Equal(t, status.MemoryMiB, int64(97280))
+	assert.Equal(t, status.UsedMemoryMiB, int64(23552))
+	assert.Equal(t, status.UsedCores, int64(80))
+
+	gpu0 := status.Cards[0]
+	assert.Equal(t, gpu0.ID, "GPU-0")
+	assert.Equal(t, gpu0.Sharers, int64(2))
+	assert.Equal(t, gpu0.UsedMemoryMiB, int64(13312))
+	// Pods are listed by namespace, soft pods with the memory they were asked to shrink to, and
+	// the containers of a pod together.
+	assert.DeepEqual(t, gpu0.Pods, []GPUAllocationPod{
+		{Namespace: "batch", Name: "soft", MemoryMiB: 1024, Cores: 10},
+		{Namespace: "default", Name: "trainer", MemoryMiB: 12288, Cores: 40},
+	})
+	assert.Equal(t, status.Cards[2].ID, "GPU-2")
+	assert.Equal(t, len(status.Cards[2].Pods), 0)
+}
+
+func Test_syncGPUAllocations(t *testing.T) {
+	stale, err := newGPUAllocation(GPUAllocationStatus{Node: "gone"})
+	assert.NilError(t, err)
+	foreign := &unstructured.Unstructured{}
+	foreign.SetAPIVersion("hami.io/v1alpha1")
+	foreign.SetKind("GPUAllocation")
+	foreign.SetName("by-hand")
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{gpuAllocationResource: "GPUAllocationList"}, stale, foreign)
+
+	s := NewScheduler()
+	s.dynamicClient = dynamicClient
+	s.addNode("node1", extendedResourcesNode())
+	s.addPod(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "trainer", Namespace: "default", UID: "trainer"}}, "node1",
+		util.PodDevices{nvidia.NvidiaGPUDevice: util.PodSingleDevice{{{UUID: "GPU-0", Usedmem: 8192 * util.MiB, Usedcores: 50}}}})
+
+	get := func(name string) (GPUAllocationStatus, error) {
+		obj, err := dynamicClient.Resource(gpuAllocationResource).Get(context.Background(), name, metav1.GetOptions{})
+		if err != nil {
+			return GPUAllocationStatus{}, err
+		}
+		var status GPUAllocationStatus
+		err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object["status"].(map[string]any), &status)
+		return status, err
+	}
+
+	s.syncGPUAllocations()
+	status, err := get("node1")
+	assert.NilError(t, err)
+	assert.Equal(t, status.UsedMemoryMiB, int64(8192))
+	assert.DeepEqual(t, status.Cards[0].Pods, []GPUAllocationPod{{Namespace: "default", Name: "trainer", MemoryMiB: 8192, Cores: 50}})
+	// Objects of nodes the scheduler doesn't know are deleted, unless someone else created them.
+	_, err = get("gone")
+	assert.Assert(t, err != nil)
+	_, err = dynamicClient.Resource(gpuAllocationResource).Get(context.Background(), "by-hand", metav1.GetOptions{})
+	assert.NilError(t, err)
+
+	// Nothing is written while the objects match the accounting.
+	dynamicClient.ClearActions()
+	s.syncGPUAllocations()
+	assert.Equal(t, len(dynamicClient.Actions()), 1)
+	assert.Equal(t, dynamicClient.Actions()[0].GetVerb(), "list")
+
+	s.delPod(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "trainer", Namespace: "default", UID: "trainer"}})
+	s.syncGPUAllocations()
+	status, err = get("node1")
+	assert.NilError(t, err)
+	assert.Equal(t, status.UsedMemoryMiB, int64(0))
+	assert.Equal(t, status.PodCount, 0)
+}
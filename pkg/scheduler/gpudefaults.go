@@ -0,0 +1,159 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// parseGPUDefaults parses a hami.io/gpu-defaults annotation, a hami.io/gpu shorthand without
+// count, e.g. "mem=4Gi,cores=30".
+func parseGPUDefaults(value string) (gpuShorthand, error) {
+	for _, entry := range strings.Split(value, ",") {
+		if k, _, _ := strings.Cut(entry, "="); strings.TrimSpace(k) == "count" {
+			return gpuShorthand{}, fmt.Errorf("count can't be defaulted, only mem, mem-percentage and cores")
+		}
+	}
+	res, err := parseGPUShorthand(value)
+	res.count = 0
+	return res, err
+}
+
+// gpuDefaultsLevel is the hami.io/gpu-defaults annotation of one level of the precedence chain.
+type gpuDefaultsLevel struct {
+	// source names the level in errors, e.g. "namespace team-a".
+	source string
+	annos  map[string]string
+}
+
+// gpuDefaultsSlots are the resources of a container which may be defaulted.
+type gpuDefaultsSlots struct {
+	memory, cores bool
+}
+
+// missingGPUDefaults returns the resources the NVIDIA GPU containers of pod lack, by container
+// index. Containers not using NVIDIA GPUs, and pods whose cores follow from hami.io/tflops, get
+// none.
+func missingGPUDefaults(pod *corev1.Pod, dev *nvidia.NvidiaGPUDevices) map[int]gpuDefaultsSlots {
+	countName, memName, memPercentageName := dev.ResourceNames()
+	has := func(c *corev1.Container, name string) bool {
+		_, inLimits := c.Resources.Limits[corev1.ResourceName(name)]
+		_, inRequests := c.Resources.Requests[corev1.ResourceName(name)]
+		return inLimits || inRequests
+	}
+	_, tflops := pod.Annotations[util.TFLOPSRequest]
+	res := make(map[int]gpuDefaultsSlots)
+	for idx := range pod.Spec.Containers {
+		c := &pod.Spec.Containers[idx]
+		if !has(c, countName) && !has(c, memName) && !has(c, memPercentageName) && !has(c, dev.CoreResourceName()) {
+			continue
+		}
+		slots := gpuDefaultsSlots{
+			memory: !has(c, memName) && !has(c, memPercentageName),
+			cores:  !tflops && !has(c, dev.CoreResourceName()),
+		}
+		if slots.memory || slots.cores {
+			res[idx] = slots
+		}
+	}
+	return res
+}
+
+// applyGPUDefaults gives the NVIDIA GPU containers of pod which lack memory or cores the ones of
+// the first of levels, in order of precedence, defaulting them. Resources the container sets
+// itself, through hami.io/gpu or hami.io/class included, always win. Every level is validated
+// as it is read, so an invalid annotation of a level which isn't needed is left alone.
+func applyGPUDefaults(pod *corev1.Pod, levels ...gpuDefaultsLevel) error {
+	dev, ok := device.GetDevices()[nvidia.NvidiaGPUDevice].(*nvidia.NvidiaGPUDevices)
+	if !ok {
+		return nil
+	}
+	missing := missingGPUDefaults(pod, dev)
+	if len(missing) == 0 {
+		return nil
+	}
+	var memDefault, coresDefault *gpuShorthand
+	for _, level := range levels {
+		value, ok := level.annos[util.GPUDefaults]
+		if !ok {
+			continue
+		}
+		defaults, err := parseGPUDefaults(value)
+		if err != nil {
+			return fmt.Errorf("%s: invalid %s annotation: %v", level.source, util.GPUDefaults, err)
+		}
+		if memDefault == nil && (defaults.memMiB > 0 || defaults.memPercentage > 0) {
+			memDefault = &defaults
+		}
+		if coresDefault == nil && defaults.cores > 0 {
+			coresDefault = &defaults
+		}
+		if memDefault != nil && coresDefault != nil {
+			break
+		}
+	}
+	_, memName, memPercentageName := dev.ResourceNames()
+	for idx, slots := range missing {
+		c := &pod.Spec.Containers[idx]
+		if c.Resources.Limits == nil {
+			c.Resources.Limits = corev1.ResourceList{}
+		}
+		set := func(name string, n int64) {
+			if n > 0 {
+				c.Resources.Limits[corev1.ResourceName(name)] = *resource.NewQuantity(n, resource.DecimalSI)
+			}
+		}
+		if slots.memory && memDefault != nil {
+			set(memName, memDefault.memMiB)
+			set(memPercentageName, memDefault.memPercentage)
+		}
+		if slots.cores && coresDefault != nil {
+			set(dev.CoreResourceName(), coresDefault.cores)
+		}
+	}
+	return nil
+}
+
+// gpuDefaultsLevels returns the levels of hami.io/gpu-defaults for pod in namespace: the pod,
+// whose annotations come from the pod template of its owner, then the namespace. The namespace
+// is only read if the webhook has a client and pod uses GPUs.
+func (h *webhook) gpuDefaultsLevels(ctx context.Context, pod *corev1.Pod, namespace string) ([]gpuDefaultsLevel, error) {
+	levels := []gpuDefaultsLevel{{source: "pod", annos: pod.Annotations}}
+	dev, ok := device.GetDevices()[nvidia.NvidiaGPUDevice].(*nvidia.NvidiaGPUDevices)
+	if h.kubeClient == nil || !ok || len(missingGPUDefaults(pod, dev)) == 0 {
+		return levels, nil
+	}
+	ns, err := h.kubeClient.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return levels, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the GPU defaults of namespace %s: %v", namespace, err)
+	}
+	return append(levels, gpuDefaultsLevel{source: "namespace " + namespace, annos: ns.Annotations}), nil
+}
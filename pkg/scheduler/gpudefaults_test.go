@@ -0,0 +1,173 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func Test_parseGPUDefaults(t *testing.T) {
+	d, err := parseGPUDefaults("mem=4Gi, cores=30")
+	assert.NilError(t, err)
+	assert.Equal(t, d, gpuShorthand{memMiB: 4096, cores: 30})
+	_, err = parseGPUDefaults("count=2,mem=4Gi")
+	assert.ErrorContains(t, err, "count can't be defaulted")
+	_, err = parseGPUDefaults("mem=4Gi,mem-percentage=50")
+	assert.ErrorContains(t, err, "exclusive")
+}
+
+func Test_applyGPUDefaults(t *testing.T) {
+	prev := device.ActiveConfig()
+	initTFLOPSDevices(t)
+	defer func() { assert.NilError(t, device.InitDevicesWithConfig(prev)) }()
+
+	limits := func(l map[string]int64) corev1.ResourceList {
+		res := corev1.ResourceList{}
+		for k, v := range l {
+			res[corev1.ResourceName(k)] = *resource.NewQuantity(v, resource.DecimalSI)
+		}
+		return res
+	}
+	newPod := func(annos map[string]string, l map[string]int64) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Annotations: annos},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{
+				{Name: "gpu", Resources: corev1.ResourceRequirements{Limits: limits(l)}},
+				{Name: "sidecar"},
+			}},
+		}
+	}
+	namespace := func(v string) gpuDefaultsLevel {
+		return gpuDefaultsLevel{source: "namespace team-a", annos: map[string]string{util.GPUDefaults: v}}
+	}
+	tests := []struct {
+		name      string
+		podAnnos  map[string]string
+		limits    map[string]int64
+		namespace gpuDefaultsLevel
+		want      map[string]int64
+		err       string
+	}{
+		{
+			name:      "namespace defaults",
+			limits:    map[string]int64{"hami.io/gpu": 1},
+			namespace: namespace("mem=4Gi,cores=30"),
+			want:      map[string]int64{"hami.io/gpu": 1, "hami.io/gpumem": 4096, "hami.io/gpucores": 30},
+		},
+		{
+			name:      "owner defaults win over the namespace, per resource",
+			podAnnos:  map[string]string{util.GPUDefaults: "mem-percentage=50"},
+			limits:    map[string]int64{"hami.io/gpu": 1},
+			namespace: namespace("mem=4Gi,cores=30"),
+			want:      map[string]int64{"hami.io/gpu": 1, "hami.io/gpumem-percentage": 50, "hami.io/gpucores": 30},
+		},
+		{
+			name:      "pod resources win over owner and namespace",
+			podAnnos:  map[string]string{util.GPUDefaults: "mem=2Gi,cores=20"},
+			limits:    map[string]int64{"hami.io/gpu": 1, "hami.io/gpumem": 1000},
+			namespace: namespace("mem=4Gi,cores=30"),
+			want:      map[string]int64{"hami.io/gpu": 1, "hami.io/gpumem": 1000, "hami.io/gpucores": 20},
+		},
+		{
+			name:      "cores follow from hami.io/tflops",
+			podAnnos:  map[string]string{util.TFLOPSRequest: "20"},
+			limits:    map[string]int64{"hami.io/gpu": 1},
+			namespace: namespace("mem=4Gi,cores=30"),
+			want:      map[string]int64{"hami.io/gpu": 1, "hami.io/gpumem": 4096},
+		},
+		{
+			name:      "invalid namespace defaults",
+			limits:    map[string]int64{"hami.io/gpu": 1},
+			namespace: namespace("mem=4096"),
+			err:       "namespace team-a: invalid hami.io/gpu-defaults annotation: mem needs a unit",
+		},
+		{
+			name:      "invalid namespace defaults are ignored by pods without GPUs",
+			namespace: namespace("count=1"),
+			want:      map[string]int64{},
+		},
+		{
+			name:      "invalid namespace defaults are ignored by pods requesting everything",
+			limits:    map[string]int64{"hami.io/gpu": 1, "hami.io/gpumem": 1000, "hami.io/gpucores": 10},
+			namespace: namespace("count=1"),
+			want:      map[string]int64{"hami.io/gpu": 1, "hami.io/gpumem": 1000, "hami.io/gpucores": 10},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pod := newPod(test.podAnnos, test.limits)
+			err := applyGPUDefaults(pod, gpuDefaultsLevel{source: "pod", annos: pod.Annotations}, test.namespace)
+			if test.err != "" {
+				assert.ErrorContains(t, err, test.err)
+				return
+			}
+			assert.NilError(t, err)
+			assert.DeepEqual(t, pod.Spec.Containers[0].Resources.Limits, limits(test.want))
+			assert.Assert(t, pod.Spec.Containers[1].Resources.Limits == nil, "containers without GPUs are left alone")
+		})
+	}
+}
+
+func TestHandleAppliesNamespaceGPUDefaults(t *testing.T) {
+	prev := device.ActiveConfig()
+	initTFLOPSDevices(t)
+	defer func() { assert.NilError(t, device.InitDevicesWithConfig(prev)) }()
+
+	wh, err := NewWebHook()
+	assert.NilError(t, err)
+	wh.Handler.(*webhook).kubeClient = fake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name: "team-a", Annotations: map[string]string{util.GPUDefaults: "mem=2Gi,cores=25"},
+	}})
+	handle := func(namespace string) admission.Response {
+		raw := `{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "test-pod", "namespace": "` + namespace + `"},
+			"spec": {"containers": [{"name": "container1", "resources": {"limits": {"hami.io/gpu": "1"}}}]}}`
+		return wh.Handle(context.Background(), admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			UID: "test-uid", Namespace: namespace, Name: "test-pod", Object: runtime.RawExtension{Raw: []byte(raw)},
+		}})
+	}
+
+	limitPatches := func(resp admission.Response) map[string]any {
+		res := map[string]any{}
+		for _, p := range resp.Patches {
+			if name, ok := strings.CutPrefix(p.Path, "/spec/containers/0/resources/limits/"); ok {
+				res[name] = p.Value
+			}
+		}
+		return res
+	}
+	resp := handle("team-a")
+	assert.Assert(t, resp.Allowed, resp.Result)
+	assert.DeepEqual(t, limitPatches(resp), map[string]any{"hami.io~1gpumem": "2048", "hami.io~1gpucores": "25"})
+
+	resp = handle("no-defaults")
+	assert.Assert(t, resp.Allowed, resp.Result)
+	assert.DeepEqual(t, limitPatches(resp), map[string]any{})
+}
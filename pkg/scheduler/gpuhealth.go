@@ -0,0 +1,131 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+)
+
+const (
+	// ZeroHealthyGPUExclude reports nodes without a healthy GPU to kube-scheduler as
+	// unresolvable, so it doesn't preempt pods there either.
+	ZeroHealthyGPUExclude = "exclude"
+	// ZeroHealthyGPUKeep reports nodes without a healthy GPU as failed for the pod only, so
+	// kube-scheduler keeps them in consideration, e.g. for preemption, until a GPU recovers.
+	ZeroHealthyGPUKeep = "keep"
+)
+
+// ValidateZeroHealthyGPUPolicy rejects unknown values of --zero-healthy-gpu-policy.
+func ValidateZeroHealthyGPUPolicy(p string) error {
+	if p != ZeroHealthyGPUExclude && p != ZeroHealthyGPUKeep {
+		return fmt.Errorf("unknown zero healthy GPU policy %q, %s or %s are allowed", p, ZeroHealthyGPUExclude, ZeroHealthyGPUKeep)
+	}
+	return nil
+}
+
+// noHealthyGPU returns why no pod may be placed on node because every GPU its device plugins
+// registered is unhealthy, "" if one is healthy or none is registered.
+func noHealthyGPU(node *NodeUsage) string {
+	if node.cards == 0 || node.healthyCards > 0 {
+		return ""
+	}
+	return fmt.Sprintf("node has no healthy GPU: %d of %d unhealthy", node.cards, node.cards)
+}
+
+// markCardUnhealthy leaves the card id of node out for new pods.
+func markCardUnhealthy(node *NodeUsage, id string) {
+	if node.unhealthy == nil {
+		node.unhealthy = make(map[string]bool)
+	}
+	node.unhealthy[id] = true
+}
+
+// splitUnresolvable moves the nodes of failedNodes without a healthy GPU to the returned map
+// under ZeroHealthyGPUExclude, so kube-scheduler doesn't try to make room on them.
+func splitUnresolvable(nodes map[string]*NodeUsage, failedNodes map[string]string) map[string]string {
+	if config.ZeroHealthyGPUPolicy != ZeroHealthyGPUExclude {
+		return nil
+	}
+	var unresolvable map[string]string
+	for nodeID, reason := range failedNodes {
+		node, ok := nodes[nodeID]
+		if !ok || noHealthyGPU(node) == "" {
+			continue
+		}
+		if unresolvable == nil {
+			unresolvable = make(map[string]string)
+		}
+		unresolvable[nodeID] = reason
+		delete(failedNodes, nodeID)
+	}
+	return unresolvable
+}
+
+// gpuHealthTracker remembers the nodes left without a healthy GPU, to report when they get
+// there and when a GPU of them recovers.
+type gpuHealthTracker struct {
+	mutex     sync.Mutex
+	unhealthy map[string]bool
+}
+
+func newGPUHealthTracker() *gpuHealthTracker {
+	return &gpuHealthTracker{unhealthy: make(map[string]bool)}
+}
+
+// observe records the GPUs of node, and reports whether it just lost its last healthy GPU or
+// just got one back.
+func (t *gpuHealthTracker) observe(nodeID string, healthy, total int) (lost bool, recovered bool) {
+	if t == nil {
+		return false, false
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	none := total > 0 && healthy == 0
+	was := t.unhealthy[nodeID]
+	switch {
+	case none && !was:
+		t.unhealthy[nodeID] = true
+		return true, false
+	case !none && was:
+		delete(t.unhealthy, nodeID)
+		return false, total > 0
+	}
+	return false, false
+}
+
+// observeGPUHealth logs and records on the node the transitions of node into having no healthy
+// GPU and out of it.
+func (s *Scheduler) observeGPUHealth(node *NodeUsage) {
+	if node.Node == nil {
+		return
+	}
+	lost, recovered := s.gpuHealth.observe(node.Node.Name, node.healthyCards, node.cards)
+	switch {
+	case lost:
+		klog.Warningf("node %v has no healthy GPU left, all %d are unhealthy, pods with devices are not placed there (zero healthy GPU policy %s)", node.Node.Name, node.cards, config.ZeroHealthyGPUPolicy)
+		s.recordGPUHealthEvent(node.Node, corev1.EventTypeWarning, EventReasonNoHealthyGPU, fmt.Sprintf("All %d GPUs are unhealthy, pods with devices are not placed on the node", node.cards))
+	case recovered:
+		klog.InfoS("Node has healthy GPUs again", "node", node.Node.Name, "healthy", node.healthyCards, "total", node.cards)
+		s.recordGPUHealthEvent(node.Node, corev1.EventTypeNormal, EventReasonGPUHealthRecovered, fmt.Sprintf("%d of %d GPUs are healthy again", node.healthyCards, node.cards))
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func Test_ValidateZeroHealthyGPUPolicy(t *testing.T) {
+	assert.NilError(t, ValidateZeroHealthyGPUPolicy(ZeroHealthyGPUExclude))
+	assert.NilError(t, ValidateZeroHealthyGPUPolicy(ZeroHealthyGPUKeep))
+	assert.ErrorContains(t, ValidateZeroHealthyGPUPolicy("drain"), "unknown zero healthy GPU policy")
+}
+
+func Test_gpuHealthTracker(t *testing.T) {
+	tr := newGPUHealthTracker()
+	steps := []struct {
+		healthy, total  int
+		lost, recovered bool
+	}{
+		{healthy: 2, total: 2},
+		{healthy: 0, total: 2, lost: true},
+		// Reported once until a GPU recovers.
+		{healthy: 0, total: 2},
+		{healthy: 1, total: 2, recovered: true},
+		{healthy: 2, total: 2},
+		{healthy: 0, total: 2, lost: true},
+		// Devices gone with the device plugin are no recovery.
+		{healthy: 0, total: 0},
+		{healthy: 0, total: 2, lost: true},
+	}
+	for i, s := range steps {
+		lost, recovered := tr.observe("node1", s.healthy, s.total)
+		assert.Equal(t, lost, s.lost, "step %d", i)
+		assert.Equal(t, recovered, s.recovered, "step %d", i)
+	}
+
+	var none *gpuHealthTracker
+	lost, recovered := none.observe("node1", 0, 2)
+	assert.Assert(t, !lost && !recovered)
+}
+
+func gpuHealthScheduler(health ...bool) *Scheduler {
+	s := NewScheduler()
+	info := &util.NodeInfo{
+		ID:   "node1",
+		Node: &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}},
+	}
+	for i, h := range health {
+		info.Devices = append(info.Devices, util.DeviceInfo{
+			ID: "GPU" + string(rune('0'+i)), Index: uint(i), Count: 10, Devmem: 8000, Devcore: 100,
+			Type: nvidia.NvidiaGPUDevice, DeviceVendor: nvidia.NvidiaGPUDevice, Health: h,
+		})
+	}
+	s.addNode("node1", info)
+	return s
+}
+
+func Test_calcScoreZeroHealthyGPU(t *testing.T) {
+	prev := config.ZeroHealthyGPUPolicy
+	defer func() { config.ZeroHealthyGPUPolicy = prev }()
+
+	nums := util.PodDeviceRequests{{nvidia.NvidiaGPUDevice: util.ContainerDeviceRequest{Nums: 1, Type: nvidia.NvidiaGPUDevice, Memreq: 1000, Coresreq: 10}}}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "trainer", Namespace: "default"}}
+	names := []string{"node1"}
+
+	// All unhealthy: the node is rejected with the reason, and reported as unresolvable unless kept.
+	s := gpuHealthScheduler(false, false)
+	nodes, failedNodes, err := s.getNodesUsage(&names, pod)
+	assert.NilError(t, err)
+	assert.Equal(t, (*nodes)["node1"].cards, 2)
+	assert.Equal(t, (*nodes)["node1"].healthyCards, 0)
+	assert.Assert(t, s.gpuHealth.unhealthy["node1"])
+	res, err := s.calcScore(nodes, nums, nil, pod, failedNodes)
+	assert.NilError(t, err)
+	assert.Equal(t, len(res.NodeList), 0)
+	assert.Equal(t, failedNodes["node1"], "node has no healthy GPU: 2 of 2 unhealthy")
+
+	config.ZeroHealthyGPUPolicy = ZeroHealthyGPUKeep
+	kept := map[string]string{"node1": failedNodes["node1"]}
+	assert.Equal(t, len(splitUnresolvable(*nodes, kept)), 0)
+	assert.Equal(t, len(kept), 1)
+
+	config.ZeroHealthyGPUPolicy = ZeroHealthyGPUExclude
+	unresolvable := splitUnresolvable(*nodes, failedNodes)
+	assert.DeepEqual(t, unresolvable, map[string]string{"node1": "node has no healthy GPU: 2 of 2 unhealthy"})
+	assert.Equal(t, len(failedNodes), 0)
+
+	// One GPU recovers: the node is placed on again.
+	s.addNode("node1", gpuHealthScheduler(false, true).nodes["node1"])
+	nodes, failedNodes, err = s.getNodesUsage(&names, pod)
+	assert.NilError(t, err)
+	assert.Equal(t, (*nodes)["node1"].healthyCards, 1)
+	assert.Assert(t, !s.gpuHealth.unhealthy["node1"])
+	res, err = s.calcScore(nodes, nums, nil, pod, failedNodes)
+	assert.NilError(t, err)
+	assert.Equal(t, len(res.NodeList), 1)
+	assert.Equal(t, len(failedNodes), 0)
+	assert.Equal(t, len(splitUnresolvable(*nodes, failedNodes)), 0)
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// PluginHeartbeat is the handshake state of the device plugin of one vendor on one node.
+type PluginHeartbeat struct {
+	Node   string `json:"node"`
+	Vendor string `json:"vendor"`
+	// State is "Reported" after the plugin registered its devices, "Requesting" while the
+	// scheduler waits for the next registration, or "Deleted" once the devices were cleaned up.
+	State string `json:"state"`
+	// Since is the time of the last report, request or clean-up, if it could be parsed.
+	Since   *time.Time `json:"since,omitempty"`
+	Healthy bool       `json:"healthy"`
+}
+
+// CacheSynced reports an error until the devices of the nodes were registered for the first time,
+// before that every pod would be rejected for lack of devices.
+func (s *Scheduler) CacheSynced() error {
+	if !s.synced.Load() {
+		return errors.New("node devices are not registered yet")
+	}
+	return nil
+}
+
+// PluginHeartbeats returns the handshake state of the device plugins on the nodes the scheduler
+// watches, sorted by node and vendor. A plugin is unhealthy once it missed a registration request.
+func (s *Scheduler) PluginHeartbeats() ([]PluginHeartbeat, error) {
+	nodes, err := s.nodeLister.List(labels.Set(config.NodeLabelSelector).AsSelector())
+	if err != nil {
+		return nil, err
+	}
+	return pluginHeartbeats(nodes), nil
+}
+
+func pluginHeartbeats(nodes []*corev1.Node) []PluginHeartbeat {
+	res := make([]PluginHeartbeat, 0)
+	for _, n := range nodes {
+		for vendor, dev := range device.GetDevices() {
+			handshake, ok := n.Annotations[util.HandshakeAnnos[vendor]]
+			if !ok || util.HandshakeAnnos[vendor] == "" {
+				continue
+			}
+			state, since := parseHandshake(handshake)
+			healthy, _ := dev.CheckHealth(vendor, n)
+			res = append(res, PluginHeartbeat{Node: n.Name, Vendor: vendor, State: state, Since: since, Healthy: healthy})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Node != res[j].Node {
+			return res[i].Node < res[j].Node
+		}
+		return res[i].Vendor < res[j].Vendor
+	})
+	return res
+}
+
+// parseHandshake splits a handshake annotation like "Requesting_2024-01-02 15:04:05", written by
+// the scheduler, or "Reported 2024-01-02 15:04:05.123 +0000 UTC m=+1.2", written by the plugins.
+func parseHandshake(handshake string) (string, *time.Time) {
+	state, at, found := strings.Cut(handshake, "_")
+	if !found {
+		state, at, _ = strings.Cut(handshake, " ")
+	}
+	// Drop the monotonic clock reading of time.Time.String.
+	at, _, _ = strings.Cut(at, " m=")
+	for _, layout := range []string{time.DateTime, "2006-01-02 15:04:05.999999999 -0700 MST"} {
+		if t, err := time.Parse(layout, at); err == nil {
+			return state, &t
+		}
+	}
+	return state, nil
+}
+
+// UnhealthyPlugins summarizes the unhealthy entries of heartbeats, or returns nil if there are none.
+func UnhealthyPlugins(heartbeats []PluginHeartbeat) error {
+	var names []string
+	for _, h := range heartbeats {
+		if !h.Healthy {
+			names = append(names, fmt.Sprintf("%s on %s", h.Vendor, h.Node))
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d device plugin(s) missed their registration: %s", len(names), strings.Join(names, ", "))
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func Test_parseHandshake(t *testing.T) {
+	state, since := parseHandshake("Requesting_2024-01-02 15:04:05")
+	assert.Equal(t, state, "Requesting")
+	assert.Equal(t, since.Format(time.DateTime), "2024-01-02 15:04:05")
+
+	state, since = parseHandshake("Reported 2024-01-02 15:04:05.123456789 +0000 UTC m=+12.345")
+	assert.Equal(t, state, "Reported")
+	assert.Equal(t, since.Format(time.DateTime), "2024-01-02 15:04:05")
+
+	state, since = parseHandshake("Deleted")
+	assert.Equal(t, state, "Deleted")
+	assert.Assert(t, since == nil)
+}
+
+func Test_pluginHeartbeats(t *testing.T) {
+	node := func(name, handshake string) *corev1.Node {
+		n := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: map[string]string{}}}
+		if handshake != "" {
+			n.Annotations[util.HandshakeAnnos[nvidia.NvidiaGPUDevice]] = handshake
+		}
+		return n
+	}
+	stale := "Requesting_" + time.Now().Add(-time.Hour).Format(time.DateTime)
+	heartbeats := pluginHeartbeats([]*corev1.Node{
+		node("node-b", stale),
+		node("node-a", "Reported "+time.Now().String()),
+		node("cpu-node", ""),
+	})
+	assert.Equal(t, len(heartbeats), 2)
+	assert.Equal(t, heartbeats[0].Node, "node-a")
+	assert.Equal(t, heartbeats[0].State, "Reported")
+	assert.Assert(t, heartbeats[0].Healthy)
+	assert.Equal(t, heartbeats[1].Node, "node-b")
+	assert.Assert(t, !heartbeats[1].Healthy)
+	assert.Error(t, UnhealthyPlugins(heartbeats), "1 device plugin(s) missed their registration: NVIDIA on node-b")
+	assert.NilError(t, UnhealthyPlugins(heartbeats[:1]))
+}
+
+func Test_CacheSynced(t *testing.T) {
+	s := &Scheduler{}
+	assert.ErrorContains(t, s.CacheSynced(), "not registered yet")
+	s.synced.Store(true)
+	assert.NilError(t, s.CacheSynced())
+}
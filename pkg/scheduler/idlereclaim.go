@@ -0,0 +1,81 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+
+	k8stypes "k8s.io/apimachinery/pkg/types"
+
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// validateGPUReclaimableMemory checks the hami.io/gpu-reclaimable-memory annotation of a pod.
+func validateGPUReclaimableMemory(annos map[string]string) error {
+	v, ok := annos[util.GPUReclaimableMemory]
+	if !ok || v == "false" {
+		return nil
+	}
+	if v != "true" {
+		return fmt.Errorf("annotation %s must be \"true\" or \"false\", got %q", util.GPUReclaimableMemory, v)
+	}
+	if softReservation(annos) {
+		return fmt.Errorf("annotation %s can't be combined with %s %q, whose memory is reclaimed anyway", util.GPUReclaimableMemory, util.GPUTier, util.SoftReservation)
+	}
+	return nil
+}
+
+// validateGPUIdleMemoryLimit denies a pod setting the hami.io/gpu-idle-memory-limit annotation,
+// which only the vGPU monitor sets.
+func validateGPUIdleMemoryLimit(annos map[string]string) error {
+	if _, ok := annos[util.GPUIdleMemoryLimit]; ok {
+		return fmt.Errorf("annotation %s is set by the vGPU monitor, pods can't set it", util.GPUIdleMemoryLimit)
+	}
+	return nil
+}
+
+// idleMemoryLimit returns the memory per card, in bytes, the vGPU monitor lowered the limit of
+// the idle pod p to, from the limits it keeps on the node, 0 if it didn't. The monitor lowers
+// it to 1 MiB at least, as HAMi-core takes 0 as no limit.
+func idleMemoryLimit(limits map[k8stypes.UID]int64, p *podInfo) int64 {
+	if !p.Reclaimable {
+		return 0
+	}
+	return limits[p.UID]
+}
+
+// idleMemory returns the memory the idle pod holds with udevice while its limit is limit.
+func idleMemory(limit int64, udevice util.ContainerDevice) int64 {
+	return min(limit, udevice.Usedmem)
+}
+
+// addIdleUsage gives back the memory the idle pod p, whose devices are already added to
+// node, doesn't hold while its limit is lowered to limit. The cards may be over-committed
+// once it is raised again, which keeps new pods off them until the memory is free.
+func addIdleUsage(node *NodeUsage, p *podInfo, limit int64) {
+	for _, podSingle := range p.Devices {
+		for _, ctrdevs := range podSingle {
+			for _, udevice := range ctrdevs {
+				for _, d := range node.Devices.DeviceLists {
+					if d.Device.ID == udevice.UUID {
+						d.Device.Usedmem -= udevice.Usedmem - idleMemory(limit, udevice)
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/k8sutil"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/policy"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func Test_validateGPUReclaimableMemory(t *testing.T) {
+	assert.NilError(t, validateGPUReclaimableMemory(nil))
+	assert.NilError(t, validateGPUReclaimableMemory(map[string]string{util.GPUReclaimableMemory: "true"}))
+	assert.NilError(t, validateGPUReclaimableMemory(map[string]string{util.GPUReclaimableMemory: "false", util.GPUTier: util.SoftReservation}))
+	assert.ErrorContains(t, validateGPUReclaimableMemory(map[string]string{util.GPUReclaimableMemory: "yes"}), `annotation hami.io/gpu-reclaimable-memory must be "true" or "false", got "yes"`)
+	assert.ErrorContains(t, validateGPUReclaimableMemory(map[string]string{util.GPUReclaimableMemory: "true", util.GPUTier: util.SoftReservation}), "can't be combined")
+}
+
+func Test_validateGPUIdleMemoryLimit(t *testing.T) {
+	assert.NilError(t, validateGPUIdleMemoryLimit(map[string]string{util.GPUReclaimableMemory: "true"}))
+	assert.ErrorContains(t, validateGPUIdleMemoryLimit(map[string]string{util.GPUIdleMemoryLimit: "1"}), "pods can't set it")
+}
+
+func Test_addIdleUsage(t *testing.T) {
+	m := newPodManager()
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "notebook", Namespace: "default", UID: "uid-1", Annotations: map[string]string{
+		util.GPUReclaimableMemory: "true",
+		// The annotation of the pod only shows the limit.
+		util.GPUIdleMemoryLimit: "1",
+	}}}
+	devices := util.PodDevices{nvidia.NvidiaGPUDevice: util.PodSingleDevice{{{UUID: "GPU-0", Usedmem: 6000 * util.MiB}}}}
+	m.addPod(pod, "node1", devices)
+	p, _ := m.getPod(pod.UID)
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1", Annotations: map[string]string{
+		util.GPUIdleMemoryLimits: `{"uid-1":500,"uid-2":100}`,
+	}}}
+	limits := k8sutil.NodeIdleMemoryLimits(node)
+	assert.Equal(t, idleMemoryLimit(limits, p), 500*util.MiB)
+
+	usage := &NodeUsage{Devices: policy.DeviceUsageList{DeviceLists: []*policy.DeviceListsScore{{Device: &util.DeviceUsage{
+		ID: "GPU-0", Count: 10, Totalmem: 8000 * util.MiB,
+	}}}}}
+	addPodUsage(usage, p.Devices)
+	addIdleUsage(usage, p, idleMemoryLimit(limits, p))
+	d := usage.Devices.DeviceLists[0].Device
+	// The idle pod only counts with what its limit was lowered to.
+	assert.Equal(t, d.Usedmem, 500*util.MiB)
+	assert.Equal(t, d.Used, int32(1))
+
+	// A limit of a pod which didn't opt in isn't trusted.
+	delete(pod.Annotations, util.GPUReclaimableMemory)
+	m.delPod(pod)
+	m.addPod(pod, "node1", devices)
+	p, _ = m.getPod(pod.UID)
+	assert.Equal(t, idleMemoryLimit(limits, p), int64(0))
+	// Nor is one the monitor didn't record on the node.
+	assert.Equal(t, idleMemoryLimit(nil, &podInfo{UID: "uid-1", Reclaimable: true}), int64(0))
+}
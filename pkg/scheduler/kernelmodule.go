@@ -0,0 +1,47 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// kernelModuleMismatch returns why node can't run a pod requiring an NVIDIA kernel module
+// variant with the hami.io/nvidia-kernel-module annotation, or "" if it can. Nodes whose
+// device plugin hasn't reported the variant yet are excluded until it does.
+func kernelModuleMismatch(node *corev1.Node, annos map[string]string) string {
+	want, ok := annos[util.NvidiaKernelModule]
+	if !ok {
+		return ""
+	}
+	var got string
+	if node != nil {
+		got = node.Annotations[util.NodeNvidiaKernelModuleAnnos]
+	}
+	switch got {
+	case want:
+		return ""
+	case "":
+		return fmt.Sprintf("node hasn't reported its NVIDIA kernel module yet, %s requested", want)
+	default:
+		return fmt.Sprintf("node runs the %s NVIDIA kernel module, %s requested", got, want)
+	}
+}
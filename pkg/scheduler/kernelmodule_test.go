@@ -0,0 +1,91 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/policy"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func kernelModuleNode(module string) *corev1.Node {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{}}}
+	if module != "" {
+		node.Annotations[util.NodeNvidiaKernelModuleAnnos] = module
+	}
+	return node
+}
+
+func Test_kernelModuleMismatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		annos map[string]string
+		node  *corev1.Node
+		want  string
+	}{
+		{name: "no constraint", annos: map[string]string{}, node: kernelModuleNode(""), want: ""},
+		{name: "variant matches", annos: map[string]string{util.NvidiaKernelModule: "open"}, node: kernelModuleNode("open"), want: ""},
+		{
+			name:  "variant differs",
+			annos: map[string]string{util.NvidiaKernelModule: "open"},
+			node:  kernelModuleNode("proprietary"),
+			want:  "node runs the proprietary NVIDIA kernel module, open requested",
+		},
+		{
+			name:  "variant not reported",
+			annos: map[string]string{util.NvidiaKernelModule: "proprietary"},
+			node:  kernelModuleNode(""),
+			want:  "node hasn't reported its NVIDIA kernel module yet, proprietary requested",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, kernelModuleMismatch(test.node, test.annos), test.want)
+		})
+	}
+}
+
+func Test_calcScoreKernelModule(t *testing.T) {
+	nodes := map[string]*NodeUsage{}
+	for name, module := range map[string]string{"open-node": "open", "proprietary-node": "proprietary", "new-node": ""} {
+		nodes[name] = &NodeUsage{
+			Node: kernelModuleNode(module),
+			Devices: policy.DeviceUsageList{
+				Policy: util.GPUSchedulerPolicySpread.String(),
+				DeviceLists: []*policy.DeviceListsScore{{Device: &util.DeviceUsage{
+					ID: name + "-gpu", Type: nvidia.NvidiaGPUDevice, Count: 10, Totalmem: 8000, Totalcore: 100, Health: true,
+				}}},
+			},
+		}
+	}
+	nums := util.PodDeviceRequests{{nvidia.NvidiaGPUDevice: util.ContainerDeviceRequest{Nums: 1, Type: nvidia.NvidiaGPUDevice, Memreq: 1000, Coresreq: 10}}}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "trainer", Namespace: "default", Annotations: map[string]string{util.NvidiaKernelModule: "open"}}}
+
+	failedNodes := map[string]string{}
+	res, err := NewScheduler().calcScore(&nodes, nums, pod.Annotations, pod, failedNodes)
+	assert.NilError(t, err)
+	assert.Equal(t, len(res.NodeList), 1)
+	assert.Equal(t, res.NodeList[0].NodeID, "open-node")
+	assert.Equal(t, failedNodes["proprietary-node"], "node runs the proprietary NVIDIA kernel module, open requested")
+	assert.Equal(t, failedNodes["new-node"], "node hasn't reported its NVIDIA kernel module yet, open requested")
+}
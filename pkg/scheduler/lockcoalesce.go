@@ -0,0 +1,168 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"maps"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/metrics"
+	"github.com/Project-HAMi/HAMi/pkg/util/nodelock"
+)
+
+// lockWritesPerCycle is the number of node annotation writes of releasing a node lock and
+// taking it again: one update removing the lock and one setting it.
+const lockWritesPerCycle = 2
+
+// lockWritesPerHandover is the number of node annotation writes saved by handing a node lock
+// over to the next pod, which replaces the lock with a single update.
+const lockWritesPerHandover = lockWritesPerCycle - 1
+
+// deferredRelease is the release of the node locks a pod took for a failed bind.
+type deferredRelease struct {
+	pod     k8stypes.UID
+	release func()
+	// handover passes the locks on to another pod and reports whether it did, may be nil.
+	handover func(next *corev1.Pod) bool
+	timer    *time.Timer
+}
+
+// lockCoalescer defers the release of the node locks of a failed bind by a short window.
+// A retry of the same pod on the same node within the window keeps the locks instead of
+// writing the node twice. Another pod binding to the node within the window has the locks
+// handed over in one write where possible, and releases them first otherwise, so no release
+// is lost. A nil *lockCoalescer releases the locks right away.
+type lockCoalescer struct {
+	window  time.Duration
+	mutex   sync.Mutex
+	pending map[string]*deferredRelease
+}
+
+func newLockCoalescer(window time.Duration) *lockCoalescer {
+	if window <= 0 {
+		return nil
+	}
+	return &lockCoalescer{window: window, pending: make(map[string]*deferredRelease)}
+}
+
+// take reports whether pod holds the node locks of nodeID, either still from its own failed
+// bind or handed over from the failed bind of another pod. Otherwise the deferred release of
+// the other pod on the node is carried out first.
+func (c *lockCoalescer) take(nodeID string, pod *corev1.Pod) bool {
+	if c == nil {
+		return false
+	}
+	c.mutex.Lock()
+	d, ok := c.pending[nodeID]
+	delete(c.pending, nodeID)
+	c.mutex.Unlock()
+	if !ok {
+		return false
+	}
+	d.timer.Stop()
+	if d.pod == pod.UID {
+		klog.V(4).InfoS("Keeping node locks of a failed bind for its retry", "pod", klog.KObj(pod), "node", nodeID)
+		metrics.NodeLockWritesSaved.Add(lockWritesPerCycle)
+		return true
+	}
+	if d.handover != nil && d.handover(pod) {
+		klog.V(4).InfoS("Handed node locks of a failed bind over", "pod", klog.KObj(pod), "node", nodeID)
+		metrics.NodeLockWritesSaved.Add(lockWritesPerHandover)
+		return true
+	}
+	d.release()
+	return false
+}
+
+// release releases the node locks pod took on nodeID after the window, unless the pod
+// takes them again or they are handed over to another pod before.
+func (c *lockCoalescer) release(nodeID string, pod *corev1.Pod, release func(), handover func(next *corev1.Pod) bool) {
+	if c == nil {
+		release()
+		return
+	}
+	d := &deferredRelease{pod: pod.UID, release: release, handover: handover}
+	c.mutex.Lock()
+	prev := c.pending[nodeID]
+	c.pending[nodeID] = d
+	d.timer = time.AfterFunc(c.window, func() { c.expire(nodeID, d) })
+	c.mutex.Unlock()
+	if prev != nil {
+		prev.timer.Stop()
+		prev.release()
+	}
+}
+
+func (c *lockCoalescer) expire(nodeID string, d *deferredRelease) {
+	c.mutex.Lock()
+	if c.pending[nodeID] != d {
+		c.mutex.Unlock()
+		return
+	}
+	delete(c.pending, nodeID)
+	c.mutex.Unlock()
+	d.release()
+}
+
+// flush carries out all deferred releases.
+func (c *lockCoalescer) flush() {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	pending := c.pending
+	c.pending = make(map[string]*deferredRelease)
+	c.mutex.Unlock()
+	for _, d := range pending {
+		d.timer.Stop()
+		d.release()
+	}
+}
+
+// handOverNodeLock hands the node lock prev holds on nodeID over to next. It only does so if
+// both pods request the same devices, so they take and release the same locks.
+func handOverNodeLock(nodeID string, prev, next *corev1.Pod) bool {
+	prevDevices, nextDevices := requestedDevices(prev), requestedDevices(next)
+	if len(prevDevices) == 0 || !maps.Equal(prevDevices, nextDevices) {
+		return false
+	}
+	if err := nodelock.TransferNodeLock(nodeID, prev, next); err != nil {
+		klog.V(4).InfoS("Failed to hand node lock over", "node", nodeID, "pod", klog.KObj(next), "err", err)
+		return false
+	}
+	return true
+}
+
+// requestedDevices returns the names of the devices any container of pod requests.
+func requestedDevices(pod *corev1.Pod) map[string]bool {
+	requested := make(map[string]bool)
+	for name, dev := range device.GetDevices() {
+		for _, ctr := range pod.Spec.Containers {
+			if dev.GenerateResourceRequests(&ctr).Nums > 0 {
+				requested[name] = true
+				break
+			}
+		}
+	}
+	return requested
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_lockCoalescer(t *testing.T) {
+	podA := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "a", UID: "uid-a"}}
+	podB := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "b", UID: "uid-b"}}
+
+	t.Run("disabled releases right away", func(t *testing.T) {
+		var c *lockCoalescer
+		released := 0
+		c.release("node1", podA, func() { released++ }, nil)
+		assert.Equal(t, released, 1)
+		assert.Equal(t, c.take("node1", podA), false)
+		c.flush()
+	})
+
+	t.Run("retry of the same pod keeps the locks", func(t *testing.T) {
+		c := newLockCoalescer(time.Hour)
+		released := 0
+		c.release("node1", podA, func() { released++ }, nil)
+		assert.Equal(t, c.take("node1", podA), true)
+		c.flush()
+		assert.Equal(t, released, 0)
+	})
+
+	t.Run("another pod releases the locks first", func(t *testing.T) {
+		c := newLockCoalescer(time.Hour)
+		released := 0
+		c.release("node1", podA, func() { released++ }, nil)
+		assert.Equal(t, c.take("node2", podB), false)
+		assert.Equal(t, released, 0)
+		assert.Equal(t, c.take("node1", podB), false)
+		assert.Equal(t, released, 1)
+		assert.Equal(t, c.take("node1", podA), false)
+	})
+
+	t.Run("locks are handed over to another pod", func(t *testing.T) {
+		c := newLockCoalescer(time.Hour)
+		released := 0
+		var handedTo *corev1.Pod
+		c.release("node1", podA, func() { released++ }, func(next *corev1.Pod) bool {
+			handedTo = next
+			return true
+		})
+		assert.Equal(t, c.take("node1", podB), true)
+		assert.Equal(t, handedTo, podB)
+		c.flush()
+		assert.Equal(t, released, 0)
+	})
+
+	t.Run("locks are released if the handover fails", func(t *testing.T) {
+		c := newLockCoalescer(time.Hour)
+		released := 0
+		c.release("node1", podA, func() { released++ }, func(*corev1.Pod) bool { return false })
+		assert.Equal(t, c.take("node1", podB), false)
+		assert.Equal(t, released, 1)
+	})
+
+	t.Run("locks are released after the window", func(t *testing.T) {
+		c := newLockCoalescer(10 * time.Millisecond)
+		var released atomic.Int32
+		c.release("node1", podA, func() { released.Add(1) }, nil)
+		assert.Assert(t, waitFor(func() bool { return released.Load() == 1 }))
+		assert.Equal(t, c.take("node1", podA), false)
+		c.flush()
+		assert.Equal(t, released.Load(), int32(1))
+	})
+
+	t.Run("flush releases all", func(t *testing.T) {
+		c := newLockCoalescer(time.Hour)
+		released := 0
+		c.release("node1", podA, func() { released++ }, nil)
+		c.release("node2", podB, func() { released++ }, nil)
+		c.flush()
+		assert.Equal(t, released, 2)
+		assert.Equal(t, c.take("node1", podA), false)
+	})
+}
+
+func waitFor(cond func() bool) bool {
+	for range 100 {
+		if cond() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
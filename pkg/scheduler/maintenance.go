@@ -0,0 +1,91 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	// The scheduler image may lack the time zone database.
+	_ "time/tzdata"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// maintenanceTimeLayout is the layout of window bounds without an offset, which are in the
+// time zone of the hami.io/gpu-maintenance-timezone annotation.
+const maintenanceTimeLayout = "2006-01-02T15:04"
+
+// parseMaintenanceWindow parses a "<start>/<end>" window, each bound either RFC 3339 or
+// maintenanceTimeLayout in loc.
+func parseMaintenanceWindow(value string, loc *time.Location) (time.Time, time.Time, error) {
+	bounds := strings.Split(value, "/")
+	if len(bounds) != 2 {
+		return time.Time{}, time.Time{}, fmt.Errorf("window %q is not <start>/<end>", value)
+	}
+	var parsed [2]time.Time
+	for i, b := range bounds {
+		b = strings.TrimSpace(b)
+		t, err := time.Parse(time.RFC3339, b)
+		if err != nil {
+			t, err = time.ParseInLocation(maintenanceTimeLayout, b, loc)
+		}
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("window bound %q is neither RFC 3339 nor %s", b, maintenanceTimeLayout)
+		}
+		parsed[i] = t
+	}
+	if !parsed[0].Before(parsed[1]) {
+		return time.Time{}, time.Time{}, fmt.Errorf("window %q ends before it starts", value)
+	}
+	return parsed[0], parsed[1], nil
+}
+
+// underMaintenance returns why no GPU pods may be placed on node at now because of its
+// hami.io/gpu-maintenance-window annotation, or "" if they may. Invalid windows are logged
+// and ignored, so a typo doesn't take the GPUs of a node out of service.
+func underMaintenance(node *corev1.Node, now time.Time) string {
+	if node == nil {
+		return ""
+	}
+	value, ok := node.Annotations[util.NodeGPUMaintenanceWindow]
+	if !ok {
+		return ""
+	}
+	loc := time.UTC
+	if tz, ok := node.Annotations[util.NodeGPUMaintenanceTimezone]; ok {
+		l, err := time.LoadLocation(tz)
+		if err != nil {
+			klog.ErrorS(err, "Ignoring GPU maintenance window with an unknown time zone", "node", node.Name, "timezone", tz)
+			return ""
+		}
+		loc = l
+	}
+	start, end, err := parseMaintenanceWindow(value, loc)
+	if err != nil {
+		klog.ErrorS(err, "Ignoring invalid GPU maintenance window", "node", node.Name)
+		return ""
+	}
+	if now.Before(start) || !now.Before(end) {
+		return ""
+	}
+	klog.InfoS("Node is under GPU maintenance", "node", node.Name, "start", start, "end", end)
+	return fmt.Sprintf("node is under GPU maintenance until %s", end.Format(time.RFC3339))
+}
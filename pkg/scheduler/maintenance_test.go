@@ -0,0 +1,106 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/policy"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func maintenanceNode(window, timezone string) *corev1.Node {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1", Annotations: map[string]string{}}}
+	if window != "" {
+		node.Annotations[util.NodeGPUMaintenanceWindow] = window
+	}
+	if timezone != "" {
+		node.Annotations[util.NodeGPUMaintenanceTimezone] = timezone
+	}
+	return node
+}
+
+func Test_underMaintenance(t *testing.T) {
+	now := time.Date(2026, 10, 15, 20, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		node *corev1.Node
+		want string
+	}{
+		{name: "no window", node: maintenanceNode("", ""), want: ""},
+		{
+			name: "within an RFC 3339 window",
+			node: maintenanceNode("2026-10-15T22:00:00+02:00/2026-10-16T04:00:00+02:00", ""),
+			want: "node is under GPU maintenance until 2026-10-16T04:00:00+02:00",
+		},
+		{name: "before the window", node: maintenanceNode("2026-10-15T21:00:00Z/2026-10-15T23:00:00Z", ""), want: ""},
+		{name: "after the window", node: maintenanceNode("2026-10-15T18:00:00Z/2026-10-15T20:30:00Z", ""), want: ""},
+		{
+			name: "local time in UTC by default",
+			node: maintenanceNode("2026-10-15T20:00/2026-10-15T21:00", ""),
+			want: "node is under GPU maintenance until 2026-10-15T21:00:00Z",
+		},
+		{
+			name: "local time in the node time zone",
+			node: maintenanceNode("2026-10-15T22:00/2026-10-16T01:00", "Europe/Berlin"),
+			want: "node is under GPU maintenance until 2026-10-16T01:00:00+02:00",
+		},
+		{name: "local time outside in the node time zone", node: maintenanceNode("2026-10-15T20:00/2026-10-15T21:00", "Asia/Tokyo"), want: ""},
+		{name: "unknown time zone", node: maintenanceNode("2026-10-15T20:00/2026-10-15T21:00", "Mars/Olympus"), want: ""},
+		{name: "malformed window", node: maintenanceNode("tonight", ""), want: ""},
+		{name: "reversed window", node: maintenanceNode("2026-10-15T21:00:00Z/2026-10-15T20:00:00Z", ""), want: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, underMaintenance(test.node, now), test.want)
+		})
+	}
+}
+
+func Test_calcScoreMaintenance(t *testing.T) {
+	now := time.Now()
+	nodes := map[string]*NodeUsage{}
+	for name, window := range map[string]string{
+		"idle":     "",
+		"draining": now.Add(-time.Hour).UTC().Format(time.RFC3339) + "/" + now.Add(time.Hour).UTC().Format(time.RFC3339),
+	} {
+		nodes[name] = &NodeUsage{
+			Node: maintenanceNode(window, ""),
+			Devices: policy.DeviceUsageList{
+				Policy: util.GPUSchedulerPolicySpread.String(),
+				DeviceLists: []*policy.DeviceListsScore{{Device: &util.DeviceUsage{
+					ID: name + "-gpu", Type: nvidia.NvidiaGPUDevice, Count: 10, Totalmem: 8000, Totalcore: 100, Health: true,
+				}}},
+			},
+		}
+	}
+	nums := util.PodDeviceRequests{{nvidia.NvidiaGPUDevice: util.ContainerDeviceRequest{Nums: 1, Type: nvidia.NvidiaGPUDevice, Memreq: 1000, Coresreq: 10}}}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "trainer", Namespace: "default"}}
+
+	failedNodes := map[string]string{}
+	res, err := NewScheduler().calcScore(&nodes, nums, nil, pod, failedNodes)
+	assert.NilError(t, err)
+	assert.Equal(t, len(res.NodeList), 1)
+	assert.Equal(t, res.NodeList[0].NodeID, "idle")
+	assert.Assert(t, failedNodes["draining"] != "")
+}
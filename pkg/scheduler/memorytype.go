@@ -0,0 +1,82 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// validateGPUMemoryType rejects hami.io/gpu-memory-type and hami.io/preferred-gpu-memory-type
+// annotations naming an unknown memory type.
+func validateGPUMemoryType(annos map[string]string) error {
+	for _, anno := range []string{util.GPUMemoryType, util.PreferredGPUMemoryType} {
+		if v, ok := annos[anno]; ok && v != util.GPUMemoryTypeHBM && v != util.GPUMemoryTypeGDDR {
+			return fmt.Errorf("annotation %s must be %q or %q, got %q", anno, util.GPUMemoryTypeHBM, util.GPUMemoryTypeGDDR, v)
+		}
+	}
+	return nil
+}
+
+// checkMemoryType returns why the memory type of d doesn't match the hami.io/gpu-memory-type
+// of the pod with annos, "" if it does or the pod has none. Cards of unknown memory type never match.
+func checkMemoryType(annos map[string]string, d *util.DeviceUsage) string {
+	want, ok := annos[util.GPUMemoryType]
+	if !ok || d.MemoryType == want {
+		return ""
+	}
+	if d.MemoryType == "" {
+		return fmt.Sprintf("card memory type is unknown, %s wanted", want)
+	}
+	return fmt.Sprintf("card has %s memory, %s wanted", d.MemoryType, want)
+}
+
+// validateGPUDeviceKind rejects a hami.io/gpu-device-kind annotation naming an unknown kind.
+func validateGPUDeviceKind(annos map[string]string) error {
+	if v, ok := annos[util.GPUDeviceKind]; ok && v != util.GPUDeviceKindPhysical && v != util.GPUDeviceKindVirtual {
+		return fmt.Errorf("annotation %s must be %q or %q, got %q", util.GPUDeviceKind, util.GPUDeviceKindPhysical, util.GPUDeviceKindVirtual, v)
+	}
+	return nil
+}
+
+// checkDeviceKind returns why d isn't of the hami.io/gpu-device-kind of the pod with annos, ""
+// if it is or the pod has none. Cards of unknown kind never match.
+func checkDeviceKind(annos map[string]string, d *util.DeviceUsage) string {
+	want, ok := annos[util.GPUDeviceKind]
+	if !ok || d.DeviceKind == want {
+		return ""
+	}
+	if d.DeviceKind == "" {
+		return fmt.Sprintf("card kind is unknown, %s wanted", want)
+	}
+	return fmt.Sprintf("card is %s, %s wanted", d.DeviceKind, want)
+}
+
+// preferMemoryType raises the score of the cards of node with the memory type the pod with
+// annos prefers by weight.
+func preferMemoryType(node *NodeUsage, annos map[string]string, weight float32) {
+	want, ok := annos[util.PreferredGPUMemoryType]
+	if !ok {
+		return
+	}
+	for _, d := range node.Devices.DeviceLists {
+		if d.Device.MemoryType == want {
+			d.AddPreference(node.Devices.Policy, weight)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/policy"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func Test_validateGPUMemoryType(t *testing.T) {
+	assert.NilError(t, validateGPUMemoryType(nil))
+	assert.NilError(t, validateGPUMemoryType(map[string]string{util.GPUMemoryType: util.GPUMemoryTypeHBM, util.PreferredGPUMemoryType: util.GPUMemoryTypeGDDR}))
+	assert.ErrorContains(t, validateGPUMemoryType(map[string]string{util.GPUMemoryType: "HBM3"}), `annotation hami.io/gpu-memory-type must be "hbm" or "gddr", got "HBM3"`)
+	assert.ErrorContains(t, validateGPUMemoryType(map[string]string{util.PreferredGPUMemoryType: ""}), "hami.io/preferred-gpu-memory-type")
+}
+
+func Test_calcScoreMemoryType(t *testing.T) {
+	prev := device.ActiveConfig()
+	initTFLOPSDevices(t)
+	defer func() { assert.NilError(t, device.InitDevicesWithConfig(prev)) }()
+	prevWeight := config.MemoryTypeWeight
+	defer func() { config.MemoryTypeWeight = prevWeight }()
+	config.MemoryTypeWeight = 10
+
+	// GPU-0 has GDDR memory, GPU-1 HBM, GPU-2 an unknown memory type. GPU-0 is the emptiest
+	// card, so the spread policy picks it without a memory type annotation.
+	newNodes := func(memoryTypes ...string) map[string]*NodeUsage {
+		devices := policy.DeviceUsageList{Policy: util.GPUSchedulerPolicySpread.String()}
+		for i, memoryType := range memoryTypes {
+			devices.DeviceLists = append(devices.DeviceLists, &policy.DeviceListsScore{Device: &util.DeviceUsage{
+				ID: fmt.Sprintf("GPU-%d", i), Type: "NVIDIA-Tesla T4", Count: 10, Totalmem: 8000 * util.MiB, Totalcore: 100, Health: true, MemoryType: memoryType,
+				Used: int32(i), Usedmem: int64(i) * 1000 * util.MiB, Usedcores: int32(i) * 10,
+			}})
+		}
+		node := &NodeUsage{Node: &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}, Devices: devices}
+		return map[string]*NodeUsage{"node1": node}
+	}
+	nums := util.PodDeviceRequests{{nvidia.NvidiaGPUDevice: util.ContainerDeviceRequest{Nums: 1, Type: nvidia.NvidiaGPUDevice, Memreq: 1000 * util.MiB, Coresreq: 10}}}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "trainer", Namespace: "default"}}
+	place := func(annos map[string]string, memoryTypes ...string) (string, string) {
+		nodes := newNodes(memoryTypes...)
+		failedNodes := map[string]string{}
+		res, err := NewScheduler().calcScore(&nodes, nums, annos, pod, failedNodes)
+		assert.NilError(t, err)
+		if len(res.NodeList) == 0 {
+			return "", failedNodes["node1"]
+		}
+		return res.NodeList[0].Devices[nvidia.NvidiaGPUDevice][0][0].UUID, ""
+	}
+	all := []string{util.GPUMemoryTypeGDDR, util.GPUMemoryTypeHBM, ""}
+
+	card, _ := place(nil, all...)
+	assert.Equal(t, card, "GPU-0")
+	card, _ = place(map[string]string{util.GPUMemoryType: util.GPUMemoryTypeHBM}, all...)
+	assert.Equal(t, card, "GPU-1")
+	card, _ = place(map[string]string{util.PreferredGPUMemoryType: util.GPUMemoryTypeHBM}, all...)
+	assert.Equal(t, card, "GPU-1")
+
+	// A requirement excludes nodes without a matching card, unknown memory types never match.
+	_, reason := place(map[string]string{util.GPUMemoryType: util.GPUMemoryTypeHBM}, util.GPUMemoryTypeGDDR)
+	assert.Equal(t, reason, "node not fit pod, card has gddr memory, hbm wanted")
+	_, reason = place(map[string]string{util.GPUMemoryType: util.GPUMemoryTypeGDDR}, "")
+	assert.Equal(t, reason, "node not fit pod, card memory type is unknown, gddr wanted")
+
+	// A preference still places the pod on a node without a matching card.
+	card, _ = place(map[string]string{util.PreferredGPUMemoryType: util.GPUMemoryTypeHBM}, util.GPUMemoryTypeGDDR, "")
+	assert.Equal(t, card, "GPU-0")
+
+	config.MemoryTypeWeight = 0
+	card, _ = place(map[string]string{util.PreferredGPUMemoryType: util.GPUMemoryTypeHBM}, all...)
+	assert.Equal(t, card, "GPU-0")
+}
+
+func Test_validateGPUDeviceKind(t *testing.T) {
+	assert.NilError(t, validateGPUDeviceKind(nil))
+	assert.NilError(t, validateGPUDeviceKind(map[string]string{util.GPUDeviceKind: util.GPUDeviceKindPhysical}))
+	assert.NilError(t, validateGPUDeviceKind(map[string]string{util.GPUDeviceKind: util.GPUDeviceKindVirtual}))
+	assert.ErrorContains(t, validateGPUDeviceKind(map[string]string{util.GPUDeviceKind: "vgpu"}), `annotation hami.io/gpu-device-kind must be "physical" or "virtual", got "vgpu"`)
+}
+
+func Test_calcScoreDeviceKind(t *testing.T) {
+	prev := device.ActiveConfig()
+	initTFLOPSDevices(t)
+	defer func() { assert.NilError(t, device.InitDevicesWithConfig(prev)) }()
+
+	// GPU-0 is a simulated vGPU of a VM, GPU-1 a physical card, GPU-2 of unknown kind. GPU-0 is
+	// the emptiest card, so the spread policy picks it without a device kind annotation.
+	newNodes := func(kinds ...string) map[string]*NodeUsage {
+		devices := policy.DeviceUsageList{Policy: util.GPUSchedulerPolicySpread.String()}
+		for i, kind := range kinds {
+			devices.DeviceLists = append(devices.DeviceLists, &policy.DeviceListsScore{Device: &util.DeviceUsage{
+				ID: fmt.Sprintf("GPU-%d", i), Type: "NVIDIA-Tesla T4", Count: 10, Totalmem: 8000 * util.MiB, Totalcore: 100, Health: true, DeviceKind: kind,
+				Used: int32(i), Usedmem: int64(i) * 1000 * util.MiB, Usedcores: int32(i) * 10,
+			}})
+		}
+		node := &NodeUsage{Node: &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}, Devices: devices}
+		return map[string]*NodeUsage{"node1": node}
+	}
+	nums := util.PodDeviceRequests{{nvidia.NvidiaGPUDevice: util.ContainerDeviceRequest{Nums: 1, Type: nvidia.NvidiaGPUDevice, Memreq: 1000 * util.MiB, Coresreq: 10}}}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "trainer", Namespace: "default"}}
+	place := func(annos map[string]string, kinds ...string) (string, string) {
+		nodes := newNodes(kinds...)
+		failedNodes := map[string]string{}
+		res, err := NewScheduler().calcScore(&nodes, nums, annos, pod, failedNodes)
+		assert.NilError(t, err)
+		if len(res.NodeList) == 0 {
+			return "", failedNodes["node1"]
+		}
+		return res.NodeList[0].Devices[nvidia.NvidiaGPUDevice][0][0].UUID, ""
+	}
+	all := []string{util.GPUDeviceKindVirtual, util.GPUDeviceKindPhysical, ""}
+
+	card, _ := place(nil, all...)
+	assert.Equal(t, card, "GPU-0")
+	card, _ = place(map[string]string{util.GPUDeviceKind: util.GPUDeviceKindPhysical}, all...)
+	assert.Equal(t, card, "GPU-1")
+	card, _ = place(map[string]string{util.GPUDeviceKind: util.GPUDeviceKindVirtual}, all...)
+	assert.Equal(t, card, "GPU-0")
+
+	// A node with vGPUs only is excluded for physical-only pods, cards of unknown kind never match.
+	_, reason := place(map[string]string{util.GPUDeviceKind: util.GPUDeviceKindPhysical}, util.GPUDeviceKindVirtual)
+	assert.Equal(t, reason, "node not fit pod, card is virtual, physical wanted")
+	_, reason = place(map[string]string{util.GPUDeviceKind: util.GPUDeviceKindVirtual}, "")
+	assert.Equal(t, reason, "node not fit pod, card kind is unknown, virtual wanted")
+}
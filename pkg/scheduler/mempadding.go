@@ -0,0 +1,142 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// EventReasonGPUMemoryPadded indicates that the memory requests of a pod were padded.
+const EventReasonGPUMemoryPadded = "GPUMemoryPadded"
+
+// memoryPadding is a parsed --gpu-memory-padding, at most one field is set.
+type memoryPadding struct {
+	mib     int64
+	percent int64
+}
+
+// parseMemoryPadding parses a quantity like "256Mi", a percentage like "10%", or "0".
+func parseMemoryPadding(value string) (memoryPadding, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "0" {
+		return memoryPadding{}, nil
+	}
+	if v, ok := strings.CutSuffix(value, "%"); ok {
+		percent, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || percent < 0 || percent > 100 {
+			return memoryPadding{}, fmt.Errorf("gpu memory padding must be a percentage between 0%% and 100%%, got %q", value)
+		}
+		return memoryPadding{percent: percent}, nil
+	}
+	mib, err := parseShorthandMemory(value)
+	if err != nil {
+		return memoryPadding{}, fmt.Errorf("gpu memory padding must be a quantity like 256Mi, a percentage like 10%% or 0: %v", err)
+	}
+	return memoryPadding{mib: mib}, nil
+}
+
+// pad returns mib with the padding added, rounded up to a whole MiB.
+func (p memoryPadding) pad(mib int64) int64 {
+	if p.percent > 0 {
+		return mib + (mib*p.percent+99)/100
+	}
+	return mib + p.mib
+}
+
+// ValidateGPUMemoryPadding rejects invalid values of --gpu-memory-padding.
+func ValidateGPUMemoryPadding(value string) error {
+	_, err := parseMemoryPadding(value)
+	return err
+}
+
+// padGPUMemory adds the padding of --gpu-memory-padding, or of the hami.io/gpu-memory-padding
+// annotation of pod, to the NVIDIA memory request of every container, and records what it
+// padded in the hami.io/gpu-memory-padded annotation. Requests for a percentage of the memory
+// of a card and containers without a memory request are left alone.
+func padGPUMemory(pod *corev1.Pod) error {
+	value := config.GPUMemoryPadding
+	if v, ok := pod.Annotations[util.GPUMemoryPadding]; ok {
+		value = v
+	}
+	padding, err := parseMemoryPadding(value)
+	if err != nil {
+		return fmt.Errorf("annotation %s: %v", util.GPUMemoryPadding, err)
+	}
+	if padding == (memoryPadding{}) {
+		return nil
+	}
+	dev, ok := device.GetDevices()[nvidia.NvidiaGPUDevice].(*nvidia.NvidiaGPUDevices)
+	if !ok {
+		return nil
+	}
+	_, memName, _ := dev.ResourceNames()
+	name := corev1.ResourceName(memName)
+	var padded []string
+	for idx := range pod.Spec.Containers {
+		c := &pod.Spec.Containers[idx]
+		if c.SecurityContext != nil && c.SecurityContext.Privileged != nil && *c.SecurityContext.Privileged {
+			continue
+		}
+		q, ok := c.Resources.Limits[name]
+		if !ok {
+			continue
+		}
+		requested := q.Value()
+		mib := padding.pad(requested)
+		if mib > math.MaxInt32 {
+			return fmt.Errorf("container %s: resource %s is too large with the gpu memory padding, got %d", c.Name, memName, mib)
+		}
+		c.Resources.Limits[name] = *resource.NewQuantity(mib, resource.DecimalSI)
+		if _, ok := c.Resources.Requests[name]; ok {
+			c.Resources.Requests[name] = *resource.NewQuantity(mib, resource.DecimalSI)
+		}
+		padded = append(padded, fmt.Sprintf("%s:%d->%d", c.Name, requested, mib))
+	}
+	if len(padded) > 0 {
+		if pod.Annotations == nil {
+			pod.Annotations = make(map[string]string)
+		}
+		pod.Annotations[util.GPUMemoryPadded] = strings.Join(padded, ",")
+	}
+	return nil
+}
+
+// recordGPUMemoryPaddedEvent records on pod the memory requests the webhook padded.
+func (s *Scheduler) recordGPUMemoryPaddedEvent(pod *corev1.Pod) {
+	v, ok := pod.Annotations[util.GPUMemoryPadded]
+	if !ok || s.eventRecorder == nil {
+		return
+	}
+	var msgs []string
+	for _, entry := range strings.Split(v, ",") {
+		ctr, change, _ := strings.Cut(entry, ":")
+		requested, padded, _ := strings.Cut(change, "->")
+		msgs = append(msgs, fmt.Sprintf("container %s requested %s MiB, reserved %s MiB", ctr, requested, padded))
+	}
+	s.eventRecorder.Eventf(pod, corev1.EventTypeNormal, EventReasonGPUMemoryPadded, "GPU memory padded for the CUDA context: %s", strings.Join(msgs, "; "))
+}
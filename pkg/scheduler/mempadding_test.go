@@ -0,0 +1,107 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func Test_parseMemoryPadding(t *testing.T) {
+	tests := []struct {
+		value string
+		want  memoryPadding
+		err   string
+	}{
+		{value: "0"},
+		{value: ""},
+		{value: "256Mi", want: memoryPadding{mib: 256}},
+		{value: "1Gi", want: memoryPadding{mib: 1024}},
+		{value: "10%", want: memoryPadding{percent: 10}},
+		{value: "256", err: "needs a unit"},
+		{value: "101%", err: "between 0% and 100%"},
+		{value: "-5%", err: "between 0% and 100%"},
+		{value: "lots", err: "quantity like 256Mi"},
+	}
+	for _, test := range tests {
+		got, err := parseMemoryPadding(test.value)
+		if test.err != "" {
+			assert.ErrorContains(t, err, test.err, test.value)
+			continue
+		}
+		assert.NilError(t, err, test.value)
+		assert.Equal(t, got, test.want, test.value)
+	}
+	assert.Equal(t, memoryPadding{mib: 256}.pad(1000), int64(1256))
+	assert.Equal(t, memoryPadding{percent: 10}.pad(1001), int64(1102), "rounded up")
+}
+
+func Test_padGPUMemory(t *testing.T) {
+	prev := config.GPUMemoryPadding
+	defer func() { config.GPUMemoryPadding = prev }()
+	mem := func(mib int64) corev1.ResourceList {
+		return corev1.ResourceList{"hami.io/gpumem": *resource.NewQuantity(mib, resource.DecimalSI)}
+	}
+	newPod := func(annos map[string]string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "p1", Annotations: annos},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{
+				{Name: "train", Resources: corev1.ResourceRequirements{Limits: mem(1000), Requests: mem(1000)}},
+				{Name: "share", Resources: corev1.ResourceRequirements{Limits: corev1.ResourceList{"hami.io/gpumem-percentage": *resource.NewQuantity(50, resource.DecimalSI)}}},
+				{Name: "sidecar"},
+			}},
+		}
+	}
+	limit := func(pod *corev1.Pod, idx int) int64 {
+		q := pod.Spec.Containers[idx].Resources.Limits["hami.io/gpumem"]
+		return q.Value()
+	}
+
+	config.GPUMemoryPadding = "0"
+	pod := newPod(nil)
+	assert.NilError(t, padGPUMemory(pod))
+	assert.Equal(t, limit(pod, 0), int64(1000))
+	_, ok := pod.Annotations[util.GPUMemoryPadded]
+	assert.Assert(t, !ok)
+
+	config.GPUMemoryPadding = "256Mi"
+	pod = newPod(nil)
+	assert.NilError(t, padGPUMemory(pod))
+	assert.Equal(t, limit(pod, 0), int64(1256))
+	q := pod.Spec.Containers[0].Resources.Requests["hami.io/gpumem"]
+	assert.Equal(t, q.Value(), int64(1256))
+	assert.Equal(t, len(pod.Spec.Containers[1].Resources.Limits), 1, "percentage requests aren't padded")
+	assert.Equal(t, len(pod.Spec.Containers[2].Resources.Limits), 0)
+	assert.Equal(t, pod.Annotations[util.GPUMemoryPadded], "train:1000->1256")
+
+	// The annotation of the pod overrides the flag, and may disable the padding.
+	pod = newPod(map[string]string{util.GPUMemoryPadding: "10%"})
+	assert.NilError(t, padGPUMemory(pod))
+	assert.Equal(t, limit(pod, 0), int64(1100))
+	pod = newPod(map[string]string{util.GPUMemoryPadding: "0"})
+	assert.NilError(t, padGPUMemory(pod))
+	assert.Equal(t, limit(pod, 0), int64(1000))
+	pod = newPod(map[string]string{util.GPUMemoryPadding: "some"})
+	assert.ErrorContains(t, padGPUMemory(pod), util.GPUMemoryPadding)
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	// ExtenderInflightRequests is the number of extender requests being served, by verb.
+	ExtenderInflightRequests = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "hami_extender_inflight_requests",
+		Help: "Number of scheduler extender requests currently being served",
+	}, []string{"verb"})
+	// ExtenderQueuedRequests is the number of extender requests waiting for a free slot, by verb.
+	ExtenderQueuedRequests = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "hami_extender_queued_requests",
+		Help: "Number of scheduler extender requests waiting for a free slot",
+	}, []string{"verb"})
+	// ExtenderRejectedRequests counts extender requests rejected because of overload, by verb and reason.
+	ExtenderRejectedRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hami_extender_rejected_requests_total",
+		Help: "Number of scheduler extender requests rejected because the extender is overloaded",
+	}, []string{"verb", "reason"})
+	// AllocationDriftIncidents counts cards found with more recorded allocations than they advertise, by node.
+	AllocationDriftIncidents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hami_allocation_drift_incidents_total",
+		Help: "Number of times a device was found with recorded allocations exceeding its advertised capacity",
+	}, []string{"node"})
+	// BindResults counts bind requests by result: success, success_after_retry or failed.
+	BindResults = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hami_bind_results_total",
+		Help: "Number of bind requests by result, telling binds which only succeeded after a retry from permanently failed ones",
+	}, []string{"result"})
+	// BindRetries counts bind attempts repeated after a transient failure.
+	BindRetries = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "hami_bind_retries_total",
+		Help: "Number of bind attempts repeated after a transient failure",
+	})
+	// BindWritesDeferred counts bind and filter writes tried again later because the API server was unreachable.
+	BindWritesDeferred = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "hami_bind_writes_deferred_total",
+		Help: "Number of bind and filter writes tried again later because the API server was unreachable",
+	})
+	// BindWritesFailed counts bind and filter writes given up because the API server stayed unreachable for the retry budget.
+	BindWritesFailed = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "hami_bind_writes_failed_total",
+		Help: "Number of bind and filter writes given up because the API server stayed unreachable for the whole retry budget",
+	})
+	// NodeLockWritesSaved counts node annotation writes saved by keeping the node locks of a failed bind for its retry,
+	// or handing them over to the next pod on the node.
+	NodeLockWritesSaved = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "hami_node_lock_writes_saved_total",
+		Help: "Number of node annotation writes saved by keeping the node locks of a failed bind for its retry or the next pod",
+	})
+)
+
+// Register registers the scheduler metrics with reg.
+func Register(reg prometheus.Registerer) {
+	reg.MustRegister(
+		ExtenderInflightRequests,
+		ExtenderQueuedRequests,
+		ExtenderRejectedRequests,
+		AllocationDriftIncidents,
+		BindResults,
+		BindRetries,
+		BindWritesDeferred,
+		BindWritesFailed,
+		NodeLockWritesSaved,
+	)
+}
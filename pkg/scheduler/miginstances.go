@@ -0,0 +1,209 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// migInstance is a free MIG instance of a card, at position pos of the card partitioned with
+// template.
+type migInstance struct {
+	card     *util.DeviceUsage
+	template int
+	pos      int
+}
+
+// migProfile is the free instances of one MIG profile on a node.
+type migProfile struct {
+	name      string
+	memory    int32
+	instances []migInstance
+}
+
+// migSameProfile reports whether the pod with annos asks for MIG instances of a single
+// profile, several of which may come from the same card.
+func migSameProfile(annos map[string]string) bool {
+	return annos[nvidia.MigSameProfile] == "true"
+}
+
+// usableMigCards returns the cards of node in mig mode with a free slot the pod with annos may
+// use for k, in the order the cards are preferred. The reason a card is turned down for is
+// recorded on node.
+func usableMigCards(node *NodeUsage, k util.ContainerDeviceRequest, annos map[string]string, pod *corev1.Pod) []*util.DeviceUsage {
+	typeOrder := gpuTypeOrder(annos)
+	accepted := acceptedTypes(typeOrder, annos, pod, time.Now())
+	partitions := nodeCardPartitions(node.Node, pod)
+	cards := make([]*util.DeviceUsage, 0)
+	for i := len(node.Devices.DeviceLists) - 1; i >= 0; i-- {
+		d := node.Devices.DeviceLists[i].Device
+		if d.Mode != nvidia.MigMode || node.unhealthy[d.ID] || d.Quarantined || d.Draining || d.HeldExternally || d.Count <= d.Used {
+			continue
+		}
+		if found, _ := checkType(annos, *d, k); !found || !checkUUID(annos, *d, k) || !checkConfidentialCompute(annos, *d) {
+			continue
+		}
+		if reason := checkMemoryType(annos, d); reason != "" {
+			node.memoryTypeRejection = reason
+			continue
+		}
+		if reason := checkDeviceKind(annos, d); reason != "" {
+			node.deviceKindRejection = reason
+			continue
+		}
+		if reason := checkTypeOrder(typeOrder, accepted, annos, *d); reason != "" {
+			node.typeOrderRejection = reason
+			continue
+		}
+		if !partitions.allows(d) {
+			node.partitionRejection = partitions.rejection()
+			continue
+		}
+		cards = append(cards, d)
+	}
+	return cards
+}
+
+// freeMigInstances returns the free instances of every MIG profile with at least the memory
+// request k asks for on the cards of node it may use, in the order the cards are preferred.
+// A card without instances in use counts with the template giving the most instances of the
+// profile, as the device plugin re-partitions it on allocation.
+func freeMigInstances(node *NodeUsage, k util.ContainerDeviceRequest, annos map[string]string, pod *corev1.Pod) map[string]*migProfile {
+	profiles := make(map[string]*migProfile)
+	add := func(name string, memory int32, inst migInstance) {
+		p, ok := profiles[name]
+		if !ok {
+			p = &migProfile{name: name, memory: memory}
+			profiles[name] = p
+		}
+		p.instances = append(p.instances, inst)
+	}
+	for _, d := range usableMigCards(node, k, annos, pod) {
+		memreq := k.Memreq
+		if k.MemPercentagereq != 101 && k.Memreq == 0 {
+			memreq = d.Totalmem * int64(k.MemPercentagereq) / 100
+		}
+		fits := func(memory int32) bool {
+			return util.MemoryToBytes(nvidia.NvidiaGPUDevice, int64(memory)) >= memreq
+		}
+		// Every instance takes one of the Count slots of the card.
+		room := make(map[string]int)
+		addFree := func(u util.MigTemplateUsage, tidx, pos int) {
+			if !u.InUse && fits(u.Memory) && room[u.Name] < int(d.Count-d.Used) {
+				room[u.Name]++
+				add(u.Name, u.Memory, migInstance{card: d, template: tidx, pos: pos})
+			}
+		}
+		inUse := false
+		for _, u := range d.MigUsage.UsageList {
+			inUse = inUse || u.InUse
+		}
+		if inUse {
+			for pos, u := range d.MigUsage.UsageList {
+				addFree(u, int(d.MigUsage.Index), pos)
+			}
+			continue
+		}
+		// Per profile, the template of the card giving the most instances of it, the one the
+		// card is partitioned with on a tie.
+		best := make(map[string]int)
+		count := func(tidx int, name string) int {
+			n := 0
+			for _, t := range d.MigTemplate[tidx] {
+				if t.Name == name {
+					n += int(t.Count)
+				}
+			}
+			return n
+		}
+		for tidx, geometry := range d.MigTemplate {
+			for _, t := range geometry {
+				if !fits(t.Memory) {
+					continue
+				}
+				cur, ok := best[t.Name]
+				switch {
+				case !ok, count(tidx, t.Name) > count(cur, t.Name):
+					best[t.Name] = tidx
+				case count(tidx, t.Name) == count(cur, t.Name) && d.MigGeometry != nil && *d.MigGeometry == tidx:
+					best[t.Name] = tidx
+				}
+			}
+		}
+		for name, tidx := range best {
+			var usage util.MigInUse
+			util.PlatternMIG(&usage, d.MigTemplate, tidx)
+			for pos, u := range usage.UsageList {
+				if u.Name == name {
+					addFree(u, tidx, pos)
+				}
+			}
+		}
+	}
+	return profiles
+}
+
+// fitMigInstances reserves k.Nums free instances of a single MIG profile on the cards of
+// node, of the smallest profile with enough free instances. If there is none, the shortfall
+// is recorded as the reason the node doesn't fit.
+func fitMigInstances(node *NodeUsage, k util.ContainerDeviceRequest, annos map[string]string, pod *corev1.Pod) (bool, map[string]util.ContainerDevices) {
+	profiles := make([]*migProfile, 0)
+	for _, p := range freeMigInstances(node, k, annos, pod) {
+		profiles = append(profiles, p)
+	}
+	sort.Slice(profiles, func(i, j int) bool {
+		if profiles[i].memory != profiles[j].memory {
+			return profiles[i].memory < profiles[j].memory
+		}
+		return profiles[i].name < profiles[j].name
+	})
+	var most *migProfile
+	for _, p := range profiles {
+		if len(p.instances) >= int(k.Nums) {
+			tmpDevs := make(map[string]util.ContainerDevices)
+			for _, inst := range p.instances[:k.Nums] {
+				tmpDevs[k.Type] = append(tmpDevs[k.Type], util.ContainerDevice{
+					Idx:       int(inst.card.Index),
+					UUID:      fmt.Sprintf("%s[%d-%d]", inst.card.ID, inst.template, inst.pos),
+					Type:      k.Type,
+					Usedmem:   util.MemoryToBytes(nvidia.NvidiaGPUDevice, int64(p.memory)),
+					Usedcores: k.Coresreq,
+				})
+			}
+			klog.InfoS("MIG instances allocated", "pod", klog.KObj(pod), "profile", p.name, "allocate device", tmpDevs)
+			return true, tmpDevs
+		}
+		if most == nil || len(p.instances) > len(most.instances) {
+			most = p
+		}
+	}
+	if most == nil {
+		node.migShortfall = fmt.Sprintf("no free MIG instance large enough, %d requested", k.Nums)
+	} else {
+		node.migShortfall = fmt.Sprintf("%d free MIG instances of profile %s, %d requested", len(most.instances), most.name, k.Nums)
+	}
+	klog.InfoS("not enough free MIG instances", "pod", klog.KObj(pod), "request", k, "reason", node.migShortfall)
+	return false, map[string]util.ContainerDevices{}
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/policy"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func Test_calcScoreMigSameProfile(t *testing.T) {
+	prev := device.ActiveConfig()
+	initTFLOPSDevices(t)
+	defer func() { assert.NilError(t, device.InitDevicesWithConfig(prev)) }()
+
+	templates := []util.Geometry{
+		{{Name: "1g.10gb", Memory: 10240, Count: 7}},
+		{{Name: "3g.40gb", Memory: 40960, Count: 2}},
+	}
+	newNodes := func() map[string]*NodeUsage {
+		// GPU-0 is partitioned into 1g.10gb instances, the first of which is in use.
+		used := &util.DeviceUsage{
+			ID: "GPU-0", Type: "NVIDIA-A100-SXM4-80GB", Mode: nvidia.MigMode, Count: 10, Used: 1, Totalmem: 81920 * util.MiB,
+			Usedmem: 10240 * util.MiB, Totalcore: 100, Health: true, MigTemplate: templates,
+		}
+		util.PlatternMIG(&used.MigUsage, templates, 0)
+		used.MigUsage.UsageList[0].InUse = true
+		idle := &util.DeviceUsage{
+			ID: "GPU-1", Index: 1, Type: "NVIDIA-A100-SXM4-80GB", Mode: nvidia.MigMode, Count: 10, Totalmem: 81920 * util.MiB,
+			Totalcore: 100, Health: true, MigTemplate: templates,
+		}
+		devices := policy.DeviceUsageList{Policy: util.GPUSchedulerPolicySpread.String(), DeviceLists: []*policy.DeviceListsScore{{Device: used}, {Device: idle}}}
+		return map[string]*NodeUsage{"node1": {Node: &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}, Devices: devices}}
+	}
+	annos := map[string]string{nvidia.MigSameProfile: "true"}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "slices", Namespace: "default"}}
+	request := func(n int32, mem int64) util.PodDeviceRequests {
+		return util.PodDeviceRequests{{nvidia.NvidiaGPUDevice: util.ContainerDeviceRequest{Nums: n, Type: nvidia.NvidiaGPUDevice, Memreq: mem * util.MiB, MemPercentagereq: 101}}}
+	}
+
+	// 6 instances are free on GPU-0 and 7 on GPU-1 once it is partitioned.
+	nodes := newNodes()
+	res, err := NewScheduler().calcScore(&nodes, request(13, 8000), annos, pod, map[string]string{})
+	assert.NilError(t, err)
+	assert.Equal(t, len(res.NodeList), 1)
+	ctr := res.NodeList[0].Devices[nvidia.NvidiaGPUDevice][0]
+	assert.Equal(t, len(ctr), 13)
+	seen := map[string]bool{}
+	for _, d := range ctr {
+		assert.Assert(t, !seen[d.UUID], d.UUID)
+		seen[d.UUID] = true
+		assert.Equal(t, d.Usedmem, 10240*util.MiB)
+	}
+	assert.Assert(t, seen["GPU-0[0-1]"] && seen["GPU-1[0-6]"])
+	assert.Equal(t, nodes["node1"].Devices.DeviceLists[0].Device.Used+nodes["node1"].Devices.DeviceLists[1].Device.Used, int32(14))
+
+	// Only the idle card may be partitioned into the larger profile.
+	nodes = newNodes()
+	res, err = NewScheduler().calcScore(&nodes, request(2, 20000), annos, pod, map[string]string{})
+	assert.NilError(t, err)
+	assert.Equal(t, len(res.NodeList), 1)
+	assert.DeepEqual(t, res.NodeList[0].Devices[nvidia.NvidiaGPUDevice][0], util.ContainerDevices{
+		{Idx: 1, UUID: "GPU-1[1-0]", Type: nvidia.NvidiaGPUDevice, Usedmem: 40960 * util.MiB},
+		{Idx: 1, UUID: "GPU-1[1-1]", Type: nvidia.NvidiaGPUDevice, Usedmem: 40960 * util.MiB},
+	})
+
+	nodes = newNodes()
+	failedNodes := map[string]string{}
+	res, err = NewScheduler().calcScore(&nodes, request(3, 20000), annos, pod, failedNodes)
+	assert.NilError(t, err)
+	assert.Equal(t, len(res.NodeList), 0)
+	assert.Equal(t, failedNodes["node1"], "node not fit pod, 2 free MIG instances of profile 3g.40gb, 3 requested")
+}
@@ -0,0 +1,261 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// migInstanceCores is the compute of a MIG instance pods sharing it reserve parts of.
+const migInstanceCores = 100
+
+// migSharedCompute reports whether the pod with annos shares the compute of MIG instances with
+// other such pods, each limited to its core request by HAMi-core.
+func migSharedCompute(annos map[string]string) bool {
+	return annos[nvidia.MigSharedCompute] == "true"
+}
+
+// validateMigSharedCompute checks the nvidia.com/mig-shared-compute annotation of a pod.
+func validateMigSharedCompute(annos map[string]string) error {
+	v, ok := annos[nvidia.MigSharedCompute]
+	if !ok {
+		return nil
+	}
+	if v != "true" && v != "false" {
+		return fmt.Errorf("annotation %s must be \"true\" or \"false\", got %q", nvidia.MigSharedCompute, v)
+	}
+	if v != "true" {
+		return nil
+	}
+	if migSameProfile(annos) {
+		return fmt.Errorf("annotation %s can't be combined with %s", nvidia.MigSharedCompute, nvidia.MigSameProfile)
+	}
+	if mode, ok := annos[nvidia.AllocateMode]; ok && mode != nvidia.MigMode {
+		return fmt.Errorf("annotation %s needs %s %q, got %q", nvidia.MigSharedCompute, nvidia.AllocateMode, nvidia.MigMode, mode)
+	}
+	return nil
+}
+
+// sharedMigMemory returns the memory k reserves of a MIG instance of memory bytes: its memory
+// request, or its memory percentage of the instance.
+func sharedMigMemory(k util.ContainerDeviceRequest, memory int64) int64 {
+	if k.Memreq > 0 {
+		return k.Memreq
+	}
+	if k.MemPercentagereq != 101 {
+		return memory * int64(k.MemPercentagereq) / 100
+	}
+	return memory
+}
+
+// sharedMigCandidate is a MIG instance a container may reserve memreq bytes of.
+type sharedMigCandidate struct {
+	inst   migInstance
+	memory int64
+	memreq int64
+	// shared is set for an instance other pods share already.
+	shared    bool
+	usedCores int32
+}
+
+// newSharedMigCandidate returns the candidate u at pos of d partitioned with template tidx makes
+// for k, ok is false if u is held exclusively or lacks the room.
+func newSharedMigCandidate(d *util.DeviceUsage, u util.MigTemplateUsage, tidx, pos int, k util.ContainerDeviceRequest) (c sharedMigCandidate, ok bool) {
+	if u.InUse && !u.Shared {
+		return sharedMigCandidate{}, false
+	}
+	memory := util.MemoryToBytes(nvidia.NvidiaGPUDevice, int64(u.Memory))
+	memreq := sharedMigMemory(k, memory)
+	if u.UsedMem+memreq > memory || u.UsedCores+k.Coresreq > migInstanceCores {
+		return sharedMigCandidate{}, false
+	}
+	// Like a whole card, an instance whose compute is fully reserved takes no pod without a
+	// core request.
+	if k.Coresreq == 0 && u.UsedCores == migInstanceCores {
+		return sharedMigCandidate{}, false
+	}
+	return sharedMigCandidate{
+		inst:      migInstance{card: d, template: tidx, pos: pos},
+		memory:    memory,
+		memreq:    memreq,
+		shared:    u.InUse,
+		usedCores: u.UsedCores,
+	}, true
+}
+
+// better reports whether c is preferred over o on a card: an instance shared already over a
+// free one, to keep free instances whole, the one with the least compute left among shared
+// ones and the smallest among free ones.
+func (c sharedMigCandidate) better(o sharedMigCandidate) bool {
+	if c.shared != o.shared {
+		return c.shared
+	}
+	if c.shared && c.usedCores != o.usedCores {
+		return c.usedCores > o.usedCores
+	}
+	return c.memory < o.memory
+}
+
+// cardSharedMigCandidate returns the instance of d preferred for k. A card without instances in
+// use counts with the template it is partitioned with if one of its instances fits, otherwise
+// with the first template of the card with one.
+func cardSharedMigCandidate(d *util.DeviceUsage, k util.ContainerDeviceRequest) (best sharedMigCandidate, found bool) {
+	consider := func(usage util.MigInUse) {
+		for pos, u := range usage.UsageList {
+			c, ok := newSharedMigCandidate(d, u, int(usage.Index), pos, k)
+			if ok && (!found || c.better(best)) {
+				best, found = c, true
+			}
+		}
+	}
+	for _, u := range d.MigUsage.UsageList {
+		if u.InUse {
+			consider(d.MigUsage)
+			return best, found
+		}
+	}
+	templates := make([]int, 0, len(d.MigTemplate))
+	if g := d.MigGeometry; g != nil && *g >= 0 && *g < len(d.MigTemplate) {
+		templates = append(templates, *g)
+	}
+	for tidx := range d.MigTemplate {
+		templates = append(templates, tidx)
+	}
+	for _, tidx := range templates {
+		var usage util.MigInUse
+		util.PlatternMIG(&usage, d.MigTemplate, tidx)
+		consider(usage)
+		if found {
+			return best, found
+		}
+	}
+	return best, found
+}
+
+// fitSharedMigInstances reserves k.Nums MIG instances on different cards of node for a
+// container sharing their compute, the preferred instance of every card, on the cards with an
+// instance shared already first. If there are not enough, the shortfall is recorded as the
+// reason the node doesn't fit.
+func fitSharedMigInstances(node *NodeUsage, k util.ContainerDeviceRequest, annos map[string]string, pod *corev1.Pod) (bool, map[string]util.ContainerDevices) {
+	if k.Coresreq > migInstanceCores {
+		k.Coresreq = migInstanceCores
+	}
+	candidates := make([]sharedMigCandidate, 0)
+	for _, d := range usableMigCards(node, k, annos, pod) {
+		if c, ok := cardSharedMigCandidate(d, k); ok {
+			candidates = append(candidates, c)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].shared && !candidates[j].shared
+	})
+	if len(candidates) < int(k.Nums) {
+		node.migShortfall = fmt.Sprintf("%d MIG instances with %d cores and the memory requested left to share, %d requested", len(candidates), k.Coresreq, k.Nums)
+		klog.InfoS("not enough MIG instances to share", "pod", klog.KObj(pod), "request", k, "reason", node.migShortfall)
+		return false, map[string]util.ContainerDevices{}
+	}
+	tmpDevs := make(map[string]util.ContainerDevices)
+	for _, c := range candidates[:k.Nums] {
+		tmpDevs[k.Type] = append(tmpDevs[k.Type], util.ContainerDevice{
+			Idx:       int(c.inst.card.Index),
+			UUID:      fmt.Sprintf("%s[%d-%d]", c.inst.card.ID, c.inst.template, c.inst.pos),
+			Type:      k.Type,
+			Usedmem:   c.memreq,
+			Usedcores: k.Coresreq,
+		})
+	}
+	klog.InfoS("shared MIG instances allocated", "pod", klog.KObj(pod), "allocate device", tmpDevs)
+	return true, tmpDevs
+}
+
+// shareMigInstance reserves the memory and cores of ctr of the MIG instance of n its UUID
+// names, partitioning n with the template of the instance if none of its instances is in use.
+// The usage of the card itself is left to the caller.
+func shareMigInstance(n *util.DeviceUsage, ctr util.ContainerDevice) error {
+	tidx, pos, err := util.ExtractMigTemplatesFromUUID(ctr.UUID)
+	if err != nil {
+		return err
+	}
+	inUse := false
+	for _, u := range n.MigUsage.UsageList {
+		inUse = inUse || u.InUse
+	}
+	if !inUse {
+		if tidx < 0 || tidx >= len(n.MigTemplate) {
+			return fmt.Errorf("mig template %d not found for device %s", tidx, n.ID)
+		}
+		n.MigUsage = util.MigInUse{}
+		util.PlatternMIG(&n.MigUsage, n.MigTemplate, tidx)
+	}
+	if int32(tidx) != n.MigUsage.Index || pos < 0 || pos >= len(n.MigUsage.UsageList) {
+		return fmt.Errorf("mig instance %s not found", ctr.UUID)
+	}
+	u := &n.MigUsage.UsageList[pos]
+	if u.InUse && !u.Shared {
+		return fmt.Errorf("mig instance %s is held by a pod not sharing it", ctr.UUID)
+	}
+	u.InUse = true
+	u.Shared = true
+	u.UsedCores += ctr.Usedcores
+	u.UsedMem += ctr.Usedmem
+	return nil
+}
+
+// addSharedMigUsage accounts ctr, placed on a shared MIG instance of n by
+// fitSharedMigInstances. Its cores are of the instance, not of the card.
+func addSharedMigUsage(n *util.DeviceUsage, ctr util.ContainerDevice) error {
+	if err := shareMigInstance(n, ctr); err != nil {
+		return err
+	}
+	n.Used++
+	n.Usedmem += ctr.Usedmem
+	return nil
+}
+
+// addMigSharedUsage accounts the shared MIG instances pd holds on node. It goes before
+// addPodUsage, which counts pd like the devices of any other pod but for its cores, which are
+// of the instances rather than of the cards.
+func addMigSharedUsage(node *NodeUsage, pd util.PodDevices) {
+	for _, podsingleds := range pd {
+		for _, ctrdevs := range podsingleds {
+			for _, udevice := range ctrdevs {
+				if udevice.Type != nvidia.NvidiaGPUDevice || !strings.Contains(udevice.UUID, "[") {
+					continue
+				}
+				deviceID := strings.Split(udevice.UUID, "[")[0]
+				for _, d := range node.Devices.DeviceLists {
+					if d.Device.ID != deviceID {
+						continue
+					}
+					if err := shareMigInstance(d.Device, udevice); err != nil {
+						klog.ErrorS(err, "Failed to account shared MIG instance", "device", deviceID)
+						continue
+					}
+					d.Device.Usedcores -= udevice.Usedcores
+				}
+			}
+		}
+	}
+}
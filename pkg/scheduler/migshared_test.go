@@ -0,0 +1,138 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/policy"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func Test_validateMigSharedCompute(t *testing.T) {
+	tests := []struct {
+		name    string
+		annos   map[string]string
+		wantErr bool
+	}{
+		{name: "unset", annos: map[string]string{}},
+		{name: "shared", annos: map[string]string{nvidia.MigSharedCompute: "true"}},
+		{name: "shared in mig mode", annos: map[string]string{nvidia.MigSharedCompute: "true", nvidia.AllocateMode: nvidia.MigMode}},
+		{name: "off with same profile", annos: map[string]string{nvidia.MigSharedCompute: "false", nvidia.MigSameProfile: "true"}},
+		{name: "invalid", annos: map[string]string{nvidia.MigSharedCompute: "yes"}, wantErr: true},
+		{name: "with same profile", annos: map[string]string{nvidia.MigSharedCompute: "true", nvidia.MigSameProfile: "true"}, wantErr: true},
+		{name: "hami-core mode", annos: map[string]string{nvidia.MigSharedCompute: "true", nvidia.AllocateMode: nvidia.HamiCoreMode}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateMigSharedCompute(tt.annos)
+			assert.Equal(t, err != nil, tt.wantErr, err)
+		})
+	}
+}
+
+func Test_calcScoreMigSharedCompute(t *testing.T) {
+	prev := device.ActiveConfig()
+	initTFLOPSDevices(t)
+	defer func() { assert.NilError(t, device.InitDevicesWithConfig(prev)) }()
+
+	templates := []util.Geometry{
+		{{Name: "1g.10gb", Memory: 10240, Count: 7}},
+		{{Name: "3g.40gb", Memory: 40960, Count: 2}},
+	}
+	newNodes := func() map[string]*NodeUsage {
+		// Instance 0 of GPU-0 is held exclusively, 60 cores and 4000 MiB of instance 1 are
+		// reserved by pods sharing it.
+		card := &util.DeviceUsage{
+			ID: "GPU-0", Type: "NVIDIA-A100-SXM4-80GB", Mode: nvidia.MigMode, Count: 10, Used: 2, Totalmem: 81920 * util.MiB,
+			Usedmem: 14240 * util.MiB, Totalcore: 100, Health: true, MigTemplate: templates,
+		}
+		util.PlatternMIG(&card.MigUsage, templates, 0)
+		card.MigUsage.UsageList[0].InUse = true
+		card.MigUsage.UsageList[1] = util.MigTemplateUsage{Name: "1g.10gb", Memory: 10240, InUse: true, Shared: true, UsedCores: 60, UsedMem: 4000 * util.MiB}
+		devices := policy.DeviceUsageList{Policy: util.GPUSchedulerPolicySpread.String(), DeviceLists: []*policy.DeviceListsScore{{Device: card}}}
+		return map[string]*NodeUsage{"node1": {Node: &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}, Devices: devices}}
+	}
+	annos := map[string]string{nvidia.MigSharedCompute: "true"}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "sharer", Namespace: "default"}}
+	request := func(mem int64, cores int32) util.PodDeviceRequests {
+		return util.PodDeviceRequests{{nvidia.NvidiaGPUDevice: util.ContainerDeviceRequest{Nums: 1, Type: nvidia.NvidiaGPUDevice, Memreq: mem * util.MiB, MemPercentagereq: 101, Coresreq: cores}}}
+	}
+
+	// The shared instance has room left, it is preferred over a free one.
+	nodes := newNodes()
+	res, err := NewScheduler().calcScore(&nodes, request(4000, 30), annos, pod, map[string]string{})
+	assert.NilError(t, err)
+	assert.Equal(t, len(res.NodeList), 1)
+	assert.DeepEqual(t, res.NodeList[0].Devices[nvidia.NvidiaGPUDevice][0], util.ContainerDevices{
+		{UUID: "GPU-0[0-1]", Type: nvidia.NvidiaGPUDevice, Usedmem: 4000 * util.MiB, Usedcores: 30},
+	})
+	card := nodes["node1"].Devices.DeviceLists[0].Device
+	assert.Equal(t, card.MigUsage.UsageList[1].UsedCores, int32(90))
+	assert.Equal(t, card.MigUsage.UsageList[1].UsedMem, 8000*util.MiB)
+	assert.Equal(t, card.Usedcores, int32(0))
+	assert.Equal(t, card.Used, int32(3))
+
+	// Neither the cores nor the memory of the shared instance suffice, a free one is shared next.
+	for _, req := range []util.PodDeviceRequests{request(4000, 50), request(8000, 30)} {
+		nodes = newNodes()
+		res, err = NewScheduler().calcScore(&nodes, req, annos, pod, map[string]string{})
+		assert.NilError(t, err)
+		assert.Equal(t, len(res.NodeList), 1)
+		assert.Equal(t, res.NodeList[0].Devices[nvidia.NvidiaGPUDevice][0][0].UUID, "GPU-0[0-2]")
+		assert.Assert(t, nodes["node1"].Devices.DeviceLists[0].Device.MigUsage.UsageList[2].Shared)
+	}
+
+	// No instance of the card is large enough.
+	nodes = newNodes()
+	failedNodes := map[string]string{}
+	res, err = NewScheduler().calcScore(&nodes, request(12000, 30), annos, pod, failedNodes)
+	assert.NilError(t, err)
+	assert.Equal(t, len(res.NodeList), 0)
+	assert.Equal(t, failedNodes["node1"], "node not fit pod, 0 MIG instances with 30 cores and the memory requested left to share, 1 requested")
+}
+
+func Test_addMigSharedUsage(t *testing.T) {
+	templates := []util.Geometry{{{Name: "3g.40gb", Memory: 40960, Count: 2}}}
+	card := &util.DeviceUsage{ID: "GPU-0", Mode: nvidia.MigMode, Count: 10, Totalmem: 81920 * util.MiB, Totalcore: 100, MigTemplate: templates}
+	node := &NodeUsage{Devices: policy.DeviceUsageList{DeviceLists: []*policy.DeviceListsScore{{Device: card}}}}
+	shared := func(cores int32, mem int64) util.PodDevices {
+		return util.PodDevices{nvidia.NvidiaGPUDevice: util.PodSingleDevice{{{UUID: "GPU-0[0-1]", Type: nvidia.NvidiaGPUDevice, Usedmem: mem * util.MiB, Usedcores: cores}}}}
+	}
+	for _, pd := range []util.PodDevices{shared(40, 10000), shared(60, 20000)} {
+		addMigSharedUsage(node, pd)
+		addPodUsage(node, pd)
+	}
+	assert.DeepEqual(t, card.MigUsage.UsageList, util.MIGS{
+		{Name: "3g.40gb", Memory: 40960},
+		{Name: "3g.40gb", Memory: 40960, InUse: true, Shared: true, UsedCores: 100, UsedMem: 30000 * util.MiB},
+	})
+	assert.Equal(t, card.Used, int32(2))
+	assert.Equal(t, card.Usedmem, 30000*util.MiB)
+	assert.Equal(t, card.Usedcores, int32(0))
+
+	// A pod holding the instance exclusively keeps it from being shared.
+	exclusive := util.PodDevices{nvidia.NvidiaGPUDevice: util.PodSingleDevice{{{UUID: "GPU-0[0-0]", Type: nvidia.NvidiaGPUDevice, Usedmem: 40960 * util.MiB}}}}
+	addPodUsage(node, exclusive)
+	assert.ErrorContains(t, shareMigInstance(card, util.ContainerDevice{UUID: "GPU-0[0-0]", Usedcores: 10}), "held by a pod not sharing it")
+}
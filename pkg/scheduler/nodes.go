@@ -18,10 +18,12 @@ package scheduler
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 	"sync"
 
 	corev1 "k8s.io/api/core/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/klog/v2"
 
 	"github.com/Project-HAMi/HAMi/pkg/device"
@@ -32,16 +34,53 @@ import (
 type NodeUsage struct {
 	Node    *corev1.Node
 	Devices policy.DeviceUsageList
+	// stickyDevices are the cards a sticky pod used last time on this node.
+	stickyDevices []string
+	// idleLimits are the memory limits per card, in bytes, the vGPU monitor of the node lowered
+	// its idle pods to, by pod UID.
+	idleLimits map[k8stypes.UID]int64
+	// switchLoad counts the bandwidth-heavy pods using cards under each PCIe switch of the node.
+	switchLoad map[string]int
+	// cardRuleRejection is the last reason a card rule kept a card of the node from the pod.
+	cardRuleRejection string
+	// encoderRejection is the last reason the encoders of a card kept it from the pod.
+	encoderRejection string
+	// namespaceRejection is the last reason namespace isolation kept a card from the pod.
+	namespaceRejection string
+	// memoryTypeRejection is the last reason the hami.io/gpu-memory-type of the pod kept a card from it.
+	memoryTypeRejection string
+	// deviceKindRejection is the last reason the hami.io/gpu-device-kind of the pod kept a card from it.
+	deviceKindRejection string
+	// typeOrderRejection is the last reason the hami.io/gpu-type-order of the pod kept a card from it.
+	typeOrderRejection string
+	// partitionRejection is why the cards of the node the card partitions leave to the pod don't fit it.
+	partitionRejection string
+	// freeBlockRejection is the last reason the hami.io/gpu-min-free-block of the pod kept a card from it.
+	freeBlockRejection string
+	// migShortfall is why the node lacks the free MIG instances of a single profile a pod wants.
+	migShortfall string
+	// cards and healthyCards count the devices of the node and the ones registered healthy.
+	cards        int
+	healthyCards int
+	// unhealthy are the cards registered unhealthy or cordoned, which take no new pods.
+	unhealthy map[string]bool
+	// roundRobin are the current weights of the cards in the round of the roundrobin GPU policy,
+	// roundRobinWeights the free memory of the cards the pod was placed with.
+	roundRobin        map[string]float64
+	roundRobinWeights map[string]float64
 }
 
 type nodeManager struct {
 	nodes map[string]*util.NodeInfo
-	mutex sync.RWMutex
+	// duplicates are the device UUIDs reported by more than one node, with the nodes last warned about.
+	duplicates map[string]string
+	mutex      sync.RWMutex
 }
 
 func newNodeManager() *nodeManager {
 	return &nodeManager{
-		nodes: make(map[string]*util.NodeInfo),
+		nodes:      make(map[string]*util.NodeInfo),
+		duplicates: make(map[string]string),
 	}
 }
 
@@ -73,6 +112,51 @@ func (m *nodeManager) addNode(nodeID string, nodeInfo *util.NodeInfo) {
 	} else {
 		m.nodes[nodeID] = nodeInfo
 	}
+	m.warnDuplicateUUIDs()
+}
+
+// duplicateUUIDs returns the device UUIDs reported by more than one of nodes, with those nodes.
+func duplicateUUIDs(nodes map[string]*util.NodeInfo) map[string][]string {
+	owners := make(map[string][]string)
+	for nodeID, node := range nodes {
+		for _, d := range node.Devices {
+			if !slices.Contains(owners[d.ID], nodeID) {
+				owners[d.ID] = append(owners[d.ID], nodeID)
+			}
+		}
+	}
+	res := make(map[string][]string)
+	for uuid, nodeIDs := range owners {
+		if len(nodeIDs) > 1 {
+			slices.Sort(nodeIDs)
+			res[uuid] = nodeIDs
+		}
+	}
+	return res
+}
+
+// warnDuplicateUUIDs logs the device UUIDs reported by several nodes, e.g. by VMs with the same
+// passed through GPU identity. Devices are always accounted per node, so this doesn't affect
+// scheduling, but inventories keyed by UUID alone would mix the cards up. Every set of nodes
+// sharing a UUID is reported once. Must be called with the mutex held.
+func (m *nodeManager) warnDuplicateUUIDs() {
+	found := duplicateUUIDs(m.nodes)
+	if m.duplicates == nil {
+		m.duplicates = make(map[string]string)
+	}
+	for uuid, nodeIDs := range found {
+		owners := strings.Join(nodeIDs, ",")
+		if m.duplicates[uuid] == owners {
+			continue
+		}
+		m.duplicates[uuid] = owners
+		klog.Warningf("device UUID %s is reported by nodes %s, the devices are accounted per node", uuid, owners)
+	}
+	for uuid := range m.duplicates {
+		if _, ok := found[uuid]; !ok {
+			delete(m.duplicates, uuid)
+		}
+	}
 }
 
 func (m *nodeManager) rmNodeDevices(nodeID string, deviceVendor string) {
@@ -96,6 +180,7 @@ func (m *nodeManager) rmNodeDevices(nodeID string, deviceVendor string) {
 	} else {
 		nodeInfo.Devices = devices
 	}
+	m.warnDuplicateUUIDs()
 	klog.InfoS("Removing device from node", "nodeName", nodeID, "deviceVendor", deviceVendor, "remainingDevices", devices)
 }
 
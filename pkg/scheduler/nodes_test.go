@@ -322,3 +322,30 @@ func Test_rmNodeDevices(t *testing.T) {
 		})
 	}
 }
+
+func Test_duplicateUUIDs(t *testing.T) {
+	s := NewScheduler()
+	for _, nodeID := range []string{"node1", "node2"} {
+		s.addNode(nodeID, &util.NodeInfo{
+			ID:      nodeID,
+			Devices: []util.DeviceInfo{{ID: "GPU-0", Count: 10, Devmem: 8000, Devcore: 100, Type: "NVIDIA", DeviceVendor: "NVIDIA", Health: true}},
+		})
+	}
+	assert.DeepEqual(t, duplicateUUIDs(s.nodes), map[string][]string{"GPU-0": {"node1", "node2"}})
+	assert.Equal(t, s.duplicates["GPU-0"], "node1,node2")
+
+	pod := &corev1.Pod{}
+	pod.Name, pod.Namespace, pod.UID = "p1", "default", "uid-1"
+	s.addPod(pod, "node1", util.PodDevices{"NVIDIA": util.PodSingleDevice{{{UUID: "GPU-0", Type: "NVIDIA", Usedmem: 2000, Usedcores: 30}}}})
+	usage, _, err := s.getNodesUsage(&[]string{"node1", "node2"}, &corev1.Pod{})
+	assert.NilError(t, err)
+	used := (*usage)["node1"].Devices.DeviceLists[0].Device
+	assert.Equal(t, used.Used, int32(1))
+	assert.Equal(t, used.Usedmem, int64(2000))
+	free := (*usage)["node2"].Devices.DeviceLists[0].Device
+	assert.Equal(t, free.Used, int32(0), "the allocation on node1 must not consume the card of node2")
+	assert.Equal(t, free.Usedmem, int64(0))
+
+	s.rmNodeDevices("node2", "NVIDIA")
+	assert.Equal(t, len(s.duplicates), 0)
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// validateNoiseTolerance checks the hami.io/noise-tolerance annotation of a pod.
+func validateNoiseTolerance(annos map[string]string) error {
+	v, ok := annos[util.NoiseTolerance]
+	if !ok || v == util.NoiseToleranceLow || v == util.NoiseToleranceHigh {
+		return nil
+	}
+	return fmt.Errorf("annotation %s must be %q or %q, got %q", util.NoiseTolerance, util.NoiseToleranceLow, util.NoiseToleranceHigh, v)
+}
+
+// prefersQuietCards reports whether the pod with annos wants cards with few and idle
+// co-tenants. Exclusive pods get whole cards anyway.
+func prefersQuietCards(annos map[string]string) bool {
+	return config.NoiseToleranceWeight > 0 && annos[util.NoiseTolerance] == util.NoiseToleranceLow && annos[util.Exclusive] != "true"
+}
+
+// preferQuietCards raises the score of cards with fewer pods, scaled between the card with the
+// fewest and the one with the most on the node, and of cards with a lower live utilization
+// like preferLowUtilization.
+func preferQuietCards(node *NodeUsage, weight float32, maxAge time.Duration, now time.Time) {
+	least, most := int32(-1), int32(0)
+	for _, d := range node.Devices.DeviceLists {
+		if least < 0 || d.Device.Used < least {
+			least = d.Device.Used
+		}
+		most = max(most, d.Device.Used)
+	}
+	if least < most {
+		for _, d := range node.Devices.DeviceLists {
+			d.AddPreference(node.Devices.Policy, weight*float32(most-d.Device.Used)/float32(most-least))
+		}
+	}
+	preferLowUtilization(node, weight, maxAge, now)
+}
+
+// quietCardsScore returns 1 when none of the cards picked on the node holds another pod,
+// falling towards 0 with the co-tenants of the most shared one.
+func quietCardsScore(node *NodeUsage, pd util.PodDevices) float32 {
+	// The usage of the cards counts the devices picked already.
+	own := make(map[string]int32)
+	for _, podSingle := range pd {
+		for _, ctrdevs := range podSingle {
+			for _, udevice := range ctrdevs {
+				own[strings.Split(udevice.UUID, "[")[0]]++
+			}
+		}
+	}
+	busiest := int32(0)
+	for _, d := range node.Devices.DeviceLists {
+		if n, ok := own[d.Device.ID]; ok {
+			busiest = max(busiest, d.Device.Used-n)
+		}
+	}
+	return 1 / float32(1+busiest)
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/policy"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func Test_validateNoiseTolerance(t *testing.T) {
+	assert.NilError(t, validateNoiseTolerance(map[string]string{}))
+	assert.NilError(t, validateNoiseTolerance(map[string]string{util.NoiseTolerance: "low"}))
+	assert.NilError(t, validateNoiseTolerance(map[string]string{util.NoiseTolerance: "high"}))
+	assert.ErrorContains(t, validateNoiseTolerance(map[string]string{util.NoiseTolerance: "medium"}), `got "medium"`)
+}
+
+func Test_quietCardsScore(t *testing.T) {
+	node := &NodeUsage{}
+	for i, used := range []int32{1, 3} {
+		node.Devices.DeviceLists = append(node.Devices.DeviceLists, &policy.DeviceListsScore{Device: &util.DeviceUsage{ID: "GPU-" + string(rune('0'+i)), Used: used}})
+	}
+	own := func(uuids ...string) util.PodDevices {
+		var ctrs util.ContainerDevices
+		for _, uuid := range uuids {
+			ctrs = append(ctrs, util.ContainerDevice{UUID: uuid, Type: nvidia.NvidiaGPUDevice})
+		}
+		return util.PodDevices{nvidia.NvidiaGPUDevice: {ctrs}}
+	}
+	assert.Equal(t, quietCardsScore(node, own("GPU-0")), float32(1))
+	assert.Equal(t, quietCardsScore(node, own("GPU-1")), float32(1)/3)
+	assert.Equal(t, quietCardsScore(node, own("GPU-0", "GPU-1")), float32(1)/3)
+}
+
+func Test_noiseTolerancePlacement(t *testing.T) {
+	prev := device.ActiveConfig()
+	initTFLOPSDevices(t)
+	defer func() { assert.NilError(t, device.InitDevicesWithConfig(prev)) }()
+	prevWeight := config.NoiseToleranceWeight
+	defer func() { config.NoiseToleranceWeight = prevWeight }()
+	config.NoiseToleranceWeight = 10
+
+	// The binpack policy picks GPU-0, which holds two pods already, unless its co-tenants count.
+	s := NewScheduler()
+	info := &util.NodeInfo{ID: "node1", Node: &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}}
+	for i := range 2 {
+		info.Devices = append(info.Devices, util.DeviceInfo{
+			ID: "GPU-" + string(rune('0'+i)), Index: uint(i), Count: 10, Devmem: 16000 - int32(i)*1000, Devcore: 100,
+			Type: "NVIDIA-Tesla T4", Health: true, DeviceVendor: nvidia.NvidiaGPUDevice,
+		})
+	}
+	s.addNode("node1", info)
+	for _, name := range []string{"a", "b"} {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, UID: k8stypes.UID("uid-" + name)}}
+		s.addPod(pod, "node1", util.PodDevices{nvidia.NvidiaGPUDevice: {{{UUID: "GPU-0", Type: nvidia.NvidiaGPUDevice, Usedmem: 1000 * util.MiB, Usedcores: 10}}}})
+	}
+	nums := util.PodDeviceRequests{{nvidia.NvidiaGPUDevice: util.ContainerDeviceRequest{Nums: 1, Type: nvidia.NvidiaGPUDevice, Memreq: 1000, Coresreq: 10}}}
+	place := func(annos map[string]string) string {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "infer", Namespace: "default", Annotations: annos}}
+		names := []string{"node1"}
+		nodes, failedNodes, err := s.getNodesUsage(&names, pod)
+		assert.NilError(t, err)
+		for _, node := range *nodes {
+			node.Devices.Policy = util.GPUSchedulerPolicyBinpack.String()
+		}
+		res, err := s.calcScore(nodes, nums, annos, pod, failedNodes)
+		assert.NilError(t, err)
+		assert.Equal(t, len(res.NodeList), 1)
+		return res.NodeList[0].Devices[nvidia.NvidiaGPUDevice][0][0].UUID
+	}
+
+	assert.Equal(t, place(nil), "GPU-0")
+	assert.Equal(t, place(map[string]string{util.NoiseTolerance: util.NoiseToleranceHigh}), "GPU-0")
+	assert.Equal(t, place(map[string]string{util.NoiseTolerance: util.NoiseToleranceLow}), "GPU-1")
+	config.NoiseToleranceWeight = 0
+	assert.Equal(t, place(map[string]string{util.NoiseTolerance: util.NoiseToleranceLow}), "GPU-0")
+}
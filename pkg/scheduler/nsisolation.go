@@ -0,0 +1,82 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// namespaceIsolated reports whether a pod of namespace with annos shares its cards only with
+// pods of namespace, by its hami.io/namespace-isolation annotation or else by
+// --isolated-namespaces.
+func namespaceIsolated(namespace string, annos map[string]string) bool {
+	if v, ok := annos[util.NamespaceIsolation]; ok {
+		isolated, _ := strconv.ParseBool(v)
+		return isolated
+	}
+	return slices.Contains(config.IsolatedNamespaces, namespace)
+}
+
+// addNamespaceUsage records the namespace of a pod, and whether it is isolated, once on every
+// card of node it holds.
+func addNamespaceUsage(node *NodeUsage, pd util.PodDevices, namespace string, isolated bool) {
+	if namespace == "" {
+		return
+	}
+	cards := make(map[string]bool)
+	for _, podSingle := range pd {
+		for _, ctrdevs := range podSingle {
+			for _, udevice := range ctrdevs {
+				cards[strings.Split(udevice.UUID, "[")[0]] = true
+			}
+		}
+	}
+	for _, d := range node.Devices.DeviceLists {
+		if !cards[d.Device.ID] {
+			continue
+		}
+		switch d.Device.Namespace {
+		case "":
+			d.Device.Namespace = namespace
+		case namespace:
+		default:
+			d.Device.MixedNamespaces = true
+		}
+		if isolated && d.Device.IsolatedNamespace == "" {
+			d.Device.IsolatedNamespace = namespace
+		}
+	}
+}
+
+// checkNamespaceIsolation returns why a pod of namespace can't share d, "" if it can. A card
+// holding an isolated pod takes no pod of another namespace, and an isolated pod takes no card
+// holding pods of another namespace. The other namespace isn't named, as the reason is shown to
+// the pod.
+func checkNamespaceIsolation(namespace string, isolated bool, d *util.DeviceUsage) string {
+	switch {
+	case d.IsolatedNamespace != "" && d.IsolatedNamespace != namespace:
+		return "card is isolated to the pods of another namespace"
+	case isolated && (d.MixedNamespaces || d.Namespace != "" && d.Namespace != namespace):
+		return "card is shared with pods of another namespace, namespace isolation can't be granted"
+	}
+	return ""
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/policy"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func Test_namespaceIsolated(t *testing.T) {
+	prev := config.IsolatedNamespaces
+	defer func() { config.IsolatedNamespaces = prev }()
+	config.IsolatedNamespaces = []string{"tenant-a"}
+
+	assert.Assert(t, namespaceIsolated("tenant-a", nil))
+	assert.Assert(t, !namespaceIsolated("tenant-b", nil))
+	assert.Assert(t, namespaceIsolated("tenant-b", map[string]string{util.NamespaceIsolation: "true"}))
+	assert.Assert(t, !namespaceIsolated("tenant-a", map[string]string{util.NamespaceIsolation: "false"}))
+}
+
+func Test_calcScoreNamespaceIsolation(t *testing.T) {
+	prev := device.ActiveConfig()
+	initTFLOPSDevices(t)
+	defer func() { assert.NilError(t, device.InitDevicesWithConfig(prev)) }()
+
+	// A single card holding a pod of holderNS.
+	newNodes := func(holderNS string, holderIsolated bool) map[string]*NodeUsage {
+		devices := policy.DeviceUsageList{Policy: util.GPUSchedulerPolicySpread.String()}
+		devices.DeviceLists = append(devices.DeviceLists, &policy.DeviceListsScore{Device: &util.DeviceUsage{
+			ID: "GPU-0", Type: "NVIDIA-Tesla T4", Count: 10, Totalmem: 8000 * util.MiB, Totalcore: 100, Health: true,
+		}})
+		node := &NodeUsage{Node: &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}, Devices: devices}
+		held := util.PodDevices{nvidia.NvidiaGPUDevice: util.PodSingleDevice{{{UUID: "GPU-0", Usedmem: 1000 * util.MiB, Usedcores: 10}}}}
+		addPodUsage(node, held)
+		addNamespaceUsage(node, held, holderNS, holderIsolated)
+		return map[string]*NodeUsage{"node1": node}
+	}
+	nums := util.PodDeviceRequests{{nvidia.NvidiaGPUDevice: util.ContainerDeviceRequest{Nums: 1, Type: nvidia.NvidiaGPUDevice, Memreq: 1000 * util.MiB, Coresreq: 10}}}
+	place := func(nodes map[string]*NodeUsage, namespace string, isolated bool) string {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "worker", Namespace: namespace}}
+		annos := map[string]string{util.NamespaceIsolation: "false"}
+		if isolated {
+			annos[util.NamespaceIsolation] = "true"
+		}
+		failedNodes := map[string]string{}
+		res, err := NewScheduler().calcScore(&nodes, nums, annos, pod, failedNodes)
+		assert.NilError(t, err)
+		if len(res.NodeList) == 0 {
+			return failedNodes["node1"]
+		}
+		return ""
+	}
+
+	// An isolated pod shares the card with its own namespace only.
+	assert.Equal(t, place(newNodes("tenant-a", false), "tenant-a", true), "")
+	assert.Equal(t, place(newNodes("tenant-b", false), "tenant-a", true),
+		"node not fit pod, card is shared with pods of another namespace, namespace isolation can't be granted")
+
+	// A card holding an isolated pod takes no pod of another namespace, isolated or not.
+	assert.Equal(t, place(newNodes("tenant-a", true), "tenant-a", false), "")
+	assert.Equal(t, place(newNodes("tenant-a", true), "tenant-b", false),
+		"node not fit pod, card is isolated to the pods of another namespace")
+	assert.Equal(t, place(newNodes("tenant-a", true), "tenant-b", true),
+		"node not fit pod, card is isolated to the pods of another namespace")
+
+	// Pods without isolation keep sharing cards across namespaces.
+	assert.Equal(t, place(newNodes("tenant-b", false), "tenant-a", false), "")
+
+	// A card with pods of several namespaces takes no isolated pod, even of one of them.
+	nodes := newNodes("tenant-a", false)
+	addNamespaceUsage(nodes["node1"], util.PodDevices{nvidia.NvidiaGPUDevice: util.PodSingleDevice{{{UUID: "GPU-0"}}}}, "tenant-b", false)
+	assert.Equal(t, place(nodes, "tenant-a", true),
+		"node not fit pod, card is shared with pods of another namespace, namespace isolation can't be granted")
+}
+
+func Test_planNamespaceIsolation(t *testing.T) {
+	prev := device.ActiveConfig()
+	initTFLOPSDevices(t)
+	defer func() { assert.NilError(t, device.InitDevicesWithConfig(prev)) }()
+
+	// Pods planned in one batch see the namespaces of the pods planned before them.
+	devices := policy.DeviceUsageList{Policy: util.GPUSchedulerPolicyBinpack.String()}
+	devices.DeviceLists = append(devices.DeviceLists, &policy.DeviceListsScore{Device: &util.DeviceUsage{
+		ID: "GPU-0", Type: "NVIDIA-Tesla T4", Count: 10, Totalmem: 8000 * util.MiB, Totalcore: 100, Health: true,
+	}})
+	usage := map[string]*NodeUsage{"node1": {Node: &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}, Devices: devices}}
+	newPod := func(namespace string) *corev1.Pod {
+		pod := fairnessTestPod("worker", 1000)
+		pod.Namespace = namespace
+		pod.Annotations = map[string]string{util.NamespaceIsolation: "true"}
+		return pod
+	}
+	s := NewScheduler()
+	planned, err := s.planPod(newPod("tenant-a"), usage, map[string]string{}, 1)
+	assert.NilError(t, err)
+	assert.Assert(t, planned.Fit)
+	planned, err = s.planPod(newPod("tenant-a"), usage, map[string]string{}, 1)
+	assert.NilError(t, err)
+	assert.Assert(t, planned.Fit)
+	planned, err = s.planPod(newPod("tenant-b"), usage, map[string]string{}, 1)
+	assert.NilError(t, err)
+	assert.Assert(t, !planned.Fit)
+	assert.Equal(t, planned.Reason, "0/1 nodes are available: 1 node not fit pod, card is isolated to the pods of another namespace")
+}
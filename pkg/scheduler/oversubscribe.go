@@ -0,0 +1,84 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// oversubscribes reports whether the memory of cards may be oversubscribed for a pod with annos.
+func oversubscribes(annos map[string]string) bool {
+	return config.MemoryOversubscriptionRatio > 1 && annos[util.GPUTier] == util.BestEffort
+}
+
+// oversubscribedMemory returns the memory best-effort pods may reserve on a card with total
+// memory. Allocations beyond total are only ever made by them, so it is also the limit above
+// which the allocations of a card are inconsistent.
+func oversubscribedMemory(total int64) int64 {
+	return oversubscribedMemoryAt(total, config.MemoryOversubscriptionRatio)
+}
+
+// oversubscribedMemoryAt is oversubscribedMemory with the given oversubscription ratio.
+func oversubscribedMemoryAt(total int64, ratio float64) int64 {
+	if ratio <= 1 {
+		return total
+	}
+	return int64(float64(total) * ratio)
+}
+
+// memoryOversubscriptionRatio returns the current MemoryOversubscriptionRatio, for checks
+// outside the scheduling cycles that the policy may be reloaded under.
+func (s *Scheduler) memoryOversubscriptionRatio() float64 {
+	s.policyMutex.RLock()
+	defer s.policyMutex.RUnlock()
+	return config.MemoryOversubscriptionRatio
+}
+
+// oversubscribeMemory raises the memory of every card to what best-effort pods may reserve.
+func oversubscribeMemory(nodes map[string]*NodeUsage) {
+	for _, node := range nodes {
+		for _, d := range node.Devices.DeviceLists {
+			d.Device.Totalmem = oversubscribedMemory(d.Device.Totalmem)
+		}
+	}
+}
+
+// overcommittedCores returns the cores of a card with total cores overcommitted by ratio, 0
+// keeps them.
+func overcommittedCores(total int32, ratio float64) int32 {
+	if ratio <= 0 {
+		return total
+	}
+	return int32(float64(total) * ratio)
+}
+
+// overcommitCores multiplies the cores of every card by ratio, see CoreOvercommit.
+func overcommitCores(nodes map[string]*NodeUsage, ratio float64) {
+	for _, node := range nodes {
+		for _, d := range node.Devices.DeviceLists {
+			d.Device.Totalcore = overcommittedCores(d.Device.Totalcore, ratio)
+		}
+	}
+}
+
+// coreOvercommit returns the current CoreOvercommit, like memoryOversubscriptionRatio.
+func (s *Scheduler) coreOvercommit() float64 {
+	s.policyMutex.RLock()
+	defer s.policyMutex.RUnlock()
+	return config.CoreOvercommit
+}
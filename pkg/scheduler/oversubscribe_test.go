@@ -0,0 +1,64 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/policy"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func Test_oversubscribeMemory(t *testing.T) {
+	initTFLOPSDevices(t)
+	defer func() { config.MemoryOversubscriptionRatio = 0 }()
+	bestEffort := map[string]string{util.GPUTier: util.BestEffort}
+	newNode := func() *NodeUsage {
+		return &NodeUsage{Devices: policy.DeviceUsageList{DeviceLists: []*policy.DeviceListsScore{
+			{Device: &util.DeviceUsage{ID: "GPU-0", Type: "NVIDIA-Tesla T4", Count: 10, Used: 1, Totalmem: 10240, Usedmem: 8192, Totalcore: 100}},
+		}}}
+	}
+	request := util.ContainerDeviceRequest{Nums: 1, Type: nvidia.NvidiaGPUDevice, Memreq: 4096, MemPercentagereq: 101}
+
+	assert.Equal(t, oversubscribes(bestEffort), false)
+	assert.Equal(t, oversubscribedMemory(10240), int64(10240))
+
+	config.MemoryOversubscriptionRatio = 1.5
+	assert.Equal(t, oversubscribes(bestEffort), true)
+	assert.Equal(t, oversubscribes(map[string]string{util.GPUTier: util.Guaranteed}), false)
+	assert.Equal(t, oversubscribedMemory(10240), int64(15360))
+
+	// Only 2048 of the 10240 are left, the best-effort pod may go up to 15360.
+	fit, _ := fitInCertainDevice(newNode(), request, nil, &corev1.Pod{}, &util.PodDevices{})
+	assert.Equal(t, fit, false)
+	node := newNode()
+	oversubscribeMemory(map[string]*NodeUsage{"node": node})
+	fit, devs := fitInCertainDevice(node, request, bestEffort, &corev1.Pod{}, &util.PodDevices{})
+	assert.Equal(t, fit, true)
+	assert.Equal(t, devs[nvidia.NvidiaGPUDevice][0].Usedmem, int64(4096))
+
+	// A card oversubscribed by best-effort pods isn't drift.
+	drift := &deviceDrift{Count: 10, Used: 2, Totalmem: 10240, Usedmem: 12288, Totalcore: 100, MemoryRatio: 1.5}
+	assert.Equal(t, drift.exceeded(), false)
+	drift.MemoryRatio = 0
+	assert.Equal(t, drift.exceeded(), true)
+}
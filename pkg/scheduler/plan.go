@@ -0,0 +1,168 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"maps"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/k8sutil"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/policy"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// MaxBatchPlanPods bounds the number of pod templates of a single batch plan request.
+const MaxBatchPlanPods = 1000
+
+// BatchPlanRequest is a batch of pods to check against the current capacity.
+type BatchPlanRequest struct {
+	// Pods are placed in order, every one on top of the ones placed before it.
+	Pods []corev1.PodTemplateSpec `json:"pods"`
+	// NodeNames are the candidate nodes, all registered nodes if empty.
+	NodeNames []string `json:"nodeNames,omitempty"`
+}
+
+// PlannedPod is where a pod of a batch would be placed.
+type PlannedPod struct {
+	Index int    `json:"index"`
+	Name  string `json:"name,omitempty"`
+	Fit   bool   `json:"fit"`
+	// Node is the suggested node, empty if the pod doesn't fit or requests no device.
+	Node    string          `json:"node,omitempty"`
+	Devices util.PodDevices `json:"devices,omitempty"`
+	// Reason is why the pod doesn't fit.
+	Reason string `json:"reason,omitempty"`
+}
+
+// BatchPlan is the outcome of a batch plan request.
+type BatchPlan struct {
+	Fitting int          `json:"fitting"`
+	Pods    []PlannedPod `json:"pods"`
+}
+
+// PlanBatch places the pods of req one after the other with the filter logic of the
+// scheduler, reserving the devices of every placed pod for the ones after it. Nothing is
+// recorded or written, so the plan only holds as long as the capacity doesn't change.
+func (s *Scheduler) PlanBatch(req BatchPlanRequest) (*BatchPlan, error) {
+	if len(req.Pods) > MaxBatchPlanPods {
+		return nil, fmt.Errorf("batch holds %d pods, at most %d are allowed", len(req.Pods), MaxBatchPlanPods)
+	}
+	s.policyMutex.RLock()
+	defer s.policyMutex.RUnlock()
+	nodeNames := req.NodeNames
+	if len(nodeNames) == 0 {
+		registered, err := s.ListNodes()
+		if err != nil {
+			return nil, err
+		}
+		for nodeID := range registered {
+			nodeNames = append(nodeNames, nodeID)
+		}
+		sort.Strings(nodeNames)
+	}
+	usage, failedNodes, err := s.getNodesUsage(&nodeNames, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &BatchPlan{Pods: make([]PlannedPod, 0, len(req.Pods))}
+	for idx, tmpl := range req.Pods {
+		pod := &corev1.Pod{ObjectMeta: *tmpl.ObjectMeta.DeepCopy(), Spec: *tmpl.Spec.DeepCopy()}
+		planned, err := s.planPod(pod, *usage, failedNodes, len(nodeNames))
+		if err != nil {
+			return nil, err
+		}
+		planned.Index = idx
+		planned.Name = pod.Name
+		if planned.Fit {
+			plan.Fitting++
+		}
+		plan.Pods = append(plan.Pods, planned)
+	}
+	klog.InfoS("Planned pod batch", "pods", len(plan.Pods), "fitting", plan.Fitting, "nodes", len(nodeNames))
+	return plan, nil
+}
+
+// planPod places pod on a copy of usage and reserves its devices in usage.
+func (s *Scheduler) planPod(pod *corev1.Pod, usage map[string]*NodeUsage, failedNodes map[string]string, candidates int) (PlannedPod, error) {
+	for _, expand := range []func(*corev1.Pod) error{expandGPUShorthand, expandDeviceClass, validateTFLOPSRequest} {
+		if err := expand(pod); err != nil {
+			return PlannedPod{Reason: err.Error()}, nil
+		}
+	}
+	nums := k8sutil.Resourcereqs(pod)
+	total := int32(0)
+	for _, n := range nums {
+		for _, k := range n {
+			total += k.Nums
+		}
+	}
+	if total == 0 {
+		return PlannedPod{Fit: true}, nil
+	}
+
+	annos := pod.Annotations
+	prof, hasProfile := s.profileFor(pod)
+	if hasProfile {
+		annos = prof.annotations(annos)
+	}
+	nodes := make(map[string]*NodeUsage, len(usage))
+	for nodeID, node := range usage {
+		nodes[nodeID] = cloneNodeUsage(node)
+		if v, ok := annos[policy.GPUSchedulerPolicyAnnotationKey]; ok {
+			nodes[nodeID].Devices.Policy = v
+		}
+	}
+	if hasProfile {
+		prof.apply(nodes, annos)
+	}
+	overcommitCores(nodes, prof.coreOvercommit())
+	if !softReservation(annos) {
+		yieldSoftMemory(nodes)
+	}
+	if oversubscribes(annos) {
+		oversubscribeMemory(nodes)
+	}
+	failed := maps.Clone(failedNodes)
+	scores, err := s.calcScore(&nodes, nums, annos, pod, failed)
+	if err != nil {
+		return PlannedPod{}, err
+	}
+	if len(scores.NodeList) == 0 {
+		return PlannedPod{Reason: summarizeFailedNodes(failed, candidates)}, nil
+	}
+	// The nodes are scored concurrently, order them by name first so ties go the same way every time.
+	sort.Slice(scores.NodeList, func(i, j int) bool { return scores.NodeList[i].NodeID > scores.NodeList[j].NodeID })
+	sort.Stable(scores)
+	m := scores.NodeList[len(scores.NodeList)-1]
+	if migSharedCompute(annos) {
+		addMigSharedUsage(usage[m.NodeID], m.Devices)
+	}
+	addPodUsage(usage[m.NodeID], m.Devices)
+	if annos[util.PCIeBandwidthHeavy] == "true" {
+		addSwitchLoad(usage[m.NodeID], m.Devices)
+	}
+	if annos[util.Encoder] != "" {
+		addEncoderUsage(usage[m.NodeID], m.Devices, annos[util.Encoder])
+	}
+	addNamespaceUsage(usage[m.NodeID], m.Devices, pod.Namespace, namespaceIsolated(pod.Namespace, annos))
+	return PlannedPod{Fit: true, Node: m.NodeID, Devices: m.Devices}, nil
+}
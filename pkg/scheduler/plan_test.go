@@ -0,0 +1,96 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func Test_PlanBatch(t *testing.T) {
+	prev := device.ActiveConfig()
+	initTFLOPSDevices(t)
+	defer func() { assert.NilError(t, device.InitDevicesWithConfig(prev)) }()
+
+	s := NewScheduler()
+	for _, nodeID := range []string{"node1", "node2"} {
+		s.addNode(nodeID, &util.NodeInfo{
+			ID:   nodeID,
+			Node: &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: nodeID}},
+			Devices: []util.DeviceInfo{{
+				ID: nodeID + "-gpu", Count: 10, Devmem: 8000, Devcore: 100, Type: "NVIDIA-Tesla T4",
+				Health: true, DeviceVendor: nvidia.NvidiaGPUDevice,
+			}},
+		})
+	}
+	template := func(name, mem string) corev1.PodTemplateSpec {
+		return corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{
+				Name: "main",
+				Resources: corev1.ResourceRequirements{Limits: corev1.ResourceList{
+					"hami.io/gpu":    resource.MustParse("1"),
+					"hami.io/gpumem": resource.MustParse(mem),
+				}},
+			}}},
+		}
+	}
+	req := BatchPlanRequest{Pods: []corev1.PodTemplateSpec{
+		template("trainer-0", "5000"),
+		template("trainer-1", "5000"),
+		template("trainer-2", "5000"),
+		{ObjectMeta: metav1.ObjectMeta{Name: "cpu-only"}, Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "main"}}}},
+	}}
+
+	plan, err := s.PlanBatch(req)
+	assert.NilError(t, err)
+	assert.Equal(t, plan.Fitting, 3)
+	assert.Equal(t, len(plan.Pods), 4)
+	// The second pod doesn't fit next to the first one, so it goes to the other node.
+	assert.Assert(t, plan.Pods[0].Fit)
+	assert.Assert(t, plan.Pods[1].Fit)
+	assert.Assert(t, plan.Pods[0].Node != plan.Pods[1].Node)
+	assert.Equal(t, plan.Pods[2].Fit, false)
+	assert.Equal(t, plan.Pods[2].Index, 2)
+	assert.Equal(t, plan.Pods[2].Name, "trainer-2")
+	assert.Assert(t, strings.HasPrefix(plan.Pods[2].Reason, "0/2 nodes are available"), plan.Pods[2].Reason)
+	assert.Equal(t, plan.Pods[3].Fit, true)
+	assert.Equal(t, plan.Pods[3].Node, "")
+
+	// Nothing was reserved for real, so the same batch plans the same way again.
+	assert.Equal(t, len(s.ListPodsInfo()), 0)
+	again, err := s.PlanBatch(req)
+	assert.NilError(t, err)
+	assert.Equal(t, again.Fitting, 3)
+
+	plan, err = s.PlanBatch(BatchPlanRequest{Pods: req.Pods[:2], NodeNames: []string{"node1"}})
+	assert.NilError(t, err)
+	assert.Equal(t, plan.Fitting, 1)
+	assert.Equal(t, plan.Pods[0].Node, "node1")
+
+	_, err = s.PlanBatch(BatchPlanRequest{Pods: make([]corev1.PodTemplateSpec, MaxBatchPlanPods+1)})
+	assert.ErrorContains(t, err, "at most 1000")
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+	"github.com/Project-HAMi/HAMi/pkg/version"
+)
+
+// EventReasonDevicePluginVersionMismatch is recorded on a node whose device plugin version is
+// incompatible with the scheduler.
+const EventReasonDevicePluginVersionMismatch = "DevicePluginVersionMismatch"
+
+// schedulerVersion is the version the device plugins are checked against.
+var schedulerVersion = version.Version()
+
+// releaseVersion is a release version as major.minor.patch, e.g. v2.5.1.
+type releaseVersion struct {
+	major, minor, patch int
+}
+
+// parseReleaseVersion parses a version like "v2.5.1", "2.5" or "v2.5.1-rc.1". ok is false for
+// anything else, e.g. "unknown" or a commit of a development build.
+func parseReleaseVersion(v string) (res releaseVersion, ok bool) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	parts := strings.Split(v, ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return releaseVersion{}, false
+	}
+	nums := make([]int, 3)
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return releaseVersion{}, false
+		}
+		nums[i] = n
+	}
+	return releaseVersion{major: nums[0], minor: nums[1], patch: nums[2]}, true
+}
+
+// pluginVersionMismatch returns why the device plugin of node is incompatible with a scheduler
+// of version scheduler, "" if it is compatible: both must have the same major version and be at
+// most config.DevicePluginVersionSkew minor versions apart. Versions which aren't releases, and
+// plugins which don't publish their version, can't be told and are taken as compatible.
+func pluginVersionMismatch(node *corev1.Node, scheduler string) string {
+	if config.DevicePluginVersionSkew < 0 || node == nil {
+		return ""
+	}
+	plugin := node.Annotations[util.NodeDevicePluginVersionAnnos]
+	pv, ok := parseReleaseVersion(plugin)
+	if !ok {
+		return ""
+	}
+	sv, ok := parseReleaseVersion(scheduler)
+	if !ok {
+		return ""
+	}
+	if pv.major != sv.major {
+		return fmt.Sprintf("device plugin %s is incompatible with scheduler %s, their major versions differ", plugin, scheduler)
+	}
+	if skew := pv.minor - sv.minor; skew > config.DevicePluginVersionSkew || -skew > config.DevicePluginVersionSkew {
+		return fmt.Sprintf("device plugin %s is incompatible with scheduler %s, they are more than %d minor versions apart", plugin, scheduler, config.DevicePluginVersionSkew)
+	}
+	return ""
+}
+
+// pluginVersionTracker remembers the plugin version of the nodes found incompatible, to report
+// every mismatch once.
+type pluginVersionTracker struct {
+	mutex        sync.Mutex
+	incompatible map[string]string
+}
+
+func newPluginVersionTracker() *pluginVersionTracker {
+	return &pluginVersionTracker{incompatible: make(map[string]string)}
+}
+
+// observe records whether the plugin of nodeID at pluginVersion is incompatible, and reports
+// whether it just became so.
+func (t *pluginVersionTracker) observe(nodeID, pluginVersion string, incompatible bool) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if !incompatible {
+		delete(t.incompatible, nodeID)
+		return false
+	}
+	if v, ok := t.incompatible[nodeID]; ok && v == pluginVersion {
+		return false
+	}
+	t.incompatible[nodeID] = pluginVersion
+	return true
+}
+
+// checkPluginVersion returns why no GPU pod may be placed on node because of the version of its
+// device plugin, "" if they may. A new mismatch is logged and recorded on the node.
+func (s *Scheduler) checkPluginVersion(node *corev1.Node) string {
+	reason := pluginVersionMismatch(node, schedulerVersion)
+	if node == nil || !s.pluginVersions.observe(node.Name, node.Annotations[util.NodeDevicePluginVersionAnnos], reason != "") {
+		return reason
+	}
+	klog.Warningf("Not placing GPU pods on node %s until the versions of its device plugin and the scheduler align: %s", node.Name, reason)
+	if s.eventRecorder != nil {
+		s.eventRecorder.Eventf(node, corev1.EventTypeWarning, EventReasonDevicePluginVersionMismatch, "No GPU pods are placed on the node: %s", reason)
+	}
+	return reason
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func pluginVersionSkew(t *testing.T, skew int, scheduler string) {
+	prevSkew, prevVersion := config.DevicePluginVersionSkew, schedulerVersion
+	t.Cleanup(func() { config.DevicePluginVersionSkew, schedulerVersion = prevSkew, prevVersion })
+	config.DevicePluginVersionSkew, schedulerVersion = skew, scheduler
+}
+
+func pluginNode(name, version string) *corev1.Node {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	if version != "" {
+		node.Annotations = map[string]string{util.NodeDevicePluginVersionAnnos: version}
+	}
+	return node
+}
+
+func Test_parseReleaseVersion(t *testing.T) {
+	for v, want := range map[string]releaseVersion{
+		"v2.5.1":      {2, 5, 1},
+		"2.5":         {2, 5, 0},
+		"v2.6.0-rc.1": {2, 6, 0},
+		"v2.4.0+abc":  {2, 4, 0},
+	} {
+		got, ok := parseReleaseVersion(v)
+		assert.Assert(t, ok, v)
+		assert.Equal(t, got, want, v)
+	}
+	for _, v := range []string{"", "unknown", "v2", "v2.x.1", "1.2.3.4", "a1b2c3d"} {
+		_, ok := parseReleaseVersion(v)
+		assert.Assert(t, !ok, v)
+	}
+}
+
+func Test_pluginVersionMismatch(t *testing.T) {
+	pluginVersionSkew(t, 1, "v2.5.0")
+	for _, plugin := range []string{"v2.5.3", "v2.4.0", "v2.6.1", "", "unknown"} {
+		assert.Equal(t, pluginVersionMismatch(pluginNode("node1", plugin), schedulerVersion), "", plugin)
+	}
+	assert.Equal(t, pluginVersionMismatch(pluginNode("node1", "v2.3.9"), schedulerVersion),
+		"device plugin v2.3.9 is incompatible with scheduler v2.5.0, they are more than 1 minor versions apart")
+	assert.Equal(t, pluginVersionMismatch(pluginNode("node1", "v3.5.0"), schedulerVersion),
+		"device plugin v3.5.0 is incompatible with scheduler v2.5.0, their major versions differ")
+	// A development build of the scheduler can't tell.
+	assert.Equal(t, pluginVersionMismatch(pluginNode("node1", "v3.5.0"), ""), "")
+
+	config.DevicePluginVersionSkew = 0
+	assert.Assert(t, pluginVersionMismatch(pluginNode("node1", "v2.6.0"), schedulerVersion) != "")
+	config.DevicePluginVersionSkew = -1
+	assert.Equal(t, pluginVersionMismatch(pluginNode("node1", "v3.5.0"), schedulerVersion), "")
+}
+
+func Test_checkPluginVersion(t *testing.T) {
+	pluginVersionSkew(t, 1, "v2.5.0")
+	s := NewScheduler()
+	recorder := record.NewFakeRecorder(10)
+	s.eventRecorder = recorder
+
+	old := pluginNode("node1", "v2.3.0")
+	assert.Assert(t, s.checkPluginVersion(old) != "")
+	assert.Assert(t, s.checkPluginVersion(old) != "")
+	assert.Equal(t, len(recorder.Events), 1)
+	event := <-recorder.Events
+	assert.Assert(t, strings.HasPrefix(event, "Warning DevicePluginVersionMismatch No GPU pods are placed on the node: device plugin v2.3.0"), event)
+
+	// Upgraded to another incompatible version, then to a compatible one.
+	assert.Assert(t, s.checkPluginVersion(pluginNode("node1", "v2.2.0")) != "")
+	assert.Equal(t, len(recorder.Events), 1)
+	<-recorder.Events
+	assert.Equal(t, s.checkPluginVersion(pluginNode("node1", "v2.5.0")), "")
+	assert.Assert(t, s.checkPluginVersion(old) != "")
+	assert.Equal(t, len(recorder.Events), 1)
+}
+
+func Test_pluginVersionPlacement(t *testing.T) {
+	prev := device.ActiveConfig()
+	initTFLOPSDevices(t)
+	defer func() { assert.NilError(t, device.InitDevicesWithConfig(prev)) }()
+	pluginVersionSkew(t, 1, "v2.5.0")
+
+	s := NewScheduler()
+	for name, version := range map[string]string{"node1": "v2.2.0", "node2": "v2.5.1"} {
+		s.addNode(name, &util.NodeInfo{ID: name, Node: pluginNode(name, version), Devices: []util.DeviceInfo{{
+			ID: "GPU-" + name, Count: 10, Devmem: 8000, Devcore: 100, Type: "NVIDIA-Tesla T4", Health: true, DeviceVendor: nvidia.NvidiaGPUDevice,
+		}}})
+	}
+	nums := util.PodDeviceRequests{{nvidia.NvidiaGPUDevice: util.ContainerDeviceRequest{Nums: 1, Type: nvidia.NvidiaGPUDevice, Memreq: 1000, Coresreq: 10}}}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "trainer", Namespace: "default"}}
+	names := []string{"node1", "node2"}
+	nodes, failedNodes, err := s.getNodesUsage(&names, pod)
+	assert.NilError(t, err)
+	res, err := s.calcScore(nodes, nums, nil, pod, failedNodes)
+	assert.NilError(t, err)
+	assert.Equal(t, len(res.NodeList), 1)
+	assert.Equal(t, res.NodeList[0].NodeID, "node2")
+	assert.Equal(t, failedNodes["node1"], "device plugin v2.2.0 is incompatible with scheduler v2.5.0, they are more than 1 minor versions apart")
+}
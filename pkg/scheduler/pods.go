@@ -18,7 +18,9 @@ package scheduler
 
 import (
 	"sync"
+	"time"
 
+	"github.com/Project-HAMi/HAMi/pkg/k8sutil"
 	"github.com/Project-HAMi/HAMi/pkg/util"
 
 	corev1 "k8s.io/api/core/v1"
@@ -34,6 +36,26 @@ type podInfo struct {
 	NodeID    string
 	Devices   util.PodDevices
 	CtrIDs    []string
+	// AddedAt is when the scheduler started accounting for the pod.
+	AddedAt time.Time
+	// BandwidthHeavy is set for pods annotated with hami.io/pcie-bandwidth-heavy.
+	BandwidthHeavy bool
+	// Soft is set for pods of the soft GPU tier.
+	Soft bool
+	// SoftLimit is the memory per card, in bytes, a soft pod was asked to shrink to, -1 if it wasn't.
+	SoftLimit int64
+	// Reclaimable is set for pods annotated with hami.io/gpu-reclaimable-memory, whose limit the
+	// vGPU monitor may lower while they are idle.
+	Reclaimable bool
+	// CostCenter is the cost center the allocations of the pod are reported under.
+	CostCenter string
+	// Encoder is how the pod uses the NVENC encoders of its cards, see util.Encoder.
+	Encoder string
+	// NamespaceIsolated is set for pods sharing their cards only with pods of their namespace.
+	NamespaceIsolated bool
+	// MigShared is set for pods sharing the compute of their MIG instances, see
+	// nvidia.MigSharedCompute.
+	MigShared bool
 }
 
 // PodUseDeviceStat counts pod use device info.
@@ -62,11 +84,23 @@ func (m *podManager) addPod(pod *corev1.Pod, nodeID string, devices util.PodDevi
 	_, exists := m.pods[pod.UID]
 	if !exists {
 		pi := &podInfo{
-			Name:      pod.Name,
-			UID:       pod.UID,
-			Namespace: pod.Namespace,
-			NodeID:    nodeID,
-			Devices:   devices,
+			Name:              pod.Name,
+			UID:               pod.UID,
+			Namespace:         pod.Namespace,
+			NodeID:            nodeID,
+			Devices:           devices,
+			AddedAt:           time.Now(),
+			BandwidthHeavy:    pod.Annotations[util.PCIeBandwidthHeavy] == "true",
+			Soft:              softReservation(pod.Annotations),
+			SoftLimit:         -1,
+			Reclaimable:       pod.Annotations[util.GPUReclaimableMemory] == "true",
+			CostCenter:        costCenter(pod.Annotations),
+			Encoder:           pod.Annotations[util.Encoder],
+			NamespaceIsolated: namespaceIsolated(pod.Namespace, pod.Annotations),
+			MigShared:         migSharedCompute(pod.Annotations),
+		}
+		if limit, ok := k8sutil.SoftMemoryLimit(pod); ok {
+			pi.SoftLimit = limit
 		}
 		m.pods[pod.UID] = pi
 		klog.InfoS("Pod added",
@@ -75,7 +109,12 @@ func (m *podManager) addPod(pod *corev1.Pod, nodeID string, devices util.PodDevi
 			"devices", devices,
 		)
 	} else {
-		m.pods[pod.UID].Devices = devices
+		pi := m.pods[pod.UID]
+		pi.Devices = devices
+		pi.CostCenter = costCenter(pod.Annotations)
+		if limit, ok := k8sutil.SoftMemoryLimit(pod); ok && (pi.SoftLimit < 0 || limit < pi.SoftLimit) {
+			pi.SoftLimit = limit
+		}
 		klog.InfoS("Pod devices updated",
 			"pod", klog.KRef(pod.Namespace, pod.Name),
 			"devices", devices,
@@ -101,6 +140,24 @@ func (m *podManager) delPod(pod *corev1.Pod) {
 	}
 }
 
+// setSoftLimit records the memory per card the soft pod uid was asked to shrink to.
+func (m *podManager) setSoftLimit(uid k8stypes.UID, limit int64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if pi, ok := m.pods[uid]; ok {
+		pi.SoftLimit = limit
+	}
+}
+
+func (m *podManager) getPod(uid k8stypes.UID) (*podInfo, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	pi, ok := m.pods[uid]
+	return pi, ok
+}
+
 func (m *podManager) ListPodsUID() ([]*corev1.Pod, error) {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
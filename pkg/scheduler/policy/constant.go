@@ -27,6 +27,8 @@ const (
 	GPUSchedulerPolicyBinpack SchedulerPolicyName = "binpack"
 	// GPUSchedulerPolicySpread is GPU use spread scheduler.
 	GPUSchedulerPolicySpread SchedulerPolicyName = "spread"
+	// GPUSchedulerPolicyRoundRobin is GPU use a weighted round-robin by free memory.
+	GPUSchedulerPolicyRoundRobin SchedulerPolicyName = "roundrobin"
 )
 
 func (s SchedulerPolicyName) String() string {
@@ -42,7 +42,8 @@ func (l DeviceUsageList) Swap(i, j int) {
 }
 
 func (l DeviceUsageList) Less(i, j int) bool {
-	if l.Policy == util.GPUSchedulerPolicyBinpack.String() {
+	// the score of roundrobin is the priority of the card in the round, so the highest goes first like binpack
+	if l.Policy == util.GPUSchedulerPolicyBinpack.String() || l.Policy == util.GPUSchedulerPolicyRoundRobin.String() {
 		if l.DeviceLists[i].Device.Numa == l.DeviceLists[j].Device.Numa {
 			return l.DeviceLists[i].Score < l.DeviceLists[j].Score
 		}
@@ -55,14 +56,24 @@ func (l DeviceUsageList) Less(i, j int) bool {
 	return l.DeviceLists[i].Device.Numa < l.DeviceLists[j].Device.Numa
 }
 
+// AddPreference adjusts the device score by bonus in the direction that makes
+// the device more likely to be chosen under the given GPU policy.
+func (ds *DeviceListsScore) AddPreference(policy string, bonus float32) {
+	if policy == util.GPUSchedulerPolicyBinpack.String() || policy == util.GPUSchedulerPolicyRoundRobin.String() {
+		ds.Score += bonus
+	} else {
+		ds.Score -= bonus
+	}
+}
+
 func (ds *DeviceListsScore) ComputeScore(requests util.ContainerDeviceRequests) {
-	request, core, mem := int32(0), int32(0), int32(0)
+	request, core, mem := int32(0), int32(0), int64(0)
 	// Here we are required to use the same type device
 	for _, container := range requests {
 		request += container.Nums
 		core += container.Coresreq
 		if container.MemPercentagereq != 0 && container.MemPercentagereq != 101 {
-			mem += ds.Device.Totalmem * (container.MemPercentagereq / 100.0)
+			mem += ds.Device.Totalmem * int64(container.MemPercentagereq/100.0)
 			continue
 		}
 		mem += container.Memreq
@@ -320,3 +320,23 @@ func TestComputeScore(t *testing.T) {
 		})
 	}
 }
+
+func TestDeviceListsScoreAddPreference(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   string
+		expected float32
+	}{
+		{name: "binpack picks higher scores", policy: util.GPUSchedulerPolicyBinpack.String(), expected: 12},
+		{name: "spread picks lower scores", policy: util.GPUSchedulerPolicySpread.String(), expected: 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ds := &DeviceListsScore{Score: 10}
+			ds.AddPreference(tt.policy, 2)
+			if ds.Score != tt.expected {
+				t.Errorf("expected score %f, got %f", tt.expected, ds.Score)
+			}
+		})
+	}
+}
@@ -30,6 +30,9 @@ type NodeScore struct {
 	Devices util.PodDevices
 	// Score recode every node all device user/allocate score
 	Score float32
+	// Breakdown is what the devices and every named preference contributed to Score, the
+	// preferences as bonuses before the node policy turns them into a raise or a cut.
+	Breakdown map[string]float32
 }
 
 type NodeScoreList struct {
@@ -65,8 +68,27 @@ func (ns *NodeScore) OverrideScore(devices DeviceUsageList, policy string) {
 	}
 }
 
+// AddPreference adjusts the node score by bonus in the direction that makes
+// the node more likely to be chosen under the given node policy.
+func (ns *NodeScore) AddPreference(policy string, bonus float32) {
+	if policy == util.NodeSchedulerPolicySpread.String() {
+		ns.Score -= bonus
+	} else {
+		ns.Score += bonus
+	}
+}
+
+// AddNamedPreference is AddPreference recording bonus in the breakdown under name.
+func (ns *NodeScore) AddNamedPreference(name, policy string, bonus float32) {
+	if ns.Breakdown == nil {
+		ns.Breakdown = make(map[string]float32)
+	}
+	ns.Breakdown[name] += bonus
+	ns.AddPreference(policy, bonus)
+}
+
 func (ns *NodeScore) ComputeDefaultScore(devices DeviceUsageList) {
-	used, usedCore, usedMem := int32(0), int32(0), int32(0)
+	used, usedCore, usedMem := int32(0), int32(0), int64(0)
 	for _, device := range devices.DeviceLists {
 		used += device.Device.Used
 		usedCore += device.Device.Usedcores
@@ -74,7 +96,7 @@ func (ns *NodeScore) ComputeDefaultScore(devices DeviceUsageList) {
 	}
 	klog.V(2).Infof("node %s used %d, usedCore %d, usedMem %d,", ns.NodeID, used, usedCore, usedMem)
 
-	total, totalCore, totalMem := int32(0), int32(0), int32(0)
+	total, totalCore, totalMem := int32(0), int32(0), int64(0)
 	for _, deviceLists := range devices.DeviceLists {
 		total += deviceLists.Device.Count
 		totalCore += deviceLists.Device.Totalcore
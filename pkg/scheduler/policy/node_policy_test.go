@@ -395,3 +395,21 @@ func TestComputeDefaultScore(t *testing.T) {
 		})
 	}
 }
+
+func TestNodeScoreAddPreference(t *testing.T) {
+	ns := &NodeScore{Score: 10}
+	ns.AddPreference(util.NodeSchedulerPolicyBinpack.String(), 2)
+	assert.Equal(t, ns.Score, float32(12))
+	ns.AddPreference(util.NodeSchedulerPolicySpread.String(), 2)
+	assert.Equal(t, ns.Score, float32(10))
+}
+
+func TestNodeScoreAddNamedPreference(t *testing.T) {
+	ns := &NodeScore{Score: 10}
+	ns.AddNamedPreference("sticky", util.NodeSchedulerPolicyBinpack.String(), 2)
+	ns.AddNamedPreference("sticky", util.NodeSchedulerPolicyBinpack.String(), 1)
+	assert.Equal(t, ns.Score, float32(13))
+	ns.AddNamedPreference("imageLocality", util.NodeSchedulerPolicySpread.String(), 2)
+	assert.Equal(t, ns.Score, float32(11))
+	assert.DeepEqual(t, ns.Breakdown, map[string]float32{"sticky": 3, "imageLocality": 2})
+}
@@ -0,0 +1,289 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v2"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// policyWeights are the weights of the soft scores the policy file may set, keyed like the
+// weights of EffectivePolicy. The fairness aging weight isn't among them, the tracker it
+// enables is set up at start.
+var policyWeights = map[string]*float64{
+	"imageLocality":    &config.ImageLocalityWeight,
+	"perfTier":         &config.PerfTierWeight,
+	"utilization":      &config.UtilizationWeight,
+	"pcieContention":   &config.PCIeContentionWeight,
+	"noiseTolerance":   &config.NoiseToleranceWeight,
+	"memoryType":       &config.MemoryTypeWeight,
+	"eccErrors":        &config.ECCErrorWeight,
+	"performanceState": &config.PerformanceStateWeight,
+	"temperature":      &config.GPUTemperatureWeight,
+}
+
+// policyReloadDelay is how long the policy file has to stay unchanged before it is reloaded,
+// so a file still being written isn't read half.
+var policyReloadDelay = time.Second
+
+// schedulingPolicy is the part of the policy the policy file sets, which a reload changes at once.
+type schedulingPolicy struct {
+	nodeSchedulerPolicy         string
+	gpuSchedulerPolicy          string
+	weights                     map[string]float64
+	memoryOversubscriptionRatio float64
+	coreOvercommit              float64
+	profiles                    map[string]Profile
+}
+
+// PolicyFileStatus is the state of the policy file of --profile-config-file.
+type PolicyFileStatus struct {
+	Path string `json:"path"`
+	// Checksum is the SHA-256 of the content in force, to compare with the ConfigMap.
+	Checksum string `json:"checksum"`
+	// AppliedAt is when the content in force was applied.
+	AppliedAt time.Time `json:"appliedAt"`
+	// Error is why the last change of the file was rejected, empty if it was applied.
+	Error string `json:"error,omitempty"`
+}
+
+// currentPolicy returns the policy in force. The caller holds the policy mutex.
+func (s *Scheduler) currentPolicy() schedulingPolicy {
+	p := schedulingPolicy{
+		nodeSchedulerPolicy:         config.NodeSchedulerPolicy,
+		gpuSchedulerPolicy:          config.GPUSchedulerPolicy,
+		weights:                     make(map[string]float64, len(policyWeights)),
+		memoryOversubscriptionRatio: config.MemoryOversubscriptionRatio,
+		coreOvercommit:              config.CoreOvercommit,
+		profiles:                    s.profiles,
+	}
+	for name, w := range policyWeights {
+		p.weights[name] = *w
+	}
+	return p
+}
+
+// setPolicy puts p in force. The caller holds the policy mutex for writing.
+func (s *Scheduler) setPolicy(p schedulingPolicy) {
+	config.NodeSchedulerPolicy = p.nodeSchedulerPolicy
+	config.GPUSchedulerPolicy = p.gpuSchedulerPolicy
+	for name, w := range policyWeights {
+		*w = p.weights[name]
+	}
+	config.MemoryOversubscriptionRatio = p.memoryOversubscriptionRatio
+	config.CoreOvercommit = p.coreOvercommit
+	s.profiles = p.profiles
+}
+
+// validSchedulerPolicy reports whether v is a policy of the nodes, or with gpu of the cards.
+func validSchedulerPolicy(v string, gpu bool) bool {
+	return v == util.GPUSchedulerPolicyBinpack.String() || v == util.GPUSchedulerPolicySpread.String() ||
+		(gpu && v == util.GPUSchedulerPolicyRoundRobin.String())
+}
+
+// policy returns base with the settings of cfg applied, or an error if one of them is invalid.
+func (cfg ProfilesConfig) policy(base schedulingPolicy) (schedulingPolicy, error) {
+	p := base
+	p.weights = maps.Clone(base.weights)
+	if cfg.NodeSchedulerPolicy != "" && !validSchedulerPolicy(cfg.NodeSchedulerPolicy, false) {
+		return p, fmt.Errorf("unknown node scheduler policy %q", cfg.NodeSchedulerPolicy)
+	}
+	if cfg.GPUSchedulerPolicy != "" && !validSchedulerPolicy(cfg.GPUSchedulerPolicy, true) {
+		return p, fmt.Errorf("unknown GPU scheduler policy %q", cfg.GPUSchedulerPolicy)
+	}
+	if cfg.NodeSchedulerPolicy != "" {
+		p.nodeSchedulerPolicy = cfg.NodeSchedulerPolicy
+	}
+	if cfg.GPUSchedulerPolicy != "" {
+		p.gpuSchedulerPolicy = cfg.GPUSchedulerPolicy
+	}
+	for name, w := range cfg.Weights {
+		if _, ok := policyWeights[name]; !ok {
+			known := make([]string, 0, len(policyWeights))
+			for k := range policyWeights {
+				known = append(known, k)
+			}
+			sort.Strings(known)
+			return p, fmt.Errorf("unknown weight %q, one of %v may be set", name, known)
+		}
+		if w < 0 {
+			return p, fmt.Errorf("weight %s must not be negative", name)
+		}
+		p.weights[name] = w
+	}
+	if cfg.MemoryOversubscriptionRatio != nil {
+		if *cfg.MemoryOversubscriptionRatio < 0 {
+			return p, fmt.Errorf("memoryOversubscriptionRatio must not be negative")
+		}
+		p.memoryOversubscriptionRatio = *cfg.MemoryOversubscriptionRatio
+	}
+	if cfg.CoreOvercommit != nil {
+		if *cfg.CoreOvercommit < 0 {
+			return p, fmt.Errorf("coreOvercommit must not be negative")
+		}
+		p.coreOvercommit = *cfg.CoreOvercommit
+	}
+	p.profiles = make(map[string]Profile, len(cfg.Profiles))
+	for _, prof := range cfg.Profiles {
+		if err := prof.validate(); err != nil {
+			return p, err
+		}
+		if _, ok := p.profiles[prof.SchedulerName]; ok {
+			return p, fmt.Errorf("duplicate profile for scheduler name %q", prof.SchedulerName)
+		}
+		p.profiles[prof.SchedulerName] = prof
+	}
+	return p, nil
+}
+
+// policyChanges describes what differs between the policies old and p, sorted.
+func policyChanges(old, p schedulingPolicy) []string {
+	var changes []string
+	if old.nodeSchedulerPolicy != p.nodeSchedulerPolicy {
+		changes = append(changes, fmt.Sprintf("nodeSchedulerPolicy %s -> %s", old.nodeSchedulerPolicy, p.nodeSchedulerPolicy))
+	}
+	if old.gpuSchedulerPolicy != p.gpuSchedulerPolicy {
+		changes = append(changes, fmt.Sprintf("gpuSchedulerPolicy %s -> %s", old.gpuSchedulerPolicy, p.gpuSchedulerPolicy))
+	}
+	for name := range policyWeights {
+		if old.weights[name] != p.weights[name] {
+			changes = append(changes, fmt.Sprintf("weights.%s %v -> %v", name, old.weights[name], p.weights[name]))
+		}
+	}
+	if old.memoryOversubscriptionRatio != p.memoryOversubscriptionRatio {
+		changes = append(changes, fmt.Sprintf("memoryOversubscriptionRatio %v -> %v", old.memoryOversubscriptionRatio, p.memoryOversubscriptionRatio))
+	}
+	if old.coreOvercommit != p.coreOvercommit {
+		changes = append(changes, fmt.Sprintf("coreOvercommit %v -> %v", old.coreOvercommit, p.coreOvercommit))
+	}
+	for name, prof := range p.profiles {
+		if prev, ok := old.profiles[name]; !ok {
+			changes = append(changes, fmt.Sprintf("profile %s added", name))
+		} else if prev != prof {
+			changes = append(changes, fmt.Sprintf("profile %s changed", name))
+		}
+	}
+	for name := range old.profiles {
+		if _, ok := p.profiles[name]; !ok {
+			changes = append(changes, fmt.Sprintf("profile %s removed", name))
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+// applyPolicyFile puts the policy of data, the content of the policy file, in force on top of
+// the policy of the flags, and returns what changed. An invalid policy changes nothing. The
+// caller holds the policy mutex for writing.
+func (s *Scheduler) applyPolicyFile(data []byte) ([]string, error) {
+	if s.policyBase == nil {
+		base := s.currentPolicy()
+		s.policyBase = &base
+	}
+	s.policyData = data
+	var cfg ProfilesConfig
+	err := yaml.Unmarshal(data, &cfg)
+	var p schedulingPolicy
+	if err == nil {
+		p, err = cfg.policy(*s.policyBase)
+	}
+	if err != nil {
+		s.policyFile.Error = err.Error()
+		return nil, err
+	}
+	changes := policyChanges(s.currentPolicy(), p)
+	s.setPolicy(p)
+	sum := sha256.Sum256(data)
+	s.policyFile.Checksum = hex.EncodeToString(sum[:])
+	s.policyFile.AppliedAt = time.Now().UTC()
+	s.policyFile.Error = ""
+	return changes, nil
+}
+
+// reloadPolicy applies the policy file path again if its content changed since it was last
+// read. Scheduling cycles in flight finish with the policy they started with.
+func (s *Scheduler) reloadPolicy(path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		klog.ErrorS(err, "Failed to read the policy file, keeping the current policy", "path", path)
+		return
+	}
+	s.policyMutex.Lock()
+	defer s.policyMutex.Unlock()
+	if bytes.Equal(data, s.policyData) {
+		return
+	}
+	changes, err := s.applyPolicyFile(data)
+	if err != nil {
+		klog.ErrorS(err, "Rejected the changed policy file, keeping the current policy", "path", path)
+		return
+	}
+	klog.InfoS("Reloaded the policy file", "path", path, "checksum", s.policyFile.Checksum, "changes", changes)
+}
+
+// WatchPolicyFile reloads the policy file path whenever it changes, until the scheduler is
+// stopped. The directory of the file is watched, as Kubernetes updates a mounted ConfigMap by
+// swapping a symlink in it.
+func (s *Scheduler) WatchPolicyFile(path string) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return err
+	}
+	klog.InfoS("Watching the policy file", "path", path)
+	go func() {
+		defer watcher.Close()
+		var reload <-chan time.Time
+		for {
+			select {
+			case <-s.stopCh:
+				return
+			case _, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				reload = time.After(policyReloadDelay)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				klog.ErrorS(err, "Failed to watch the policy file", "path", path)
+			case <-reload:
+				reload = nil
+				s.reloadPolicy(path)
+			}
+		}
+	}()
+	return nil
+}
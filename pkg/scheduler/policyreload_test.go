@@ -0,0 +1,153 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+)
+
+// keepPolicyFlags restores the flags a policy file overrides when the test ends.
+func keepPolicyFlags(t *testing.T) {
+	s := NewScheduler()
+	prev := s.currentPolicy()
+	t.Cleanup(func() { s.setPolicy(prev) })
+}
+
+func TestPolicyFileReload(t *testing.T) {
+	keepPolicyFlags(t)
+	config.GPUSchedulerPolicy = "spread"
+	config.PerfTierWeight = 10
+	config.MemoryOversubscriptionRatio = 1
+	config.CoreOvercommit = 1
+
+	s := NewScheduler()
+	path := writeProfiles(t, `
+gpuSchedulerPolicy: binpack
+weights:
+  perfTier: 5
+memoryOversubscriptionRatio: 1.5
+coreOvercommit: 2
+profiles:
+  - schedulerName: batch
+    maxSharers: 2
+`)
+	assert.NilError(t, s.LoadProfiles(path))
+	assert.Equal(t, config.GPUSchedulerPolicy, "binpack")
+	assert.Equal(t, config.PerfTierWeight, float64(5))
+	assert.Equal(t, config.MemoryOversubscriptionRatio, 1.5)
+	assert.Equal(t, config.CoreOvercommit, float64(2))
+	p, err := s.EffectivePolicy()
+	assert.NilError(t, err)
+	assert.Equal(t, p.Weights["perfTier"], float64(5))
+	assert.Equal(t, len(p.Profiles), 1)
+	assert.Equal(t, p.PolicyFile.Path, path)
+	assert.Equal(t, p.PolicyFile.Error, "")
+	applied := p.PolicyFile.Checksum
+
+	// A rejected change keeps the whole policy in force.
+	for _, content := range []string{
+		"gpuSchedulerPolicy: spread\nweights:\n  fairnessAging: 2\n",
+		"gpuSchedulerPolicy: spread\nweights:\n  perfTier: -1\n",
+		"gpuSchedulerPolicy: pack\n",
+		"memoryOversubscriptionRatio: -1\n",
+		"coreOvercommit: -1\n",
+		"profiles:\n  - schedulerName: a\n  - schedulerName: a\n",
+		"gpuSchedulerPolicy: [\n",
+	} {
+		assert.NilError(t, os.WriteFile(path, []byte(content), 0o644))
+		s.reloadPolicy(path)
+		assert.Equal(t, config.GPUSchedulerPolicy, "binpack", content)
+		assert.Equal(t, config.PerfTierWeight, float64(5), content)
+		p, err = s.EffectivePolicy()
+		assert.NilError(t, err)
+		assert.Equal(t, p.PolicyFile.Checksum, applied, content)
+		assert.Assert(t, p.PolicyFile.Error != "", content)
+	}
+
+	// Settings removed from the file fall back to the flags.
+	assert.NilError(t, os.WriteFile(path, []byte("nodeSchedulerPolicy: spread\n"), 0o644))
+	s.reloadPolicy(path)
+	assert.Equal(t, config.GPUSchedulerPolicy, "spread")
+	assert.Equal(t, config.NodeSchedulerPolicy, "spread")
+	assert.Equal(t, config.PerfTierWeight, float64(10))
+	assert.Equal(t, config.MemoryOversubscriptionRatio, float64(1))
+	assert.Equal(t, config.CoreOvercommit, float64(1))
+	p, err = s.EffectivePolicy()
+	assert.NilError(t, err)
+	assert.Equal(t, len(p.Profiles), 0)
+	assert.Equal(t, p.PolicyFile.Error, "")
+	assert.Assert(t, p.PolicyFile.Checksum != applied)
+}
+
+func TestPolicyChanges(t *testing.T) {
+	old := schedulingPolicy{
+		nodeSchedulerPolicy: "binpack",
+		gpuSchedulerPolicy:  "spread",
+		weights:             map[string]float64{"perfTier": 10},
+		profiles:            map[string]Profile{"batch": {SchedulerName: "batch"}, "online": {SchedulerName: "online"}},
+	}
+	p := schedulingPolicy{
+		nodeSchedulerPolicy:         "binpack",
+		gpuSchedulerPolicy:          "binpack",
+		weights:                     map[string]float64{"perfTier": 5},
+		memoryOversubscriptionRatio: 1.5,
+		coreOvercommit:              2,
+		profiles:                    map[string]Profile{"batch": {SchedulerName: "batch", MaxSharers: 2}, "train": {SchedulerName: "train"}},
+	}
+	assert.DeepEqual(t, policyChanges(old, p), []string{
+		"coreOvercommit 0 -> 2",
+		"gpuSchedulerPolicy spread -> binpack",
+		"memoryOversubscriptionRatio 0 -> 1.5",
+		"profile batch changed",
+		"profile online removed",
+		"profile train added",
+		"weights.perfTier 10 -> 5",
+	})
+	assert.Equal(t, len(policyChanges(p, p)), 0)
+}
+
+func TestWatchPolicyFile(t *testing.T) {
+	keepPolicyFlags(t)
+	prevDelay := policyReloadDelay
+	policyReloadDelay = 10 * time.Millisecond
+	defer func() { policyReloadDelay = prevDelay }()
+	config.UtilizationWeight = 0
+
+	s := NewScheduler()
+	defer s.Stop()
+	path := writeProfiles(t, "weights:\n  utilization: 1\n")
+	assert.NilError(t, s.LoadProfiles(path))
+	assert.NilError(t, s.WatchPolicyFile(path))
+	assert.NilError(t, os.WriteFile(path, []byte("weights:\n  utilization: 3\n"), 0o644))
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.policyMutex.RLock()
+		w := config.UtilizationWeight
+		s.policyMutex.RUnlock()
+		if w == 3 {
+			break
+		}
+		assert.Assert(t, time.Now().Before(deadline), "policy file not reloaded, utilization weight %v", w)
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"maps"
+	"os"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/policy"
+)
+
+// Profile is the HAMi policy applied to the pods of one kube-scheduler profile,
+// which is matched by the schedulerName of the pod. Unset fields keep the global setting.
+type Profile struct {
+	SchedulerName       string `yaml:"schedulerName" json:"schedulerName"`
+	NodeSchedulerPolicy string `yaml:"nodeSchedulerPolicy" json:"nodeSchedulerPolicy,omitempty"`
+	GPUSchedulerPolicy  string `yaml:"gpuSchedulerPolicy" json:"gpuSchedulerPolicy,omitempty"`
+	// MemoryOvercommit multiplies the memory every card registered, e.g. 1.5 lets 150% of it be allocated.
+	MemoryOvercommit float64 `yaml:"memoryOvercommit" json:"memoryOvercommit,omitempty"`
+	// CoreOvercommit multiplies the cores every card registered, independently of the memory, e.g.
+	// 2 lets 200% of them be allocated while the memory stays at what the card registered. It
+	// overrides the global CoreOvercommit.
+	CoreOvercommit float64 `yaml:"coreOvercommit" json:"coreOvercommit,omitempty"`
+	// MaxSharers caps the number of containers sharing a card below its registered split count.
+	MaxSharers int32 `yaml:"maxSharers" json:"maxSharers,omitempty"`
+}
+
+// ProfilesConfig is the content of the file passed with --profile-config-file. Unset global
+// fields keep the value of the flag.
+type ProfilesConfig struct {
+	NodeSchedulerPolicy string `yaml:"nodeSchedulerPolicy"`
+	GPUSchedulerPolicy  string `yaml:"gpuSchedulerPolicy"`
+	// Weights override the weights of the soft scores, keyed like the weights of the policy endpoint.
+	Weights                     map[string]float64 `yaml:"weights"`
+	MemoryOversubscriptionRatio *float64           `yaml:"memoryOversubscriptionRatio"`
+	CoreOvercommit              *float64           `yaml:"coreOvercommit"`
+	Profiles                    []Profile          `yaml:"profiles"`
+}
+
+// LoadProfiles reads the scheduler policy and profiles from path. An empty path leaves every
+// pod on the global policy of the flags.
+func (s *Scheduler) LoadProfiles(path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	s.policyMutex.Lock()
+	defer s.policyMutex.Unlock()
+	s.policyFile.Path = path
+	if _, err := s.applyPolicyFile(data); err != nil {
+		return err
+	}
+	klog.InfoS("Loaded scheduler profiles", "path", path, "profiles", len(s.profiles), "checksum", s.policyFile.Checksum)
+	return nil
+}
+
+func (p Profile) validate() error {
+	if p.SchedulerName == "" {
+		return fmt.Errorf("profile without schedulerName")
+	}
+	if p.NodeSchedulerPolicy != "" && !validSchedulerPolicy(p.NodeSchedulerPolicy, false) {
+		return fmt.Errorf("profile %s: unknown scheduler policy %q", p.SchedulerName, p.NodeSchedulerPolicy)
+	}
+	if p.GPUSchedulerPolicy != "" && !validSchedulerPolicy(p.GPUSchedulerPolicy, true) {
+		return fmt.Errorf("profile %s: unknown scheduler policy %q", p.SchedulerName, p.GPUSchedulerPolicy)
+	}
+	if p.MemoryOvercommit < 0 || p.CoreOvercommit < 0 || p.MaxSharers < 0 {
+		return fmt.Errorf("profile %s: memoryOvercommit, coreOvercommit and maxSharers must not be negative", p.SchedulerName)
+	}
+	return nil
+}
+
+// profileFor returns the profile of the kube-scheduler profile pod is scheduled by.
+func (s *Scheduler) profileFor(pod *corev1.Pod) (Profile, bool) {
+	p, ok := s.profiles[pod.Spec.SchedulerName]
+	return p, ok
+}
+
+// annotations returns annos with the policies of the profile filled in where the pod sets none.
+func (p Profile) annotations(annos map[string]string) map[string]string {
+	res := maps.Clone(annos)
+	if res == nil {
+		res = make(map[string]string)
+	}
+	if _, ok := res[policy.NodeSchedulerPolicyAnnotationKey]; !ok && p.NodeSchedulerPolicy != "" {
+		res[policy.NodeSchedulerPolicyAnnotationKey] = p.NodeSchedulerPolicy
+	}
+	if _, ok := res[policy.GPUSchedulerPolicyAnnotationKey]; !ok && p.GPUSchedulerPolicy != "" {
+		res[policy.GPUSchedulerPolicyAnnotationKey] = p.GPUSchedulerPolicy
+	}
+	return res
+}
+
+// coreOvercommit returns the ratio the cores of every card are multiplied with for the pods of
+// p, the global one if p doesn't set its own. A pod without a profile gets the zero Profile.
+func (p Profile) coreOvercommit() float64 {
+	if p.CoreOvercommit > 0 {
+		return p.CoreOvercommit
+	}
+	return config.CoreOvercommit
+}
+
+// apply adjusts the node usage computed for a pod of the profile. annos are the
+// annotations returned by annotations, so the GPU policy of the pod still wins.
+func (p Profile) apply(nodes map[string]*NodeUsage, annos map[string]string) {
+	for _, node := range nodes {
+		if v, ok := annos[policy.GPUSchedulerPolicyAnnotationKey]; ok {
+			node.Devices.Policy = v
+		}
+		for _, d := range node.Devices.DeviceLists {
+			if p.MemoryOvercommit > 0 {
+				d.Device.Totalmem = int64(float64(d.Device.Totalmem) * p.MemoryOvercommit)
+			}
+			if p.MaxSharers > 0 {
+				d.Device.Count = min(d.Device.Count, p.MaxSharers)
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/policy"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func writeProfiles(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "profiles.yaml")
+	assert.NilError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestLoadProfiles(t *testing.T) {
+	s := NewScheduler()
+	assert.NilError(t, s.LoadProfiles(""))
+	_, ok := s.profileFor(&corev1.Pod{Spec: corev1.PodSpec{SchedulerName: "batch"}})
+	assert.Assert(t, !ok)
+
+	assert.NilError(t, s.LoadProfiles(writeProfiles(t, `
+profiles:
+  - schedulerName: batch
+    nodeSchedulerPolicy: binpack
+    gpuSchedulerPolicy: binpack
+    memoryOvercommit: 1.5
+    maxSharers: 2
+  - schedulerName: online
+    gpuSchedulerPolicy: spread
+`)))
+	p, ok := s.profileFor(&corev1.Pod{Spec: corev1.PodSpec{SchedulerName: "batch"}})
+	assert.Assert(t, ok)
+	assert.Equal(t, p.MaxSharers, int32(2))
+	_, ok = s.profileFor(&corev1.Pod{Spec: corev1.PodSpec{SchedulerName: "default-scheduler"}})
+	assert.Assert(t, !ok, "unknown profiles fall back to the global policy")
+
+	for _, content := range []string{
+		"profiles:\n  - gpuSchedulerPolicy: binpack\n",
+		"profiles:\n  - schedulerName: a\n    gpuSchedulerPolicy: pack\n",
+		"profiles:\n  - schedulerName: a\n    maxSharers: -1\n",
+		"profiles:\n  - schedulerName: a\n    coreOvercommit: -1\n",
+		"profiles:\n  - schedulerName: a\n  - schedulerName: a\n",
+	} {
+		assert.Assert(t, s.LoadProfiles(writeProfiles(t, content)) != nil, content)
+	}
+}
+
+func TestProfileApply(t *testing.T) {
+	p := Profile{SchedulerName: "batch", NodeSchedulerPolicy: "binpack", GPUSchedulerPolicy: "binpack", MemoryOvercommit: 1.5, MaxSharers: 2}
+	annos := p.annotations(map[string]string{policy.GPUSchedulerPolicyAnnotationKey: "spread"})
+	assert.Equal(t, annos[policy.NodeSchedulerPolicyAnnotationKey], "binpack")
+	assert.Equal(t, annos[policy.GPUSchedulerPolicyAnnotationKey], "spread", "the pod annotation wins")
+
+	nodes := map[string]*NodeUsage{
+		"node1": {Devices: policy.DeviceUsageList{Policy: "binpack", DeviceLists: []*policy.DeviceListsScore{
+			{Device: &util.DeviceUsage{ID: "GPU-0", Count: 10, Totalmem: 1024 * util.MiB}},
+		}}},
+	}
+	p.apply(nodes, annos)
+	assert.Equal(t, nodes["node1"].Devices.Policy, "spread")
+	assert.Equal(t, nodes["node1"].Devices.DeviceLists[0].Device.Count, int32(2))
+	assert.Equal(t, nodes["node1"].Devices.DeviceLists[0].Device.Totalmem, 1536*util.MiB)
+}
+
+func TestProfileAsymmetricOvercommit(t *testing.T) {
+	initTFLOPSDevices(t)
+	p := Profile{SchedulerName: "inference", MemoryOvercommit: 1, CoreOvercommit: 2}
+	newNode := func() *NodeUsage {
+		return &NodeUsage{Devices: policy.DeviceUsageList{Policy: "binpack", DeviceLists: []*policy.DeviceListsScore{
+			{Device: &util.DeviceUsage{ID: "GPU-0", Type: "NVIDIA-Tesla T4", Count: 10, Used: 1, Totalmem: 10240, Usedmem: 6144, Totalcore: 100, Usedcores: 80}},
+		}}}
+	}
+	fit := func(node *NodeUsage, memreq int64, coresreq int32) bool {
+		request := util.ContainerDeviceRequest{Nums: 1, Type: nvidia.NvidiaGPUDevice, Memreq: memreq, MemPercentagereq: 101, Coresreq: coresreq}
+		ok, _ := fitInCertainDevice(node, request, nil, &corev1.Pod{}, &util.PodDevices{})
+		return ok
+	}
+
+	// Without the profile only 20 cores are left.
+	assert.Assert(t, !fit(newNode(), 2048, 50))
+	node := newNode()
+	p.apply(map[string]*NodeUsage{"node1": node}, nil)
+	overcommitCores(map[string]*NodeUsage{"node1": node}, p.coreOvercommit())
+	assert.Equal(t, node.Devices.DeviceLists[0].Device.Totalcore, int32(200))
+	assert.Equal(t, node.Devices.DeviceLists[0].Device.Totalmem, int64(10240))
+	// The cores are oversubscribed, the memory isn't.
+	assert.Assert(t, fit(node, 2048, 50))
+	assert.Assert(t, !fit(node, 6144, 50))
+}
+
+func TestProfileCoreOvercommitOverridesGlobal(t *testing.T) {
+	keepPolicyFlags(t)
+	config.CoreOvercommit = 2
+
+	// Pods without a profile, or of one leaving it out, get the global ratio.
+	assert.Equal(t, Profile{}.coreOvercommit(), float64(2))
+	assert.Equal(t, Profile{SchedulerName: "batch", MaxSharers: 2}.coreOvercommit(), float64(2))
+	assert.Equal(t, Profile{SchedulerName: "online", CoreOvercommit: 1}.coreOvercommit(), float64(1))
+
+	config.CoreOvercommit = 0
+	node := &NodeUsage{Devices: policy.DeviceUsageList{DeviceLists: []*policy.DeviceListsScore{
+		{Device: &util.DeviceUsage{ID: "GPU-0", Totalcore: 100}},
+	}}}
+	overcommitCores(map[string]*NodeUsage{"node1": node}, Profile{}.coreOvercommit())
+	assert.Equal(t, node.Devices.DeviceLists[0].Device.Totalcore, int32(100))
+}
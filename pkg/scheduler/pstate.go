@@ -0,0 +1,43 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+// preferHighPerformanceState raises the score of cards in a higher performance state, i.e. a
+// lower P-state, scaled between the card in the highest and the one in the lowest state on the
+// node. Cards whose state is unknown are left untouched, and so are nodes whose cards are all in
+// the same state.
+func preferHighPerformanceState(node *NodeUsage, weight float32) {
+	best, worst := -1, -1
+	for _, d := range node.Devices.DeviceLists {
+		p := d.Device.PerformanceState
+		if p == nil {
+			continue
+		}
+		if best < 0 || *p < best {
+			best = *p
+		}
+		worst = max(worst, *p)
+	}
+	if best == worst {
+		return
+	}
+	for _, d := range node.Devices.DeviceLists {
+		if p := d.Device.PerformanceState; p != nil {
+			d.AddPreference(node.Devices.Policy, weight*float32(worst-*p)/float32(worst-best))
+		}
+	}
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func Test_performanceStatePlacement(t *testing.T) {
+	prev := device.ActiveConfig()
+	initTFLOPSDevices(t)
+	defer func() { assert.NilError(t, device.InitDevicesWithConfig(prev)) }()
+	prevWeight := config.PerformanceStateWeight
+	defer func() { config.PerformanceStateWeight = prevWeight }()
+	config.PerformanceStateWeight = 10
+
+	// GPU-0 has the most memory, so the spread policy picks it unless its state counts.
+	newScheduler := func(states ...*int) *Scheduler {
+		s := NewScheduler()
+		info := &util.NodeInfo{ID: "node1", Node: &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}}
+		for i, p := range states {
+			info.Devices = append(info.Devices, util.DeviceInfo{
+				ID: "GPU-" + string(rune('0'+i)), Index: uint(i), Count: 10, Devmem: 8000 - int32(i)*1000, Devcore: 100,
+				Type: "NVIDIA-Tesla T4", Health: true, DeviceVendor: nvidia.NvidiaGPUDevice, PerformanceState: p,
+			})
+		}
+		s.addNode("node1", info)
+		return s
+	}
+	nums := util.PodDeviceRequests{{nvidia.NvidiaGPUDevice: util.ContainerDeviceRequest{Nums: 1, Type: nvidia.NvidiaGPUDevice, Memreq: 1000, Coresreq: 10}}}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "inference", Namespace: "default"}}
+	place := func(s *Scheduler, annos map[string]string) string {
+		names := []string{"node1"}
+		nodes, failedNodes, err := s.getNodesUsage(&names, pod)
+		assert.NilError(t, err)
+		for _, node := range *nodes {
+			node.Devices.Policy = util.GPUSchedulerPolicySpread.String()
+		}
+		res, err := s.calcScore(nodes, nums, annos, pod, failedNodes)
+		assert.NilError(t, err)
+		assert.Equal(t, len(res.NodeList), 1)
+		return res.NodeList[0].Devices[nvidia.NvidiaGPUDevice][0][0].UUID
+	}
+	p0, p2, p8 := 0, 2, 8
+	sensitive := map[string]string{util.LatencySensitive: "true"}
+
+	// A latency-sensitive pod goes to the card which is awake.
+	assert.Equal(t, place(newScheduler(&p8, &p0), sensitive), "GPU-1")
+	assert.Equal(t, place(newScheduler(&p8, &p2, &p8), sensitive), "GPU-1")
+	// Other pods don't care.
+	assert.Equal(t, place(newScheduler(&p8, &p0), nil), "GPU-0")
+	// Cards in the same or an unknown state are scored as usual.
+	assert.Equal(t, place(newScheduler(&p8, &p8), sensitive), "GPU-0")
+	assert.Equal(t, place(newScheduler(nil, &p0), sensitive), "GPU-0")
+
+	config.PerformanceStateWeight = 0
+	assert.Equal(t, place(newScheduler(&p8, &p0), sensitive), "GPU-0")
+}
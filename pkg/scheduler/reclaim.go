@@ -0,0 +1,340 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/k8sutil"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+const (
+	// EventReasonGPUReclaiming indicates that pods are evicted to free GPUs for the pod.
+	EventReasonGPUReclaiming = "GPUReclaiming"
+	// EventReasonGPUReclaimed indicates that the pod is evicted to free its GPUs for another pod.
+	EventReasonGPUReclaimed = "GPUReclaimed"
+
+	// reclaimRetryAfter is how long a pod waits for its victims to go before it reclaims again.
+	reclaimRetryAfter = time.Minute
+	// reclaimQueueSize bounds the reclaims waiting for their evictions.
+	reclaimQueueSize = 64
+)
+
+// reclaimTracker remembers when pods last evicted others, so a pod waiting for its
+// victims to terminate doesn't evict more, and queues the evictions, which are made
+// outside of the filter. A nil *reclaimTracker disables reclaiming.
+type reclaimTracker struct {
+	mutex   sync.Mutex
+	now     func() time.Time
+	pending map[k8stypes.UID]time.Time
+	plans   chan reclaimPlan
+}
+
+// reclaimPlan is the eviction of victims from node to free GPUs for pod.
+type reclaimPlan struct {
+	pod      *corev1.Pod
+	priority int32
+	node     string
+	victims  []reclaimVictim
+}
+
+func newReclaimTracker(enabled bool) *reclaimTracker {
+	if !enabled {
+		return nil
+	}
+	return &reclaimTracker{now: time.Now, pending: make(map[k8stypes.UID]time.Time), plans: make(chan reclaimPlan, reclaimQueueSize)}
+}
+
+// enqueue queues plan for the evictions, and reports false if the queue is full.
+func (r *reclaimTracker) enqueue(plan reclaimPlan) bool {
+	select {
+	case r.plans <- plan:
+		return true
+	default:
+		return false
+	}
+}
+
+// due reports whether pod may reclaim GPUs now.
+func (r *reclaimTracker) due(uid k8stypes.UID) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	now := r.now()
+	for u, at := range r.pending {
+		if now.Sub(at) >= reclaimRetryAfter {
+			delete(r.pending, u)
+		}
+	}
+	_, waiting := r.pending[uid]
+	return !waiting
+}
+
+func (r *reclaimTracker) mark(uid k8stypes.UID) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.pending[uid] = r.now()
+}
+
+func (r *reclaimTracker) forget(uid k8stypes.UID) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.pending, uid)
+}
+
+type reclaimVictim struct {
+	info     *podInfo
+	pod      *corev1.Pod
+	priority int32
+}
+
+// nonPreemptible reports whether pod opted out of being evicted to free GPUs.
+func nonPreemptible(pod *corev1.Pod) bool {
+	return pod.Annotations[util.GPUNonPreemptible] == "true"
+}
+
+// releaseUsage removes the devices of pd from the usage of node.
+func releaseUsage(node *NodeUsage, pd util.PodDevices) {
+	for _, podSingle := range pd {
+		for _, ctrdevs := range podSingle {
+			for _, udevice := range ctrdevs {
+				for _, d := range node.Devices.DeviceLists {
+					if d.Device.ID == udevice.UUID {
+						d.Device.Used--
+						d.Device.Usedmem -= udevice.Usedmem
+						d.Device.Usedcores -= udevice.Usedcores
+						if i := slices.Index(d.Device.Allocations, udevice); i >= 0 {
+							d.Device.Allocations = slices.Delete(d.Device.Allocations, i, i+1)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func hasMigDevices(pd util.PodDevices) bool {
+	for _, podSingle := range pd {
+		for _, ctrdevs := range podSingle {
+			for _, udevice := range ctrdevs {
+				if strings.Contains(udevice.UUID, "[") {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// fitsWithout reports whether pod fits on a copy of node without the devices of victims.
+func fitsWithout(node *NodeUsage, victims []reclaimVictim, nums util.PodDeviceRequests, annos map[string]string, pod *corev1.Pod) bool {
+	c := cloneNodeUsage(node)
+	for _, v := range victims {
+		releaseUsage(c, v.info.Devices)
+	}
+	pd := util.PodDevices{}
+	for _, n := range nums {
+		if fit, _ := fitInDevices(c, n, annos, pod, &pd); !fit {
+			return false
+		}
+	}
+	return true
+}
+
+// planReclaim returns the fewest victims on node which have to go for pod to fit, taking
+// the ones with the lowest reclaim priority, and the newest among those, first. It returns
+// an empty list if pod fits already, and nil if evicting all candidates isn't enough.
+func planReclaim(node *NodeUsage, candidates []reclaimVictim, nums util.PodDeviceRequests, annos map[string]string, pod *corev1.Pod) []reclaimVictim {
+	if fitsWithout(node, nil, nums, annos, pod) {
+		return []reclaimVictim{}
+	}
+	slices.SortStableFunc(candidates, func(a, b reclaimVictim) int {
+		if a.priority != b.priority {
+			return int(a.priority) - int(b.priority)
+		}
+		return b.info.AddedAt.Compare(a.info.AddedAt)
+	})
+	n := -1
+	for i := range candidates {
+		if fitsWithout(node, candidates[:i+1], nums, annos, pod) {
+			n = i + 1
+			break
+		}
+	}
+	if n < 0 {
+		return nil
+	}
+	victims := slices.Clone(candidates[:n])
+	// Spare the victims, highest priority first, which turn out not to be in the way.
+	for i := len(victims) - 1; i >= 0; i-- {
+		rest := slices.Delete(slices.Clone(victims), i, i+1)
+		if fitsWithout(node, rest, nums, annos, pod) {
+			victims = rest
+		}
+	}
+	return victims
+}
+
+// reclaimGPUs queues the eviction of the pods with a lower GPU reclaim priority than pod from
+// the node where the fewest of them have to go for pod to fit. pod itself stays
+// unschedulable, kube-scheduler retries it once the victims are gone.
+func (s *Scheduler) reclaimGPUs(pod *corev1.Pod, nums util.PodDeviceRequests, annos map[string]string, nodeNames *[]string) {
+	if s.reclaim == nil || s.podLister == nil || nodeNames == nil || !s.reclaim.due(pod.UID) {
+		return
+	}
+	own := k8sutil.GPUReclaimPriority(pod, config.GPUReclaimPriorityNamespaces)
+	soft := softReservation(annos)
+	candidates := make(map[string][]reclaimVictim)
+	terminating := make(map[string][]reclaimVictim)
+	spared := 0
+	for _, p := range s.ListPodsInfo() {
+		// Soft pods already yield their memory to pod unless it is soft itself.
+		if p.UID == pod.UID || !slices.Contains(*nodeNames, p.NodeID) || (p.Soft && !soft) {
+			continue
+		}
+		vp, err := s.podLister.Pods(p.Namespace).Get(p.Name)
+		if err != nil || vp.UID != p.UID {
+			continue
+		}
+		v := reclaimVictim{info: p, pod: vp, priority: k8sutil.GPUReclaimPriority(vp, config.GPUReclaimPriorityNamespaces)}
+		switch {
+		case vp.DeletionTimestamp != nil:
+			terminating[p.NodeID] = append(terminating[p.NodeID], v)
+		case v.priority >= own || hasMigDevices(p.Devices):
+			continue
+		case nonPreemptible(vp):
+			// Never a victim. As victims are only evicted if pod fits without them, a pod
+			// kept out by such pods alone evicts nothing and waits.
+			spared++
+		default:
+			candidates[p.NodeID] = append(candidates[p.NodeID], v)
+		}
+	}
+	if len(candidates) == 0 {
+		if spared > 0 {
+			klog.V(4).InfoS("Only non-preemptible pods have a lower GPU reclaim priority", "pod", klog.KObj(pod), "reclaimPriority", own, "nonPreemptible", spared)
+		}
+		return
+	}
+	nodes, _, err := s.getNodesUsage(nodeNames, pod)
+	if err != nil {
+		klog.ErrorS(err, "Failed to get node usage for GPU reclaim", "pod", klog.KObj(pod))
+		return
+	}
+	if !soft {
+		yieldSoftMemory(*nodes)
+	}
+	if oversubscribes(annos) {
+		oversubscribeMemory(*nodes)
+	}
+	prof, _ := s.profileFor(pod)
+	overcommitCores(*nodes, prof.coreOvercommit())
+	fabrics := requestedFabrics(annos)
+	var bestNode string
+	var best []reclaimVictim
+	for nodeID, cands := range candidates {
+		node, ok := (*nodes)[nodeID]
+		if !ok || !fitInFabric(node.Node, fabrics) || underMaintenance(node.Node, time.Now()) != "" || noHealthyGPU(node) != "" {
+			continue
+		}
+		// Terminating pods free their devices anyway.
+		node = cloneNodeUsage(node)
+		for _, v := range terminating[nodeID] {
+			releaseUsage(node, v.info.Devices)
+		}
+		victims := planReclaim(node, cands, nums, annos, pod)
+		if victims == nil {
+			continue
+		}
+		if len(victims) == 0 {
+			klog.V(4).InfoS("Terminating pods free enough GPUs, not reclaiming", "pod", klog.KObj(pod), "node", nodeID)
+			return
+		}
+		if best == nil || len(victims) < len(best) || (len(victims) == len(best) && nodeID < bestNode) {
+			bestNode, best = nodeID, victims
+		}
+	}
+	if best == nil {
+		klog.V(4).InfoS("No pods to reclaim GPUs from", "pod", klog.KObj(pod), "reclaimPriority", own, "nonPreemptible", spared)
+		return
+	}
+	s.reclaim.mark(pod.UID)
+	if !s.reclaim.enqueue(reclaimPlan{pod: pod, priority: own, node: bestNode, victims: best}) {
+		s.reclaim.forget(pod.UID)
+		klog.InfoS("GPU reclaim queue full, not reclaiming", "pod", klog.KObj(pod), "node", bestNode)
+	}
+}
+
+// WatchGPUReclaims makes the evictions reclaimGPUs queued, until the scheduler stops.
+func (s *Scheduler) WatchGPUReclaims() {
+	if s.reclaim == nil {
+		return
+	}
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case plan := <-s.reclaim.plans:
+			s.evictReclaimVictims(plan)
+		}
+	}
+}
+
+// evictReclaimVictims evicts the victims of plan. Evictions go through the Eviction API, so a
+// PodDisruptionBudget can refuse them.
+func (s *Scheduler) evictReclaimVictims(plan reclaimPlan) {
+	pod, own, bestNode, best := plan.pod, plan.priority, plan.node, plan.victims
+	names := make([]string, 0, len(best))
+	for _, v := range best {
+		names = append(names, v.pod.Namespace+"/"+v.pod.Name)
+	}
+	// Evicting only some victims would disrupt them without making room, so a dry run
+	// checks first that no PodDisruptionBudget refuses any of the evictions.
+	for _, dryRun := range []bool{true, false} {
+		for _, v := range best {
+			eviction := &policyv1.Eviction{ObjectMeta: metav1.ObjectMeta{Name: v.pod.Name, Namespace: v.pod.Namespace}}
+			if dryRun {
+				eviction.DeleteOptions = &metav1.DeleteOptions{DryRun: []string{metav1.DryRunAll}}
+			}
+			if err := s.kubeClient.PolicyV1().Evictions(v.pod.Namespace).Evict(context.Background(), eviction); err != nil {
+				klog.ErrorS(err, "Failed to evict pod to reclaim GPUs", "pod", klog.KObj(pod), "victim", klog.KObj(v.pod), "dryRun", dryRun)
+				s.eventRecorder.Eventf(pod, corev1.EventTypeWarning, EventReasonGPUReclaiming, "Can't evict %s/%s to free GPUs on node %s: %v", v.pod.Namespace, v.pod.Name, bestNode, err)
+				return
+			}
+			if !dryRun {
+				s.eventRecorder.Eventf(v.pod, corev1.EventTypeWarning, EventReasonGPUReclaimed,
+					"Evicted to free GPUs for pod %s/%s, GPU reclaim priority %d is below %d", pod.Namespace, pod.Name, v.priority, own)
+			}
+		}
+	}
+	klog.InfoS("Reclaimed GPUs", "pod", klog.KObj(pod), "reclaimPriority", own, "node", bestNode, "victims", names)
+	s.eventRecorder.Eventf(pod, corev1.EventTypeNormal, EventReasonGPUReclaiming, "Evicted %v on node %s to free GPUs", names, bestNode)
+}
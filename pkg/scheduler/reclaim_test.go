@@ -0,0 +1,215 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	listerscorev1 "k8s.io/client-go/listers/core/v1"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	extenderv1 "k8s.io/kube-scheduler/extender/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+	"github.com/Project-HAMi/HAMi/pkg/util/client"
+)
+
+// drainReclaims makes the evictions the filter queued.
+func drainReclaims(s *Scheduler) {
+	for {
+		select {
+		case plan := <-s.reclaim.plans:
+			s.evictReclaimVictims(plan)
+		default:
+			return
+		}
+	}
+}
+
+func Test_reclaimGPUs(t *testing.T) {
+	assert.NilError(t, device.InitDevicesWithConfig(&device.Config{NvidiaConfig: nvidia.NvidiaConfig{
+		ResourceCountName:            "hami.io/gpu",
+		ResourceMemoryName:           "hami.io/gpumem",
+		ResourceMemoryPercentageName: "hami.io/gpumem-percentage",
+		ResourceCoreName:             "hami.io/gpucores",
+		DefaultGPUNum:                1,
+	}}))
+	fakeClient := fake.NewSimpleClientset()
+	client.KubeClient = fakeClient
+	s := NewScheduler()
+	s.kubeClient = fakeClient
+	s.eventRecorder = record.NewFakeRecorder(100)
+	s.reclaim = newReclaimTracker(true)
+	config.GPUReclaimPriorityNamespaces = []string{"default"}
+	defer func() { config.GPUReclaimPriorityNamespaces = nil }()
+	podIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	s.podLister = listerscorev1.NewPodLister(podIndexer)
+	s.addNode("node1", &util.NodeInfo{
+		ID: "node1",
+		Devices: []util.DeviceInfo{
+			{ID: "GPU-0", Count: 10, Devmem: 8000, Devcore: 100, Type: nvidia.NvidiaGPUDevice, Health: true},
+			{ID: "GPU-1", Count: 10, Devmem: 8000, Devcore: 100, Type: nvidia.NvidiaGPUDevice, Health: true},
+		},
+	})
+	running := func(name, reclaim, uuid string, mem int64) {
+		pod := fairnessTestPod(name, mem)
+		pod.Annotations = map[string]string{util.GPUReclaimPriority: reclaim}
+		assert.NilError(t, podIndexer.Add(pod))
+		_, err := fakeClient.CoreV1().Pods(pod.Namespace).Create(context.Background(), pod, metav1.CreateOptions{})
+		assert.NilError(t, err)
+		s.addPod(pod, "node1", util.PodDevices{nvidia.NvidiaGPUDevice: util.PodSingleDevice{{{UUID: uuid, Type: nvidia.NvidiaGPUDevice, Usedmem: util.MemoryToBytes(nvidia.NvidiaGPUDevice, mem)}}}})
+	}
+	// GPU-0 is shared by a batch job and a service, GPU-1 by two services.
+	running("batch", "1", "GPU-0", 4000)
+	running("service-0", "100", "GPU-0", 4000)
+	running("service-1", "100", "GPU-1", 4000)
+	running("service-2", "100", "GPU-1", 4000)
+
+	evictions := func() []string {
+		names := make([]string, 0)
+		for _, a := range fakeClient.Actions() {
+			if c, ok := a.(k8stesting.CreateAction); ok && a.GetSubresource() == "eviction" && len(c.GetObject().(metav1.Object).GetName()) > 0 {
+				names = append(names, c.GetObject().(metav1.Object).GetName())
+			}
+		}
+		return names
+	}
+	filter := func(pod *corev1.Pod) bool {
+		if _, err := fakeClient.CoreV1().Pods(pod.Namespace).Get(context.Background(), pod.Name, metav1.GetOptions{}); err != nil {
+			_, err = fakeClient.CoreV1().Pods(pod.Namespace).Create(context.Background(), pod, metav1.CreateOptions{})
+			assert.NilError(t, err)
+		}
+		res, err := s.Filter(extenderv1.ExtenderArgs{Pod: pod, NodeNames: &[]string{"node1"}})
+		assert.NilError(t, err)
+		drainReclaims(s)
+		return res.NodeNames != nil
+	}
+
+	// A pod outside of the trusted namespaces can't raise its reclaim priority.
+	untrusted := fairnessTestPod("untrusted", 4000)
+	untrusted.Namespace = "tenant"
+	untrusted.Annotations = map[string]string{util.GPUReclaimPriority: "50"}
+	assert.Equal(t, filter(untrusted), false)
+	assert.DeepEqual(t, evictions(), []string{})
+
+	// A pod whose reclaim priority isn't above any of the running pods evicts nothing.
+	low := fairnessTestPod("low", 4000)
+	low.Annotations = map[string]string{util.GPUReclaimPriority: "1"}
+	assert.Equal(t, filter(low), false)
+	assert.DeepEqual(t, evictions(), []string{})
+
+	training := fairnessTestPod("training", 4000)
+	training.Annotations = map[string]string{util.GPUReclaimPriority: "50"}
+	assert.Equal(t, filter(training), false)
+	// The dry run and the eviction of the batch job, the services stay.
+	assert.DeepEqual(t, evictions(), []string{"batch", "batch"})
+
+	// Until the victim is gone the pod doesn't evict more.
+	assert.Equal(t, filter(training), false)
+	assert.Equal(t, len(evictions()), 2)
+	s.reclaim.now = func() time.Time { return time.Now().Add(reclaimRetryAfter) }
+	terminating := fairnessTestPod("batch", 4000)
+	terminating.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	assert.NilError(t, podIndexer.Update(terminating))
+	assert.Equal(t, filter(training), false)
+	assert.Equal(t, len(evictions()), 2, "the terminating victim already makes room")
+
+	s.delPod(terminating)
+	assert.Equal(t, filter(training), true)
+}
+
+func Test_reclaimGPUsNonPreemptible(t *testing.T) {
+	assert.NilError(t, device.InitDevicesWithConfig(&device.Config{NvidiaConfig: nvidia.NvidiaConfig{
+		ResourceCountName:            "hami.io/gpu",
+		ResourceMemoryName:           "hami.io/gpumem",
+		ResourceMemoryPercentageName: "hami.io/gpumem-percentage",
+		ResourceCoreName:             "hami.io/gpucores",
+		DefaultGPUNum:                1,
+	}}))
+	fakeClient := fake.NewSimpleClientset()
+	client.KubeClient = fakeClient
+	s := NewScheduler()
+	s.kubeClient = fakeClient
+	s.eventRecorder = record.NewFakeRecorder(100)
+	s.reclaim = newReclaimTracker(true)
+	config.GPUReclaimPriorityNamespaces = []string{"default"}
+	defer func() { config.GPUReclaimPriorityNamespaces = nil }()
+	podIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	s.podLister = listerscorev1.NewPodLister(podIndexer)
+	s.addNode("node1", &util.NodeInfo{
+		ID: "node1",
+		Devices: []util.DeviceInfo{
+			{ID: "GPU-0", Count: 10, Devmem: 8000, Devcore: 100, Type: nvidia.NvidiaGPUDevice, Health: true},
+			{ID: "GPU-1", Count: 10, Devmem: 8000, Devcore: 100, Type: nvidia.NvidiaGPUDevice, Health: true},
+		},
+	})
+	running := func(name, reclaim, nonPreemptible, uuid string) {
+		pod := fairnessTestPod(name, 4000)
+		pod.Annotations = map[string]string{util.GPUReclaimPriority: reclaim, util.GPUNonPreemptible: nonPreemptible}
+		assert.NilError(t, podIndexer.Add(pod))
+		_, err := fakeClient.CoreV1().Pods(pod.Namespace).Create(context.Background(), pod, metav1.CreateOptions{})
+		assert.NilError(t, err)
+		s.addPod(pod, "node1", util.PodDevices{nvidia.NvidiaGPUDevice: util.PodSingleDevice{{{UUID: uuid, Type: nvidia.NvidiaGPUDevice, Usedmem: util.MemoryToBytes(nvidia.NvidiaGPUDevice, 4000)}}}})
+	}
+	// GPU-0 is shared by a critical inference pod and a batch job of the same low reclaim
+	// priority, GPU-1 by two services.
+	running("inference", "1", "true", "GPU-0")
+	running("batch", "1", "false", "GPU-0")
+	running("service-0", "100", "false", "GPU-1")
+	running("service-1", "100", "false", "GPU-1")
+
+	evictions := func() []string {
+		names := make([]string, 0)
+		for _, a := range fakeClient.Actions() {
+			if c, ok := a.(k8stesting.CreateAction); ok && a.GetSubresource() == "eviction" && len(c.GetObject().(metav1.Object).GetName()) > 0 {
+				names = append(names, c.GetObject().(metav1.Object).GetName())
+			}
+		}
+		return names
+	}
+	filter := func(pod *corev1.Pod) bool {
+		_, err := fakeClient.CoreV1().Pods(pod.Namespace).Create(context.Background(), pod, metav1.CreateOptions{})
+		assert.NilError(t, err)
+		res, err := s.Filter(extenderv1.ExtenderArgs{Pod: pod, NodeNames: &[]string{"node1"}})
+		assert.NilError(t, err)
+		drainReclaims(s)
+		return res.NodeNames != nil
+	}
+
+	// A whole card could only be freed by evicting the inference pod too, so not even the
+	// batch job is evicted: the pod waits rather than disrupting pods for nothing.
+	whole := fairnessTestPod("whole", 8000)
+	whole.Annotations = map[string]string{util.GPUReclaimPriority: "50"}
+	assert.Equal(t, filter(whole), false)
+	assert.DeepEqual(t, evictions(), []string{})
+
+	// Half a card is freed by evicting the batch job alone.
+	training := fairnessTestPod("training", 4000)
+	training.Annotations = map[string]string{util.GPUReclaimPriority: "50"}
+	assert.Equal(t, filter(training), false)
+	assert.DeepEqual(t, evictions(), []string{"batch", "batch"})
+}
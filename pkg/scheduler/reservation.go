@@ -0,0 +1,233 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+var (
+	// ErrInvalidReservation is wrapped by the errors of malformed reservation requests.
+	ErrInvalidReservation = errors.New("invalid reservation")
+	// ErrReservationExists is returned for a token which already holds capacity.
+	ErrReservationExists = errors.New("reservation token is already in use")
+)
+
+// ReservationRequest asks to hold the capacity of pods about to be created.
+type ReservationRequest struct {
+	// Token is matched against the hami.io/reservation annotation of the pods consuming the reservation.
+	Token string `json:"token"`
+	// Pods are placed like the pods of a batch plan, every one on top of the ones before it.
+	Pods []corev1.PodTemplateSpec `json:"pods"`
+	// NodeNames are the candidate nodes, all registered nodes if empty.
+	NodeNames []string `json:"nodeNames,omitempty"`
+	// TTLSeconds is how long unconsumed capacity is held, --reservation-max-ttl if 0.
+	TTLSeconds int64 `json:"ttlSeconds,omitempty"`
+}
+
+// Reservation is the outcome of a reservation request.
+type Reservation struct {
+	Token string `json:"token"`
+	// Held is set if every pod fits, and their capacity is held until Expires. Nothing is held
+	// otherwise.
+	Held    bool         `json:"held"`
+	Expires time.Time    `json:"expires,omitempty"`
+	Pods    []PlannedPod `json:"pods"`
+}
+
+// heldReservation is the capacity a token holds, one entry per pod not consumed yet.
+type heldReservation struct {
+	expires time.Time
+	pods    []*podInfo
+}
+
+// reservationManager holds the capacity of reservations until pods consume it or it expires.
+type reservationManager struct {
+	// planning serializes reservations, so two of them don't hold the same capacity.
+	planning sync.Mutex
+
+	mutex        sync.Mutex
+	reservations map[string]*heldReservation
+}
+
+func newReservationManager() *reservationManager {
+	return &reservationManager{reservations: make(map[string]*heldReservation)}
+}
+
+// reservationToken returns the reservation pod consumes, "" if none.
+func reservationToken(pod *corev1.Pod) string {
+	if pod == nil {
+		return ""
+	}
+	return pod.Annotations[util.Reservation]
+}
+
+// expire drops the reservations expired at now. The caller holds the mutex.
+func (m *reservationManager) expire(now time.Time) {
+	for token, r := range m.reservations {
+		if !now.Before(r.expires) {
+			klog.InfoS("Reservation expired", "token", token, "unconsumed", len(r.pods))
+			delete(m.reservations, token)
+		}
+	}
+}
+
+// ListPodsInfo returns the capacity held by the reservations at now, except for the one of
+// token, which the pod being scheduled may use.
+func (m *reservationManager) ListPodsInfo(token string, now time.Time) []*podInfo {
+	if m == nil {
+		return nil
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.expire(now)
+	var pods []*podInfo
+	for t, r := range m.reservations {
+		if t != token {
+			pods = append(pods, r.pods...)
+		}
+	}
+	return pods
+}
+
+// hold holds the capacity of pods for token until expires.
+func (m *reservationManager) hold(token string, pods []*podInfo, expires time.Time) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.expire(time.Now())
+	if _, ok := m.reservations[token]; ok {
+		return ErrReservationExists
+	}
+	m.reservations[token] = &heldReservation{expires: expires, pods: pods}
+	return nil
+}
+
+// consume releases the capacity of one pod of token, preferably the one held on nodeID.
+func (m *reservationManager) consume(token, nodeID string) {
+	if m == nil || token == "" {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	r, ok := m.reservations[token]
+	if !ok {
+		return
+	}
+	idx := 0
+	for i, p := range r.pods {
+		if p.NodeID == nodeID {
+			idx = i
+			break
+		}
+	}
+	r.pods = append(r.pods[:idx], r.pods[idx+1:]...)
+	klog.InfoS("Reservation consumed", "token", token, "node", nodeID, "unconsumed", len(r.pods))
+	if len(r.pods) == 0 {
+		delete(m.reservations, token)
+	}
+}
+
+// release drops the reservation of token. It reports whether there was one.
+func (m *reservationManager) release(token string) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	_, ok := m.reservations[token]
+	delete(m.reservations, token)
+	return ok
+}
+
+// Reserve places the pods of req like PlanBatch and, if all of them fit, holds their devices
+// for the pods annotated with the token of req until they consume them or the TTL runs out.
+func (s *Scheduler) Reserve(req ReservationRequest) (*Reservation, error) {
+	if req.Token == "" {
+		return nil, fmt.Errorf("%w: token is empty", ErrInvalidReservation)
+	}
+	if len(req.Pods) == 0 || len(req.Pods) > MaxBatchPlanPods {
+		return nil, fmt.Errorf("%w: %d pods, between 1 and %d are allowed", ErrInvalidReservation, len(req.Pods), MaxBatchPlanPods)
+	}
+	ttl := time.Duration(req.TTLSeconds) * time.Second
+	if ttl == 0 {
+		ttl = config.ReservationMaxTTL
+	}
+	if ttl <= 0 || ttl > config.ReservationMaxTTL {
+		return nil, fmt.Errorf("%w: ttl %s, between 1s and %s are allowed", ErrInvalidReservation, ttl, config.ReservationMaxTTL)
+	}
+	return s.reserve(req, ttl)
+}
+
+// reserve is Reserve for a valid req, holding the devices for ttl.
+func (s *Scheduler) reserve(req ReservationRequest, ttl time.Duration) (*Reservation, error) {
+	s.reservations.planning.Lock()
+	defer s.reservations.planning.Unlock()
+	plan, err := s.PlanBatch(BatchPlanRequest{Pods: req.Pods, NodeNames: req.NodeNames})
+	if err != nil {
+		return nil, err
+	}
+	res := &Reservation{Token: req.Token, Pods: plan.Pods}
+	if plan.Fitting < len(plan.Pods) {
+		klog.InfoS("Reservation not held, not every pod fits", "token", req.Token, "pods", len(plan.Pods), "fitting", plan.Fitting)
+		return res, nil
+	}
+	now := time.Now()
+	held := make([]*podInfo, 0, len(plan.Pods))
+	for _, p := range plan.Pods {
+		if p.Node == "" {
+			continue
+		}
+		tmpl := req.Pods[p.Index]
+		held = append(held, &podInfo{
+			Namespace:         tmpl.Namespace,
+			Name:              tmpl.Name,
+			UID:               k8stypes.UID(fmt.Sprintf("reservation/%s/%d", req.Token, p.Index)),
+			NodeID:            p.Node,
+			Devices:           p.Devices,
+			AddedAt:           now,
+			BandwidthHeavy:    tmpl.Annotations[util.PCIeBandwidthHeavy] == "true",
+			Soft:              softReservation(tmpl.Annotations),
+			SoftLimit:         -1,
+			Encoder:           tmpl.Annotations[util.Encoder],
+			NamespaceIsolated: namespaceIsolated(tmpl.Namespace, tmpl.Annotations),
+			MigShared:         migSharedCompute(tmpl.Annotations),
+		})
+	}
+	if err := s.reservations.hold(req.Token, held, now.Add(ttl)); err != nil {
+		return nil, err
+	}
+	res.Held = true
+	res.Expires = now.Add(ttl).UTC()
+	klog.InfoS("Reservation held", "token", req.Token, "pods", len(held), "expires", res.Expires)
+	return res, nil
+}
+
+// ReleaseReservation drops the capacity still held by token. It reports whether there was any.
+func (s *Scheduler) ReleaseReservation(token string) bool {
+	released := s.reservations.release(token)
+	if released {
+		klog.InfoS("Reservation released", "token", token)
+	}
+	return released
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func Test_Reserve(t *testing.T) {
+	prev := device.ActiveConfig()
+	initTFLOPSDevices(t)
+	defer func() { assert.NilError(t, device.InitDevicesWithConfig(prev)) }()
+	prevTTL := config.ReservationMaxTTL
+	config.ReservationMaxTTL = 5 * time.Minute
+	defer func() { config.ReservationMaxTTL = prevTTL }()
+
+	s := NewScheduler()
+	for _, nodeID := range []string{"node1", "node2"} {
+		s.addNode(nodeID, &util.NodeInfo{
+			ID:   nodeID,
+			Node: &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: nodeID}},
+			Devices: []util.DeviceInfo{{
+				ID: nodeID + "-gpu", Count: 10, Devmem: 8000, Devcore: 100, Type: "NVIDIA-Tesla T4",
+				Health: true, DeviceVendor: nvidia.NvidiaGPUDevice,
+			}},
+		})
+	}
+	template := func(name string) corev1.PodTemplateSpec {
+		return corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{
+				Name: "main",
+				Resources: corev1.ResourceRequirements{Limits: corev1.ResourceList{
+					"hami.io/gpu":    resource.MustParse("1"),
+					"hami.io/gpumem": resource.MustParse("5000"),
+				}},
+			}}},
+		}
+	}
+	trainers := []corev1.PodTemplateSpec{template("trainer-0"), template("trainer-1")}
+
+	res, err := s.Reserve(ReservationRequest{Token: "job-1", Pods: trainers, TTLSeconds: 60})
+	assert.NilError(t, err)
+	assert.Assert(t, res.Held)
+	assert.Assert(t, res.Pods[0].Node != res.Pods[1].Node)
+	assert.Assert(t, time.Until(res.Expires) > 50*time.Second)
+
+	// A competing pod no longer fits.
+	plan, err := s.PlanBatch(BatchPlanRequest{Pods: []corev1.PodTemplateSpec{template("other")}})
+	assert.NilError(t, err)
+	assert.Equal(t, plan.Fitting, 0)
+	res, err = s.Reserve(ReservationRequest{Token: "job-2", Pods: []corev1.PodTemplateSpec{template("other")}})
+	assert.NilError(t, err)
+	assert.Equal(t, res.Held, false)
+	_, err = s.Reserve(ReservationRequest{Token: "job-1", Pods: []corev1.PodTemplateSpec{{}}})
+	assert.Assert(t, errors.Is(err, ErrReservationExists))
+
+	// A pod of the reservation sees the capacity held for it as free.
+	consumer := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "trainer-0", Annotations: map[string]string{util.Reservation: "job-1"}}}
+	nodes := []string{"node1", "node2"}
+	usage, _, err := s.getNodesUsage(&nodes, consumer)
+	assert.NilError(t, err)
+	assert.Equal(t, (*usage)["node1"].Devices.DeviceLists[0].Device.Usedmem, int64(0))
+	usage, _, err = s.getNodesUsage(&nodes, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, (*usage)["node1"].Devices.DeviceLists[0].Device.Usedmem, 5000*util.MiB)
+
+	// Consuming releases the capacity held on the node of the pod first.
+	s.reservations.consume("job-1", "node2")
+	held := s.reservations.ListPodsInfo("", time.Now())
+	assert.Equal(t, len(held), 1)
+	assert.Equal(t, held[0].NodeID, "node1")
+	s.reservations.consume("job-1", "node2")
+	assert.Equal(t, len(s.reservations.ListPodsInfo("", time.Now())), 0)
+	assert.Equal(t, s.ReleaseReservation("job-1"), false)
+
+	// Unconsumed capacity expires.
+	res, err = s.Reserve(ReservationRequest{Token: "job-3", Pods: trainers, TTLSeconds: 1})
+	assert.NilError(t, err)
+	assert.Assert(t, res.Held)
+	assert.Equal(t, len(s.reservations.ListPodsInfo("", time.Now())), 2)
+	assert.Equal(t, len(s.reservations.ListPodsInfo("", time.Now().Add(2*time.Second))), 0)
+
+	res, err = s.Reserve(ReservationRequest{Token: "job-4", Pods: trainers})
+	assert.NilError(t, err)
+	assert.Assert(t, res.Held)
+	assert.Equal(t, s.ReleaseReservation("job-4"), true)
+	assert.Equal(t, len(s.reservations.ListPodsInfo("", time.Now())), 0)
+
+	for _, req := range []ReservationRequest{
+		{Pods: trainers},
+		{Token: "job-5"},
+		{Token: "job-5", Pods: trainers, TTLSeconds: 3600},
+		{Token: "job-5", Pods: trainers, TTLSeconds: -1},
+	} {
+		_, err = s.Reserve(req)
+		assert.Assert(t, errors.Is(err, ErrInvalidReservation), err)
+	}
+}
@@ -0,0 +1,315 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/k8sutil"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+)
+
+const (
+	// EventReasonGPUCapacityReserved is recorded on a resumed workload whose GPU capacity is held
+	// for its pods.
+	EventReasonGPUCapacityReserved = "GPUCapacityReserved"
+	// EventReasonGPUCapacityNotReserved is recorded on a resumed workload whose GPU capacity
+	// couldn't be held, its pods are scheduled like any other.
+	EventReasonGPUCapacityNotReserved = "GPUCapacityNotReserved"
+)
+
+// workloadObject is the object of a workload, for its metadata and events.
+type workloadObject interface {
+	metav1.Object
+	runtime.Object
+}
+
+// gpuWorkload is a Job, ReplicaSet or StatefulSet, the controllers creating pods themselves.
+type gpuWorkload struct {
+	kind     string
+	obj      workloadObject
+	template corev1.PodTemplateSpec
+	// active is the number of pods the workload runs, 0 while it is suspended or scaled to zero.
+	active int32
+	// suspended is set for a Job with spec.suspend, which is suspended whether or not the
+	// scheduler saw it run before.
+	suspended bool
+}
+
+func jobWorkload(job *batchv1.Job) gpuWorkload {
+	w := gpuWorkload{kind: "Job", obj: job, template: job.Spec.Template, active: 1}
+	if job.Spec.Suspend != nil && *job.Spec.Suspend {
+		w.active = 0
+		w.suspended = true
+		return w
+	}
+	if job.Spec.Parallelism != nil {
+		w.active = *job.Spec.Parallelism
+	}
+	if job.Spec.Completions != nil {
+		w.active = min(w.active, *job.Spec.Completions-job.Status.Succeeded)
+	}
+	w.active = max(w.active, 0)
+	return w
+}
+
+func replicaSetWorkload(rs *appsv1.ReplicaSet) gpuWorkload {
+	w := gpuWorkload{kind: "ReplicaSet", obj: rs, template: rs.Spec.Template, active: 1}
+	if rs.Spec.Replicas != nil {
+		w.active = *rs.Spec.Replicas
+	}
+	return w
+}
+
+func statefulSetWorkload(ss *appsv1.StatefulSet) gpuWorkload {
+	w := gpuWorkload{kind: "StatefulSet", obj: ss, template: ss.Spec.Template, active: 1}
+	if ss.Spec.Replicas != nil {
+		w.active = *ss.Spec.Replicas
+	}
+	return w
+}
+
+// requestsDevices reports whether the pods of w request devices HAMi schedules.
+func (w gpuWorkload) requestsDevices() bool {
+	pod := &corev1.Pod{ObjectMeta: w.template.ObjectMeta, Spec: w.template.Spec}
+	for _, ctr := range k8sutil.Resourcereqs(pod) {
+		if len(ctr) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// resumeToken returns the reservation token of w resumed at its current generation.
+func (w gpuWorkload) resumeToken() string {
+	return fmt.Sprintf("resume/%s/%s/%s/%d", strings.ToLower(w.kind), w.obj.GetNamespace(), w.obj.GetName(), w.obj.GetGeneration())
+}
+
+// deploymentOwned reports whether rs is a ReplicaSet of a Deployment, which scales it from
+// zero on every rollout and rollback.
+func deploymentOwned(rs *appsv1.ReplicaSet) bool {
+	owner := metav1.GetControllerOf(rs)
+	return owner != nil && owner.Kind == "Deployment"
+}
+
+// resumeTracker remembers the reservation of every workload resumed, by the UID its pods name
+// as their controller, and the workloads seen scaling to zero. A nil *resumeTracker tracks nothing.
+type resumeTracker struct {
+	mutex  sync.Mutex
+	tokens map[k8stypes.UID]string
+	// scaledDown holds the workloads seen going from running pods to none.
+	scaledDown map[k8stypes.UID]bool
+}
+
+func newResumeTracker(enabled bool) *resumeTracker {
+	if !enabled {
+		return nil
+	}
+	return &resumeTracker{tokens: make(map[k8stypes.UID]string), scaledDown: make(map[k8stypes.UID]bool)}
+}
+
+// scaleDown records that the workload uid went to zero pods.
+func (t *resumeTracker) scaleDown(uid k8stypes.UID) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.scaledDown[uid] = true
+}
+
+// scaleUp reports whether the workload uid was seen going to zero pods, and forgets it.
+func (t *resumeTracker) scaleUp(uid k8stypes.UID) bool {
+	if t == nil {
+		return false
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	seen := t.scaledDown[uid]
+	delete(t.scaledDown, uid)
+	return seen
+}
+
+func (t *resumeTracker) set(uid k8stypes.UID, token string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.tokens[uid] = token
+}
+
+// forget drops the reservation of uid and returns its token, "" if there was none.
+func (t *resumeTracker) forget(uid k8stypes.UID) string {
+	if t == nil {
+		return ""
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	token := t.tokens[uid]
+	delete(t.tokens, uid)
+	delete(t.scaledDown, uid)
+	return token
+}
+
+// token returns the reservation of the controller of pod, "" if none.
+func (t *resumeTracker) token(pod *corev1.Pod) string {
+	if t == nil || pod == nil {
+		return ""
+	}
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return ""
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.tokens[owner.UID]
+}
+
+// podReservationToken returns the reservation pod consumes: the one of its annotation, or the
+// one held for its controller when it resumed. "" if none.
+func (s *Scheduler) podReservationToken(pod *corev1.Pod) string {
+	if token := reservationToken(pod); token != "" {
+		return token
+	}
+	return s.resumes.token(pod)
+}
+
+// startResumeWatch watches the Jobs, ReplicaSets and StatefulSets for GPU workloads suspended
+// or scaled to zero and resumed.
+func (s *Scheduler) startResumeWatch(informerFactory informers.SharedInformerFactory) {
+	klog.InfoS("Holding the GPU capacity of resumed workloads", "ttl", config.ResumeReservationTTL)
+	informerFactory.Batch().V1().Jobs().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj any) {
+			oldJob, ok1 := oldObj.(*batchv1.Job)
+			newJob, ok2 := newObj.(*batchv1.Job)
+			if ok1 && ok2 {
+				s.onWorkloadUpdate(jobWorkload(oldJob), jobWorkload(newJob))
+			}
+		},
+		DeleteFunc: s.onWorkloadDelete,
+	})
+	informerFactory.Apps().V1().ReplicaSets().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj any) {
+			oldRS, ok1 := oldObj.(*appsv1.ReplicaSet)
+			newRS, ok2 := newObj.(*appsv1.ReplicaSet)
+			if ok1 && ok2 && !deploymentOwned(newRS) {
+				s.onWorkloadUpdate(replicaSetWorkload(oldRS), replicaSetWorkload(newRS))
+			}
+		},
+		DeleteFunc: s.onWorkloadDelete,
+	})
+	informerFactory.Apps().V1().StatefulSets().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj any) {
+			oldSS, ok1 := oldObj.(*appsv1.StatefulSet)
+			newSS, ok2 := newObj.(*appsv1.StatefulSet)
+			if ok1 && ok2 {
+				s.onWorkloadUpdate(statefulSetWorkload(oldSS), statefulSetWorkload(newSS))
+			}
+		},
+		DeleteFunc: s.onWorkloadDelete,
+	})
+}
+
+// onWorkloadUpdate drops the capacity held for a GPU workload suspended or scaled to zero,
+// whose pods release their devices as they terminate, and holds it again for the pods of a
+// workload resumed. Only a Job unsuspended, or a workload seen scaling to zero before, is
+// resumed: a workload created with zero pods and scaled up is just starting.
+func (s *Scheduler) onWorkloadUpdate(oldW, newW gpuWorkload) {
+	switch {
+	case oldW.active > 0 && newW.active == 0:
+		if !newW.requestsDevices() {
+			return
+		}
+		klog.InfoS("GPU workload suspended, its devices are released as its pods terminate", "kind", newW.kind, "workload", klog.KObj(newW.obj))
+		if token := s.resumes.forget(newW.obj.GetUID()); token != "" {
+			s.ReleaseReservation(token)
+		}
+		s.resumes.scaleDown(newW.obj.GetUID())
+	case oldW.active == 0 && newW.active > 0:
+		resumed := s.resumes.scaleUp(newW.obj.GetUID()) || oldW.suspended
+		if resumed && newW.requestsDevices() {
+			s.reserveResumed(newW)
+		}
+	}
+}
+
+// onWorkloadDelete drops the capacity held for a workload deleted.
+func (s *Scheduler) onWorkloadDelete(obj any) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	meta, ok := obj.(metav1.Object)
+	if !ok {
+		return
+	}
+	if token := s.resumes.forget(meta.GetUID()); token != "" {
+		s.ReleaseReservation(token)
+	}
+}
+
+// reserveResumed holds the devices of the pods of the resumed workload w for
+// config.ResumeReservationTTL, if they all fit. It is best effort: the pods get other cards
+// than before the suspension, or none if the capacity was taken meanwhile.
+func (s *Scheduler) reserveResumed(w gpuWorkload) {
+	n := int(w.active)
+	if n > MaxBatchPlanPods {
+		klog.InfoS("Holding the capacity of part of the pods of a resumed workload", "kind", w.kind, "workload", klog.KObj(w.obj), "pods", n, "held", MaxBatchPlanPods)
+		n = MaxBatchPlanPods
+	}
+	pods := make([]corev1.PodTemplateSpec, n)
+	for i := range pods {
+		pods[i] = *w.template.DeepCopy()
+		pods[i].Namespace = w.obj.GetNamespace()
+		pods[i].Name = fmt.Sprintf("%s-%d", w.obj.GetName(), i)
+	}
+	token := w.resumeToken()
+	res, err := s.reserve(ReservationRequest{Token: token, Pods: pods}, config.ResumeReservationTTL)
+	if err != nil {
+		klog.ErrorS(err, "Failed to hold the capacity of a resumed workload", "kind", w.kind, "workload", klog.KObj(w.obj))
+		return
+	}
+	if !res.Held {
+		reasons := make([]string, 0)
+		for _, p := range res.Pods {
+			if !p.Fit {
+				reasons = append(reasons, fmt.Sprintf("%s: %s", p.Name, p.Reason))
+			}
+		}
+		klog.InfoS("Capacity of a resumed workload not held, not every pod fits", "kind", w.kind, "workload", klog.KObj(w.obj), "reasons", reasons)
+		if s.eventRecorder != nil {
+			s.eventRecorder.Eventf(w.obj, corev1.EventTypeWarning, EventReasonGPUCapacityNotReserved, "The GPU capacity of the %d pods isn't held, not every pod fits: %s", n, strings.Join(reasons, "; "))
+		}
+		return
+	}
+	if old := s.resumes.forget(w.obj.GetUID()); old != "" && old != token {
+		s.ReleaseReservation(old)
+	}
+	s.resumes.set(w.obj.GetUID(), token)
+	if s.eventRecorder != nil {
+		s.eventRecorder.Eventf(w.obj, corev1.EventTypeNormal, EventReasonGPUCapacityReserved, "The GPU capacity of %d pods is held until %s", n, res.Expires.Format("15:04:05"))
+	}
+}
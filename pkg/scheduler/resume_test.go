@@ -0,0 +1,179 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func int32p(v int32) *int32 {
+	return &v
+}
+
+func Test_jobWorkload(t *testing.T) {
+	job := func(suspend bool, parallelism, completions *int32, succeeded int32) *batchv1.Job {
+		return &batchv1.Job{
+			Spec:   batchv1.JobSpec{Suspend: &suspend, Parallelism: parallelism, Completions: completions},
+			Status: batchv1.JobStatus{Succeeded: succeeded},
+		}
+	}
+	assert.Equal(t, jobWorkload(job(true, int32p(4), nil, 0)).active, int32(0))
+	assert.Equal(t, jobWorkload(job(false, nil, nil, 0)).active, int32(1))
+	assert.Equal(t, jobWorkload(job(false, int32p(4), nil, 0)).active, int32(4))
+	assert.Equal(t, jobWorkload(job(false, int32p(4), int32p(6), 3)).active, int32(3))
+	assert.Equal(t, jobWorkload(job(false, int32p(4), int32p(6), 7)).active, int32(0))
+}
+
+func Test_resumeReservation(t *testing.T) {
+	prev := device.ActiveConfig()
+	initTFLOPSDevices(t)
+	defer func() { assert.NilError(t, device.InitDevicesWithConfig(prev)) }()
+	prevTTL := config.ResumeReservationTTL
+	config.ResumeReservationTTL = time.Minute
+	defer func() { config.ResumeReservationTTL = prevTTL }()
+
+	s := NewScheduler()
+	s.addNode("node1", &util.NodeInfo{
+		ID:   "node1",
+		Node: &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}},
+		Devices: []util.DeviceInfo{{
+			ID: "node1-gpu", Count: 10, Devmem: 8000, Devcore: 100, Type: "NVIDIA-Tesla T4",
+			Health: true, DeviceVendor: nvidia.NvidiaGPUDevice,
+		}},
+	})
+	job := func(suspend bool, mem string) *batchv1.Job {
+		return &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "default", UID: "uid-train", Generation: 2},
+			Spec: batchv1.JobSpec{
+				Suspend:     &suspend,
+				Parallelism: int32p(2),
+				Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+					Name: "main",
+					Resources: corev1.ResourceRequirements{Limits: corev1.ResourceList{
+						"hami.io/gpu":    resource.MustParse("1"),
+						"hami.io/gpumem": resource.MustParse(mem),
+					}},
+				}}}},
+			},
+		}
+	}
+	controller := true
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "train-abcde", Namespace: "default", OwnerReferences: []metav1.OwnerReference{
+		{APIVersion: "batch/v1", Kind: "Job", Name: "train", UID: "uid-train", Controller: &controller},
+	}}}
+	held := func() int { return len(s.reservations.ListPodsInfo("", time.Now())) }
+
+	// Resuming holds the capacity of the pods, which their pods consume.
+	s.onWorkloadUpdate(jobWorkload(job(true, "3000")), jobWorkload(job(false, "3000")))
+	assert.Equal(t, held(), 2)
+	assert.Equal(t, s.podReservationToken(pod), "resume/job/default/train/2")
+	assert.Equal(t, len(s.reservations.ListPodsInfo(s.podReservationToken(pod), time.Now())), 0)
+	// An annotation of the pod wins.
+	annotated := pod.DeepCopy()
+	annotated.Annotations = map[string]string{util.Reservation: "other"}
+	assert.Equal(t, s.podReservationToken(annotated), "other")
+
+	// Suspending drops what is left.
+	s.onWorkloadUpdate(jobWorkload(job(false, "3000")), jobWorkload(job(true, "3000")))
+	assert.Equal(t, held(), 0)
+	assert.Equal(t, s.podReservationToken(pod), "")
+
+	// Nothing is held if not every pod fits.
+	s.onWorkloadUpdate(jobWorkload(job(true, "5000")), jobWorkload(job(false, "5000")))
+	assert.Equal(t, held(), 0)
+	assert.Equal(t, s.podReservationToken(pod), "")
+
+	// Deleting a workload drops its capacity.
+	s.onWorkloadUpdate(jobWorkload(job(true, "3000")), jobWorkload(job(false, "3000")))
+	assert.Equal(t, held(), 2)
+	s.onWorkloadDelete(job(false, "3000"))
+	assert.Equal(t, held(), 0)
+
+	// Workloads without devices are left alone.
+	plain := job(false, "3000")
+	plain.Spec.Template.Spec.Containers[0].Resources = corev1.ResourceRequirements{}
+	suspended := job(true, "3000")
+	suspended.Spec.Template = plain.Spec.Template
+	s.onWorkloadUpdate(jobWorkload(suspended), jobWorkload(plain))
+	assert.Equal(t, held(), 0)
+}
+
+func Test_resumeScaledWorkloads(t *testing.T) {
+	prev := device.ActiveConfig()
+	initTFLOPSDevices(t)
+	defer func() { assert.NilError(t, device.InitDevicesWithConfig(prev)) }()
+	prevTTL := config.ResumeReservationTTL
+	config.ResumeReservationTTL = time.Minute
+	defer func() { config.ResumeReservationTTL = prevTTL }()
+
+	s := NewScheduler()
+	s.addNode("node1", &util.NodeInfo{
+		ID:   "node1",
+		Node: &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}},
+		Devices: []util.DeviceInfo{{
+			ID: "node1-gpu", Count: 10, Devmem: 8000, Devcore: 100, Type: "NVIDIA-Tesla T4",
+			Health: true, DeviceVendor: nvidia.NvidiaGPUDevice,
+		}},
+	})
+	rs := func(replicas int32) *appsv1.ReplicaSet {
+		return &appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "serve", Namespace: "default", UID: "uid-serve", Generation: 1},
+			Spec: appsv1.ReplicaSetSpec{
+				Replicas: &replicas,
+				Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+					Name: "main",
+					Resources: corev1.ResourceRequirements{Limits: corev1.ResourceList{
+						"hami.io/gpu":    resource.MustParse("1"),
+						"hami.io/gpumem": resource.MustParse("1000"),
+					}},
+				}}}},
+			},
+		}
+	}
+	held := func() int { return len(s.reservations.ListPodsInfo("", time.Now())) }
+
+	// A ReplicaSet created with zero replicas and scaled up is starting, not resuming.
+	s.onWorkloadUpdate(replicaSetWorkload(rs(0)), replicaSetWorkload(rs(2)))
+	assert.Equal(t, held(), 0)
+
+	// Scaled to zero and back it resumes, once.
+	s.onWorkloadUpdate(replicaSetWorkload(rs(2)), replicaSetWorkload(rs(0)))
+	s.onWorkloadUpdate(replicaSetWorkload(rs(0)), replicaSetWorkload(rs(2)))
+	assert.Equal(t, held(), 2)
+	s.onWorkloadDelete(rs(2))
+	s.onWorkloadUpdate(replicaSetWorkload(rs(0)), replicaSetWorkload(rs(2)))
+	assert.Equal(t, held(), 0)
+
+	controller := true
+	owned := rs(0)
+	owned.OwnerReferences = []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "Deployment", Name: "serve", UID: "uid-deploy", Controller: &controller}}
+	assert.Equal(t, deploymentOwned(owned), true)
+	assert.Equal(t, deploymentOwned(rs(0)), false)
+}
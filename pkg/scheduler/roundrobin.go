@@ -0,0 +1,113 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/policy"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// cardRoundRobin keeps the state of the smooth weighted round-robin of the roundrobin GPU policy:
+// every placement on a node adds the free memory of each of its cards to the current weight of
+// the card and takes the sum of them off the cards chosen, so cards take turns in proportion to
+// their free memory instead of the pods piling onto the card scoring best at the moment.
+type cardRoundRobin struct {
+	mutex   sync.Mutex
+	current map[string]map[string]float64
+}
+
+func newCardRoundRobin() *cardRoundRobin {
+	return &cardRoundRobin{current: make(map[string]map[string]float64)}
+}
+
+// snapshot returns a copy of the current weights of the cards of nodeID.
+func (r *cardRoundRobin) snapshot(nodeID string) map[string]float64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	res := make(map[string]float64, len(r.current[nodeID]))
+	for id, w := range r.current[nodeID] {
+		res[id] = w
+	}
+	return res
+}
+
+// placed advances the round of nodeID for the cards of devices, which were chosen among cards
+// with the free memory of weights. Every card chosen is one turn of the round.
+func (r *cardRoundRobin) placed(nodeID string, weights map[string]float64, devices util.PodDevices) {
+	if len(weights) == 0 {
+		return
+	}
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	prev := r.current[nodeID]
+	// Cards gone from the node are dropped.
+	current := make(map[string]float64, len(weights))
+	for id := range weights {
+		current[id] = prev[id]
+	}
+	for _, podSingle := range devices {
+		for _, ctrdevs := range podSingle {
+			for _, udevice := range ctrdevs {
+				id := strings.Split(udevice.UUID, "[")[0]
+				if _, ok := current[id]; !ok {
+					continue
+				}
+				for card, w := range weights {
+					current[card] += w
+				}
+				current[id] -= total
+			}
+		}
+	}
+	r.current[nodeID] = current
+}
+
+// roundRobinWeights returns the free memory of every card of node in MiB.
+func roundRobinWeights(node *NodeUsage) map[string]float64 {
+	weights := make(map[string]float64, len(node.Devices.DeviceLists))
+	for _, d := range node.Devices.DeviceLists {
+		weights[d.Device.ID] = float64(max(d.Device.Totalmem-d.Device.Usedmem, 0)) / float64(util.MiB)
+	}
+	return weights
+}
+
+// scoreRoundRobin replaces the scores of the cards of node by their priority in the round, on
+// the scale of the usage scores so the soft preferences keep their weight. The free memory the
+// first container of the pod was placed with is kept for advancing the round.
+func scoreRoundRobin(node *NodeUsage) {
+	weights := roundRobinWeights(node)
+	if node.roundRobinWeights == nil {
+		node.roundRobinWeights = weights
+	}
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	for _, d := range node.Devices.DeviceLists {
+		d.Score = 0
+		if total > 0 {
+			d.Score = float32(3 * float64(policy.Weight) * (node.roundRobin[d.Device.ID] + weights[d.Device.ID]) / total)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	listerscorev1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	extenderv1 "k8s.io/kube-scheduler/extender/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/policy"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+	"github.com/Project-HAMi/HAMi/pkg/util/client"
+)
+
+func Test_cardRoundRobin(t *testing.T) {
+	r := newCardRoundRobin()
+	weights := map[string]float64{"GPU-0": 2, "GPU-1": 1}
+	on := func(id string) util.PodDevices {
+		return util.PodDevices{nvidia.NvidiaGPUDevice: {{{UUID: id}}}}
+	}
+	r.placed("node1", weights, on("GPU-0"))
+	assert.DeepEqual(t, r.snapshot("node1"), map[string]float64{"GPU-0": -1, "GPU-1": 1})
+	r.placed("node1", weights, on("GPU-1[1g.10gb]"))
+	assert.DeepEqual(t, r.snapshot("node1"), map[string]float64{"GPU-0": 1, "GPU-1": -1})
+	// A card gone from the node is dropped, and other policies don't advance the round.
+	r.placed("node1", map[string]float64{"GPU-0": 2}, on("GPU-0"))
+	assert.DeepEqual(t, r.snapshot("node1"), map[string]float64{"GPU-0": 1})
+	r.placed("node1", nil, on("GPU-0"))
+	assert.DeepEqual(t, r.snapshot("node1"), map[string]float64{"GPU-0": 1})
+}
+
+// placeRoundRobin filters pods of mem MiB with the roundrobin GPU policy onto a node with cards
+// of the memories, and counts the pods placed on every card.
+func placeRoundRobin(t *testing.T, pods int, mem int64, memories ...int32) map[string]int {
+	prev := device.ActiveConfig()
+	initTFLOPSDevices(t)
+	defer func() { assert.NilError(t, device.InitDevicesWithConfig(prev)) }()
+	fakeClient := fake.NewSimpleClientset()
+	client.KubeClient = fakeClient
+	s := NewScheduler()
+	s.kubeClient = fakeClient
+	s.eventRecorder = record.NewFakeRecorder(1000)
+	podIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	s.podLister = listerscorev1.NewPodLister(podIndexer)
+	info := &util.NodeInfo{ID: "node1", Node: &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}}
+	for i, m := range memories {
+		info.Devices = append(info.Devices, util.DeviceInfo{
+			ID: fmt.Sprintf("GPU-%d", i), Index: uint(i), Count: 100, Devmem: m, Devcore: 100,
+			Type: nvidia.NvidiaGPUDevice, DeviceVendor: nvidia.NvidiaGPUDevice, Health: true,
+		})
+	}
+	s.addNode("node1", info)
+
+	counts := make(map[string]int)
+	for i := 0; i < pods; i++ {
+		pod := fairnessTestPod(fmt.Sprintf("shared-%d", i), mem)
+		pod.Annotations = map[string]string{policy.GPUSchedulerPolicyAnnotationKey: util.GPUSchedulerPolicyRoundRobin.String()}
+		assert.NilError(t, podIndexer.Add(pod))
+		_, err := fakeClient.CoreV1().Pods(pod.Namespace).Create(context.Background(), pod, metav1.CreateOptions{})
+		assert.NilError(t, err)
+		res, err := s.Filter(extenderv1.ExtenderArgs{Pod: pod, NodeNames: &[]string{"node1"}})
+		assert.NilError(t, err)
+		assert.Assert(t, res.NodeNames != nil, "pod %d not placed", i)
+		pi, ok := s.getPod(pod.UID)
+		assert.Assert(t, ok)
+		counts[pi.Devices[nvidia.NvidiaGPUDevice][0][0].UUID]++
+	}
+	return counts
+}
+
+func Test_roundRobinDistribution(t *testing.T) {
+	// Identical pods take turns on identical cards.
+	counts := placeRoundRobin(t, 12, 1000, 16000, 16000, 16000, 16000)
+	assert.DeepEqual(t, counts, map[string]int{"GPU-0": 3, "GPU-1": 3, "GPU-2": 3, "GPU-3": 3})
+
+	// A card with twice the free memory takes about twice the pods.
+	counts = placeRoundRobin(t, 12, 1000, 32000, 16000)
+	assert.DeepEqual(t, counts, map[string]int{"GPU-0": 8, "GPU-1": 4})
+}
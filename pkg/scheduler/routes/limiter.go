@@ -0,0 +1,97 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/metrics"
+)
+
+const (
+	rejectReasonQueueFull = "queue_full"
+	rejectReasonTimeout   = "timeout"
+)
+
+// Limiter bounds the number of extender requests served concurrently. Requests beyond the
+// limit wait in a bounded queue; when the queue is full, or a request waited longer than the
+// timeout, it fails fast with 503 so kube-scheduler retries the pod later instead of timing out.
+type Limiter struct {
+	slots   chan struct{}
+	waiting chan struct{}
+	timeout time.Duration
+}
+
+// NewLimiter returns a limiter serving at most concurrency requests with up to queueSize
+// waiting. A concurrency of 0 or less disables limiting.
+func NewLimiter(concurrency, queueSize int, timeout time.Duration) *Limiter {
+	if concurrency <= 0 {
+		return &Limiter{}
+	}
+	return &Limiter{
+		slots:   make(chan struct{}, concurrency),
+		waiting: make(chan struct{}, max(queueSize, 0)+concurrency),
+		timeout: timeout,
+	}
+}
+
+// Limit wraps handle with the concurrency limit, labelling metrics with verb.
+func (l *Limiter) Limit(verb string, handle httprouter.Handle) httprouter.Handle {
+	if l.slots == nil {
+		return handle
+	}
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		select {
+		case l.waiting <- struct{}{}:
+		default:
+			l.reject(w, verb, rejectReasonQueueFull)
+			return
+		}
+		defer func() { <-l.waiting }()
+
+		metrics.ExtenderQueuedRequests.WithLabelValues(verb).Inc()
+		timer := time.NewTimer(l.timeout)
+		defer timer.Stop()
+		select {
+		case l.slots <- struct{}{}:
+			metrics.ExtenderQueuedRequests.WithLabelValues(verb).Dec()
+		case <-timer.C:
+			metrics.ExtenderQueuedRequests.WithLabelValues(verb).Dec()
+			l.reject(w, verb, rejectReasonTimeout)
+			return
+		case <-r.Context().Done():
+			metrics.ExtenderQueuedRequests.WithLabelValues(verb).Dec()
+			return
+		}
+		defer func() { <-l.slots }()
+
+		metrics.ExtenderInflightRequests.WithLabelValues(verb).Inc()
+		defer metrics.ExtenderInflightRequests.WithLabelValues(verb).Dec()
+		handle(w, r, ps)
+	}
+}
+
+func (l *Limiter) reject(w http.ResponseWriter, verb, reason string) {
+	metrics.ExtenderRejectedRequests.WithLabelValues(verb, reason).Inc()
+	klog.Warningf("Scheduler extender overloaded, rejecting %s request: %s", verb, reason)
+	w.Header().Set("Retry-After", "1")
+	http.Error(w, "scheduler extender is overloaded, retry later", http.StatusServiceUnavailable)
+}
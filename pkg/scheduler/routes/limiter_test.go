@@ -0,0 +1,92 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"gotest.tools/v3/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 10)
+	handle := func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+		started <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}
+	limiter := NewLimiter(1, 1, 200*time.Millisecond)
+	limited := limiter.Limit("test", handle)
+	serve := func() int {
+		rec := httptest.NewRecorder()
+		limited(rec, httptest.NewRequest(http.MethodPost, "/filter", nil), nil)
+		return rec.Code
+	}
+
+	var wg sync.WaitGroup
+	codes := make(chan int, 2)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		codes <- serve()
+	}()
+	<-started
+
+	// The second request waits in the queue until it times out, the third finds the queue full.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		codes <- serve()
+	}()
+	assert.Assert(t, waitFor(func() bool {
+		return len(limiter.waiting) == 2
+	}))
+	assert.Equal(t, serve(), http.StatusServiceUnavailable)
+
+	assert.Equal(t, <-codes, http.StatusServiceUnavailable)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, <-codes, http.StatusOK)
+	assert.Equal(t, len(limiter.waiting), 0)
+	assert.Equal(t, len(limiter.slots), 0)
+}
+
+func TestLimiterDisabled(t *testing.T) {
+	called := false
+	handle := func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+		called = true
+	}
+	NewLimiter(0, 0, time.Second).Limit("disabled", handle)(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/filter", nil), nil)
+	assert.Assert(t, called)
+}
+
+func waitFor(cond func() bool) bool {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return false
+}
@@ -19,9 +19,11 @@ package routes
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 
 	"github.com/julienschmidt/httprouter"
 	"k8s.io/apimachinery/pkg/types"
@@ -29,6 +31,7 @@ import (
 	extenderv1 "k8s.io/kube-scheduler/extender/v1"
 
 	"github.com/Project-HAMi/HAMi/pkg/scheduler"
+	"github.com/Project-HAMi/HAMi/pkg/util/health"
 )
 
 func checkBody(w http.ResponseWriter, r *http.Request) {
@@ -139,9 +142,252 @@ func WebHookRoute() httprouter.Handle {
 	}
 }
 
-func HealthzRoute() httprouter.Handle {
+// HealthzRoute serves the liveness checks of the scheduler.
+func HealthzRoute(checks ...health.Check) httprouter.Handle {
+	h := health.Handler("healthz", checks...)
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-		klog.Infoln("Health check endpoint hit")
+		h(w, r)
+	}
+}
+
+// ReadyzRoute serves the readiness checks of the scheduler and its webhook.
+func ReadyzRoute(checks ...health.Check) httprouter.Handle {
+	h := health.Handler("readyz", checks...)
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		h(w, r)
+	}
+}
+
+// DevicePluginsRoute serves the handshake state of the device plugins on all nodes. It answers
+// with 503 if any plugin missed its registration, so it can be monitored, but it is not part of
+// the readiness of the scheduler, which must not depend on every node.
+func DevicePluginsRoute(s *scheduler.Scheduler) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		heartbeats, err := s.PluginHeartbeats()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		response, err := json.Marshal(heartbeats)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if scheduler.UnhealthyPlugins(heartbeats) != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		} else {
+			w.WriteHeader(http.StatusOK)
+		}
+		w.Write(response)
+	}
+}
+
+// PolicyRoute serves the scheduling policy the scheduler currently applies.
+func PolicyRoute(s *scheduler.Scheduler) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		policy, err := s.EffectivePolicy()
+		if err != nil {
+			klog.ErrorS(err, "Failed to collect the effective policy")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		response, err := json.Marshal(policy)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(response)
+	}
+}
+
+// UsageRoute serves the devices currently held by the pods of every cost center.
+func UsageRoute(s *scheduler.Scheduler) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		response, err := json.Marshal(s.CostCenterUsage())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(response)
+	}
+}
+
+// ConsistencyRoute audits the accounting of every node, repairing what it can if repair is set.
+func ConsistencyRoute(s *scheduler.Scheduler, repair bool) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		report, err := s.CheckConsistency(repair)
+		if err != nil {
+			klog.ErrorS(err, "Failed to audit the accounting consistency")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		response, err := json.Marshal(report)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(response)
+	}
+}
+
+// CardPodsRoute serves the pods, DRA claims and reservations holding a card of a node, to see
+// what cordoning the card affects.
+func CardPodsRoute(s *scheduler.Scheduler) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		pods, err := s.CardPods(ps.ByName("node"), ps.ByName("uuid"))
+		switch {
+		case errors.Is(err, scheduler.ErrCardNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		response, err := json.Marshal(pods)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(response)
+	}
+}
+
+// PlanRoute checks a batch of pod templates against the current capacity, placing every
+// pod on top of the ones before it.
+func PlanRoute(s *scheduler.Scheduler) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		var req scheduler.BatchPlanRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(req.Pods) > scheduler.MaxBatchPlanPods {
+			http.Error(w, fmt.Sprintf("batch holds %d pods, at most %d are allowed", len(req.Pods), scheduler.MaxBatchPlanPods), http.StatusRequestEntityTooLarge)
+			return
+		}
+		plan, err := s.PlanBatch(req)
+		if err != nil {
+			klog.ErrorS(err, "Failed to plan pod batch")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		response, err := json.Marshal(plan)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(response)
+	}
+}
+
+// ReserveRoute holds the capacity of a batch of pods about to be created, if all of them fit.
+func ReserveRoute(s *scheduler.Scheduler) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		var req scheduler.ReservationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		reservation, err := s.Reserve(req)
+		switch {
+		case errors.Is(err, scheduler.ErrInvalidReservation):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case errors.Is(err, scheduler.ErrReservationExists):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			klog.ErrorS(err, "Failed to reserve capacity", "token", req.Token)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		response, err := json.Marshal(reservation)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(response)
+	}
+}
+
+// ReleaseReservationRoute drops the capacity still held by a reservation.
+func ReleaseReservationRoute(s *scheduler.Scheduler) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		token := ps.ByName("token")
+		if !s.ReleaseReservation(token) {
+			http.Error(w, fmt.Sprintf("no reservation held for token %s", token), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// DecisionRoute serves the recorded scheduling decision of the pod with the given UID.
+func DecisionRoute(s *scheduler.Scheduler) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		uid := ps.ByName("uid")
+		decision, ok := s.Decision(types.UID(uid))
+		if !ok {
+			http.Error(w, fmt.Sprintf("no scheduling decision recorded for pod %s", uid), http.StatusNotFound)
+			return
+		}
+		response, err := json.Marshal(decision)
+		if err != nil {
+			klog.ErrorS(err, "Failed to marshal scheduling decision", "uid", uid)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(response)
+	}
+}
+
+// DecisionReportRoute serves the report of the scheduling decision of the pod with the given UID
+// as a file to download, with the namespaces and label values redacted if ?redact=true.
+func DecisionReportRoute(s *scheduler.Scheduler) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		uid := ps.ByName("uid")
+		redact := false
+		if v := r.URL.Query().Get("redact"); v != "" {
+			var err error
+			if redact, err = strconv.ParseBool(v); err != nil {
+				http.Error(w, fmt.Sprintf("invalid redact %q", v), http.StatusBadRequest)
+				return
+			}
+		}
+		report, ok, err := s.DecisionReport(types.UID(uid), redact)
+		if err != nil {
+			klog.ErrorS(err, "Failed to build scheduling decision report", "uid", uid)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, fmt.Sprintf("no scheduling decision recorded for pod %s", uid), http.StatusNotFound)
+			return
+		}
+		response, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			klog.ErrorS(err, "Failed to marshal scheduling decision report", "uid", uid)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"hami-decision-%s.json\"", uid))
 		w.WriteHeader(http.StatusOK)
+		w.Write(response)
 	}
 }
@@ -0,0 +1,41 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// validateScaleDownCheckpoint checks the hami.io/scale-down-checkpoint annotations of a pod.
+func validateScaleDownCheckpoint(annos map[string]string) error {
+	v, ok := annos[util.ScaleDownCheckpoint]
+	if ok && v != "true" && v != "false" {
+		return fmt.Errorf("annotation %s must be \"true\" or \"false\", got %q", util.ScaleDownCheckpoint, v)
+	}
+	if g, ok := annos[util.ScaleDownGrace]; ok {
+		if d, err := time.ParseDuration(g); err != nil || d <= 0 {
+			return fmt.Errorf("annotation %s must be a positive duration, got %q", util.ScaleDownGrace, g)
+		}
+	}
+	if _, own := annos[util.SafeToEvict]; own && v == "true" {
+		return fmt.Errorf("annotation %s can't be combined with %s, which it manages", util.ScaleDownCheckpoint, util.SafeToEvict)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func Test_validateScaleDownCheckpoint(t *testing.T) {
+	for _, annos := range []map[string]string{
+		nil,
+		{util.ScaleDownCheckpoint: "true"},
+		{util.ScaleDownCheckpoint: "true", util.ScaleDownGrace: "30m"},
+		{util.ScaleDownCheckpoint: "false", util.SafeToEvict: "false"},
+	} {
+		assert.NilError(t, validateScaleDownCheckpoint(annos), annos)
+	}
+	for _, annos := range []map[string]string{
+		{util.ScaleDownCheckpoint: "yes"},
+		{util.ScaleDownCheckpoint: "true", util.ScaleDownGrace: "later"},
+		{util.ScaleDownCheckpoint: "true", util.ScaleDownGrace: "-1m"},
+		{util.ScaleDownCheckpoint: "true", util.SafeToEvict: "true"},
+	} {
+		assert.Assert(t, validateScaleDownCheckpoint(annos) != nil, annos)
+	}
+}
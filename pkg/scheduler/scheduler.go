@@ -18,15 +18,20 @@ package scheduler
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	listerscorev1 "k8s.io/client-go/listers/core/v1"
@@ -35,12 +40,15 @@ import (
 	"k8s.io/klog/v2"
 	extenderv1 "k8s.io/kube-scheduler/extender/v1"
 
+	"github.com/Project-HAMi/HAMi/pkg/audit"
 	"github.com/Project-HAMi/HAMi/pkg/device"
 	"github.com/Project-HAMi/HAMi/pkg/k8sutil"
 	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/metrics"
 	"github.com/Project-HAMi/HAMi/pkg/scheduler/policy"
 	"github.com/Project-HAMi/HAMi/pkg/util"
 	"github.com/Project-HAMi/HAMi/pkg/util/client"
+	"github.com/Project-HAMi/HAMi/pkg/util/nodelock"
 )
 
 type Scheduler struct {
@@ -58,6 +66,48 @@ type Scheduler struct {
 	overviewstatus map[string]*NodeUsage
 
 	eventRecorder record.EventRecorder
+	auditor       *audit.Recorder
+	sticky        *stickyManager
+	// profiles are the HAMi policies of kube-scheduler profiles, keyed by scheduler name.
+	profiles map[string]Profile
+	// policyMutex is held for reading by every scheduling cycle and for writing while the policy
+	// file is applied, so no cycle sees a policy half reloaded.
+	policyMutex sync.RWMutex
+	// policyBase is the policy of the flags, which the policy file is applied on top of.
+	policyBase *schedulingPolicy
+	// policyData is the content of the policy file read last.
+	policyData []byte
+	policyFile PolicyFileStatus
+	// decisions keeps the recent scheduling decisions for the debug endpoint.
+	decisions *decisionCache
+	// draClaims accounts for the devices of allocated ResourceClaims, keyed by claim UID.
+	draClaims *podManager
+	// fairness ages the pods waiting for devices, nil unless FairnessAgingWeight is set.
+	fairness *fairnessTracker
+	// reclaim tracks the pods which evicted others to free GPUs, nil unless GPUReclaim is set.
+	reclaim *reclaimTracker
+	// locks defers the release of the node locks of failed binds, nil unless NodeLockCoalesceWindow is set.
+	locks *lockCoalescer
+	// resources publishes node extended resources, nil unless NodeExtendedResources is set.
+	resources *resourceExporter
+	// allocations publishes GPUAllocation objects, nil unless GPUAllocationCRD is set.
+	allocations *allocationMirror
+	// dynamicClient writes the GPUAllocation objects.
+	dynamicClient dynamic.Interface
+	// reservations hold the capacity of pods about to be created.
+	reservations *reservationManager
+	// resumes remembers the capacity held for resumed workloads, nil unless ResumeReservationTTL is set.
+	resumes *resumeTracker
+	// roundRobin keeps the round of the cards of every node for the roundrobin GPU policy.
+	roundRobin *cardRoundRobin
+	// gpuHealth remembers the nodes without healthy GPU, to report them once.
+	gpuHealth *gpuHealthTracker
+	// pluginVersions remembers the nodes with an incompatible device plugin, to report them once.
+	pluginVersions *pluginVersionTracker
+	// filterRecords writes every filter request for replay, nil unless OpenFilterRecords was called.
+	filterRecords *filterRecorder
+	// synced is set once the node devices were registered for the first time.
+	synced atomic.Bool
 }
 
 func NewScheduler() *Scheduler {
@@ -69,6 +119,19 @@ func NewScheduler() *Scheduler {
 	}
 	s.nodeManager = newNodeManager()
 	s.podManager = newPodManager()
+	s.draClaims = newPodManager()
+	s.sticky = newStickyManager()
+	s.decisions = newDecisionCache(config.DecisionCacheSize)
+	s.fairness = newFairnessTracker(config.FairnessAgingWeight)
+	s.reclaim = newReclaimTracker(config.GPUReclaim)
+	s.locks = newLockCoalescer(config.NodeLockCoalesceWindow)
+	s.resources = newResourceExporter(config.NodeExtendedResources)
+	s.allocations = newAllocationMirror(config.GPUAllocationCRD)
+	s.reservations = newReservationManager()
+	s.resumes = newResumeTracker(config.ResumeReservationTTL > 0)
+	s.gpuHealth = newGPUHealthTracker()
+	s.pluginVersions = newPluginVersionTracker()
+	s.roundRobin = newCardRoundRobin()
 	klog.V(2).InfoS("Scheduler initialized successfully")
 	return s
 }
@@ -92,11 +155,13 @@ func (s *Scheduler) onAddPod(obj any) {
 		return
 	}
 	if k8sutil.IsPodInTerminatedState(pod) {
-		s.delPod(pod)
+		s.releasePod(pod)
 		return
 	}
 	podDev, _ := util.DecodePodDevices(util.SupportDevices, pod.Annotations)
 	s.addPod(pod, nodeID, podDev)
+	s.resources.changed()
+	s.allocations.changed()
 }
 
 func (s *Scheduler) onUpdatePod(_, newObj any) {
@@ -109,19 +174,42 @@ func (s *Scheduler) onDelPod(obj any) {
 		klog.Errorf("unknown add object type")
 		return
 	}
+	s.fairness.forget(pod.UID)
+	s.reclaim.forget(pod.UID)
 	_, ok = pod.Annotations[util.AssignedNodeAnnotations]
 	if !ok {
 		return
 	}
+	s.releasePod(pod)
+	if err := util.ReleaseDevicesOverflow(pod); err != nil {
+		klog.ErrorS(err, "Failed to release the overflowed device annotations", "pod", klog.KObj(pod))
+	}
+}
+
+// releasePod drops the pod from accounting and records a release audit event
+// if the pod was holding devices. Only bound pods were recorded as allocated, a
+// pod whose bind failed releases nothing.
+func (s *Scheduler) releasePod(pod *corev1.Pod) {
+	pi, ok := s.getPod(pod.UID)
 	s.delPod(pod)
+	s.sticky.release(pod)
+	s.resources.changed()
+	s.allocations.changed()
+	if ok && pod.Spec.NodeName != "" {
+		s.auditor.Record(audit.NewAllocationEvent(audit.EventReleased, pod, pi.NodeID, pi.Devices))
+	}
 }
 
 func (s *Scheduler) Start() {
 	klog.InfoS("Starting HAMi scheduler components")
 	s.kubeClient = client.GetClient()
+	s.dynamicClient = client.GetDynamicClient()
 	informerFactory := informers.NewSharedInformerFactoryWithOptions(s.kubeClient, time.Hour*1)
 	s.podLister = informerFactory.Core().V1().Pods().Lister()
 	s.nodeLister = informerFactory.Core().V1().Nodes().Lister()
+	// The auditor runs before the pod handlers are added, so the releases seen while the
+	// informers sync are recorded too.
+	s.startAuditor()
 
 	informerFactory.Core().V1().Pods().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc:    s.onAddPod,
@@ -133,13 +221,40 @@ func (s *Scheduler) Start() {
 		UpdateFunc: func(_, _ any) { s.doNodeNotify() },
 		DeleteFunc: func(_ any) { s.doNodeNotify() },
 	})
+	if config.EnableDRA {
+		s.startDRAWatch()
+	}
+	if s.resumes != nil {
+		s.startResumeWatch(informerFactory)
+	}
 	informerFactory.Start(s.stopCh)
 	informerFactory.WaitForCacheSync(s.stopCh)
 	s.addAllEventHandlers()
+	go s.WatchAllocationDrift()
+	go s.WatchNodeExtendedResources()
+	go s.WatchGPUAllocations()
+	go s.WatchGPUReclaims()
+}
+
+func (s *Scheduler) startAuditor() {
+	auditor, err := audit.Start(audit.SourceScheduler, audit.Config{
+		SinkURL:    config.AuditSinkURL,
+		SinkType:   config.AuditSinkType,
+		KafkaTopic: config.AuditKafkaTopic,
+		BufferSize: config.AuditBufferSize,
+		SpoolPath:  config.AuditSpoolPath,
+	}, s.stopCh)
+	if err != nil {
+		klog.ErrorS(err, "Failed to start the audit recorder, allocation auditing disabled")
+		return
+	}
+	s.auditor = auditor
 }
 
 func (s *Scheduler) Stop() {
 	close(s.stopCh)
+	s.locks.flush()
+	s.filterRecords.close()
 }
 
 func (s *Scheduler) RegisterFromNodeAnnotations() {
@@ -219,8 +334,12 @@ func (s *Scheduler) RegisterFromNodeAnnotations() {
 				}
 				nodeInfo.Devices = make([]util.DeviceInfo, 0)
 				for _, deviceinfo := range nodedevices {
+					if deviceinfo.DeviceVendor == "" {
+						deviceinfo.DeviceVendor = devhandsk
+					}
 					nodeInfo.Devices = append(nodeInfo.Devices, *deviceinfo)
 				}
+				s.logDevmemChanges(val.Name, nodeInfo.Devices)
 				s.addNode(val.Name, nodeInfo)
 				if s.nodes[val.Name] != nil && len(nodeInfo.Devices) > 0 {
 					if printedLog[val.Name] {
@@ -232,9 +351,32 @@ func (s *Scheduler) RegisterFromNodeAnnotations() {
 				}
 			}
 		}
+		s.policyMutex.RLock()
 		_, _, err = s.getNodesUsage(&nodeNames, nil)
+		s.policyMutex.RUnlock()
 		if err != nil {
 			klog.ErrorS(err, "Failed to get node usage", "nodeNames", nodeNames)
+			continue
+		}
+		s.resources.changed()
+		s.allocations.changed()
+		if !s.synced.Swap(true) {
+			klog.InfoS("Node devices registered, scheduler is ready", "nodeCount", len(nodeNames))
+		}
+	}
+}
+
+// logDevmemChanges reports devices whose registered memory differs from the cached one.
+func (s *Scheduler) logDevmemChanges(nodeID string, devices []util.DeviceInfo) {
+	cached, err := s.GetNode(nodeID)
+	if err != nil {
+		return
+	}
+	for _, prev := range cached.Devices {
+		for _, cur := range devices {
+			if prev.ID == cur.ID && prev.Devmem != cur.Devmem {
+				klog.InfoS("Device total memory changed", "nodeName", nodeID, "deviceID", cur.ID, "previousMemory", prev.Devmem, "currentMemory", cur.Devmem)
+			}
 		}
 	}
 }
@@ -265,11 +407,28 @@ func (s *Scheduler) getNodesUsage(nodes *[]string, task *corev1.Pod) (*map[strin
 			}
 		}
 		nodeInfo.Node = node.Node
+		if node.Node != nil {
+			nodeInfo.idleLimits = k8sutil.NodeIdleMemoryLimits(node.Node)
+		}
 		nodeInfo.Devices = policy.DeviceUsageList{
 			Policy:      userGPUPolicy,
 			DeviceLists: make([]*policy.DeviceListsScore, 0),
 		}
 		for _, d := range node.Devices {
+			nodeInfo.cards++
+			if d.Health {
+				nodeInfo.healthyCards++
+			} else {
+				markCardUnhealthy(nodeInfo, d.ID)
+			}
+			if reason := eccUnhealthy(d.ECCErrors); reason != "" {
+				klog.V(4).InfoS("Card over the ECC error threshold, no new pods are placed on it", "node", node.ID, "device", d.ID, "reason", reason)
+				markCardUnhealthy(nodeInfo, d.ID)
+			}
+			if reason := tooHot(d.Temperature); reason != "" {
+				klog.V(4).InfoS("Card over the temperature threshold, no new pods are placed on it", "node", node.ID, "device", d.ID, "reason", reason)
+				markCardUnhealthy(nodeInfo, d.ID)
+			}
 			nodeInfo.Devices.DeviceLists = append(nodeInfo.Devices.DeviceLists, &policy.DeviceListsScore{
 				Score: 0,
 				Device: &util.DeviceUsage{
@@ -278,62 +437,80 @@ func (s *Scheduler) getNodesUsage(nodes *[]string, task *corev1.Pod) (*map[strin
 					Used:      0,
 					Count:     d.Count,
 					Usedmem:   0,
-					Totalmem:  d.Devmem,
+					Totalmem:  util.MemoryToBytes(d.DeviceVendor, int64(d.Devmem)),
 					Totalcore: d.Devcore,
 					Usedcores: 0,
 					MigUsage: util.MigInUse{
 						Index:     0,
 						UsageList: make(util.MIGS, 0),
 					},
-					MigTemplate: d.MIGTemplate,
-					Mode:        d.Mode,
-					Type:        d.Type,
-					Numa:        d.Numa,
-					Health:      d.Health,
+					MigTemplate:         d.MIGTemplate,
+					Mode:                d.Mode,
+					Type:                d.Type,
+					Numa:                d.Numa,
+					Health:              d.Health,
+					PCIeSwitch:          d.PCIeSwitch,
+					PerfTier:            d.PerfTier,
+					Utilization:         d.Utilization,
+					Quarantined:         d.Quarantined,
+					Draining:            d.Draining,
+					HeldExternally:      d.HeldExternally,
+					ConfidentialCompute: d.ConfidentialCompute,
+					Encoder:             d.Encoder,
+					MemoryType:          d.MemoryType,
+					DeviceKind:          d.DeviceKind,
+					MigGeometry:         d.MigGeometry,
+					ECCErrors:           d.ECCErrors,
+					PerformanceState:    d.PerformanceState,
+					Temperature:         d.Temperature,
 				},
 			})
 		}
 		overallnodeMap[node.ID] = nodeInfo
+		s.observeGPUHealth(nodeInfo)
 	}
 
 	podsInfo := s.ListPodsInfo()
+	if s.draClaims != nil {
+		podsInfo = append(podsInfo, s.draClaims.ListPodsInfo()...)
+	}
+	podsInfo = append(podsInfo, s.reservations.ListPodsInfo(reservationToken(task), time.Now())...)
 	for _, p := range podsInfo {
 		node, ok := overallnodeMap[p.NodeID]
 		if !ok {
 			continue
 		}
-		for _, podsingleds := range p.Devices {
-			for _, ctrdevs := range podsingleds {
-				for _, udevice := range ctrdevs {
-					for _, d := range node.Devices.DeviceLists {
-						deviceID := udevice.UUID
-						if strings.Contains(deviceID, "[") {
-							deviceID = strings.Split(deviceID, "[")[0]
-						}
-						if d.Device.ID == deviceID {
-							d.Device.Used++
-							d.Device.Usedmem += udevice.Usedmem
-							d.Device.Usedcores += udevice.Usedcores
-							if strings.Contains(udevice.UUID, "[") {
-								if strings.Compare(d.Device.Mode, "hami-core") == 0 {
-									klog.Errorf("found a mig task running on a hami-core GPU\n")
-									d.Device.Health = false
-									continue
-								}
-								tmpIdx, Instance, _ := util.ExtractMigTemplatesFromUUID(udevice.UUID)
-								if len(d.Device.MigUsage.UsageList) == 0 {
-									util.PlatternMIG(&d.Device.MigUsage, d.Device.MigTemplate, tmpIdx)
-								}
-								d.Device.MigUsage.UsageList[Instance].InUse = true
-								klog.V(5).Infoln("add mig usage", d.Device.MigUsage, "template=", d.Device.MigTemplate, "uuid=", d.Device.ID)
-							}
-						}
-					}
-				}
-			}
+		if p.MigShared {
+			addMigSharedUsage(node, p.Devices)
+		}
+		addPodUsage(node, p.Devices)
+		if p.Soft {
+			addSoftUsage(node, p)
+		}
+		if limit := idleMemoryLimit(node.idleLimits, p); limit > 0 {
+			addIdleUsage(node, p, limit)
+		}
+		if p.BandwidthHeavy {
+			addSwitchLoad(node, p.Devices)
 		}
+		if p.Encoder != "" {
+			addEncoderUsage(node, p.Devices, p.Encoder)
+		}
+		addNamespaceUsage(node, p.Devices, p.Namespace, p.NamespaceIsolated)
 		klog.V(5).Infof("usage: pod %v assigned %v %v", p.Name, p.NodeID, p.Devices)
 	}
+	for nodeID, node := range overallnodeMap {
+		for _, d := range node.Devices.DeviceLists {
+			// The advertised memory may shrink below what is already allocated, e.g. after ECC is enabled.
+			// Soft pods yield their memory, so they don't count.
+			if d.Device.Usedmem-d.Device.Softmem > oversubscribedMemory(d.Device.Totalmem) {
+				klog.Warningf("device %v on node %v is over-committed: used memory %v bytes exceeds total memory %v bytes, cordoning it", d.Device.ID, nodeID, d.Device.Usedmem, d.Device.Totalmem)
+				d.Device.Health = false
+				markCardUnhealthy(node, d.Device.ID)
+				s.recordDeviceCordonedEvent(node.Node, d.Device.ID, "used memory exceeds the memory the device plugin reports")
+			}
+		}
+	}
 	s.overviewstatus = overallnodeMap
 	for _, nodeID := range *nodes {
 		node, err := s.GetNode(nodeID)
@@ -349,6 +526,41 @@ func (s *Scheduler) getNodesUsage(nodes *[]string, task *corev1.Pod) (*map[strin
 	return &cachenodeMap, failedNodes, nil
 }
 
+// addPodUsage accounts the devices pd allocates on the cards of node.
+func addPodUsage(node *NodeUsage, pd util.PodDevices) {
+	for _, podsingleds := range pd {
+		for _, ctrdevs := range podsingleds {
+			for _, udevice := range ctrdevs {
+				for _, d := range node.Devices.DeviceLists {
+					deviceID := udevice.UUID
+					if strings.Contains(deviceID, "[") {
+						deviceID = strings.Split(deviceID, "[")[0]
+					}
+					if d.Device.ID == deviceID {
+						d.Device.Used++
+						d.Device.Usedmem += udevice.Usedmem
+						d.Device.Usedcores += udevice.Usedcores
+						d.Device.Allocations = append(d.Device.Allocations, udevice)
+						if strings.Contains(udevice.UUID, "[") {
+							if strings.Compare(d.Device.Mode, "hami-core") == 0 {
+								klog.Errorf("found a mig task running on a hami-core GPU\n")
+								d.Device.Health = false
+								continue
+							}
+							tmpIdx, Instance, _ := util.ExtractMigTemplatesFromUUID(udevice.UUID)
+							if len(d.Device.MigUsage.UsageList) == 0 {
+								util.PlatternMIG(&d.Device.MigUsage, d.Device.MigTemplate, tmpIdx)
+							}
+							d.Device.MigUsage.UsageList[Instance].InUse = true
+							klog.V(5).Infoln("add mig usage", d.Device.MigUsage, "template=", d.Device.MigTemplate, "uuid=", d.Device.ID)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
 func (s *Scheduler) getPodUsage() (map[string]PodUseDeviceStat, error) {
 	podUsageStat := make(map[string]PodUseDeviceStat)
 	pods, err := s.podLister.List(labels.NewSelector())
@@ -384,41 +596,118 @@ func (s *Scheduler) Bind(args extenderv1.ExtenderBindingArgs) (*extenderv1.Exten
 	klog.InfoS("Attempting to bind pod to node", "pod", args.PodName, "namespace", args.PodNamespace, "node", args.Node)
 	var res *extenderv1.ExtenderBindingResult
 
-	binding := &corev1.Binding{
-		ObjectMeta: metav1.ObjectMeta{Name: args.PodName, UID: args.PodUID},
-		Target:     corev1.ObjectReference{Kind: "Node", Name: args.Node},
+	// Every step is tried again while the API server is unreachable, until the deadline.
+	deadline := time.Now().Add(config.BindRetryBudget)
+	unreachableBackoff := config.BindRetryBackoff
+	var current *corev1.Pod
+	var err error
+	for {
+		current, err = s.kubeClient.CoreV1().Pods(args.PodNamespace).Get(context.Background(), args.PodName, metav1.GetOptions{})
+		if err == nil || !deferBindWrite(err, deadline, &unreachableBackoff) {
+			break
+		}
 	}
-	current, err := s.kubeClient.CoreV1().Pods(args.PodNamespace).Get(context.Background(), args.PodName, metav1.GetOptions{})
 	if err != nil {
 		klog.ErrorS(err, "Failed to get pod", "pod", args.PodName, "namespace", args.PodNamespace)
+		s.recordBindWriteFailed(nil, "get the pod", err)
 		return &extenderv1.ExtenderBindingResult{Error: err.Error()}, err
 	}
 	klog.InfoS("Trying to get the target node for pod", "pod", args.PodName, "namespace", args.PodNamespace, "node", args.Node)
-	node, err := s.kubeClient.CoreV1().Nodes().Get(context.Background(), args.Node, metav1.GetOptions{})
+	var node *corev1.Node
+	for {
+		node, err = s.kubeClient.CoreV1().Nodes().Get(context.Background(), args.Node, metav1.GetOptions{})
+		if err == nil || !deferBindWrite(err, deadline, &unreachableBackoff) {
+			break
+		}
+	}
 	if err != nil {
 		klog.ErrorS(err, "Failed to get node", "node", args.Node)
-		s.recordScheduleBindingResultEvent(current, EventReasonBindingFailed, []string{}, fmt.Errorf("failed to get node %s", args.Node))
+		if !s.recordBindWriteFailed(current, "get node "+args.Node, err) {
+			s.recordScheduleBindingResultEvent(current, EventReasonBindingFailed, []string{}, fmt.Errorf("failed to get node %s", args.Node))
+		}
 		res = &extenderv1.ExtenderBindingResult{Error: err.Error()}
 		return res, nil
 	}
+	// The plugin may have been replaced since the pod was filtered.
+	if reason := s.checkPluginVersion(node); reason != "" {
+		err = fmt.Errorf("node %s: %s", args.Node, reason)
+		s.recordScheduleBindingResultEvent(current, EventReasonBindingFailed, []string{}, err)
+		return &extenderv1.ExtenderBindingResult{Error: err.Error()}, nil
+	}
 
+	result := "success"
+	backoff := config.BindRetryBackoff
+	for attempt := 0; ; {
+		err = s.bindOnce(args, node, current)
+		if err == nil {
+			break
+		}
+		if !deferBindWrite(err, deadline, &unreachableBackoff) {
+			if attempt >= config.BindRetryCount || !isTransientBindError(err) {
+				metrics.BindResults.WithLabelValues("failed").Inc()
+				if !s.recordBindWriteFailed(current, "bind the pod to node "+args.Node, err) {
+					s.recordScheduleBindingResultEvent(current, EventReasonBindingFailed, []string{}, err)
+				}
+				return &extenderv1.ExtenderBindingResult{Error: err.Error()}, nil
+			}
+			attempt++
+			metrics.BindRetries.Inc()
+			klog.InfoS("Retrying transient bind failure", "pod", args.PodName, "namespace", args.PodNamespace, "node", args.Node, "attempt", attempt, "backoff", backoff, "err", err)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		result = "success_after_retry"
+		// A conflict means the pod changed meanwhile, so the next attempt starts from a fresh copy.
+		if p, gerr := s.kubeClient.CoreV1().Pods(args.PodNamespace).Get(context.Background(), args.PodName, metav1.GetOptions{}); gerr == nil {
+			current = p
+		}
+		if current.Spec.NodeName == args.Node {
+			// The binding of a previous attempt went through although its response was lost.
+			break
+		}
+	}
+
+	metrics.BindResults.WithLabelValues(result).Inc()
+	// The allocation is only recorded once the pod is bound, a failed bind allocates nothing.
+	if pi, ok := s.getPod(current.UID); ok {
+		s.auditor.Record(audit.NewAllocationEvent(audit.EventAllocated, current, pi.NodeID, pi.Devices))
+	}
+	s.recordScheduleBindingResultEvent(current, EventReasonBindingSucceed, []string{args.Node}, nil)
+	s.recordGPUMemoryPaddedEvent(current)
+	klog.InfoS("Successfully bound pod to node", "pod", args.PodName, "namespace", args.PodNamespace, "node", args.Node)
+	return &extenderv1.ExtenderBindingResult{Error: ""}, nil
+}
+
+// bindOnce locks the node, marks the pod as allocating and binds it. On failure the
+// node locks are released again, so the attempt can be repeated. A repeated attempt
+// within NodeLockCoalesceWindow keeps the locks of the previous one.
+func (s *Scheduler) bindOnce(args extenderv1.ExtenderBindingArgs, node *corev1.Node, current *corev1.Pod) error {
+	binding := &corev1.Binding{
+		ObjectMeta: metav1.ObjectMeta{Name: args.PodName, UID: args.PodUID},
+		Target:     corev1.ObjectReference{Kind: "Node", Name: args.Node},
+	}
 	tmppatch := map[string]string{
 		util.DeviceBindPhase:     "allocating",
 		util.BindTimeAnnotations: strconv.FormatInt(time.Now().Unix(), 10),
 	}
 
-	for _, val := range device.GetDevices() {
-		err = val.LockNode(node, current)
-		if err != nil {
-			klog.ErrorS(err, "Failed to lock node", "node", args.Node, "device", val)
-			goto ReleaseNodeLocks
+	var err error
+	locked := s.locks.take(args.Node, current)
+	if !locked {
+		for _, val := range device.GetDevices() {
+			err = val.LockNode(node, current)
+			if err != nil {
+				klog.ErrorS(err, "Failed to lock node", "node", args.Node, "device", val)
+				goto ReleaseNodeLocks
+			}
 		}
+		locked = true
 	}
 
 	err = util.PatchPodAnnotations(current, tmppatch)
 	if err != nil {
 		klog.ErrorS(err, "Failed to patch pod annotations", "pod", klog.KObj(current))
-		return &extenderv1.ExtenderBindingResult{Error: err.Error()}, err
+		goto ReleaseNodeLocks
 	}
 
 	err = s.kubeClient.CoreV1().Pods(args.PodNamespace).Bind(context.Background(), binding, metav1.CreateOptions{})
@@ -426,21 +715,80 @@ func (s *Scheduler) Bind(args extenderv1.ExtenderBindingArgs) (*extenderv1.Exten
 		klog.ErrorS(err, "Failed to bind pod", "pod", args.PodName, "namespace", args.PodNamespace, "node", args.Node)
 		goto ReleaseNodeLocks
 	}
-
-	s.recordScheduleBindingResultEvent(current, EventReasonBindingSucceed, []string{args.Node}, nil)
-	klog.InfoS("Successfully bound pod to node", "pod", args.PodName, "namespace", args.PodNamespace, "node", args.Node)
-	return &extenderv1.ExtenderBindingResult{Error: ""}, nil
+	return nil
 
 ReleaseNodeLocks:
 	klog.InfoS("Release node locks", "node", args.Node)
-	for _, val := range device.GetDevices() {
-		val.ReleaseNodeLock(node, current)
+	release := func() {
+		for _, val := range device.GetDevices() {
+			val.ReleaseNodeLock(node, current)
+		}
 	}
-	s.recordScheduleBindingResultEvent(current, EventReasonBindingFailed, []string{}, err)
-	return &extenderv1.ExtenderBindingResult{Error: err.Error()}, nil
+	if !locked {
+		// Not all locks were taken, so a retry has to lock the node again anyway.
+		release()
+		return err
+	}
+	s.locks.release(args.Node, current, release, func(next *corev1.Pod) bool {
+		return handOverNodeLock(args.Node, current, next)
+	})
+	return err
+}
+
+// isTransientBindError reports whether a failed bind attempt is worth repeating: the node
+// lock is held by another pod, the write conflicted, or the API server is briefly unavailable.
+func isTransientBindError(err error) bool {
+	return errors.Is(err, nodelock.ErrNodeLocked) ||
+		apierrors.IsConflict(err) ||
+		apierrors.IsServerTimeout(err) ||
+		apierrors.IsTimeout(err) ||
+		apierrors.IsTooManyRequests(err) ||
+		apierrors.IsServiceUnavailable(err)
 }
 
 func (s *Scheduler) Filter(args extenderv1.ExtenderArgs) (*extenderv1.ExtenderFilterResult, error) {
+	s.policyMutex.RLock()
+	res, write, err := s.filter(args)
+	s.policyMutex.RUnlock()
+	if write != nil {
+		// The write is deferred while the API server is unreachable, which mustn't hold off a
+		// policy reload for the whole retry budget.
+		err = util.EncodeDevicesAnnotations(args.Pod, write.nodeID, write.annotations, util.DevicesAnnotationEncoding{
+			Compact:           config.CompactDeviceAnnotations,
+			OverflowSize:      config.DeviceAnnotationOverflowSize,
+			OverflowNamespace: config.DeviceAnnotationOverflowNamespace,
+		})
+		if err == nil {
+			err = patchPodAnnotationsDeferred(args.Pod, write.annotations)
+		}
+		s.policyMutex.RLock()
+		res, err = s.assigned(args.Pod, write, err)
+		s.policyMutex.RUnlock()
+	}
+	if s.filterRecords != nil && args.Pod != nil {
+		var devices util.PodDevices
+		if pi, ok := s.getPod(args.Pod.UID); ok {
+			devices = pi.Devices
+		}
+		s.filterRecords.record(args.Pod, args.NodeNames, res, devices, err)
+	}
+	return res, err
+}
+
+// filterWrite is the device assignment the filter writes to the pod once it released the policy lock.
+type filterWrite struct {
+	nodeID      string
+	node        *corev1.Node
+	annotations map[string]string
+	soft        bool
+	devices     util.PodDevices
+	// roundRobinWeights are the weights of the cards of the node the devices were chosen by.
+	roundRobinWeights map[string]float64
+}
+
+// filter places the pod on one of the nodes. When it assigned devices to the pod, it returns
+// the annotations to write to it instead of a result, see assigned.
+func (s *Scheduler) filter(args extenderv1.ExtenderArgs) (*extenderv1.ExtenderFilterResult, *filterWrite, error) {
 	klog.InfoS("Starting schedule filter process", "pod", args.Pod.Name, "uuid", args.Pod.UID, "namespace", args.Pod.Namespace)
 	nums := k8sutil.Resourcereqs(args.Pod)
 	total := 0
@@ -457,14 +805,31 @@ func (s *Scheduler) Filter(args extenderv1.ExtenderArgs) (*extenderv1.ExtenderFi
 			NodeNames:   args.NodeNames,
 			FailedNodes: nil,
 			Error:       "",
-		}, nil
+		}, nil, nil
 	}
 	annos := args.Pod.Annotations
+	prof, hasProfile := s.profileFor(args.Pod)
+	if hasProfile {
+		klog.V(4).InfoS("Applying scheduler profile", "pod", klog.KObj(args.Pod), "profile", prof.SchedulerName)
+		annos = prof.annotations(annos)
+	}
 	s.delPod(args.Pod)
+	since := s.fairness.observe(args.Pod, nums, annos, args.NodeNames)
 	nodeUsage, failedNodes, err := s.getNodesUsage(args.NodeNames, args.Pod)
 	if err != nil {
 		s.recordScheduleFilterResultEvent(args.Pod, EventReasonFilteringFailed, []string{}, err)
-		return nil, err
+		return nil, nil, err
+	}
+	elders := fittingElders(*nodeUsage, s.fairness.elders(args.Pod.UID, since))
+	if hasProfile {
+		prof.apply(*nodeUsage, annos)
+	}
+	overcommitCores(*nodeUsage, prof.coreOvercommit())
+	if !softReservation(annos) {
+		yieldSoftMemory(*nodeUsage)
+	}
+	if oversubscribes(annos) {
+		oversubscribeMemory(*nodeUsage)
 	}
 	if len(failedNodes) != 0 {
 		klog.V(5).InfoS("Nodes failed during usage retrieval",
@@ -474,18 +839,27 @@ func (s *Scheduler) Filter(args extenderv1.ExtenderArgs) (*extenderv1.ExtenderFi
 	if err != nil {
 		err := fmt.Errorf("calcScore failed %v for pod %v", err, args.Pod.Name)
 		s.recordScheduleFilterResultEvent(args.Pod, EventReasonFilteringFailed, []string{}, err)
-		return nil, err
+		return nil, nil, err
 	}
+	holdForElders(nodeScores, *nodeUsage, elders, failedNodes)
 	if len((*nodeScores).NodeList) == 0 {
 		klog.V(4).InfoS("No available nodes meet the required scores",
 			"pod", args.Pod.Name)
-		s.recordScheduleFilterResultEvent(args.Pod, EventReasonFilteringFailed, []string{}, fmt.Errorf("no available node, all node scores do not meet"))
+		s.recordScheduleFilterResultEvent(args.Pod, EventReasonFilteringFailed, []string{}, fmt.Errorf("no available node, all node scores do not meet; %s", summarizeFailedNodes(failedNodes, len(*args.NodeNames))))
+		s.decisions.record(newSchedulingDecision(args.Pod, nodeScores, failedNodes))
+		// A pod failed past its deadline doesn't need room anymore.
+		if !s.failPastDeadline(args.Pod, summarizeFailedNodes(failedNodes, len(*args.NodeNames)), time.Now()) {
+			s.reclaimGPUs(args.Pod, nums, annos, args.NodeNames)
+		}
+		unresolvable := splitUnresolvable(*nodeUsage, failedNodes)
 		return &extenderv1.ExtenderFilterResult{
-			FailedNodes: failedNodes,
-		}, nil
+			FailedNodes:                failedNodes,
+			FailedAndUnresolvableNodes: unresolvable,
+		}, nil, nil
 	}
 	klog.V(4).Infoln("nodeScores_len=", len((*nodeScores).NodeList))
 	sort.Sort(nodeScores)
+	s.decisions.record(newSchedulingDecision(args.Pod, nodeScores, failedNodes))
 	m := (*nodeScores).NodeList[len((*nodeScores).NodeList)-1]
 	klog.InfoS("Scheduling pod to node",
 		"podNamespace", args.Pod.Namespace,
@@ -504,14 +878,45 @@ func (s *Scheduler) Filter(args extenderv1.ExtenderArgs) (*extenderv1.ExtenderFi
 	//supportDevices := util.EncodePodDevices(util.SupportDevices, m.devices)
 	//maps.Copy(annotations, InRequestDevices)
 	//maps.Copy(annotations, supportDevices)
+	// The devices are accounted right away, so concurrent filters don't assign them again.
+	// Everything else waits for the write, see assigned.
 	s.addPod(args.Pod, m.NodeID, m.Devices)
-	err = util.PatchPodAnnotations(args.Pod, annotations)
+	s.resources.changed()
+	s.allocations.changed()
+	return nil, &filterWrite{
+		nodeID:            m.NodeID,
+		node:              (*nodeUsage)[m.NodeID].Node,
+		annotations:       annotations,
+		soft:              softReservation(annos),
+		devices:           m.Devices,
+		roundRobinWeights: (*nodeUsage)[m.NodeID].roundRobinWeights,
+	}, nil
+}
+
+// assigned completes the filter of pod once the devices assigned to it were written, or the
+// write failed with err. Only a written assignment advances the round robin of the cards,
+// records the sticky placement, consumes the reservation of the pod and ends its wait; a
+// failed one only gives the devices back.
+func (s *Scheduler) assigned(pod *corev1.Pod, write *filterWrite, err error) (*extenderv1.ExtenderFilterResult, error) {
 	if err != nil {
-		s.recordScheduleFilterResultEvent(args.Pod, EventReasonFilteringFailed, []string{}, err)
-		s.delPod(args.Pod)
+		if !s.recordBindWriteFailed(pod, "write the devices assigned to the pod", err) {
+			s.recordScheduleFilterResultEvent(pod, EventReasonFilteringFailed, []string{}, err)
+		}
+		s.delPod(pod)
+		s.resources.changed()
+		s.allocations.changed()
 		return nil, err
 	}
-	s.recordScheduleFilterResultEvent(args.Pod, EventReasonFilteringSucceed, []string{m.NodeID}, nil)
-	res := extenderv1.ExtenderFilterResult{NodeNames: &[]string{m.NodeID}}
+	s.roundRobin.placed(write.nodeID, write.roundRobinWeights, write.devices)
+	s.sticky.record(pod, write.nodeID, write.devices)
+	s.fairness.forget(pod.UID)
+	s.reclaim.forget(pod.UID)
+	s.reservations.consume(s.podReservationToken(pod), write.nodeID)
+	s.recordScheduleFilterResultEvent(pod, EventReasonFilteringSucceed, []string{write.nodeID}, nil)
+	s.warnCUDAVersion(pod, write.node)
+	if !write.soft {
+		s.shrinkSoftReservations(write.nodeID)
+	}
+	res := extenderv1.ExtenderFilterResult{NodeNames: &[]string{write.nodeID}}
 	return &res, nil
 }
@@ -18,6 +18,8 @@ package scheduler
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"strings"
 	"testing"
 	"time"
@@ -25,19 +27,27 @@ import (
 	"github.com/stretchr/testify/require"
 	"gotest.tools/v3/assert"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 	extenderv1 "k8s.io/kube-scheduler/extender/v1"
 
+	"github.com/Project-HAMi/HAMi/pkg/audit"
 	"github.com/Project-HAMi/HAMi/pkg/device"
 	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
 	"github.com/Project-HAMi/HAMi/pkg/scheduler/policy"
 	"github.com/Project-HAMi/HAMi/pkg/util"
 	"github.com/Project-HAMi/HAMi/pkg/util/client"
+	"github.com/Project-HAMi/HAMi/pkg/util/nodelock"
 )
 
 func Test_getNodesUsage(t *testing.T) {
@@ -73,7 +83,7 @@ func Test_getNodesUsage(t *testing.T) {
 				{
 					Idx:       0,
 					UUID:      "GPU0",
-					Usedmem:   100,
+					Usedmem:   100 * util.MiB,
 					Usedcores: 10,
 				},
 			},
@@ -109,7 +119,8 @@ func Test_getNodesUsage(t *testing.T) {
 	assert.Equal(t, ok, true)
 	assert.Equal(t, len(v.Devices.DeviceLists), 2)
 	assert.Equal(t, v.Devices.DeviceLists[0].Device.Used, int32(2))
-	assert.Equal(t, v.Devices.DeviceLists[0].Device.Usedmem, int32(200))
+	assert.Equal(t, v.Devices.DeviceLists[0].Device.Usedmem, 200*util.MiB)
+	assert.Equal(t, v.Devices.DeviceLists[0].Device.Totalmem, 1024*util.MiB)
 	assert.Equal(t, v.Devices.DeviceLists[0].Device.Usedcores, int32(20))
 }
 
@@ -831,3 +842,360 @@ func Test_RegisterFromNodeAnnotations_NIL(t *testing.T) {
 		})
 	}
 }
+
+func Test_BindRetry(t *testing.T) {
+	config.BindRetryBackoff = time.Millisecond
+	tests := []struct {
+		name       string
+		retryCount int
+		failures   []error
+		wantError  bool
+		wantCalls  int
+	}{
+		{
+			name:       "conflict is retried",
+			retryCount: 3,
+			failures:   []error{apierrors.NewConflict(corev1.Resource("pods"), "p1", nil)},
+			wantCalls:  2,
+		},
+		{
+			name:       "retries are bounded",
+			retryCount: 2,
+			failures: []error{
+				apierrors.NewServiceUnavailable("etcd leader changed"),
+				apierrors.NewServiceUnavailable("etcd leader changed"),
+				apierrors.NewServiceUnavailable("etcd leader changed"),
+			},
+			wantError: true,
+			wantCalls: 3,
+		},
+		{
+			name:       "permanent error is not retried",
+			retryCount: 3,
+			failures:   []error{apierrors.NewForbidden(corev1.Resource("pods"), "p1", nil)},
+			wantError:  true,
+			wantCalls:  1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config.BindRetryCount = test.retryCount
+			fakeClient := fake.NewSimpleClientset(
+				&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "p1", Namespace: "default", UID: "uid-1"}},
+				&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}},
+			)
+			calls := 0
+			fakeClient.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				if action.GetSubresource() != "binding" {
+					return false, nil, nil
+				}
+				calls++
+				if calls <= len(test.failures) {
+					return true, nil, test.failures[calls-1]
+				}
+				return true, nil, nil
+			})
+			client.KubeClient = fakeClient
+			s := NewScheduler()
+			s.kubeClient = fakeClient
+			s.eventRecorder = record.NewFakeRecorder(10)
+
+			res, err := s.Bind(extenderv1.ExtenderBindingArgs{PodName: "p1", PodNamespace: "default", PodUID: "uid-1", Node: "node1"})
+			assert.NilError(t, err)
+			assert.Equal(t, res.Error != "", test.wantError)
+			assert.Equal(t, calls, test.wantCalls)
+		})
+	}
+}
+
+func Test_BindRecordsAllocationAudit(t *testing.T) {
+	config.BindRetryBackoff = time.Millisecond
+	config.BindRetryCount = 0
+	for _, test := range []struct {
+		name    string
+		bindErr error
+		want    int
+	}{
+		{name: "bound pod is recorded", want: 1},
+		{name: "failed bind is not recorded", bindErr: apierrors.NewForbidden(corev1.Resource("pods"), "p1", nil), want: 0},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "p1", Namespace: "default", UID: "uid-1"}}
+			fakeClient := fake.NewSimpleClientset(pod, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+			fakeClient.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				if action.GetSubresource() != "binding" {
+					return false, nil, nil
+				}
+				return true, nil, test.bindErr
+			})
+			client.KubeClient = fakeClient
+			s := NewScheduler()
+			s.kubeClient = fakeClient
+			s.eventRecorder = record.NewFakeRecorder(10)
+			sink, err := audit.NewSink(audit.SinkTypeWebhook, "http://127.0.0.1:0", "")
+			assert.NilError(t, err)
+			s.auditor = audit.NewRecorder(audit.SourceScheduler, sink, 10)
+			// Filter assigned the devices, which alone doesn't allocate them.
+			s.addPod(pod, "node1", util.PodDevices{})
+			assert.Equal(t, s.auditor.Pending(), 0)
+
+			_, err = s.Bind(extenderv1.ExtenderBindingArgs{PodName: "p1", PodNamespace: "default", PodUID: "uid-1", Node: "node1"})
+			assert.NilError(t, err)
+			assert.Equal(t, s.auditor.Pending(), test.want)
+		})
+	}
+}
+
+func Test_releasePodRecordsAuditOfBoundPods(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		nodeName string
+		want     int
+	}{
+		{name: "bound pod is recorded", nodeName: "node1", want: 1},
+		{name: "pod never bound is not recorded", want: 0},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "p1", Namespace: "default", UID: "uid-1"},
+				Spec:       corev1.PodSpec{NodeName: test.nodeName},
+			}
+			s := NewScheduler()
+			sink, err := audit.NewSink(audit.SinkTypeWebhook, "http://127.0.0.1:0", "")
+			assert.NilError(t, err)
+			s.auditor = audit.NewRecorder(audit.SourceScheduler, sink, 10)
+			s.addPod(pod, "node1", util.PodDevices{})
+
+			s.releasePod(pod)
+			assert.Equal(t, s.auditor.Pending(), test.want)
+		})
+	}
+}
+
+func Test_BindRetryKeepsNodeLock(t *testing.T) {
+	prev := device.ActiveConfig()
+	initTFLOPSDevices(t)
+	defer func() { assert.NilError(t, device.InitDevicesWithConfig(prev)) }()
+	config.BindRetryBackoff = time.Millisecond
+	config.BindRetryCount = 3
+	config.NodeLockCoalesceWindow = time.Hour
+	defer func() { config.NodeLockCoalesceWindow = 0 }()
+
+	fakeClient := fake.NewSimpleClientset(
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "p1", Namespace: "default", UID: "uid-1"},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{
+				Name: "gpu",
+				Resources: corev1.ResourceRequirements{Limits: corev1.ResourceList{
+					"hami.io/gpu": resource.MustParse("1"),
+				}},
+			}}},
+		},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1", Annotations: map[string]string{}}},
+	)
+	binds := 0
+	fakeClient.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "binding" {
+			return false, nil, nil
+		}
+		binds++
+		if binds == 1 {
+			return true, nil, apierrors.NewConflict(corev1.Resource("pods"), "p1", nil)
+		}
+		return true, nil, nil
+	})
+	nodeUpdates := 0
+	fakeClient.PrependReactor("update", "nodes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		nodeUpdates++
+		return false, nil, nil
+	})
+	client.KubeClient = fakeClient
+	s := NewScheduler()
+	s.kubeClient = fakeClient
+	s.eventRecorder = record.NewFakeRecorder(10)
+
+	res, err := s.Bind(extenderv1.ExtenderBindingArgs{PodName: "p1", PodNamespace: "default", PodUID: "uid-1", Node: "node1"})
+	assert.NilError(t, err)
+	assert.Equal(t, res.Error, "")
+	assert.Equal(t, binds, 2)
+	// The lock is set once, the retry keeps it instead of releasing and setting it again.
+	assert.Equal(t, nodeUpdates, 1)
+	node, err := fakeClient.CoreV1().Nodes().Get(context.Background(), "node1", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(node.Annotations[nodelock.NodeLockKey], "p1"))
+}
+
+func Test_BindRetryLocksAgainAfterFailedLock(t *testing.T) {
+	prev := device.ActiveConfig()
+	initTFLOPSDevices(t)
+	defer func() { assert.NilError(t, device.InitDevicesWithConfig(prev)) }()
+	config.NodeLockCoalesceWindow = time.Hour
+	defer func() { config.NodeLockCoalesceWindow = 0 }()
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "p1", Namespace: "default", UID: "uid-1"},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name: "gpu",
+			Resources: corev1.ResourceRequirements{Limits: corev1.ResourceList{
+				"hami.io/gpu": resource.MustParse("1"),
+			}},
+		}}},
+	}
+	other := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default"}}
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1", Annotations: map[string]string{
+		nodelock.NodeLockKey: nodelock.GenerateNodeLockKeyByPod(other),
+	}}}
+	fakeClient := fake.NewSimpleClientset(pod, node)
+	fakeClient.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return action.GetSubresource() == "binding", nil, nil
+	})
+	client.KubeClient = fakeClient
+	s := NewScheduler()
+	s.kubeClient = fakeClient
+	args := extenderv1.ExtenderBindingArgs{PodName: "p1", PodNamespace: "default", PodUID: "uid-1", Node: "node1"}
+
+	err := s.bindOnce(args, node, pod)
+	assert.Assert(t, errors.Is(err, nodelock.ErrNodeLocked))
+
+	// The other pod releases the lock, the retry has to take it itself.
+	node.Annotations = map[string]string{}
+	_, err = fakeClient.CoreV1().Nodes().Update(context.Background(), node, metav1.UpdateOptions{})
+	assert.NilError(t, err)
+	assert.NilError(t, s.bindOnce(args, node, pod))
+	current, err := fakeClient.CoreV1().Nodes().Get(context.Background(), "node1", metav1.GetOptions{})
+	assert.NilError(t, err)
+	_, _, owner, err := nodelock.ParseNodeLock(current.Annotations[nodelock.NodeLockKey])
+	assert.NilError(t, err)
+	assert.Equal(t, owner, "p1")
+}
+
+func Test_BindHandsNodeLockOver(t *testing.T) {
+	prev := device.ActiveConfig()
+	initTFLOPSDevices(t)
+	defer func() { assert.NilError(t, device.InitDevicesWithConfig(prev)) }()
+	config.BindRetryBackoff = time.Millisecond
+	config.BindRetryCount = 0
+	config.NodeLockCoalesceWindow = time.Hour
+	defer func() { config.NodeLockCoalesceWindow = 0 }()
+
+	gpuPod := func(name string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: k8stypes.UID("uid-" + name)},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{
+				Name: "gpu",
+				Resources: corev1.ResourceRequirements{Limits: corev1.ResourceList{
+					"hami.io/gpu": resource.MustParse("1"),
+				}},
+			}}},
+		}
+	}
+	fakeClient := fake.NewSimpleClientset(gpuPod("p1"), gpuPod("p2"),
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1", Annotations: map[string]string{}}})
+	fakeClient.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "binding" {
+			return false, nil, nil
+		}
+		if action.(k8stesting.CreateAction).GetObject().(*corev1.Binding).Name == "p1" {
+			return true, nil, apierrors.NewForbidden(corev1.Resource("pods"), "p1", nil)
+		}
+		return true, nil, nil
+	})
+	nodeUpdates := 0
+	fakeClient.PrependReactor("update", "nodes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		nodeUpdates++
+		return false, nil, nil
+	})
+	client.KubeClient = fakeClient
+	s := NewScheduler()
+	s.kubeClient = fakeClient
+	s.eventRecorder = record.NewFakeRecorder(10)
+
+	res, err := s.Bind(extenderv1.ExtenderBindingArgs{PodName: "p1", PodNamespace: "default", PodUID: "uid-p1", Node: "node1"})
+	assert.NilError(t, err)
+	assert.Assert(t, res.Error != "")
+	res, err = s.Bind(extenderv1.ExtenderBindingArgs{PodName: "p2", PodNamespace: "default", PodUID: "uid-p2", Node: "node1"})
+	assert.NilError(t, err)
+	assert.Equal(t, res.Error, "")
+	// p1 sets the lock and hands it over to p2 in one update, instead of releasing it for p2 to set it again.
+	assert.Equal(t, nodeUpdates, 2)
+	node, err := fakeClient.CoreV1().Nodes().Get(context.Background(), "node1", metav1.GetOptions{})
+	assert.NilError(t, err)
+	_, _, owner, err := nodelock.ParseNodeLock(node.Annotations[nodelock.NodeLockKey])
+	assert.NilError(t, err)
+	assert.Equal(t, owner, "p2")
+}
+
+func Test_isTransientBindError(t *testing.T) {
+	assert.Assert(t, isTransientBindError(fmt.Errorf("node node1 has been locked within 5 minutes: %w", nodelock.ErrNodeLocked)))
+	assert.Assert(t, isTransientBindError(apierrors.NewConflict(corev1.Resource("pods"), "p1", nil)))
+	assert.Assert(t, isTransientBindError(apierrors.NewTooManyRequests("slow down", 1)))
+	assert.Assert(t, !isTransientBindError(apierrors.NewNotFound(corev1.Resource("pods"), "p1")))
+	assert.Assert(t, !isTransientBindError(fmt.Errorf("unexpected")))
+}
+
+func Test_FilterEncodesDeviceAnnotations(t *testing.T) {
+	prev := device.ActiveConfig()
+	initTFLOPSDevices(t)
+	defer func() { assert.NilError(t, device.InitDevicesWithConfig(prev)) }()
+	defer func() {
+		config.CompactDeviceAnnotations, config.DeviceAnnotationOverflowSize, config.DeviceAnnotationOverflowNamespace = false, 0, ""
+	}()
+
+	for _, test := range []struct {
+		name         string
+		compact      bool
+		overflowSize int
+		prefix       string
+	}{
+		{name: "plain", prefix: "GPU-0"},
+		{name: "compact", compact: true, prefix: util.CompactDevicesPrefix},
+		{name: "overflow", overflowSize: 1, prefix: util.OverflowDevicesPrefix},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			config.CompactDeviceAnnotations = test.compact
+			config.DeviceAnnotationOverflowSize = test.overflowSize
+			config.DeviceAnnotationOverflowNamespace = "hami-system"
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "p1", Namespace: "default", UID: "uid-1"},
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{
+					Name: "gpu",
+					Resources: corev1.ResourceRequirements{Limits: corev1.ResourceList{
+						"hami.io/gpu": resource.MustParse("1"),
+					}},
+				}}},
+			}
+			fakeClient := fake.NewSimpleClientset(pod)
+			client.KubeClient = fakeClient
+			s := NewScheduler()
+			s.kubeClient = fakeClient
+			s.eventRecorder = record.NewFakeRecorder(10)
+			s.addNode("node1", &util.NodeInfo{
+				ID:      "node1",
+				Node:    &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}},
+				Devices: []util.DeviceInfo{{ID: "GPU-0", Count: 10, Devmem: 8000, Devcore: 100, Type: nvidia.NvidiaGPUDevice, Health: true}},
+			})
+
+			res, err := s.Filter(extenderv1.ExtenderArgs{Pod: pod, NodeNames: &[]string{"node1"}})
+			assert.NilError(t, err)
+			assert.DeepEqual(t, *res.NodeNames, []string{"node1"})
+			current, err := fakeClient.CoreV1().Pods("default").Get(context.Background(), "p1", metav1.GetOptions{})
+			assert.NilError(t, err)
+			value := current.Annotations[util.SupportDevices[nvidia.NvidiaGPUDevice]]
+			assert.Assert(t, strings.HasPrefix(value, test.prefix), value)
+			pd, err := util.DecodePodDevices(util.SupportDevices, current.Annotations)
+			assert.NilError(t, err)
+			assert.Equal(t, pd[nvidia.NvidiaGPUDevice][0][0].UUID, "GPU-0")
+
+			// Deleting the pod releases what overflowed.
+			s.onDelPod(current)
+			cms, err := fakeClient.CoreV1().ConfigMaps("hami-system").List(context.Background(), metav1.ListOptions{})
+			assert.NilError(t, err)
+			if test.overflowSize > 0 {
+				assert.Equal(t, len(cms.Items), 1)
+			}
+			for _, cm := range cms.Items {
+				assert.Equal(t, len(cm.Data), 0)
+			}
+		})
+	}
+}
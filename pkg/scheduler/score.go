@@ -16,15 +16,18 @@ limitations under the License.
 package scheduler
 
 import (
+	"slices"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/klog/v2"
 
 	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
 	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
 	"github.com/Project-HAMi/HAMi/pkg/scheduler/policy"
 	"github.com/Project-HAMi/HAMi/pkg/util"
@@ -64,10 +67,82 @@ func checkUUID(annos map[string]string, d util.DeviceUsage, n util.ContainerDevi
 	return result
 }
 
+// normalizeImageName expands an image reference to the fully qualified form
+// kubelet reports in node status, e.g. `nginx` -> `docker.io/library/nginx:latest`.
+func normalizeImageName(image string) string {
+	name := image
+	if i := strings.Index(name, "/"); i < 0 {
+		name = "docker.io/library/" + name
+	} else if first := name[:i]; !strings.ContainsAny(first, ".:") && first != "localhost" {
+		name = "docker.io/" + name
+	}
+	if !strings.Contains(name, "@") && !strings.Contains(name[strings.LastIndex(name, "/")+1:], ":") {
+		name += ":latest"
+	}
+	return name
+}
+
+// checkConfidentialCompute reports whether the confidential computing mode of d matches
+// the hami.io/confidential-compute annotation. Without the annotation every card matches.
+func checkConfidentialCompute(annos map[string]string, d util.DeviceUsage) bool {
+	switch annos[util.ConfidentialCompute] {
+	case util.ConfidentialComputeRequired:
+		return d.ConfidentialCompute
+	case util.ConfidentialComputeForbidden:
+		return !d.ConfidentialCompute
+	}
+	return true
+}
+
+// imageLocalityScore returns the size-weighted fraction (0..1) of the pod's
+// container images already present on the node.
+func imageLocalityScore(node *corev1.Node, pod *corev1.Pod) float32 {
+	if node == nil || pod == nil || len(pod.Spec.Containers) == 0 {
+		return 0
+	}
+	sizes := make(map[string]int64)
+	for _, img := range node.Status.Images {
+		for _, name := range img.Names {
+			sizes[normalizeImageName(name)] = img.SizeBytes
+		}
+	}
+	present, total := int64(0), int64(0)
+	for _, ctr := range pod.Spec.Containers {
+		size, ok := sizes[normalizeImageName(ctr.Image)]
+		// Images that are not present are unknown in size, as are cached ones the node doesn't
+		// report a size for, count them as the largest cached one would.
+		if size <= 0 {
+			size = 1
+			for _, s := range sizes {
+				size = max(size, s)
+			}
+		}
+		if ok {
+			present += size
+		}
+		total += size
+	}
+	if total == 0 {
+		return 0
+	}
+	return float32(present) / float32(total)
+}
+
 func fitInCertainDevice(node *NodeUsage, request util.ContainerDeviceRequest, annos map[string]string, pod *corev1.Pod, allocated *util.PodDevices) (bool, map[string]util.ContainerDevices) {
 	k := request
 	originReq := k.Nums
 	prevnuma := -1
+	exclusive := annos[util.Exclusive] == "true"
+	tflops, byTFLOPS := tflopsTarget(annos)
+	byTFLOPS = byTFLOPS && k.Type == nvidia.NvidiaGPUDevice
+	typeOrder := gpuTypeOrder(annos)
+	accepted := acceptedTypes(typeOrder, annos, pod, time.Now())
+	partitions := nodeCardPartitions(node.Node, pod)
+	var namespace string
+	if pod != nil {
+		namespace = pod.Namespace
+	}
+	isolated := namespaceIsolated(namespace, annos)
 	klog.InfoS("Allocating device for container request", "pod", klog.KObj(pod), "card request", k)
 	var tmpDevs map[string]util.ContainerDevices
 	tmpDevs = make(map[string]util.ContainerDevices)
@@ -88,11 +163,80 @@ func fitInCertainDevice(node *NodeUsage, request util.ContainerDeviceRequest, an
 			klog.InfoS("card uuid mismatch,", "pod", klog.KObj(pod), "current device info is:", *node.Devices.DeviceLists[i].Device)
 			continue
 		}
+		if reason := checkTypeOrder(typeOrder, accepted, annos, *node.Devices.DeviceLists[i].Device); reason != "" {
+			klog.V(5).InfoS("card type not accepted yet, skipping", "pod", klog.KObj(pod), "device index", i, "device", node.Devices.DeviceLists[i].Device.ID, "reason", reason)
+			node.typeOrderRejection = reason
+			continue
+		}
+		if !partitions.allows(node.Devices.DeviceLists[i].Device) {
+			klog.V(5).InfoS("card outside of the card partition of the pod, skipping", "pod", klog.KObj(pod), "device index", i, "device", node.Devices.DeviceLists[i].Device.ID)
+			node.partitionRejection = partitions.rejection()
+			continue
+		}
 
-		memreq := int32(0)
+		memreq := int64(0)
+		if node.unhealthy[node.Devices.DeviceLists[i].Device.ID] {
+			klog.V(5).InfoS("card unhealthy, skipping", "pod", klog.KObj(pod), "device index", i, "device", node.Devices.DeviceLists[i].Device.ID)
+			continue
+		}
+		if node.Devices.DeviceLists[i].Device.Quarantined {
+			klog.V(5).InfoS("card quarantined, skipping", "pod", klog.KObj(pod), "device index", i, "device", node.Devices.DeviceLists[i].Device.ID)
+			continue
+		}
+		if node.Devices.DeviceLists[i].Device.Draining {
+			klog.V(5).InfoS("card draining to be re-partitioned, skipping", "pod", klog.KObj(pod), "device index", i, "device", node.Devices.DeviceLists[i].Device.ID)
+			continue
+		}
+		if node.Devices.DeviceLists[i].Device.HeldExternally {
+			klog.V(5).InfoS("card held by another device plugin, skipping", "pod", klog.KObj(pod), "device index", i, "device", node.Devices.DeviceLists[i].Device.ID)
+			continue
+		}
+		if !checkConfidentialCompute(annos, *node.Devices.DeviceLists[i].Device) {
+			klog.V(5).InfoS("card confidential computing mode mismatch, skipping", "pod", klog.KObj(pod), "device index", i, "device", node.Devices.DeviceLists[i].Device.ID, "confidential compute", node.Devices.DeviceLists[i].Device.ConfidentialCompute)
+			continue
+		}
+		if k.Type == nvidia.NvidiaGPUDevice {
+			if reason := checkMemoryType(annos, node.Devices.DeviceLists[i].Device); reason != "" {
+				klog.V(5).InfoS("card memory type mismatch, skipping", "pod", klog.KObj(pod), "device index", i, "device", node.Devices.DeviceLists[i].Device.ID, "reason", reason)
+				node.memoryTypeRejection = reason
+				continue
+			}
+			if reason := checkDeviceKind(annos, node.Devices.DeviceLists[i].Device); reason != "" {
+				klog.V(5).InfoS("card kind mismatch, skipping", "pod", klog.KObj(pod), "device index", i, "device", node.Devices.DeviceLists[i].Device.ID, "reason", reason)
+				node.deviceKindRejection = reason
+				continue
+			}
+		}
+		if reason := checkEncoder(annos, node.Devices.DeviceLists[i].Device); reason != "" {
+			klog.V(5).InfoS("card encoders unavailable, skipping", "pod", klog.KObj(pod), "device index", i, "device", node.Devices.DeviceLists[i].Device.ID, "reason", reason)
+			node.encoderRejection = reason
+			continue
+		}
+		if reason := checkNamespaceIsolation(namespace, isolated, node.Devices.DeviceLists[i].Device); reason != "" {
+			klog.V(5).InfoS("card isolated from the namespace of the pod, skipping", "pod", klog.KObj(pod), "device index", i, "device", node.Devices.DeviceLists[i].Device.ID, "reason", reason)
+			node.namespaceRejection = reason
+			continue
+		}
 		if node.Devices.DeviceLists[i].Device.Count <= node.Devices.DeviceLists[i].Device.Used {
 			continue
 		}
+		if node.Devices.DeviceLists[i].Device.Usedmem > node.Devices.DeviceLists[i].Device.Totalmem {
+			klog.V(5).InfoS("card memory over-committed, skipping", "pod", klog.KObj(pod), "device index", i, "device", node.Devices.DeviceLists[i].Device.ID, "device total memory", node.Devices.DeviceLists[i].Device.Totalmem, "device used memory", node.Devices.DeviceLists[i].Device.Usedmem)
+			continue
+		}
+		if reason := checkFreeBlock(minFreeBlock(annos), node.Devices.DeviceLists[i].Device); reason != "" {
+			klog.V(5).InfoS("card lacks the free memory block the pod wants, skipping", "pod", klog.KObj(pod), "device index", i, "device", node.Devices.DeviceLists[i].Device.ID, "reason", reason)
+			node.freeBlockRejection = reason
+			continue
+		}
+		if byTFLOPS {
+			cores, ok := tflopsCores(node.Devices.DeviceLists[i].Device.Type, tflops)
+			if !ok {
+				klog.V(5).InfoS("card can't deliver the requested TFLOPS, skipping", "pod", klog.KObj(pod), "device index", i, "device", node.Devices.DeviceLists[i].Device.ID, "type", node.Devices.DeviceLists[i].Device.Type, "tflops", tflops)
+				continue
+			}
+			k.Coresreq = cores
+		}
 		if k.Coresreq > 100 {
 			klog.ErrorS(nil, "core limit can't exceed 100", "pod", klog.KObj(pod))
 			k.Coresreq = 100
@@ -103,7 +247,16 @@ func fitInCertainDevice(node *NodeUsage, request util.ContainerDeviceRequest, an
 		}
 		if k.MemPercentagereq != 101 && k.Memreq == 0 {
 			//This incurs an issue
-			memreq = node.Devices.DeviceLists[i].Device.Totalmem * k.MemPercentagereq / 100
+			memreq = node.Devices.DeviceLists[i].Device.Totalmem * int64(k.MemPercentagereq) / 100
+		}
+		if exclusive {
+			if node.Devices.DeviceLists[i].Device.Used > 0 || node.Devices.DeviceLists[i].Device.Mode == "mig" {
+				klog.V(5).InfoS("the pod wants whole cards, but the card is in use or partitioned", "pod", klog.KObj(pod), "device index", i, "device", node.Devices.DeviceLists[i].Device.ID, "used", node.Devices.DeviceLists[i].Device.Used, "mode", node.Devices.DeviceLists[i].Device.Mode)
+				continue
+			}
+			// Reserving all memory and cores keeps every later request off the card.
+			memreq = node.Devices.DeviceLists[i].Device.Totalmem
+			k.Coresreq = node.Devices.DeviceLists[i].Device.Totalcore
 		}
 		if node.Devices.DeviceLists[i].Device.Totalmem-node.Devices.DeviceLists[i].Device.Usedmem < memreq {
 			klog.V(5).InfoS("card Insufficient remaining memory", "pod", klog.KObj(pod), "device index", i, "device", node.Devices.DeviceLists[i].Device.ID, "device total memory", node.Devices.DeviceLists[i].Device.Totalmem, "device used memory", node.Devices.DeviceLists[i].Device.Usedmem, "request memory", memreq)
@@ -123,6 +276,13 @@ func fitInCertainDevice(node *NodeUsage, request util.ContainerDeviceRequest, an
 			klog.V(5).InfoS("can't allocate core=0 job to an already full GPU", "pod", klog.KObj(pod), "device index", i, "device", node.Devices.DeviceLists[i].Device.ID)
 			continue
 		}
+		if !exclusive {
+			if reason := checkCardRules(node.Devices.DeviceLists[i].Device, memreq, k.Coresreq); reason != "" {
+				klog.InfoS("card rule rejects the allocation", "pod", klog.KObj(pod), "device index", i, "device", node.Devices.DeviceLists[i].Device.ID, "reason", reason)
+				node.cardRuleRejection = reason
+				continue
+			}
+		}
 		if !device.GetDevices()[k.Type].CustomFilterRule(allocated, request, tmpDevs[k.Type], node.Devices.DeviceLists[i].Device) {
 			continue
 		}
@@ -148,30 +308,255 @@ func fitInCertainDevice(node *NodeUsage, request util.ContainerDeviceRequest, an
 	return false, tmpDevs
 }
 
+// stickyBonus outweighs every other score term, so a sticky pod gets its previous cards
+// back whenever they still fit, yet falls back to the normal choice when they do not.
+const stickyBonus = float32(policy.Weight * 10)
+
+// preferPerfTier raises the score of higher performance tier cards, scaled between
+// the lowest and highest known tier on the node. Nodes with a single tier are left untouched.
+func preferPerfTier(node *NodeUsage, weight float32) {
+	minTier, maxTier := 0, 0
+	for _, d := range node.Devices.DeviceLists {
+		if d.Device.PerfTier <= 0 {
+			continue
+		}
+		if minTier == 0 || d.Device.PerfTier < minTier {
+			minTier = d.Device.PerfTier
+		}
+		maxTier = max(maxTier, d.Device.PerfTier)
+	}
+	if minTier == maxTier {
+		return
+	}
+	for _, d := range node.Devices.DeviceLists {
+		if d.Device.PerfTier <= 0 {
+			continue
+		}
+		d.AddPreference(node.Devices.Policy, weight*float32(d.Device.PerfTier-minTier)/float32(maxTier-minTier))
+	}
+}
+
+// preferLowUtilization raises the score of cards with a lower live utilization, taking the
+// larger of SM and memory bandwidth utilization and scaling between the least and most busy
+// card on the node. Cards without a sample newer than maxAge are left untouched.
+func preferLowUtilization(node *NodeUsage, weight float32, maxAge time.Duration, now time.Time) {
+	busy := func(d *util.DeviceUsage) (int, bool) {
+		u := d.Utilization
+		if u == nil || now.Sub(u.Timestamp) > maxAge {
+			return 0, false
+		}
+		return max(u.SM, u.Memory), true
+	}
+	minBusy, maxBusy, found := 0, 0, false
+	for _, d := range node.Devices.DeviceLists {
+		b, ok := busy(d.Device)
+		if !ok {
+			continue
+		}
+		if !found || b < minBusy {
+			minBusy = b
+		}
+		maxBusy = max(maxBusy, b)
+		found = true
+	}
+	if minBusy == maxBusy {
+		return
+	}
+	for _, d := range node.Devices.DeviceLists {
+		b, ok := busy(d.Device)
+		if !ok {
+			continue
+		}
+		d.AddPreference(node.Devices.Policy, weight*float32(maxBusy-b)/float32(maxBusy-minBusy))
+	}
+}
+
+// addSwitchLoad counts a bandwidth-heavy pod once for every PCIe switch its cards hang off.
+func addSwitchLoad(node *NodeUsage, pd util.PodDevices) {
+	switches := make(map[string]bool)
+	for _, podSingle := range pd {
+		for _, ctrdevs := range podSingle {
+			for _, udevice := range ctrdevs {
+				for _, d := range node.Devices.DeviceLists {
+					if d.Device.PCIeSwitch != "" && d.Device.ID == strings.Split(udevice.UUID, "[")[0] {
+						switches[d.Device.PCIeSwitch] = true
+					}
+				}
+			}
+		}
+	}
+	if len(switches) == 0 {
+		return
+	}
+	if node.switchLoad == nil {
+		node.switchLoad = make(map[string]int)
+	}
+	for sw := range switches {
+		node.switchLoad[sw]++
+	}
+}
+
+// preferUncontendedSwitch raises the score of cards under PCIe switches carrying fewer
+// bandwidth-heavy pods, scaled between the least and most loaded switch of the node.
+// Cards with unknown topology are left untouched.
+func preferUncontendedSwitch(node *NodeUsage, weight float32) {
+	minLoad, maxLoad, found := 0, 0, false
+	for _, d := range node.Devices.DeviceLists {
+		if d.Device.PCIeSwitch == "" {
+			continue
+		}
+		load := node.switchLoad[d.Device.PCIeSwitch]
+		if !found || load < minLoad {
+			minLoad = load
+		}
+		maxLoad = max(maxLoad, load)
+		found = true
+	}
+	if minLoad == maxLoad {
+		return
+	}
+	for _, d := range node.Devices.DeviceLists {
+		if d.Device.PCIeSwitch == "" {
+			continue
+		}
+		load := node.switchLoad[d.Device.PCIeSwitch]
+		d.AddPreference(node.Devices.Policy, weight*float32(maxLoad-load)/float32(maxLoad-minLoad))
+	}
+}
+
+// switchContentionScore returns 1 when none of the PCIe switches of the cards picked on the
+// node carries another bandwidth-heavy pod, falling towards 0 with the load of the busiest one.
+func switchContentionScore(node *NodeUsage, pd util.PodDevices) float32 {
+	busiest := 0
+	for _, podSingle := range pd {
+		for _, ctrdevs := range podSingle {
+			for _, udevice := range ctrdevs {
+				for _, d := range node.Devices.DeviceLists {
+					if d.Device.PCIeSwitch != "" && d.Device.ID == strings.Split(udevice.UUID, "[")[0] {
+						busiest = max(busiest, node.switchLoad[d.Device.PCIeSwitch])
+					}
+				}
+			}
+		}
+	}
+	return 1 / float32(1+busiest)
+}
+
+// fitInSamePCIeSwitch runs fitInCertainDevice on the cards of a single PCIe switch at a time.
+// Cards of earlier containers pin the switch, and cards with unknown topology are never chosen.
+func fitInSamePCIeSwitch(node *NodeUsage, request util.ContainerDeviceRequest, annos map[string]string, pod *corev1.Pod, allocated *util.PodDevices) (bool, map[string]util.ContainerDevices) {
+	pinned := ""
+	for _, podSingle := range *allocated {
+		for _, ctrdevs := range podSingle {
+			for _, d := range ctrdevs {
+				for _, dev := range node.Devices.DeviceLists {
+					if dev.Device.ID == d.UUID {
+						pinned = dev.Device.PCIeSwitch
+					}
+				}
+			}
+		}
+	}
+	groups := make(map[string][]*policy.DeviceListsScore)
+	order := make([]string, 0)
+	// Collect in the sorted order, trying first the switch holding the most preferred card.
+	for i := len(node.Devices.DeviceLists) - 1; i >= 0; i-- {
+		dev := node.Devices.DeviceLists[i]
+		sw := dev.Device.PCIeSwitch
+		if sw == "" || (pinned != "" && sw != pinned) {
+			continue
+		}
+		if _, ok := groups[sw]; !ok {
+			order = append(order, sw)
+		}
+		groups[sw] = append([]*policy.DeviceListsScore{dev}, groups[sw]...)
+	}
+	for _, sw := range order {
+		subset := &NodeUsage{
+			Node: node.Node,
+			Devices: policy.DeviceUsageList{
+				Policy:      node.Devices.Policy,
+				DeviceLists: groups[sw],
+			},
+		}
+		if fit, tmpDevs := fitInCertainDevice(subset, request, annos, pod, allocated); fit {
+			return true, tmpDevs
+		}
+	}
+	klog.InfoS("no PCIe switch can hold the request", "pod", klog.KObj(pod), "request", request, "pinned switch", pinned)
+	return false, map[string]util.ContainerDevices{}
+}
+
 func fitInDevices(node *NodeUsage, requests util.ContainerDeviceRequests, annos map[string]string, pod *corev1.Pod, devinput *util.PodDevices) (bool, float32) {
 	//devmap := make(map[string]util.ContainerDevices)
 	devs := util.ContainerDevices{}
-	total, totalCore, totalMem := int32(0), int32(0), int32(0)
-	free, freeCore, freeMem := int32(0), int32(0), int32(0)
+	total, totalCore, totalMem := int32(0), int32(0), int64(0)
+	free, freeCore, freeMem := int32(0), int32(0), int64(0)
 	sums := 0
 	// computer all device score for one node
 	for index := range node.Devices.DeviceLists {
 		node.Devices.DeviceLists[index].ComputeScore(requests)
 	}
+	if node.Devices.Policy == util.GPUSchedulerPolicyRoundRobin.String() {
+		scoreRoundRobin(node)
+	}
+	if annos[util.LatencySensitive] == "true" && config.PerfTierWeight > 0 {
+		preferPerfTier(node, float32(config.PerfTierWeight))
+	}
+	if annos[util.LatencySensitive] == "true" && config.UtilizationWeight > 0 {
+		preferLowUtilization(node, float32(config.UtilizationWeight), config.UtilizationMaxAge, time.Now())
+	}
+	if config.MemoryTypeWeight > 0 {
+		preferMemoryType(node, annos, float32(config.MemoryTypeWeight))
+	}
+	if config.ECCErrorWeight > 0 {
+		preferFewECCErrors(node, float32(config.ECCErrorWeight))
+	}
+	if annos[util.LatencySensitive] == "true" && config.PerformanceStateWeight > 0 {
+		preferHighPerformanceState(node, float32(config.PerformanceStateWeight))
+	}
+	if config.GPUTemperatureSoftThreshold > 0 && config.GPUTemperatureWeight > 0 {
+		preferCoolCards(node, config.GPUTemperatureSoftThreshold, float32(config.GPUTemperatureWeight))
+	}
+	if annos[util.PCIeBandwidthHeavy] == "true" && config.PCIeContentionWeight > 0 {
+		preferUncontendedSwitch(node, float32(config.PCIeContentionWeight))
+	}
+	if prefersQuietCards(annos) {
+		preferQuietCards(node, float32(config.NoiseToleranceWeight), config.UtilizationMaxAge, time.Now())
+	}
+	if order := gpuTypeOrder(annos); len(order) > 1 {
+		preferTypeOrder(node, order)
+	}
+	for _, d := range node.Devices.DeviceLists {
+		if slices.Contains(node.stickyDevices, d.Device.ID) {
+			d.AddPreference(node.Devices.Policy, stickyBonus)
+		}
+	}
 	//This loop is for requests for different devices
 	for _, k := range requests {
 		sums += int(k.Nums)
-		if int(k.Nums) > len(node.Devices.DeviceLists) {
+		if int(k.Nums) > len(node.Devices.DeviceLists) && !migSameProfile(annos) {
 			klog.InfoS("request devices nums cannot exceed the total number of devices on the node.", "pod", klog.KObj(pod), "request devices nums", k.Nums, "node device nums", len(node.Devices.DeviceLists))
 			return false, 0
 		}
 		sort.Sort(node.Devices)
-		fit, tmpDevs := fitInCertainDevice(node, k, annos, pod, devinput)
+		var fit bool
+		var tmpDevs map[string]util.ContainerDevices
+		sharedMig := migSharedCompute(annos) && k.Type == nvidia.NvidiaGPUDevice
+		if sharedMig {
+			fit, tmpDevs = fitSharedMigInstances(node, k, annos, pod)
+		} else if migSameProfile(annos) && k.Type == nvidia.NvidiaGPUDevice {
+			fit, tmpDevs = fitMigInstances(node, k, annos, pod)
+		} else if annos[util.PCIeSwitchBind] == "true" {
+			fit, tmpDevs = fitInSamePCIeSwitch(node, k, annos, pod, devinput)
+		} else {
+			fit, tmpDevs = fitInCertainDevice(node, k, annos, pod, devinput)
+		}
 		if fit {
 			for idx, val := range tmpDevs[k.Type] {
 				for nidx, v := range node.Devices.DeviceLists {
 					//bc node.Devices has been sorted, so we should find out the correct device
-					if v.Device.ID != val.UUID {
+					if v.Device.ID != strings.Split(val.UUID, "[")[0] {
 						continue
 					}
 					total += v.Device.Count
@@ -180,11 +565,17 @@ func fitInDevices(node *NodeUsage, requests util.ContainerDeviceRequests, annos
 					free += v.Device.Count - v.Device.Used
 					freeCore += v.Device.Totalcore - v.Device.Usedcores
 					freeMem += v.Device.Totalmem - v.Device.Usedmem
-					err := device.GetDevices()[k.Type].AddResourceUsage(node.Devices.DeviceLists[nidx].Device, &tmpDevs[k.Type][idx])
+					var err error
+					if sharedMig {
+						err = addSharedMigUsage(node.Devices.DeviceLists[nidx].Device, tmpDevs[k.Type][idx])
+					} else {
+						err = device.GetDevices()[k.Type].AddResourceUsage(node.Devices.DeviceLists[nidx].Device, &tmpDevs[k.Type][idx])
+					}
 					if err != nil {
 						klog.Errorf("AddResource failed:%s", err.Error())
 						return false, 0
 					}
+					node.Devices.DeviceLists[nidx].Device.Allocations = append(node.Devices.DeviceLists[nidx].Device.Allocations, tmpDevs[k.Type][idx])
 					klog.Infoln("After AddResourceUsage:", node.Devices.DeviceLists[nidx].Device)
 				}
 			}
@@ -209,6 +600,13 @@ func (s *Scheduler) calcScore(nodes *map[string]*NodeUsage, nums util.PodDeviceR
 		NodeList: make([]*policy.NodeScore, 0),
 	}
 
+	sticky, isSticky := s.sticky.lookup(task)
+	if isSticky {
+		klog.InfoS("Preferring previous placement of sticky pod", "pod", klog.KObj(task), "node", sticky.nodeID, "devices", sticky.devices)
+	}
+	fabrics := requestedFabrics(annos)
+	multiGPU := config.NVLinkFabricGate && nvidiaDeviceCount(nums) > 1
+
 	wg := sync.WaitGroup{}
 	mutex := sync.Mutex{}
 	errCh := make(chan error, len(*nodes))
@@ -218,8 +616,64 @@ func (s *Scheduler) calcScore(nodes *map[string]*NodeUsage, nums util.PodDeviceR
 			defer wg.Done()
 
 			viewStatus(*node)
+			if !fitInFabric(node.Node, fabrics) {
+				klog.InfoS("calcScore:node lacks requested interconnect fabric", "pod", klog.KObj(task), "node", nodeID, "fabric", nodeFabric(node.Node), "requested", fabrics)
+				mutex.Lock()
+				failedNodes[nodeID] = "node lacks requested interconnect fabric"
+				mutex.Unlock()
+				return
+			}
+			if reason := underMaintenance(node.Node, time.Now()); reason != "" {
+				mutex.Lock()
+				failedNodes[nodeID] = reason
+				mutex.Unlock()
+				return
+			}
+			if reason := noHealthyGPU(node); reason != "" {
+				klog.InfoS("calcScore:node has no healthy GPU", "pod", klog.KObj(task), "node", nodeID, "reason", reason)
+				mutex.Lock()
+				failedNodes[nodeID] = reason
+				mutex.Unlock()
+				return
+			}
+			if reason := kernelModuleMismatch(node.Node, annos); reason != "" {
+				klog.InfoS("calcScore:node runs another NVIDIA kernel module", "pod", klog.KObj(task), "node", nodeID, "reason", reason)
+				mutex.Lock()
+				failedNodes[nodeID] = reason
+				mutex.Unlock()
+				return
+			}
+			if reason := s.checkPluginVersion(node.Node); reason != "" {
+				klog.InfoS("calcScore:node runs an incompatible device plugin", "pod", klog.KObj(task), "node", nodeID, "reason", reason)
+				mutex.Lock()
+				failedNodes[nodeID] = reason
+				mutex.Unlock()
+				return
+			}
+			if reason := cudaVersionFilterReason(node.Node, annos); reason != "" {
+				klog.InfoS("calcScore:node driver doesn't support the CUDA version", "pod", klog.KObj(task), "node", nodeID, "reason", reason)
+				mutex.Lock()
+				failedNodes[nodeID] = reason
+				mutex.Unlock()
+				return
+			}
+			if multiGPU {
+				if reason := unhealthyNVLinkFabric(node.Node); reason != "" {
+					klog.InfoS("calcScore:node has an unhealthy NVLink fabric", "pod", klog.KObj(task), "node", nodeID, "reason", reason)
+					mutex.Lock()
+					failedNodes[nodeID] = "NVLink fabric unhealthy, multi-GPU pods are not placed: " + reason
+					mutex.Unlock()
+					return
+				}
+			}
 			score := policy.NodeScore{NodeID: nodeID, Node: node.Node, Devices: make(util.PodDevices), Score: 0}
 			score.ComputeDefaultScore(node.Devices)
+			if isSticky && sticky.nodeID == nodeID {
+				node.stickyDevices = sticky.devices
+			}
+			if node.Devices.Policy == util.GPUSchedulerPolicyRoundRobin.String() {
+				node.roundRobin = s.roundRobin.snapshot(nodeID)
+			}
 
 			//This loop is for different container request
 			ctrfit := false
@@ -242,16 +696,58 @@ func (s *Scheduler) calcScore(nodes *map[string]*NodeUsage, nums util.PodDeviceR
 				ctrfit = fit
 				if !fit {
 					klog.InfoS("calcScore:node not fit pod", "pod", klog.KObj(task), "node", nodeID)
-					failedNodes[nodeID] = "node not fit pod"
+					// Nodes are scored concurrently, the reason is built first and set once under the lock.
+					reason := "node not fit pod"
+					for _, rejection := range []string{
+						node.cardRuleRejection,
+						node.encoderRejection,
+						node.namespaceRejection,
+						node.memoryTypeRejection,
+						node.deviceKindRejection,
+						node.typeOrderRejection,
+						node.partitionRejection,
+						node.freeBlockRejection,
+						node.migShortfall,
+					} {
+						if rejection != "" {
+							reason += ", " + rejection
+						}
+					}
+					mutex.Lock()
+					failedNodes[nodeID] = reason
+					mutex.Unlock()
 					break
 				}
 			}
 
 			if ctrfit {
+				if reason := cardSpanExceeded(score.Devices); reason != "" {
+					klog.InfoS("calcScore:pod spans too many cards", "pod", klog.KObj(task), "node", nodeID, "reason", reason)
+					mutex.Lock()
+					failedNodes[nodeID] = reason
+					mutex.Unlock()
+					return
+				}
+				score.OverrideScore(node.Devices, userNodePolicy)
+				score.Breakdown = map[string]float32{"devices": score.Score}
+				if config.ImageLocalityWeight > 0 {
+					score.AddNamedPreference("imageLocality", userNodePolicy, float32(config.ImageLocalityWeight)*imageLocalityScore(node.Node, task))
+				}
+				if annos[util.PCIeBandwidthHeavy] == "true" && config.PCIeContentionWeight > 0 {
+					score.AddNamedPreference("pcieContention", userNodePolicy, float32(config.PCIeContentionWeight)*switchContentionScore(node, score.Devices))
+				}
+				if prefersQuietCards(annos) {
+					score.AddNamedPreference("noiseTolerance", userNodePolicy, float32(config.NoiseToleranceWeight)*quietCardsScore(node, score.Devices))
+				}
+				if order := gpuTypeOrder(annos); len(order) > 1 {
+					score.AddNamedPreference("typeOrder", userNodePolicy, typeOrderScore(node, score.Devices, order))
+				}
+				if isSticky && sticky.nodeID == nodeID {
+					score.AddNamedPreference("sticky", userNodePolicy, stickyBonus)
+				}
 				mutex.Lock()
 				res.NodeList = append(res.NodeList, &score)
 				mutex.Unlock()
-				score.OverrideScore(node.Devices, userNodePolicy)
 			}
 		}(nodeID, node)
 	}
@@ -17,7 +17,9 @@ limitations under the License.
 package scheduler
 
 import (
+	"fmt"
 	"testing"
+	"time"
 
 	"gotest.tools/v3/assert"
 	corev1 "k8s.io/api/core/v1"
@@ -42,6 +44,11 @@ func TestMain(m *testing.M) {
 			DefaultMemory:                0,
 			DefaultCores:                 0,
 			DefaultGPUNum:                1,
+			DeviceClasses: []nvidia.DeviceClass{
+				{Name: "inference-small", Memory: 4096, Cores: 25, Types: []string{"T4"}},
+				{Name: "training", Count: 2, MemoryPercentage: 100, Cores: 100, Types: []string{"A100", "H100"}},
+				{Name: "any-half", MemoryPercentage: 50},
+			},
 		},
 	}
 
@@ -1638,8 +1645,8 @@ func Test_fitInCertainDevice(t *testing.T) {
 									Type:      nvidia.NvidiaGPUDevice,
 									Used:      int32(1),
 									Count:     int32(4),
-									Totalmem:  int32(8192),
-									Usedmem:   int32(2048),
+									Totalmem:  int64(8192),
+									Usedmem:   int64(2048),
 									Usedcores: int32(1),
 									Totalcore: int32(4),
 								},
@@ -1650,7 +1657,7 @@ func Test_fitInCertainDevice(t *testing.T) {
 				request: util.ContainerDeviceRequest{
 					Nums:             int32(1),
 					Type:             nvidia.NvidiaGPUDevice,
-					Memreq:           int32(1024),
+					Memreq:           int64(1024),
 					MemPercentagereq: int32(100),
 					Coresreq:         int32(1),
 				},
@@ -1663,13 +1670,142 @@ func Test_fitInCertainDevice(t *testing.T) {
 				"NVIDIA": {
 					{
 						Usedcores: int32(1),
-						Usedmem:   int32(1024),
+						Usedmem:   int64(1024),
 						Type:      nvidia.NvidiaGPUDevice,
 						UUID:      "test-0",
 					},
 				},
 			},
 		},
+		{
+			name: "quarantined card",
+			args: struct {
+				node      *NodeUsage
+				request   util.ContainerDeviceRequest
+				annos     map[string]string
+				pod       *corev1.Pod
+				allocated *util.PodDevices
+			}{
+				node: &NodeUsage{
+					Devices: policy.DeviceUsageList{
+						DeviceLists: []*policy.DeviceListsScore{
+							{
+								Device: &util.DeviceUsage{
+									ID:          "test-0",
+									Numa:        int(1),
+									Type:        nvidia.NvidiaGPUDevice,
+									Used:        int32(1),
+									Count:       int32(4),
+									Totalmem:    int64(8192),
+									Usedmem:     int64(2048),
+									Usedcores:   int32(1),
+									Totalcore:   int32(4),
+									Quarantined: true,
+								},
+							},
+						},
+					},
+				},
+				request: util.ContainerDeviceRequest{
+					Nums:             int32(1),
+					Type:             nvidia.NvidiaGPUDevice,
+					Memreq:           int64(1024),
+					MemPercentagereq: int32(100),
+					Coresreq:         int32(1),
+				},
+				annos:     map[string]string{},
+				pod:       &corev1.Pod{},
+				allocated: &util.PodDevices{},
+			},
+			want1: false,
+			want2: map[string]util.ContainerDevices{},
+		},
+		{
+			name: "draining card",
+			args: struct {
+				node      *NodeUsage
+				request   util.ContainerDeviceRequest
+				annos     map[string]string
+				pod       *corev1.Pod
+				allocated *util.PodDevices
+			}{
+				node: &NodeUsage{
+					Devices: policy.DeviceUsageList{
+						DeviceLists: []*policy.DeviceListsScore{
+							{
+								Device: &util.DeviceUsage{
+									ID:        "test-0",
+									Numa:      int(1),
+									Type:      nvidia.NvidiaGPUDevice,
+									Used:      int32(1),
+									Count:     int32(4),
+									Totalmem:  int64(8192),
+									Usedmem:   int64(2048),
+									Usedcores: int32(1),
+									Totalcore: int32(4),
+									Draining:  true,
+								},
+							},
+						},
+					},
+				},
+				request: util.ContainerDeviceRequest{
+					Nums:             int32(1),
+					Type:             nvidia.NvidiaGPUDevice,
+					Memreq:           int64(1024),
+					MemPercentagereq: int32(100),
+					Coresreq:         int32(1),
+				},
+				annos:     map[string]string{},
+				pod:       &corev1.Pod{},
+				allocated: &util.PodDevices{},
+			},
+			want1: false,
+			want2: map[string]util.ContainerDevices{},
+		},
+		{
+			name: "card held by another device plugin",
+			args: struct {
+				node      *NodeUsage
+				request   util.ContainerDeviceRequest
+				annos     map[string]string
+				pod       *corev1.Pod
+				allocated *util.PodDevices
+			}{
+				node: &NodeUsage{
+					Devices: policy.DeviceUsageList{
+						DeviceLists: []*policy.DeviceListsScore{
+							{
+								Device: &util.DeviceUsage{
+									ID:             "test-0",
+									Numa:           int(1),
+									Type:           nvidia.NvidiaGPUDevice,
+									Used:           int32(1),
+									Count:          int32(4),
+									Totalmem:       int64(8192),
+									Usedmem:        int64(2048),
+									Usedcores:      int32(1),
+									Totalcore:      int32(4),
+									HeldExternally: true,
+								},
+							},
+						},
+					},
+				},
+				request: util.ContainerDeviceRequest{
+					Nums:             int32(1),
+					Type:             nvidia.NvidiaGPUDevice,
+					Memreq:           int64(1024),
+					MemPercentagereq: int32(100),
+					Coresreq:         int32(1),
+				},
+				annos:     map[string]string{},
+				pod:       &corev1.Pod{},
+				allocated: &util.PodDevices{},
+			},
+			want1: false,
+			want2: map[string]util.ContainerDevices{},
+		},
 		{
 			name: "card type don't match",
 			args: struct {
@@ -1689,8 +1825,8 @@ func Test_fitInCertainDevice(t *testing.T) {
 									Type:      nvidia.NvidiaGPUDevice,
 									Used:      int32(1),
 									Count:     int32(4),
-									Totalmem:  int32(8192),
-									Usedmem:   int32(2048),
+									Totalmem:  int64(8192),
+									Usedmem:   int64(2048),
 									Usedcores: int32(1),
 									Totalcore: int32(4),
 								},
@@ -1701,7 +1837,7 @@ func Test_fitInCertainDevice(t *testing.T) {
 				request: util.ContainerDeviceRequest{
 					Nums:             int32(1),
 					Type:             "test",
-					Memreq:           int32(1024),
+					Memreq:           int64(1024),
 					MemPercentagereq: int32(100),
 					Coresreq:         int32(1),
 				},
@@ -1731,8 +1867,8 @@ func Test_fitInCertainDevice(t *testing.T) {
 									Type:      nvidia.NvidiaGPUDevice,
 									Used:      int32(5),
 									Count:     int32(4),
-									Totalmem:  int32(8192),
-									Usedmem:   int32(2048),
+									Totalmem:  int64(8192),
+									Usedmem:   int64(2048),
 									Usedcores: int32(1),
 									Totalcore: int32(4),
 								},
@@ -1743,7 +1879,7 @@ func Test_fitInCertainDevice(t *testing.T) {
 				request: util.ContainerDeviceRequest{
 					Nums:             int32(1),
 					Type:             nvidia.NvidiaGPUDevice,
-					Memreq:           int32(1024),
+					Memreq:           int64(1024),
 					MemPercentagereq: int32(100),
 					Coresreq:         int32(1),
 				},
@@ -1773,8 +1909,8 @@ func Test_fitInCertainDevice(t *testing.T) {
 									Type:      nvidia.NvidiaGPUDevice,
 									Used:      int32(1),
 									Count:     int32(4),
-									Totalmem:  int32(8192),
-									Usedmem:   int32(2048),
+									Totalmem:  int64(8192),
+									Usedmem:   int64(2048),
 									Usedcores: int32(1),
 									Totalcore: int32(4),
 								},
@@ -1785,7 +1921,7 @@ func Test_fitInCertainDevice(t *testing.T) {
 				request: util.ContainerDeviceRequest{
 					Nums:             int32(1),
 					Type:             nvidia.NvidiaGPUDevice,
-					Memreq:           int32(1024),
+					Memreq:           int64(1024),
 					MemPercentagereq: int32(100),
 					Coresreq:         int32(200),
 				},
@@ -1815,8 +1951,8 @@ func Test_fitInCertainDevice(t *testing.T) {
 									Type:      nvidia.NvidiaGPUDevice,
 									Used:      int32(1),
 									Count:     int32(4),
-									Totalmem:  int32(8000),
-									Usedmem:   int32(8000),
+									Totalmem:  int64(8000),
+									Usedmem:   int64(8000),
 									Usedcores: int32(1),
 									Totalcore: int32(4),
 								},
@@ -1827,7 +1963,7 @@ func Test_fitInCertainDevice(t *testing.T) {
 				request: util.ContainerDeviceRequest{
 					Nums:             int32(1),
 					Type:             nvidia.NvidiaGPUDevice,
-					Memreq:           int32(0),
+					Memreq:           int64(0),
 					MemPercentagereq: int32(100),
 					Coresreq:         int32(100),
 				},
@@ -1857,8 +1993,8 @@ func Test_fitInCertainDevice(t *testing.T) {
 									Type:      nvidia.NvidiaGPUDevice,
 									Used:      int32(1),
 									Count:     int32(4),
-									Totalmem:  int32(8192),
-									Usedmem:   int32(2048),
+									Totalmem:  int64(8192),
+									Usedmem:   int64(2048),
 									Usedcores: int32(0),
 									Totalcore: int32(100),
 								},
@@ -1869,7 +2005,7 @@ func Test_fitInCertainDevice(t *testing.T) {
 				request: util.ContainerDeviceRequest{
 					Nums:             int32(1),
 					Type:             nvidia.NvidiaGPUDevice,
-					Memreq:           int32(100),
+					Memreq:           int64(100),
 					MemPercentagereq: int32(100),
 					Coresreq:         int32(100),
 				},
@@ -1899,8 +2035,8 @@ func Test_fitInCertainDevice(t *testing.T) {
 									Type:      nvidia.NvidiaGPUDevice,
 									Used:      int32(1),
 									Count:     int32(4),
-									Totalmem:  int32(8192),
-									Usedmem:   int32(2048),
+									Totalmem:  int64(8192),
+									Usedmem:   int64(2048),
 									Usedcores: int32(1),
 									Totalcore: int32(1),
 								},
@@ -1911,7 +2047,7 @@ func Test_fitInCertainDevice(t *testing.T) {
 				request: util.ContainerDeviceRequest{
 					Nums:             int32(1),
 					Type:             nvidia.NvidiaGPUDevice,
-					Memreq:           int32(1024),
+					Memreq:           int64(1024),
 					MemPercentagereq: int32(100),
 					Coresreq:         int32(0),
 				},
@@ -1941,8 +2077,8 @@ func Test_fitInCertainDevice(t *testing.T) {
 									Type:      nvidia.NvidiaGPUDevice,
 									Used:      int32(1),
 									Count:     int32(4),
-									Totalmem:  int32(8192),
-									Usedmem:   int32(2048),
+									Totalmem:  int64(8192),
+									Usedmem:   int64(2048),
 									Usedcores: int32(1),
 									Totalcore: int32(4),
 									Mode:      "mig",
@@ -1964,7 +2100,7 @@ func Test_fitInCertainDevice(t *testing.T) {
 				request: util.ContainerDeviceRequest{
 					Nums:             int32(2),
 					Type:             nvidia.NvidiaGPUDevice,
-					Memreq:           int32(1024),
+					Memreq:           int64(1024),
 					MemPercentagereq: int32(100),
 					Coresreq:         int32(1),
 				},
@@ -1979,7 +2115,7 @@ func Test_fitInCertainDevice(t *testing.T) {
 						UUID:      "test-0",
 						Type:      nvidia.NvidiaGPUDevice,
 						Usedcores: int32(1),
-						Usedmem:   int32(1024),
+						Usedmem:   int64(1024),
 					},
 				},
 			},
@@ -2003,8 +2139,8 @@ func Test_fitInCertainDevice(t *testing.T) {
 									Type:      nvidia.NvidiaGPUDevice,
 									Used:      int32(1),
 									Count:     int32(4),
-									Totalmem:  int32(8192),
-									Usedmem:   int32(2048),
+									Totalmem:  int64(8192),
+									Usedmem:   int64(2048),
 									Usedcores: int32(1),
 									Totalcore: int32(4),
 								},
@@ -2015,7 +2151,7 @@ func Test_fitInCertainDevice(t *testing.T) {
 				request: util.ContainerDeviceRequest{
 					Nums:             int32(1),
 					Type:             nvidia.NvidiaGPUDevice,
-					Memreq:           int32(1024),
+					Memreq:           int64(1024),
 					MemPercentagereq: int32(100),
 					Coresreq:         int32(1),
 				},
@@ -2047,8 +2183,8 @@ func Test_fitInCertainDevice(t *testing.T) {
 									Type:      nvidia.NvidiaGPUDevice,
 									Used:      int32(1),
 									Count:     int32(4),
-									Totalmem:  int32(8192),
-									Usedmem:   int32(2048),
+									Totalmem:  int64(8192),
+									Usedmem:   int64(2048),
 									Usedcores: int32(1),
 									Totalcore: int32(4),
 								},
@@ -2059,7 +2195,7 @@ func Test_fitInCertainDevice(t *testing.T) {
 				request: util.ContainerDeviceRequest{
 					Nums:             int32(1),
 					Type:             nvidia.NvidiaGPUDevice,
-					Memreq:           int32(1024),
+					Memreq:           int64(1024),
 					MemPercentagereq: int32(100),
 					Coresreq:         int32(1),
 				},
@@ -2077,10 +2213,52 @@ func Test_fitInCertainDevice(t *testing.T) {
 						UUID:      "test-0",
 						Type:      nvidia.NvidiaGPUDevice,
 						Usedcores: int32(1),
-						Usedmem:   int32(1024),
+						Usedmem:   int64(1024),
+					},
+				},
+			},
+		},
+		{
+			name: "card memory shrank below allocated memory",
+			args: struct {
+				node      *NodeUsage
+				request   util.ContainerDeviceRequest
+				annos     map[string]string
+				pod       *corev1.Pod
+				allocated *util.PodDevices
+			}{
+				node: &NodeUsage{
+					Devices: policy.DeviceUsageList{
+						DeviceLists: []*policy.DeviceListsScore{
+							{
+								Device: &util.DeviceUsage{
+									ID:        "test-0",
+									Numa:      int(1),
+									Type:      nvidia.NvidiaGPUDevice,
+									Used:      int32(1),
+									Count:     int32(4),
+									Totalmem:  int64(7680),
+									Usedmem:   int64(8000),
+									Usedcores: int32(1),
+									Totalcore: int32(100),
+								},
+							},
+						},
 					},
 				},
+				request: util.ContainerDeviceRequest{
+					Nums:             int32(1),
+					Type:             nvidia.NvidiaGPUDevice,
+					Memreq:           int64(0),
+					MemPercentagereq: int32(0),
+					Coresreq:         int32(0),
+				},
+				annos:     map[string]string{},
+				pod:       &corev1.Pod{},
+				allocated: &util.PodDevices{},
 			},
+			want1: false,
+			want2: map[string]util.ContainerDevices{},
 		},
 	}
 	for _, test := range tests {
@@ -2092,6 +2270,202 @@ func Test_fitInCertainDevice(t *testing.T) {
 	}
 }
 
+func Test_fitInCertainDeviceExclusive(t *testing.T) {
+	node := &NodeUsage{
+		Devices: policy.DeviceUsageList{
+			DeviceLists: []*policy.DeviceListsScore{
+				{Device: &util.DeviceUsage{ID: "GPU-0", Type: nvidia.NvidiaGPUDevice, Count: 10, Totalmem: 8192, Totalcore: 100}},
+				{Device: &util.DeviceUsage{ID: "GPU-1", Type: nvidia.NvidiaGPUDevice, Count: 10, Used: 1, Totalmem: 8192, Usedmem: 1024, Usedcores: 10, Totalcore: 100}},
+				{Device: &util.DeviceUsage{ID: "GPU-2", Type: nvidia.NvidiaGPUDevice, Count: 10, Totalmem: 8192, Totalcore: 100, Mode: "mig"}},
+			},
+		},
+	}
+	request := util.ContainerDeviceRequest{Nums: 1, Type: nvidia.NvidiaGPUDevice, Memreq: 1024, MemPercentagereq: 101, Coresreq: 10}
+	annos := map[string]string{util.Exclusive: "true"}
+	fit, devs := fitInCertainDevice(node, request, annos, &corev1.Pod{}, &util.PodDevices{})
+	assert.Equal(t, fit, true)
+	assert.DeepEqual(t, devs[nvidia.NvidiaGPUDevice], util.ContainerDevices{
+		{UUID: "GPU-0", Type: nvidia.NvidiaGPUDevice, Usedmem: 8192, Usedcores: 100},
+	})
+
+	request.Nums = 2
+	fit, _ = fitInCertainDevice(node, request, annos, &corev1.Pod{}, &util.PodDevices{})
+	assert.Equal(t, fit, false)
+}
+
+func Test_fitInCertainDeviceConfidentialCompute(t *testing.T) {
+	node := &NodeUsage{
+		Devices: policy.DeviceUsageList{
+			DeviceLists: []*policy.DeviceListsScore{
+				{Device: &util.DeviceUsage{ID: "GPU-0", Type: nvidia.NvidiaGPUDevice, Count: 10, Totalmem: 8192, Totalcore: 100, ConfidentialCompute: true}},
+				{Device: &util.DeviceUsage{ID: "GPU-1", Type: nvidia.NvidiaGPUDevice, Count: 10, Totalmem: 8192, Totalcore: 100}},
+			},
+		},
+	}
+	request := util.ContainerDeviceRequest{Nums: 1, Type: nvidia.NvidiaGPUDevice, Memreq: 1024, MemPercentagereq: 101}
+	tests := []struct {
+		name  string
+		annos map[string]string
+		want  string
+	}{
+		{name: "required", annos: map[string]string{util.ConfidentialCompute: util.ConfidentialComputeRequired}, want: "GPU-0"},
+		{name: "forbidden", annos: map[string]string{util.ConfidentialCompute: util.ConfidentialComputeForbidden}, want: "GPU-1"},
+		{name: "no preference", annos: map[string]string{}, want: "GPU-1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fit, devs := fitInCertainDevice(node, request, test.annos, &corev1.Pod{}, &util.PodDevices{})
+			assert.Equal(t, fit, true)
+			assert.Equal(t, devs[nvidia.NvidiaGPUDevice][0].UUID, test.want)
+		})
+	}
+}
+
+func Test_preferPerfTier(t *testing.T) {
+	newNode := func(policyName string, tiers ...int) *NodeUsage {
+		devs := []*policy.DeviceListsScore{}
+		for i, tier := range tiers {
+			devs = append(devs, &policy.DeviceListsScore{Score: 10, Device: &util.DeviceUsage{ID: fmt.Sprintf("GPU-%d", i), PerfTier: tier}})
+		}
+		return &NodeUsage{Devices: policy.DeviceUsageList{Policy: policyName, DeviceLists: devs}}
+	}
+	node := newNode(util.GPUSchedulerPolicySpread.String(), 2, 4, 0, 3)
+	preferPerfTier(node, 10)
+	assert.Equal(t, node.Devices.DeviceLists[0].Score, float32(10))
+	assert.Equal(t, node.Devices.DeviceLists[1].Score, float32(0))
+	assert.Equal(t, node.Devices.DeviceLists[2].Score, float32(10))
+	assert.Equal(t, node.Devices.DeviceLists[3].Score, float32(5))
+
+	node = newNode(util.GPUSchedulerPolicyBinpack.String(), 2, 4)
+	preferPerfTier(node, 10)
+	assert.Equal(t, node.Devices.DeviceLists[1].Score, float32(20))
+
+	node = newNode(util.GPUSchedulerPolicyBinpack.String(), 3, 3, 0)
+	preferPerfTier(node, 10)
+	for _, d := range node.Devices.DeviceLists {
+		assert.Equal(t, d.Score, float32(10))
+	}
+}
+
+func Test_preferLowUtilization(t *testing.T) {
+	now := time.Now()
+	newNode := func(policyName string, utils ...*util.DeviceUtilization) *NodeUsage {
+		devs := []*policy.DeviceListsScore{}
+		for i, u := range utils {
+			devs = append(devs, &policy.DeviceListsScore{Score: 10, Device: &util.DeviceUsage{ID: fmt.Sprintf("GPU-%d", i), Utilization: u}})
+		}
+		return &NodeUsage{Devices: policy.DeviceUsageList{Policy: policyName, DeviceLists: devs}}
+	}
+	stale := &util.DeviceUtilization{SM: 0, Timestamp: now.Add(-time.Hour)}
+	node := newNode(util.GPUSchedulerPolicySpread.String(),
+		&util.DeviceUtilization{SM: 90, Memory: 10, Timestamp: now},
+		&util.DeviceUtilization{SM: 10, Memory: 50, Timestamp: now},
+		&util.DeviceUtilization{SM: 10, Memory: 10, Timestamp: now},
+		nil, stale)
+	preferLowUtilization(node, 10, time.Minute, now)
+	assert.Equal(t, node.Devices.DeviceLists[0].Score, float32(10))
+	assert.Equal(t, node.Devices.DeviceLists[1].Score, float32(5))
+	assert.Equal(t, node.Devices.DeviceLists[2].Score, float32(0))
+	assert.Equal(t, node.Devices.DeviceLists[3].Score, float32(10))
+	assert.Equal(t, node.Devices.DeviceLists[4].Score, float32(10))
+
+	node = newNode(util.GPUSchedulerPolicyBinpack.String(),
+		&util.DeviceUtilization{SM: 100, Timestamp: now},
+		&util.DeviceUtilization{SM: 0, Timestamp: now})
+	preferLowUtilization(node, 10, time.Minute, now)
+	assert.Equal(t, node.Devices.DeviceLists[0].Score, float32(10))
+	assert.Equal(t, node.Devices.DeviceLists[1].Score, float32(20))
+
+	node = newNode(util.GPUSchedulerPolicyBinpack.String(), stale, &util.DeviceUtilization{SM: 40, Timestamp: now})
+	preferLowUtilization(node, 10, time.Minute, now)
+	for _, d := range node.Devices.DeviceLists {
+		assert.Equal(t, d.Score, float32(10))
+	}
+}
+
+func Test_preferUncontendedSwitch(t *testing.T) {
+	newNode := func(policyName string, switches ...string) *NodeUsage {
+		devs := []*policy.DeviceListsScore{}
+		for i, sw := range switches {
+			devs = append(devs, &policy.DeviceListsScore{Score: 10, Device: &util.DeviceUsage{ID: fmt.Sprintf("GPU-%d", i), PCIeSwitch: sw}})
+		}
+		return &NodeUsage{Devices: policy.DeviceUsageList{Policy: policyName, DeviceLists: devs}}
+	}
+	heavy := func(uuids ...string) util.PodDevices {
+		ctr := util.ContainerDevices{}
+		for _, uuid := range uuids {
+			ctr = append(ctr, util.ContainerDevice{UUID: uuid, Type: nvidia.NvidiaGPUDevice})
+		}
+		return util.PodDevices{nvidia.NvidiaGPUDevice: util.PodSingleDevice{ctr}}
+	}
+
+	node := newNode(util.GPUSchedulerPolicySpread.String(), "sw0", "sw0", "sw1", "sw2", "")
+	// A pod on two cards of one switch counts once.
+	addSwitchLoad(node, heavy("GPU-0", "GPU-1"))
+	addSwitchLoad(node, heavy("GPU-0"))
+	addSwitchLoad(node, heavy("GPU-2", "GPU-4"))
+	assert.DeepEqual(t, node.switchLoad, map[string]int{"sw0": 2, "sw1": 1})
+
+	preferUncontendedSwitch(node, 10)
+	assert.Equal(t, node.Devices.DeviceLists[0].Score, float32(10))
+	assert.Equal(t, node.Devices.DeviceLists[1].Score, float32(10))
+	assert.Equal(t, node.Devices.DeviceLists[2].Score, float32(5))
+	assert.Equal(t, node.Devices.DeviceLists[3].Score, float32(0))
+	assert.Equal(t, node.Devices.DeviceLists[4].Score, float32(10))
+
+	assert.Equal(t, switchContentionScore(node, heavy("GPU-3")), float32(1))
+	assert.Equal(t, switchContentionScore(node, heavy("GPU-3", "GPU-1")), float32(1)/3)
+
+	node = newNode(util.GPUSchedulerPolicyBinpack.String(), "sw0", "sw1")
+	addSwitchLoad(node, heavy("GPU-0"))
+	preferUncontendedSwitch(node, 10)
+	assert.Equal(t, node.Devices.DeviceLists[0].Score, float32(10))
+	assert.Equal(t, node.Devices.DeviceLists[1].Score, float32(20))
+
+	node = newNode(util.GPUSchedulerPolicyBinpack.String(), "sw0", "sw1")
+	preferUncontendedSwitch(node, 10)
+	for _, d := range node.Devices.DeviceLists {
+		assert.Equal(t, d.Score, float32(10))
+	}
+}
+
+func Test_fitInSamePCIeSwitch(t *testing.T) {
+	newNode := func() *NodeUsage {
+		devs := []*policy.DeviceListsScore{}
+		for i, sw := range []string{"sw-a", "sw-b", "sw-b", "sw-a", ""} {
+			devs = append(devs, &policy.DeviceListsScore{
+				Device: &util.DeviceUsage{
+					ID:         fmt.Sprintf("GPU-%d", i),
+					Index:      uint(i),
+					Type:       nvidia.NvidiaGPUDevice,
+					Count:      10,
+					Totalmem:   8000,
+					Totalcore:  100,
+					PCIeSwitch: sw,
+				},
+			})
+		}
+		return &NodeUsage{Devices: policy.DeviceUsageList{Policy: util.GPUSchedulerPolicySpread.String(), DeviceLists: devs}}
+	}
+	request := util.ContainerDeviceRequest{Nums: 2, Type: nvidia.NvidiaGPUDevice, Memreq: 1000, MemPercentagereq: 101, Coresreq: 10}
+
+	fit, devs := fitInSamePCIeSwitch(newNode(), request, map[string]string{}, &corev1.Pod{}, &util.PodDevices{})
+	assert.Equal(t, fit, true)
+	assert.Equal(t, len(devs[nvidia.NvidiaGPUDevice]), 2)
+	assert.Equal(t, devs[nvidia.NvidiaGPUDevice][0].UUID, "GPU-3")
+	assert.Equal(t, devs[nvidia.NvidiaGPUDevice][1].UUID, "GPU-0")
+
+	request.Nums = 3
+	fit, _ = fitInSamePCIeSwitch(newNode(), request, map[string]string{}, &corev1.Pod{}, &util.PodDevices{})
+	assert.Equal(t, fit, false)
+
+	request.Nums = 1
+	allocated := util.PodDevices{nvidia.NvidiaGPUDevice: util.PodSingleDevice{{{UUID: "GPU-2"}}}}
+	fit, devs = fitInSamePCIeSwitch(newNode(), request, map[string]string{}, &corev1.Pod{}, &allocated)
+	assert.Equal(t, fit, true)
+	assert.Equal(t, devs[nvidia.NvidiaGPUDevice][0].UUID, "GPU-2")
+}
+
 func Test_fitInDevices(t *testing.T) {
 	tests := []struct {
 		name string
@@ -2124,8 +2498,8 @@ func Test_fitInDevices(t *testing.T) {
 									Type:      nvidia.NvidiaGPUDevice,
 									Used:      int32(1),
 									Count:     int32(4),
-									Totalmem:  int32(8192),
-									Usedmem:   int32(2048),
+									Totalmem:  int64(8192),
+									Usedmem:   int64(2048),
 									Usedcores: int32(1),
 									Totalcore: int32(4),
 								},
@@ -2137,8 +2511,8 @@ func Test_fitInDevices(t *testing.T) {
 									Type:      nvidia.NvidiaGPUDevice,
 									Used:      int32(1),
 									Count:     int32(4),
-									Totalmem:  int32(8192),
-									Usedmem:   int32(2048),
+									Totalmem:  int64(8192),
+									Usedmem:   int64(2048),
 									Usedcores: int32(1),
 									Totalcore: int32(4),
 								},
@@ -2150,7 +2524,7 @@ func Test_fitInDevices(t *testing.T) {
 					"test-2": {
 						Nums:             int32(1),
 						Type:             nvidia.NvidiaGPUDevice,
-						Memreq:           int32(1024),
+						Memreq:           int64(1024),
 						MemPercentagereq: int32(100),
 						Coresreq:         int32(1),
 					},
@@ -2181,8 +2555,8 @@ func Test_fitInDevices(t *testing.T) {
 									Type:      nvidia.NvidiaGPUDevice,
 									Used:      int32(1),
 									Count:     int32(4),
-									Totalmem:  int32(8192),
-									Usedmem:   int32(2048),
+									Totalmem:  int64(8192),
+									Usedmem:   int64(2048),
 									Usedcores: int32(1),
 									Totalcore: int32(4),
 								},
@@ -2194,7 +2568,7 @@ func Test_fitInDevices(t *testing.T) {
 					"test-1": {
 						Nums:             int32(2),
 						Type:             nvidia.NvidiaGPUDevice,
-						Memreq:           int32(1024),
+						Memreq:           int64(1024),
 						MemPercentagereq: int32(100),
 						Coresreq:         int32(1),
 					},
@@ -2225,8 +2599,8 @@ func Test_fitInDevices(t *testing.T) {
 									Type:      nvidia.NvidiaGPUDevice,
 									Used:      int32(1),
 									Count:     int32(4),
-									Totalmem:  int32(8192),
-									Usedmem:   int32(2048),
+									Totalmem:  int64(8192),
+									Usedmem:   int64(2048),
 									Usedcores: int32(1),
 									Totalcore: int32(4),
 								},
@@ -2238,7 +2612,7 @@ func Test_fitInDevices(t *testing.T) {
 					"test-1": {
 						Nums:             int32(1),
 						Type:             "test",
-						Memreq:           int32(1024),
+						Memreq:           int64(1024),
 						MemPercentagereq: int32(100),
 						Coresreq:         int32(1),
 					},
@@ -2260,3 +2634,45 @@ func Test_fitInDevices(t *testing.T) {
 		})
 	}
 }
+
+func Test_normalizeImageName(t *testing.T) {
+	tests := map[string]string{
+		"nginx":                        "docker.io/library/nginx:latest",
+		"nginx:1.25":                   "docker.io/library/nginx:1.25",
+		"library/nginx:1.25":           "docker.io/library/nginx:1.25",
+		"docker.io/library/nginx:1.25": "docker.io/library/nginx:1.25",
+		"nvcr.io/nvidia/cuda:12.2":     "nvcr.io/nvidia/cuda:12.2",
+		"localhost/app":                "localhost/app:latest",
+		"registry:5000/app":            "registry:5000/app:latest",
+		"nginx@sha256:abcd":            "docker.io/library/nginx@sha256:abcd",
+	}
+	for in, want := range tests {
+		assert.Equal(t, normalizeImageName(in), want, in)
+	}
+}
+
+func Test_imageLocalityScore(t *testing.T) {
+	node := &corev1.Node{
+		Status: corev1.NodeStatus{
+			Images: []corev1.ContainerImage{
+				{Names: []string{"docker.io/library/nginx@sha256:abcd", "docker.io/library/nginx:1.25"}, SizeBytes: 300},
+				{Names: []string{"nvcr.io/nvidia/cuda:12.2"}, SizeBytes: 100},
+				{Names: []string{"registry.local/sizeless:1"}},
+			},
+		},
+	}
+	pod := func(images ...string) *corev1.Pod {
+		p := &corev1.Pod{}
+		for _, img := range images {
+			p.Spec.Containers = append(p.Spec.Containers, corev1.Container{Image: img})
+		}
+		return p
+	}
+	assert.Equal(t, imageLocalityScore(node, pod("nginx:1.25")), float32(1))
+	assert.Equal(t, imageLocalityScore(node, pod("busybox")), float32(0))
+	assert.Equal(t, imageLocalityScore(node, pod("nvcr.io/nvidia/cuda:12.2", "busybox")), float32(0.25))
+	assert.Equal(t, imageLocalityScore(&corev1.Node{}, pod("nginx")), float32(0))
+	// Cached images without a size still count as cached.
+	assert.Equal(t, imageLocalityScore(node, pod("registry.local/sizeless:1")), float32(1))
+	assert.Equal(t, imageLocalityScore(node, pod("registry.local/sizeless:1", "busybox")), float32(0.5))
+}
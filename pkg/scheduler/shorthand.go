@@ -0,0 +1,187 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// gpuShorthand is a parsed hami.io/gpu annotation, zero fields are unset.
+type gpuShorthand struct {
+	count         int64
+	memMiB        int64
+	memPercentage int64
+	cores         int64
+}
+
+// parseGPUShorthand parses "count=2,mem=8Gi,cores=50". count defaults to 1, mem is a quantity
+// with a unit and must be a whole number of MiB, mem-percentage and cores are percentages.
+func parseGPUShorthand(value string) (gpuShorthand, error) {
+	res := gpuShorthand{count: 1}
+	seen := make([]string, 0)
+	for _, entry := range strings.Split(value, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if !ok || k == "" || v == "" {
+			return res, fmt.Errorf("entry %q is not of the form key=value", strings.TrimSpace(entry))
+		}
+		if slices.Contains(seen, k) {
+			return res, fmt.Errorf("key %s is set twice", k)
+		}
+		seen = append(seen, k)
+		var err error
+		switch k {
+		case "count":
+			res.count, err = parseShorthandInt(k, v, 1, math.MaxInt32)
+		case "mem":
+			res.memMiB, err = parseShorthandMemory(v)
+		case "mem-percentage":
+			res.memPercentage, err = parseShorthandInt(k, v, 1, 100)
+		case "cores":
+			res.cores, err = parseShorthandInt(k, v, 1, 100)
+		default:
+			return res, fmt.Errorf("unknown key %s, expected count, mem, mem-percentage or cores", k)
+		}
+		if err != nil {
+			return res, err
+		}
+	}
+	if res.memMiB > 0 && res.memPercentage > 0 {
+		return res, fmt.Errorf("mem and mem-percentage are exclusive")
+	}
+	return res, nil
+}
+
+func parseShorthandInt(key, value string, lo, hi int64) (int64, error) {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < lo || n > hi {
+		return 0, fmt.Errorf("%s must be an integer between %d and %d, got %q", key, lo, hi, value)
+	}
+	return n, nil
+}
+
+// parseShorthandMemory requires a unit, as a bare number would be bytes for a quantity
+// but MiB for the memory resource.
+func parseShorthandMemory(value string) (int64, error) {
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return 0, fmt.Errorf("mem needs a unit, e.g. %sMi or %sGi, got %q", value, value, value)
+	}
+	q, err := resource.ParseQuantity(value)
+	if err != nil {
+		return 0, fmt.Errorf("mem must be a quantity like 8Gi, got %q", value)
+	}
+	b, ok := q.AsInt64()
+	if !ok || b <= 0 || b%util.MiB != 0 {
+		return 0, fmt.Errorf("mem must be a positive whole number of MiB, got %q", value)
+	}
+	if b/util.MiB > math.MaxInt32 {
+		return 0, fmt.Errorf("mem is too large, got %q", value)
+	}
+	return b / util.MiB, nil
+}
+
+// expandGPUShorthand turns the hami.io/gpu annotations of pod into the NVIDIA device resources
+// of the containers they target. The annotations are kept for reference.
+func expandGPUShorthand(pod *corev1.Pod) error {
+	targets, err := annotatedContainers(pod, util.GPUShorthand, util.GPUShorthandPrefix)
+	if err != nil || len(targets) == 0 {
+		return err
+	}
+	dev, ok := device.GetDevices()[nvidia.NvidiaGPUDevice].(*nvidia.NvidiaGPUDevices)
+	if !ok {
+		return fmt.Errorf("annotation %s needs the NVIDIA device to be enabled", util.GPUShorthand)
+	}
+	for idx := range pod.Spec.Containers {
+		c := &pod.Spec.Containers[idx]
+		value, ok := targets[c.Name]
+		if !ok {
+			continue
+		}
+		req, err := parseGPUShorthand(value)
+		if err != nil {
+			return fmt.Errorf("container %s: invalid %s annotation: %v", c.Name, util.GPUShorthand, err)
+		}
+		if err := setGPUResources(c, dev, req, util.GPUShorthand); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// annotatedContainers maps the containers of pod to the value of the annotation key, which
+// targets the only container, or key prefix followed by the container name.
+func annotatedContainers(pod *corev1.Pod, key, prefix string) (map[string]string, error) {
+	targets := make(map[string]string)
+	if v, ok := pod.Annotations[key]; ok {
+		if len(pod.Spec.Containers) != 1 {
+			return nil, fmt.Errorf("annotation %s is ambiguous for a pod with %d containers, use %s<container>", key, len(pod.Spec.Containers), prefix)
+		}
+		targets[pod.Spec.Containers[0].Name] = v
+	}
+	for k, v := range pod.Annotations {
+		name, ok := strings.CutPrefix(k, prefix)
+		if !ok {
+			continue
+		}
+		if _, dup := targets[name]; dup {
+			return nil, fmt.Errorf("annotations %s and %s both target container %s", key, k, name)
+		}
+		if !slices.ContainsFunc(pod.Spec.Containers, func(c corev1.Container) bool { return c.Name == name }) {
+			return nil, fmt.Errorf("annotation %s targets container %s which the pod doesn't have", k, name)
+		}
+		targets[name] = v
+	}
+	return targets, nil
+}
+
+// setGPUResources sets the NVIDIA device resource limits of c to req, source is the
+// annotation req was read from.
+func setGPUResources(c *corev1.Container, dev *nvidia.NvidiaGPUDevices, req gpuShorthand, source string) error {
+	countName, memName, memPercentageName := dev.ResourceNames()
+	names := []string{countName, memName, memPercentageName, dev.CoreResourceName()}
+	for _, list := range []corev1.ResourceList{c.Resources.Limits, c.Resources.Requests} {
+		for _, name := range names {
+			if _, ok := list[corev1.ResourceName(name)]; ok {
+				return fmt.Errorf("container %s: %s conflicts with the explicit resource %s, use one of them", c.Name, source, name)
+			}
+		}
+	}
+	if c.Resources.Limits == nil {
+		c.Resources.Limits = corev1.ResourceList{}
+	}
+	set := func(name string, n int64) {
+		if n > 0 {
+			c.Resources.Limits[corev1.ResourceName(name)] = *resource.NewQuantity(n, resource.DecimalSI)
+		}
+	}
+	set(countName, req.count)
+	set(memName, req.memMiB)
+	set(memPercentageName, req.memPercentage)
+	set(dev.CoreResourceName(), req.cores)
+	return nil
+}
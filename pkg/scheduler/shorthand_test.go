@@ -0,0 +1,108 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func Test_parseGPUShorthand(t *testing.T) {
+	tests := []struct {
+		value string
+		want  gpuShorthand
+		err   string
+	}{
+		{value: "count=2,mem=8Gi,cores=50", want: gpuShorthand{count: 2, memMiB: 8192, cores: 50}},
+		{value: " mem = 3000Mi ", want: gpuShorthand{count: 1, memMiB: 3000}},
+		{value: "mem-percentage=50", want: gpuShorthand{count: 1, memPercentage: 50}},
+		{value: "count=1", want: gpuShorthand{count: 1}},
+		{value: "", err: "not of the form key=value"},
+		{value: "count=2,", err: "not of the form key=value"},
+		{value: "count", err: "not of the form key=value"},
+		{value: "count=2,count=3", err: "set twice"},
+		{value: "gpus=2", err: "unknown key gpus"},
+		{value: "count=0", err: "between 1 and"},
+		{value: "cores=101", err: "between 1 and 100"},
+		{value: "cores=half", err: "between 1 and 100"},
+		{value: "mem=8000", err: "needs a unit"},
+		{value: "mem=8G", err: "whole number of MiB"},
+		{value: "mem=lots", err: "quantity"},
+		{value: "mem=4Gi,mem-percentage=50", err: "exclusive"},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			got, err := parseGPUShorthand(test.value)
+			if test.err != "" {
+				assert.ErrorContains(t, err, test.err)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, got, test.want)
+		})
+	}
+}
+
+func Test_expandGPUShorthand(t *testing.T) {
+	newPod := func(annos map[string]string, ctrs ...corev1.Container) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "p1", Annotations: annos}, Spec: corev1.PodSpec{Containers: ctrs}}
+	}
+	limit := func(pod *corev1.Pod, idx int, name string) string {
+		q, ok := pod.Spec.Containers[idx].Resources.Limits[corev1.ResourceName(name)]
+		if !ok {
+			return ""
+		}
+		return q.String()
+	}
+
+	pod := newPod(map[string]string{util.GPUShorthand: "count=2,mem=8Gi,cores=50"}, corev1.Container{Name: "main"})
+	assert.NilError(t, expandGPUShorthand(pod))
+	assert.Equal(t, limit(pod, 0, "hami.io/gpu"), "2")
+	assert.Equal(t, limit(pod, 0, "hami.io/gpumem"), "8192")
+	assert.Equal(t, limit(pod, 0, "hami.io/gpucores"), "50")
+	assert.Equal(t, limit(pod, 0, "hami.io/gpumem-percentage"), "")
+
+	pod = newPod(map[string]string{util.GPUShorthandPrefix + "train": "mem-percentage=50"}, corev1.Container{Name: "sidecar"}, corev1.Container{Name: "train"})
+	assert.NilError(t, expandGPUShorthand(pod))
+	assert.Equal(t, len(pod.Spec.Containers[0].Resources.Limits), 0)
+	assert.Equal(t, limit(pod, 1, "hami.io/gpu"), "1")
+	assert.Equal(t, limit(pod, 1, "hami.io/gpumem-percentage"), "50")
+
+	explicit := corev1.Container{Name: "main", Resources: corev1.ResourceRequirements{Limits: corev1.ResourceList{"hami.io/gpu": *resource.NewQuantity(1, resource.DecimalSI)}}}
+	tests := []struct {
+		name string
+		pod  *corev1.Pod
+		err  string
+	}{
+		{name: "ambiguous", pod: newPod(map[string]string{util.GPUShorthand: "count=1"}, corev1.Container{Name: "a"}, corev1.Container{Name: "b"}), err: "ambiguous"},
+		{name: "both forms", pod: newPod(map[string]string{util.GPUShorthand: "count=1", util.GPUShorthandPrefix + "a": "count=1"}, corev1.Container{Name: "a"}), err: "both target container a"},
+		{name: "unknown container", pod: newPod(map[string]string{util.GPUShorthandPrefix + "b": "count=1"}, corev1.Container{Name: "a"}), err: "doesn't have"},
+		{name: "explicit resources", pod: newPod(map[string]string{util.GPUShorthand: "count=1"}, explicit), err: "conflicts with the explicit resource hami.io/gpu"},
+		{name: "invalid value", pod: newPod(map[string]string{util.GPUShorthand: "mem=8000"}, corev1.Container{Name: "a"}), err: "container a: invalid"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.ErrorContains(t, expandGPUShorthand(test.pod), test.err)
+		})
+	}
+}
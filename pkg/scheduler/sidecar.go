@@ -0,0 +1,89 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"slices"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+)
+
+const (
+	// MetricsSidecarAnnotation turns metrics sidecar injection on ("true") or off ("false") for a pod,
+	// overriding the namespace default.
+	MetricsSidecarAnnotation = "hami.io/metrics-sidecar"
+
+	metricsSidecarName          = "hami-metrics"
+	metricsSidecarVolumeName    = "hami-metrics-cache"
+	metricsSidecarContainerPath = "/hami/containers"
+	metricsSidecarPodUIDEnv     = "HAMI_POD_UID"
+)
+
+// metricsSidecarEnabled reports whether the metrics sidecar should be injected into pod.
+func metricsSidecarEnabled(pod *corev1.Pod) bool {
+	if config.MetricsSidecarImage == "" {
+		return false
+	}
+	if value, ok := pod.Annotations[MetricsSidecarAnnotation]; ok {
+		enabled, _ := strconv.ParseBool(value)
+		return enabled
+	}
+	return slices.Contains(config.MetricsSidecarNamespaces, pod.Namespace)
+}
+
+// injectMetricsSidecar appends the metrics sidecar to pod. The sidecar gets no GPU of
+// its own; it only sees the HAMi-core cache directories of the GPU containers listed in
+// gpuContainers, which hold the usage of the devices assigned to this pod.
+func injectMetricsSidecar(pod *corev1.Pod, gpuContainers []string) {
+	for _, ctr := range pod.Spec.Containers {
+		if ctr.Name == metricsSidecarName {
+			return
+		}
+	}
+	sidecar := corev1.Container{
+		Name:  metricsSidecarName,
+		Image: config.MetricsSidecarImage,
+		Args:  config.MetricsSidecarArgs,
+		Env: []corev1.EnvVar{
+			// Keep the NVIDIA runtime from exposing any GPU to the sidecar.
+			{Name: "NVIDIA_VISIBLE_DEVICES", Value: "none"},
+			{Name: "HAMI_POD_NAME", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"}}},
+			{Name: "HAMI_POD_NAMESPACE", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.namespace"}}},
+			{Name: metricsSidecarPodUIDEnv, ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.uid"}}},
+		},
+	}
+	for _, name := range gpuContainers {
+		// The device plugin keeps the cache of each container in <host path>/<pod uid>_<container name>.
+		sidecar.VolumeMounts = append(sidecar.VolumeMounts, corev1.VolumeMount{
+			Name:        metricsSidecarVolumeName,
+			MountPath:   metricsSidecarContainerPath + "/" + name,
+			SubPathExpr: "$(" + metricsSidecarPodUIDEnv + ")_" + name,
+			ReadOnly:    true,
+		})
+	}
+	hostPathType := corev1.HostPathDirectoryOrCreate
+	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+		Name: metricsSidecarVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			HostPath: &corev1.HostPathVolumeSource{Path: config.MetricsSidecarCacheHostPath, Type: &hostPathType},
+		},
+	})
+	pod.Spec.Containers = append(pod.Spec.Containers, sidecar)
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+)
+
+func Test_metricsSidecarEnabled(t *testing.T) {
+	defer func() {
+		config.MetricsSidecarImage = ""
+		config.MetricsSidecarNamespaces = nil
+	}()
+	newPod := func(namespace string, annos map[string]string) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Annotations: annos}}
+	}
+	tests := []struct {
+		name       string
+		image      string
+		namespaces []string
+		pod        *corev1.Pod
+		want       bool
+	}{
+		{name: "no image configured", namespaces: []string{"ml"}, pod: newPod("ml", nil), want: false},
+		{name: "namespace enabled", image: "metrics:v1", namespaces: []string{"ml"}, pod: newPod("ml", nil), want: true},
+		{name: "namespace not enabled", image: "metrics:v1", namespaces: []string{"ml"}, pod: newPod("default", nil), want: false},
+		{name: "pod opts in", image: "metrics:v1", pod: newPod("default", map[string]string{MetricsSidecarAnnotation: "true"}), want: true},
+		{name: "pod opts out", image: "metrics:v1", namespaces: []string{"ml"}, pod: newPod("ml", map[string]string{MetricsSidecarAnnotation: "false"}), want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config.MetricsSidecarImage = test.image
+			config.MetricsSidecarNamespaces = test.namespaces
+			assert.Equal(t, metricsSidecarEnabled(test.pod), test.want)
+		})
+	}
+}
+
+func Test_injectMetricsSidecar(t *testing.T) {
+	config.MetricsSidecarImage = "metrics:v1"
+	config.MetricsSidecarArgs = []string{"--port=9400"}
+	config.MetricsSidecarCacheHostPath = "/usr/local/vgpu/containers"
+	defer func() {
+		config.MetricsSidecarImage = ""
+		config.MetricsSidecarArgs = nil
+	}()
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "train"}, {Name: "logger"}},
+		},
+	}
+	injectMetricsSidecar(pod, []string{"train"})
+	assert.Equal(t, len(pod.Spec.Containers), 3)
+	sidecar := pod.Spec.Containers[2]
+	assert.Equal(t, sidecar.Name, metricsSidecarName)
+	assert.Equal(t, sidecar.Image, "metrics:v1")
+	assert.DeepEqual(t, sidecar.Args, []string{"--port=9400"})
+	assert.Equal(t, len(sidecar.VolumeMounts), 1)
+	assert.Equal(t, sidecar.VolumeMounts[0].SubPathExpr, "$(HAMI_POD_UID)_train")
+	assert.Equal(t, sidecar.VolumeMounts[0].ReadOnly, true)
+	assert.Equal(t, sidecar.Resources.Limits == nil, true)
+	assert.Equal(t, len(pod.Spec.Volumes), 1)
+	assert.Equal(t, pod.Spec.Volumes[0].HostPath.Path, "/usr/local/vgpu/containers")
+
+	// Injecting again must not add a second sidecar.
+	injectMetricsSidecar(pod, []string{"train"})
+	assert.Equal(t, len(pod.Spec.Containers), 3)
+	assert.Equal(t, len(pod.Spec.Volumes), 1)
+}
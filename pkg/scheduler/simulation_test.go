@@ -0,0 +1,302 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// simCluster drives a scheduler through a sequence of pods and failures the way kube-scheduler
+// and the pod informer would: pods are placed one at a time with the filter logic, in the order
+// they were submitted, and a failure evicts the pods it hits and retries every pending pod.
+// Nodes are tried in name order and ties go to the first name, so a sequence always ends the same.
+type simCluster struct {
+	t *testing.T
+	s *Scheduler
+	// cordoned nodes are left out of the candidates, like kube-scheduler does.
+	cordoned map[string]bool
+	// queue holds the pods not placed yet, in submission order.
+	queue []*corev1.Pod
+	// reasons are why the pods of queue didn't fit the last time they were tried.
+	reasons map[string]string
+	// running are the placed pods, by name.
+	running map[string]*corev1.Pod
+	// submitted is the position of every pod in submission order, evicted pods keep theirs.
+	submitted map[string]int
+}
+
+// simReport is the state a sequence of a simCluster ends in.
+type simReport struct {
+	// Placement is the node of every placed pod.
+	Placement map[string]string
+	// Pending is why every pod not placed doesn't fit.
+	Pending map[string]string
+	// Used counts the pods using every card, unhealthy ones included.
+	Used map[string]int32
+}
+
+func newSimCluster(t *testing.T, nodes map[string]int) *simCluster {
+	prev := device.ActiveConfig()
+	initTFLOPSDevices(t)
+	t.Cleanup(func() { assert.NilError(t, device.InitDevicesWithConfig(prev)) })
+
+	c := &simCluster{
+		t:         t,
+		s:         NewScheduler(),
+		cordoned:  make(map[string]bool),
+		reasons:   make(map[string]string),
+		running:   make(map[string]*corev1.Pod),
+		submitted: make(map[string]int),
+	}
+	for nodeID, cards := range nodes {
+		info := &util.NodeInfo{ID: nodeID, Node: &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: nodeID}}}
+		for i := 0; i < cards; i++ {
+			info.Devices = append(info.Devices, util.DeviceInfo{
+				ID: fmt.Sprintf("%s-gpu%d", nodeID, i), Index: uint(i), Count: 10, Devmem: 8000, Devcore: 100,
+				Type: "NVIDIA-Tesla T4", Health: true, DeviceVendor: nvidia.NvidiaGPUDevice,
+			})
+		}
+		c.s.addNode(nodeID, info)
+	}
+	return c
+}
+
+// simPod is a pod asking for one card with mem MiB of memory.
+func simPod(name string, mem string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: k8stypes.UID(name)},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name: "main",
+			Resources: corev1.ResourceRequirements{Limits: corev1.ResourceList{
+				"hami.io/gpu":    resource.MustParse("1"),
+				"hami.io/gpumem": resource.MustParse(mem),
+			}},
+		}}},
+	}
+}
+
+// submit queues pods and places what fits.
+func (c *simCluster) submit(pods ...*corev1.Pod) {
+	for _, p := range pods {
+		c.submitted[p.Name] = len(c.submitted)
+		c.queue = append(c.queue, p)
+	}
+	c.schedule()
+}
+
+// schedule tries every pending pod once, in submission order.
+func (c *simCluster) schedule() {
+	var names []string
+	nodes, err := c.s.ListNodes()
+	assert.NilError(c.t, err)
+	for nodeID := range nodes {
+		if !c.cordoned[nodeID] {
+			names = append(names, nodeID)
+		}
+	}
+	sort.Strings(names)
+	sort.SliceStable(c.queue, func(i, j int) bool { return c.submitted[c.queue[i].Name] < c.submitted[c.queue[j].Name] })
+
+	var pending []*corev1.Pod
+	for _, p := range c.queue {
+		usage, failedNodes, err := c.s.getNodesUsage(&names, p)
+		assert.NilError(c.t, err)
+		planned, err := c.s.planPod(p, *usage, failedNodes, len(names))
+		assert.NilError(c.t, err)
+		if !planned.Fit {
+			c.reasons[p.Name] = planned.Reason
+			pending = append(pending, p)
+			continue
+		}
+		delete(c.reasons, p.Name)
+		c.s.addPod(p, planned.Node, planned.Devices)
+		c.running[p.Name] = p
+	}
+	c.queue = pending
+}
+
+// evict deletes the running pods matching hit and queues them again, like their controllers would.
+func (c *simCluster) evict(hit func(*podInfo) bool) {
+	for _, pi := range c.s.ListPodsInfo() {
+		if !hit(pi) {
+			continue
+		}
+		p := c.running[pi.Name]
+		c.s.delPod(p)
+		delete(c.running, pi.Name)
+		c.queue = append(c.queue, p)
+	}
+}
+
+// failCard has the device plugin of nodeID report card unhealthy, evicts the pods using it and
+// retries the pending pods.
+func (c *simCluster) failCard(nodeID, card string) {
+	info, err := c.s.GetNode(nodeID)
+	assert.NilError(c.t, err)
+	devices := slices.Clone(info.Devices)
+	found := false
+	for i := range devices {
+		if devices[i].ID == card {
+			devices[i].Health = false
+			found = true
+		}
+	}
+	assert.Assert(c.t, found, "node %s has no card %s", nodeID, card)
+	c.s.addNode(nodeID, &util.NodeInfo{ID: nodeID, Node: info.Node, Devices: devices})
+	c.evict(func(pi *podInfo) bool {
+		for _, ctrs := range pi.Devices {
+			for _, ctr := range ctrs {
+				for _, d := range ctr {
+					if d.UUID == card {
+						return true
+					}
+				}
+			}
+		}
+		return false
+	})
+	c.schedule()
+}
+
+// cordon keeps new pods off nodeID, and with drain evicts the pods on it, then retries the
+// pending pods.
+func (c *simCluster) cordon(nodeID string, drain bool) {
+	c.cordoned[nodeID] = true
+	if drain {
+		c.evict(func(pi *podInfo) bool { return pi.NodeID == nodeID })
+	}
+	c.schedule()
+}
+
+// report returns where every pod ended up and the pods each card holds.
+func (c *simCluster) report() simReport {
+	r := simReport{Placement: make(map[string]string), Pending: make(map[string]string), Used: make(map[string]int32)}
+	for _, pi := range c.s.ListPodsInfo() {
+		r.Placement[pi.Name] = pi.NodeID
+	}
+	for _, p := range c.queue {
+		r.Pending[p.Name] = c.reasons[p.Name]
+	}
+	var names []string
+	nodes, err := c.s.ListNodes()
+	assert.NilError(c.t, err)
+	for nodeID := range nodes {
+		names = append(names, nodeID)
+	}
+	usage, _, err := c.s.getNodesUsage(&names, nil)
+	assert.NilError(c.t, err)
+	for _, node := range *usage {
+		for _, d := range node.Devices.DeviceLists {
+			r.Used[d.Device.ID] = d.Device.Used
+		}
+	}
+	return r
+}
+
+func Test_simClusterCardFailure(t *testing.T) {
+	c := newSimCluster(t, map[string]int{"node1": 2, "node2": 1})
+	c.submit(simPod("a", "6000"), simPod("b", "6000"), simPod("c", "6000"))
+	r := c.report()
+	assert.Equal(t, len(r.Placement), 3)
+	assert.Equal(t, len(r.Pending), 0)
+	assert.DeepEqual(t, r.Used, map[string]int32{"node1-gpu0": 1, "node1-gpu1": 1, "node2-gpu0": 1})
+
+	// The pod on the failed card has nowhere else to go, and the card takes no pod anymore.
+	var victim string
+	for _, pi := range c.s.ListPodsInfo() {
+		if pi.Devices["NVIDIA"][0][0].UUID == "node1-gpu1" {
+			victim = pi.Name
+		}
+	}
+	assert.Assert(t, victim != "")
+	c.failCard("node1", "node1-gpu1")
+	r = c.report()
+	assert.Equal(t, len(r.Placement), 2)
+	assert.Equal(t, r.Used["node1-gpu1"], int32(0))
+	assert.Assert(t, r.Pending[victim] != "", r.Pending)
+
+	// A small pod still fits next to the ones left.
+	c.submit(simPod("d", "1000"))
+	r = c.report()
+	assert.Equal(t, r.Used["node1-gpu1"], int32(0))
+	_, ok := r.Placement["d"]
+	assert.Assert(t, ok, r.Pending)
+
+	// Both cards of node1 gone: the node is reported without a healthy GPU.
+	c.failCard("node1", "node1-gpu0")
+	r = c.report()
+	assert.Equal(t, r.Used["node1-gpu0"], int32(0))
+	for name, reason := range r.Pending {
+		assert.Assert(t, reason != "", "pod %s", name)
+	}
+	assert.Equal(t, len(r.Placement)+len(r.Pending), 4)
+}
+
+func Test_simClusterCordon(t *testing.T) {
+	c := newSimCluster(t, map[string]int{"node1": 1, "node2": 1})
+	c.submit(simPod("a", "6000"))
+	first := c.report().Placement["a"]
+	other := "node1"
+	if first == "node1" {
+		other = "node2"
+	}
+
+	// Cordoning keeps the pods there but new ones off.
+	c.cordon(other, false)
+	c.submit(simPod("b", "6000"))
+	r := c.report()
+	assert.DeepEqual(t, r.Placement, map[string]string{"a": first})
+	assert.Equal(t, len(r.Pending), 1)
+
+	// Draining the node of a moves it nowhere, as the only other node is cordoned.
+	c.cordon(first, true)
+	r = c.report()
+	assert.Equal(t, len(r.Placement), 0)
+	assert.Equal(t, len(r.Pending), 2)
+	assert.Assert(t, strings.HasPrefix(r.Pending["a"], "0/0 nodes are available"), r.Pending["a"])
+}
+
+func Test_simClusterDeterministic(t *testing.T) {
+	run := func() simReport {
+		c := newSimCluster(t, map[string]int{"node1": 2, "node2": 2, "node3": 1})
+		for i := 0; i < 6; i++ {
+			c.submit(simPod(fmt.Sprintf("p%d", i), "3000"))
+		}
+		c.failCard("node2", "node2-gpu0")
+		c.cordon("node3", true)
+		c.submit(simPod("late", "7000"))
+		return c.report()
+	}
+	want := run()
+	for i := 0; i < 5; i++ {
+		assert.DeepEqual(t, run(), want)
+	}
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+const (
+	// EventReasonGPUSoftReservationShrunk indicates that a soft pod is asked to use less memory per card.
+	EventReasonGPUSoftReservationShrunk = "GPUSoftReservationShrunk"
+	// EventReasonGPUSoftReservationEvicted indicates that a soft pod is evicted because none of its memory is left.
+	EventReasonGPUSoftReservationEvicted = "GPUSoftReservationEvicted"
+)
+
+// softReservation reports whether a pod with annos is of the soft GPU tier.
+func softReservation(annos map[string]string) bool {
+	return annos[util.GPUTier] == util.SoftReservation
+}
+
+// softMemory returns the memory the soft pod p holds with udevice.
+func softMemory(p *podInfo, udevice util.ContainerDevice) int64 {
+	if p.SoftLimit >= 0 && p.SoftLimit < udevice.Usedmem {
+		return p.SoftLimit
+	}
+	return udevice.Usedmem
+}
+
+// addSoftUsage accounts the memory of the soft pod p, whose devices are already added to
+// node, as held by soft pods, down to what p was asked to shrink to.
+func addSoftUsage(node *NodeUsage, p *podInfo) {
+	for _, podSingle := range p.Devices {
+		for _, ctrdevs := range podSingle {
+			for _, udevice := range ctrdevs {
+				for _, d := range node.Devices.DeviceLists {
+					if d.Device.ID == udevice.UUID {
+						held := softMemory(p, udevice)
+						d.Device.Usedmem -= udevice.Usedmem - held
+						d.Device.Softmem += held
+					}
+				}
+			}
+		}
+	}
+}
+
+// yieldSoftMemory frees the memory soft pods hold on every card of nodes, for a pod which
+// may take it from them.
+func yieldSoftMemory(nodes map[string]*NodeUsage) {
+	for _, node := range nodes {
+		for _, d := range node.Devices.DeviceLists {
+			d.Device.Usedmem -= d.Device.Softmem
+			d.Device.Softmem = 0
+		}
+	}
+}
+
+// shrinkSoftReservations makes room on the cards of nodeID whose memory is oversubscribed
+// by soft pods, after another pod was placed on them. The newest soft pods shrink first;
+// each is asked to use no more per card than what is left for it on its fullest card, and
+// evicted when nothing is left.
+func (s *Scheduler) shrinkSoftReservations(nodeID string) {
+	if s.podLister == nil || s.kubeClient == nil {
+		return
+	}
+	node, err := s.GetNode(nodeID)
+	if err != nil {
+		return
+	}
+	total := make(map[string]int64, len(node.Devices))
+	for _, d := range node.Devices {
+		total[d.ID] = util.MemoryToBytes(d.DeviceVendor, int64(d.Devmem))
+	}
+	used := make(map[string]int64)
+	soft := make([]*podInfo, 0)
+	for _, p := range s.ListPodsInfo() {
+		if p.NodeID != nodeID {
+			continue
+		}
+		if p.Soft {
+			soft = append(soft, p)
+		}
+		for _, podSingle := range p.Devices {
+			for _, ctrdevs := range podSingle {
+				for _, udevice := range ctrdevs {
+					deviceID := strings.Split(udevice.UUID, "[")[0]
+					if p.Soft {
+						used[deviceID] += softMemory(p, udevice)
+					} else {
+						used[deviceID] += udevice.Usedmem
+					}
+				}
+			}
+		}
+	}
+	if len(soft) == 0 {
+		return
+	}
+	slices.SortStableFunc(soft, func(a, b *podInfo) int { return b.AddedAt.Compare(a.AddedAt) })
+	for _, p := range soft {
+		limit := int64(-1)
+		for _, podSingle := range p.Devices {
+			for _, ctrdevs := range podSingle {
+				for _, udevice := range ctrdevs {
+					excess := used[udevice.UUID] - total[udevice.UUID]
+					if _, ok := total[udevice.UUID]; !ok || excess <= 0 {
+						continue
+					}
+					held := softMemory(p, udevice)
+					left := max(held-excess, 0)
+					if limit < 0 || left < limit {
+						limit = left
+					}
+				}
+			}
+		}
+		if limit < 0 {
+			continue
+		}
+		limit = limit / util.MiB * util.MiB
+		// The limit applies to every card of the pod, so it frees memory on all of them.
+		for _, podSingle := range p.Devices {
+			for _, ctrdevs := range podSingle {
+				for _, udevice := range ctrdevs {
+					used[udevice.UUID] -= softMemory(p, udevice) - min(softMemory(p, udevice), limit)
+				}
+			}
+		}
+		s.shrinkSoftPod(p, limit)
+	}
+}
+
+// shrinkSoftPod asks the soft pod p to use at most limit bytes per card, or evicts it if
+// limit is 0.
+func (s *Scheduler) shrinkSoftPod(p *podInfo, limit int64) {
+	pod, err := s.podLister.Pods(p.Namespace).Get(p.Name)
+	if err != nil || pod.UID != p.UID || pod.DeletionTimestamp != nil {
+		return
+	}
+	s.setSoftLimit(p.UID, limit)
+	if limit == 0 {
+		eviction := &policyv1.Eviction{ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace}}
+		if err := s.kubeClient.PolicyV1().Evictions(pod.Namespace).Evict(context.Background(), eviction); err != nil {
+			klog.ErrorS(err, "Failed to evict soft GPU reservation", "pod", klog.KObj(pod), "node", p.NodeID)
+			return
+		}
+		klog.InfoS("Evicted soft GPU reservation", "pod", klog.KObj(pod), "node", p.NodeID)
+		s.eventRecorder.Eventf(pod, corev1.EventTypeWarning, EventReasonGPUSoftReservationEvicted,
+			"Evicted, the GPU memory of the soft reservation is needed by other pods on node %s", p.NodeID)
+		return
+	}
+	mib := strconv.FormatInt(limit/util.MiB, 10)
+	if err := util.PatchPodAnnotations(pod, map[string]string{util.SoftMemoryLimit: mib}); err != nil {
+		klog.ErrorS(err, "Failed to shrink soft GPU reservation", "pod", klog.KObj(pod), "node", p.NodeID)
+		return
+	}
+	klog.InfoS("Shrunk soft GPU reservation", "pod", klog.KObj(pod), "node", p.NodeID, "limitMiB", mib)
+	s.eventRecorder.Eventf(pod, corev1.EventTypeNormal, EventReasonGPUSoftReservationShrunk,
+		"GPU memory limit lowered to %s MiB per card for other pods on node %s", mib, p.NodeID)
+}
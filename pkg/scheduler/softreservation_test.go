@@ -0,0 +1,127 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	listerscorev1 "k8s.io/client-go/listers/core/v1"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	extenderv1 "k8s.io/kube-scheduler/extender/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/policy"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+	"github.com/Project-HAMi/HAMi/pkg/util/client"
+)
+
+func Test_yieldSoftMemory(t *testing.T) {
+	node := &NodeUsage{Devices: policy.DeviceUsageList{DeviceLists: []*policy.DeviceListsScore{{Device: &util.DeviceUsage{
+		ID: "GPU-0", Count: 10, Totalmem: 8000 * util.MiB,
+	}}}}}
+	hard := &podInfo{Devices: util.PodDevices{nvidia.NvidiaGPUDevice: util.PodSingleDevice{{{UUID: "GPU-0", Usedmem: 2000 * util.MiB}}}}, SoftLimit: -1}
+	soft := &podInfo{Devices: util.PodDevices{nvidia.NvidiaGPUDevice: util.PodSingleDevice{{{UUID: "GPU-0", Usedmem: 6000 * util.MiB}}}}, Soft: true, SoftLimit: 4000 * util.MiB}
+	for _, p := range []*podInfo{hard, soft} {
+		addPodUsage(node, p.Devices)
+		if p.Soft {
+			addSoftUsage(node, p)
+		}
+	}
+	d := node.Devices.DeviceLists[0].Device
+	// The soft pod only counts with what it was asked to shrink to.
+	assert.Equal(t, d.Usedmem, 6000*util.MiB)
+	assert.Equal(t, d.Softmem, 4000*util.MiB)
+	assert.Equal(t, d.Used, int32(2))
+
+	yieldSoftMemory(map[string]*NodeUsage{"node1": node})
+	assert.Equal(t, d.Usedmem, 2000*util.MiB)
+	assert.Equal(t, d.Softmem, int64(0))
+	assert.Equal(t, d.Used, int32(2))
+}
+
+func Test_shrinkSoftReservations(t *testing.T) {
+	prev := device.ActiveConfig()
+	initTFLOPSDevices(t)
+	defer func() { assert.NilError(t, device.InitDevicesWithConfig(prev)) }()
+	fakeClient := fake.NewSimpleClientset()
+	client.KubeClient = fakeClient
+	s := NewScheduler()
+	s.kubeClient = fakeClient
+	s.eventRecorder = record.NewFakeRecorder(100)
+	podIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	s.podLister = listerscorev1.NewPodLister(podIndexer)
+	s.addNode("node1", &util.NodeInfo{
+		ID:      "node1",
+		Node:    &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}},
+		Devices: []util.DeviceInfo{{ID: "GPU-0", Count: 10, Devmem: 8000, Devcore: 100, Type: nvidia.NvidiaGPUDevice, Health: true}},
+	})
+	filter := func(pod *corev1.Pod) bool {
+		assert.NilError(t, podIndexer.Add(pod))
+		_, err := fakeClient.CoreV1().Pods(pod.Namespace).Create(context.Background(), pod, metav1.CreateOptions{})
+		assert.NilError(t, err)
+		res, err := s.Filter(extenderv1.ExtenderArgs{Pod: pod, NodeNames: &[]string{"node1"}})
+		assert.NilError(t, err)
+		return res.NodeNames != nil
+	}
+	softLimit := func(name string) string {
+		pod, err := fakeClient.CoreV1().Pods("default").Get(context.Background(), name, metav1.GetOptions{})
+		assert.NilError(t, err)
+		return pod.Annotations[util.SoftMemoryLimit]
+	}
+	evictions := func() []string {
+		names := make([]string, 0)
+		for _, a := range fakeClient.Actions() {
+			if c, ok := a.(k8stesting.CreateAction); ok && a.GetSubresource() == "eviction" {
+				names = append(names, c.GetObject().(metav1.Object).GetName())
+			}
+		}
+		return names
+	}
+
+	spare := fairnessTestPod("spare", 6000)
+	spare.Annotations = map[string]string{util.GPUTier: util.SoftReservation}
+	assert.Equal(t, filter(spare), true)
+	// A soft pod doesn't take memory from another soft pod.
+	greedy := fairnessTestPod("greedy", 4000)
+	greedy.Annotations = map[string]string{util.GPUTier: util.SoftReservation}
+	assert.Equal(t, filter(greedy), false)
+	s.delPod(greedy)
+
+	// A hard pod takes the memory it needs from the soft pod, which is asked to shrink.
+	assert.Equal(t, filter(fairnessTestPod("service-0", 4000)), true)
+	assert.Equal(t, softLimit("spare"), "4000")
+	p, ok := s.getPod("spare")
+	assert.Assert(t, ok)
+	assert.Equal(t, p.SoftLimit, 4000*util.MiB)
+	assert.DeepEqual(t, evictions(), []string{})
+
+	// Once nothing is left for it, the soft pod is evicted.
+	assert.Equal(t, filter(fairnessTestPod("service-1", 4000)), true)
+	assert.DeepEqual(t, evictions(), []string{"spare"})
+	assert.Equal(t, p.SoftLimit, int64(0))
+
+	// The card is full of hard pods now.
+	assert.Equal(t, filter(fairnessTestPod("service-2", 1000)), false)
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// StickyPlacementAnnotation asks the scheduler to place a recreated pod with the same
+// namespace/name, e.g. a StatefulSet replica, back onto the cards it used last time.
+const StickyPlacementAnnotation = "hami.io/sticky-placement"
+
+type stickyPlacement struct {
+	nodeID  string
+	devices []string
+	// releasedAt is zero while the pod holding the placement is still running.
+	releasedAt time.Time
+}
+
+type stickyManager struct {
+	mutex      sync.Mutex
+	placements map[string]*stickyPlacement
+}
+
+func newStickyManager() *stickyManager {
+	return &stickyManager{
+		placements: make(map[string]*stickyPlacement),
+	}
+}
+
+func stickyKey(pod *corev1.Pod) (string, bool) {
+	if pod == nil || pod.Annotations[StickyPlacementAnnotation] != "true" {
+		return "", false
+	}
+	return pod.Namespace + "/" + pod.Name, true
+}
+
+// record remembers the cards assigned to pod on nodeID.
+func (m *stickyManager) record(pod *corev1.Pod, nodeID string, pd util.PodDevices) {
+	key, ok := stickyKey(pod)
+	if m == nil || !ok {
+		return
+	}
+	devices := make([]string, 0)
+	for _, podSingle := range pd {
+		for _, ctrdevs := range podSingle {
+			for _, d := range ctrdevs {
+				if len(d.UUID) == 0 {
+					continue
+				}
+				devices = append(devices, strings.Split(d.UUID, "[")[0])
+			}
+		}
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.placements[key] = &stickyPlacement{nodeID: nodeID, devices: devices}
+}
+
+// release starts the expiry window of the placement of pod.
+func (m *stickyManager) release(pod *corev1.Pod) {
+	key, ok := stickyKey(pod)
+	if m == nil || !ok {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if p, ok := m.placements[key]; ok && p.releasedAt.IsZero() {
+		p.releasedAt = time.Now()
+	}
+}
+
+// lookup returns the last placement of pod, dropping it if the expiry window has passed.
+func (m *stickyManager) lookup(pod *corev1.Pod) (*stickyPlacement, bool) {
+	key, ok := stickyKey(pod)
+	if m == nil || !ok {
+		return nil, false
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for k, p := range m.placements {
+		if !p.releasedAt.IsZero() && time.Since(p.releasedAt) > config.StickyPlacementTTL {
+			klog.V(4).InfoS("Sticky placement expired", "key", k, "node", p.nodeID)
+			delete(m.placements, k)
+		}
+	}
+	p, ok := m.placements[key]
+	return p, ok
+}
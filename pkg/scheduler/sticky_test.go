@@ -0,0 +1,115 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/policy"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func stickyPod(uid string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "db-0",
+			Namespace:   "default",
+			UID:         k8stypes.UID("uid-" + uid),
+			Annotations: map[string]string{StickyPlacementAnnotation: "true"},
+		},
+	}
+}
+
+func Test_stickyManager(t *testing.T) {
+	config.StickyPlacementTTL = time.Minute
+	m := newStickyManager()
+	pod := stickyPod("1")
+	pd := util.PodDevices{nvidia.NvidiaGPUDevice: util.PodSingleDevice{{{UUID: "GPU-1"}, {UUID: "GPU-2[2g.10gb-1]"}}}}
+
+	m.record(pod, "node1", pd)
+	p, ok := m.lookup(stickyPod("2"))
+	assert.Assert(t, ok)
+	assert.Equal(t, p.nodeID, "node1")
+	assert.DeepEqual(t, p.devices, []string{"GPU-1", "GPU-2"})
+
+	m.release(pod)
+	p.releasedAt = time.Now().Add(-2 * time.Minute)
+	_, ok = m.lookup(stickyPod("2"))
+	assert.Assert(t, !ok)
+
+	plain := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-0", Namespace: "default"}}
+	m.record(plain, "node1", pd)
+	_, ok = m.lookup(plain)
+	assert.Assert(t, !ok)
+
+	var nilManager *stickyManager
+	nilManager.record(pod, "node1", pd)
+	nilManager.release(pod)
+	_, ok = nilManager.lookup(pod)
+	assert.Assert(t, !ok)
+}
+
+func Test_calcScoreSticky(t *testing.T) {
+	config.StickyPlacementTTL = time.Minute
+	newNodes := func() *map[string]*NodeUsage {
+		nodes := map[string]*NodeUsage{}
+		for _, name := range []string{"node1", "node2"} {
+			devs := []*policy.DeviceListsScore{}
+			for _, id := range []string{"-a", "-b"} {
+				devs = append(devs, &policy.DeviceListsScore{Device: &util.DeviceUsage{
+					ID: name + id, Type: nvidia.NvidiaGPUDevice, Count: 10, Totalmem: 8000, Totalcore: 100, Health: true,
+				}})
+			}
+			nodes[name] = &NodeUsage{Devices: policy.DeviceUsageList{Policy: util.GPUSchedulerPolicySpread.String(), DeviceLists: devs}}
+		}
+		// Binpack prefers the busier node2, spread then prefers its idle card node2-a.
+		nodes["node2"].Devices.DeviceLists[1].Device.Used = 1
+		nodes["node2"].Devices.DeviceLists[1].Device.Usedmem = 1000
+		return &nodes
+	}
+	nums := util.PodDeviceRequests{{nvidia.NvidiaGPUDevice: util.ContainerDeviceRequest{Nums: 1, Type: nvidia.NvidiaGPUDevice, Memreq: 1000, Coresreq: 10}}}
+	pick := func(s *Scheduler, pod *corev1.Pod) (string, string) {
+		res, err := s.calcScore(newNodes(), nums, pod.Annotations, pod, map[string]string{})
+		assert.NilError(t, err)
+		best := res.NodeList[0]
+		for _, n := range res.NodeList {
+			if n.Score > best.Score {
+				best = n
+			}
+		}
+		return best.NodeID, best.Devices[nvidia.NvidiaGPUDevice][0][0].UUID
+	}
+
+	s := NewScheduler()
+	node, dev := pick(s, stickyPod("1"))
+	assert.Equal(t, node, "node2")
+	assert.Equal(t, dev, "node2-a")
+
+	s.sticky.record(stickyPod("1"), "node1", util.PodDevices{nvidia.NvidiaGPUDevice: util.PodSingleDevice{{{UUID: "node1-b"}}}})
+	s.sticky.release(stickyPod("1"))
+	node, dev = pick(s, stickyPod("2"))
+	assert.Equal(t, node, "node1")
+	assert.Equal(t, dev, "node1-b")
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+)
+
+// tooHot returns why a card at temperature takes no new pods, "" if it does.
+func tooHot(temperature *int) string {
+	if temperature == nil || config.GPUTemperatureThreshold <= 0 || *temperature < config.GPUTemperatureThreshold {
+		return ""
+	}
+	return fmt.Sprintf("%d°C, the threshold is %d°C", *temperature, config.GPUTemperatureThreshold)
+}
+
+// preferCoolCards raises the score of cards running less above the soft temperature threshold,
+// scaled between the card least and the one most above it on the node. Cards below the
+// threshold all count as cool, cards whose temperature is unknown are left untouched, and so
+// are nodes without a card above it.
+func preferCoolCards(node *NodeUsage, threshold int, weight float32) {
+	excess := func(t *int) (int, bool) {
+		if t == nil {
+			return 0, false
+		}
+		return max(0, *t-threshold), true
+	}
+	least, most := -1, 0
+	for _, d := range node.Devices.DeviceLists {
+		n, ok := excess(d.Device.Temperature)
+		if !ok {
+			continue
+		}
+		if least < 0 || n < least {
+			least = n
+		}
+		most = max(most, n)
+	}
+	if least < 0 || least == most {
+		return
+	}
+	for _, d := range node.Devices.DeviceLists {
+		if n, ok := excess(d.Device.Temperature); ok {
+			d.AddPreference(node.Devices.Policy, weight*float32(most-n)/float32(most-least))
+		}
+	}
+}
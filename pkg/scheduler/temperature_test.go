@@ -0,0 +1,102 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func Test_tooHot(t *testing.T) {
+	prev := config.GPUTemperatureThreshold
+	defer func() { config.GPUTemperatureThreshold = prev }()
+	hot, cool := 85, 84
+
+	config.GPUTemperatureThreshold = 0
+	assert.Equal(t, tooHot(&hot), "")
+	config.GPUTemperatureThreshold = 85
+	assert.Equal(t, tooHot(&hot), "85°C, the threshold is 85°C")
+	assert.Equal(t, tooHot(&cool), "")
+	assert.Equal(t, tooHot(nil), "")
+}
+
+func Test_temperaturePlacement(t *testing.T) {
+	prev := device.ActiveConfig()
+	initTFLOPSDevices(t)
+	defer func() { assert.NilError(t, device.InitDevicesWithConfig(prev)) }()
+	prevHard, prevSoft, prevWeight := config.GPUTemperatureThreshold, config.GPUTemperatureSoftThreshold, config.GPUTemperatureWeight
+	defer func() {
+		config.GPUTemperatureThreshold, config.GPUTemperatureSoftThreshold, config.GPUTemperatureWeight = prevHard, prevSoft, prevWeight
+	}()
+	config.GPUTemperatureWeight = 10
+
+	// GPU-0 has the most memory, so the spread policy picks it unless its temperature counts.
+	newScheduler := func(temperatures ...*int) *Scheduler {
+		s := NewScheduler()
+		info := &util.NodeInfo{ID: "node1", Node: &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}}
+		for i, c := range temperatures {
+			info.Devices = append(info.Devices, util.DeviceInfo{
+				ID: "GPU-" + string(rune('0'+i)), Index: uint(i), Count: 10, Devmem: 8000 - int32(i)*1000, Devcore: 100,
+				Type: "NVIDIA-Tesla T4", Health: true, DeviceVendor: nvidia.NvidiaGPUDevice, Temperature: c,
+			})
+		}
+		s.addNode("node1", info)
+		return s
+	}
+	nums := util.PodDeviceRequests{{nvidia.NvidiaGPUDevice: util.ContainerDeviceRequest{Nums: 1, Type: nvidia.NvidiaGPUDevice, Memreq: 1000, Coresreq: 10}}}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "training", Namespace: "default"}}
+	place := func(s *Scheduler) string {
+		names := []string{"node1"}
+		nodes, failedNodes, err := s.getNodesUsage(&names, pod)
+		assert.NilError(t, err)
+		for _, node := range *nodes {
+			node.Devices.Policy = util.GPUSchedulerPolicySpread.String()
+		}
+		res, err := s.calcScore(nodes, nums, nil, pod, failedNodes)
+		assert.NilError(t, err)
+		if len(res.NodeList) == 0 {
+			return ""
+		}
+		return res.NodeList[0].Devices[nvidia.NvidiaGPUDevice][0][0].UUID
+	}
+	c60, c75, c82, c90 := 60, 75, 82, 90
+
+	// Without thresholds the temperature doesn't count.
+	assert.Equal(t, place(newScheduler(&c90, &c60)), "GPU-0")
+
+	// A card at the hard threshold takes no new pods.
+	config.GPUTemperatureThreshold = 85
+	assert.Equal(t, place(newScheduler(&c90, &c60)), "GPU-1")
+	assert.Equal(t, place(newScheduler(&c90)), "")
+	// Unknown temperatures don't count.
+	assert.Equal(t, place(newScheduler(nil, &c60)), "GPU-0")
+
+	// Cards above the soft threshold are avoided, the more the hotter.
+	config.GPUTemperatureSoftThreshold = 70
+	assert.Equal(t, place(newScheduler(&c82, &c60)), "GPU-1")
+	assert.Equal(t, place(newScheduler(&c82, &c75, &c82)), "GPU-1")
+	// Cards below it are all as cool.
+	assert.Equal(t, place(newScheduler(&c60, &c60)), "GPU-0")
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func parseTFLOPS(value string) (float64, error) {
+	target, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || target <= 0 || math.IsInf(target, 0) {
+		return 0, fmt.Errorf("invalid %s %q, expected a positive number", util.TFLOPSRequest, value)
+	}
+	return target, nil
+}
+
+// validateTFLOPSRequest rejects a hami.io/tflops annotation which no card of the TFLOPS table
+// allowed by the card type annotations of pod can deliver, or which competes with a core request.
+func validateTFLOPSRequest(pod *corev1.Pod) error {
+	value, ok := pod.Annotations[util.TFLOPSRequest]
+	if !ok {
+		return nil
+	}
+	if !config.TFLOPSRequests {
+		return fmt.Errorf("annotation %s needs the scheduler to be started with --tflops-requests", util.TFLOPSRequest)
+	}
+	target, err := parseTFLOPS(value)
+	if err != nil {
+		return err
+	}
+	dev, ok := device.GetDevices()[nvidia.NvidiaGPUDevice].(*nvidia.NvidiaGPUDevices)
+	if !ok {
+		return fmt.Errorf("annotation %s needs the NVIDIA device to be enabled", util.TFLOPSRequest)
+	}
+	cores := corev1.ResourceName(dev.CoreResourceName())
+	for _, c := range pod.Spec.Containers {
+		_, inLimits := c.Resources.Limits[cores]
+		_, inRequests := c.Resources.Requests[cores]
+		if inLimits || inRequests {
+			return fmt.Errorf("container %s: %s and %s are exclusive", c.Name, util.TFLOPSRequest, cores)
+		}
+	}
+	if len(dev.TFLOPSModels(pod.Annotations, target)) == 0 {
+		return fmt.Errorf("no card model in the TFLOPS table delivers %s=%s", util.TFLOPSRequest, value)
+	}
+	return nil
+}
+
+// tflopsTarget returns the throughput requested by the hami.io/tflops annotation in annos,
+// if the annotation is enabled and set.
+func tflopsTarget(annos map[string]string) (float64, bool) {
+	value, ok := annos[util.TFLOPSRequest]
+	if !ok || !config.TFLOPSRequests {
+		return 0, false
+	}
+	target, err := parseTFLOPS(value)
+	return target, err == nil
+}
+
+// tflopsCores returns the cores a card of cardType reserves to deliver target TFLOPS,
+// or false if the card is missing from the TFLOPS table or too slow.
+func tflopsCores(cardType string, target float64) (int32, bool) {
+	dev, ok := device.GetDevices()[nvidia.NvidiaGPUDevice].(*nvidia.NvidiaGPUDevices)
+	if !ok {
+		return 0, false
+	}
+	return dev.TFLOPSCores(cardType, target)
+}
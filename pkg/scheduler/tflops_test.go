@@ -0,0 +1,158 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/policy"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func initTFLOPSDevices(t *testing.T) {
+	assert.NilError(t, device.InitDevicesWithConfig(&device.Config{NvidiaConfig: nvidia.NvidiaConfig{
+		ResourceCountName:            "hami.io/gpu",
+		ResourceMemoryName:           "hami.io/gpumem",
+		ResourceMemoryPercentageName: "hami.io/gpumem-percentage",
+		ResourceCoreName:             "hami.io/gpucores",
+		DefaultGPUNum:                1,
+		CardTFLOPS: []nvidia.CardTFLOPS{
+			{Model: "A100", TFLOPS: 312},
+			{Model: "T4", TFLOPS: 65},
+		},
+	}}))
+}
+
+func Test_validateTFLOPSRequest(t *testing.T) {
+	initTFLOPSDevices(t)
+	defer func() { config.TFLOPSRequests = false }()
+	pod := func(annos map[string]string, cores bool) *corev1.Pod {
+		p := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Annotations: annos},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{
+				Name:      "main",
+				Resources: corev1.ResourceRequirements{Limits: corev1.ResourceList{"hami.io/gpu": resource.MustParse("1")}},
+			}}},
+		}
+		if cores {
+			p.Spec.Containers[0].Resources.Limits["hami.io/gpucores"] = resource.MustParse("30")
+		}
+		return p
+	}
+
+	assert.NilError(t, validateTFLOPSRequest(pod(nil, true)))
+	assert.ErrorContains(t, validateTFLOPSRequest(pod(map[string]string{util.TFLOPSRequest: "20"}, false)), "--tflops-requests")
+
+	config.TFLOPSRequests = true
+	assert.NilError(t, validateTFLOPSRequest(pod(map[string]string{util.TFLOPSRequest: "20"}, false)))
+	assert.ErrorContains(t, validateTFLOPSRequest(pod(map[string]string{util.TFLOPSRequest: "-1"}, false)), "expected a positive number")
+	assert.ErrorContains(t, validateTFLOPSRequest(pod(map[string]string{util.TFLOPSRequest: "20"}, true)), "exclusive")
+	assert.ErrorContains(t, validateTFLOPSRequest(pod(map[string]string{util.TFLOPSRequest: "500"}, false)), "no card model")
+	assert.ErrorContains(t, validateTFLOPSRequest(pod(map[string]string{util.TFLOPSRequest: "100", nvidia.GPUInUse: "T4"}, false)), "no card model")
+}
+
+func Test_fitInCertainDeviceTFLOPS(t *testing.T) {
+	initTFLOPSDevices(t)
+	config.TFLOPSRequests = true
+	defer func() { config.TFLOPSRequests = false }()
+	node := &NodeUsage{
+		Devices: policy.DeviceUsageList{
+			DeviceLists: []*policy.DeviceListsScore{
+				{Device: &util.DeviceUsage{ID: "GPU-A100", Type: "NVIDIA-A100-SXM4-40GB", Count: 10, Totalmem: 40960, Totalcore: 100, Usedcores: 90}},
+				{Device: &util.DeviceUsage{ID: "GPU-T4", Type: "NVIDIA-Tesla T4", Count: 10, Totalmem: 15360, Totalcore: 100}},
+				{Device: &util.DeviceUsage{ID: "GPU-H100", Type: "NVIDIA-H100", Count: 10, Totalmem: 81920, Totalcore: 100}},
+			},
+		},
+	}
+	request := util.ContainerDeviceRequest{Nums: 1, Type: nvidia.NvidiaGPUDevice, Memreq: 1024, MemPercentagereq: 101}
+
+	// The H100 is missing from the table, 20 TFLOPS are 7% of the A100 and 31% of the T4.
+	fit, devs := fitInCertainDevice(node, request, map[string]string{util.TFLOPSRequest: "20"}, &corev1.Pod{}, &util.PodDevices{})
+	assert.Equal(t, fit, true)
+	assert.DeepEqual(t, devs[nvidia.NvidiaGPUDevice], util.ContainerDevices{
+		{UUID: "GPU-T4", Type: nvidia.NvidiaGPUDevice, Usedmem: 1024, Usedcores: 31},
+	})
+
+	// 70 TFLOPS are too much for the T4, and more than the 10% left on the A100.
+	fit, _ = fitInCertainDevice(node, request, map[string]string{util.TFLOPSRequest: "70"}, &corev1.Pod{}, &util.PodDevices{})
+	assert.Equal(t, fit, false)
+	node.Devices.DeviceLists[0].Device.Usedcores = 0
+	fit, devs = fitInCertainDevice(node, request, map[string]string{util.TFLOPSRequest: "70"}, &corev1.Pod{}, &util.PodDevices{})
+	assert.Equal(t, fit, true)
+	assert.Equal(t, devs[nvidia.NvidiaGPUDevice][0].UUID, "GPU-A100")
+	assert.Equal(t, devs[nvidia.NvidiaGPUDevice][0].Usedcores, int32(23))
+}
+
+func Test_fitInCertainDeviceCoreRounding(t *testing.T) {
+	config.TFLOPSRequests = true
+	defer func() { config.TFLOPSRequests = false }()
+	request := util.ContainerDeviceRequest{Nums: 1, Type: nvidia.NvidiaGPUDevice, Memreq: 1024, MemPercentagereq: 101}
+	// 30 TFLOPS are a third of the cores of a card with 90.
+	annos := map[string]string{util.TFLOPSRequest: "30"}
+
+	for _, test := range []struct {
+		rounding nvidia.CoreRounding
+		packed   int
+		cores    int32
+	}{
+		{rounding: nvidia.CoreRoundingCeil, packed: 2, cores: 68},
+		{rounding: nvidia.CoreRoundingFloor, packed: 3, cores: 99},
+		{rounding: nvidia.CoreRoundingExact, packed: 0, cores: 0},
+	} {
+		t.Run(string(test.rounding), func(t *testing.T) {
+			assert.NilError(t, device.InitDevicesWithConfig(&device.Config{NvidiaConfig: nvidia.NvidiaConfig{
+				ResourceCountName:            "hami.io/gpu",
+				ResourceMemoryName:           "hami.io/gpumem",
+				ResourceMemoryPercentageName: "hami.io/gpumem-percentage",
+				ResourceCoreName:             "hami.io/gpucores",
+				DefaultGPUNum:                1,
+				CardTFLOPS:                   []nvidia.CardTFLOPS{{Model: "L40", TFLOPS: 90}},
+				CoreRounding:                 test.rounding,
+			}}))
+			card := &util.DeviceUsage{ID: "GPU-L40", Type: "NVIDIA-L40", Count: 10, Totalmem: 46068, Totalcore: 100}
+			node := &NodeUsage{Devices: policy.DeviceUsageList{DeviceLists: []*policy.DeviceListsScore{{Device: card}}}}
+			place := func(request util.ContainerDeviceRequest, annos map[string]string) bool {
+				fit, devs := fitInCertainDevice(node, request, annos, &corev1.Pod{}, &util.PodDevices{})
+				if fit {
+					card.Used++
+					card.Usedmem += devs[nvidia.NvidiaGPUDevice][0].Usedmem
+					card.Usedcores += devs[nvidia.NvidiaGPUDevice][0].Usedcores
+				}
+				return fit
+			}
+
+			packed := 0
+			for place(request, annos) {
+				packed++
+			}
+			assert.Equal(t, packed, test.packed)
+			assert.Equal(t, card.Usedcores, test.cores)
+			// The cores left over by the rounding still go to a pod asking for 1%.
+			small := request
+			small.Coresreq = 1
+			assert.Assert(t, place(small, nil))
+		})
+	}
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/policy"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// typeOrderBonus is the score a card or node gains over one of the next type of the order, so
+// a pod which already falls back still takes a more preferred type whenever one fits.
+const typeOrderBonus = float32(policy.Weight * 5)
+
+// gpuTypeOrder returns the entries of the hami.io/gpu-type-order annotation of annos, nil
+// without it.
+func gpuTypeOrder(annos map[string]string) []string {
+	var order []string
+	for _, t := range strings.Split(annos[util.GPUTypeOrder], ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			order = append(order, t)
+		}
+	}
+	return order
+}
+
+// parseTypeFallbackAfter parses the value of the hami.io/gpu-type-fallback-after annotation.
+// ok is false if the pod never falls back.
+func parseTypeFallbackAfter(v string) (after time.Duration, ok bool, err error) {
+	if v == util.GPUTypeFallbackNever {
+		return 0, false, nil
+	}
+	after, err = time.ParseDuration(v)
+	if err != nil {
+		return 0, false, err
+	}
+	if after < 0 {
+		return 0, false, fmt.Errorf("negative duration %s", v)
+	}
+	return after, true, nil
+}
+
+// typeFallbackAfter returns the wait per fallback step of a pod with annos. ok is false if
+// the pod never falls back.
+func typeFallbackAfter(annos map[string]string) (time.Duration, bool) {
+	v, set := annos[util.GPUTypeFallbackAfter]
+	if !set {
+		return config.GPUTypeFallbackAfter, true
+	}
+	after, ok, err := parseTypeFallbackAfter(v)
+	if err != nil {
+		// Rejected by the webhook, so only seen for pods admitted before it checked them.
+		return config.GPUTypeFallbackAfter, true
+	}
+	return after, ok
+}
+
+// typeOrderPosition returns the position of the first entry of order cardtype matches, the
+// same way nvidia.com/use-gputype matches, or -1 if none does.
+func typeOrderPosition(order []string, cardtype string) int {
+	cardtype = strings.ToUpper(cardtype)
+	for i, t := range order {
+		if strings.Contains(cardtype, strings.ToUpper(t)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// acceptedTypes returns how many entries of order pod accepts at now: the first one, and one
+// more for every fallback step the pod has been waiting since it was created.
+func acceptedTypes(order []string, annos map[string]string, pod *corev1.Pod, now time.Time) int {
+	after, ok := typeFallbackAfter(annos)
+	if !ok {
+		return 1
+	}
+	if after == 0 {
+		return len(order)
+	}
+	// Pod templates, e.g. of a batch plan, have no age yet.
+	if pod == nil || pod.CreationTimestamp.IsZero() {
+		return 1
+	}
+	steps := now.Sub(pod.CreationTimestamp.Time) / after
+	return int(min(int64(len(order)), 1+max(int64(steps), 0)))
+}
+
+// checkTypeOrder reports why d isn't accepted by a pod with the type order order of which it
+// accepts the first accepted entries, or "" if it is. Without an order every card is accepted.
+func checkTypeOrder(order []string, accepted int, annos map[string]string, d util.DeviceUsage) string {
+	if len(order) == 0 {
+		return ""
+	}
+	pos := typeOrderPosition(order, d.Type)
+	switch {
+	case pos < 0:
+		return fmt.Sprintf("card type %s is not in %s", d.Type, util.GPUTypeOrder)
+	case pos < accepted:
+		return ""
+	}
+	after, ok := typeFallbackAfter(annos)
+	if !ok {
+		return fmt.Sprintf("%s cards are not accepted, the pod doesn't fall back from %s", order[pos], order[0])
+	}
+	return fmt.Sprintf("%s cards are accepted after the pod waited %s", order[pos], time.Duration(pos)*after)
+}
+
+// preferTypeOrder raises the score of cards of the earlier types of order.
+func preferTypeOrder(node *NodeUsage, order []string) {
+	for _, d := range node.Devices.DeviceLists {
+		if pos := typeOrderPosition(order, d.Device.Type); pos >= 0 {
+			d.AddPreference(node.Devices.Policy, typeOrderBonus*float32(len(order)-1-pos))
+		}
+	}
+}
+
+// typeOrderScore returns the bonus of a node whose cards devices were chosen for a pod with
+// the type order order, by the least preferred type among them.
+func typeOrderScore(node *NodeUsage, devices util.PodDevices, order []string) float32 {
+	worst := 0
+	for _, podSingle := range devices {
+		for _, ctrdevs := range podSingle {
+			for _, udevice := range ctrdevs {
+				for _, d := range node.Devices.DeviceLists {
+					if d.Device.ID == strings.Split(udevice.UUID, "[")[0] {
+						worst = max(worst, typeOrderPosition(order, d.Device.Type))
+					}
+				}
+			}
+		}
+	}
+	return typeOrderBonus * float32(len(order)-1-worst)
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/device"
+	"github.com/Project-HAMi/HAMi/pkg/device/nvidia"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/scheduler/policy"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func Test_acceptedTypes(t *testing.T) {
+	prevAfter := config.GPUTypeFallbackAfter
+	config.GPUTypeFallbackAfter = 10 * time.Minute
+	defer func() { config.GPUTypeFallbackAfter = prevAfter }()
+
+	now := time.Now()
+	order := []string{"A100", "H100", "L40"}
+	created := func(ago time.Duration) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(now.Add(-ago))}}
+	}
+	tests := []struct {
+		name  string
+		annos map[string]string
+		pod   *corev1.Pod
+		want  int
+	}{
+		{name: "new pod", pod: created(time.Minute), want: 1},
+		{name: "one step", pod: created(11 * time.Minute), want: 2},
+		{name: "capped at the order", pod: created(time.Hour), want: 3},
+		{name: "pod template", pod: &corev1.Pod{}, want: 1},
+		{name: "own wait", annos: map[string]string{util.GPUTypeFallbackAfter: "30s"}, pod: created(time.Minute), want: 3},
+		{name: "right away", annos: map[string]string{util.GPUTypeFallbackAfter: "0s"}, pod: created(0), want: 3},
+		{name: "never", annos: map[string]string{util.GPUTypeFallbackAfter: util.GPUTypeFallbackNever}, pod: created(time.Hour), want: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, acceptedTypes(order, test.annos, test.pod, now), test.want)
+		})
+	}
+}
+
+func Test_calcScoreTypeFallback(t *testing.T) {
+	prev := device.ActiveConfig()
+	initTFLOPSDevices(t)
+	defer func() { assert.NilError(t, device.InitDevicesWithConfig(prev)) }()
+	prevAfter := config.GPUTypeFallbackAfter
+	config.GPUTypeFallbackAfter = 10 * time.Minute
+	defer func() { config.GPUTypeFallbackAfter = prevAfter }()
+
+	// The A100 of node-a is full unless free is set, the H100 of node-h is free.
+	newNodes := func(free bool) map[string]*NodeUsage {
+		nodes := make(map[string]*NodeUsage)
+		for name, cardType := range map[string]string{"node-a": "NVIDIA-A100", "node-h": "NVIDIA-H100"} {
+			d := &util.DeviceUsage{ID: name + "-GPU-0", Type: cardType, Count: 10, Totalmem: 8000 * util.MiB, Totalcore: 100, Health: true}
+			if name == "node-a" && !free {
+				d.Usedmem, d.Used = 8000*util.MiB, 1
+			}
+			nodes[name] = &NodeUsage{
+				Node:    &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}},
+				Devices: policy.DeviceUsageList{Policy: util.GPUSchedulerPolicySpread.String(), DeviceLists: []*policy.DeviceListsScore{{Device: d}}},
+			}
+		}
+		return nodes
+	}
+	nums := util.PodDeviceRequests{{nvidia.NvidiaGPUDevice: util.ContainerDeviceRequest{Nums: 1, Type: nvidia.NvidiaGPUDevice, Memreq: 1000 * util.MiB, Coresreq: 10}}}
+	place := func(free bool, waited time.Duration, annos map[string]string) (string, map[string]string) {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "trainer", Namespace: "default", CreationTimestamp: metav1.NewTime(time.Now().Add(-waited))}}
+		nodes := newNodes(free)
+		failedNodes := map[string]string{}
+		res, err := NewScheduler().calcScore(&nodes, nums, annos, pod, failedNodes)
+		assert.NilError(t, err)
+		if len(res.NodeList) == 0 {
+			return "", failedNodes
+		}
+		best := res.NodeList[0]
+		for _, n := range res.NodeList[1:] {
+			if n.Score > best.Score {
+				best = n
+			}
+		}
+		return best.NodeID, failedNodes
+	}
+	annos := map[string]string{util.GPUTypeOrder: "A100,H100"}
+
+	// A new pod waits for an A100.
+	node, failed := place(false, time.Minute, annos)
+	assert.Equal(t, node, "")
+	assert.Equal(t, failed["node-h"], "node not fit pod, H100 cards are accepted after the pod waited 10m0s")
+
+	// Once it waited long enough it falls back to the H100.
+	node, _ = place(false, 11*time.Minute, annos)
+	assert.Equal(t, node, "node-h")
+
+	// It still takes an A100 when one is free.
+	node, _ = place(true, 11*time.Minute, annos)
+	assert.Equal(t, node, "node-a")
+
+	// A strict pod never falls back.
+	strict := map[string]string{util.GPUTypeOrder: "A100,H100", util.GPUTypeFallbackAfter: util.GPUTypeFallbackNever}
+	node, failed = place(false, time.Hour, strict)
+	assert.Equal(t, node, "")
+	assert.Equal(t, failed["node-h"], "node not fit pod, H100 cards are not accepted, the pod doesn't fall back from A100")
+}
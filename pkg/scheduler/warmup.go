@@ -0,0 +1,53 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+// validateGPUWarmup checks the hami.io/gpu-warmup annotations of a pod.
+func validateGPUWarmup(annos map[string]string) error {
+	if v, ok := annos[util.GPUWarmup]; ok && v != "true" && v != "false" {
+		return fmt.Errorf("annotation %s must be \"true\" or \"false\", got %q", util.GPUWarmup, v)
+	}
+	if v, ok := annos[util.GPUWarmupTimeout]; ok {
+		if d, err := time.ParseDuration(v); err != nil || d <= 0 {
+			return fmt.Errorf("annotation %s must be a positive duration, got %q", util.GPUWarmupTimeout, v)
+		}
+	}
+	return nil
+}
+
+// injectWarmupGate adds the hami.io/gpu-warmup readiness gate to a pod asking for GPU warmup,
+// so it isn't ready before the vGPU monitor sees its GPU containers warmed up.
+func injectWarmupGate(pod *corev1.Pod) {
+	if pod.Annotations[util.GPUWarmup] != "true" {
+		return
+	}
+	for _, gate := range pod.Spec.ReadinessGates {
+		if gate.ConditionType == util.GPUWarmupCondition {
+			return
+		}
+	}
+	pod.Spec.ReadinessGates = append(pod.Spec.ReadinessGates, corev1.PodReadinessGate{ConditionType: util.GPUWarmupCondition})
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Project-HAMi/HAMi/pkg/util"
+)
+
+func Test_validateGPUWarmup(t *testing.T) {
+	for _, annos := range []map[string]string{
+		nil,
+		{util.GPUWarmup: "true"},
+		{util.GPUWarmup: "false"},
+		{util.GPUWarmup: "true", util.GPUWarmupTimeout: "15m"},
+	} {
+		assert.NilError(t, validateGPUWarmup(annos), annos)
+	}
+	for _, annos := range []map[string]string{
+		{util.GPUWarmup: "yes"},
+		{util.GPUWarmup: "true", util.GPUWarmupTimeout: "soon"},
+		{util.GPUWarmup: "true", util.GPUWarmupTimeout: "0s"},
+	} {
+		assert.Assert(t, validateGPUWarmup(annos) != nil, annos)
+	}
+}
+
+func Test_injectWarmupGate(t *testing.T) {
+	pod := func(warmup string) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "server", Annotations: map[string]string{util.GPUWarmup: warmup}}}
+	}
+	p := pod("false")
+	injectWarmupGate(p)
+	assert.Equal(t, len(p.Spec.ReadinessGates), 0)
+
+	p = pod("true")
+	injectWarmupGate(p)
+	injectWarmupGate(p)
+	assert.DeepEqual(t, p.Spec.ReadinessGates, []corev1.PodReadinessGate{{ConditionType: util.GPUWarmupCondition}})
+}
@@ -19,10 +19,15 @@ package scheduler
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"math"
 	"net/http"
+	"slices"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/klog/v2"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
@@ -30,12 +35,16 @@ import (
 
 	"github.com/Project-HAMi/HAMi/pkg/device"
 	"github.com/Project-HAMi/HAMi/pkg/scheduler/config"
+	"github.com/Project-HAMi/HAMi/pkg/util"
+	"github.com/Project-HAMi/HAMi/pkg/util/client"
 )
 
 const template = "Processing admission hook for pod %v/%v, UID: %v"
 
 type webhook struct {
 	decoder *admission.Decoder
+	// kubeClient reads the GPU defaults of namespaces, they are skipped without it.
+	kubeClient kubernetes.Interface
 }
 
 func NewWebHook() (*admission.Webhook, error) {
@@ -45,11 +54,11 @@ func NewWebHook() (*admission.Webhook, error) {
 		return nil, err
 	}
 	decoder := admission.NewDecoder(schema)
-	wh := &admission.Webhook{Handler: &webhook{decoder: decoder}}
+	wh := &admission.Webhook{Handler: &webhook{decoder: decoder, kubeClient: client.GetClient()}}
 	return wh, nil
 }
 
-func (h *webhook) Handle(_ context.Context, req admission.Request) admission.Response {
+func (h *webhook) Handle(ctx context.Context, req admission.Request) admission.Response {
 	pod := &corev1.Pod{}
 	err := h.decoder.Decode(req, pod)
 	if err != nil {
@@ -61,7 +70,33 @@ func (h *webhook) Handle(_ context.Context, req admission.Request) admission.Res
 		return admission.Denied("pod has no containers")
 	}
 	klog.Infof(template, req.Namespace, req.Name, req.UID)
+	if err := expandGPUShorthand(pod); err != nil {
+		klog.Warningf(template+" - Denying admission: %v", req.Namespace, req.Name, req.UID, err)
+		return admission.Denied(err.Error())
+	}
+	if err := translateAMDGPU(pod); err != nil {
+		klog.Warningf(template+" - Denying admission: %v", req.Namespace, req.Name, req.UID, err)
+		return admission.Denied(err.Error())
+	}
+	if err := expandDeviceClass(pod); err != nil {
+		klog.Warningf(template+" - Denying admission: %v", req.Namespace, req.Name, req.UID, err)
+		return admission.Denied(err.Error())
+	}
+	if err := validateTFLOPSRequest(pod); err != nil {
+		klog.Warningf(template+" - Denying admission: %v", req.Namespace, req.Name, req.UID, err)
+		return admission.Denied(err.Error())
+	}
+	levels, err := h.gpuDefaultsLevels(ctx, pod, req.Namespace)
+	if err != nil {
+		klog.Errorf(template+" - %v", req.Namespace, req.Name, req.UID, err)
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if err := applyGPUDefaults(pod, levels...); err != nil {
+		klog.Warningf(template+" - Denying admission: %v", req.Namespace, req.Name, req.UID, err)
+		return admission.Denied(err.Error())
+	}
 	hasResource := false
+	gpuContainers := make([]string, 0)
 	for idx, ctr := range pod.Spec.Containers {
 		c := &pod.Spec.Containers[idx]
 		if ctr.SecurityContext != nil {
@@ -70,6 +105,10 @@ func (h *webhook) Handle(_ context.Context, req admission.Request) admission.Res
 				continue
 			}
 		}
+		if err := validateDeviceResources(c); err != nil {
+			klog.Warningf(template+" - Denying admission: %v", req.Namespace, req.Name, req.UID, err)
+			return admission.Denied(err.Error())
+		}
 		for _, val := range device.GetDevices() {
 			found, err := val.MutateAdmission(c, pod)
 			if err != nil {
@@ -77,6 +116,119 @@ func (h *webhook) Handle(_ context.Context, req admission.Request) admission.Res
 				return admission.Errored(http.StatusInternalServerError, err)
 			}
 			hasResource = hasResource || found
+			if found && !slices.Contains(gpuContainers, c.Name) {
+				gpuContainers = append(gpuContainers, c.Name)
+			}
+		}
+	}
+
+	if err := padGPUMemory(pod); err != nil {
+		klog.Warningf(template+" - Denying admission: %v", req.Namespace, req.Name, req.UID, err)
+		return admission.Denied(err.Error())
+	}
+	if err := validateExclusive(pod); err != nil {
+		klog.Warningf(template+" - Denying admission: %v", req.Namespace, req.Name, req.UID, err)
+		return admission.Denied(err.Error())
+	}
+	if v, ok := pod.Annotations[util.ConfidentialCompute]; ok && v != util.ConfidentialComputeRequired && v != util.ConfidentialComputeForbidden {
+		err := fmt.Errorf("annotation %s must be %q or %q, got %q", util.ConfidentialCompute, util.ConfidentialComputeRequired, util.ConfidentialComputeForbidden, v)
+		klog.Warningf(template+" - Denying admission: %v", req.Namespace, req.Name, req.UID, err)
+		return admission.Denied(err.Error())
+	}
+	if err := validateGPUMemoryType(pod.Annotations); err != nil {
+		klog.Warningf(template+" - Denying admission: %v", req.Namespace, req.Name, req.UID, err)
+		return admission.Denied(err.Error())
+	}
+	if err := validateGPUDeviceKind(pod.Annotations); err != nil {
+		klog.Warningf(template+" - Denying admission: %v", req.Namespace, req.Name, req.UID, err)
+		return admission.Denied(err.Error())
+	}
+	if err := validateGPUMinFreeBlock(pod.Annotations); err != nil {
+		klog.Warningf(template+" - Denying admission: %v", req.Namespace, req.Name, req.UID, err)
+		return admission.Denied(err.Error())
+	}
+	if err := validateGPUReclaimableMemory(pod.Annotations); err != nil {
+		klog.Warningf(template+" - Denying admission: %v", req.Namespace, req.Name, req.UID, err)
+		return admission.Denied(err.Error())
+	}
+	if err := validateGPUIdleMemoryLimit(pod.Annotations); err != nil {
+		klog.Warningf(template+" - Denying admission: %v", req.Namespace, req.Name, req.UID, err)
+		return admission.Denied(err.Error())
+	}
+	if v, ok := pod.Annotations[util.Encoder]; ok && v != util.EncoderShared && v != util.EncoderExclusive {
+		err := fmt.Errorf("annotation %s must be %q or %q, got %q", util.Encoder, util.EncoderShared, util.EncoderExclusive, v)
+		klog.Warningf(template+" - Denying admission: %v", req.Namespace, req.Name, req.UID, err)
+		return admission.Denied(err.Error())
+	}
+	if v, ok := pod.Annotations[util.InterconnectFabric]; ok && requestedFabrics(pod.Annotations) == nil {
+		err := fmt.Errorf("annotation %s must list at least one fabric, got %q", util.InterconnectFabric, v)
+		klog.Warningf(template+" - Denying admission: %v", req.Namespace, req.Name, req.UID, err)
+		return admission.Denied(err.Error())
+	}
+	if v, ok := pod.Annotations[util.GPUTypeOrder]; ok && len(gpuTypeOrder(pod.Annotations)) == 0 {
+		err := fmt.Errorf("annotation %s must list at least one card type, got %q", util.GPUTypeOrder, v)
+		klog.Warningf(template+" - Denying admission: %v", req.Namespace, req.Name, req.UID, err)
+		return admission.Denied(err.Error())
+	}
+	if v, ok := pod.Annotations[util.GPUTypeFallbackAfter]; ok {
+		if _, _, err := parseTypeFallbackAfter(v); err != nil {
+			err = fmt.Errorf("annotation %s must be a duration or %q, got %q: %v", util.GPUTypeFallbackAfter, util.GPUTypeFallbackNever, v, err)
+			klog.Warningf(template+" - Denying admission: %v", req.Namespace, req.Name, req.UID, err)
+			return admission.Denied(err.Error())
+		}
+	}
+	if v, ok := pod.Annotations[util.SchedulingDeadline]; ok {
+		if _, err := parseSchedulingDeadline(v); err != nil {
+			err = fmt.Errorf("annotation %s must be a positive duration, got %q: %v", util.SchedulingDeadline, v, err)
+			klog.Warningf(template+" - Denying admission: %v", req.Namespace, req.Name, req.UID, err)
+			return admission.Denied(err.Error())
+		}
+	}
+	if err := validateGPUWarmup(pod.Annotations); err != nil {
+		klog.Warningf(template+" - Denying admission: %v", req.Namespace, req.Name, req.UID, err)
+		return admission.Denied(err.Error())
+	}
+	if err := validateScaleDownCheckpoint(pod.Annotations); err != nil {
+		klog.Warningf(template+" - Denying admission: %v", req.Namespace, req.Name, req.UID, err)
+		return admission.Denied(err.Error())
+	}
+	if err := validateMigSharedCompute(pod.Annotations); err != nil {
+		klog.Warningf(template+" - Denying admission: %v", req.Namespace, req.Name, req.UID, err)
+		return admission.Denied(err.Error())
+	}
+	if err := validateNoiseTolerance(pod.Annotations); err != nil {
+		klog.Warningf(template+" - Denying admission: %v", req.Namespace, req.Name, req.UID, err)
+		return admission.Denied(err.Error())
+	}
+	if err := validateCoreLogLevel(pod.Annotations, gpuContainers); err != nil {
+		klog.Warningf(template+" - Denying admission: %v", req.Namespace, req.Name, req.UID, err)
+		return admission.Denied(err.Error())
+	}
+	if v, ok := pod.Annotations[util.GPUNonPreemptible]; ok && v != "true" && v != "false" {
+		err := fmt.Errorf("annotation %s must be \"true\" or \"false\", got %q", util.GPUNonPreemptible, v)
+		klog.Warningf(template+" - Denying admission: %v", req.Namespace, req.Name, req.UID, err)
+		return admission.Denied(err.Error())
+	}
+	if v, ok := pod.Annotations[util.NamespaceIsolation]; ok && v != "true" && v != "false" {
+		err := fmt.Errorf("annotation %s must be \"true\" or \"false\", got %q", util.NamespaceIsolation, v)
+		klog.Warningf(template+" - Denying admission: %v", req.Namespace, req.Name, req.UID, err)
+		return admission.Denied(err.Error())
+	}
+	if v, ok := pod.Annotations[util.NCCLTopology]; ok && v != "true" && v != "false" {
+		err := fmt.Errorf("annotation %s must be \"true\" or \"false\", got %q", util.NCCLTopology, v)
+		klog.Warningf(template+" - Denying admission: %v", req.Namespace, req.Name, req.UID, err)
+		return admission.Denied(err.Error())
+	}
+	if v, ok := pod.Annotations[util.NvidiaKernelModule]; ok && v != util.NvidiaKernelModuleOpen && v != util.NvidiaKernelModuleProprietary {
+		err := fmt.Errorf("annotation %s must be %q or %q, got %q", util.NvidiaKernelModule, util.NvidiaKernelModuleOpen, util.NvidiaKernelModuleProprietary, v)
+		klog.Warningf(template+" - Denying admission: %v", req.Namespace, req.Name, req.UID, err)
+		return admission.Denied(err.Error())
+	}
+	if v, ok := pod.Annotations[util.CUDAVersion]; ok {
+		if _, err := parseCUDAVersion(v); err != nil {
+			err = fmt.Errorf("annotation %s must be a CUDA version like \"12.2\": %v", util.CUDAVersion, err)
+			klog.Warningf(template+" - Denying admission: %v", req.Namespace, req.Name, req.UID, err)
+			return admission.Denied(err.Error())
 		}
 	}
 
@@ -90,6 +242,13 @@ func (h *webhook) Handle(_ context.Context, req admission.Request) admission.Res
 			return admission.Denied("pod has node assigned")
 		}
 	}
+	if hasResource {
+		injectWarmupGate(pod)
+	}
+	if hasResource && metricsSidecarEnabled(pod) {
+		klog.Infof(template+" - Injecting metrics sidecar", req.Namespace, req.Name, req.UID)
+		injectMetricsSidecar(pod, gpuContainers)
+	}
 	marshaledPod, err := json.Marshal(pod)
 	if err != nil {
 		klog.Errorf(template+" - Failed to marshal pod, error: %v", req.Namespace, req.Name, req.UID, err)
@@ -97,3 +256,56 @@ func (h *webhook) Handle(_ context.Context, req admission.Request) admission.Res
 	}
 	return admission.PatchResponseFromRaw(req.Object.Raw, marshaledPod)
 }
+
+// validateExclusive rejects a hami.io/exclusive pod which explicitly asks for a slice of
+// a card through the core or memory percentage resources, as it would get whole cards anyway.
+func validateExclusive(pod *corev1.Pod) error {
+	v, ok := pod.Annotations[util.Exclusive]
+	if !ok || v == "false" {
+		return nil
+	}
+	if v != "true" {
+		return fmt.Errorf("annotation %s must be \"true\" or \"false\", got %q", util.Exclusive, v)
+	}
+	for idx := range pod.Spec.Containers {
+		c := &pod.Spec.Containers[idx]
+		for _, dev := range device.GetDevices() {
+			req := dev.GenerateResourceRequests(c)
+			if req.Nums == 0 {
+				continue
+			}
+			if (req.Coresreq > 0 && req.Coresreq < 100) || (req.Memreq == 0 && req.MemPercentagereq > 0 && req.MemPercentagereq < 100) {
+				return fmt.Errorf("container %s: %s allocates whole cards and can't be combined with a request for a slice of a card", c.Name, util.Exclusive)
+			}
+		}
+	}
+	return nil
+}
+
+// validateDeviceResources rejects device resource values which can't become a sane
+// request: zero or negative values, fractions and values overflowing the int32 accounting.
+func validateDeviceResources(ctr *corev1.Container) error {
+	for _, list := range []corev1.ResourceList{ctr.Resources.Limits, ctr.Resources.Requests} {
+		names := make([]string, 0, len(list))
+		for name := range list {
+			names = append(names, string(name))
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			if !device.IsDeviceResource(corev1.ResourceName(name)) {
+				continue
+			}
+			q := list[corev1.ResourceName(name)]
+			if q.Sign() <= 0 {
+				return fmt.Errorf("container %s: resource %s must be a positive integer, got %s", ctr.Name, name, q.String())
+			}
+			if q.Cmp(*resource.NewQuantity(math.MaxInt32, resource.DecimalSI)) > 0 {
+				return fmt.Errorf("container %s: resource %s is too large, got %s, max %d", ctr.Name, name, q.String(), math.MaxInt32)
+			}
+			if _, ok := q.AsInt64(); !ok {
+				return fmt.Errorf("container %s: resource %s must be a whole number, got %s", ctr.Name, name, q.String())
+			}
+		}
+	}
+	return nil
+}
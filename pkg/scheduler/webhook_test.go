@@ -18,6 +18,7 @@ package scheduler
 
 import (
 	"context"
+	"net/http"
 	"testing"
 
 	admissionv1 "k8s.io/api/admission/v1"
@@ -168,3 +169,139 @@ func TestPodHasNodeName(t *testing.T) {
 	}
 
 }
+
+func TestHandleValidatesDeviceResources(t *testing.T) {
+	config.SchedulerName = "hami-scheduler"
+	if err := device.InitDevicesWithConfig(&device.Config{
+		NvidiaConfig: nvidia.NvidiaConfig{
+			ResourceCountName:            "hami.io/gpu",
+			ResourceMemoryName:           "hami.io/gpumem",
+			ResourceMemoryPercentageName: "hami.io/gpumem-percentage",
+			ResourceCoreName:             "hami.io/gpucores",
+			ResourcePriority:             "hami.io/priority",
+			DefaultGPUNum:                1,
+		},
+	}); err != nil {
+		t.Fatalf("Failed to initialize devices with config: %v", err)
+	}
+	wh, err := NewWebHook()
+	if err != nil {
+		t.Fatalf("Error creating WebHook: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		limits  string
+		allowed bool
+		code    int32
+	}{
+		{name: "valid request", limits: `"hami.io/gpu": "1", "hami.io/gpumem": "3000"`, allowed: true},
+		{name: "zero priority is valid", limits: `"hami.io/gpu": "1", "hami.io/priority": "0"`, allowed: true},
+		{name: "zero memory", limits: `"hami.io/gpu": "1", "hami.io/gpumem": "0"`, code: http.StatusForbidden},
+		{name: "zero gpus", limits: `"hami.io/gpu": "0"`, code: http.StatusForbidden},
+		{name: "negative cores", limits: `"hami.io/gpu": "1", "hami.io/gpucores": "-30"`, code: http.StatusForbidden},
+		{name: "fractional gpus", limits: `"hami.io/gpu": "500m"`, code: http.StatusForbidden},
+		{name: "absurdly large memory", limits: `"hami.io/gpu": "1", "hami.io/gpumem": "1Ei"`, code: http.StatusForbidden},
+		{name: "non-numeric memory", limits: `"hami.io/gpu": "1", "hami.io/gpumem": "lots"`, code: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			raw := `{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "test-pod", "namespace": "default"},
+				"spec": {"containers": [{"name": "container1", "resources": {"limits": {` + test.limits + `}}}]}}`
+			resp := wh.Handle(context.Background(), admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					UID:       "test-uid",
+					Namespace: "default",
+					Name:      "test-pod",
+					Object:    runtime.RawExtension{Raw: []byte(raw)},
+				},
+			})
+			if resp.Allowed != test.allowed {
+				t.Fatalf("Expected allowed=%v, but got: %v", test.allowed, resp.Result)
+			}
+			if !test.allowed && resp.Result.Code != test.code {
+				t.Errorf("Expected code %d, but got: %v", test.code, resp.Result)
+			}
+		})
+	}
+}
+
+func TestHandleValidatesExclusive(t *testing.T) {
+	config.SchedulerName = "hami-scheduler"
+	if err := device.InitDevicesWithConfig(&device.Config{
+		NvidiaConfig: nvidia.NvidiaConfig{
+			ResourceCountName:            "hami.io/gpu",
+			ResourceMemoryName:           "hami.io/gpumem",
+			ResourceMemoryPercentageName: "hami.io/gpumem-percentage",
+			ResourceCoreName:             "hami.io/gpucores",
+			ResourcePriority:             "hami.io/priority",
+			DefaultGPUNum:                1,
+		},
+	}); err != nil {
+		t.Fatalf("Failed to initialize devices with config: %v", err)
+	}
+	wh, err := NewWebHook()
+	if err != nil {
+		t.Fatalf("Error creating WebHook: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		exclusive string
+		limits    string
+		allowed   bool
+	}{
+		{name: "whole card", exclusive: "true", limits: `"hami.io/gpu": "2"`, allowed: true},
+		{name: "memory request is overridden", exclusive: "true", limits: `"hami.io/gpu": "1", "hami.io/gpumem": "3000"`, allowed: true},
+		{name: "full cores", exclusive: "true", limits: `"hami.io/gpu": "1", "hami.io/gpucores": "100"`, allowed: true},
+		{name: "partial cores", exclusive: "true", limits: `"hami.io/gpu": "1", "hami.io/gpucores": "30"`},
+		{name: "partial memory percentage", exclusive: "true", limits: `"hami.io/gpu": "1", "hami.io/gpumem-percentage": "50"`},
+		{name: "slice without exclusive", exclusive: "false", limits: `"hami.io/gpu": "1", "hami.io/gpucores": "30"`, allowed: true},
+		{name: "malformed value", exclusive: "yes", limits: `"hami.io/gpu": "1"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			raw := `{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "test-pod", "namespace": "default", "annotations": {"hami.io/exclusive": "` + test.exclusive + `"}},
+				"spec": {"containers": [{"name": "container1", "resources": {"limits": {` + test.limits + `}}}]}}`
+			resp := wh.Handle(context.Background(), admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					UID:       "test-uid",
+					Namespace: "default",
+					Name:      "test-pod",
+					Object:    runtime.RawExtension{Raw: []byte(raw)},
+				},
+			})
+			if resp.Allowed != test.allowed {
+				t.Fatalf("Expected allowed=%v, but got: %v", test.allowed, resp.Result)
+			}
+			if !test.allowed && resp.Result.Code != http.StatusForbidden {
+				t.Errorf("Expected code %d, but got: %v", http.StatusForbidden, resp.Result)
+			}
+		})
+	}
+}
+
+func TestHandleValidatesInterconnectFabric(t *testing.T) {
+	prev := device.ActiveConfig()
+	initTFLOPSDevices(t)
+	defer func() {
+		if err := device.InitDevicesWithConfig(prev); err != nil {
+			t.Fatalf("Failed to restore devices: %v", err)
+		}
+	}()
+	wh, err := NewWebHook()
+	if err != nil {
+		t.Fatalf("Error creating WebHook: %v", err)
+	}
+
+	for value, allowed := range map[string]bool{"infiniband,roce": true, "": false, " , ": false} {
+		raw := `{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "test-pod", "namespace": "default", "annotations": {"hami.io/interconnect-fabric": "` + value + `"}},
+			"spec": {"containers": [{"name": "container1", "resources": {"limits": {"hami.io/gpu": "1"}}}]}}`
+		resp := wh.Handle(context.Background(), admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			UID: "test-uid", Namespace: "default", Name: "test-pod", Object: runtime.RawExtension{Raw: []byte(raw)},
+		}})
+		if resp.Allowed != allowed {
+			t.Errorf("%q: expected allowed=%v, but got: %v", value, allowed, resp.Result)
+		}
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"path/filepath"
 	"sync"
 
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -30,7 +31,9 @@ import (
 
 var (
 	KubeClient kubernetes.Interface
-	once       sync.Once
+	// DynamicClient serves the custom resources HAMi publishes.
+	DynamicClient dynamic.Interface
+	once          sync.Once
 )
 
 func init() {
@@ -41,11 +44,16 @@ func GetClient() kubernetes.Interface {
 	return KubeClient
 }
 
+func GetDynamicClient() dynamic.Interface {
+	return DynamicClient
+}
+
 // Client is a kubernetes client.
 type Client struct {
-	Client kubernetes.Interface
-	QPS    float32
-	Burst  int
+	Client  kubernetes.Interface
+	Dynamic dynamic.Interface
+	QPS     float32
+	Burst   int
 }
 
 // WithQPS sets the QPS of the client.
@@ -67,8 +75,13 @@ func NewClientWithConfig(config *rest.Config, opts ...func(*Client)) (*Client, e
 	if err != nil {
 		return nil, err
 	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
 	c := &Client{
-		Client: client,
+		Client:  client,
+		Dynamic: dynamicClient,
 	}
 	for _, opt := range opts {
 		opt(c)
@@ -104,4 +117,5 @@ func InitGlobalClient(ops ...func(*Client)) {
 		klog.Fatalf("new client error %s", err.Error())
 	}
 	KubeClient = c.Client
+	DynamicClient = c.Dynamic
 }
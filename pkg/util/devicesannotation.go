@@ -0,0 +1,323 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+
+	"github.com/Project-HAMi/HAMi/pkg/util/client"
+)
+
+const (
+	// CompactDevicesPrefix starts a device annotation holding the gzip compressed, base64
+	// encoded devices.
+	CompactDevicesPrefix = "gz:"
+	// OverflowDevicesPrefix starts a device annotation whose devices are kept in the
+	// ConfigMap of the node instead, "cm:<namespace>/<name>/<key>".
+	OverflowDevicesPrefix = "cm:"
+	// DevicesOverflowConfigMapPrefix starts the names of the ConfigMaps holding the device
+	// annotations of the pods on a node which overflowed.
+	DevicesOverflowConfigMapPrefix = "hami-devices-"
+
+	// maxCachedOverflows bounds the overflowed annotations kept in memory. Their keys change
+	// with their content, so a cached one never goes stale.
+	maxCachedOverflows = 256
+)
+
+// DevicesAnnotationEncoding tells how the device annotations of pods are written. Readers
+// accept the plain, the compact and the overflowed format alike, whatever it says.
+type DevicesAnnotationEncoding struct {
+	// Compact writes the annotations gzip compressed.
+	Compact bool
+	// OverflowSize is the size above which an annotation is kept in the ConfigMap of the
+	// node of the pod, 0 keeps all of them on the pod.
+	OverflowSize int
+	// OverflowNamespace is the namespace of those ConfigMaps.
+	OverflowNamespace string
+}
+
+var (
+	overflowMutex sync.Mutex
+	overflowCache = make(map[string]string)
+)
+
+// IsDevicesAnnotation reports whether key is an annotation listing the devices of a pod.
+func IsDevicesAnnotation(key string) bool {
+	for _, m := range []map[string]string{InRequestDevices, SupportDevices} {
+		for _, v := range m {
+			if v == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// EncodeDevicesAnnotations encodes the device annotations in annos, which pod placed on
+// nodeID gets, as enc tells. Overflowing annotations are written to the ConfigMap of the
+// node first and replaced by a reference to it.
+func EncodeDevicesAnnotations(pod *corev1.Pod, nodeID string, annos map[string]string, enc DevicesAnnotationEncoding) error {
+	overflow := make(map[string]string)
+	for key, value := range annos {
+		if !IsDevicesAnnotation(key) || value == "" {
+			continue
+		}
+		if enc.Compact {
+			compact, err := compactDevices(value)
+			if err != nil {
+				return err
+			}
+			annos[key] = compact
+		}
+		if enc.OverflowSize > 0 && len(annos[key]) > enc.OverflowSize {
+			overflow[key] = value
+		}
+	}
+	if len(overflow) == 0 {
+		return nil
+	}
+	name := devicesOverflowConfigMap(nodeID)
+	refs := make(map[string]string, len(overflow))
+	err := updateDevicesOverflow(enc.OverflowNamespace, name, func(data map[string]string) error {
+		for key, value := range overflow {
+			compact, err := compactDevices(value)
+			if err != nil {
+				return err
+			}
+			entry := overflowEntry(pod.UID, key, compact)
+			data[entry] = compact
+			refs[key] = OverflowDevicesPrefix + enc.OverflowNamespace + "/" + name + "/" + entry
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write the overflowing device annotations of pod %s/%s: %w", pod.Namespace, pod.Name, err)
+	}
+	for key, ref := range refs {
+		klog.InfoS("Device annotation overflowed into the ConfigMap of the node", "pod", klog.KObj(pod), "annotation", key, "size", len(annos[key]), "ref", ref)
+		annos[key] = ref
+	}
+	return nil
+}
+
+// ReencodeDevicesAnnotation encodes value, the new devices of the annotation key of pod, in
+// the format the annotation has now. An overflowed annotation gets a new entry in the same
+// ConfigMap, which replaces the current one.
+func ReencodeDevicesAnnotation(pod *corev1.Pod, key string, value string) (string, error) {
+	current := pod.Annotations[key]
+	switch {
+	case strings.HasPrefix(current, OverflowDevicesPrefix):
+		namespace, name, entry, err := parseOverflowRef(current)
+		if err != nil {
+			return "", err
+		}
+		compact, err := compactDevices(value)
+		if err != nil {
+			return "", err
+		}
+		next := overflowEntry(pod.UID, key, compact)
+		err = updateDevicesOverflow(namespace, name, func(data map[string]string) error {
+			delete(data, entry)
+			data[next] = compact
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+		return OverflowDevicesPrefix + namespace + "/" + name + "/" + next, nil
+	case strings.HasPrefix(current, CompactDevicesPrefix):
+		return compactDevices(value)
+	default:
+		return value, nil
+	}
+}
+
+// ExpandDevicesAnnotation returns the devices of a device annotation in the plain format,
+// whether it is plain, compact or overflowed into a ConfigMap.
+func ExpandDevicesAnnotation(value string) (string, error) {
+	if strings.HasPrefix(value, OverflowDevicesPrefix) {
+		stored, err := loadDevicesOverflow(value)
+		if err != nil {
+			return "", err
+		}
+		if strings.HasPrefix(stored, OverflowDevicesPrefix) {
+			return "", fmt.Errorf("device annotation %s refers to another ConfigMap", value)
+		}
+		value = stored
+	}
+	if !strings.HasPrefix(value, CompactDevicesPrefix) {
+		return value, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, CompactDevicesPrefix))
+	if err != nil {
+		return "", fmt.Errorf("invalid compact device annotation: %w", err)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("invalid compact device annotation: %w", err)
+	}
+	defer r.Close()
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("invalid compact device annotation: %w", err)
+	}
+	return string(plain), nil
+}
+
+// ReleaseDevicesOverflow removes the overflowed device annotations of pod from the ConfigMap
+// of its node. The entries of other pods are left alone.
+func ReleaseDevicesOverflow(pod *corev1.Pod) error {
+	configMaps := make(map[[2]string]bool)
+	for key, value := range pod.Annotations {
+		if !IsDevicesAnnotation(key) || !strings.HasPrefix(value, OverflowDevicesPrefix) {
+			continue
+		}
+		namespace, name, _, err := parseOverflowRef(value)
+		if err != nil {
+			return err
+		}
+		configMaps[[2]string{namespace, name}] = true
+	}
+	for cm := range configMaps {
+		err := updateDevicesOverflow(cm[0], cm[1], func(data map[string]string) error {
+			for entry := range data {
+				if k8stypes.UID(strings.SplitN(entry, ".", 2)[0]) == pod.UID {
+					delete(data, entry)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func compactDevices(value string) (string, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte(value)); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return CompactDevicesPrefix + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// devicesOverflowConfigMap returns the name of the ConfigMap holding the overflowed device
+// annotations of the pods on nodeID.
+func devicesOverflowConfigMap(nodeID string) string {
+	name := DevicesOverflowConfigMapPrefix + nodeID
+	if len(name) > 253 {
+		sum := sha256.Sum256([]byte(nodeID))
+		name = DevicesOverflowConfigMapPrefix + hex.EncodeToString(sum[:16])
+	}
+	return name
+}
+
+// overflowEntry returns the ConfigMap key of the annotation key of the pod with uid holding
+// value. It changes with value, so readers may cache what they read.
+func overflowEntry(uid k8stypes.UID, key string, value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return string(uid) + "." + strings.ReplaceAll(key, "/", "_") + "." + hex.EncodeToString(sum[:8])
+}
+
+func parseOverflowRef(ref string) (namespace, name, entry string, err error) {
+	s := strings.Split(strings.TrimPrefix(ref, OverflowDevicesPrefix), "/")
+	if len(s) != 3 || s[0] == "" || s[1] == "" || s[2] == "" {
+		return "", "", "", fmt.Errorf("invalid overflowed device annotation %q", ref)
+	}
+	return s[0], s[1], s[2], nil
+}
+
+func loadDevicesOverflow(ref string) (string, error) {
+	overflowMutex.Lock()
+	value, ok := overflowCache[ref]
+	overflowMutex.Unlock()
+	if ok {
+		return value, nil
+	}
+	namespace, name, entry, err := parseOverflowRef(ref)
+	if err != nil {
+		return "", err
+	}
+	cm, err := client.GetClient().CoreV1().ConfigMaps(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to read overflowed device annotation %s: %w", ref, err)
+	}
+	value, ok = cm.Data[entry]
+	if !ok {
+		return "", fmt.Errorf("overflowed device annotation %s not found", ref)
+	}
+	overflowMutex.Lock()
+	if len(overflowCache) >= maxCachedOverflows {
+		overflowCache = make(map[string]string)
+	}
+	overflowCache[ref] = value
+	overflowMutex.Unlock()
+	return value, nil
+}
+
+// updateDevicesOverflow applies update to the data of the ConfigMap namespace/name, which
+// is created if it doesn't exist yet.
+func updateDevicesOverflow(namespace, name string, update func(data map[string]string) error) error {
+	ctx := context.Background()
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := client.GetClient().CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}, Data: map[string]string{}}
+			if err := update(cm.Data); err != nil {
+				return err
+			}
+			_, err = client.GetClient().CoreV1().ConfigMaps(namespace).Create(ctx, cm, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				return apierrors.NewConflict(corev1.Resource("configmaps"), name, err)
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		cm = cm.DeepCopy()
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		if err := update(cm.Data); err != nil {
+			return err
+		}
+		_, err = client.GetClient().CoreV1().ConfigMaps(namespace).Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	})
+}
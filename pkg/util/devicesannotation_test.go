@@ -0,0 +1,196 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	apivalidation "k8s.io/apimachinery/pkg/api/validation"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/Project-HAMi/HAMi/pkg/util/client"
+)
+
+// denseAssignment returns the devices of a pod with 64 containers using 64 MIG instances each.
+func denseAssignment() PodDevices {
+	pd := PodSingleDevice{}
+	for c := 0; c < 64; c++ {
+		ctr := ContainerDevices{}
+		for i := 0; i < 64; i++ {
+			ctr = append(ctr, ContainerDevice{
+				UUID: fmt.Sprintf("GPU-ebe7c3f7-303d-558d-435e-99a160631f%02d[3-%d]", i%16, c%7),
+				Type: "NVIDIA", Usedmem: 24576 * MiB, Usedcores: 14,
+			})
+		}
+		pd = append(pd, ctr)
+	}
+	return PodDevices{"NVIDIA": pd}
+}
+
+func devicesAnnotationsSize(annos map[string]string) int {
+	size := 0
+	for k, v := range annos {
+		size += len(k) + len(v)
+	}
+	return size
+}
+
+func TestEncodeDevicesAnnotations(t *testing.T) {
+	InRequestDevices["NVIDIA"] = "hami.io/vgpu-devices-to-allocate"
+	SupportDevices["NVIDIA"] = "hami.io/vgpu-devices-allocated"
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "dense", Namespace: "default", UID: "uid-dense"}}
+	pd := denseAssignment()
+	plain := func() map[string]string {
+		annos := EncodePodDevices(InRequestDevices, pd)
+		for k, v := range EncodePodDevices(SupportDevices, pd) {
+			annos[k] = v
+		}
+		annos[AssignedNodeAnnotations] = "node1"
+		return annos
+	}
+	// The plain format exceeds the limit of the annotations of an object.
+	assert.Assert(t, devicesAnnotationsSize(plain()) > apivalidation.TotalAnnotationSizeLimitB)
+
+	tests := []struct {
+		name string
+		enc  DevicesAnnotationEncoding
+		// prefix starts both device annotations.
+		prefix string
+	}{
+		{name: "plain", enc: DevicesAnnotationEncoding{}, prefix: "GPU-"},
+		{name: "compact", enc: DevicesAnnotationEncoding{Compact: true}, prefix: CompactDevicesPrefix},
+		{name: "overflow", enc: DevicesAnnotationEncoding{OverflowSize: 1024, OverflowNamespace: "hami-system"}, prefix: OverflowDevicesPrefix},
+		{name: "compact overflow", enc: DevicesAnnotationEncoding{Compact: true, OverflowSize: 1024, OverflowNamespace: "hami-system"}, prefix: OverflowDevicesPrefix},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client.KubeClient = fake.NewSimpleClientset()
+			annos := plain()
+			assert.NilError(t, EncodeDevicesAnnotations(pod, "node1", annos, test.enc))
+			assert.Equal(t, annos[AssignedNodeAnnotations], "node1")
+			for _, key := range []string{InRequestDevices["NVIDIA"], SupportDevices["NVIDIA"]} {
+				assert.Assert(t, strings.HasPrefix(annos[key], test.prefix), annos[key][:16])
+			}
+			if test.enc.Compact || test.enc.OverflowSize > 0 {
+				assert.Assert(t, devicesAnnotationsSize(annos) < apivalidation.TotalAnnotationSizeLimitB/8, "annotations take %d bytes", devicesAnnotationsSize(annos))
+			}
+			// Readers get the same devices whatever the format.
+			for _, checklist := range []map[string]string{InRequestDevices, SupportDevices} {
+				got, err := DecodePodDevices(checklist, annos)
+				assert.NilError(t, err)
+				assert.DeepEqual(t, got, pd)
+			}
+		})
+	}
+}
+
+func TestReencodeDevicesAnnotation(t *testing.T) {
+	InRequestDevices["NVIDIA"] = "hami.io/vgpu-devices-to-allocate"
+	key := InRequestDevices["NVIDIA"]
+	remaining := "GPU-0,NVIDIA,1024,10:;"
+	tests := []struct {
+		name   string
+		enc    DevicesAnnotationEncoding
+		prefix string
+	}{
+		{name: "plain stays plain", enc: DevicesAnnotationEncoding{}, prefix: "GPU-0"},
+		{name: "compact stays compact", enc: DevicesAnnotationEncoding{Compact: true}, prefix: CompactDevicesPrefix},
+		{name: "overflow stays in the ConfigMap", enc: DevicesAnnotationEncoding{OverflowSize: 1, OverflowNamespace: "hami-system"}, prefix: OverflowDevicesPrefix},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client.KubeClient = fake.NewSimpleClientset()
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "p1", Namespace: "default", UID: "uid-1"}}
+			pod.Annotations = map[string]string{key: "GPU-1,NVIDIA,2048,20:;GPU-0,NVIDIA,1024,10:;"}
+			assert.NilError(t, EncodeDevicesAnnotations(pod, "node1", pod.Annotations, test.enc))
+
+			value, err := ReencodeDevicesAnnotation(pod, key, remaining)
+			assert.NilError(t, err)
+			assert.Assert(t, strings.HasPrefix(value, test.prefix), value)
+			expanded, err := ExpandDevicesAnnotation(value)
+			assert.NilError(t, err)
+			assert.Equal(t, expanded, remaining)
+			if test.enc.OverflowSize > 0 {
+				// The new entry replaces the one of the previous devices.
+				cm, err := client.GetClient().CoreV1().ConfigMaps("hami-system").Get(context.Background(), DevicesOverflowConfigMapPrefix+"node1", metav1.GetOptions{})
+				assert.NilError(t, err)
+				assert.Equal(t, len(cm.Data), 1)
+			}
+		})
+	}
+}
+
+func TestReleaseDevicesOverflow(t *testing.T) {
+	InRequestDevices["NVIDIA"] = "hami.io/vgpu-devices-to-allocate"
+	SupportDevices["NVIDIA"] = "hami.io/vgpu-devices-allocated"
+	client.KubeClient = fake.NewSimpleClientset()
+	enc := DevicesAnnotationEncoding{OverflowSize: 1, OverflowNamespace: "hami-system"}
+	pods := make(map[string]*corev1.Pod)
+	for _, name := range []string{"deleted", "live", "gone"} {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: k8stypes.UID("uid-" + name)}}
+		pod.Annotations = map[string]string{
+			InRequestDevices["NVIDIA"]: "GPU-0,NVIDIA,1024,10:;",
+			SupportDevices["NVIDIA"]:   "GPU-0,NVIDIA,1024,10:;",
+		}
+		assert.NilError(t, EncodeDevicesAnnotations(pod, "node1", pod.Annotations, enc))
+		pods[name] = pod
+	}
+	configMap := func() map[string]string {
+		cm, err := client.GetClient().CoreV1().ConfigMaps("hami-system").Get(context.Background(), DevicesOverflowConfigMapPrefix+"node1", metav1.GetOptions{})
+		assert.NilError(t, err)
+		return cm.Data
+	}
+	assert.Equal(t, len(configMap()), 6)
+
+	// A pod without overflowed annotations has nothing to release.
+	assert.NilError(t, ReleaseDevicesOverflow(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{UID: "uid-plain"}}))
+	assert.Equal(t, len(configMap()), 6)
+
+	// Only the entries of the deleted pod go, whichever pods the scheduler holds.
+	assert.NilError(t, ReleaseDevicesOverflow(pods["deleted"]))
+	data := configMap()
+	assert.Equal(t, len(data), 4)
+	for entry := range data {
+		assert.Assert(t, !strings.HasPrefix(entry, "uid-deleted."), entry)
+	}
+	got, err := DecodePodDevices(SupportDevices, pods["live"].Annotations)
+	assert.NilError(t, err)
+	assert.Equal(t, got["NVIDIA"][0][0].UUID, "GPU-0")
+}
+
+func TestExpandDevicesAnnotation(t *testing.T) {
+	client.KubeClient = fake.NewSimpleClientset()
+	for _, value := range []string{
+		CompactDevicesPrefix + "not base64",
+		CompactDevicesPrefix + "bm90IGd6aXA=",
+		OverflowDevicesPrefix + "hami-system/missing",
+		OverflowDevicesPrefix + "hami-system/hami-devices-node1/uid-1.key.0",
+	} {
+		_, err := ExpandDevicesAnnotation(value)
+		assert.Assert(t, err != nil, value)
+	}
+	got, err := ExpandDevicesAnnotation("GPU-0,NVIDIA,1024,10:;")
+	assert.NilError(t, err)
+	assert.Equal(t, got, "GPU-0,NVIDIA,1024,10:;")
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// DRADriverName is the driver name of the HAMi DRA driver. The devices it publishes in
+// ResourceSlices carry it, DeviceClasses select them by it.
+const DRADriverName = "gpu.hami.io"
+
+var (
+	// ResourceSliceResource is the resource of the ResourceSlices the device plugin publishes
+	// the card slots of its node in.
+	ResourceSliceResource = schema.GroupVersionResource{Group: "resource.k8s.io", Version: "v1beta1", Resource: "resourceslices"}
+	// ResourceClaimResource is the resource of the ResourceClaims kube-scheduler allocates
+	// those slots to.
+	ResourceClaimResource = schema.GroupVersionResource{Group: "resource.k8s.io", Version: "v1beta1", Resource: "resourceclaims"}
+)
+
+// DRAClaim holds the fields of a resource.k8s.io/v1beta1 ResourceClaim HAMi reads. The client
+// libraries HAMi builds with don't have the type, claims are converted from unstructured.
+type DRAClaim struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Status            DRAClaimStatus `json:"status,omitempty"`
+}
+
+type DRAClaimStatus struct {
+	Allocation *DRAAllocationResult `json:"allocation,omitempty"`
+}
+
+type DRAAllocationResult struct {
+	Devices DRADeviceAllocationResult `json:"devices,omitempty"`
+}
+
+type DRADeviceAllocationResult struct {
+	Results []DRADeviceRequestAllocationResult `json:"results,omitempty"`
+	Config  []DRADeviceAllocationConfiguration `json:"config,omitempty"`
+}
+
+// DRADeviceRequestAllocationResult is a device kube-scheduler allocated to a request of a claim.
+type DRADeviceRequestAllocationResult struct {
+	Request string `json:"request"`
+	Driver  string `json:"driver"`
+	Pool    string `json:"pool"`
+	Device  string `json:"device"`
+}
+
+// DRADeviceAllocationConfiguration is a configuration of the DeviceClass or of the claim,
+// copied into the allocation. Requests limits it to some requests of the claim.
+type DRADeviceAllocationConfiguration struct {
+	Source   string                        `json:"source"`
+	Requests []string                      `json:"requests,omitempty"`
+	Opaque   *DRAOpaqueDeviceConfiguration `json:"opaque,omitempty"`
+}
+
+type DRAOpaqueDeviceConfiguration struct {
+	Driver     string               `json:"driver"`
+	Parameters runtime.RawExtension `json:"parameters"`
+}
+
+// DRADeviceConfig is the opaque configuration of the HAMi driver, the share of its card an
+// allocated slot gets:
+//
+//	config:
+//	- opaque:
+//	    driver: gpu.hami.io
+//	    parameters:
+//	      memory: 3000 # MiB
+//	      cores: 30    # percent
+//
+// memory and memoryPercentage are exclusive, without either the slot gets the whole memory
+// of its card.
+type DRADeviceConfig struct {
+	Memory           int32  `json:"memory,omitempty"`
+	MemoryPercentage *int32 `json:"memoryPercentage,omitempty"`
+	Cores            int32  `json:"cores,omitempty"`
+}
+
+// DRAAllocatedDevice is a slot of a card allocated to a request of a claim.
+type DRAAllocatedDevice struct {
+	Request string
+	Pool    string
+	Device  string
+	// Index is the index of the card of the slot.
+	Index  uint
+	Config DRADeviceConfig
+}
+
+// ClaimFromUnstructured converts a ResourceClaim read with the dynamic client.
+func ClaimFromUnstructured(obj map[string]any) (*DRAClaim, error) {
+	claim := &DRAClaim{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj, claim); err != nil {
+		return nil, fmt.Errorf("invalid ResourceClaim: %w", err)
+	}
+	return claim, nil
+}
+
+// DRADeviceName returns the name of slot of the card with index in the ResourceSlice of its node.
+func DRADeviceName(index uint, slot int32) string {
+	return fmt.Sprintf("gpu-%d-%d", index, slot)
+}
+
+// ParseDRADeviceName returns the index of the card of a slot named by DRADeviceName.
+func ParseDRADeviceName(name string) (uint, error) {
+	var index uint
+	var slot int32
+	if n, err := fmt.Sscanf(name, "gpu-%d-%d", &index, &slot); err != nil || n != 2 || DRADeviceName(index, slot) != name {
+		return 0, fmt.Errorf("invalid device name %q", name)
+	}
+	return index, nil
+}
+
+// ParseDRADeviceConfig reads and validates the parameters of an opaque configuration.
+func ParseDRADeviceConfig(raw []byte) (DRADeviceConfig, error) {
+	c := DRADeviceConfig{}
+	if len(raw) == 0 {
+		return c, nil
+	}
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return c, fmt.Errorf("invalid device configuration: %w", err)
+	}
+	if c.Memory < 0 || c.Cores < 0 || (c.MemoryPercentage != nil && *c.MemoryPercentage < 0) {
+		return c, fmt.Errorf("device configuration can't be negative")
+	}
+	if c.Memory > 0 && c.MemoryPercentage != nil {
+		return c, fmt.Errorf("device configuration memory and memoryPercentage are exclusive")
+	}
+	if c.MemoryPercentage != nil && *c.MemoryPercentage > 100 {
+		return c, fmt.Errorf("device configuration memoryPercentage can't exceed 100")
+	}
+	if c.Cores > 100 {
+		return c, fmt.Errorf("device configuration cores can't exceed 100")
+	}
+	return c, nil
+}
+
+// AllocatedDevices returns the slots of the HAMi driver allocated to claim, each with the
+// configuration of its request. Of several configurations applying to a request the last
+// one wins, the ones of the claim come after the ones of its DeviceClass.
+func (claim *DRAClaim) AllocatedDevices() ([]DRAAllocatedDevice, error) {
+	alloc := claim.Status.Allocation
+	if alloc == nil {
+		return nil, nil
+	}
+	var devices []DRAAllocatedDevice
+	for _, r := range alloc.Devices.Results {
+		if r.Driver != DRADriverName {
+			continue
+		}
+		index, err := ParseDRADeviceName(r.Device)
+		if err != nil {
+			return nil, err
+		}
+		dev := DRAAllocatedDevice{Request: r.Request, Pool: r.Pool, Device: r.Device, Index: index}
+		for _, c := range alloc.Devices.Config {
+			if c.Opaque == nil || c.Opaque.Driver != DRADriverName {
+				continue
+			}
+			if len(c.Requests) > 0 && !slices.Contains(c.Requests, r.Request) {
+				continue
+			}
+			if dev.Config, err = ParseDRADeviceConfig(c.Opaque.Parameters.Raw); err != nil {
+				return nil, fmt.Errorf("request %s: %w", r.Request, err)
+			}
+		}
+		devices = append(devices, dev)
+	}
+	return devices, nil
+}
+
+// ContainerDevice returns the usage of card, a device of vendor, the configuration gives a
+// slot of it.
+func (c DRADeviceConfig) ContainerDevice(vendor string, card DeviceInfo) ContainerDevice {
+	mem := MemoryToBytes(vendor, int64(card.Devmem))
+	switch {
+	case c.Memory > 0:
+		mem = MemoryToBytes(vendor, int64(c.Memory))
+	case c.MemoryPercentage != nil:
+		mem = mem * int64(*c.MemoryPercentage) / 100
+	}
+	return ContainerDevice{UUID: card.ID, Type: vendor, Usedmem: mem, Usedcores: c.Cores}
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestParseDRADeviceConfig(t *testing.T) {
+	percentage := int32(50)
+	tests := []struct {
+		name string
+		raw  string
+		want DRADeviceConfig
+		err  string
+	}{
+		{name: "no parameters", raw: "", want: DRADeviceConfig{}},
+		{name: "memory in MiB", raw: `{"memory": 3000, "cores": 30}`, want: DRADeviceConfig{Memory: 3000, Cores: 30}},
+		{name: "memory percentage", raw: `{"memoryPercentage": 50}`, want: DRADeviceConfig{MemoryPercentage: &percentage}},
+		{name: "unknown type", raw: `{"memory": "lots"}`, err: "invalid device configuration"},
+		{name: "negative", raw: `{"cores": -1}`, err: "can't be negative"},
+		{name: "exclusive memory keys", raw: `{"memory": 1000, "memoryPercentage": 50}`, err: "exclusive"},
+		{name: "percentage above 100", raw: `{"memoryPercentage": 150}`, err: "memoryPercentage can't exceed 100"},
+		{name: "cores above 100", raw: `{"cores": 101}`, err: "cores can't exceed 100"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, err := ParseDRADeviceConfig([]byte(test.raw))
+			if test.err != "" {
+				assert.ErrorContains(t, err, test.err)
+				return
+			}
+			assert.NilError(t, err)
+			assert.DeepEqual(t, c, test.want)
+		})
+	}
+}
+
+func TestDRAClaimAllocatedDevices(t *testing.T) {
+	obj := map[string]any{
+		"apiVersion": "resource.k8s.io/v1beta1",
+		"kind":       "ResourceClaim",
+		"metadata":   map[string]any{"name": "c1", "namespace": "default", "uid": "claim-uid"},
+		"status": map[string]any{
+			"allocation": map[string]any{
+				"devices": map[string]any{
+					"results": []any{
+						map[string]any{"request": "gpu", "driver": DRADriverName, "pool": "node1", "device": "gpu-0-3"},
+						map[string]any{"request": "big", "driver": DRADriverName, "pool": "node1", "device": "gpu-1-0"},
+						map[string]any{"request": "nic", "driver": "nic.example.com", "pool": "node1", "device": "eth0"},
+					},
+					"config": []any{
+						map[string]any{"source": "FromClass", "opaque": map[string]any{"driver": DRADriverName, "parameters": map[string]any{"cores": int64(10)}}},
+						map[string]any{"source": "FromClaim", "requests": []any{"gpu"}, "opaque": map[string]any{"driver": DRADriverName, "parameters": map[string]any{"memory": int64(3000), "cores": int64(30)}}},
+						map[string]any{"source": "FromClaim", "opaque": map[string]any{"driver": "nic.example.com", "parameters": map[string]any{"mtu": int64(9000)}}},
+					},
+				},
+			},
+		},
+	}
+	claim, err := ClaimFromUnstructured(obj)
+	assert.NilError(t, err)
+	devices, err := claim.AllocatedDevices()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, devices, []DRAAllocatedDevice{
+		{Request: "gpu", Pool: "node1", Device: "gpu-0-3", Index: 0, Config: DRADeviceConfig{Memory: 3000, Cores: 30}},
+		{Request: "big", Pool: "node1", Device: "gpu-1-0", Index: 1, Config: DRADeviceConfig{Cores: 10}},
+	})
+
+	card := DeviceInfo{ID: "GPU-1", Devmem: 8192}
+	assert.DeepEqual(t, devices[0].Config.ContainerDevice("NVIDIA", card), ContainerDevice{UUID: "GPU-1", Type: "NVIDIA", Usedmem: 3000 * MiB, Usedcores: 30})
+	assert.DeepEqual(t, devices[1].Config.ContainerDevice("NVIDIA", card), ContainerDevice{UUID: "GPU-1", Type: "NVIDIA", Usedmem: 8192 * MiB, Usedcores: 10})
+
+	for _, name := range []string{"gpu-0", "gpu-a-1", "gpu-01-1", "eth0"} {
+		_, err := ParseDRADeviceName(name)
+		assert.Assert(t, err != nil, name)
+	}
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package health serves the /healthz and /readyz endpoints of the HAMi components.
+package health
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// Check is a named health check. It returns nil if the check passes.
+type Check struct {
+	Name  string
+	Check func() error
+}
+
+// Ping always passes, it only shows the component serves requests.
+var Ping = Check{Name: "ping", Check: func() error { return nil }}
+
+// Result is the outcome of a single check.
+type Result struct {
+	Name string
+	Err  error
+}
+
+// Run runs checks in order and reports whether all passed.
+func Run(checks []Check) ([]Result, bool) {
+	results := make([]Result, 0, len(checks))
+	ok := true
+	for _, c := range checks {
+		err := c.Check()
+		if err != nil {
+			ok = false
+		}
+		results = append(results, Result{Name: c.Name, Err: err})
+	}
+	return results, ok
+}
+
+// Handler serves the aggregated result of checks in the format of the Kubernetes components:
+// "ok" with status 200 if all checks pass, otherwise every check with its error and status 500.
+// With the verbose query parameter every check is listed anyway. name shows up in the logs.
+func Handler(name string, checks ...Check) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		results, ok := Run(checks)
+		_, verbose := r.URL.Query()["verbose"]
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		if ok && !verbose {
+			fmt.Fprint(w, "ok")
+			return
+		}
+		var b strings.Builder
+		for _, res := range results {
+			if res.Err != nil {
+				fmt.Fprintf(&b, "[-]%s failed: %v\n", res.Name, res.Err)
+				klog.V(2).InfoS("Health check failed", "endpoint", name, "check", res.Name, "err", res.Err)
+			} else {
+				fmt.Fprintf(&b, "[+]%s ok\n", res.Name)
+			}
+		}
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(&b, "%s check failed", name)
+		} else {
+			fmt.Fprintf(&b, "%s check passed", name)
+		}
+		fmt.Fprint(w, b.String())
+	}
+}
+
+// CertificateCheck fails if cert, the serving certificate of a component, is not valid right now.
+func CertificateCheck(cert *tls.Certificate) Check {
+	return Check{Name: "serving-cert", Check: func() error {
+		if cert == nil || len(cert.Certificate) == 0 {
+			return fmt.Errorf("no serving certificate loaded")
+		}
+		leaf := cert.Leaf
+		if leaf == nil {
+			var err error
+			if leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+				return fmt.Errorf("invalid serving certificate: %v", err)
+			}
+		}
+		now := time.Now()
+		if now.Before(leaf.NotBefore) {
+			return fmt.Errorf("serving certificate is not valid before %s", leaf.NotBefore.Format(time.RFC3339))
+		}
+		if now.After(leaf.NotAfter) {
+			return fmt.Errorf("serving certificate expired at %s", leaf.NotAfter.Format(time.RFC3339))
+		}
+		return nil
+	}}
+}
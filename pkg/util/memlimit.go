@@ -0,0 +1,104 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MemoryLimitEnvValue formats b bytes the way the device plugin writes
+// CUDA_DEVICE_MEMORY_LIMIT_<n>: whole MiB with the "m" suffix, rounded up.
+func MemoryLimitEnvValue(b int64) string {
+	if b <= 0 {
+		return "0m"
+	}
+	return fmt.Sprintf("%vm", (b+MiB-1)/MiB)
+}
+
+// ParseMemoryLimitEnv parses a CUDA_DEVICE_MEMORY_LIMIT value the way HAMi-core
+// does: an unsigned integer with an optional k, m or g suffix (case insensitive,
+// binary multiples). A value without suffix is in bytes.
+func ParseMemoryLimitEnv(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("empty memory limit")
+	}
+	unit := int64(1)
+	switch s[len(s)-1] {
+	case 'k', 'K':
+		unit = 1 << 10
+	case 'm', 'M':
+		unit = MiB
+	case 'g', 'G':
+		unit = 1 << 30
+	}
+	digits := s
+	if unit != 1 {
+		digits = s[:len(s)-1]
+	}
+	v, err := strconv.ParseUint(digits, 10, 63)
+	if err != nil {
+		return 0, fmt.Errorf("invalid memory limit %q: expected an integer with an optional k, m or g suffix", s)
+	}
+	if int64(v) > (1<<63-1)/unit {
+		return 0, fmt.Errorf("memory limit %q overflows", s)
+	}
+	return int64(v) * unit, nil
+}
+
+// MemoryLimitReport describes the limit HAMi-core enforces for a requested amount of memory.
+type MemoryLimitReport struct {
+	Input string `json:"input"`
+	// RequestedBytes is the amount the scheduler accounts for the container.
+	RequestedBytes int64 `json:"requestedBytes"`
+	// Env is the CUDA_DEVICE_MEMORY_LIMIT value handed to the container.
+	Env string `json:"env"`
+	// EffectiveBytes is the limit HAMi-core enforces after parsing Env.
+	EffectiveBytes int64 `json:"effectiveBytes"`
+	// RoundedBytes is EffectiveBytes - RequestedBytes.
+	RoundedBytes    int64  `json:"roundedBytes"`
+	CardMemoryBytes int64  `json:"cardMemoryBytes,omitempty"`
+	ExceedsCard     bool   `json:"exceedsCard,omitempty"`
+	Warning         string `json:"warning,omitempty"`
+}
+
+// EvaluateMemoryLimit reports how HAMi-core enforces env for a container which was
+// scheduled with requested bytes. cardBytes is the memory of the target card, or 0 when unknown.
+func EvaluateMemoryLimit(input, env string, requested, cardBytes int64) (MemoryLimitReport, error) {
+	r := MemoryLimitReport{
+		Input:           input,
+		RequestedBytes:  requested,
+		Env:             env,
+		CardMemoryBytes: cardBytes,
+	}
+	effective, err := ParseMemoryLimitEnv(env)
+	if err != nil {
+		return r, err
+	}
+	r.EffectiveBytes = effective
+	r.RoundedBytes = effective - requested
+	switch {
+	case effective == 0:
+		r.Warning = "a zero limit leaves the container without device memory"
+	case cardBytes > 0 && effective > cardBytes:
+		r.ExceedsCard = true
+		r.Warning = fmt.Sprintf("limit exceeds the card memory of %d bytes, the container can only use it with oversubscription", cardBytes)
+	}
+	return r, nil
+}
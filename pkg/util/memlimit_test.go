@@ -0,0 +1,83 @@
+/*
+Copyright 2024 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestParseMemoryLimitEnv(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+		err  bool
+	}{
+		{in: "3000m", want: 3000 * MiB},
+		{in: "3000M", want: 3000 * MiB},
+		{in: "2g", want: 2 << 30},
+		{in: "512k", want: 512 << 10},
+		{in: "1000", want: 1000},
+		{in: " 16G ", want: 16 << 30},
+		{in: "", err: true},
+		{in: "m", err: true},
+		{in: "1.5g", err: true},
+		{in: "-1m", err: true},
+		{in: "3Gi", err: true},
+		{in: "99999999999999999g", err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.in, func(t *testing.T) {
+			got, err := ParseMemoryLimitEnv(test.in)
+			if test.err {
+				assert.Assert(t, err != nil)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, got, test.want)
+		})
+	}
+}
+
+func TestEvaluateMemoryLimit(t *testing.T) {
+	r, err := EvaluateMemoryLimit("gpumem=3000", MemoryLimitEnvValue(3000*MiB), 3000*MiB, 0)
+	assert.NilError(t, err)
+	assert.Equal(t, r.Env, "3000m")
+	assert.Equal(t, r.EffectiveBytes, 3000*MiB)
+	assert.Equal(t, r.RoundedBytes, int64(0))
+	assert.Equal(t, r.Warning, "")
+
+	// A percentage of a card rarely lands on a MiB boundary and is rounded up.
+	requested := 40960 * MiB * 33 / 100
+	r, err = EvaluateMemoryLimit("gpumem-percentage=33", MemoryLimitEnvValue(requested), requested, 40960*MiB)
+	assert.NilError(t, err)
+	assert.Equal(t, r.Env, "13517m")
+	assert.Equal(t, r.EffectiveBytes, 13517*MiB)
+	assert.Assert(t, r.RoundedBytes > 0 && r.RoundedBytes < MiB)
+	assert.Equal(t, r.ExceedsCard, false)
+
+	r, err = EvaluateMemoryLimit("2g", "2g", 2<<30, 1024*MiB)
+	assert.NilError(t, err)
+	assert.Equal(t, r.ExceedsCard, true)
+	assert.Assert(t, r.Warning != "")
+
+	r, err = EvaluateMemoryLimit("0", MemoryLimitEnvValue(0), 0, 0)
+	assert.NilError(t, err)
+	assert.Equal(t, r.Env, "0m")
+	assert.Assert(t, r.Warning != "")
+}
@@ -18,6 +18,7 @@ package nodelock
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
@@ -38,6 +39,9 @@ const (
 
 var lock sync.Mutex
 
+// ErrNodeLocked is wrapped by the errors returned when another pod holds the node lock.
+var ErrNodeLocked = errors.New("node lock is held by another pod")
+
 func SetNodeLock(nodeName string, lockname string, pods *corev1.Pod) error {
 	lock.Lock()
 	defer lock.Unlock()
@@ -47,7 +51,7 @@ func SetNodeLock(nodeName string, lockname string, pods *corev1.Pod) error {
 		return err
 	}
 	if _, ok := node.Annotations[NodeLockKey]; ok {
-		return fmt.Errorf("node %s is locked", nodeName)
+		return fmt.Errorf("node %s is locked: %w", nodeName, ErrNodeLocked)
 	}
 	newNode := node.DeepCopy()
 	newNode.Annotations[NodeLockKey] = GenerateNodeLockKeyByPod(pods)
@@ -109,6 +113,38 @@ func ReleaseNodeLock(nodeName string, lockname string, pod *corev1.Pod, timeout
 	return nil
 }
 
+// TransferNodeLock hands the node lock held by from over to to with a single node update,
+// instead of releasing it and setting it again. It fails without writing the node if the
+// lock isn't held by from.
+func TransferNodeLock(nodeName string, from *corev1.Pod, to *corev1.Pod) error {
+	lock.Lock()
+	defer lock.Unlock()
+	ctx := context.Background()
+	node, err := client.GetClient().CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	lockStr, ok := node.Annotations[NodeLockKey]
+	if !ok {
+		return fmt.Errorf("node %s is not locked", nodeName)
+	}
+	_, ns, name, err := ParseNodeLock(lockStr)
+	if err != nil {
+		return err
+	}
+	if ns != from.Namespace || name != from.Name {
+		return fmt.Errorf("node %s is locked by %s/%s: %w", nodeName, ns, name, ErrNodeLocked)
+	}
+	newNode := node.DeepCopy()
+	newNode.Annotations[NodeLockKey] = GenerateNodeLockKeyByPod(to)
+	_, err = client.GetClient().CoreV1().Nodes().Update(ctx, newNode, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	klog.InfoS("Node lock transferred", "node", nodeName, "from", from.Name, "podName", to.Name)
+	return nil
+}
+
 func LockNode(nodeName string, lockname string, pods *corev1.Pod) error {
 	ctx := context.Background()
 	node, err := client.GetClient().CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
@@ -131,7 +167,7 @@ func LockNode(nodeName string, lockname string, pods *corev1.Pod) error {
 		}
 		return SetNodeLock(nodeName, lockname, pods)
 	}
-	return fmt.Errorf("node %s has been locked within 5 minutes", nodeName)
+	return fmt.Errorf("node %s has been locked within 5 minutes: %w", nodeName, ErrNodeLocked)
 }
 
 func ParseNodeLock(value string) (lockTime time.Time, ns, name string, err error) {
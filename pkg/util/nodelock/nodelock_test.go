@@ -235,3 +235,55 @@ func TestReleaseNodeLock(t *testing.T) {
 		})
 	}
 }
+
+func TestTransferNodeLock(t *testing.T) {
+	from := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "hami", Namespace: "hami-ns"}}
+	to := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "next", Namespace: "hami-ns"}}
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		wantErr     bool
+		wantOwner   string
+	}{
+		{
+			name:        "node is not locked",
+			annotations: map[string]string{},
+			wantErr:     true,
+		},
+		{
+			name: "node is locked by another pod",
+			annotations: map[string]string{
+				NodeLockKey: GenerateNodeLockKeyByPod(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "namespace"}}),
+			},
+			wantErr:   true,
+			wantOwner: "pod",
+		},
+		{
+			name:        "successfully transfer node lock",
+			annotations: map[string]string{NodeLockKey: GenerateNodeLockKeyByPod(from)},
+			wantErr:     false,
+			wantOwner:   "next",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client.KubeClient = fake.NewSimpleClientset(&corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "worker", Annotations: tt.annotations},
+			})
+			if err := TransferNodeLock("worker", from, to); (err != nil) != tt.wantErr {
+				t.Errorf("TransferNodeLock() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			node, err := client.KubeClient.CoreV1().Nodes().Get(context.TODO(), "worker", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			owner := ""
+			if lockStr, ok := node.Annotations[NodeLockKey]; ok {
+				_, _, owner, _ = ParseNodeLock(lockStr)
+			}
+			if owner != tt.wantOwner {
+				t.Errorf("TransferNodeLock() owner = %q, want %q", owner, tt.wantOwner)
+			}
+		})
+	}
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package util
 
 import (
+	"time"
+
 	corev1 "k8s.io/api/core/v1"
 )
 
@@ -33,6 +35,9 @@ const (
 	DeviceBindSuccess    = "success"
 
 	DeviceLimit = 100
+
+	// MiB is the memory unit used by most vendors.
+	MiB int64 = 1 << 20
 	//TimeLayout = "ANSIC"
 	//DefaultTimeout = time.Second * 60.
 
@@ -44,6 +49,192 @@ const (
 	NodeNameEnvName = "NODE_NAME"
 	TaskPriority    = "CUDA_TASK_PRIORITY"
 	CoreLimitSwitch = "GPU_CORE_UTILIZATION_POLICY"
+	// CoreLogLevelEnv sets the verbosity of the logs HAMi-core writes to the stderr of a container.
+	CoreLogLevelEnv = "LIBCUDA_LOG_LEVEL"
+
+	// PCIeSwitchBind requires all devices of a pod to be attached under the same PCIe switch.
+	PCIeSwitchBind = "hami.io/pcie-switch-bind"
+	// LatencySensitive marks a pod whose devices should be picked for responsiveness rather than packing.
+	LatencySensitive = "hami.io/latency-sensitive"
+	// PCIeBandwidthHeavy marks a pod which moves a lot of data over PCIe, such pods are spread across PCIe switches.
+	PCIeBandwidthHeavy = "hami.io/pcie-bandwidth-heavy"
+	// NoiseTolerance is how well a pod tolerates co-tenants on its cards, NoiseToleranceLow or
+	// NoiseToleranceHigh. Pods with a low tolerance prefer cards with fewer and less busy co-tenants.
+	NoiseTolerance     = "hami.io/noise-tolerance"
+	NoiseToleranceLow  = "low"
+	NoiseToleranceHigh = "high"
+	// InterconnectFabric restricts a pod to nodes with one of the listed fabrics, e.g. "infiniband".
+	InterconnectFabric = "hami.io/interconnect-fabric"
+	// NodeFabricAnnos is the interconnect fabric the device plugin detected on the node.
+	NodeFabricAnnos = "hami.io/node-interconnect-fabric"
+	// NvidiaKernelModule restricts a pod to nodes whose NVIDIA driver runs the "open" or the
+	// "proprietary" kernel module.
+	NvidiaKernelModule            = "hami.io/nvidia-kernel-module"
+	NvidiaKernelModuleOpen        = "open"
+	NvidiaKernelModuleProprietary = "proprietary"
+	// NodeNvidiaKernelModuleAnnos is the NVIDIA kernel module variant the device plugin detected on the node.
+	NodeNvidiaKernelModuleAnnos = "hami.io/node-nvidia-kernel-module"
+	// CUDAVersion is the minimum CUDA version, e.g. "12.2", the driver of the node of a pod must support.
+	CUDAVersion = "hami.io/cuda-version"
+	// NodeNvidiaDriverVersionAnnos is the NVIDIA driver version the device plugin detected on the node.
+	NodeNvidiaDriverVersionAnnos = "hami.io/node-nvidia-driver-version"
+	// NodeNvidiaCUDAVersionAnnos is the highest CUDA version the NVIDIA driver of the node supports, e.g. "12.2".
+	NodeNvidiaCUDAVersionAnnos = "hami.io/node-nvidia-cuda-version"
+	// NodeDevicePluginVersionAnnos is the version of the HAMi device plugin running on the node,
+	// e.g. "v2.5.0", which the scheduler checks against its own before placing pods there.
+	NodeDevicePluginVersionAnnos = "hami.io/node-device-plugin-version"
+	// MigReconfigNodeLabel set to MigReconfigAllowed lets the device plugin re-partition the idle
+	// MIG cards of the node for pending pods, see --mig-auto-reconfig.
+	MigReconfigNodeLabel = "hami.io/mig-reconfig"
+	MigReconfigAllowed   = "allowed"
+	// NodeNVLinkFabricAnnos is the health of the NVSwitch fabric the GPUs of the node are attached to:
+	// "healthy", "unhealthy: <reason>", or empty if the GPUs aren't attached to one.
+	NodeNVLinkFabricAnnos = "hami.io/node-nvlink-fabric"
+	NVLinkFabricHealthy   = "healthy"
+	NVLinkFabricUnhealthy = "unhealthy"
+	// NodeGPUMaintenanceWindow is a "<start>/<end>" window of a node during which no GPU pods
+	// are placed on it. NodeGPUMaintenanceTimezone is the IANA time zone of start and end if
+	// they don't carry an offset, UTC if unset.
+	NodeGPUMaintenanceWindow   = "hami.io/gpu-maintenance-window"
+	NodeGPUMaintenanceTimezone = "hami.io/gpu-maintenance-timezone"
+	// Exclusive gives every device of a pod a whole physical card, regardless of the memory and core request.
+	Exclusive = "hami.io/exclusive"
+	// ConfidentialCompute is "required" to place a pod only on cards running in confidential
+	// computing mode, or "forbidden" to keep it off them.
+	ConfidentialCompute          = "hami.io/confidential-compute"
+	ConfidentialComputeRequired  = "required"
+	ConfidentialComputeForbidden = "forbidden"
+	// GPUShorthand requests GPUs for the only container of a pod in one annotation, e.g.
+	// "count=2,mem=8Gi,cores=50". The webhook expands it into the device resources.
+	GPUShorthand = "hami.io/gpu"
+	// GPUShorthandPrefix followed by a container name targets the shorthand at that container.
+	GPUShorthandPrefix = "hami.io/gpu."
+	// GPUDefaults holds the GPU memory and cores, e.g. "mem=4Gi,cores=30", given to the GPU
+	// containers of a pod which don't request them. It is read from the pod, usually set by the
+	// pod template of its owner, and from its namespace.
+	GPUDefaults = "hami.io/gpu-defaults"
+	// CoreLogLevel sets the HAMi-core log level of the GPU containers of a pod, e.g. "4", or of
+	// some of them only, e.g. "trainer=4,loader=3", instead of the one of the device config.
+	CoreLogLevel = "hami.io/core-log-level"
+	// DeviceClass requests GPUs for the only container of a pod by the name of a device class
+	// defined in the device config. The webhook expands it into the device resources and card types.
+	DeviceClass = "hami.io/class"
+	// DeviceClassPrefix followed by a container name targets the class at that container.
+	DeviceClassPrefix = "hami.io/class."
+	// TFLOPSRequest is the throughput a pod wants from each of its NVIDIA GPUs. The scheduler
+	// turns it into the core percentage of every candidate card, using the per-model TFLOPS table.
+	TFLOPSRequest = "hami.io/tflops"
+	// GPUReclaimPriority is the priority of a pod when the scheduler evicts pods to free GPUs
+	// for another one, the pod priority if unset. It doesn't affect the scheduling order.
+	GPUReclaimPriority = "hami.io/gpu-reclaim-priority"
+	// GPUNonPreemptible set to "true" keeps the scheduler from ever evicting the pod to free GPUs
+	// for another one, whatever their reclaim priorities.
+	GPUNonPreemptible = "hami.io/gpu-non-preemptible"
+	// GPUTier set to BestEffort lets the scheduler place the pod on cards whose memory is
+	// oversubscribed, and the device plugin evict it when such a card runs out of memory.
+	// Set to SoftReservation, the memory of the pod yields to the pods of other tiers.
+	GPUTier = "hami.io/gpu-tier"
+	// SoftReservation is the GPUTier of pods which only use spare memory: the scheduler places
+	// other pods as if their memory were free, and shrinks or evicts them to make room.
+	SoftReservation = "soft"
+	// SoftMemoryLimit is the memory per card, in MiB, the scheduler asked a pod of the soft
+	// GPU tier to shrink to. The vGPU monitor lowers the HAMi-core limit of its containers to it.
+	SoftMemoryLimit = "hami.io/gpu-soft-memory-limit"
+	// CostCenter is the cost center the GPU allocations of a pod are charged to. It labels the
+	// allocation metrics and audit records of the scheduler.
+	CostCenter = "hami.io/cost-center"
+	// Encoder declares that a pod uses the NVENC encoders of its cards. EncoderShared lets it
+	// share them with other encoder pods, EncoderExclusive keeps every other encoder pod off its
+	// cards, while pods without encoder use may still share their memory and cores.
+	Encoder          = "hami.io/nvenc"
+	EncoderShared    = "shared"
+	EncoderExclusive = "exclusive"
+	// NamespaceIsolation set to "true" keeps the cards of a pod free of pods of other namespaces,
+	// "false" lets them share cards with any namespace, overriding --isolated-namespaces.
+	NamespaceIsolation = "hami.io/namespace-isolation"
+	// GPUTypeOrder is a comma-separated list of card types, most preferred first. A pod only
+	// accepts the first type at first, and one more type of the list every time it waited
+	// GPUTypeFallbackAfter, or the --gpu-type-fallback-after of the scheduler, for a place.
+	GPUTypeOrder = "hami.io/gpu-type-order"
+	// GPUTypeFallbackAfter overrides the wait per fallback step of GPUTypeOrder for a pod, as a
+	// duration. GPUTypeFallbackNever keeps the pod on the first type.
+	GPUTypeFallbackAfter = "hami.io/gpu-type-fallback-after"
+	GPUTypeFallbackNever = "never"
+	// SchedulingDeadline is how long after its creation, as a duration, a pod may wait for its
+	// devices. A pod still not fitting past it is marked failed instead of staying pending.
+	SchedulingDeadline = "hami.io/scheduling-deadline"
+	// GPUWarmup set to "true" gates the readiness of a pod on its GPU containers reporting their
+	// warmup complete, by creating the file the device plugin names in GPUWarmupDoneEnv,
+	// GPUWarmupDoneFile in their HAMi-core directory. GPUWarmupTimeout, a duration, bounds the
+	// wait, DefaultGPUWarmupTimeout if unset.
+	GPUWarmup               = "hami.io/gpu-warmup"
+	GPUWarmupTimeout        = "hami.io/gpu-warmup-timeout"
+	GPUWarmupCondition      = "hami.io/gpu-warmup"
+	GPUWarmupDoneEnv        = "HAMI_WARMUP_DONE_FILE"
+	GPUWarmupDoneFile       = "warmup-done"
+	DefaultGPUWarmupTimeout = 10 * time.Minute
+	// ScaleDownCheckpoint set to "true" has the vGPU monitor hold the node of the pod back from
+	// a scale-down of the cluster autoscaler until its GPU containers checkpointed. The monitor
+	// creates ScaleDownPendingFile in their HAMi-core directory once the autoscaler finds the node
+	// unneeded, they create ScaleDownReadyFile when done, the device plugin names both in
+	// ScaleDownPendingEnv and ScaleDownReadyEnv. ScaleDownGrace, a duration, bounds the wait,
+	// DefaultScaleDownGrace if unset.
+	ScaleDownCheckpoint   = "hami.io/scale-down-checkpoint"
+	ScaleDownGrace        = "hami.io/scale-down-grace"
+	ScaleDownPendingEnv   = "HAMI_SCALE_DOWN_PENDING_FILE"
+	ScaleDownReadyEnv     = "HAMI_SCALE_DOWN_READY_FILE"
+	ScaleDownPendingFile  = "scale-down-pending"
+	ScaleDownReadyFile    = "scale-down-ready"
+	DefaultScaleDownGrace = 10 * time.Minute
+	// ScaleDownSignaledAt and ScaleDownReleasedAt record on a ScaleDownCheckpoint pod when the
+	// monitor told it of the scale-down and when it let the autoscaler evict it again.
+	ScaleDownSignaledAt = "hami.io/scale-down-signaled-at"
+	ScaleDownReleasedAt = "hami.io/scale-down-released-at"
+	// SafeToEvict is the pod annotation the cluster autoscaler reads: it removes no node with a
+	// pod whose annotation is "false".
+	SafeToEvict = "cluster-autoscaler.kubernetes.io/safe-to-evict"
+	// DeletionCandidateTaint and ToBeDeletedTaint are the taints the cluster autoscaler sets on
+	// the nodes it found unneeded and on the ones it is removing.
+	DeletionCandidateTaint = "DeletionCandidateOfClusterAutoscaler"
+	ToBeDeletedTaint       = "ToBeDeletedByClusterAutoscaler"
+	// NCCLTopology set to "true" lets the device plugin set the NCCL peer to peer variables of
+	// the containers with more than one NVIDIA GPU from the topology of the allocated cards.
+	NCCLTopology = "hami.io/nccl-topology"
+	// Reservation is the token of the reservation a pod consumes: the scheduler places it as if
+	// the capacity held by the reservation were free, and releases the capacity of one pod of it.
+	Reservation = "hami.io/reservation"
+	// GPUMemoryType restricts a pod to cards with the memory technology GPUMemoryTypeHBM or
+	// GPUMemoryTypeGDDR. PreferredGPUMemoryType only makes the scheduler prefer such cards.
+	GPUMemoryType          = "hami.io/gpu-memory-type"
+	PreferredGPUMemoryType = "hami.io/preferred-gpu-memory-type"
+	GPUMemoryTypeHBM       = "hbm"
+	GPUMemoryTypeGDDR      = "gddr"
+	// GPUDeviceKind restricts a pod to physical cards, GPUDeviceKindPhysical, including cards
+	// passed through to a VM whole, or to vendor vGPUs, GPUDeviceKindVirtual, e.g. mediated
+	// or SR-IOV slices of a card in a VM.
+	GPUDeviceKind         = "hami.io/gpu-device-kind"
+	GPUDeviceKindPhysical = "physical"
+	GPUDeviceKindVirtual  = "virtual"
+	// GPUMemoryPadding overrides --gpu-memory-padding for the pod, "0" disables the padding.
+	GPUMemoryPadding = "hami.io/gpu-memory-padding"
+	// GPUMemoryPadded is set by the webhook to the memory requests it padded, e.g.
+	// "train:1000->1256,sidecar:500->756" in MiB, so the padding shows on the pod.
+	GPUMemoryPadded = "hami.io/gpu-memory-padded"
+	// GPUReclaimableMemory set to "true" lets the vGPU monitor lower the memory limit of a pod
+	// whose GPUs were idle for the --idle-memory-reclaim-window to the memory it uses, so other
+	// pods can use the rest, and raise it again once the pod uses its GPUs again.
+	GPUReclaimableMemory = "hami.io/gpu-reclaimable-memory"
+	// GPUIdleMemoryLimit is the memory per card, in MiB, the vGPU monitor lowered the limit of an
+	// idle pod with GPUReclaimableMemory to, shown on the pod. It is removed when the limit is
+	// raised again. Pods can't set it, and nothing trusts it: see GPUIdleMemoryLimits.
+	GPUIdleMemoryLimit = "hami.io/gpu-idle-memory-limit"
+	// GPUIdleMemoryLimits is the node annotation the vGPU monitor of the node keeps the lowered
+	// limits of its idle pods in, a JSON object of the limits in MiB by pod UID. The scheduler
+	// and the monitor account the pods with it.
+	GPUIdleMemoryLimits = "hami.io/gpu-idle-memory-limits"
+	// GPUMinFreeBlock is the contiguous free memory, in MiB, a pod wants on each of its cards,
+	// for allocations of a single large tensor which a fragmented card fails.
+	GPUMinFreeBlock = "hami.io/gpu-min-free-block"
 )
 
 var (
@@ -55,17 +246,19 @@ var (
 
 type ContainerDevice struct {
 	// TODO current Idx cannot use, because EncodeContainerDevices method not encode this filed.
-	Idx       int
-	UUID      string
-	Type      string
-	Usedmem   int32
+	Idx  int
+	UUID string
+	Type string
+	// Usedmem is in bytes, annotations carry it in the native unit of Type.
+	Usedmem   int64
 	Usedcores int32
 }
 
 type ContainerDeviceRequest struct {
-	Nums             int32
-	Type             string
-	Memreq           int32
+	Nums int32
+	Type string
+	// Memreq is in bytes.
+	Memreq           int64
 	MemPercentagereq int32
 	Coresreq         int32
 }
@@ -88,6 +281,11 @@ type MigTemplateUsage struct {
 	Name   string `json:"name,omitempty"`
 	Memory int32  `json:"memory,omitempty"`
 	InUse  bool   `json:"inuse,omitempty"`
+	// Shared is set for an instance in use by pods sharing its compute through HAMi-core core
+	// limits, UsedCores and UsedMem (in bytes) are what they reserved of it.
+	Shared    bool  `json:"shared,omitempty"`
+	UsedCores int32 `json:"usedcores,omitempty"`
+	UsedMem   int64 `json:"usedmem,omitempty"`
 }
 
 type Geometry []MigTemplate
@@ -105,12 +303,15 @@ type AllowedMigGeometries struct {
 }
 
 type DeviceUsage struct {
-	ID          string
-	Index       uint
-	Used        int32
-	Count       int32
-	Usedmem     int32
-	Totalmem    int32
+	ID    string
+	Index uint
+	Used  int32
+	Count int32
+	// Usedmem and Totalmem are in bytes.
+	Usedmem  int64
+	Totalmem int64
+	// Softmem is the part of Usedmem held by pods of the soft GPU tier.
+	Softmem     int64
 	Totalcore   int32
 	Usedcores   int32
 	Mode        string
@@ -119,12 +320,51 @@ type DeviceUsage struct {
 	Numa        int
 	Type        string
 	Health      bool
+	PCIeSwitch  string
+	PerfTier    int
+	// Utilization is the last live utilization sample of the device, nil if unknown.
+	Utilization *DeviceUtilization
+	// Quarantined is set by the device plugin for a card withdrawn after repeated allocation failures.
+	Quarantined bool
+	// Draining is set by the device plugin for a MIG card withdrawn to be re-partitioned.
+	Draining bool
+	// HeldExternally is set by the device plugin for a card another device plugin handed out.
+	HeldExternally bool
+	// ConfidentialCompute is set for a card running in confidential computing mode.
+	ConfidentialCompute bool
+	// Encoder is set for a card with NVENC encoders.
+	Encoder bool
+	// MemoryType is the memory technology of the card, see GPUMemoryType. Empty if unknown.
+	MemoryType string
+	// DeviceKind is whether the card is physical or a vendor vGPU, see GPUDeviceKind. Empty if unknown.
+	DeviceKind string
+	// EncoderPods counts the pods using the encoders of the card, EncoderExclusive is set if
+	// one of them holds them exclusively.
+	EncoderPods      int
+	EncoderExclusive bool
+	// Namespace is the namespace of the pods on the card, MixedNamespaces is set if they come
+	// from more than one. IsolatedNamespace is the namespace of an isolated pod on the card,
+	// see NamespaceIsolation.
+	Namespace         string
+	MixedNamespaces   bool
+	IsolatedNamespace string
+	// MigGeometry is the index into MigTemplate of the geometry the card is partitioned with, nil if unknown.
+	MigGeometry *int
+	// ECCErrors are the ECC error counts of the card, nil if unknown.
+	ECCErrors *DeviceECCErrors
+	// PerformanceState is the P-state of the card, nil if unknown.
+	PerformanceState *int
+	// Temperature is the temperature of the card in degrees Celsius, nil if unknown.
+	Temperature *int
+	// Allocations are the devices allocated on the card, which card rules count by their shape.
+	Allocations []ContainerDevice
 }
 
 type DeviceInfo struct {
-	ID           string     `json:"id,omitempty"`
-	Index        uint       `json:"index,omitempty"`
-	Count        int32      `json:"count,omitempty"`
+	ID    string `json:"id,omitempty"`
+	Index uint   `json:"index,omitempty"`
+	Count int32  `json:"count,omitempty"`
+	// Devmem is in the native memory unit of the vendor, see MemoryUnits.
 	Devmem       int32      `json:"devmem,omitempty"`
 	Devcore      int32      `json:"devcore,omitempty"`
 	Type         string     `json:"type,omitempty"`
@@ -133,6 +373,85 @@ type DeviceInfo struct {
 	MIGTemplate  []Geometry `json:"migtemplate,omitempty"`
 	Health       bool       `json:"health,omitempty"`
 	DeviceVendor string     `json:"devicevendor,omitempty"`
+	PCIeSwitch   string     `json:"pcieswitch,omitempty"`
+	PerfTier     int        `json:"perftier,omitempty"`
+	Quarantined  bool       `json:"quarantined,omitempty"`
+	// Draining is set while the card is withdrawn to be re-partitioned into another MIG geometry.
+	Draining bool `json:"draining,omitempty"`
+	// HeldExternally is set while another device plugin, e.g. the stock NVIDIA one, has handed
+	// the card out to a pod.
+	HeldExternally bool `json:"heldexternally,omitempty"`
+	// ConfidentialCompute is set when the card runs in confidential computing mode, Devmem
+	// is then the memory usable by protected workloads.
+	ConfidentialCompute bool `json:"confidentialcompute,omitempty"`
+	// Encoder is set when the card has NVENC encoders.
+	Encoder bool `json:"encoder,omitempty"`
+	// MemoryType is the memory technology of the card, see GPUMemoryType. Empty if unknown.
+	MemoryType string `json:"memorytype,omitempty"`
+	// DeviceKind is whether the card is physical or a vendor vGPU, see GPUDeviceKind. Empty if unknown.
+	DeviceKind string `json:"devicekind,omitempty"`
+	// Utilization is filled from the utilization node annotation, see DecodeNodeDeviceUtilization.
+	Utilization *DeviceUtilization `json:"utilization,omitempty"`
+	// MigGeometry is the index of the known MIG geometry of the card model the card is
+	// currently partitioned with, nil if it isn't partitioned with a known one.
+	MigGeometry *int `json:"miggeometry,omitempty"`
+	// ECCErrors are the ECC error counts of the card, nil if it has no ECC or they can't be read.
+	ECCErrors *DeviceECCErrors `json:"eccerrors,omitempty"`
+	// PerformanceState is the P-state of the card when the device plugin last registered it,
+	// from 0 (highest performance) to 15 (lowest), nil if NVML can't tell.
+	PerformanceState *int `json:"performancestate,omitempty"`
+	// Temperature is the temperature of the GPU die in degrees Celsius, a drop followed with a
+	// delay so a card which was hot a moment ago still counts as such, nil if NVML can't tell.
+	Temperature *int `json:"temperature,omitempty"`
+}
+
+// DeviceAttributes carries the per-device properties which are not part of the
+// positional register annotation, keyed by device ID in the node annotation.
+type DeviceAttributes struct {
+	PCIeSwitch string `json:"pcieSwitch,omitempty"`
+	// PerfTier ranks cards of the same model by their clock and power caps, 1 (lowest) to 4. 0 means unknown.
+	PerfTier int `json:"perfTier,omitempty"`
+	// Quarantined marks a card the device plugin withdrew after repeated allocation failures.
+	Quarantined bool `json:"quarantined,omitempty"`
+	// Draining marks a MIG card the device plugin withdrew to re-partition it.
+	Draining bool `json:"draining,omitempty"`
+	// HeldExternally marks a card another device plugin handed out to a pod.
+	HeldExternally bool `json:"heldExternally,omitempty"`
+	// ConfidentialCompute marks a card running in confidential computing mode.
+	ConfidentialCompute bool `json:"confidentialCompute,omitempty"`
+	// Encoder marks a card with NVENC encoders.
+	Encoder bool `json:"encoder,omitempty"`
+	// MemoryType is the memory technology of the card, "hbm" or "gddr".
+	MemoryType string `json:"memoryType,omitempty"`
+	// DeviceKind is "physical" for a card, "virtual" for a vendor vGPU.
+	DeviceKind string `json:"deviceKind,omitempty"`
+	// MigGeometry is the index of the MIG geometry the card is currently partitioned with.
+	MigGeometry *int `json:"migGeometry,omitempty"`
+	// ECCErrors are the ECC error counts of the card.
+	ECCErrors *DeviceECCErrors `json:"eccErrors,omitempty"`
+	// PerformanceState is the P-state of the card, 0 (highest performance) to 15.
+	PerformanceState *int `json:"performanceState,omitempty"`
+	// Temperature is the temperature of the card in degrees Celsius.
+	Temperature *int `json:"temperature,omitempty"`
+}
+
+// DeviceECCErrors are the ECC error counts of a device sampled by the device plugin.
+type DeviceECCErrors struct {
+	// Corrected and Uncorrected count the errors since the driver was loaded.
+	Corrected   uint64 `json:"corrected"`
+	Uncorrected uint64 `json:"uncorrected"`
+	// RecentCorrected and RecentUncorrected count the errors of the last 24 hours. Until the
+	// device plugin has run that long, they are all the errors since the driver was loaded.
+	RecentCorrected   uint64 `json:"recentCorrected"`
+	RecentUncorrected uint64 `json:"recentUncorrected"`
+}
+
+// DeviceUtilization is a live utilization sample of a device taken by the device plugin.
+type DeviceUtilization struct {
+	// SM and Memory are the SM and memory bandwidth utilization in percent.
+	SM        int       `json:"sm"`
+	Memory    int       `json:"memory"`
+	Timestamp time.Time `json:"timestamp"`
 }
 
 type NodeInfo struct {
@@ -152,6 +471,8 @@ const (
 	GPUSchedulerPolicyBinpack SchedulerPolicyName = "binpack"
 	// GPUSchedulerPolicySpread is GPU use spread scheduler.
 	GPUSchedulerPolicySpread SchedulerPolicyName = "spread"
+	// GPUSchedulerPolicyRoundRobin is GPU use a weighted round-robin by free memory.
+	GPUSchedulerPolicyRoundRobin SchedulerPolicyName = "roundrobin"
 )
 
 func (s SchedulerPolicyName) String() string {
@@ -48,12 +48,42 @@ var (
 	InRequestDevices map[string]string
 	SupportDevices   map[string]string
 	HandshakeAnnos   map[string]string
+	// MemoryUnits is the size in bytes of the memory unit each device type uses in its
+	// resources and annotations. Device types which are not registered use MiB.
+	MemoryUnits map[string]int64
+	// MemoryShares holds the device types whose memory is a percentage share of a card rather
+	// than a size. Their memory unit is a share, which can't be told in bytes.
+	MemoryShares map[string]bool
 )
 
 func init() {
 	InRequestDevices = make(map[string]string)
 	SupportDevices = make(map[string]string)
 	HandshakeAnnos = make(map[string]string)
+	MemoryUnits = make(map[string]int64)
+	MemoryShares = make(map[string]bool)
+}
+
+func memoryUnit(devType string) int64 {
+	if unit, ok := MemoryUnits[devType]; ok && unit > 0 {
+		return unit
+	}
+	return MiB
+}
+
+// MemoryToBytes converts v from the native memory unit of devType into bytes.
+func MemoryToBytes(devType string, v int64) int64 {
+	return v * memoryUnit(devType)
+}
+
+// MemoryFromBytes converts b bytes into the native memory unit of devType. Partial
+// units are rounded up, so a container never gets less memory than it was scheduled with.
+func MemoryFromBytes(devType string, b int64) int64 {
+	unit := memoryUnit(devType)
+	if b <= 0 {
+		return b / unit
+	}
+	return (b + unit - 1) / unit
 }
 
 func GetNode(nodename string) (*corev1.Node, error) {
@@ -212,6 +242,86 @@ func EncodeNodeDevices(dlist []*DeviceInfo) string {
 	return tmp
 }
 
+// EncodeNodeDeviceAttributes encodes the extra attributes of dlist as a JSON object keyed by device ID.
+func EncodeNodeDeviceAttributes(dlist []*DeviceInfo) string {
+	attrs := make(map[string]DeviceAttributes, len(dlist))
+	for _, val := range dlist {
+		attrs[val.ID] = DeviceAttributes{
+			PCIeSwitch:          val.PCIeSwitch,
+			PerfTier:            val.PerfTier,
+			Quarantined:         val.Quarantined,
+			Draining:            val.Draining,
+			HeldExternally:      val.HeldExternally,
+			ConfidentialCompute: val.ConfidentialCompute,
+			Encoder:             val.Encoder,
+			MemoryType:          val.MemoryType,
+			DeviceKind:          val.DeviceKind,
+			MigGeometry:         val.MigGeometry,
+			ECCErrors:           val.ECCErrors,
+			PerformanceState:    val.PerformanceState,
+			Temperature:         val.Temperature,
+		}
+	}
+	data, err := json.Marshal(attrs)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// DecodeNodeDeviceAttributes fills the extra attributes encoded in str into the matching devices of dlist.
+func DecodeNodeDeviceAttributes(str string, dlist []*DeviceInfo) error {
+	attrs := make(map[string]DeviceAttributes)
+	if err := json.Unmarshal([]byte(str), &attrs); err != nil {
+		return err
+	}
+	for _, val := range dlist {
+		attr, ok := attrs[val.ID]
+		if !ok {
+			continue
+		}
+		val.PCIeSwitch = attr.PCIeSwitch
+		val.PerfTier = attr.PerfTier
+		val.Quarantined = attr.Quarantined
+		val.Draining = attr.Draining
+		val.HeldExternally = attr.HeldExternally
+		val.ConfidentialCompute = attr.ConfidentialCompute
+		val.Encoder = attr.Encoder
+		val.MemoryType = attr.MemoryType
+		val.DeviceKind = attr.DeviceKind
+		val.MigGeometry = attr.MigGeometry
+		val.ECCErrors = attr.ECCErrors
+		val.PerformanceState = attr.PerformanceState
+		val.Temperature = attr.Temperature
+	}
+	return nil
+}
+
+// EncodeNodeDeviceUtilization encodes utilization samples keyed by device ID.
+func EncodeNodeDeviceUtilization(utils map[string]DeviceUtilization) string {
+	data, err := json.Marshal(utils)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// DecodeNodeDeviceUtilization fills the utilization samples encoded in str into the matching devices of dlist.
+func DecodeNodeDeviceUtilization(str string, dlist []*DeviceInfo) error {
+	utils := make(map[string]DeviceUtilization)
+	if err := json.Unmarshal([]byte(str), &utils); err != nil {
+		return err
+	}
+	for _, val := range dlist {
+		u, ok := utils[val.ID]
+		if !ok {
+			continue
+		}
+		val.Utilization = &u
+	}
+	return nil
+}
+
 func MarshalNodeDevices(dlist []*DeviceInfo) string {
 	data, err := json.Marshal(dlist)
 	if err != nil {
@@ -229,7 +339,7 @@ func UnMarshalNodeDevices(str string) ([]*DeviceInfo, error) {
 func EncodeContainerDevices(cd ContainerDevices) string {
 	tmp := ""
 	for _, val := range cd {
-		tmp += val.UUID + "," + val.Type + "," + strconv.Itoa(int(val.Usedmem)) + "," + strconv.Itoa(int(val.Usedcores)) + OneContainerMultiDeviceSplitSymbol
+		tmp += val.UUID + "," + val.Type + "," + strconv.FormatInt(MemoryFromBytes(val.Type, val.Usedmem), 10) + "," + strconv.Itoa(int(val.Usedcores)) + OneContainerMultiDeviceSplitSymbol
 	}
 	klog.Infof("Encoded container Devices: %s", tmp)
 	return tmp
@@ -240,7 +350,7 @@ func EncodeContainerDeviceType(cd ContainerDevices, t string) string {
 	tmp := ""
 	for _, val := range cd {
 		if strings.Compare(val.Type, t) == 0 {
-			tmp += val.UUID + "," + val.Type + "," + strconv.Itoa(int(val.Usedmem)) + "," + strconv.Itoa(int(val.Usedcores))
+			tmp += val.UUID + "," + val.Type + "," + strconv.FormatInt(MemoryFromBytes(val.Type, val.Usedmem), 10) + "," + strconv.Itoa(int(val.Usedcores))
 		}
 		tmp += OneContainerMultiDeviceSplitSymbol
 	}
@@ -288,8 +398,8 @@ func DecodeContainerDevices(str string) (ContainerDevices, error) {
 			}
 			tmpdev.UUID = tmpstr[0]
 			tmpdev.Type = tmpstr[1]
-			devmem, _ := strconv.ParseInt(tmpstr[2], 10, 32)
-			tmpdev.Usedmem = int32(devmem)
+			devmem, _ := strconv.ParseInt(tmpstr[2], 10, 64)
+			tmpdev.Usedmem = MemoryToBytes(tmpdev.Type, devmem)
 			devcores, _ := strconv.ParseInt(tmpstr[3], 10, 32)
 			tmpdev.Usedcores = int32(devcores)
 			contdev = append(contdev, tmpdev)
@@ -310,6 +420,10 @@ func DecodePodDevices(checklist map[string]string, annos map[string]string) (Pod
 		if !ok {
 			continue
 		}
+		str, err := ExpandDevicesAnnotation(str)
+		if err != nil {
+			return PodDevices{}, err
+		}
 		pd[devID] = make(PodSingleDevice, 0)
 		for _, s := range strings.Split(str, OnePodMultiContainerSplitSymbol) {
 			cd, err := DecodeContainerDevices(s)
@@ -22,9 +22,11 @@ import (
 	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	"gotest.tools/v3/assert"
 	corev1 "k8s.io/api/core/v1"
+	apivalidation "k8s.io/apimachinery/pkg/api/validation"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/fake"
 
@@ -142,7 +144,7 @@ func TestPodDevicesCoding(t *testing.T) {
 			args: PodDevices{
 				"NVIDIA": PodSingleDevice{
 					ContainerDevices{
-						ContainerDevice{0, "UUID1", "Type1", 1000, 30},
+						ContainerDevice{0, "UUID1", "Type1", 1000 * MiB, 30},
 					},
 				},
 			},
@@ -152,10 +154,10 @@ func TestPodDevicesCoding(t *testing.T) {
 			args: PodDevices{
 				"NVIDIA": PodSingleDevice{
 					ContainerDevices{
-						ContainerDevice{0, "UUID1", "Type1", 1000, 30},
+						ContainerDevice{0, "UUID1", "Type1", 1000 * MiB, 30},
 					},
 					ContainerDevices{
-						ContainerDevice{0, "UUID1", "Type1", 1000, 30},
+						ContainerDevice{0, "UUID1", "Type1", 1000 * MiB, 30},
 					},
 				},
 			},
@@ -165,8 +167,8 @@ func TestPodDevicesCoding(t *testing.T) {
 			args: PodDevices{
 				"NVIDIA": PodSingleDevice{
 					ContainerDevices{
-						ContainerDevice{0, "UUID1", "Type1", 1000, 30},
-						ContainerDevice{0, "UUID2", "Type1", 1000, 30},
+						ContainerDevice{0, "UUID1", "Type1", 1000 * MiB, 30},
+						ContainerDevice{0, "UUID2", "Type1", 1000 * MiB, 30},
 					},
 				},
 			},
@@ -225,7 +227,7 @@ func Test_DecodePodDevices(t *testing.T) {
 						{
 							UUID:      "GPU-8dcd427f-483b-b48f-d7e5-75fb19a52b76",
 							Type:      "NVIDIA",
-							Usedmem:   500,
+							Usedmem:   500 * MiB,
 							Usedcores: 3,
 						},
 					},
@@ -233,7 +235,7 @@ func Test_DecodePodDevices(t *testing.T) {
 						{
 							UUID:      "GPU-ebe7c3f7-303d-558d-435e-99a160631fe4",
 							Type:      "NVIDIA",
-							Usedmem:   500,
+							Usedmem:   500 * MiB,
 							Usedcores: 3,
 						},
 					},
@@ -533,6 +535,130 @@ func Test_EncodeNodeDevices(t *testing.T) {
 	}
 }
 
+// TestAnnotationSizes checks that the annotations holding devices stay far below the limit of
+// the annotations of an object on dense nodes: the node annotations list every card once,
+// whatever the number of pods sharing it, and the assignments live on the pods themselves.
+func TestAnnotationSizes(t *testing.T) {
+	var cards []*DeviceInfo
+	for i := 0; i < 16; i++ {
+		cards = append(cards, &DeviceInfo{
+			ID: fmt.Sprintf("GPU-ebe7c3f7-303d-558d-435e-99a160631f%02d", i), Index: uint(i), Count: 1000,
+			Devmem: 196608, Devcore: 100, Type: "NVIDIA-NVIDIA H200 NVL", Numa: 1, Mode: "hami-core", Health: true,
+			PCIeSwitch: "0000:00:01.0", PerfTier: 4, Encoder: true, MemoryType: GPUMemoryTypeHBM,
+		})
+	}
+	nodeSize := len(EncodeNodeDevices(cards)) + len(EncodeNodeDeviceAttributes(cards))
+	assert.Assert(t, nodeSize < 8*1024, "node annotations of 16 cards take %d bytes", nodeSize)
+
+	// A pod with 64 containers of 8 MIG instances each.
+	pd := PodSingleDevice{}
+	for c := 0; c < 64; c++ {
+		ctr := ContainerDevices{}
+		for i := 0; i < 8; i++ {
+			ctr = append(ctr, ContainerDevice{UUID: fmt.Sprintf("%s[3-%d]", cards[i].ID, c%7), Type: "NVIDIA", Usedmem: 24576 * MiB, Usedcores: 14})
+		}
+		pd = append(pd, ctr)
+	}
+	podSize := 0
+	for _, v := range EncodePodDevices(inRequestDevices, PodDevices{"NVIDIA": pd}) {
+		podSize += len(v)
+	}
+	assert.Assert(t, podSize < apivalidation.TotalAnnotationSizeLimitB/4, "assignments of 512 devices take %d bytes", podSize)
+}
+
+func TestNodeDeviceAttributesCoding(t *testing.T) {
+	pstate, temperature := 8, 71
+	devices := []*DeviceInfo{
+		{ID: "GPU-0", PCIeSwitch: "0000:3b:00.0", PerfTier: 3, Quarantined: true, Draining: true, HeldExternally: true, ConfidentialCompute: true, Encoder: true, MemoryType: GPUMemoryTypeHBM, DeviceKind: GPUDeviceKindVirtual,
+			ECCErrors: &DeviceECCErrors{Corrected: 12, Uncorrected: 1, RecentCorrected: 4}, PerformanceState: &pstate, Temperature: &temperature},
+		{ID: "GPU-1"},
+	}
+	encoded := EncodeNodeDeviceAttributes(devices)
+	decoded := []*DeviceInfo{{ID: "GPU-0"}, {ID: "GPU-1"}, {ID: "GPU-2"}}
+	assert.NilError(t, DecodeNodeDeviceAttributes(encoded, decoded))
+	assert.Equal(t, decoded[0].PCIeSwitch, "0000:3b:00.0")
+	assert.Equal(t, decoded[0].PerfTier, 3)
+	assert.Equal(t, decoded[0].Quarantined, true)
+	assert.Equal(t, decoded[1].Quarantined, false)
+	assert.Equal(t, decoded[0].Draining, true)
+	assert.Equal(t, decoded[1].Draining, false)
+	assert.Equal(t, decoded[0].HeldExternally, true)
+	assert.Equal(t, decoded[1].HeldExternally, false)
+	assert.Equal(t, decoded[0].ConfidentialCompute, true)
+	assert.Equal(t, decoded[1].ConfidentialCompute, false)
+	assert.Equal(t, decoded[0].Encoder, true)
+	assert.Equal(t, decoded[1].Encoder, false)
+	assert.Equal(t, decoded[0].MemoryType, GPUMemoryTypeHBM)
+	assert.Equal(t, decoded[1].MemoryType, "")
+	assert.Equal(t, decoded[0].DeviceKind, GPUDeviceKindVirtual)
+	assert.Equal(t, decoded[1].DeviceKind, "")
+	assert.DeepEqual(t, decoded[0].ECCErrors, &DeviceECCErrors{Corrected: 12, Uncorrected: 1, RecentCorrected: 4})
+	assert.Assert(t, decoded[1].ECCErrors == nil)
+	assert.DeepEqual(t, decoded[0].PerformanceState, &pstate)
+	assert.Assert(t, decoded[1].PerformanceState == nil)
+	assert.DeepEqual(t, decoded[0].Temperature, &temperature)
+	assert.Assert(t, decoded[1].Temperature == nil)
+	assert.Equal(t, decoded[1].PCIeSwitch, "")
+	assert.Equal(t, decoded[2].PCIeSwitch, "")
+	assert.Assert(t, DecodeNodeDeviceAttributes("not json", decoded) != nil)
+}
+
+func TestNodeDeviceUtilizationCoding(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	encoded := EncodeNodeDeviceUtilization(map[string]DeviceUtilization{
+		"GPU-0": {SM: 80, Memory: 35, Timestamp: ts},
+	})
+	decoded := []*DeviceInfo{{ID: "GPU-0"}, {ID: "GPU-1"}}
+	assert.NilError(t, DecodeNodeDeviceUtilization(encoded, decoded))
+	assert.Equal(t, decoded[0].Utilization.SM, 80)
+	assert.Equal(t, decoded[0].Utilization.Memory, 35)
+	assert.Assert(t, decoded[0].Utilization.Timestamp.Equal(ts))
+	assert.Assert(t, decoded[1].Utilization == nil)
+	assert.Assert(t, DecodeNodeDeviceUtilization("not json", decoded) != nil)
+}
+
+func TestMemoryUnitConversion(t *testing.T) {
+	MemoryUnits["TestPercent"] = 1
+	MemoryUnits["TestGiB"] = 1 << 30
+	defer delete(MemoryUnits, "TestPercent")
+	defer delete(MemoryUnits, "TestGiB")
+
+	tests := []struct {
+		devType string
+		value   int64
+		bytes   int64
+	}{
+		{devType: "Unregistered", value: 1024, bytes: 1024 * MiB},
+		{devType: "TestPercent", value: 30, bytes: 30},
+		{devType: "TestGiB", value: 80, bytes: 80 << 30},
+		{devType: "TestGiB", value: 0, bytes: 0},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s/%d", test.devType, test.value), func(t *testing.T) {
+			assert.Equal(t, MemoryToBytes(test.devType, test.value), test.bytes)
+			assert.Equal(t, MemoryFromBytes(test.devType, test.bytes), test.value)
+		})
+	}
+	// Partial units are rounded up rather than truncated.
+	assert.Equal(t, MemoryFromBytes("TestGiB", 1), int64(1))
+	assert.Equal(t, MemoryFromBytes("Unregistered", 3*MiB+1), int64(4))
+}
+
+func TestContainerDevicesMemoryRoundTrip(t *testing.T) {
+	MemoryUnits["TestGiB"] = 1 << 30
+	defer delete(MemoryUnits, "TestGiB")
+
+	cd := ContainerDevices{
+		{Idx: 0, UUID: "GPU-0", Type: "NVIDIA", Usedmem: 3000 * MiB, Usedcores: 30},
+		{Idx: 0, UUID: "DEV-1", Type: "TestGiB", Usedmem: 16 << 30, Usedcores: 50},
+	}
+	s := EncodeContainerDevices(cd)
+	assert.Equal(t, s, "GPU-0,NVIDIA,3000,30:DEV-1,TestGiB,16,50:")
+	got, err := DecodeContainerDevices(s)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, got, cd)
+}
+
 func Test_CheckHealth(t *testing.T) {
 	tests := []struct {
 		name string